@@ -13,6 +13,9 @@ import (
 func main() {
 	// profiler.StartProfiling()
 	// defer profiler.StopProfiling()
+	if len(os.Args) > 1 && os.Args[1] == "doctor" {
+		os.Exit(app.RunDoctor(os.Args[2:]))
+	}
 	a := app.NewApp()
 	err := a.ParseFlags()
 	if err != nil {
@@ -22,6 +25,9 @@ func main() {
 	a.SetupRouter()
 	a.StartServer()
 	defer func(db *sql.DB) {
+		if db == nil {
+			return
+		}
 		err = db.Close()
 		if err != nil {
 			return
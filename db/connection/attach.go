@@ -0,0 +1,252 @@
+package connection
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Attachment is a SQLite database file attached to a connection under an alias,
+// its tables being read as alias.table.
+type Attachment struct {
+	Alias string `json:"alias"`
+	Path  string `json:"path"`
+}
+
+// aliasPattern is what an alias may look like, so it never needs quoting.
+var aliasPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// validate checks the alias and that the file exists; ATTACH would otherwise create an empty database.
+func (a Attachment) validate() error {
+	if !aliasPattern.MatchString(a.Alias) {
+		return fmt.Errorf("invalid alias %q: use letters, digits and underscores", a.Alias)
+	}
+	if strings.EqualFold(a.Alias, "main") || strings.EqualFold(a.Alias, "temp") {
+		return fmt.Errorf("alias %s is reserved", a.Alias)
+	}
+	if a.Path == "" {
+		return errors.New("path cannot be empty")
+	}
+	info, err := os.Stat(a.Path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", a.Path)
+	}
+	return nil
+}
+
+// sqliteConnector opens the connections of a SQLite pool, attaching the attached databases to each:
+// ATTACH only applies to the connection it runs on, and the pool opens new ones at any time.
+type sqliteConnector struct {
+	dsn    string
+	driver *sqlite3.SQLiteDriver
+	// memory is set for an in-memory database, which is lost once its only connection closes
+	memory bool
+	// db is the pool of the connector, its key in sqliteConnectors
+	db *sql.DB
+
+	mu       sync.Mutex
+	attached []Attachment
+}
+
+// Connect opens a connection with the attached databases attached. A database that can no longer be attached,
+// e.g. a file deleted since, is left out so that the main database stays usable; its tables are missing until
+// it is detached and attached again.
+func (sc *sqliteConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := sc.driver.Open(sc.dsn)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range sc.attachments() {
+		// ATTACH would create a missing file
+		if a.validate() != nil {
+			continue
+		}
+		_, _ = conn.(*sqlite3.SQLiteConn).ExecContext(ctx, fmt.Sprintf(`ATTACH DATABASE ? AS "%s"`, a.Alias),
+			[]driver.NamedValue{{Ordinal: 1, Value: a.Path}})
+	}
+	return conn, nil
+}
+
+func (sc *sqliteConnector) Driver() driver.Driver {
+	return sc.driver
+}
+
+// Close forgets the connector; sql.DB calls it when the pool is closed.
+func (sc *sqliteConnector) Close() error {
+	sqliteConnectorsMu.Lock()
+	delete(sqliteConnectors, sc.db)
+	sqliteConnectorsMu.Unlock()
+	return nil
+}
+
+func (sc *sqliteConnector) attachments() []Attachment {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return append([]Attachment(nil), sc.attached...)
+}
+
+// add records the attachment, for the connections opened from now on.
+func (sc *sqliteConnector) add(a Attachment) error {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	for _, attached := range sc.attached {
+		if strings.EqualFold(attached.Alias, a.Alias) {
+			return fmt.Errorf("a database is already attached as %s", attached.Alias)
+		}
+	}
+	sc.attached = append(sc.attached, a)
+	return nil
+}
+
+// remove forgets the attachment under the alias, reporting whether there was one.
+func (sc *sqliteConnector) remove(alias string) bool {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	for i, attached := range sc.attached {
+		if strings.EqualFold(attached.Alias, alias) {
+			sc.attached = append(sc.attached[:i], sc.attached[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	sqliteConnectorsMu sync.Mutex
+	// sqliteConnectors are the connectors of the open SQLite pools, for Attach and Detach
+	sqliteConnectors = make(map[*sql.DB]*sqliteConnector)
+)
+
+// openSQLite opens a pool on the SQLite connection, with its attachments attached to every connection.
+func openSQLite(c *Connection) (*sql.DB, error) {
+	for _, a := range c.Attached {
+		if err := a.validate(); err != nil {
+			return nil, fmt.Errorf("cannot attach %s: %w", a.Alias, err)
+		}
+	}
+	connector := &sqliteConnector{
+		dsn:      c.sqliteDSN(),
+		driver:   &sqlite3.SQLiteDriver{},
+		memory:   c.Path == ":memory:" || strings.Contains(c.Path, "mode=memory"),
+		attached: append([]Attachment(nil), c.Attached...),
+	}
+	db := sql.OpenDB(connector)
+	connector.db = db
+	sqliteConnectorsMu.Lock()
+	sqliteConnectors[db] = connector
+	sqliteConnectorsMu.Unlock()
+	return db, nil
+}
+
+func sqliteConnectorOf(db *sql.DB) (*sqliteConnector, error) {
+	sqliteConnectorsMu.Lock()
+	defer sqliteConnectorsMu.Unlock()
+	connector, ok := sqliteConnectors[db]
+	if !ok {
+		return nil, errors.New("databases can only be attached to a SQLite connection")
+	}
+	return connector, nil
+}
+
+// Attached returns the databases attached to the SQLite pool, nil for other pools.
+func Attached(db *sql.DB) []Attachment {
+	connector, err := sqliteConnectorOf(db)
+	if err != nil {
+		return nil
+	}
+	return connector.attachments()
+}
+
+// Attach attaches the database file to every connection of the SQLite pool under the alias.
+// Idle connections are closed so the pool reopens them with the file attached; a connection
+// busy in a request meanwhile does not see it until it is reopened. An in-memory database only
+// has the one connection, which closing would wipe, so the file is attached to it in place.
+func Attach(db *sql.DB, a Attachment) error {
+	connector, err := sqliteConnectorOf(db)
+	if err != nil {
+		return err
+	}
+	if err = a.validate(); err != nil {
+		return err
+	}
+
+	if err = connector.add(a); err != nil {
+		return err
+	}
+	if connector.memory {
+		// the pool is limited to a single connection, which Exec runs on
+		_, err = db.Exec(fmt.Sprintf(`ATTACH DATABASE ? AS "%s"`, a.Alias), a.Path)
+		if err != nil {
+			connector.remove(a.Alias)
+			return fmt.Errorf("failed to attach %s: %w", a.Alias, err)
+		}
+	} else {
+		reopenConnections(db)
+	}
+	// reading the attached schema fails if the file is not a database
+	if err = checkAttached(db, a.Alias); err != nil {
+		_ = Detach(db, a.Alias)
+		return err
+	}
+	return nil
+}
+
+// Detach detaches the database attached under the alias from every connection of the SQLite pool.
+func Detach(db *sql.DB, alias string) error {
+	connector, err := sqliteConnectorOf(db)
+	if err != nil {
+		return err
+	}
+
+	if !connector.remove(alias) {
+		return fmt.Errorf("no database is attached as %s", alias)
+	}
+
+	if connector.memory {
+		// the file may already be missing from the connection if it could not be attached
+		_, _ = db.Exec(fmt.Sprintf(`DETACH DATABASE "%s"`, alias))
+		return nil
+	}
+	reopenConnections(db)
+	return nil
+}
+
+// reopenConnections closes the idle connections of the pool, which opens new ones as requests need them.
+func reopenConnections(db *sql.DB) {
+	db.SetMaxIdleConns(0)
+	db.SetMaxIdleConns(defaultMaxIdleConns)
+}
+
+// defaultMaxIdleConns is the number of idle connections database/sql keeps by default.
+const defaultMaxIdleConns = 2
+
+func checkAttached(db *sql.DB, alias string) error {
+	var (
+		name string
+		err  error
+	)
+	err = db.QueryRow(`SELECT name FROM pragma_database_list WHERE name = ?`, alias).Scan(&name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to attach %s: the file cannot be opened", alias)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to attach %s: %w", alias, err)
+	}
+	// reading the schema fails when the file is not a SQLite database
+	_, err = db.Exec(fmt.Sprintf(`SELECT count(*) FROM "%s".sqlite_master`, alias))
+	if err != nil {
+		return fmt.Errorf("failed to attach %s: %w", alias, err)
+	}
+	return nil
+}
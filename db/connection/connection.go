@@ -1,10 +1,18 @@
 package connection
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
 	"strings"
+	"time"
 
 	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
@@ -16,13 +24,139 @@ type Connection struct {
 	Host     string      `json:"host"`
 	Port     int         `json:"port"`
 	User     string      `json:"user"`
-	Password string      `json:"password"`
+	Password string      `json:"password,omitempty"`
 	Name     string      `json:"database"`
 	Type     _sql.DbType `json:"databaseType"`
 	Path     string      `json:"path"`
+	// Label and Color are optional cues that tell saved connections apart in the UI, e.g. "prod" in red
+	Label string `json:"label,omitempty"`
+	Color string `json:"color,omitempty"`
+	// Environment tags the connection, e.g. "staging"; production connections always confirm destructive operations
+	Environment string `json:"environment,omitempty"`
+	// LastUsedAt is when a saved connection was last connected to, nil until it is
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	// Credentials, when set, tell how to mint the password at connect time instead of storing it, e.g. an IAM auth token
+	Credentials *Credentials `json:"credentials,omitempty"`
+	// BusyTimeout (in milliseconds), JournalMode and ForeignKeys override the defaults of SQLite connections, see sqliteDSN
+	BusyTimeout *int   `json:"busyTimeout,omitempty"`
+	JournalMode string `json:"journalMode,omitempty"`
+	ForeignKeys *bool  `json:"foreignKeys,omitempty"`
+	// Attached are the SQLite database files attached to the connection, attached again on every connect
+	Attached []Attachment `json:"attached,omitempty"`
+	// ApplicationName tags the sessions of MySQL and PostgreSQL connections for server monitoring,
+	// DefaultApplicationName when empty, see CheckApplicationName
+	ApplicationName string `json:"applicationName,omitempty"`
+	// SafeMode makes /execute return the plan of each statement and run it only once confirmed,
+	// the default of the session's safe mode
+	SafeMode bool `json:"safeMode,omitempty"`
+	// Settings are defaults of the requests made on this connection, e.g. a short timeout for production
+	Settings Settings `json:"settings"`
+}
+
+// Settings are per-connection defaults, used when a request does not set its own. Zero leaves the
+// server's behavior: no default page size, no statement timeout and exports of every row.
+type Settings struct {
+	DefaultPerPage     int `json:"defaultPerPage"`
+	StatementTimeoutMs int `json:"statementTimeoutMs"`
+	MaxExportRows      int `json:"maxExportRows"`
+	// StreamBatchRows is how many rows a streamed export sends to the client at once, 0 for the default
+	StreamBatchRows int `json:"streamBatchRows,omitempty"`
+	// ProtectedColumns are "table.column" patterns of the columns that cannot be edited, e.g. "*.created_at"
+	ProtectedColumns []string `json:"protectedColumns,omitempty"`
+	// ExportExcludedColumns are "table.column" patterns of the columns left out of every export, e.g. "users.ssn"
+	ExportExcludedColumns []string `json:"exportExcludedColumns,omitempty"`
+}
+
+// Validate checks that no setting is negative and that every column pattern is well formed.
+func (s Settings) Validate() error {
+	switch {
+	case s.DefaultPerPage < 0:
+		return fmt.Errorf("invalid defaultPerPage: %d", s.DefaultPerPage)
+	case s.StatementTimeoutMs < 0:
+		return fmt.Errorf("invalid statementTimeoutMs: %d", s.StatementTimeoutMs)
+	case s.MaxExportRows < 0:
+		return fmt.Errorf("invalid maxExportRows: %d", s.MaxExportRows)
+	case s.StreamBatchRows < 0:
+		return fmt.Errorf("invalid streamBatchRows: %d", s.StreamBatchRows)
+	}
+	if err := validateColumnPatterns("protected column", s.ProtectedColumns); err != nil {
+		return err
+	}
+	return validateColumnPatterns("export excluded column", s.ExportExcludedColumns)
+}
+
+// validateColumnPatterns checks that every pattern is a "table.column" pair of valid path.Match patterns.
+func validateColumnPatterns(kind string, patterns []string) error {
+	for _, pattern := range patterns {
+		table, column, ok := strings.Cut(pattern, ".")
+		if !ok || table == "" || column == "" {
+			return fmt.Errorf("invalid %s %q: expected table.column", kind, pattern)
+		}
+		if _, err := path.Match(table, ""); err != nil {
+			return fmt.Errorf("invalid %s %q: %w", kind, pattern, err)
+		}
+		if _, err := path.Match(column, ""); err != nil {
+			return fmt.Errorf("invalid %s %q: %w", kind, pattern, err)
+		}
+	}
+	return nil
+}
+
+// Protects reports whether a protected column pattern matches the column of the table. Patterns are
+// matched without regard to case, and their table and column parts can hold wildcards, see path.Match.
+func (s Settings) Protects(table, column string) bool {
+	return matchColumnPatterns(s.ProtectedColumns, table, column)
+}
+
+// ExcludesFromExport reports whether an export excluded column pattern matches the column of the table,
+// matched like protected columns, see Protects.
+func (s Settings) ExcludesFromExport(table, column string) bool {
+	return matchColumnPatterns(s.ExportExcludedColumns, table, column)
+}
+
+// matchColumnPatterns reports whether one of the "table.column" patterns matches the column of the table.
+func matchColumnPatterns(patterns []string, table, column string) bool {
+	for _, pattern := range patterns {
+		tablePattern, columnPattern, ok := strings.Cut(strings.ToLower(pattern), ".")
+		if !ok {
+			continue
+		}
+		tableMatch, _ := path.Match(tablePattern, strings.ToLower(table))
+		columnMatch, _ := path.Match(columnPattern, strings.ToLower(column))
+		if tableMatch && columnMatch {
+			return true
+		}
+	}
+	return false
+}
+
+// Defaults of SQLite connections. Waiting on a busy database rather than failing at once, and letting
+// readers run alongside the writer with WAL, avoids "database is locked" errors on concurrent requests.
+const (
+	DefaultBusyTimeout = 5000
+	DefaultJournalMode = "WAL"
+)
+
+// DefaultApplicationName is the application name of connections that do not set one.
+const DefaultApplicationName = "sqlweb"
+
+// EnvProduction is the environment of production connections.
+const EnvProduction = "production"
+
+// IsProduction reports whether the connection is tagged as production.
+func (c *Connection) IsProduction() bool {
+	return strings.EqualFold(strings.TrimSpace(c.Environment), EnvProduction)
+}
+
+// Redacted returns a copy of the connection without its password, to share its definition.
+func (c Connection) Redacted() Connection {
+	c.Password = ""
+	return c
 }
 
 // UnmarshalJSON customizes the JSON unmarshaling for the Connection type.
+// A databaseType that names no supported database is an error; a missing one, or the
+// "Unsupported" an unset type is marshaled as, leaves the type unset for CheckRequired to report.
 func (c *Connection) UnmarshalJSON(data []byte) error {
 	type clientAlias Connection
 	aux := &struct {
@@ -32,7 +166,15 @@ func (c *Connection) UnmarshalJSON(data []byte) error {
 	if err := json.Unmarshal(data, &aux); err != nil {
 		return err
 	}
-	c.Type = parseDbType(aux.Type)
+	if aux.Type == "" || aux.Type == _sql.Unsupported.String() {
+		c.Type = _sql.Unsupported
+		return nil
+	}
+	dbType, err := parseDbType(aux.Type)
+	if err != nil {
+		return err
+	}
+	c.Type = dbType
 	return nil
 }
 
@@ -47,41 +189,161 @@ func (c *Connection) MarshalJSON() ([]byte, error) {
 	return json.Marshal(aux)
 }
 
+// dbTypeAliases are the names accepted as databaseType, ignoring case, besides those of the types themselves.
+var dbTypeAliases = map[string]_sql.DbType{
+	"mariadb":  _sql.MySQL,
+	"postgres": _sql.PostgreSQL,
+	"pg":       _sql.PostgreSQL,
+	"sqlite3":  _sql.SQLite,
+}
+
+// AcceptedDbTypes describes the values accepted as databaseType, for error messages.
+const AcceptedDbTypes = "MySQL, PostgreSQL or SQLite, ignoring case, or one of the aliases mariadb, postgres, pg and sqlite3"
+
 // parseDbType converts a string representation of a database type to a DbType constant.
-func parseDbType(dbType string) _sql.DbType {
-	switch strings.ToLower(dbType) {
+func parseDbType(dbType string) (_sql.DbType, error) {
+	name := strings.ToLower(strings.TrimSpace(dbType))
+	switch name {
 	case "mysql":
-		return _sql.MySQL
+		return _sql.MySQL, nil
 	case "postgresql":
-		return _sql.PostgreSQL
+		return _sql.PostgreSQL, nil
 	case "sqlite":
-		return _sql.SQLite
+		return _sql.SQLite, nil
+	}
+	if t, ok := dbTypeAliases[name]; ok {
+		return t, nil
+	}
+	return _sql.Unsupported, fmt.Errorf("invalid databaseType %q: expected %s", dbType, AcceptedDbTypes)
+}
+
+// CheckRequired checks that the connection has what dialing its database needs: a supported
+// databaseType, a host for MySQL and PostgreSQL, and a path for SQLite.
+func (c *Connection) CheckRequired() error {
+	switch c.Type {
+	case _sql.MySQL, _sql.PostgreSQL:
+		if strings.TrimSpace(c.Host) == "" {
+			return fmt.Errorf("host is required for %s connections", c.Type.String())
+		}
+	case _sql.SQLite:
+		if strings.TrimSpace(c.Path) == "" {
+			return errors.New("path is required for SQLite connections")
+		}
 	default:
-		return _sql.Unsupported
+		return fmt.Errorf("databaseType is required: expected %s", AcceptedDbTypes)
+	}
+	return nil
+}
+
+// CheckApplicationName checks that the application name of the connection can be sent to the server:
+// MySQL connection attributes are a comma separated list, and PostgreSQL only keeps the first 63 bytes.
+func (c *Connection) CheckApplicationName() error {
+	switch {
+	case strings.Contains(c.ApplicationName, ","):
+		return fmt.Errorf("invalid applicationName %q: must not contain a comma", c.ApplicationName)
+	case len(c.ApplicationName) > 63:
+		return fmt.Errorf("invalid applicationName %q: longer than 63 bytes", c.ApplicationName)
 	}
+	return nil
+}
+
+// applicationName returns the name the sessions of the connection are tagged with.
+func (c *Connection) applicationName() string {
+	if name := strings.TrimSpace(c.ApplicationName); name != "" {
+		return name
+	}
+	return DefaultApplicationName
+}
+
+// mySqlConnectionAttributes returns the connection attributes MySQL lists in
+// performance_schema.session_connect_attrs, where program_name names the client.
+func (c *Connection) mySqlConnectionAttributes() string {
+	return "program_name:" + c.applicationName()
 }
 
 // mySqlUrl generates a MySQL-specific database connection URL.
 func (c *Connection) mySqlUrl() string {
 	return fmt.Sprintf(
-		"%s:%s@tcp(%s:%d)/%s",
+		"%s:%s@tcp(%s:%d)/%s?connectionAttributes=%s",
 		c.User,
 		c.Password,
 		c.Host,
 		c.Port,
-		c.Name,
+		// the driver unescapes the database name
+		url.PathEscape(c.Name),
+		url.QueryEscape(c.mySqlConnectionAttributes()),
 	)
 }
 
+// SameDataSource reports whether a pool opened for one connection serves the other as is: both reach the same
+// database with the same credentials and every other setting of their data source names. Hosts are compared
+// case-insensitively and SQLite paths once cleaned; labels, settings and attachments are not part of it.
+func SameDataSource(a, b *Connection) bool {
+	if a.Type != b.Type || !reflect.DeepEqual(a.Credentials, b.Credentials) {
+		return false
+	}
+	if a.Type == _sql.SQLite {
+		x, y := *a, *b
+		x.Path, y.Path = filepath.Clean(a.Path), filepath.Clean(b.Path)
+		return x.sqliteDSN() == y.sqliteDSN()
+	}
+	return strings.EqualFold(a.Host, b.Host) && a.Port == b.Port && a.User == b.User && a.Password == b.Password &&
+		a.Name == b.Name && a.applicationName() == b.applicationName()
+}
+
+// mySqlScriptUrl generates a MySQL connection URL that lets a single Exec run several statements.
+func (c *Connection) mySqlScriptUrl() string {
+	return c.mySqlUrl() + "&multiStatements=true"
+}
+
+// sqliteDSN generates the SQLite data source name of the connection, with its busy timeout, journal mode and
+// foreign key enforcement. Transactions take the write lock when they begin, so one that reads before
+// writing waits for the busy timeout instead of failing when another connection writes first.
+func (c *Connection) sqliteDSN() string {
+	busyTimeout := DefaultBusyTimeout
+	if c.BusyTimeout != nil {
+		busyTimeout = *c.BusyTimeout
+	}
+	journalMode := DefaultJournalMode
+	if c.JournalMode != "" {
+		journalMode = strings.ToUpper(c.JournalMode)
+	}
+	foreignKeys := "on"
+	if c.ForeignKeys != nil && !*c.ForeignKeys {
+		foreignKeys = "off"
+	}
+
+	separator := "?"
+	if strings.Contains(c.Path, "?") {
+		separator = "&"
+	}
+	return fmt.Sprintf("%s%s_busy_timeout=%d&_journal_mode=%s&_foreign_keys=%s&_txlock=immediate",
+		c.Path, separator, busyTimeout, journalMode, foreignKeys)
+}
+
+// configureSQLitePool limits the pool of a SQLite connection to a single connection, and so a single writer,
+// unless it uses WAL, where readers do not block the writer. An in-memory database is always limited,
+// as each connection would otherwise open a database of its own.
+func configureSQLitePool(db *sql.DB, c *Connection) {
+	journalMode := DefaultJournalMode
+	if c.JournalMode != "" {
+		journalMode = c.JournalMode
+	}
+	if !strings.EqualFold(journalMode, "WAL") || c.Path == ":memory:" || strings.Contains(c.Path, "mode=memory") {
+		db.SetMaxOpenConns(1)
+	}
+}
+
 // postgresUrl generates a PostgreSQL-specific database connection URL.
 func (c *Connection) postgresUrl() string {
 	return fmt.Sprintf(
-		"host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
+		"host=%s port=%d user=%s password=%s dbname=%s sslmode=disable application_name=%s",
 		c.Host,
 		c.Port,
 		c.User,
 		c.Password,
 		c.Name,
+		quoteDSNValue(c.applicationName()),
 	)
 }
 
@@ -91,16 +353,32 @@ func ConnectToDatabase(c *Connection, dbType string) (*sql.DB, error) {
 		return nil, fmt.Errorf("database type cannot be empty")
 	}
 	var (
-		db  *sql.DB
-		err error
+		db       *sql.DB
+		err      error
+		provider CredentialProvider
 	)
+	provider, err = c.credentialProvider()
+	if err != nil {
+		return nil, err
+	}
 	switch strings.ToLower(dbType) {
 	case strings.ToLower(_sql.MySQL.String()):
-		db, err = sql.Open("mysql", c.mySqlUrl())
+		if provider != nil {
+			db, err = openWithCredentials(c, provider, false)
+		} else {
+			db, err = sql.Open("mysql", c.mySqlUrl())
+		}
 	case strings.ToLower(_sql.PostgreSQL.String()):
-		db, err = sql.Open("postgres", c.postgresUrl())
+		if provider != nil {
+			db, err = openWithCredentials(c, provider, false)
+		} else {
+			db, err = sql.Open("postgres", c.postgresUrl())
+		}
 	case strings.ToLower(_sql.SQLite.String()):
-		db, err = sql.Open("sqlite3", c.Path)
+		db, err = openSQLite(c)
+		if err == nil {
+			configureSQLitePool(db, c)
+		}
 	default:
 		return nil, fmt.Errorf("unsupported database type: %s", dbType)
 	}
@@ -109,10 +387,89 @@ func ConnectToDatabase(c *Connection, dbType string) (*sql.DB, error) {
 	}
 	err = db.Ping()
 	if err != nil {
-		_ = db.Close()
+		_ = Disconnect(db)
 		return nil, err
 	}
 	err = testQuery(db)
+	if err != nil {
+		_ = Disconnect(db)
+		return nil, err
+	}
+	return db, nil
+}
+
+// Probe checks that the database described by c accepts connections within the context's deadline,
+// then closes the connection. Unlike ConnectToDatabase, it never creates a missing SQLite file.
+func Probe(ctx context.Context, c *Connection) error {
+	var (
+		db       *sql.DB
+		err      error
+		provider CredentialProvider
+	)
+	provider, err = c.credentialProvider()
+	if err != nil {
+		return err
+	}
+	switch c.Type {
+	case _sql.MySQL:
+		if provider != nil {
+			db, err = openWithCredentials(c, provider, false)
+		} else {
+			db, err = sql.Open("mysql", c.mySqlUrl())
+		}
+	case _sql.PostgreSQL:
+		if provider != nil {
+			db, err = openWithCredentials(c, provider, false)
+		} else {
+			db, err = sql.Open("postgres", c.postgresUrl())
+		}
+	case _sql.SQLite:
+		if _, err = os.Stat(c.Path); err != nil {
+			return err
+		}
+		db, err = sql.Open("sqlite3", c.Path)
+	default:
+		return fmt.Errorf("unsupported database type: %s", c.Type.String())
+	}
+	if err != nil {
+		return err
+	}
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	if err = db.PingContext(ctx); err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, "SELECT 1;")
+	return err
+}
+
+// ConnectForScript connects like ConnectToDatabase, but lets a single Exec run a script of several statements.
+//
+// For MySQL this enables the driver's multiStatements option, which is never set on the main connection:
+// with it, a value smuggling "; DROP TABLE ..." into any query built from user input would run as a second
+// statement instead of failing with a syntax error. The connection is meant to run one script and be closed.
+// PostgreSQL and SQLite run multi-statement Exec calls without an option, so they get a regular connection.
+func ConnectForScript(c *Connection) (*sql.DB, error) {
+	if !strings.EqualFold(c.Type.String(), _sql.MySQL.String()) {
+		return ConnectToDatabase(c, c.Type.String())
+	}
+
+	provider, err := c.credentialProvider()
+	if err != nil {
+		return nil, err
+	}
+	var db *sql.DB
+	if provider != nil {
+		db, err = openWithCredentials(c, provider, true)
+	} else {
+		db, err = sql.Open("mysql", c.mySqlScriptUrl())
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = db.Ping()
 	if err != nil {
 		_ = db.Close()
 		return nil, err
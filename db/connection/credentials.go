@@ -0,0 +1,339 @@
+package connection
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	_sql "github.com/yazeed1s/sqlweb/db/sql"
+)
+
+// Credential providers. A connection without credentials uses its password.
+const (
+	ProviderPassword = "password"
+	ProviderAWSIAM   = "aws-iam"
+	ProviderGCPIAM   = "gcp-iam"
+)
+
+// Credentials tells how to obtain the password of a connection, instead of storing it.
+// Params are specific to the provider, e.g. {"region": "eu-west-1"} for aws-iam.
+type Credentials struct {
+	Provider string            `json:"provider"`
+	Params   map[string]string `json:"params,omitempty"`
+}
+
+// CredentialProvider mints the password of a connection, such as a short-lived IAM auth token.
+// The token is used for new connections until it expires; a zero expiry means it does not.
+type CredentialProvider interface {
+	Token(ctx context.Context, c *Connection) (token string, expiry time.Time, err error)
+}
+
+// CredentialProviderFactory creates a provider from the parameters stored with the connection.
+type CredentialProviderFactory func(params map[string]string) (CredentialProvider, error)
+
+var (
+	providersMu sync.RWMutex
+	providers   = map[string]CredentialProviderFactory{
+		ProviderPassword: func(map[string]string) (CredentialProvider, error) { return passwordProvider{}, nil },
+		ProviderAWSIAM:   newAWSIAMProvider,
+		ProviderGCPIAM:   newGCPIAMProvider,
+	}
+)
+
+// RegisterCredentialProvider makes a credential provider available under the given name,
+// replacing the one registered under it before.
+func RegisterCredentialProvider(name string, factory CredentialProviderFactory) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers[name] = factory
+}
+
+// HasCredentialProvider reports whether the password of the connection is minted by a credential provider
+// when connecting, rather than stored with it.
+func (c *Connection) HasCredentialProvider() bool {
+	return c.Credentials != nil && c.Credentials.Provider != "" && c.Credentials.Provider != ProviderPassword
+}
+
+// CheckCredentials checks that the credential provider of the connection exists and accepts its parameters.
+func (c *Connection) CheckCredentials() error {
+	_, err := c.credentialProvider()
+	return err
+}
+
+// credentialProvider returns the provider of the connection, nil when it simply uses its password.
+func (c *Connection) credentialProvider() (CredentialProvider, error) {
+	if !c.HasCredentialProvider() {
+		return nil, nil
+	}
+	if c.Type != _sql.MySQL && c.Type != _sql.PostgreSQL {
+		return nil, fmt.Errorf("credential provider %s is not supported for %s", c.Credentials.Provider, c.Type.String())
+	}
+	providersMu.RLock()
+	factory, ok := providers[c.Credentials.Provider]
+	providersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown credential provider: %s", c.Credentials.Provider)
+	}
+	return factory(c.Credentials.Params)
+}
+
+// passwordProvider returns the password stored with the connection.
+type passwordProvider struct{}
+
+func (passwordProvider) Token(_ context.Context, c *Connection) (string, time.Time, error) {
+	return c.Password, time.Time{}, nil
+}
+
+// tokenRefreshMargin is how long before its expiry a token is replaced, so it does not expire mid-handshake.
+const tokenRefreshMargin = 30 * time.Second
+
+// credentialConnector opens each new connection of a pool with a token from the provider,
+// minting another one once the last has expired. The pool reconnecting after a dropped or
+// expired connection thus never reuses a stale token.
+type credentialConnector struct {
+	conn     *Connection
+	provider CredentialProvider
+	driver   driver.Driver
+	// connect opens a connection with the given password
+	connect func(ctx context.Context, password string) (driver.Conn, error)
+	now     func() time.Time
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+func (cc *credentialConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	token, err := cc.currentToken(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain credentials: %w", err)
+	}
+	return cc.connect(ctx, token)
+}
+
+func (cc *credentialConnector) Driver() driver.Driver {
+	return cc.driver
+}
+
+// currentToken returns the last token while it is valid, and mints a new one otherwise.
+func (cc *credentialConnector) currentToken(ctx context.Context) (string, error) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if cc.token != "" && (cc.expiry.IsZero() || cc.now().Add(tokenRefreshMargin).Before(cc.expiry)) {
+		return cc.token, nil
+	}
+	token, expiry, err := cc.provider.Token(ctx, cc.conn)
+	if err != nil {
+		return "", err
+	}
+	cc.token, cc.expiry = token, expiry
+	return token, nil
+}
+
+// openWithCredentials opens a pool for a MySQL or PostgreSQL connection whose password comes from
+// a credential provider. IAM tokens are only accepted over TLS, so TLS is required.
+func openWithCredentials(c *Connection, provider CredentialProvider, multiStatements bool) (*sql.DB, error) {
+	connector := &credentialConnector{conn: c, provider: provider, now: time.Now}
+	switch c.Type {
+	case _sql.MySQL:
+		config := mysql.NewConfig()
+		config.User = c.User
+		config.Net = "tcp"
+		config.Addr = fmt.Sprintf("%s:%d", c.Host, c.Port)
+		config.DBName = c.Name
+		config.TLSConfig = "true"
+		// the token is sent as is, which MySQL calls a cleartext password
+		config.AllowCleartextPasswords = true
+		config.MultiStatements = multiStatements
+		config.ConnectionAttributes = c.mySqlConnectionAttributes()
+		connector.driver = &mysql.MySQLDriver{}
+		// the token is set on a copy of the config rather than in a DSN, which it could not be parsed back from
+		connector.connect = func(ctx context.Context, password string) (driver.Conn, error) {
+			withPassword := config.Clone()
+			withPassword.Passwd = password
+			mysqlConnector, err := mysql.NewConnector(withPassword)
+			if err != nil {
+				return nil, err
+			}
+			return mysqlConnector.Connect(ctx)
+		}
+	case _sql.PostgreSQL:
+		connector.driver = &pq.Driver{}
+		connector.connect = func(ctx context.Context, password string) (driver.Conn, error) {
+			pqConnector, err := pq.NewConnector(fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=require application_name=%s",
+				c.Host, c.Port, quoteDSNValue(c.User), quoteDSNValue(password), quoteDSNValue(c.Name), quoteDSNValue(c.applicationName())))
+			if err != nil {
+				return nil, err
+			}
+			return pqConnector.Connect(ctx)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported database type: %s", c.Type.String())
+	}
+	return sql.OpenDB(connector), nil
+}
+
+// quoteDSNValue quotes a value of a PostgreSQL key=value connection string, e.g. a token holding '='.
+func quoteDSNValue(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+// awsIAMTokenLifetime is how long RDS accepts an IAM auth token for new connections.
+const awsIAMTokenLifetime = 15 * time.Minute
+
+// awsIAMProvider mints RDS IAM auth tokens: presigned "connect" requests signed with the AWS
+// credentials of the environment (AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN).
+type awsIAMProvider struct {
+	region string
+	now    func() time.Time
+}
+
+func newAWSIAMProvider(params map[string]string) (CredentialProvider, error) {
+	region := params["region"]
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		return nil, errors.New("aws-iam credentials need a region")
+	}
+	return &awsIAMProvider{region: region, now: time.Now}, nil
+}
+
+func (p *awsIAMProvider) Token(_ context.Context, c *Connection) (string, time.Time, error) {
+	accessKey, secretKey := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKey == "" || secretKey == "" {
+		return "", time.Time{}, errors.New("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set for aws-iam credentials")
+	}
+	now := p.now().UTC()
+	query := url.Values{}
+	query.Set("Action", "connect")
+	query.Set("DBUser", c.User)
+	if sessionToken := os.Getenv("AWS_SESSION_TOKEN"); sessionToken != "" {
+		query.Set("X-Amz-Security-Token", sessionToken)
+	}
+	host := fmt.Sprintf("%s:%d", c.Host, c.Port)
+	// the signed request has an empty body
+	emptyHash := sha256.Sum256(nil)
+	signed := presignV4(host, "/", query, accessKey, secretKey, p.region, "rds-db", now,
+		awsIAMTokenLifetime, hex.EncodeToString(emptyHash[:]))
+	return host + "/?" + signed, now.Add(awsIAMTokenLifetime), nil
+}
+
+// presignV4 adds the AWS Signature Version 4 query parameters of a presigned GET request to query,
+// and returns the encoded query.
+func presignV4(host, path string, query url.Values, accessKey, secretKey, region, service string,
+	now time.Time, expires time.Duration, payloadHash string) string {
+	date := now.Format("20060102")
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", accessKey+"/"+scope)
+	query.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	query.Set("X-Amz-Expires", fmt.Sprintf("%d", int(expires.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	canonicalQuery := canonicalQueryString(query)
+	canonicalRequest := strings.Join([]string{
+		"GET", path, canonicalQuery, "host:" + host + "\n", "host", payloadHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256", now.Format("20060102T150405Z"), scope, hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	return canonicalQuery + "&X-Amz-Signature=" + signature
+}
+
+// canonicalQueryString encodes the query sorted by key, escaping as SigV4 requires (spaces as %20).
+func canonicalQueryString(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		for _, v := range query[k] {
+			pairs = append(pairs, awsEscape(k)+"="+awsEscape(v))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func awsEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// gcpMetadataTokenURL serves an OAuth2 access token of the service account of a Google Cloud VM.
+const gcpMetadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+// gcpIAMProvider mints Cloud SQL IAM database auth tokens, the OAuth2 access tokens of the
+// instance's service account, from the metadata server or the one given as tokenURL.
+type gcpIAMProvider struct {
+	tokenURL string
+	client   *http.Client
+	now      func() time.Time
+}
+
+func newGCPIAMProvider(params map[string]string) (CredentialProvider, error) {
+	tokenURL := params["tokenURL"]
+	if tokenURL == "" {
+		tokenURL = gcpMetadataTokenURL
+	}
+	return &gcpIAMProvider{tokenURL: tokenURL, client: &http.Client{Timeout: 10 * time.Second}, now: time.Now}, nil
+}
+
+func (p *gcpIAMProvider) Token(ctx context.Context, _ *Connection) (string, time.Time, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, p.tokenURL, nil)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	request.Header.Set("Metadata-Flavor", "Google")
+	response, err := p.client.Do(request)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	if response.StatusCode != http.StatusOK {
+		return "", time.Time{}, fmt.Errorf("token request failed: %s", response.Status)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err = json.NewDecoder(response.Body).Decode(&token); err != nil {
+		return "", time.Time{}, err
+	}
+	if token.AccessToken == "" {
+		return "", time.Time{}, errors.New("token response has no access_token")
+	}
+	return token.AccessToken, p.now().Add(time.Duration(token.ExpiresIn) * time.Second), nil
+}
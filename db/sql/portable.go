@@ -0,0 +1,253 @@
+package sql
+
+import (
+	"regexp"
+	"strings"
+)
+
+// PortableType is a column type that means the same on every dialect, e.g. the "integer" of
+// MySQL's int(11), PostgreSQL's integer and SQLite's INT.
+type PortableType string
+
+// Portable types. Unknown is given to types that have no portable equivalent, e.g. PostgreSQL's
+// user-defined types or a SQLite column declared without a type.
+const (
+	Boolean   PortableType = "boolean"
+	SmallInt  PortableType = "smallint"
+	Integer   PortableType = "integer"
+	BigInt    PortableType = "bigint"
+	Decimal   PortableType = "decimal"
+	Float     PortableType = "float"
+	Double    PortableType = "double"
+	String    PortableType = "string"
+	Text      PortableType = "text"
+	Binary    PortableType = "binary"
+	Date      PortableType = "date"
+	Time      PortableType = "time"
+	Timestamp PortableType = "timestamp"
+	Interval  PortableType = "interval"
+	JSON      PortableType = "json"
+	UUID      PortableType = "uuid"
+	Enum      PortableType = "enum"
+	Array     PortableType = "array"
+	Unknown   PortableType = "unknown"
+)
+
+// goTypes are the Go types values of a portable type are scanned into. Decimals are strings so that
+// they keep their precision, and times of day are strings since no driver scans them into time.Time.
+var goTypes = map[PortableType]string{
+	Boolean:   "bool",
+	SmallInt:  "int16",
+	Integer:   "int32",
+	BigInt:    "int64",
+	Decimal:   "string",
+	Float:     "float32",
+	Double:    "float64",
+	String:    "string",
+	Text:      "string",
+	Binary:    "[]byte",
+	Date:      "time.Time",
+	Time:      "string",
+	Timestamp: "time.Time",
+	Interval:  "string",
+	JSON:      "json.RawMessage",
+	UUID:      "string",
+	Enum:      "string",
+	Array:     "[]byte",
+	Unknown:   "interface{}",
+}
+
+// GoType returns the Go type a value of the portable type is scanned into, a pointer to it
+// when the column is nullable. Slices and interfaces already hold NULL as nil.
+func (t PortableType) GoType(nullable bool) string {
+	goType, ok := goTypes[t]
+	if !ok {
+		goType = goTypes[Unknown]
+	}
+	if nullable && !strings.HasPrefix(goType, "[]") && goType != "json.RawMessage" && goType != "interface{}" {
+		return "*" + goType
+	}
+	return goType
+}
+
+// mysqlTypes maps the types of MySQL's COLUMN_TYPE, without their length or precision.
+var mysqlTypes = map[string]PortableType{
+	"bool":       Boolean,
+	"boolean":    Boolean,
+	"bit":        Binary,
+	"tinyint":    SmallInt,
+	"smallint":   SmallInt,
+	"mediumint":  Integer,
+	"int":        Integer,
+	"integer":    Integer,
+	"bigint":     BigInt,
+	"decimal":    Decimal,
+	"numeric":    Decimal,
+	"float":      Float,
+	"double":     Double,
+	"real":       Double,
+	"char":       String,
+	"varchar":    String,
+	"tinytext":   Text,
+	"text":       Text,
+	"mediumtext": Text,
+	"longtext":   Text,
+	"binary":     Binary,
+	"varbinary":  Binary,
+	"tinyblob":   Binary,
+	"blob":       Binary,
+	"mediumblob": Binary,
+	"longblob":   Binary,
+	"date":       Date,
+	"datetime":   Timestamp,
+	"timestamp":  Timestamp,
+	"time":       Time,
+	"year":       SmallInt,
+	"json":       JSON,
+	"enum":       Enum,
+	"set":        String,
+}
+
+// postgresqlTypes maps the data_type of PostgreSQL's information_schema, along with the names
+// and aliases of its types as written in DDL.
+var postgresqlTypes = map[string]PortableType{
+	"boolean":                     Boolean,
+	"bool":                        Boolean,
+	"smallint":                    SmallInt,
+	"int2":                        SmallInt,
+	"smallserial":                 SmallInt,
+	"integer":                     Integer,
+	"int":                         Integer,
+	"int4":                        Integer,
+	"serial":                      Integer,
+	"bigint":                      BigInt,
+	"int8":                        BigInt,
+	"bigserial":                   BigInt,
+	"numeric":                     Decimal,
+	"decimal":                     Decimal,
+	"money":                       Decimal,
+	"real":                        Float,
+	"float4":                      Float,
+	"double precision":            Double,
+	"float8":                      Double,
+	"character varying":           String,
+	"varchar":                     String,
+	"character":                   String,
+	"char":                        String,
+	"bpchar":                      String,
+	"text":                        Text,
+	"citext":                      Text,
+	"xml":                         Text,
+	"bytea":                       Binary,
+	"date":                        Date,
+	"time without time zone":      Time,
+	"time with time zone":         Time,
+	"time":                        Time,
+	"timetz":                      Time,
+	"timestamp without time zone": Timestamp,
+	"timestamp with time zone":    Timestamp,
+	"timestamp":                   Timestamp,
+	"timestamptz":                 Timestamp,
+	"interval":                    Interval,
+	"json":                        JSON,
+	"jsonb":                       JSON,
+	"uuid":                        UUID,
+	"inet":                        String,
+	"cidr":                        String,
+	"macaddr":                     String,
+	"tsvector":                    Text,
+	"array":                       Array,
+	"user-defined":                Unknown,
+}
+
+// sqliteTypes maps the declared types SQLite applications commonly use. Other declared types
+// get the portable type of their affinity, see sqliteAffinity.
+var sqliteTypes = map[string]PortableType{
+	"boolean":   Boolean,
+	"bool":      Boolean,
+	"date":      Date,
+	"datetime":  Timestamp,
+	"timestamp": Timestamp,
+	"time":      Time,
+	"json":      JSON,
+	"uuid":      UUID,
+	"varchar":   String,
+	"nvarchar":  String,
+	"character": String,
+	"char":      String,
+	"nchar":     String,
+	"decimal":   Decimal,
+	"numeric":   Decimal,
+	"float":     Double,
+	"smallint":  SmallInt,
+	"tinyint":   SmallInt,
+}
+
+// typeArguments matches the length, precision or values of a type, e.g. the "(10, 2)" of decimal(10, 2).
+var typeArguments = regexp.MustCompile(`\s*\(.*?\)`)
+
+// NormalizeType returns the portable type of a column type as the database reports it:
+// MySQL's COLUMN_TYPE, PostgreSQL's data_type or the type a SQLite column was declared with.
+func NormalizeType(dbType DbType, columnType string) PortableType {
+	var (
+		declared = strings.ToLower(strings.TrimSpace(columnType))
+		base     = typeArguments.ReplaceAllString(declared, "")
+	)
+
+	switch dbType {
+	case MySQL:
+		// tinyint(1) is how MySQL stores booleans
+		if strings.HasPrefix(declared, "tinyint(1)") {
+			return Boolean
+		}
+		base = strings.TrimSpace(strings.NewReplacer(" unsigned", "", " zerofill", "").Replace(base))
+		portable, ok := mysqlTypes[base]
+		if !ok {
+			return Unknown
+		}
+		// an unsigned value does not fit its signed Go type, the next wider one holds it
+		if strings.Contains(declared, "unsigned") {
+			switch portable {
+			case SmallInt:
+				return Integer
+			case Integer:
+				return BigInt
+			}
+		}
+		return portable
+	case PostgreSQL:
+		if strings.HasSuffix(base, "[]") {
+			return Array
+		}
+		if portable, ok := postgresqlTypes[base]; ok {
+			return portable
+		}
+		return Unknown
+	case SQLite:
+		if portable, ok := sqliteTypes[base]; ok {
+			return portable
+		}
+		return sqliteAffinity(base)
+	default:
+		return Unknown
+	}
+}
+
+// sqliteAffinity returns the portable type of a SQLite declared type by the rules SQLite
+// derives column affinity with, see https://www.sqlite.org/datatype3.html#determination_of_column_affinity.
+func sqliteAffinity(declared string) PortableType {
+	switch {
+	case declared == "":
+		return Unknown
+	case strings.Contains(declared, "int"):
+		return BigInt
+	case strings.Contains(declared, "char"), strings.Contains(declared, "clob"), strings.Contains(declared, "text"):
+		return Text
+	case strings.Contains(declared, "blob"):
+		return Binary
+	case strings.Contains(declared, "real"), strings.Contains(declared, "floa"), strings.Contains(declared, "doub"):
+		return Double
+	default:
+		return Decimal
+	}
+}
@@ -0,0 +1,144 @@
+package sql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeTypeMySQL(t *testing.T) {
+	types := map[string]PortableType{
+		"tinyint(1)":                Boolean,
+		"tinyint(4)":                SmallInt,
+		"tinyint unsigned":          Integer,
+		"smallint(6)":               SmallInt,
+		"smallint unsigned":         Integer,
+		"mediumint(9)":              Integer,
+		"int(11)":                   Integer,
+		"int":                       Integer,
+		"int(10) unsigned":          BigInt,
+		"bigint(20)":                BigInt,
+		"bigint unsigned":           BigInt,
+		"decimal(10,2)":             Decimal,
+		"decimal(10,2) unsigned":    Decimal,
+		"float":                     Float,
+		"double":                    Double,
+		"bit(1)":                    Binary,
+		"char(36)":                  String,
+		"varchar(255)":              String,
+		"tinytext":                  Text,
+		"text":                      Text,
+		"mediumtext":                Text,
+		"longtext":                  Text,
+		"binary(16)":                Binary,
+		"varbinary(255)":            Binary,
+		"blob":                      Binary,
+		"longblob":                  Binary,
+		"date":                      Date,
+		"datetime":                  Timestamp,
+		"datetime(6)":               Timestamp,
+		"timestamp":                 Timestamp,
+		"time":                      Time,
+		"year":                      SmallInt,
+		"json":                      JSON,
+		"enum('small','large')":     Enum,
+		"set('read','write')":       String,
+		"INT(11) UNSIGNED ZEROFILL": BigInt,
+		"geometry":                  Unknown,
+	}
+	for columnType, expected := range types {
+		assert.Equal(t, expected, NormalizeType(MySQL, columnType), columnType)
+	}
+}
+
+func TestNormalizeTypePostgreSQL(t *testing.T) {
+	types := map[string]PortableType{
+		"boolean":                     Boolean,
+		"smallint":                    SmallInt,
+		"integer":                     Integer,
+		"serial":                      Integer,
+		"bigint":                      BigInt,
+		"bigserial":                   BigInt,
+		"numeric":                     Decimal,
+		"numeric(10,2)":               Decimal,
+		"money":                       Decimal,
+		"real":                        Float,
+		"double precision":            Double,
+		"character varying":           String,
+		"varchar(64)":                 String,
+		"character":                   String,
+		"text":                        Text,
+		"citext":                      Text,
+		"xml":                         Text,
+		"bytea":                       Binary,
+		"date":                        Date,
+		"time without time zone":      Time,
+		"time with time zone":         Time,
+		"timestamp without time zone": Timestamp,
+		"timestamp with time zone":    Timestamp,
+		"timestamp(3) with time zone": Timestamp,
+		"timestamptz":                 Timestamp,
+		"interval":                    Interval,
+		"json":                        JSON,
+		"jsonb":                       JSON,
+		"uuid":                        UUID,
+		"inet":                        String,
+		"ARRAY":                       Array,
+		"integer[]":                   Array,
+		"USER-DEFINED":                Unknown,
+		"point":                       Unknown,
+	}
+	for columnType, expected := range types {
+		assert.Equal(t, expected, NormalizeType(PostgreSQL, columnType), columnType)
+	}
+}
+
+func TestNormalizeTypeSQLite(t *testing.T) {
+	types := map[string]PortableType{
+		"INTEGER":                BigInt,
+		"INT":                    BigInt,
+		"BIGINT":                 BigInt,
+		"UNSIGNED BIG INT":       BigInt,
+		"MEDIUMINT":              BigInt,
+		"SMALLINT":               SmallInt,
+		"TINYINT":                SmallInt,
+		"BOOLEAN":                Boolean,
+		"REAL":                   Double,
+		"DOUBLE":                 Double,
+		"DOUBLE PRECISION":       Double,
+		"FLOAT":                  Double,
+		"NUMERIC":                Decimal,
+		"DECIMAL(10,5)":          Decimal,
+		"TEXT":                   Text,
+		"CLOB":                   Text,
+		"VARCHAR(255)":           String,
+		"NVARCHAR(100)":          String,
+		"CHARACTER(20)":          String,
+		"NCHAR(55)":              String,
+		"VARYING CHARACTER(255)": Text,
+		"NATIVE CHARACTER(70)":   Text,
+		"BLOB":                   Binary,
+		"DATE":                   Date,
+		"DATETIME":               Timestamp,
+		"TIMESTAMP":              Timestamp,
+		"TIME":                   Time,
+		"JSON":                   JSON,
+		"UUID":                   UUID,
+		"":                       Unknown,
+		"MONEY":                  Decimal,
+	}
+	for columnType, expected := range types {
+		assert.Equal(t, expected, NormalizeType(SQLite, columnType), columnType)
+	}
+}
+
+func TestPortableGoType(t *testing.T) {
+	assert.Equal(t, "int64", BigInt.GoType(false))
+	assert.Equal(t, "*int64", BigInt.GoType(true))
+	assert.Equal(t, "*time.Time", Timestamp.GoType(true))
+	assert.Equal(t, "string", Decimal.GoType(false))
+	assert.Equal(t, "[]byte", Binary.GoType(true))
+	assert.Equal(t, "json.RawMessage", JSON.GoType(true))
+	assert.Equal(t, "interface{}", Unknown.GoType(true))
+	assert.Equal(t, "interface{}", PortableType("other").GoType(false))
+}
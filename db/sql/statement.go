@@ -7,26 +7,31 @@ const (
 	/*------------------------
 	 === Common Constants ===
 	--------------------------*/
-	SQLSelectAll string = `SELECT * FROM %s.%s`
-	SQLUpdateRow string = `UPDATE %s SET %s = %s WHERE %s = %s`
+	SQLSelectAll    string = `SELECT * FROM %s.%s`
+	SQLUpdateRow    string = `UPDATE %s SET %s = %s WHERE %s = %s`
+	SQLRenameColumn string = `ALTER TABLE %s RENAME COLUMN %s TO %s`
+	SQLRenameTable  string = `ALTER TABLE %s RENAME TO %s`
+	SQLCollate      string = `%s COLLATE %s`
 
 	/*------------------------
 	 === SQLite Constants ===
 	--------------------------*/
 	SQLiteShowCreateTable string = `
 		SELECT 
-			sql
+			name, sql
 		FROM 
 			sqlite_schema 
 		WHERE 
-			name='%s';`
+			name='%s' COLLATE NOCASE;`
 	SQLiteGetColumnDataType string = `
 		SELECT 
-			typeof('%s') 
+			type 
 		AS 
 			data_type 
-		FROM '%s' 
-			LIMIT 1;
+		FROM 
+			pragma_table_info('%s') 
+		WHERE 
+			name = '%s' COLLATE NOCASE;
 	`
 	SQLiteCountTableColumns string = `
 		SELECT 
@@ -39,7 +44,7 @@ const (
 			COUNT(*) 
 		AS 
 			row_count 
-		FROM '%s';`
+		FROM %s;`
 	SQLiteShowTables string = `
 		SELECT 
 			name
@@ -47,6 +52,43 @@ const (
 			sqlite_master
 		WHERE type='table';
 	`
+	// SQLiteTableTypes lists the tables and views, with whether each is a view
+	SQLiteTableTypes string = `
+		SELECT
+			name,
+			type = 'view'
+		FROM
+			sqlite_master
+		WHERE
+			type IN ('table', 'view');
+	`
+	SQLiteIsView string = `SELECT type = 'view' FROM sqlite_master WHERE type IN ('table', 'view') AND name = %s`
+	// SQLiteViewDefinition returns the CREATE VIEW statement of a view as it was written
+	SQLiteViewDefinition string = `SELECT sql FROM sqlite_master WHERE type = 'view' AND name = %s`
+	// SQLiteEstimateRows reads the row count ANALYZE recorded for a table; without ANALYZE the table does not exist
+	SQLiteEstimateRows string = `SELECT stat FROM sqlite_stat1 WHERE tbl = %s LIMIT 1`
+	// SQLiteShowDatabases lists main, temp and the attached databases; file is empty for in-memory ones
+	SQLiteShowDatabases string = `SELECT name, file FROM pragma_database_list ORDER BY seq`
+	// SQLiteExplain describes the plan of a statement without running it
+	SQLiteExplain string = `EXPLAIN QUERY PLAN %s`
+	// SQLiteAttachedDatabases lists the aliases of the attached databases
+	SQLiteAttachedDatabases string = `SELECT name FROM pragma_database_list WHERE name NOT IN ('main', 'temp') ORDER BY seq`
+	// SQLiteAttachedTables lists the tables of the attached databases, with the alias of each
+	SQLiteAttachedTables string = `
+		SELECT
+			schema,
+			name
+		FROM
+			pragma_table_list
+		WHERE
+			schema NOT IN ('main', 'temp')
+		AND
+			type = 'table'
+		AND
+			name NOT IN ('sqlite_schema', 'sqlite_master')
+		ORDER BY
+			schema, name;
+	`
 	SQLiteDropTable      string = `DROP TABLE %s`
 	SQLiteDropDatabase   string = `DROP DATABASE %s`
 	SQLiteCreateDatabase string = `CREATE DATABASE %s`
@@ -58,13 +100,39 @@ const (
 			c.pk AS 'Key',
 			'' AS 'ConstraintName',
 			'' AS 'ReferencedTable',
-			'' AS 'ReferencedColumn'
+			'' AS 'ReferencedColumn',
+			'' AS 'Comment',
+			c.dflt_value AS 'Default',
+			c.hidden IN (2, 3) AS 'IsGenerated',
+			c."notnull" = 0 AND c.pk = 0 AS 'Nullable'
     	FROM
-        	pragma_table_info('%s') 
-		AS c;
+        	pragma_table_xinfo('%s', '%s') 
+		AS c
+		WHERE
+			c.hidden <> 1;
 	`
 
-	SQLiteSelectAllWithLimit string = `SELECT %s FROM %s LIMIT %d OFFSET %d`
+	SQLiteSelectAllWithLimit string = `SELECT %s FROM %s%s LIMIT %d OFFSET %d`
+	// SQLite identifiers are case-insensitive but keep the case they were created with;
+	// these look up the stored spelling of a table or column name.
+	SQLiteStoredTableName string = `
+		SELECT
+			name
+		FROM
+			pragma_table_list
+		WHERE
+			schema = '%s'
+		AND
+			name = '%s' COLLATE NOCASE;
+	`
+	SQLiteStoredColumnName string = `
+		SELECT
+			name
+		FROM
+			pragma_table_xinfo('%s')
+		WHERE
+			name = '%s' COLLATE NOCASE;
+	`
 
 	SQLiteTablesSize string = `
 		SELECT 
@@ -78,6 +146,103 @@ const (
 				name
 		);
 	`
+	SQLiteViewDefinitions string = `
+		SELECT
+			name,
+			sql
+		FROM
+			sqlite_master
+		WHERE
+			type = 'view';
+	`
+	SQLiteTableObjects string = `
+		SELECT
+			sql
+		FROM
+			sqlite_master
+		WHERE
+			type IN ('index', 'trigger')
+		AND
+			tbl_name = '%s' COLLATE NOCASE
+		AND
+			sql IS NOT NULL
+		ORDER BY
+			type, name;
+	`
+	SQLiteReferencingForeignKeys string = `
+		SELECT
+			m.name,
+			f."from",
+			''
+		FROM
+			sqlite_master m,
+			pragma_foreign_key_list(m.name) f
+		WHERE
+			m.type = 'table'
+		AND
+			f."table" = '%s' COLLATE NOCASE
+		AND
+			f."to" = '%s' COLLATE NOCASE;
+	`
+	SQLiteCollations string = `
+		SELECT
+			name,
+			'',
+			'',
+			name = 'BINARY'
+		FROM
+			pragma_collation_list
+		ORDER BY
+			name;
+	`
+	SQLiteTableSQL string = `
+		SELECT
+			COALESCE(sql, '')
+		FROM
+			sqlite_master
+		WHERE
+			type = 'table'
+		AND
+			name = '%s' COLLATE NOCASE;
+	`
+	SQLiteForeignKeys string = `
+		SELECT
+			"from",
+			"table",
+			"to"
+		FROM
+			pragma_foreign_key_list('%s')
+		ORDER BY
+			id, seq;
+	`
+	SQLiteReferencingTables string = `
+		SELECT
+			m.name,
+			CAST(f.id AS TEXT),
+			'',
+			f."from",
+			f."to",
+			f.on_delete
+		FROM
+			sqlite_master m,
+			pragma_foreign_key_list(m.name) f
+		WHERE
+			m.type = 'table'
+		AND
+			f."table" = '%s' COLLATE NOCASE
+		ORDER BY
+			m.name, f.id, f.seq;
+	`
+	SQLiteTableBloat string = `
+		SELECT
+			f.freelist_count,
+			p.page_count,
+			s.page_size
+		FROM
+			pragma_freelist_count() f,
+			pragma_page_count() p,
+			pragma_page_size() s;
+	`
 	SQLiteTableSize string = `
 		SELECT 
 		    name AS "Table",
@@ -85,12 +250,18 @@ const (
 		FROM 
 			dbstat
 		WHERE 
-			name = '%s';
+			name = '%s' COLLATE NOCASE;
+	`
+	// SQLiteConnectionPragmas reads the settings of the connection it runs on
+	SQLiteConnectionPragmas string = `
+		SELECT b.timeout, j.journal_mode, f.foreign_keys
+		FROM pragma_busy_timeout() b, pragma_journal_mode() j, pragma_foreign_keys() f;
 	`
 	/*------------------------
 	 === MySQL Constants ===
 	--------------------------*/
 	MySQLShowCreateTable   string = `SHOW CREATE TABLE %s.%s`
+	MySQLShowCreateTrigger string = `SHOW CREATE TRIGGER %s.%s`
 	MySQLGetColumnDataType string = `
 		SELECT 
 		    DATA_TYPE
@@ -103,6 +274,18 @@ const (
 		AND 
 		    COLUMN_NAME = '%s';
 	`
+	MySQLTableTriggers string = `
+		SELECT
+			TRIGGER_NAME
+		FROM
+			information_schema.TRIGGERS
+		WHERE
+			EVENT_OBJECT_SCHEMA = '%s'
+		AND
+			EVENT_OBJECT_TABLE = '%s'
+		ORDER BY
+			ACTION_TIMING, EVENT_MANIPULATION, ACTION_ORDER;
+	`
 	MySQLSchemaSize string = `
 		SELECT table_schema "database", 
 			sum(data_length + index_length)/1024/1024 "size in MB" 
@@ -121,21 +304,52 @@ const (
 		AND 
 			table_name = '%s';
 	`
-	MySQLCountTableRows string = `SELECT COUNT(*) FROM %s.%s`
-	MySQLShowTables     string = `SHOW TABLES`
-	MySQLDropTable      string = `DROP TABLE %s`
-	MySQLDropDatabase   string = `DROP DATABASE %s`
-	MySQLCreateDatabase string = `CREATE DATABASE %s`
-	MySQLTruncateTable  string = `TRUNCATE TABLE %s`
-	MySQLUse            string = `USE %s`
-	MySQLColumnsInfo    string = `
+	MySQLCountTableRows      string = `SELECT COUNT(*) FROM %s.%s`
+	MySQLShowTables          string = `SHOW TABLES FROM %s`
+	MySQLTableTypes          string = `SELECT TABLE_NAME, TABLE_TYPE = 'VIEW' FROM information_schema.TABLES WHERE TABLE_SCHEMA = %s`
+	MySQLIsView              string = `SELECT TABLE_TYPE = 'VIEW' FROM information_schema.TABLES WHERE TABLE_SCHEMA = %s AND TABLE_NAME = %s`
+	MySQLShowCreateView      string = `SHOW CREATE VIEW %s`
+	MySQLRoutines            string = `SELECT ROUTINE_NAME, ROUTINE_TYPE, COALESCE(ROUTINE_DEFINITION, '') FROM information_schema.ROUTINES WHERE ROUTINE_SCHEMA = %s ORDER BY ROUTINE_NAME`
+	MySQLEstimateRows        string = `SELECT TABLE_ROWS FROM information_schema.TABLES WHERE TABLE_SCHEMA = %s AND TABLE_NAME = %s`
+	MySQLDropTable           string = `DROP TABLE %s`
+	MySQLDropDatabase        string = `DROP DATABASE %s`
+	MySQLCreateDatabase      string = `CREATE DATABASE %s`
+	MySQLDatabaseCharset     string = ` CHARACTER SET %s`
+	MySQLDatabaseCollation   string = ` COLLATE %s`
+	MySQLTruncateTable       string = `TRUNCATE TABLE %s`
+	MySQLUse                 string = `USE %s`
+	MySQLExplain             string = `EXPLAIN %s`
+	MySQLSetValidate         string = `SET @sqlweb_validate = ?`
+	MySQLPrepareValidate     string = `PREPARE sqlweb_validate FROM @sqlweb_validate`
+	MySQLDeallocateValidate  string = `DEALLOCATE PREPARE sqlweb_validate`
+	MySQLSetTableComment     string = `ALTER TABLE %s COMMENT = %s`
+	MySQLModifyColumnComment string = `ALTER TABLE %s MODIFY COLUMN %s %s COMMENT %s`
+	MySQLColumnDefinition    string = `
+		SELECT
+			COLUMN_TYPE,
+			IS_NULLABLE,
+			COLUMN_DEFAULT,
+			EXTRA,
+			COALESCE(GENERATION_EXPRESSION, ''),
+			COALESCE(CHARACTER_SET_NAME, ''),
+			COALESCE(COLLATION_NAME, '')
+		FROM
+			information_schema.COLUMNS
+		WHERE
+			TABLE_SCHEMA = '%s' AND TABLE_NAME = '%s' AND COLUMN_NAME = '%s';
+	`
+	MySQLColumnsInfo string = `
 		SELECT
     		c.COLUMN_NAME AS 'Field',
     		c.COLUMN_TYPE AS 'Type',
     		c.COLUMN_KEY AS 'Key',
     		COALESCE(k.CONSTRAINT_NAME, '') AS 'ConstraintName',
     		COALESCE(k.REFERENCED_TABLE_NAME, '') AS 'ReferencedTable',
-    		COALESCE(k.REFERENCED_COLUMN_NAME, '') AS 'ReferencedColumn'
+    		COALESCE(k.REFERENCED_COLUMN_NAME, '') AS 'ReferencedColumn',
+    		c.COLUMN_COMMENT AS 'Comment',
+    		c.COLUMN_DEFAULT AS 'Default',
+    		COALESCE(c.GENERATION_EXPRESSION, '') <> '' AS 'IsGenerated',
+    		c.IS_NULLABLE = 'YES' AS 'Nullable'
 		FROM
     		INFORMATION_SCHEMA.COLUMNS c
     	LEFT JOIN 
@@ -149,8 +363,16 @@ const (
     	AND 
 			c.TABLE_NAME = '%s'
 	`
-	MySQLSelectAllWithLimit string = `SELECT %s FROM %s.%s LIMIT %d OFFSET %d`
-	MySQLGetTablesSize      string = `
+	MySQLSelectAllWithLimit string = `SELECT %s FROM %s.%s%s LIMIT %d OFFSET %d`
+	MySQLTableComment       string = `
+		SELECT
+			TABLE_COMMENT
+		FROM
+			information_schema.TABLES
+		WHERE
+			TABLE_SCHEMA = '%s' AND TABLE_NAME = '%s';
+	`
+	MySQLGetTablesSize string = `
 		SELECT
 			TABLE_NAME AS "Table",
 			ROUND(((DATA_LENGTH + INDEX_LENGTH) / 1024 / 1024), 2) AS "Size (MB)"
@@ -161,6 +383,108 @@ const (
 		ORDER BY
 			(DATA_LENGTH + INDEX_LENGTH) DESC;
 	`
+	MySQLCharsets string = `
+		SELECT
+			CHARACTER_SET_NAME,
+			DEFAULT_COLLATE_NAME,
+			DESCRIPTION
+		FROM
+			information_schema.CHARACTER_SETS
+		ORDER BY
+			CHARACTER_SET_NAME;
+	`
+	MySQLCollations string = `
+		SELECT
+			COLLATION_NAME,
+			CHARACTER_SET_NAME,
+			'',
+			IS_DEFAULT = 'Yes'
+		FROM
+			information_schema.COLLATIONS
+		ORDER BY
+			COLLATION_NAME;
+	`
+	MySQLFullTextIndexes string = `
+		SELECT
+			INDEX_NAME,
+			COLUMN_NAME
+		FROM
+			information_schema.STATISTICS
+		WHERE
+			TABLE_SCHEMA = '%s'
+		AND
+			TABLE_NAME = '%s'
+		AND
+			INDEX_TYPE = 'FULLTEXT'
+		ORDER BY
+			INDEX_NAME, SEQ_IN_INDEX;
+	`
+	MySQLTablesLastModified string = `
+		SELECT
+			TABLE_NAME,
+			UNIX_TIMESTAMP(UPDATE_TIME)
+		FROM
+			information_schema.TABLES
+		WHERE
+			TABLE_SCHEMA = '%s'
+		AND
+			TABLE_TYPE = 'BASE TABLE';
+	`
+	MySQLViewDefinitions string = `
+		SELECT
+			TABLE_NAME,
+			VIEW_DEFINITION
+		FROM
+			information_schema.VIEWS
+		WHERE
+			TABLE_SCHEMA = '%s';
+	`
+	MySQLReferencingForeignKeys string = `
+		SELECT
+			TABLE_NAME,
+			COLUMN_NAME,
+			CONSTRAINT_NAME
+		FROM
+			information_schema.KEY_COLUMN_USAGE
+		WHERE
+			REFERENCED_TABLE_SCHEMA = '%s'
+		AND
+			REFERENCED_TABLE_NAME = '%s'
+		AND
+			REFERENCED_COLUMN_NAME = '%s';
+	`
+	MySQLReferencingTables string = `
+		SELECT
+			k.TABLE_NAME,
+			k.CONSTRAINT_NAME,
+			k.CONSTRAINT_NAME,
+			k.COLUMN_NAME,
+			k.REFERENCED_COLUMN_NAME,
+			r.DELETE_RULE
+		FROM
+			information_schema.KEY_COLUMN_USAGE k
+		JOIN
+			information_schema.REFERENTIAL_CONSTRAINTS r
+				ON r.CONSTRAINT_SCHEMA = k.CONSTRAINT_SCHEMA
+				AND r.CONSTRAINT_NAME = k.CONSTRAINT_NAME
+				AND r.TABLE_NAME = k.TABLE_NAME
+		WHERE
+			k.REFERENCED_TABLE_SCHEMA = '%s'
+		AND
+			k.REFERENCED_TABLE_NAME = '%s'
+		ORDER BY
+			k.TABLE_NAME, k.CONSTRAINT_NAME, k.ORDINAL_POSITION;
+	`
+	MySQLTableBloat string = `
+		SELECT
+			TABLE_NAME,
+			COALESCE(DATA_LENGTH + INDEX_LENGTH, 0),
+			COALESCE(DATA_FREE, 0)
+		FROM
+			information_schema.TABLES
+		WHERE
+			TABLE_SCHEMA = '%s' AND TABLE_NAME = '%s';
+	`
 	MySQLGetTableSize string = `
 		SELECT
 			table_name AS "Table",
@@ -182,6 +506,127 @@ const (
 		WHERE NOT 
 			datistemplate
 	`
+	PostgreSQLViewDefinition string = `
+		SELECT
+			pg_get_viewdef(c.oid, true)
+		FROM
+			pg_class c
+		JOIN
+			pg_namespace n ON n.oid = c.relnamespace
+		WHERE
+			n.nspname = %s
+		AND
+			c.relname = %s
+		AND
+			c.relkind = 'v'
+	`
+	// PostgreSQLRoutines lists the functions and procedures of a schema; the definition is only readable by their owner
+	PostgreSQLRoutines string = `
+		SELECT
+			routine_name,
+			COALESCE(routine_type, 'FUNCTION'),
+			COALESCE(routine_definition, '')
+		FROM
+			information_schema.routines
+		WHERE
+			routine_schema = %s
+		ORDER BY
+			routine_name
+	`
+	// MySQLLockWaits pairs every transaction waiting for a row lock with the one holding it, from the
+	// performance_schema tables of MySQL 8.0. The wait is counted in seconds
+	MySQLLockWaits string = `
+		SELECT
+			r.trx_mysql_thread_id,
+			COALESCE(rt.PROCESSLIST_USER, ''),
+			COALESCE(r.trx_query, ''),
+			b.trx_mysql_thread_id,
+			COALESCE(bt.PROCESSLIST_USER, ''),
+			COALESCE(b.trx_query, ''),
+			COALESCE(CONCAT(l.OBJECT_SCHEMA, '.', l.OBJECT_NAME), ''),
+			COALESCE(l.LOCK_MODE, ''),
+			COALESCE(TIMESTAMPDIFF(SECOND, r.trx_wait_started, NOW()), 0)
+		FROM
+			performance_schema.data_lock_waits w
+		JOIN
+			information_schema.INNODB_TRX r ON r.trx_id = w.REQUESTING_ENGINE_TRANSACTION_ID
+		JOIN
+			information_schema.INNODB_TRX b ON b.trx_id = w.BLOCKING_ENGINE_TRANSACTION_ID
+		LEFT JOIN
+			performance_schema.data_locks l ON l.ENGINE_LOCK_ID = w.REQUESTING_ENGINE_LOCK_ID
+		LEFT JOIN
+			performance_schema.threads rt ON rt.THREAD_ID = w.REQUESTING_THREAD_ID
+		LEFT JOIN
+			performance_schema.threads bt ON bt.THREAD_ID = w.BLOCKING_THREAD_ID
+		ORDER BY
+			9 DESC, 1
+	`
+	// MySQLLegacyLockWaits is MySQLLockWaits for MySQL 5.7, whose lock waits are in information_schema;
+	// the backticks quoting lock_table, CHAR(96), are removed
+	MySQLLegacyLockWaits string = `
+		SELECT
+			r.trx_mysql_thread_id,
+			COALESCE(rp.USER, ''),
+			COALESCE(r.trx_query, ''),
+			b.trx_mysql_thread_id,
+			COALESCE(bp.USER, ''),
+			COALESCE(b.trx_query, ''),
+			COALESCE(REPLACE(l.lock_table, CHAR(96), ''), ''),
+			COALESCE(l.lock_mode, ''),
+			COALESCE(TIMESTAMPDIFF(SECOND, r.trx_wait_started, NOW()), 0)
+		FROM
+			information_schema.INNODB_LOCK_WAITS w
+		JOIN
+			information_schema.INNODB_TRX r ON r.trx_id = w.requesting_trx_id
+		JOIN
+			information_schema.INNODB_TRX b ON b.trx_id = w.blocking_trx_id
+		LEFT JOIN
+			information_schema.INNODB_LOCKS l ON l.lock_id = w.requested_lock_id
+		LEFT JOIN
+			information_schema.PROCESSLIST rp ON rp.ID = r.trx_mysql_thread_id
+		LEFT JOIN
+			information_schema.PROCESSLIST bp ON bp.ID = b.trx_mysql_thread_id
+		ORDER BY
+			9 DESC, 1
+	`
+	// PostgreSQLLockWaits pairs every backend waiting for a lock with each backend blocking it, along with
+	// the lock it waits for. The wait is counted in seconds since its statement started
+	PostgreSQLLockWaits string = `
+		SELECT
+			blocked.pid,
+			COALESCE(blocked.usename, ''),
+			COALESCE(blocked.query, ''),
+			blocking.pid,
+			COALESCE(blocking.usename, ''),
+			COALESCE(blocking.query, ''),
+			COALESCE(waiting.relation::regclass::text, waiting.locktype, ''),
+			COALESCE(waiting.mode, ''),
+			COALESCE(EXTRACT(EPOCH FROM now() - blocked.query_start)::bigint, 0)
+		FROM
+			pg_stat_activity blocked
+		JOIN LATERAL
+			unnest(pg_blocking_pids(blocked.pid)) AS blocker(pid) ON true
+		JOIN
+			pg_stat_activity blocking ON blocking.pid = blocker.pid
+		LEFT JOIN LATERAL (
+			SELECT l.relation, l.locktype, l.mode FROM pg_locks l WHERE l.pid = blocked.pid AND NOT l.granted LIMIT 1
+		) waiting ON true
+		ORDER BY
+			9 DESC, 1, 4
+	`
+	// PostgreSQLEstimateRows reads the planner's row estimate, negative for a table never vacuumed or analyzed
+	PostgreSQLEstimateRows string = `
+		SELECT
+			c.reltuples::bigint
+		FROM
+			pg_class c
+		JOIN
+			pg_namespace n ON n.oid = c.relnamespace
+		WHERE
+			n.nspname = %s
+		AND
+			c.relname = %s
+	`
 	PostgreSQLShowTables string = `
 		SELECT 
 			table_name 
@@ -190,8 +635,26 @@ const (
 		WHERE 
 			table_schema = '%s'
 	`
-	PostgreSQLSelectAllWithLimit string = `SELECT %s FROM %s.%s LIMIT %d OFFSET %d`
-	PostgreSQLSchemaSize         string = `
+	PostgreSQLTableTypes         string = `SELECT table_name, table_type = 'VIEW' FROM information_schema.tables WHERE table_schema = %s`
+	PostgreSQLIsView             string = `SELECT table_type = 'VIEW' FROM information_schema.tables WHERE table_schema = %s AND table_name = %s`
+	PostgreSQLSelectAllWithLimit string = `SELECT %s FROM %s.%s%s LIMIT %d OFFSET %d`
+	PostgreSQLSetSearchPath      string = `SET search_path TO %s`
+	PostgreSQLResetSearchPath    string = `RESET search_path`
+	PostgreSQLExplain            string = `EXPLAIN %s`
+	PostgreSQLPrepareValidate    string = `PREPARE sqlweb_validate AS `
+	PostgreSQLDeallocateValidate string = `DEALLOCATE sqlweb_validate`
+	PostgreSQLShowSearchPath     string = `SHOW search_path`
+	PostgreSQLTableComment       string = `
+		SELECT
+			COALESCE(obj_description(c.oid, 'pg_class'), '')
+		FROM
+			pg_catalog.pg_class c
+		JOIN
+			pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+		WHERE
+			n.nspname = '%s' AND c.relname = '%s';
+	`
+	PostgreSQLSchemaSize string = `
 		SELECT 
 			pg_size_pretty(pg_database_size(current_database())) 
 		AS 
@@ -213,6 +676,163 @@ const (
 		FROM 
 			%s.%s
 	`
+	PostgreSQLDependentViews string = `
+		SELECT DISTINCT
+			v.relname
+		FROM
+			pg_depend d
+		JOIN
+			pg_rewrite r ON r.oid = d.objid
+		JOIN
+			pg_class v ON v.oid = r.ev_class
+		JOIN
+			pg_class t ON t.oid = d.refobjid
+		JOIN
+			pg_namespace n ON n.oid = t.relnamespace
+		JOIN
+			pg_attribute a ON a.attrelid = t.oid AND a.attnum = d.refobjsubid
+		WHERE
+			d.classid = 'pg_rewrite'::regclass
+		AND
+			d.refclassid = 'pg_class'::regclass
+		AND
+			v.oid <> t.oid
+		AND
+			n.nspname = '%s' AND t.relname = '%s' AND a.attname = '%s'
+		ORDER BY
+			v.relname;
+	`
+	PostgreSQLReferencingForeignKeys string = `
+		SELECT
+			cl.relname,
+			att.attname,
+			con.conname
+		FROM
+			pg_constraint con
+		JOIN
+			pg_class cl ON cl.oid = con.conrelid
+		JOIN
+			pg_class ref ON ref.oid = con.confrelid
+		JOIN
+			pg_namespace n ON n.oid = ref.relnamespace
+		JOIN LATERAL
+			unnest(con.conkey, con.confkey) AS k(conkey, confkey) ON true
+		JOIN
+			pg_attribute att ON att.attrelid = con.conrelid AND att.attnum = k.conkey
+		JOIN
+			pg_attribute ratt ON ratt.attrelid = con.confrelid AND ratt.attnum = k.confkey
+		WHERE
+			con.contype = 'f'
+		AND
+			n.nspname = '%s' AND ref.relname = '%s' AND ratt.attname = '%s';
+	`
+	PostgreSQLCharsets string = `
+		SELECT
+			pg_encoding_to_char(e),
+			'',
+			''
+		FROM
+			generate_series(0, 63) e
+		WHERE
+			pg_encoding_to_char(e) <> ''
+		ORDER BY
+			1;
+	`
+	PostgreSQLCollations string = `
+		SELECT
+			collname,
+			CASE WHEN collencoding = -1 THEN '' ELSE pg_encoding_to_char(collencoding) END,
+			COALESCE(collcollate, ''),
+			collname = 'default'
+		FROM
+			pg_collation
+		ORDER BY
+			collname;
+	`
+	PostgreSQLTsvectorColumns string = `
+		SELECT
+			'',
+			column_name
+		FROM
+			information_schema.columns
+		WHERE
+			table_schema = '%s'
+		AND
+			table_name = '%s'
+		AND
+			data_type = 'tsvector'
+		ORDER BY
+			ordinal_position;
+	`
+	PostgreSQLTablesLastModified string = `
+		SELECT
+			relname,
+			EXTRACT(EPOCH FROM GREATEST(last_vacuum, last_autovacuum, last_analyze, last_autoanalyze)),
+			n_mod_since_analyze
+		FROM
+			pg_stat_user_tables
+		WHERE
+			schemaname = '%s';
+	`
+	PostgreSQLReferencingTables string = `
+		SELECT
+			cl.relname,
+			con.conname,
+			con.conname,
+			att.attname,
+			ratt.attname,
+			CASE con.confdeltype
+				WHEN 'r' THEN 'RESTRICT'
+				WHEN 'c' THEN 'CASCADE'
+				WHEN 'n' THEN 'SET NULL'
+				WHEN 'd' THEN 'SET DEFAULT'
+				ELSE 'NO ACTION'
+			END
+		FROM
+			pg_constraint con
+		JOIN
+			pg_class cl ON cl.oid = con.conrelid
+		JOIN
+			pg_class ref ON ref.oid = con.confrelid
+		JOIN
+			pg_namespace n ON n.oid = ref.relnamespace
+		JOIN LATERAL
+			unnest(con.conkey, con.confkey) WITH ORDINALITY AS k(conkey, confkey, ord) ON true
+		JOIN
+			pg_attribute att ON att.attrelid = con.conrelid AND att.attnum = k.conkey
+		JOIN
+			pg_attribute ratt ON ratt.attrelid = con.confrelid AND ratt.attnum = k.confkey
+		WHERE
+			con.contype = 'f'
+		AND
+			n.nspname = '%s' AND ref.relname = '%s'
+		ORDER BY
+			cl.relname, con.conname, k.ord;
+	`
+	PostgreSQLTableBloat string = `
+		SELECT
+			c.relname,
+			pg_relation_size(c.oid)::bigint,
+			COALESCE(s.n_live_tup, 0)::bigint,
+			COALESCE(s.n_dead_tup, 0)::bigint,
+			GREATEST(
+				pg_relation_size(c.oid) - CEIL(
+					COALESCE(s.n_live_tup, 0) * (28 + COALESCE((
+						SELECT SUM(avg_width) FROM pg_stats
+						WHERE schemaname = n.nspname AND tablename = c.relname
+					), 0)) / (current_setting('block_size')::numeric - 24)
+				) * current_setting('block_size')::numeric,
+				0
+			)::bigint
+		FROM
+			pg_class c
+		JOIN
+			pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN
+			pg_stat_user_tables s ON s.relid = c.oid
+		WHERE
+			n.nspname = '%s' AND c.relname = '%s' AND c.relkind IN ('r', 'm');
+	`
 	PostgreSQLTableSize string = `
 		WITH table_info AS (
     		SELECT
@@ -254,11 +874,65 @@ const (
 		NOT IN 
 			('pg_catalog', 'information_schema')
 	`
-	PostgreSQLDropTable      string = `DROP TABLE IF EXISTS %s`
-	PostgreSQLDropDatabase   string = `DROP DATABASE IF EXISTS %s`
-	PostgreSQLCreateDatabase string = `CREATE DATABASE %s`
-	PostgreSQLTruncateTable  string = `TRUNCATE TABLE %s`
-	PostgreSQLColumnsInfo    string = `
+	// PostgreSQLOwnedSequences lists the sequences owned by the columns of a table, e.g. those backing serial columns
+	PostgreSQLOwnedSequences string = `
+		SELECT
+			quote_ident(sn.nspname) || '.' || quote_ident(s.relname),
+			quote_ident(a.attname),
+			seq.increment_by,
+			seq.min_value,
+			seq.max_value,
+			seq.start_value,
+			seq.cycle
+		FROM
+			pg_depend d
+		JOIN pg_class s ON s.oid = d.objid AND s.relkind = 'S'
+		JOIN pg_namespace sn ON sn.oid = s.relnamespace
+		JOIN pg_class t ON t.oid = d.refobjid
+		JOIN pg_namespace tn ON tn.oid = t.relnamespace
+		JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = d.refobjsubid
+		JOIN pg_sequences seq ON seq.schemaname = sn.nspname AND seq.sequencename = s.relname
+		WHERE
+			d.classid = 'pg_class'::regclass
+		AND
+			d.refclassid = 'pg_class'::regclass
+		AND
+			d.deptype = 'a'
+		AND
+			tn.nspname = '%s'
+		AND
+			t.relname = '%s'
+		ORDER BY
+			a.attnum;
+	`
+	// PostgreSQLTableTriggers lists the user triggers of a table along with the definition of their functions
+	PostgreSQLTableTriggers string = `
+		SELECT
+			pg_get_functiondef(tg.tgfoid),
+			pg_get_triggerdef(tg.oid)
+		FROM
+			pg_trigger tg
+		JOIN pg_class c ON c.oid = tg.tgrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE
+			NOT tg.tgisinternal
+		AND
+			n.nspname = '%s'
+		AND
+			c.relname = '%s'
+		ORDER BY
+			tg.tgname;
+	`
+	PostgreSQLDropTable        string = `DROP TABLE IF EXISTS %s`
+	PostgreSQLDropDatabase     string = `DROP DATABASE %s`
+	PostgreSQLCreateDatabase   string = `CREATE DATABASE %s`
+	PostgreSQLDatabaseEncoding string = ` ENCODING %s`
+	PostgreSQLDatabaseLocale   string = ` LC_COLLATE %s`
+	PostgreSQLTemplate0        string = ` TEMPLATE template0`
+	PostgreSQLTruncateTable    string = `TRUNCATE TABLE %s`
+	PostgreSQLSetTableComment  string = `COMMENT ON TABLE %s IS %s`
+	PostgreSQLSetColumnComment string = `COMMENT ON COLUMN %s.%s IS %s`
+	PostgreSQLColumnsInfo      string = `
 		SELECT 
 			c.column_name AS Field, 
 			c.data_type AS Type,
@@ -269,7 +943,14 @@ const (
 				END AS Key,
 				COALESCE(tc.constraint_name, '') AS ConstraintName,
 				COALESCE(ccu.table_name, '') AS ReferencedTable,
-				COALESCE(ccu.column_name, '') AS ReferencedColumn
+				COALESCE(ccu.column_name, '') AS ReferencedColumn,
+				COALESCE(col_description(
+					(quote_ident(c.table_schema) || '.' || quote_ident(c.table_name))::regclass,
+					c.ordinal_position
+				), '') AS Comment,
+				c.column_default AS column_default,
+				c.is_generated = 'ALWAYS' AS is_generated,
+				c.is_nullable = 'YES' AS nullable
 			FROM 
 				information_schema.columns c
 			LEFT JOIN 
@@ -396,9 +1077,14 @@ const (
 
 		-- suffix create statement with all of the indexes on the table
 		FOR v_index_record IN
-			SELECT indexdef
-			FROM pg_indexes
-			WHERE (schemaname, tablename) = (in_schema_name, in_table_name)
+			SELECT pg_get_indexdef(i.indexrelid) AS indexdef
+			FROM pg_index i
+			JOIN pg_class rel ON rel.oid = i.indrelid
+			JOIN pg_namespace nsp ON nsp.oid = rel.relnamespace
+			WHERE nsp.nspname = in_schema_name
+			AND rel.relname = in_table_name
+			-- indexes backing primary key and unique constraints come with the constraints
+			AND NOT EXISTS (SELECT 1 FROM pg_constraint con WHERE con.conindid = i.indexrelid)
 		LOOP
 			v_table_ddl := v_table_ddl
 				|| v_index_record.indexdef
@@ -0,0 +1,288 @@
+// Package api holds the types of the sqlweb HTTP API: the response envelope and the data
+// of each response. The handlers encode them and pkg/apiclient decodes them, so the server
+// and the Go client cannot drift apart.
+package api
+
+import (
+	"time"
+
+	"github.com/yazeed1s/sqlweb/db/connection"
+	_client "github.com/yazeed1s/sqlweb/pkg/client"
+	"github.com/yazeed1s/sqlweb/pkg/config"
+	"github.com/yazeed1s/sqlweb/pkg/query"
+)
+
+// Response is the JSON envelope every handler responds with.
+// Code is set on errors the client is expected to act on, such as connection_lost or schema_changed.
+// Pagination is set on the responses of paginated endpoints and describes the page Data holds.
+type Response struct {
+	Message    string      `json:"message"`
+	Data       interface{} `json:"data,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	Code       string      `json:"code,omitempty"`
+	Pagination *Pagination `json:"pagination,omitempty"`
+}
+
+// Pagination describes one page of a paginated response. Page counts from 1.
+type Pagination struct {
+	Page       int  `json:"page"`
+	PerPage    int  `json:"perPage"`
+	TotalRows  int  `json:"totalRows"`
+	TotalPages int  `json:"totalPages"`
+	HasMore    bool `json:"hasMore"`
+}
+
+// NewPagination returns the pagination of the given page of totalRows rows split in pages of perPage.
+// There is always at least one page, even when there are no rows.
+func NewPagination(page, perPage, totalRows int) *Pagination {
+	totalPages := 1
+	if perPage > 0 && totalRows > perPage {
+		totalPages = (totalRows + perPage - 1) / perPage
+	}
+	return &Pagination{
+		Page:       page,
+		PerPage:    perPage,
+		TotalRows:  totalRows,
+		TotalPages: totalPages,
+		HasMore:    page < totalPages,
+	}
+}
+
+// ConnectData is the data of a successful /connect response.
+type ConnectData struct {
+	Schema string               `json:"schema"`
+	Tables []_client.ColumnData `json:"tables"`
+	// Settings are the defaults of the connection, for the UI to initialize its controls with
+	Settings connection.Settings `json:"settings"`
+	// Preview holds the first rows of a table when the connect request asked for them with 'preview'
+	Preview      *_client.Table `json:"preview,omitempty"`
+	PreviewError string         `json:"previewError,omitempty"`
+}
+
+// TableData is the data of a /table response when the server runs without legacy pagination:
+// one page of rows, described by the Pagination of the response.
+type TableData struct {
+	Table *_client.Table `json:"table"`
+}
+
+// TablePage is the data of a /table response: one page of rows along with the totals.
+// TotalRows and TotalPages predate Response.Pagination and are only sent while the server keeps
+// legacy pagination on; apiclient.Client.GetTable fills them from the pagination otherwise.
+type TablePage struct {
+	TableData
+	TotalRows  int     `json:"total_rows"`
+	TotalPages float64 `json:"total_pages"`
+	// Pagination is the pagination of the response
+	Pagination *Pagination `json:"-"`
+}
+
+// ResultData is the data of the endpoints that run a statement, such as /execute,
+// /queries/history/rerun and the row and table edits.
+type ResultData struct {
+	Result *query.Result `json:"result"`
+	// Reproduction is set when /execute is asked for it with shareable=true
+	Reproduction *Reproduction `json:"reproduction,omitempty"`
+}
+
+// Reproduction describes a query that ran, for bug reports and sharing. It never holds the user, password
+// or credentials of the connection, and passwords written in the query are redacted.
+type Reproduction struct {
+	SQL string `json:"sql"`
+	// Params are the values bound to the placeholders of a saved query, those of secret-looking names redacted
+	Params     map[string]interface{} `json:"params,omitempty"`
+	Connection SharedConnection       `json:"connection"`
+	Version    string                 `json:"version"`
+	TimeMS     int64                  `json:"time_ms"`
+	// Curl runs the query again through the API
+	Curl string `json:"curl"`
+}
+
+// SharedConnection tells which database a shared query ran on, without the user or credentials of the connection.
+type SharedConnection struct {
+	Type     string `json:"databaseType"`
+	Host     string `json:"host,omitempty"`
+	Port     int    `json:"port,omitempty"`
+	Database string `json:"database,omitempty"`
+	// Path is the SQLite database file, without the options of its DSN
+	Path   string `json:"path,omitempty"`
+	Schema string `json:"schema,omitempty"`
+}
+
+// ReproductionData is the data of a failed run that was asked for its reproduction with shareable=true.
+type ReproductionData struct {
+	Reproduction *Reproduction `json:"reproduction"`
+}
+
+// ResultsData is the data of the endpoints that run several statements, one result each.
+type ResultsData struct {
+	Result []*query.Result `json:"result"`
+}
+
+// RowEditData is the data of a /row/update response.
+type RowEditData struct {
+	Result *query.RowEditResult `json:"result"`
+}
+
+// RerunData is the data of a /queries/history/rerun response: the new result, and the run it repeats.
+type RerunData struct {
+	Result   *query.Result `json:"result"`
+	Previous PreviousRun   `json:"previous"`
+}
+
+// PreviousRun is the history entry a rerun repeats.
+type PreviousRun struct {
+	ID           string    `json:"id"`
+	AffectedRows int64     `json:"affected_rows"`
+	Time         string    `json:"time_taken"`
+	ExecutedAt   time.Time `json:"executed_at"`
+}
+
+// SavedQueryRunData is the data of a saved query run: its result, the saved query, and the
+// reproduction of the run when it was asked for with shareable=true.
+type SavedQueryRunData struct {
+	Result       *query.Result     `json:"result"`
+	Query        config.SavedQuery `json:"query"`
+	Reproduction *Reproduction     `json:"reproduction,omitempty"`
+}
+
+// MissingParamsData is the data of a missing_params error: the params of the saved query
+// without a value, and every param of the query.
+type MissingParamsData struct {
+	Missing []string `json:"missing"`
+	Params  []string `json:"params"`
+}
+
+// ConfirmationData is the data of a confirmation_required error: the tables the statement
+// changes, and the token to send back to run it.
+type ConfirmationData struct {
+	Targets []query.TableRef `json:"targets"`
+	// Production tells whether the connection is marked as production
+	Production   bool   `json:"production"`
+	ConfirmToken string `json:"confirm_token"`
+}
+
+// SystemSchemaData is the data of a system_schema error: the system tables the statement
+// targets, and the token to send back, together with allowSystem, to run it.
+type SystemSchemaData struct {
+	Targets      []query.TableRef `json:"targets"`
+	ConfirmToken string           `json:"confirm_token"`
+}
+
+// ProtectedColumnsData is the data of a column_protected error.
+type ProtectedColumnsData struct {
+	Table   string   `json:"table"`
+	Columns []string `json:"columns"`
+}
+
+// FingerprintData is the data of a schema_changed error: the current fingerprint of the table.
+type FingerprintData struct {
+	Fingerprint string `json:"fingerprint"`
+}
+
+// CollationsData is the data of an unknown_collation error: the collations the database knows.
+type CollationsData struct {
+	Available []string `json:"available"`
+}
+
+// AttachedData lists the databases attached to a SQLite connection.
+type AttachedData struct {
+	Attached []connection.Attachment `json:"attached"`
+}
+
+// AttachData is the data of a /sqlite/attach response: the attached databases and their tables.
+type AttachData struct {
+	AttachedData
+	Tables []string `json:"tables"`
+}
+
+// ColumnCountData is the number of columns of a table.
+type ColumnCountData struct {
+	Table   string `json:"table"`
+	Columns int    `json:"columns"`
+}
+
+// RowCountData is the number of rows of a table.
+type RowCountData struct {
+	Table string `json:"table"`
+	Rows  int    `json:"rows"`
+}
+
+// RecentTablesData lists the tables of the connection opened last, and its favorite tables.
+type RecentTablesData struct {
+	Recent    []config.RecentTable `json:"recent"`
+	Favorites []string             `json:"favorites"`
+}
+
+// FavoriteData tells whether a table is now a favorite.
+type FavoriteData struct {
+	Table    string `json:"table"`
+	Favorite bool   `json:"favorite"`
+}
+
+// TableSizeData is the size of one table.
+type TableSizeData struct {
+	Table NamedTableSize `json:"table"`
+}
+
+// NamedTableSize is the size of the named table.
+type NamedTableSize struct {
+	Name string            `json:"name"`
+	Size _client.TableSize `json:"size"`
+}
+
+// TableSizesData is the data of a /table/size/ response: the size of every table.
+type TableSizesData struct {
+	TableSize []_client.TableSize `json:"table_size"`
+}
+
+// TableBloatData is the data of a /table/bloat response.
+type TableBloatData struct {
+	Result *_client.TableBloat `json:"result"`
+}
+
+// ViewsData lists the views of the schema.
+type ViewsData struct {
+	Result []_client.View `json:"result"`
+}
+
+// RoutinesData lists the routines of the schema.
+type RoutinesData struct {
+	Result []_client.Routine `json:"result"`
+}
+
+// LockWaitsData lists the sessions waiting on a lock.
+type LockWaitsData struct {
+	Result []_client.LockWait `json:"result"`
+}
+
+// ReferencesData lists the tables whose foreign keys reference a table.
+type ReferencesData struct {
+	Result []_client.ReferencingTable `json:"result"`
+}
+
+// CharsetsData lists the charsets and collations of the database.
+type CharsetsData struct {
+	Result *_client.Charsets `json:"result"`
+}
+
+// FormatData is the data of a /format response: the formatted query.
+type FormatData struct {
+	Query string `json:"query"`
+}
+
+// SafeModeData tells whether safe mode is on.
+type SafeModeData struct {
+	SafeMode bool `json:"safeMode"`
+}
+
+// VersionData is the schema version the UI polls to know when to reload the tables.
+type VersionData struct {
+	Version string `json:"version"`
+}
+
+// CacheRefreshData is the data of a /cache/refresh response: the number of tables read
+// again, and the new schema version.
+type CacheRefreshData struct {
+	Tables  int    `json:"tables"`
+	Version string `json:"version"`
+}
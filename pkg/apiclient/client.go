@@ -0,0 +1,224 @@
+package apiclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Export formats accepted by Client.Export.
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// Error is returned when the server answers with an error response.
+type Error struct {
+	Status  int
+	Message string
+	Err     string
+	Code    string
+	// Data holds the raw data of the response, e.g. the confirm token of a system_schema error
+	Data json.RawMessage
+}
+
+func (e *Error) Error() string {
+	if e.Err == "" {
+		return fmt.Sprintf("sqlweb: %d: %s", e.Status, e.Message)
+	}
+	return fmt.Sprintf("sqlweb: %d: %s: %s", e.Status, e.Message, e.Err)
+}
+
+// Client calls a sqlweb server. It holds no state besides the address: the server
+// keeps the active database connection, so calls are made in the order a user would.
+type Client struct {
+	baseURL string
+	http    *http.Client
+}
+
+// New returns a client for the server at baseURL, e.g. "http://localhost:3000".
+// A nil httpClient uses http.DefaultClient.
+func New(baseURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{baseURL: strings.TrimRight(baseURL, "/"), http: httpClient}
+}
+
+// Connect opens the connection on the server and returns the schema and its tables.
+func (c *Client) Connect(conn *Connection) (*ConnectData, error) {
+	var data ConnectData
+	if err := c.do(http.MethodPost, "/connect", nil, conn, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// Disconnect closes the server's database connection.
+func (c *Client) Disconnect() error {
+	return c.do(http.MethodPost, "/disconnect", nil, nil, nil)
+}
+
+// GetTable returns one page of the table's rows.
+func (c *Client) GetTable(name string, page, perPage int) (*TablePage, error) {
+	var (
+		data   TablePage
+		params url.Values
+	)
+
+	params = url.Values{}
+	params.Set("name", name)
+	params.Set("page", strconv.Itoa(page))
+	params.Set("perPage", strconv.Itoa(perPage))
+	pagination, err := c.doPaginated(http.MethodGet, "/table", params, nil, &data)
+	if err != nil {
+		return nil, err
+	}
+	data.Pagination = pagination
+	if pagination != nil {
+		data.TotalRows = pagination.TotalRows
+		data.TotalPages = float64(pagination.TotalPages)
+	}
+	return &data, nil
+}
+
+// Execute runs the SQL query and returns its result.
+func (c *Client) Execute(sqlQuery string) (*Result, error) {
+	var data ResultData
+	if err := c.do(http.MethodPost, "/execute", nil, &Query{SQLQuery: sqlQuery}, &data); err != nil {
+		return nil, err
+	}
+	return data.Result, nil
+}
+
+// Export returns the whole table in the given format, FormatCSV or FormatJSON.
+func (c *Client) Export(table, format string) ([]byte, error) {
+	var (
+		err      error
+		params   url.Values
+		response *http.Response
+	)
+
+	if format != FormatCSV && format != FormatJSON {
+		return nil, fmt.Errorf("unsupported export format: %s", format)
+	}
+	params = url.Values{}
+	params.Set("name", table)
+	response, err = c.send(http.MethodGet, "/export/"+format, params, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			return
+		}
+	}(response.Body)
+
+	if response.StatusCode >= http.StatusBadRequest {
+		return nil, decodeError(response)
+	}
+	return io.ReadAll(response.Body)
+}
+
+// do sends the request and decodes the data of the response envelope into out, which may be nil.
+func (c *Client) do(method, path string, params url.Values, body, out interface{}) error {
+	_, err := c.doPaginated(method, path, params, body, out)
+	return err
+}
+
+// doPaginated is do for paginated endpoints: it also returns the pagination of the response, if any.
+func (c *Client) doPaginated(method, path string, params url.Values, body, out interface{}) (*Pagination, error) {
+	var (
+		err      error
+		response *http.Response
+		envelope struct {
+			Response
+			Data json.RawMessage `json:"data,omitempty"`
+		}
+	)
+
+	response, err = c.send(method, path, params, body)
+	if err != nil {
+		return nil, err
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			return
+		}
+	}(response.Body)
+
+	if response.StatusCode >= http.StatusBadRequest {
+		return nil, decodeError(response)
+	}
+	if err = json.NewDecoder(response.Body).Decode(&envelope); err != nil {
+		return nil, fmt.Errorf("error decoding response: %w", err)
+	}
+	if out == nil || len(envelope.Data) == 0 {
+		return envelope.Pagination, nil
+	}
+	if err = json.Unmarshal(envelope.Data, out); err != nil {
+		return nil, fmt.Errorf("error decoding response data: %w", err)
+	}
+	return envelope.Pagination, nil
+}
+
+func (c *Client) send(method, path string, params url.Values, body interface{}) (*http.Response, error) {
+	var (
+		err     error
+		reader  io.Reader
+		request *http.Request
+		target  string
+	)
+
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding request: %w", err)
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	target = c.baseURL + path
+	if len(params) > 0 {
+		target += "?" + params.Encode()
+	}
+	request, err = http.NewRequest(method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	return c.http.Do(request)
+}
+
+// decodeError turns an error response into an *Error. Responses that are not a JSON envelope,
+// such as the plain text written by http.Error, are kept as the message.
+func decodeError(response *http.Response) error {
+	var (
+		raw      []byte
+		envelope struct {
+			Response
+			Data json.RawMessage `json:"data,omitempty"`
+		}
+	)
+
+	raw, _ = io.ReadAll(response.Body)
+	apiErr := &Error{Status: response.StatusCode}
+	if json.Unmarshal(raw, &envelope) != nil {
+		apiErr.Message = strings.TrimSpace(string(raw))
+		return apiErr
+	}
+	apiErr.Message = envelope.Message
+	apiErr.Err = envelope.Error
+	apiErr.Code = envelope.Code
+	apiErr.Data = envelope.Data
+	return apiErr
+}
@@ -0,0 +1,112 @@
+package apiclient_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_sql "github.com/yazeed1s/sqlweb/db/sql"
+	"github.com/yazeed1s/sqlweb/pkg/apiclient"
+	"github.com/yazeed1s/sqlweb/pkg/handler"
+	_http "github.com/yazeed1s/sqlweb/pkg/http"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupServer starts the real router on a test server and connects it to an empty SQLite database.
+func setupServer(t *testing.T) *apiclient.Client {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	mux := http.NewServeMux()
+	_http.RegisterRoutes(mux, handler.NewHandler())
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	c := apiclient.New(server.URL, server.Client())
+	_, err := c.Connect(&apiclient.Connection{
+		Name: "test",
+		Type: _sql.SQLite,
+		Path: filepath.Join(t.TempDir(), "test.db"),
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c.Disconnect() })
+	return c
+}
+
+func TestClientEndToEnd(t *testing.T) {
+	c := setupServer(t)
+
+	_, err := c.Execute(`CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT)`)
+	require.NoError(t, err)
+	_, err = c.Execute(`INSERT INTO people (name) VALUES ('ada'), ('grace'), ('linus')`)
+	require.NoError(t, err)
+
+	result, err := c.Execute(`SELECT name FROM people ORDER BY id`)
+	require.NoError(t, err)
+	require.Len(t, result.Data, 3)
+	assert.Equal(t, "ada", result.Data[0]["name"])
+
+	page, err := c.GetTable("people", 1, 2)
+	require.NoError(t, err)
+	require.NotNil(t, page.Table)
+	assert.Equal(t, "people", page.Table.Name)
+	assert.Equal(t, 3, page.TotalRows)
+	require.NotNil(t, page.Pagination)
+	assert.Equal(t, 2, page.Pagination.TotalPages)
+	assert.True(t, page.Pagination.HasMore)
+	assert.Len(t, page.Table.Data, 2)
+	assert.NotEmpty(t, page.Table.Fingerprint)
+
+	csv, err := c.Export("people", apiclient.FormatCSV)
+	require.NoError(t, err)
+	assert.Equal(t, "id,name\n1,ada\n2,grace\n3,linus\n", string(csv))
+
+	raw, err := c.Export("people", apiclient.FormatJSON)
+	require.NoError(t, err)
+	var rows []map[string]interface{}
+	require.NoError(t, json.Unmarshal(raw, &rows))
+	assert.Len(t, rows, 3)
+}
+
+func TestClientConnectListsTables(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	mux := http.NewServeMux()
+	_http.RegisterRoutes(mux, handler.NewHandler())
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "test.db")
+	c := apiclient.New(server.URL, server.Client())
+	_, err := c.Connect(&apiclient.Connection{Name: "test", Type: _sql.SQLite, Path: path})
+	require.NoError(t, err)
+	_, err = c.Execute(`CREATE TABLE notes (id INTEGER PRIMARY KEY, body TEXT)`)
+	require.NoError(t, err)
+
+	data, err := c.Connect(&apiclient.Connection{Name: "test", Type: _sql.SQLite, Path: path})
+	require.NoError(t, err)
+	require.Len(t, data.Tables, 1)
+	assert.Equal(t, "notes", data.Tables[0].TableName)
+	assert.Len(t, data.Tables[0].Columns, 2)
+}
+
+func TestClientErrorResponse(t *testing.T) {
+	c := setupServer(t)
+
+	_, err := c.Execute(`SELECT * FROM missing`)
+	require.Error(t, err)
+	var apiErr *apiclient.Error
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadRequest, apiErr.Status)
+	assert.Equal(t, "Failed to execute query", apiErr.Message)
+	assert.True(t, strings.Contains(apiErr.Err, "missing"))
+
+	_, err = c.Export("people", "xml")
+	assert.Error(t, err)
+}
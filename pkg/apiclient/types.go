@@ -0,0 +1,37 @@
+// Package apiclient is a Go client for the sqlweb HTTP API.
+//
+// The request and response types are the ones the handlers encode, aliased from pkg/api and
+// the packages that define them, so the client and the server cannot drift apart.
+package apiclient
+
+import (
+	"github.com/yazeed1s/sqlweb/db/connection"
+	"github.com/yazeed1s/sqlweb/pkg/api"
+	_client "github.com/yazeed1s/sqlweb/pkg/client"
+	"github.com/yazeed1s/sqlweb/pkg/query"
+)
+
+type (
+	Connection = connection.Connection
+	Query      = query.Query
+	Result     = query.Result
+	Table      = _client.Table
+	Row        = _client.Row
+	RowSet     = _client.RowSet
+	Column     = _client.Column
+	ColumnData = _client.ColumnData
+
+	Response         = api.Response
+	Pagination       = api.Pagination
+	ConnectData      = api.ConnectData
+	TableData        = api.TableData
+	TablePage        = api.TablePage
+	ResultData       = api.ResultData
+	Reproduction     = api.Reproduction
+	SharedConnection = api.SharedConnection
+)
+
+// NewPagination returns the pagination of the given page of totalRows rows split in pages of perPage.
+func NewPagination(page, perPage, totalRows int) *Pagination {
+	return api.NewPagination(page, perPage, totalRows)
+}
@@ -1,22 +1,35 @@
 package app
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/yazeed1s/sqlweb/pkg/cli"
+	_client "github.com/yazeed1s/sqlweb/pkg/client"
+	"github.com/yazeed1s/sqlweb/pkg/config"
 	"github.com/yazeed1s/sqlweb/pkg/handler"
 	_http "github.com/yazeed1s/sqlweb/pkg/http"
-	_static "github.com/yazeed1s/sqlweb/static"
+	"github.com/yazeed1s/sqlweb/pkg/tracing"
 )
 
 type App struct {
-	Args    *cli.Args
-	Router  *http.ServeMux
-	Handler *handler.Handler
+	Args *cli.Args
+	// Router serves the API, and the UI too unless the API has a port of its own
+	Router *http.ServeMux
+	// UIRouter serves the UI on its own port when the API has one, nil otherwise
+	UIRouter *http.ServeMux
+	Handler  *handler.Handler
+	Limits   _http.Limits
 }
 
 func NewApp() *App {
@@ -34,8 +47,33 @@ func (app *App) ParseFlags() error {
 		err         error
 	)
 	flag.IntVar(&app.Args.Port, "p", app.Args.Port, "Set the port number (default: 3000)")
+	flag.IntVar(&app.Args.APIPort, "api-port", app.Args.APIPort, "Serve the API on this port and the UI alone on -p")
+	flag.StringVar(&app.Args.UIOrigin, "ui-origin", app.Args.UIOrigin, "Allow only this origin to call the API on -api-port")
+	flag.BoolVar(&app.Args.NoUI, "no-ui", app.Args.NoUI, "Serve the API only, without the UI")
+	flag.StringVar(&app.Args.Bind, "b", app.Args.Bind, "Listen on this address only")
+	flag.Float64Var(&app.Args.RateLimit, "rl", app.Args.RateLimit, "Requests per second per client IP on execute and mutation routes")
+	flag.IntVar(&app.Args.RateBurst, "rb", app.Args.RateBurst, "Requests a client IP may send at once")
+	flag.Int64Var(&app.Args.MaxBody, "mb", app.Args.MaxBody, "Maximum request body size in bytes")
 	flag.BoolVar(&app.Args.Log, "l", app.Args.Log, "Enable logging")
+	flag.BoolVar(&app.Args.ReadOnly, "r", app.Args.ReadOnly, "Run in read-only mode")
+	flag.DurationVar(&app.Args.IdleTimeout, "i", app.Args.IdleTimeout, "Close idle database connections after this duration")
+	flag.StringVar(&app.Args.NullPlaceholder, "n", app.Args.NullPlaceholder, "Write NULL values as this placeholder in CSV exports")
+	flag.BoolVar(&app.Args.NullInJSON, "nj", app.Args.NullInJSON, "Also write NULL values as the placeholder in JSON exports")
+	flag.IntVar(&app.Args.FloatPrecision, "fp", app.Args.FloatPrecision, "Write floats in CSV exports with this many decimals, 0 writes as many as needed")
+	flag.BoolVar(&app.Args.FloatScientific, "fe", app.Args.FloatScientific, "Write large and small floats in CSV exports in scientific notation")
+	flag.BoolVar(&app.Args.MultiStatements, "ms", app.Args.MultiStatements, "Allow multi-statement scripts on MySQL connections")
+	flag.IntVar(&app.Args.DefaultLimit, "dl", app.Args.DefaultLimit, "Append this LIMIT to the SELECTs run from the editor that have none, 0 disables")
+	flag.BoolVar(&app.Args.ConfirmDestructive, "cd", app.Args.ConfirmDestructive, "Confirm destructive operations on every connection")
+	flag.IntVar(&app.Args.MaxConnections, "mc", app.Args.MaxConnections, "Keep this many saved connections, evicting the oldest")
+	flag.BoolVar(&app.Args.LegacyPagination, "lp", app.Args.LegacyPagination, "Keep total_rows and total_pages in /table data")
+	flag.IntVar(&app.Args.MaxCellChars, "cl", app.Args.MaxCellChars, "Truncate values longer than this many characters in results, 0 disables")
+	flag.BoolVar(&app.Args.FullExports, "xf", app.Args.FullExports, "Write values longer than -cl in full in exports")
+	flag.IntVar(&app.Args.MaxResultBytes, "rs", app.Args.MaxResultBytes, "Refuse results larger than this, 0 disables")
+	flag.StringVar(&app.Args.TraceEndpoint, "ot", app.Args.TraceEndpoint, "Export traces over OTLP/HTTP to this endpoint")
 	flag.StringVar(&app.Args.Connection, "c", app.Args.Connection, "Use saved connection")
+	flag.StringVar(&app.Args.ImportConnections, "ic", app.Args.ImportConnections, "Import the connections of a JSON file")
+	flag.StringVar(&app.Args.ExportConnections, "ec", app.Args.ExportConnections, "Export the saved connections to a JSON file")
+	flag.BoolVar(&app.Args.ExportPasswords, "ep", app.Args.ExportPasswords, "Include passwords in the file written by -ec")
 	showVersion = flag.Bool("v", false, "Display version")
 	showHelp = flag.Bool("h", false, "Show help")
 	flag.Parse()
@@ -47,22 +85,193 @@ func (app *App) ParseFlags() error {
 		fmt.Println(app.Args.Help)
 		os.Exit(0)
 	}
+	if app.Args.ImportConnections != "" {
+		if err = importConnections(app.Args.ImportConnections); err != nil {
+			return err
+		}
+		os.Exit(0)
+	}
+	if app.Args.ExportConnections != "" {
+		if err = config.ExportConnectionsToFile(app.Args.ExportConnections, app.Args.ExportPasswords); err != nil {
+			return err
+		}
+		fmt.Println("exported saved connections to", app.Args.ExportConnections)
+		os.Exit(0)
+	}
 	if err = app.Args.ValidatePortRange(); err != nil {
 		return err
 	}
+	app.Limits = limits(app.Args)
+	app.Handler.SetReadOnly(app.Args.ReadOnly)
+	app.Handler.SetIdleTimeout(app.Args.IdleTimeout)
+	app.Handler.SetMultiStatements(app.Args.MultiStatements)
+	app.Handler.SetDefaultLimit(app.Args.DefaultLimit)
+	app.Handler.SetConfirmDestructive(app.Args.ConfirmDestructive)
+	app.Handler.SetLegacyPagination(app.Args.LegacyPagination)
+	app.Handler.SetVersion(strings.TrimPrefix(app.Args.Version, "version "))
+	config.SetMaxSavedConnections(app.Args.MaxConnections)
+	app.Handler.SetNullFormat(_client.NullFormat{
+		Placeholder: app.Args.NullPlaceholder,
+		InJSON:      app.Args.NullInJSON,
+	})
+	app.Handler.SetFloatFormat(_client.FloatFormat{
+		Precision:  app.Args.FloatPrecision,
+		Scientific: app.Args.FloatScientific,
+	})
+	app.Handler.SetCellLimit(_client.CellLimit{
+		MaxChars:       app.Args.MaxCellChars,
+		FullExports:    app.Args.FullExports,
+		MaxResultBytes: app.Args.MaxResultBytes,
+	})
+	if app.Args.Connection != "" {
+		if err = app.Handler.ConnectSaved(app.Args.Connection); err != nil {
+			return fmt.Errorf("failed to connect to saved connection %s: %w", app.Args.Connection, err)
+		}
+	}
+	return nil
+}
+
+// importConnections saves the connections of a JSON file and prints which were added and skipped.
+func importConnections(fileName string) error {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+	connections, err := config.ParseConnections(data)
+	if err != nil {
+		return err
+	}
+	result, err := config.ImportConnections(connections)
+	if err != nil {
+		return err
+	}
+	for _, key := range result.Added {
+		fmt.Println("added:", key)
+	}
+	for _, skipped := range result.Skipped {
+		fmt.Printf("skipped: %s (%s)\n", skipped.Key, skipped.Reason)
+	}
 	return nil
 }
 
+// SetupRouter registers the API on Router, and the UI on Router as well or on a UIRouter of its own
+// when the API has a port of its own. With -no-ui the UI is not registered at all.
 func (app *App) SetupRouter() {
-	app.Router.HandleFunc("/", _static.ServeStaticFiles)
-	_http.RegisterRoutes(app.Router, *app.Handler)
+	_http.RegisterAPIRoutes(app.Router, app.Handler, app.Limits)
+	switch {
+	case app.Args.NoUI:
+	case app.Args.SplitAPI():
+		app.UIRouter = http.NewServeMux()
+		_http.RegisterUIRoutes(app.UIRouter)
+	default:
+		_http.RegisterUIRoutes(app.Router)
+	}
+}
+
+// servers returns the servers to start: the API, along with the UI on its own port when it has one.
+// An API on a port of its own answers the cross-origin requests of the UI origins only.
+func (app *App) servers() []*http.Server {
+	if !app.Args.SplitAPI() {
+		return []*http.Server{{Addr: app.Args.Addr(), Handler: app.Router}}
+	}
+	cors := _http.CorsConfig{}
+	if !app.Args.NoUI {
+		cors.Origins = app.Args.UIOrigins()
+	}
+	servers := []*http.Server{{Addr: app.Args.APIAddr(), Handler: _http.CorsMiddleware(cors, app.Router)}}
+	if app.UIRouter != nil {
+		servers = append(servers, &http.Server{Addr: app.Args.Addr(), Handler: app.UIRouter})
+	}
+	return servers
+}
+
+// limits returns the request limits to enforce. They are off on a loopback bind,
+// where only local clients can reach the server, unless one of their flags was passed.
+func limits(args *cli.Args) _http.Limits {
+	var set bool
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "rl", "rb", "mb":
+			set = true
+		}
+	})
+	if _http.IsLoopback(args.Bind) && !set {
+		return _http.Limits{}
+	}
+	return _http.Limits{Rate: args.RateLimit, Burst: args.RateBurst, MaxBody: args.MaxBody}
 }
 
+// StartServer serves until the process is interrupted, then waits for in-flight requests
+// and removes pending uploads before returning. When one of the servers fails, the others are
+// shut down before exiting.
 func (app *App) StartServer() {
-	// Uncomment this line to enable CORS middleware if needed
-	// serveMux := _http.CorsMiddleware(app.Router)
-	log.Print("Listening...", app.Args.Port)
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", app.Args.Port), app.Router))
-	// Uncomment this line to use CORS middleware with the HTTP server
-	// log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", app.Args.Port), serveMux))
+	var (
+		err     error
+		servers []*http.Server
+		ctx     context.Context
+		stop    context.CancelFunc
+		failed  chan error
+		flush   func(context.Context) error
+	)
+
+	app.Handler.StartIdleMonitor()
+	app.Handler.StartUploadSweeper()
+	app.Handler.StartUsageFlusher()
+	// exports left half-written by a crash are only removed once they are a day old
+	if _, err = _client.SweepPartialFiles(24 * time.Hour); err != nil {
+		log.Println("failed to remove unfinished exports:", err)
+	}
+	flush, err = tracing.Setup(context.Background(), app.Args.TraceEndpoint)
+	if err != nil {
+		log.Fatal("failed to set up tracing: ", err)
+	}
+	servers = app.servers()
+	ctx, stop = signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	failed = make(chan error, len(servers))
+	for _, server := range servers {
+		go func(server *http.Server) {
+			log.Print("Listening...", server.Addr)
+			failed <- server.ListenAndServe()
+		}(server)
+	}
+
+	var failure error
+	select {
+	case <-ctx.Done():
+	case failure = <-failed:
+	}
+	shutdownServers(servers)
+	if failure != nil && !errors.Is(failure, http.ErrServerClosed) {
+		log.Fatal(failure)
+	}
+	timeout, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err = flush(timeout); err != nil {
+		log.Println("failed to export the last traces:", err)
+	}
+	_client.AbortPartialFiles()
+	if err = app.Handler.FlushUsage(); err != nil {
+		log.Println("failed to save table usage:", err)
+	}
+	if err = app.Handler.CloseUploads(); err != nil {
+		log.Println("failed to remove uploads:", err)
+	}
+}
+
+// shutdownServers shuts the servers down together, giving their in-flight requests 10 seconds in all.
+func shutdownServers(servers []*http.Server) {
+	timeout, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, server := range servers {
+		wg.Add(1)
+		go func(server *http.Server) {
+			defer wg.Done()
+			if err := server.Shutdown(timeout); err != nil {
+				log.Println("failed to shut down:", err)
+			}
+		}(server)
+	}
+	wg.Wait()
 }
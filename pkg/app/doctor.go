@@ -0,0 +1,54 @@
+package app
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/yazeed1s/sqlweb/pkg/cli"
+	"github.com/yazeed1s/sqlweb/pkg/doctor"
+)
+
+// RunDoctor runs `sqlweb doctor` with the arguments that follow it, prints the report and
+// returns the exit code: 1 when a check failed, 2 when the arguments are invalid.
+func RunDoctor(args []string) int {
+	var (
+		defaults = cli.NewArgs()
+		fs       = flag.NewFlagSet("doctor", flag.ContinueOnError)
+		opts     doctor.Options
+		asJSON   bool
+		err      error
+	)
+	fs.IntVar(&defaults.Port, "p", defaults.Port, "Check that this port is available")
+	fs.IntVar(&defaults.APIPort, "api-port", defaults.APIPort, "Check that this API port is available as well")
+	fs.StringVar(&defaults.Bind, "b", defaults.Bind, "Check the port on this address")
+	fs.DurationVar(&opts.Timeout, "t", doctor.DefaultTimeout, "Give up on a saved connection after this duration")
+	fs.BoolVar(&asJSON, "json", false, "Print the report as JSON")
+	if err = fs.Parse(args); err != nil {
+		return 2
+	}
+	if err = defaults.ValidatePortRange(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	opts.Addr = defaults.Addr()
+	if defaults.SplitAPI() {
+		opts.APIAddr = defaults.APIAddr()
+	}
+
+	report := doctor.Run(context.Background(), opts)
+	if asJSON {
+		err = report.WriteJSON(os.Stdout)
+	} else {
+		err = report.Write(os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if report.Failed() {
+		return 1
+	}
+	return 0
+}
@@ -1,41 +1,180 @@
 package cli
 
-import "fmt"
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	_client "github.com/yazeed1s/sqlweb/pkg/client"
+	"github.com/yazeed1s/sqlweb/pkg/config"
+)
 
 // Args represents the command-line arguments for sqlweb.
 type Args struct {
-	Port       int
-	Log        bool
-	Help       string
-	Version    string
-	Connection string
+	Port int
+	// APIPort serves the API on a port of its own, leaving Port to the UI; 0 serves both on Port
+	APIPort int
+	// NoUI leaves the UI out, serving only the API
+	NoUI bool
+	// UIOrigin is the origin allowed to call an API on a port of its own, see UIOrigins
+	UIOrigin        string
+	Bind            string
+	RateLimit       float64
+	RateBurst       int
+	MaxBody         int64
+	Log             bool
+	ReadOnly        bool
+	IdleTimeout     time.Duration
+	NullPlaceholder string
+	NullInJSON      bool
+	// FloatPrecision and FloatScientific set how floats are written in CSV exports, see client.FloatFormat
+	FloatPrecision  int
+	FloatScientific bool
+	MultiStatements bool
+	// DefaultLimit is appended as a LIMIT to the SELECTs run through /execute that have none, 0 appends none
+	DefaultLimit int
+	// ConfirmDestructive requires confirming destructive operations on every connection, not only production ones
+	ConfirmDestructive bool
+	MaxConnections     int
+	LegacyPagination   bool
+	MaxCellChars       int
+	FullExports        bool
+	MaxResultBytes     int
+	Help               string
+	Version            string
+	Connection         string
+	ImportConnections  string
+	ExportConnections  string
+	ExportPasswords    bool
+	// TraceEndpoint is the OTLP/HTTP endpoint traces are exported to, see tracing.Setup
+	TraceEndpoint string
 }
 
 // NewArgs initializes and returns a new Args struct with default values.
 func NewArgs() *Args {
 	return &Args{
-		Port: 3000,
-		Log:  false,
+		Port:               3000,
+		APIPort:            0,
+		NoUI:               false,
+		Bind:               "",
+		RateLimit:          10,
+		RateBurst:          20,
+		MaxBody:            1 << 20,
+		Log:                false,
+		ReadOnly:           false,
+		IdleTimeout:        30 * time.Minute,
+		NullPlaceholder:    "",
+		NullInJSON:         false,
+		FloatPrecision:     0,
+		FloatScientific:    false,
+		MultiStatements:    false,
+		DefaultLimit:       0,
+		ConfirmDestructive: false,
+		MaxConnections:     config.DefaultMaxSavedConnections,
+		LegacyPagination:   true,
+		MaxCellChars:       0,
+		FullExports:        true,
+		MaxResultBytes:     _client.DefaultMaxResultBytes,
+		ImportConnections:  "",
+		ExportConnections:  "",
+		ExportPasswords:    false,
 		Help: `
 			Help information:
 			USAGE: sqlweb [OPTION]
+			       sqlweb doctor [-p <port>] [-api-port <port>] [-b <host>] [-t <duration>] [-json]
 			OPTION:
 			  -p <port>   	Set the port number (default: 3000)
+			  -b <host>   	Listen on this address only, e.g. 127.0.0.1 (default: all interfaces)
+			  -api-port <port>	Serve the API on this port and the UI alone on -p, allowing the UI origin
+			              	to call the API (default: 0, both on -p)
+			  -ui-origin <url>	Allow only this origin to call the API on -api-port, e.g. https://sqlweb.example.com
+			              	(default: the UI port on localhost, 127.0.0.1, [::1] and the -b address)
+			  -no-ui=<bool>	Serve the API only, without the UI (default: false)
+			  -rl <float> 	Requests per second per client IP on execute and mutation routes, 0 disables (default: 10)
+			  -rb <int>   	Requests a client IP may send at once before -rl applies (default: 20)
+			  -mb <bytes> 	Maximum request body size, 0 disables (default: 1048576)
+			              	Limits are off when bound to a loopback address unless -rl, -rb or -mb is passed
 			  -l=<bool>   	Enable logging (default: false)
+			  -r=<bool>   	Run in read-only mode, rejecting schema changes (default: false)
+			  -i <duration>	Close idle database connections after this duration, 0 disables (default: 30m)
+			  -n <string> 	Write NULL values as this placeholder in CSV exports, e.g. NULL or \N (default: empty)
+			  -nj=<bool>  	Also write NULL values as the placeholder in JSON exports (default: false)
+			  -fp <int>   	Write floats in CSV exports with this many decimals, 0 writes as many as needed (default: 0)
+			  -fe=<bool>  	Write large and small floats in CSV exports in scientific notation (default: false)
+			  -ms=<bool>  	Allow multi-statement scripts on MySQL connections (default: false)
+			  -dl <rows>  	Append LIMIT <rows> to the SELECTs run from the editor that have no LIMIT, 0 disables (default: 0)
+			  -cd=<bool>  	Confirm destructive operations on every connection, not only production ones (default: false)
+			  -mc <int>   	Keep this many saved connections, evicting the oldest, 0 keeps them all (default: 50)
+			  -lp=<bool>  	Keep total_rows and total_pages in /table data, deprecated by pagination (default: true)
+			  -cl <chars> 	Truncate values longer than this in results to a preview of up to 4096 characters, 0 disables (default: 0)
+			  -xf=<bool>  	Write values longer than -cl in full in exports (default: true)
+			  -rs <bytes> 	Refuse query and table results larger than this when encoded, 0 disables (default: 67108864)
+			  -ot <url>   	Export traces over OTLP/HTTP to this endpoint, e.g. http://localhost:4318
+			              	(default: OTEL_EXPORTER_OTLP_ENDPOINT, tracing is off when neither is set)
 			  -h          	Display help information
 			  -v          	Display version
 			  -c=<schema> 	Use saved connection 
+			  -ic <file>  	Import the connections of a JSON file into the saved connections, then exit
+			  -ec <file>  	Export the saved connections to a JSON file without their passwords, then exit
+			  -ep=<bool>  	Include the passwords in the file written by -ec (default: false)
+			DOCTOR:
+			  Checks the config directory, the saved connections, SQLite files and the port,
+			  prints a pass/warn/fail report and exits with 1 if any check failed.
+			  -t <duration>	Give up on a saved connection after this duration (default: 5s)
+			  -json       	Print the report as JSON
 			`,
 		Version:    "version 0.1.0",
 		Connection: "",
 	}
 }
 
+// Addr returns the address the server listens on.
+func (args *Args) Addr() string {
+	return net.JoinHostPort(args.Bind, strconv.Itoa(args.Port))
+}
+
+// APIAddr returns the address the API listens on, the same as Addr unless it has a port of its own.
+func (args *Args) APIAddr() string {
+	if !args.SplitAPI() {
+		return args.Addr()
+	}
+	return net.JoinHostPort(args.Bind, strconv.Itoa(args.APIPort))
+}
+
+// UIOrigins returns the origins the UI may call an API on a port of its own from: UIOrigin when it is set,
+// otherwise the UI port under the loopback names and the bind address. A UI reached under another name,
+// e.g. the LAN address of a server listening on every interface, needs UIOrigin.
+func (args *Args) UIOrigins() []string {
+	if args.UIOrigin != "" {
+		return []string{strings.TrimSuffix(args.UIOrigin, "/")}
+	}
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if ip := net.ParseIP(args.Bind); args.Bind != "" && (ip == nil || !ip.IsUnspecified()) && !slices.Contains(hosts, args.Bind) {
+		hosts = append(hosts, args.Bind)
+	}
+	origins := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		origins = append(origins, "http://"+net.JoinHostPort(host, strconv.Itoa(args.Port)))
+	}
+	return origins
+}
+
+// SplitAPI reports whether the API is served on a port other than the UI's.
+func (args *Args) SplitAPI() bool {
+	return args.APIPort != 0 && args.APIPort != args.Port
+}
+
 // ValidatePortRange checks if the Port field falls within a valid port number range.
 // It returns an error if the port number is invalid.
 func (args *Args) ValidatePortRange() error {
 	if args.Port < 1 || args.Port > 65535 {
 		return fmt.Errorf("invalid port number")
 	}
+	if args.APIPort < 0 || args.APIPort > 65535 {
+		return fmt.Errorf("invalid API port number")
+	}
 	return nil
 }
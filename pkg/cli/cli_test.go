@@ -45,3 +45,35 @@ func TestArgs_NewArgs_SetCustomValues(t *testing.T) {
 	assert.Contains(t, args.Help, "USAGE: sqlweb", "Expected default help message to contain usage information")
 	assert.Equal(t, "1.2.3", args.Version, "Expected custom version to be set")
 }
+
+func TestArgs_APIAddr(t *testing.T) {
+	args := NewArgs()
+	assert.False(t, args.SplitAPI())
+	assert.Equal(t, ":3000", args.APIAddr())
+
+	args.APIPort = 3000
+	assert.False(t, args.SplitAPI(), "Expected the API on the UI port to be served by the same server")
+
+	args.APIPort = 8080
+	args.Bind = "10.0.0.1"
+	assert.True(t, args.SplitAPI())
+	assert.Equal(t, "10.0.0.1:8080", args.APIAddr())
+	assert.Equal(t, "10.0.0.1:3000", args.Addr())
+
+	args.APIPort = 70000
+	assert.EqualError(t, args.ValidatePortRange(), "invalid API port number")
+}
+
+func TestArgs_UIOrigins(t *testing.T) {
+	args := NewArgs()
+	assert.Equal(t, []string{"http://localhost:3000", "http://127.0.0.1:3000", "http://[::1]:3000"}, args.UIOrigins())
+
+	args.Bind = "0.0.0.0"
+	assert.Len(t, args.UIOrigins(), 3, "Expected no origin for an unspecified bind address")
+
+	args.Bind = "10.0.0.1"
+	assert.Contains(t, args.UIOrigins(), "http://10.0.0.1:3000")
+
+	args.UIOrigin = "https://sqlweb.example.com/"
+	assert.Equal(t, []string{"https://sqlweb.example.com"}, args.UIOrigins())
+}
@@ -0,0 +1,70 @@
+package client
+
+import (
+	"errors"
+	"strings"
+
+	_sql "github.com/yazeed1s/sqlweb/db/sql"
+)
+
+// AttachedDatabases returns the aliases of the databases attached to a SQLite connection,
+// nil for the other databases.
+func (c *Client) AttachedDatabases() ([]string, error) {
+	if !c.isSQLite() {
+		return nil, nil
+	}
+	if c.Database == nil {
+		return nil, errors.New("database connection is nil")
+	}
+	return getSchemaNamesHelper(_sql.SQLiteAttachedDatabases, c.Database)
+}
+
+// AttachedTables returns the tables of the databases attached to a SQLite connection, named alias.table.
+func (c *Client) AttachedTables() ([]string, error) {
+	if !c.isSQLite() {
+		return nil, nil
+	}
+	if c.Database == nil {
+		return nil, errors.New("database connection is nil")
+	}
+
+	rows, err := c.Database.Query(_sql.SQLiteAttachedTables)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var schema, name string
+		if err = rows.Scan(&schema, &name); err != nil {
+			return nil, err
+		}
+		tables = append(tables, schema+"."+name)
+	}
+	return tables, rows.Err()
+}
+
+// sourceOf returns the schema and the name of the table the client reads. For SQLite, alias.table is a
+// table of the database attached as alias, and any other name one of main; the other databases read
+// the table from the schema browsed.
+func (c *Client) sourceOf(tableName string) (string, string, error) {
+	if !c.isSQLite() {
+		return c.Schema.Name, tableName, nil
+	}
+	alias, table, ok := strings.Cut(tableName, ".")
+	if !ok {
+		return "main", tableName, nil
+	}
+	aliases, err := c.AttachedDatabases()
+	if err != nil {
+		return "", "", err
+	}
+	for _, attached := range aliases {
+		if strings.EqualFold(attached, alias) {
+			return attached, table, nil
+		}
+	}
+	// a table of main may have a dot in its name
+	return "main", tableName, nil
+}
@@ -0,0 +1,114 @@
+package client
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	_sql "github.com/yazeed1s/sqlweb/db/sql"
+)
+
+// Bloat severities, from a table that needs nothing to one that should be optimized or vacuumed.
+const (
+	BloatNone   = "none"
+	BloatLow    = "low"
+	BloatMedium = "medium"
+	BloatHigh   = "high"
+)
+
+// minBloatBytes is the reclaimable space below which a table is never reported as bloated,
+// since optimizing a small table gains nothing even when most of it is free space.
+const minBloatBytes = 1 << 20
+
+// TableBloat reports how much of a table's storage is reclaimable.
+// For SQLite the numbers cover the whole database file, since free pages are not tracked per table.
+type TableBloat struct {
+	Table string `json:"table_name"`
+	// Scope is "table", or "database" when the numbers cover the whole database file
+	Scope string `json:"scope"`
+	// UsedBytes is the storage holding live data (and indexes, for MySQL)
+	UsedBytes int64 `json:"used_bytes"`
+	// FreeBytes is the reclaimable storage: MySQL's data_free, PostgreSQL's estimated bloat,
+	// or the size of SQLite's free pages
+	FreeBytes int64 `json:"free_bytes"`
+	// Ratio is FreeBytes relative to the total storage, between 0 and 1
+	Ratio      float64 `json:"fragmentation_ratio"`
+	LiveTuples *int64  `json:"live_tuples,omitempty"`
+	DeadTuples *int64  `json:"dead_tuples,omitempty"`
+	Severity   string  `json:"severity"`
+}
+
+// classify fills in the ratio and the severity from the used and free bytes.
+func (b *TableBloat) classify() {
+	total := b.UsedBytes + b.FreeBytes
+	if total > 0 {
+		b.Ratio = float64(b.FreeBytes) / float64(total)
+	}
+
+	switch {
+	case b.FreeBytes < minBloatBytes || b.Ratio < 0.1:
+		b.Severity = BloatNone
+	case b.Ratio < 0.25:
+		b.Severity = BloatLow
+	case b.Ratio < 0.5:
+		b.Severity = BloatMedium
+	default:
+		b.Severity = BloatHigh
+	}
+}
+
+// GetTableBloat reports the reclaimable storage of the table, with a severity telling
+// whether an OPTIMIZE TABLE or VACUUM is worth running.
+func (c *Client) GetTableBloat(table string) (*TableBloat, error) {
+	if c.Database == nil {
+		return nil, errors.New("database connection is nil")
+	}
+
+	var (
+		err   error
+		query string
+		bloat *TableBloat
+	)
+
+	bloat = &TableBloat{Table: table, Scope: "table"}
+	switch strings.ToLower(c.Type.String()) {
+	case strings.ToLower(_sql.MySQL.String()):
+		query = fmt.Sprintf(_sql.MySQLTableBloat, c.Schema.Name, table)
+		err = c.Database.QueryRow(query).Scan(&bloat.Table, &bloat.UsedBytes, &bloat.FreeBytes)
+	case strings.ToLower(_sql.PostgreSQL.String()):
+		var live, dead, size int64
+		query = fmt.Sprintf(_sql.PostgreSQLTableBloat, c.Schema.Name, table)
+		err = c.Database.QueryRow(query).Scan(&bloat.Table, &size, &live, &dead, &bloat.FreeBytes)
+		bloat.UsedBytes = size - bloat.FreeBytes
+		bloat.LiveTuples, bloat.DeadTuples = &live, &dead
+	case strings.ToLower(_sql.SQLite.String()):
+		var (
+			freePages, pages, pageSize int64
+			cols                       []Column
+		)
+		// the pragmas are database wide, so check the table exists first
+		cols, err = c.GetColumns(table)
+		if err != nil {
+			return nil, err
+		}
+		if len(cols) == 0 {
+			return nil, fmt.Errorf("table '%s' not found", table)
+		}
+		err = c.Database.QueryRow(_sql.SQLiteTableBloat).Scan(&freePages, &pages, &pageSize)
+		bloat.Scope = "database"
+		bloat.UsedBytes = (pages - freePages) * pageSize
+		bloat.FreeBytes = freePages * pageSize
+	default:
+		return nil, fmt.Errorf("unsupported database type: %s", c.Type.String())
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("table '%s' not found", table)
+		}
+		return nil, fmt.Errorf("error executing query: %w", err)
+	}
+
+	bloat.classify()
+	return bloat, nil
+}
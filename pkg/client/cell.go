@@ -0,0 +1,219 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/yazeed1s/sqlweb/pkg/util"
+)
+
+const (
+	// cellPreviewChars is how many characters of a truncated value are kept as its preview, at most
+	cellPreviewChars = 4 << 10
+	// ellipsis ends the preview of a truncated value
+	ellipsis = "…"
+	// DefaultMaxResultBytes is the size of the largest result sent for display unless SetCellLimit changes it
+	DefaultMaxResultBytes = 64 << 20
+)
+
+// CellLimit sets how long a value may be before it is replaced with a TruncatedCell, and how large
+// a whole result may be. Encoding a single huge text or blob can stall a response even when it holds
+// few rows, and a SELECT * of a wide table can hold more than a browser renders.
+type CellLimit struct {
+	// MaxChars is the number of characters of the longest value kept whole, 0 keeps every value whole
+	MaxChars int
+	// FullExports writes values of any size in exports, which go to files rather than the browser
+	FullExports bool
+	// MaxResultBytes is the estimated JSON size of the largest result read for display, 0 leaves results unbounded.
+	// Exports are never bounded.
+	MaxResultBytes int
+}
+
+// TruncatedCell replaces a value longer than CellLimit.MaxChars. Bytes is the size of the whole value, which
+// can be downloaded from /cell/download, and Preview its first characters followed by an ellipsis.
+type TruncatedCell struct {
+	Truncated bool   `json:"truncated"`
+	Bytes     int    `json:"bytes"`
+	Preview   string `json:"preview"`
+}
+
+// String renders the truncated cell in CSV exports.
+func (t *TruncatedCell) String() string {
+	return fmt.Sprintf("%s (truncated, %d bytes)", t.Preview, t.Bytes)
+}
+
+// UnreadableCell replaces a value that cannot be encoded, like an infinite float, a time past the year 9999
+// or a type of the driver that JSON does not handle, so that one such value does not fail the whole result.
+type UnreadableCell struct {
+	Unreadable bool   `json:"unreadable"`
+	Type       string `json:"type"`
+	Error      string `json:"error"`
+}
+
+// String renders the unreadable cell in CSV exports.
+func (u *UnreadableCell) String() string {
+	return fmt.Sprintf("(unreadable %s: %s)", u.Type, u.Error)
+}
+
+// readable returns the value, or an *UnreadableCell when it cannot be encoded, which is logged with the column.
+func readable(column string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, int64, bool, string, []byte, *TruncatedCell:
+		return value
+	case float64:
+		if !math.IsInf(v, 0) && !math.IsNaN(v) {
+			return value
+		}
+	case time.Time:
+		if year := v.Year(); year >= 0 && year <= 9999 {
+			return value
+		}
+	}
+	_, err := json.Marshal(value)
+	if err == nil {
+		return value
+	}
+	log.Printf("cannot read column %s, a %T: %v", column, value, err)
+	return &UnreadableCell{Unreadable: true, Type: fmt.Sprintf("%T", value), Error: err.Error()}
+}
+
+// CellWarning reports a value that was truncated: its row, from 0, and column, and its size.
+type CellWarning struct {
+	Row    int    `json:"row"`
+	Column string `json:"column"`
+	Bytes  int    `json:"bytes"`
+}
+
+// export returns the limit that applies to exports.
+func (l CellLimit) export() CellLimit {
+	if l.FullExports {
+		return CellLimit{}
+	}
+	return CellLimit{MaxChars: l.MaxChars}
+}
+
+// Value converts a scanned value for display: bytes become a string, and a text or bytes value
+// longer than MaxChars becomes a *TruncatedCell, in which case truncated is set.
+func (l CellLimit) Value(v interface{}) (value interface{}, truncated bool) {
+	var (
+		text string
+		size int
+		n    = cellPreviewChars
+	)
+	if l.MaxChars < n {
+		n = l.MaxChars
+	}
+
+	switch val := v.(type) {
+	case []byte:
+		if l.fitsBytes(val) {
+			return string(val), false
+		}
+		// only the start of the value makes the preview
+		text, size = string(val[:prefixLen(len(val), n)]), len(val)
+	case string:
+		if l.fits(val) {
+			return val, false
+		}
+		text, size = val, len(val)
+	default:
+		return v, false
+	}
+
+	end := 0
+	for i := 0; i < n && end < len(text); i++ {
+		_, width := utf8.DecodeRuneInString(text[end:])
+		end += width
+	}
+	return &TruncatedCell{Truncated: true, Bytes: size, Preview: text[:end] + ellipsis}, true
+}
+
+// fits tells whether a text value is kept whole. A value has no more characters than bytes,
+// so most are not counted.
+func (l CellLimit) fits(s string) bool {
+	return l.MaxChars <= 0 || len(s) <= l.MaxChars || utf8.RuneCountInString(s) <= l.MaxChars
+}
+
+// fitsBytes is fits for a bytes value.
+func (l CellLimit) fitsBytes(b []byte) bool {
+	return l.MaxChars <= 0 || len(b) <= l.MaxChars || utf8.RuneCount(b) <= l.MaxChars
+}
+
+// prefixLen returns how many bytes of a value of size bytes hold its first n characters, at most.
+func prefixLen(size, n int) int {
+	if size > n*utf8.UTFMax {
+		return n * utf8.UTFMax
+	}
+	return size
+}
+
+// ResultBudget tracks the estimated size of the JSON a result is encoded to as its rows are read,
+// so that reading stops as soon as the result is too large rather than once it is in memory.
+// A nil budget is unbounded.
+type ResultBudget struct {
+	max  int
+	used int
+}
+
+// Budget starts the budget of a result, nil when MaxResultBytes is 0.
+func (l CellLimit) Budget() *ResultBudget {
+	if l.MaxResultBytes <= 0 {
+		return nil
+	}
+	return &ResultBudget{max: l.MaxResultBytes}
+}
+
+// Charge adds a value of the result, under its key in a row map or with an empty key in a row slice.
+// It fails with util.ErrResultTooLarge once the result is over the limit.
+func (b *ResultBudget) Charge(key string, value interface{}) error {
+	if b == nil {
+		return nil
+	}
+	return b.charge(key, encodedSize(value))
+}
+
+// charge adds a value whose encoded size is already known.
+func (b *ResultBudget) charge(key string, size int) error {
+	if b == nil {
+		return nil
+	}
+	if key != "" {
+		b.used += len(key) + 3
+	}
+	b.used += size + 1
+	if b.used > b.max {
+		return fmt.Errorf("%w: it is over %d bytes, add a LIMIT to the query", util.ErrResultTooLarge, b.max)
+	}
+	return nil
+}
+
+// encodedSize estimates the size of the JSON encoding of a value read from a row, as converted by CellLimit.Value.
+// Escapes are not counted.
+func encodedSize(value interface{}) int {
+	switch v := value.(type) {
+	case nil:
+		return len("null")
+	case string:
+		return len(v) + 2
+	case bool:
+		return len("false")
+	case int64:
+		var buf [24]byte
+		return len(strconv.AppendInt(buf[:0], v, 10))
+	case float64:
+		var buf [32]byte
+		return len(strconv.AppendFloat(buf[:0], v, 'g', -1, 64))
+	case time.Time:
+		return len(time.RFC3339Nano) + 2
+	case *TruncatedCell:
+		return len(v.Preview) + len(`{"truncated":true,"bytes":,"preview":""}`) + len(strconv.Itoa(v.Bytes))
+	default:
+		encoded, _ := json.Marshal(v)
+		return len(encoded)
+	}
+}
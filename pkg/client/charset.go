@@ -0,0 +1,157 @@
+package client
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	_sql "github.com/yazeed1s/sqlweb/db/sql"
+	"github.com/yazeed1s/sqlweb/pkg/util"
+)
+
+// Charset is a character set, an encoding on PostgreSQL, that databases and tables can be created with.
+type Charset struct {
+	Name             string `json:"name"`
+	DefaultCollation string `json:"defaultCollation,omitempty"`
+	Description      string `json:"description,omitempty"`
+}
+
+// Collation is a collation, and the charset it applies to when it is tied to one.
+// Locale is the locale a PostgreSQL collation uses, the value CREATE DATABASE takes as LC_COLLATE.
+type Collation struct {
+	Name      string `json:"name"`
+	Charset   string `json:"charset,omitempty"`
+	Locale    string `json:"locale,omitempty"`
+	IsDefault bool   `json:"isDefault"`
+}
+
+// Charsets lists the charsets and collations the server offers.
+type Charsets struct {
+	Charsets   []Charset   `json:"charsets"`
+	Collations []Collation `json:"collations"`
+}
+
+// GetCharsets lists the charsets and collations of the server. PostgreSQL lists every encoding it knows,
+// some of which are client-side only and cannot be used for a database. SQLite has no charsets: text is
+// UTF-8 or UTF-16, set once per file, and only its collations are listed.
+func (c *Client) GetCharsets() (*Charsets, error) {
+	if c.Database == nil {
+		return nil, errors.New("database connection is nil")
+	}
+
+	var (
+		err            error
+		charsets       = &Charsets{Charsets: make([]Charset, 0)}
+		charsetQuery   string
+		collationQuery string
+	)
+
+	switch strings.ToLower(c.Type.String()) {
+	case strings.ToLower(_sql.MySQL.String()):
+		charsetQuery, collationQuery = _sql.MySQLCharsets, _sql.MySQLCollations
+	case strings.ToLower(_sql.PostgreSQL.String()):
+		charsetQuery, collationQuery = _sql.PostgreSQLCharsets, _sql.PostgreSQLCollations
+	case strings.ToLower(_sql.SQLite.String()):
+		collationQuery = _sql.SQLiteCollations
+	default:
+		return nil, fmt.Errorf("unsupported database type: %s", c.Type.String())
+	}
+
+	if charsetQuery != "" {
+		charsets.Charsets, err = getCharsetsHelper(charsetQuery, c.Database)
+		if err != nil {
+			return nil, err
+		}
+	}
+	charsets.Collations, err = getCollationsHelper(collationQuery, c.Database)
+	if err != nil {
+		return nil, err
+	}
+	return charsets, nil
+}
+
+func getCharsetsHelper(query string, db *sql.DB) ([]Charset, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("error executing query: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	charsets := make([]Charset, 0)
+	for rows.Next() {
+		var charset Charset
+		if err = rows.Scan(&charset.Name, &charset.DefaultCollation, &charset.Description); err != nil {
+			return nil, err
+		}
+		charsets = append(charsets, charset)
+	}
+	return charsets, rows.Err()
+}
+
+func getCollationsHelper(query string, db *sql.DB) ([]Collation, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("error executing query: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	collations := make([]Collation, 0)
+	for rows.Next() {
+		var (
+			collation Collation
+			charset   sql.NullString
+		)
+		if err = rows.Scan(&collation.Name, &charset, &collation.Locale, &collation.IsDefault); err != nil {
+			return nil, err
+		}
+		collation.Charset = charset.String
+		collations = append(collations, collation)
+	}
+	return collations, rows.Err()
+}
+
+// UnknownCollationError is returned when a collation is not one the server offers. It lists those it does.
+type UnknownCollationError struct {
+	Collation string
+	Available []string
+}
+
+func (e *UnknownCollationError) Error() string {
+	return fmt.Sprintf("%s: %q", util.ErrUnknownCollation, e.Collation)
+}
+
+func (e *UnknownCollationError) Unwrap() error {
+	return util.ErrUnknownCollation
+}
+
+// checkCollation returns the name of the collation as the server lists it, from information_schema.COLLATIONS
+// on MySQL, pg_collation on PostgreSQL and pragma_collation_list on SQLite, failing with an UnknownCollationError
+// when it lists none by that name. Only PostgreSQL tells apart names differing in case.
+func (c *Client) checkCollation(collation string) (string, error) {
+	charsets, err := c.GetCharsets()
+	if err != nil {
+		return "", err
+	}
+	var (
+		isPostgres = strings.EqualFold(c.Type.String(), _sql.PostgreSQL.String())
+		available  = make([]string, len(charsets.Collations))
+	)
+	for i, known := range charsets.Collations {
+		if known.Name == collation || (!isPostgres && strings.EqualFold(known.Name, collation)) {
+			return known.Name, nil
+		}
+		available[i] = known.Name
+	}
+	return "", &UnknownCollationError{Collation: collation, Available: available}
+}
@@ -17,18 +17,25 @@ package client
 
 import (
 	"bufio"
+	"context"
 	"database/sql"
 	"encoding/csv"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
-	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/yazeed1s/sqlweb/db/connection"
 	_sql "github.com/yazeed1s/sqlweb/db/sql"
+	"github.com/yazeed1s/sqlweb/pkg/tracing"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Client represent the active client connected to the db
@@ -39,8 +46,62 @@ type Client struct {
 	Password string      `json:"password"`
 	Name     string      `json:"database"`
 	Type     _sql.DbType `json:"databaseType"`
+	Path     string      `json:"path"`
 	Schema   Schema      `json:"schema"`
 	Database *sql.DB
+	// Nulls is how NULL values are rendered in exports
+	Nulls NullFormat `json:"-"`
+	// Floats is how floats are rendered in CSV exports
+	Floats FloatFormat `json:"-"`
+	// Credentials mint the password of connections opened apart from Database, e.g. for scripts
+	Credentials *connection.Credentials `json:"-"`
+	// ApplicationName tags the sessions of connections opened apart from Database, like those of Database
+	ApplicationName string `json:"-"`
+	// Cells sets how large a value may be before it is truncated for display
+	Cells CellLimit `json:"-"`
+	// DefaultLimit is appended as a LIMIT to the SELECTs of ExecuteQuery that have none, 0 appends none
+	DefaultLimit int `json:"-"`
+	// Settings are the defaults of the connection: page size, statement timeout and export size
+	Settings connection.Settings `json:"-"`
+
+	// columnCache holds column metadata fetched on demand, keyed by "schema.table"
+	cacheMu     sync.Mutex
+	columnCache map[string][]Column
+}
+
+// Key identifies the connection the client was created from, e.g. "mysql://root@localhost:3306/shop".
+// It is used to store per-connection preferences.
+func (c *Client) Key() string {
+	if strings.EqualFold(c.Type.String(), _sql.SQLite.String()) {
+		return "sqlite://" + c.Path
+	}
+	return fmt.Sprintf("%s://%s@%s:%d/%s", strings.ToLower(c.Type.String()), c.User, c.Host, c.Port, c.Name)
+}
+
+// selectAllQuery builds the query exports read the table with: every row, up to the MaxExportRows setting, and
+// the given columns, or all of them when there are none. SQLite connections opened through the handler have no
+// schema name, so their tables are qualified with "main".
+func (c *Client) selectAllQuery(tableName string, columns []string) string {
+	schema := c.Schema.Name
+	if schema == "" && strings.EqualFold(c.Type.String(), _sql.SQLite.String()) {
+		schema = "main"
+	}
+	if len(columns) == 0 {
+		return c.limitExport(fmt.Sprintf(_sql.SQLSelectAll, schema, tableName))
+	}
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = QuoteIdentifier(c.Type.String(), column)
+	}
+	return c.limitExport(fmt.Sprintf("SELECT %s FROM %s", strings.Join(quoted, ", "), QualifiedTable(c.Type.String(), schema, tableName)))
+}
+
+// limitExport caps the rows an export query reads at the MaxExportRows setting of the connection.
+func (c *Client) limitExport(query string) string {
+	if c.Settings.MaxExportRows <= 0 {
+		return query
+	}
+	return fmt.Sprintf("%s LIMIT %d", query, c.Settings.MaxExportRows)
 }
 
 // Schema represent the db schema connected to
@@ -63,23 +124,71 @@ type Table struct {
 	N_columns int      `json:"n_columns"`
 	N_rows    int      `json:"n_rows"`
 	Size      float64  `json:"size_mb"`
+	Comment   string   `json:"comment"`
+	// Fingerprint identifies the column layout the rows were read with, see Fingerprint
+	Fingerprint string `json:"fingerprint"`
+	// Rows holds the rows instead of Data when the table was read in compact form
+	Rows *RowSet `json:"rows,omitempty"`
+	// Warnings lists the values truncated by the cell limit, see CellLimit
+	Warnings []CellWarning `json:"warnings,omitempty"`
+	// Search tells how the rows were searched for when the table was read with SearchTable
+	Search *Search `json:"search,omitempty"`
+	// Order is the order the rows were sorted in when none was asked for, see TableOrder
+	Order *TableOrder `json:"order,omitempty"`
+	// Renamed lists the columns of Data renamed because an earlier column has the same name, see DistinctColumns
+	Renamed []ColumnRename `json:"renamed_columns,omitempty"`
+
+	// rows holds the rows instead of Data when the table was read with TableQuery.Columnar
+	rows *Rows
+}
+
+// MarshalJSON encodes the table, its data straight from the columns of its rows when it was read with
+// TableQuery.Columnar. The JSON is the same either way.
+func (t Table) MarshalJSON() ([]byte, error) {
+	type table Table
+	if t.Data != nil {
+		t.rows = nil
+	}
+	return MarshalWithRows(table(t), "data", t.rows)
 }
 
 // Column represents a column within a table, including its field name, data type, key type (e.g., PRI KEY),
 // constraint name, and references to other tables and columns.
 type Column struct {
-	Field            string `json:"field"`
-	Type             string `json:"type"`
-	Key              string `json:"key"`
-	ConstraintName   string `json:"constraint_name"`
-	ReferencedTable  string `json:"refrenced_table"`
-	ReferencedColumn string `json:"refrenced_column"`
+	Field            string  `json:"field"`
+	Type             string  `json:"type"`
+	Key              string  `json:"key"`
+	ConstraintName   string  `json:"constraint_name"`
+	ReferencedTable  string  `json:"refrenced_table"`
+	ReferencedColumn string  `json:"refrenced_column"`
+	Comment          string  `json:"comment"`
+	Default          *string `json:"default"`
+	IsGenerated      bool    `json:"is_generated"`
+	Nullable         bool    `json:"nullable"`
+	// Protected is set on columns the connection protects from edits, see connection.Settings
+	Protected bool `json:"protected"`
 }
 
 // ColumnData represents column-related data for a specific table
 type ColumnData struct {
-	TableName string   `json:"table_name"`
-	Columns   []Column `json:"columns"`
+	TableName    string     `json:"table_name"`
+	Comment      string     `json:"comment"`
+	Columns      []Column   `json:"columns"`
+	Favorite     bool       `json:"favorite"`
+	LastOpenedAt *time.Time `json:"lastOpenedAt,omitempty"`
+	// ReferencedBy lists the foreign keys of other tables referencing this one
+	ReferencedBy []ReferencingTable `json:"referencedBy"`
+	// LastModified tells when the table last changed, see GetTablesLastModified
+	LastModified *LastModified `json:"lastModified,omitempty"`
+	// IsView tells views apart from base tables, only base tables can be truncated or edited
+	IsView bool `json:"is_view"`
+}
+
+// SchemaInfo names a schema. For SQLite, schemas are the attached databases and File is the database file,
+// empty for in-memory and temporary ones.
+type SchemaInfo struct {
+	Name string `json:"name"`
+	File string `json:"file,omitempty"`
 }
 
 // SchemaSize holds information about the size of a schema
@@ -92,6 +201,8 @@ type SchemaSize struct {
 type TableSize struct {
 	Table  string  `json:"table_name"`
 	SizeMB float64 `json:"size_mb"`
+	// LastModified tells when the table last changed, see GetTablesLastModified
+	LastModified *LastModified `json:"lastModified,omitempty"`
 }
 
 /*
@@ -163,9 +274,75 @@ func (c *Client) GetSchemaNames() ([]string, error) {
 			return nil, err
 		}
 		return names, nil
+
+	case strings.ToLower(_sql.SQLite.String()):
+		schemas, err := getSQLiteSchemasHelper(_sql.SQLiteShowDatabases, c.Database)
+		if err != nil {
+			return nil, err
+		}
+		for _, schema := range schemas {
+			names = append(names, schema.Name)
+		}
+		return names, nil
 	}
 
-	return nil, nil
+	return nil, fmt.Errorf("unsupported database type: %s", c.Type.String())
+}
+
+// GetSchemas lists the schemas like GetSchemaNames, along with the database file of each for SQLite.
+func (c *Client) GetSchemas() ([]SchemaInfo, error) {
+	if c.Database == nil {
+		return nil, errors.New("database connection is nil")
+	}
+
+	var (
+		names   []string
+		schemas []SchemaInfo
+		err     error
+	)
+
+	if strings.EqualFold(c.Type.String(), _sql.SQLite.String()) {
+		return getSQLiteSchemasHelper(_sql.SQLiteShowDatabases, c.Database)
+	}
+
+	names, err = c.GetSchemaNames()
+	if err != nil {
+		return nil, err
+	}
+	schemas = make([]SchemaInfo, 0, len(names))
+	for _, name := range names {
+		schemas = append(schemas, SchemaInfo{Name: name})
+	}
+	return schemas, nil
+}
+
+func getSQLiteSchemasHelper(query string, db *sql.DB) ([]SchemaInfo, error) {
+	var (
+		err     error
+		res     *sql.Rows
+		schemas []SchemaInfo
+	)
+
+	res, err = db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(res *sql.Rows) {
+		err = res.Close()
+		if err != nil {
+			return
+		}
+	}(res)
+
+	for res.Next() {
+		var schema SchemaInfo
+		if err := res.Scan(&schema.Name, &schema.File); err != nil {
+			return nil, err
+		}
+		schemas = append(schemas, schema)
+	}
+	return schemas, res.Err()
 }
 
 func getSchemaSizeHelper(query string, db *sql.DB) (SchemaSize, error) {
@@ -249,12 +426,12 @@ func (c *Client) CountTableColumns(tableName string) (int, error) {
 	return count, nil
 }
 
-func countTableRowsHelper(query string, db *sql.DB) (int, error) {
+func countTableRowsHelper(ctx context.Context, query string, db *sql.DB) (int, error) {
 	var (
 		err      error
 		rowCount int
 	)
-	err = db.QueryRow(query).Scan(&rowCount)
+	err = db.QueryRowContext(ctx, query).Scan(&rowCount)
 	if err != nil {
 		return 0, err
 	}
@@ -262,6 +439,11 @@ func countTableRowsHelper(query string, db *sql.DB) (int, error) {
 }
 
 func (c *Client) CountTableRows(tableName string) (int, error) {
+	return c.CountTableRowsContext(context.Background(), tableName)
+}
+
+// CountTableRowsContext is like CountTableRows, traced as a child of the span of ctx and cancelled with it.
+func (c *Client) CountTableRowsContext(ctx context.Context, tableName string) (int, error) {
 	if c.Database == nil {
 		return 0, errors.New("database connection is nil")
 	}
@@ -270,12 +452,18 @@ func (c *Client) CountTableRows(tableName string) (int, error) {
 		query    string
 		rowCount int
 		err      error
+		span     trace.Span
 	)
 
+	ctx, span = tracing.StartQuery(ctx, "CountTableRows", strings.ToLower(c.Type.String()), "SELECT", tableName)
+	defer func() {
+		tracing.EndQuery(span, int64(rowCount), err)
+	}()
+
 	switch strings.ToLower(c.Type.String()) {
 	case strings.ToLower(_sql.MySQL.String()):
 		query = fmt.Sprintf(_sql.MySQLCountTableRows, c.Schema.Name, tableName)
-		rowCount, err = countTableRowsHelper(query, c.Database)
+		rowCount, err = countTableRowsHelper(ctx, query, c.Database)
 		if err != nil {
 			return 0, err
 		}
@@ -283,14 +471,18 @@ func (c *Client) CountTableRows(tableName string) (int, error) {
 
 	case strings.ToLower(_sql.PostgreSQL.String()):
 		query = fmt.Sprintf(_sql.PostgreSQLCountTableRows, c.Schema.Name, tableName)
-		rowCount, err = countTableRowsHelper(query, c.Database)
+		rowCount, err = countTableRowsHelper(ctx, query, c.Database)
 		if err != nil {
 			return 0, err
 		}
 		return rowCount, nil
 	case strings.ToLower(_sql.SQLite.String()):
-		query = fmt.Sprintf(_sql.SQLiteCountTableRows, tableName)
-		rowCount, err = countTableRowsHelper(query, c.Database)
+		schema, table, err := c.sourceOf(tableName)
+		if err != nil {
+			return 0, err
+		}
+		query = fmt.Sprintf(_sql.SQLiteCountTableRows, QualifiedTable(c.Type.String(), schema, table))
+		rowCount, err = countTableRowsHelper(ctx, query, c.Database)
 		if err != nil {
 			return 0, err
 		}
@@ -350,12 +542,7 @@ func (c *Client) GetTableNames() ([]string, error) {
 
 	switch strings.ToLower(c.Type.String()) {
 	case strings.ToLower(_sql.MySQL.String()):
-		query = fmt.Sprintf(_sql.MySQLUse, c.Schema.Name)
-		_, err = c.Database.Exec(query)
-		if err != nil {
-			return nil, err
-		}
-		query = _sql.MySQLShowTables
+		query = fmt.Sprintf(_sql.MySQLShowTables, QuoteIdentifier(c.Type.String(), c.Schema.Name))
 		tables, err = getTableNamesHelper(query, c.Database)
 		if err != nil {
 			return nil, err
@@ -399,7 +586,10 @@ func getColumnsHelper(query string, db *sql.DB) ([]Column, error) {
 	}(rows)
 
 	for rows.Next() {
-		var column Column
+		var (
+			column     Column
+			defaultVal sql.NullString
+		)
 		err = rows.Scan(
 			&column.Field,
 			&column.Type,
@@ -407,10 +597,17 @@ func getColumnsHelper(query string, db *sql.DB) ([]Column, error) {
 			&column.ConstraintName,
 			&column.ReferencedTable,
 			&column.ReferencedColumn,
+			&column.Comment,
+			&defaultVal,
+			&column.IsGenerated,
+			&column.Nullable,
 		)
 		if err != nil {
 			return nil, err
 		}
+		if defaultVal.Valid {
+			column.Default = &defaultVal.String
+		}
 		columns = append(columns, column)
 	}
 
@@ -422,6 +619,12 @@ func getColumnsHelper(query string, db *sql.DB) ([]Column, error) {
 }
 
 func (c *Client) GetColumns(tableName string) ([]Column, error) {
+	return c.GetColumnsInSchema(c.Schema.Name, tableName)
+}
+
+// GetColumnsInSchema is like GetColumns but reads the table from the given schema
+// instead of the one the client is currently browsing.
+func (c *Client) GetColumnsInSchema(schema, tableName string) ([]Column, error) {
 	if c.Database == nil {
 		return nil, errors.New("database connection is nil")
 	}
@@ -434,21 +637,25 @@ func (c *Client) GetColumns(tableName string) ([]Column, error) {
 
 	switch strings.ToLower(c.Type.String()) {
 	case strings.ToLower(_sql.MySQL.String()):
-		query = fmt.Sprintf(_sql.MySQLColumnsInfo, c.Schema.Name, tableName)
+		query = fmt.Sprintf(_sql.MySQLColumnsInfo, schema, tableName)
 		cols, err = getColumnsHelper(query, c.Database)
 		if err != nil {
 			return nil, err
 		}
 		return cols, nil
 	case strings.ToLower(_sql.PostgreSQL.String()):
-		query = fmt.Sprintf(_sql.PostgreSQLColumnsInfo, c.Schema.Name, tableName)
+		query = fmt.Sprintf(_sql.PostgreSQLColumnsInfo, schema, tableName)
 		cols, err = getColumnsHelper(query, c.Database)
 		if err != nil {
 			return nil, err
 		}
 		return cols, nil
 	case strings.ToLower(_sql.SQLite.String()):
-		query = fmt.Sprintf(_sql.SQLiteColumnsInfo, tableName)
+		schema, tableName, err = c.sourceOf(tableName)
+		if err != nil {
+			return nil, err
+		}
+		query = fmt.Sprintf(_sql.SQLiteColumnsInfo, tableName, schema)
 		cols, err = getColumnsHelper(query, c.Database)
 		if err != nil {
 			return nil, err
@@ -459,6 +666,116 @@ func (c *Client) GetColumns(tableName string) ([]Column, error) {
 	return nil, nil
 }
 
+// GetCachedColumns returns the columns of schema.table, querying the database only the first
+// time a given table is asked for. Tables that turn out to have no visible columns are not cached.
+func (c *Client) GetCachedColumns(schema, tableName string) ([]Column, error) {
+	var (
+		key  string
+		cols []Column
+		ok   bool
+		err  error
+	)
+
+	key = c.columnCacheKey(schema, tableName)
+	c.cacheMu.Lock()
+	cols, ok = c.columnCache[key]
+	c.cacheMu.Unlock()
+	if ok {
+		return cols, nil
+	}
+
+	cols, err = c.GetColumnsInSchema(schema, tableName)
+	if err != nil {
+		return nil, err
+	}
+	c.cacheColumns(schema, tableName, cols)
+	return cols, nil
+}
+
+// GetCachedColumnsWith is GetCachedColumns for a write naming the given columns. When one of them is
+// missing from the cached columns, the table may have been altered since it was cached, e.g. by another
+// client, so its columns are read again from the database and replace the cached ones.
+func (c *Client) GetCachedColumnsWith(schema, tableName string, names ...string) ([]Column, error) {
+	cols, err := c.GetCachedColumns(schema, tableName)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if !slices.ContainsFunc(cols, func(col Column) bool { return c.SameIdentifier(col.Field, name) }) {
+			c.InvalidateColumns(schema, tableName)
+			return c.GetCachedColumns(schema, tableName)
+		}
+	}
+	return cols, nil
+}
+
+// columnCacheKey returns the cache key of schema.table. SQLite keys are folded to lower case,
+// since a table may be referred to with any casing.
+func (c *Client) columnCacheKey(schema, tableName string) string {
+	if c.isSQLite() {
+		return strings.ToLower(schema + "." + tableName)
+	}
+	return schema + "." + tableName
+}
+
+// InvalidateColumns drops the cached columns of schema.table, after the table was altered.
+func (c *Client) InvalidateColumns(schema, tableName string) {
+	c.cacheMu.Lock()
+	delete(c.columnCache, c.columnCacheKey(schema, tableName))
+	c.cacheMu.Unlock()
+}
+
+// ResetColumns drops every cached column, so that they are read again from the database.
+func (c *Client) ResetColumns() {
+	c.cacheMu.Lock()
+	c.columnCache = nil
+	c.cacheMu.Unlock()
+}
+
+// RefreshColumns reads the columns of every table of the schema again and replaces the whole column cache
+// with them, e.g. after migrations run by another client. It returns the number of tables read. When a table
+// cannot be read the cache is left empty, to be filled on demand.
+func (c *Client) RefreshColumns() (int, error) {
+	tables, err := c.GetTableNames()
+	if err != nil {
+		c.ResetColumns()
+		return 0, err
+	}
+
+	cache := make(map[string][]Column, len(tables))
+	for _, table := range tables {
+		cols, err := c.GetColumnsInSchema(c.Schema.Name, table)
+		if err != nil {
+			c.ResetColumns()
+			return 0, fmt.Errorf("%s: %w", table, err)
+		}
+		// as in cacheColumns, tables with no visible columns are not cached
+		if len(cols) > 0 {
+			cache[c.columnCacheKey(c.Schema.Name, table)] = cols
+		}
+	}
+
+	c.cacheMu.Lock()
+	c.columnCache = cache
+	c.cacheMu.Unlock()
+	return len(tables), nil
+}
+
+// cacheColumns stores freshly read column metadata so later lookups see it.
+// Tables with no visible columns are not cached.
+func (c *Client) cacheColumns(schema, tableName string, cols []Column) {
+	if len(cols) == 0 {
+		return
+	}
+
+	c.cacheMu.Lock()
+	if c.columnCache == nil {
+		c.columnCache = make(map[string][]Column)
+	}
+	c.columnCache[c.columnCacheKey(schema, tableName)] = cols
+	c.cacheMu.Unlock()
+}
+
 func (c *Client) GetColumnsData(tableName string) (ColumnData, error) {
 	if c.Database == nil {
 		return ColumnData{}, errors.New("database connection is nil")
@@ -472,6 +789,14 @@ func (c *Client) GetColumnsData(tableName string) (ColumnData, error) {
 	)
 
 	data.TableName = tableName
+	data.Comment, err = c.GetTableComment(tableName)
+	if err != nil {
+		return ColumnData{}, err
+	}
+	data.ReferencedBy, err = c.GetReferencingTables(tableName)
+	if err != nil {
+		return ColumnData{}, err
+	}
 	switch strings.ToLower(c.Type.String()) {
 	case strings.ToLower(_sql.MySQL.String()):
 		query = fmt.Sprintf(_sql.MySQLColumnsInfo, c.Schema.Name, tableName)
@@ -491,7 +816,11 @@ func (c *Client) GetColumnsData(tableName string) (ColumnData, error) {
 		}
 		return data, nil
 	case strings.ToLower(_sql.SQLite.String()):
-		query = fmt.Sprintf(_sql.SQLiteColumnsInfo, tableName)
+		schema, table, err := c.sourceOf(tableName)
+		if err != nil {
+			return ColumnData{}, err
+		}
+		query = fmt.Sprintf(_sql.SQLiteColumnsInfo, table, schema)
 		cols, err = getColumnsHelper(query, c.Database)
 		data.Columns = cols
 		if err != nil {
@@ -506,11 +835,13 @@ func (c *Client) GetColumnsData(tableName string) (ColumnData, error) {
 /*
 - buildSelectAll constructs the SQL query to select all columns from a table.
 - Based on the database type, it formats the query string with the appropriate placeholders and values.
+- The rows are sorted in the given order, if any, so that the pages do not overlap.
 - It returns the formatted query string.
 */
-func buildSelectAll(cols []Column, DbType, schema, table string, perPage, offset int) string {
+func buildSelectAll(cols []Column, DbType, schema, table string, order *TableOrder, perPage, offset int) string {
 	var (
 		columnList string
+		orderBy    string
 		query      string
 	)
 	for i, columnName := range cols {
@@ -524,42 +855,86 @@ func buildSelectAll(cols []Column, DbType, schema, table string, perPage, offset
 		case strings.ToLower(_sql.PostgreSQL.String()):
 			columnList += fmt.Sprintf("\"%s\"", columnName.Field)
 		default:
-			columnList += columnName.Field
+			columnList += fmt.Sprintf("\"%s\"", columnName.Field)
 		}
 	}
 
+	if order != nil {
+		orderBy = " ORDER BY " + order.orderBy(DbType)
+	}
+
 	switch strings.ToLower(DbType) {
 	case strings.ToLower(_sql.MySQL.String()):
-		query = fmt.Sprintf(_sql.MySQLSelectAllWithLimit, columnList, schema, table, perPage, offset)
+		query = fmt.Sprintf(_sql.MySQLSelectAllWithLimit, columnList, schema, table, orderBy, perPage, offset)
 	case strings.ToLower(_sql.PostgreSQL.String()):
-		query = fmt.Sprintf(_sql.PostgreSQLSelectAllWithLimit, columnList, schema, table, perPage, offset)
+		query = fmt.Sprintf(_sql.PostgreSQLSelectAllWithLimit, columnList, schema, table, orderBy, perPage, offset)
 	case strings.ToLower(_sql.SQLite.String()):
-		query = fmt.Sprintf(_sql.SQLiteSelectAllWithLimit, columnList, table, perPage, offset)
+		query = fmt.Sprintf(_sql.SQLiteSelectAllWithLimit, columnList, QualifiedTable(DbType, schema, table), orderBy, perPage, offset)
 	}
 
 	return query
 }
 
-func getTableHelper(query string, db *sql.DB) (*Table, error) {
+// getTableHelper reads the rows of the query into Rows, nil when there are none so that they are encoded as null.
+// Values longer than the limit are truncated and reported in the warnings, see CellLimit.
+func getTableHelper(ctx context.Context, query string, db *sql.DB, limit CellLimit, args ...interface{}) (*Rows, []CellWarning, error) {
 	if db == nil {
-		return nil, errors.New("database connection is nil")
+		return nil, nil, errors.New("database connection is nil")
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer func(rows *sql.Rows) {
+		err = rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	results, warnings, err := ReadRows(rows, limit, limit.Budget())
+	if err != nil || results.Len() == 0 {
+		return nil, warnings, err
+	}
+	return results, warnings, nil
+}
+
+// RowSet is a compact form of query results: the rows are value slices ordered like Columns,
+// which are encoded without repeating the column names of every row of Table.Data.
+type RowSet struct {
+	Columns []string        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+	// Renamed lists the columns renamed because an earlier column has the same name, see DistinctColumns
+	Renamed []ColumnRename `json:"renamed_columns,omitempty"`
+}
+
+// rowSetBlockRows is how many rows getRowSetHelper allocates storage for at once.
+const rowSetBlockRows = 256
+
+// getRowSetHelper is like getTableHelper but returns a RowSet. Row values are carved out of
+// blocks holding rowSetBlockRows rows, so there is one allocation per block instead of one map per row.
+func getRowSetHelper(ctx context.Context, query string, db *sql.DB, limit CellLimit, args ...interface{}) (*RowSet, []CellWarning, error) {
+	if db == nil {
+		return nil, nil, errors.New("database connection is nil")
 	}
 
 	var (
 		rows      *sql.Rows
-		tableData *Table
+		rowSet    *RowSet
 		err       error
 		columns   []string
-		results   []Row
+		block     []interface{}
 		values    []interface{}
 		valuePtrs []interface{}
-		numRows   int
-		numCols   int
+		warnings  []CellWarning
+		budget    = limit.Budget()
 	)
 
-	rows, err = db.Query(query)
+	rows, err = db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	defer func(rows *sql.Rows) {
@@ -571,75 +946,165 @@ func getTableHelper(query string, db *sql.DB) (*Table, error) {
 
 	columns, err = rows.Columns()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	// TODO: (Optimize memory allocation) preallocating 'results' with the exact number of rows
-	// results := make([]Row, 0, rowCount)
+	rowSet = &RowSet{Rows: make([][]interface{}, 0)}
+	rowSet.Columns, rowSet.Renamed = DistinctColumns(columns)
 	values = make([]interface{}, len(columns))
 	valuePtrs = make([]interface{}, len(columns))
+	for i := range columns {
+		valuePtrs[i] = &values[i]
+	}
 	for rows.Next() {
-		row := make(Row, len(columns))
-		for i := range columns {
-			valuePtrs[i] = &values[i]
-		}
 		if err = rows.Scan(valuePtrs...); err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		for i, col := range columns {
-			var v interface{}
-			val := values[i]
-			b, ok := val.([]byte)
-			if ok {
-				v = string(b)
+		if len(block) < len(columns) {
+			block = make([]interface{}, rowSetBlockRows*len(columns))
+		}
+		row := block[:len(columns):len(columns)]
+		block = block[len(columns):]
+		for i, val := range values {
+			v, truncated := limit.Value(val)
+			if truncated {
+				warnings = append(warnings, CellWarning{Row: len(rowSet.Rows), Column: columns[i], Bytes: v.(*TruncatedCell).Bytes})
 			} else {
-				v = val
+				v = readable(columns[i], v)
 			}
-			row[col] = v
+			if err = budget.Charge("", v); err != nil {
+				return nil, nil, err
+			}
+			row[i] = v
 		}
-		results = append(results, row)
+		rowSet.Rows = append(rowSet.Rows, row)
 	}
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	numRows, numCols = len(results), len(columns)
-	if err != nil {
-		return nil, err
-	}
+	return rowSet, warnings, nil
+}
 
-	tableData = &Table{
-		Data:      results,
-		N_columns: numCols,
-		N_rows:    numRows,
-	}
+func (c *Client) GetTable(tableName string, page, perPage int) (*Table, error) {
+	return c.getTable(context.Background(), tableName, TableQuery{Page: page, PerPage: perPage})
+}
 
-	return tableData, nil
+// GetTableContext is like GetTable, traced as a child of the span of ctx and cancelled with it.
+func (c *Client) GetTableContext(ctx context.Context, tableName string, page, perPage int) (*Table, error) {
+	return c.getTable(ctx, tableName, TableQuery{Page: page, PerPage: perPage})
 }
 
-func (c *Client) GetTable(tableName string, page, perPage int) (*Table, error) {
+// GetTableCompact is like GetTable but returns the rows in Table.Rows as value slices
+// instead of objects in Table.Data, which is much smaller for wide tables.
+func (c *Client) GetTableCompact(tableName string, page, perPage int) (*Table, error) {
+	return c.getTable(context.Background(), tableName, TableQuery{Page: page, PerPage: perPage, Compact: true})
+}
+
+// GetTableCompactContext is like GetTableCompact, traced as a child of the span of ctx and cancelled with it.
+func (c *Client) GetTableCompactContext(ctx context.Context, tableName string, page, perPage int) (*Table, error) {
+	return c.getTable(ctx, tableName, TableQuery{Page: page, PerPage: perPage, Compact: true})
+}
+
+// TableQuery is the page of a table to read, see GetTablePageContext.
+type TableQuery struct {
+	Page    int
+	PerPage int
+	// Compact returns the rows in Table.Rows, see GetTableCompact
+	Compact bool
+	// Columnar leaves Table.Data nil and keeps the rows column by column, encoded to JSON as Data would be.
+	// It spares a map per row to tables that are only encoded, such as the /table responses.
+	Columnar bool
+	// Search only reads the rows containing the text, see SearchTable
+	Search string
+	// Collation sorts the text columns of the implicit order with a collation the server offers, see TableOrder
+	Collation string
+}
+
+// GetTablePageContext reads the page of the table the query selects, traced as a child of the span of ctx
+// and cancelled with it. It fails with an UnknownCollationError when the server offers no such collation.
+func (c *Client) GetTablePageContext(ctx context.Context, tableName string, q TableQuery) (*Table, error) {
+	return c.getTable(ctx, tableName, q)
+}
+
+// getTable reads a page of the table, only the rows matching the search when it is set, see SearchTable.
+// Reading the rows is traced as a child of the span of ctx.
+func (c *Client) getTable(ctx context.Context, tableName string, q TableQuery) (*Table, error) {
 	if c.Database == nil {
 		return nil, errors.New("database connection is nil")
 	}
 
 	var (
 		cols      []Column
-		tableData *Table
+		data      *Rows
+		rowSet    *RowSet
+		warnings  []CellWarning
 		table     *Table
 		size      TableSize
 		err       error
 		offset    int
 		query     string
+		args      []interface{}
+		comment   string
+		search    *Search
+		order     *TableOrder
+		numRows   int
+		collation string
+		page      = q.Page
+		perPage   = q.PerPage
+		compact   = q.Compact
+		text      = q.Search
 	)
 
+	if q.Collation != "" {
+		collation, err = c.checkCollation(q.Collation)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the stored name is used from here on, so the table is quoted, cached and reported as created
+	tableName, err = c.StoredTableName(tableName)
+	if err != nil {
+		return nil, err
+	}
+
 	offset = (page - 1) * perPage
 	cols, err = c.GetColumns(tableName)
 	if err != nil {
 		return nil, err
 	}
+	c.cacheColumns(c.Schema.Name, tableName, cols)
 
-	query = buildSelectAll(cols, c.Type.String(), c.Schema.Name, tableName, perPage, offset)
-	tableData, err = getTableHelper(query, c.Database)
+	order = implicitOrder(c.Type.String(), cols)
+	if order != nil && collation != "" {
+		order.collate(collation, cols)
+	}
+	if text != "" {
+		search, order, query, args, err = c.searchTable(ctx, tableName, text, cols, order, perPage, offset)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		schema, table, err := c.sourceOf(tableName)
+		if err != nil {
+			return nil, err
+		}
+		query = buildSelectAll(cols, c.Type.String(), schema, table, order, perPage, offset)
+	}
+	ctx, span := tracing.StartQuery(ctx, "GetTable", strings.ToLower(c.Type.String()), "SELECT", tableName)
+	if compact {
+		rowSet, warnings, err = getRowSetHelper(ctx, query, c.Database, c.Cells, args...)
+		if err == nil {
+			numRows = len(rowSet.Rows)
+		}
+	} else {
+		data, warnings, err = getTableHelper(ctx, query, c.Database, c.Cells, args...)
+		if err == nil {
+			numRows = data.Len()
+		}
+	}
+	tracing.EndQuery(span, int64(numRows), err)
 	if err != nil {
 		return nil, err
 	}
@@ -654,18 +1119,69 @@ func (c *Client) GetTable(tableName string, page, perPage int) (*Table, error) {
 		}
 	}
 
+	comment, err = c.GetTableComment(tableName)
+	if err != nil {
+		return nil, err
+	}
+
 	table = &Table{
 		Name:      tableName,
-		Data:      tableData.Data,
 		Columns:   cols,
 		N_columns: len(cols),
-		N_rows:    len(tableData.Data),
 		Size:      size.SizeMB,
+		Comment:   comment,
+
+		Fingerprint: Fingerprint(cols),
+		Search:      search,
+		Order:       order,
+	}
+	if compact {
+		table.Rows, table.N_rows, table.Warnings = rowSet, len(rowSet.Rows), warnings
+	} else if q.Columnar {
+		table.rows, table.N_rows, table.Warnings = data, data.Len(), warnings
+	} else {
+		table.Data, table.N_rows, table.Warnings = data.Maps(), data.Len(), warnings
 	}
 
 	return table, nil
 }
 
+func getTableCommentHelper(query string, db *sql.DB) (string, error) {
+	var (
+		err     error
+		comment string
+	)
+	err = db.QueryRow(query).Scan(&comment)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", err
+	}
+	return comment, nil
+}
+
+// GetTableComment returns the comment (description) attached to a table.
+// SQLite has no table comments, so it always yields an empty string.
+func (c *Client) GetTableComment(tableName string) (string, error) {
+	if c.Database == nil {
+		return "", errors.New("database connection is nil")
+	}
+
+	var query string
+
+	switch strings.ToLower(c.Type.String()) {
+	case strings.ToLower(_sql.MySQL.String()):
+		query = fmt.Sprintf(_sql.MySQLTableComment, c.Schema.Name, tableName)
+		return getTableCommentHelper(query, c.Database)
+	case strings.ToLower(_sql.PostgreSQL.String()):
+		query = fmt.Sprintf(_sql.PostgreSQLTableComment, c.Schema.Name, tableName)
+		return getTableCommentHelper(query, c.Database)
+	}
+
+	return "", nil
+}
+
 func getTableSizes(query string, db *sql.DB) ([]TableSize, error) {
 
 	var (
@@ -710,6 +1226,7 @@ func (c *Client) GetTablesSize() ([]TableSize, error) {
 	// tableSizes := make([]TableSize, 0)
 	var (
 		tableSizes []TableSize
+		modified   map[string]LastModified
 		err        error
 		query      string
 	)
@@ -717,29 +1234,28 @@ func (c *Client) GetTablesSize() ([]TableSize, error) {
 	switch strings.ToLower(c.Type.String()) {
 	case strings.ToLower(_sql.MySQL.String()):
 		query = fmt.Sprintf(_sql.MySQLGetTablesSize, c.Schema.Name)
-		tableSizes, err = getTableSizes(query, c.Database)
-		if err != nil {
-			return nil, err
-		}
-		return tableSizes, nil
-
 	case strings.ToLower(_sql.PostgreSQL.String()):
 		query = _sql.PostgreSQLTableSizes
-		tableSizes, err = getTableSizes(query, c.Database)
-		if err != nil {
-			return nil, err
-		}
-		return tableSizes, nil
 	case strings.ToLower(_sql.SQLite.String()):
 		query = _sql.SQLiteTablesSize
-		tableSizes, err = getTableSizes(query, c.Database)
-		if err != nil {
-			return nil, err
-		}
-		return tableSizes, nil
+	default:
+		return nil, nil
 	}
 
-	return nil, nil
+	tableSizes, err = getTableSizes(query, c.Database)
+	if err != nil {
+		return nil, err
+	}
+	modified, err = c.GetTablesLastModified()
+	if err != nil {
+		return nil, err
+	}
+	for i := range tableSizes {
+		if m, ok := modified[tableSizes[i].Table]; ok {
+			tableSizes[i].LastModified = &m
+		}
+	}
+	return tableSizes, nil
 }
 
 func getTableSize(query string, db *sql.DB) (TableSize, error) {
@@ -807,53 +1323,19 @@ func (c *Client) GetTableSize(table string) (TableSize, error) {
 	return TableSize{}, nil
 }
 
-func createFile(fileName string) (*os.File, error) {
-	var (
-		err      error
-		file     *os.File
-		filePath string
-		homeDir  string
-		appPath  string
-	)
-
-	homeDir, err = os.UserHomeDir()
-	if err != nil {
-		return nil, err
-	}
-
-	appPath = filepath.Join(homeDir, "sqlweb")
-	if _, err = os.Stat(appPath); errors.Is(err, os.ErrNotExist) {
-		err := os.MkdirAll(appPath, os.ModePerm)
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	filePath = filepath.Join(appPath, fileName)
-	if _, err = os.Stat(filePath); errors.Is(err, os.ErrNotExist) {
-		file, err = os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0666)
-		if err != nil {
-			return nil, err
-		}
-		return file, nil
-	}
-
-	file, err = os.OpenFile(filePath, os.O_RDWR|os.O_APPEND, 0666)
-	if err != nil {
-		return nil, err
-	}
-	return file, nil
-}
-
-func (c *Client) ExportToJsonFile(tableName string) (int, error) {
+// ExportToJsonFile writes the table as JSON to <table>.json in the sqlweb directory, replacing an
+// earlier export, and returns the number of bytes written. The file is written under a .partial name and
+// only renamed once complete, so a cancelled or failed export leaves no file behind. Columns the connection
+// excludes from exports are left out.
+func (c *Client) ExportToJsonFile(ctx context.Context, tableName string) (int, error) {
 	if c.Database == nil {
 		return 0, errors.New("database connection is nil")
 	}
 
 	var (
 		err          error
-		file         *os.File
-		table        *Table
+		file         *partialFile
+		rows         *Rows
 		jsonFileName string
 		query        string
 		data         []byte
@@ -861,104 +1343,103 @@ func (c *Client) ExportToJsonFile(tableName string) (int, error) {
 	)
 
 	jsonFileName = fmt.Sprintf("%s.json", tableName)
-	file, err = createFile(jsonFileName)
+	file, err = createPartial(jsonFileName)
 	if err != nil {
 		return 0, err
 	}
+	defer file.abort()
 
-	defer func() {
-		if err = file.Close(); err != nil {
-			fmt.Printf("Error closing file: %v\n", err)
-		}
-	}()
-
-	query = fmt.Sprintf(_sql.SQLSelectAll, c.Schema.Name, tableName)
-	table, err = getTableHelper(query, c.Database)
+	query, _, err = c.exportQuery(tableName, nil)
+	if err != nil {
+		return 0, err
+	}
+	rows, _, err = getTableHelper(ctx, query, c.Database, c.Cells.export())
 	if err != nil {
 		return 0, err
 	}
 
-	data, err = json.MarshalIndent(table.Data, "", "\t")
+	data, err = json.MarshalIndent(c.Nulls.JSONRows(rows), "", "\t")
 	if err != nil {
 		return 0, err
 	}
+	if err = ctx.Err(); err != nil {
+		return 0, err
+	}
 
 	bytes, err = file.WriteString(string(data))
 	if err != nil {
 		return 0, err
 	}
+	if err = file.commit(); err != nil {
+		return 0, err
+	}
 
 	return bytes, nil
 }
 
-func (c *Client) ExportToCSVFile(tableName string) (int, error) {
+// ExportToCSVFile streams the table as CSV to <table>.csv in the sqlweb directory, replacing an
+// earlier export, and returns the number of bytes written, as measured on the file. The file is written
+// under a .partial name and only renamed once complete, so a cancelled or failed export leaves no file behind.
+// Columns the connection excludes from exports are left out.
+func (c *Client) ExportToCSVFile(ctx context.Context, tableName string) (int, error) {
 	if c.Database == nil {
 		return 0, errors.New("database connection is nil")
 	}
 
 	var (
 		err         error
-		file        *os.File
-		table       *Table
-		writer      *csv.Writer
-		firstRow    Row
+		file        *partialFile
+		rows        *sql.Rows
+		info        os.FileInfo
 		csvFileName string
 		query       string
-		header      []string
-		bits        int
 	)
 
 	csvFileName = fmt.Sprintf("%s.csv", tableName)
-	file, err = createFile(csvFileName)
+	file, err = createPartial(csvFileName)
 	if err != nil {
 		return 0, err
 	}
+	defer file.abort()
 
-	defer func() {
-		if err = file.Close(); err != nil {
-			fmt.Printf("Error closing file: %v\n", err)
-		}
-	}()
-
-	query = fmt.Sprintf(_sql.SQLSelectAll, c.Schema.Name, tableName)
-	table, err = getTableHelper(query, c.Database)
+	query, _, err = c.exportQuery(tableName, nil)
+	if err != nil {
+		return 0, err
+	}
+	rows, err = c.Database.QueryContext(ctx, query)
 	if err != nil {
 		return 0, err
 	}
 
-	writer = csv.NewWriter(file)
-	defer writer.Flush()
-
-	if len(table.Data) > 0 {
-		firstRow = table.Data[0]
-		header = make([]string, 0, len(firstRow))
-		for key := range firstRow {
-			header = append(header, key)
-		}
-		if err = writer.Write(header); err != nil {
-			return 0, err
+	defer func(rows *sql.Rows) {
+		if err := rows.Close(); err != nil {
+			return
 		}
+	}(rows)
+
+	if err = writeRowsCSV(file, rows, c.Nulls, c.Floats, c.Cells.export(), nil); err != nil {
+		return 0, err
 	}
 
-	for _, row := range table.Data {
-		var values []string
-		for _, v := range row {
-			values = append(values, fmt.Sprintf("%v", v))
-		}
-		if err = writer.Write(values); err != nil {
-			return 0, err
-		}
-		bits += len([]byte(strings.Join(values, ","))) + len("\n")
+	info, err = file.Stat()
+	if err != nil {
+		return 0, err
 	}
-	return bits, nil
+	if err = file.commit(); err != nil {
+		return 0, err
+	}
+	return int(info.Size()), nil
 }
 
-func (c *Client) ShowCreateTableFile() (int, error) {
+// ShowCreateTableFile writes the MySQL DDL of every table to <schema>.sql in the sqlweb directory,
+// replacing an earlier dump, and returns the number of bytes written. The file is written under a .partial
+// name and only renamed once complete, so a cancelled or failed dump leaves no file behind.
+func (c *Client) ShowCreateTableFile(ctx context.Context) (int, error) {
 	if c.Database == nil {
 		return 0, fmt.Errorf("database connection is nil")
 	}
 	var (
-		file         *os.File
+		file         *partialFile
 		writer       *bufio.Writer
 		err          error
 		query        string
@@ -976,23 +1457,19 @@ func (c *Client) ShowCreateTableFile() (int, error) {
 	}
 
 	sqlFileName = fmt.Sprintf("%s.sql", c.Schema.Name)
-	file, err = createFile(sqlFileName)
-	writer = bufio.NewWriter(file)
+	file, err = createPartial(sqlFileName)
 	if err != nil {
 		return 0, err
 	}
-	defer func() {
-		if err = file.Close(); err != nil {
-			fmt.Printf("Error closing file: %v\n", err)
-		}
-	}()
+	defer file.abort()
+	writer = bufio.NewWriter(file)
 	header = `
 ========================================================================
 ========================================================================
 `
 	for _, t := range tables {
 		query = fmt.Sprintf(_sql.MySQLShowCreateTable, c.Schema.Name, t)
-		err = c.Database.QueryRow(query).Scan(&tableName, &sqlStatement)
+		err = c.Database.QueryRowContext(ctx, query).Scan(&tableName, &sqlStatement)
 		if err != nil {
 			return 0, err
 		}
@@ -1016,56 +1493,74 @@ func (c *Client) ShowCreateTableFile() (int, error) {
 	if err = writer.Flush(); err != nil {
 		return 0, err
 	}
+	if err = file.commit(); err != nil {
+		return 0, err
+	}
 
 	return totalBytes, nil
 }
 
-func (c *Client) ExportToJson(tableName string) ([]byte, error) {
+// ExportToJson renders the table as JSON, without the excluded columns, and returns the columns it omitted,
+// see ExportColumns.
+func (c *Client) ExportToJson(tableName string, exclude []string) ([]byte, []string, error) {
 	if c.Database == nil {
-		return nil, errors.New("database connection is nil")
+		return nil, nil, errors.New("database connection is nil")
 	}
 
 	var (
-		err   error
-		table *Table
-		query string
-		data  []byte
+		err     error
+		rows    *Rows
+		query   string
+		omitted []string
+		data    []byte
 	)
 
-	query = fmt.Sprintf(_sql.SQLSelectAll, c.Schema.Name, tableName)
-	table, err = getTableHelper(query, c.Database)
+	query, omitted, err = c.exportQuery(tableName, exclude)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	rows, _, err = getTableHelper(context.Background(), query, c.Database, c.Cells.export())
+	if err != nil {
+		return nil, nil, err
 	}
 
-	data, err = json.MarshalIndent(table.Data, "", "\t")
+	data, err = json.MarshalIndent(c.Nulls.JSONRows(rows), "", "\t")
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return data, nil
+	return data, omitted, nil
 }
 
-// TODO: fix bug where NULL SQL values are preventing the export
-// invistgate why tables with lots of null values aren't exported
-func sqlToCsv(rows *sql.Rows) (string, error) {
+// sqlToCsv renders the rows as CSV, writing NULL values as the placeholder of the given format
+// and floats in the given float format.
+func sqlToCsv(rows *sql.Rows, nulls NullFormat, floats FloatFormat, limit CellLimit) (string, error) {
+	var builder strings.Builder
+	if err := writeRowsCSV(&builder, rows, nulls, floats, limit, nil); err != nil {
+		return "", err
+	}
+	return builder.String(), nil
+}
 
+// writeRowsCSV writes the rows to w as CSV, with a header row. All values go through csv.Writer
+// so that commas, quotes and newlines inside values are quoted. Values longer than the limit are truncated.
+// When rowWritten is not nil, each row is flushed to w before it is called.
+func writeRowsCSV(w io.Writer, rows *sql.Rows, nulls NullFormat, floats FloatFormat, limit CellLimit, rowWritten func()) error {
 	var (
-		//err         error
-		builder strings.Builder
-		writer  *csv.Writer
+		err    error
+		writer *csv.Writer
 	)
-	writer = csv.NewWriter(&builder)
-	defer writer.Flush()
+	writer = csv.NewWriter(w)
 	writer.Comma = ','
 	columnNames, err := rows.Columns()
 	if err != nil {
-		return "", nil
+		return err
 	}
+	columnNames, _ = DistinctColumns(columnNames)
 	headers := columnNames
 	err = writer.Write(headers)
 	if err != nil {
-		return "", fmt.Errorf("failed to write headers: %w", err)
+		return fmt.Errorf("failed to write headers: %w", err)
 	}
 	values := make([]interface{}, len(columnNames))
 	valuePtrs := make([]interface{}, len(columnNames))
@@ -1076,53 +1571,59 @@ func sqlToCsv(rows *sql.Rows) (string, error) {
 		}
 
 		if err = rows.Scan(valuePtrs...); err != nil {
-			return "", err
+			return err
 		}
 		for i := range columnNames {
-			var value interface{}
-			rawValue := values[i]
-
-			byteArray, ok := rawValue.([]byte)
-			if ok {
-				value = string(byteArray)
-			} else {
-				value = rawValue
-			}
+			value, _ := limit.Value(values[i])
 			float64Value, ok := value.(float64)
 			if ok {
-				value = fmt.Sprintf("%v", float64Value)
+				value = floats.Text(float64Value, 64)
 			} else {
 				float32Value, ok := value.(float32)
 				if ok {
-					value = fmt.Sprintf("%v", float32Value)
+					value = floats.Text(float64(float32Value), 32)
 				}
 			}
 			timeValue, ok := value.(time.Time)
 			if ok {
 				value = timeValue.Format(time.RFC822)
 			}
-			row[i] = fmt.Sprintf("%v", value)
+			row[i] = nulls.Text(value)
 		}
 		err = writer.Write(row)
 		if err != nil {
-			return "", fmt.Errorf("failed to write data row to csv %w", err)
+			return fmt.Errorf("failed to write data row to csv %w", err)
+		}
+		if rowWritten != nil {
+			writer.Flush()
+			if err = writer.Error(); err != nil {
+				return err
+			}
+			rowWritten()
 		}
 	}
 	if err = rows.Err(); err != nil {
-		return "", err
+		return err
 	}
-	return builder.String(), nil
+	// the writer buffers its output, it must be flushed before w is read
+	writer.Flush()
+	return writer.Error()
 }
 
-func (c *Client) ExportToCSV(tableName string) (string, error) {
+// ExportToCSV renders the table as CSV, without the excluded columns, and returns the columns it omitted,
+// see ExportColumns.
+func (c *Client) ExportToCSV(tableName string, exclude []string) (string, []string, error) {
 	if c.Database == nil {
-		return "", errors.New("database connection is nil")
+		return "", nil, errors.New("database connection is nil")
 	}
 
-	query := fmt.Sprintf(_sql.SQLSelectAll, c.Schema.Name, tableName)
+	query, omitted, err := c.exportQuery(tableName, exclude)
+	if err != nil {
+		return "", nil, err
+	}
 	rows, err := c.Database.Query(query)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
 	defer func(rows *sql.Rows) {
@@ -1132,12 +1633,12 @@ func (c *Client) ExportToCSV(tableName string) (string, error) {
 		}
 	}(rows)
 
-	csvStr, err := sqlToCsv(rows)
+	csvStr, err := sqlToCsv(rows, c.Nulls, c.Floats, c.Cells.export())
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
-	return csvStr, nil
+	return csvStr, omitted, nil
 }
 
 func (c *Client) ShowCreateTable() (string, error) {
@@ -1163,25 +1664,68 @@ func (c *Client) ShowCreateTable() (string, error) {
 			return "", nil
 		}
 		return result, nil
+	case strings.ToLower(_sql.SQLite.String()):
+		result, err := c.ShowCreateTableSQLite(tables, seperator)
+		if err != nil {
+			return "", nil
+		}
+		return result, nil
 	}
 	return "", nil
 }
 
-func (c *Client) ShowCreateTablePostgreSQL(tables []string, seperator string) (string, error) {
+// GetCreateStatements returns the DDL of every table in the current schema keyed by table name.
+func (c *Client) GetCreateStatements() (map[string]string, error) {
+	tables, err := c.GetTableNames()
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(c.Type.String()) {
+	case strings.ToLower(_sql.MySQL.String()):
+		return c.createStatementsMySQL(tables)
+	case strings.ToLower(_sql.PostgreSQL.String()):
+		return c.createStatementsPostgreSQL(tables)
+	case strings.ToLower(_sql.SQLite.String()):
+		return c.createStatementsSQLite(tables)
+	}
+	return nil, fmt.Errorf("unsupported database type: %s", c.Type.String())
+}
+
+// joinCreateStatements concatenates the statements in table order, each preceded by the separator.
+func joinCreateStatements(tables []string, statements map[string]string, seperator string) string {
+	var builder strings.Builder
+	for _, t := range tables {
+		statement, ok := statements[t]
+		if !ok {
+			continue
+		}
+		builder.WriteString(seperator + "\n")
+		builder.WriteString("===== TABLE: " + t + " =====" + "\n")
+		builder.WriteString(statement + "\n")
+	}
+	return builder.String()
+}
+
+func (c *Client) createStatementsPostgreSQL(tables []string) (map[string]string, error) {
 	if c.Database == nil {
-		return "", fmt.Errorf("database connection is nil")
+		return nil, fmt.Errorf("database connection is nil")
 	}
 
 	var (
 		err          error
 		query        string
 		sqlStatement string
-		builder      strings.Builder
+		creates      []string
+		owners       []string
+		triggers     []string
+		bundle       []string
+		statements   map[string]string
 	)
 
 	_, err = c.Database.Exec(_sql.PostgreSQLShowCreateFunction)
 	if err != nil {
-		return builder.String(), err
+		return nil, err
 	}
 
 	defer func() {
@@ -1191,72 +1735,137 @@ func (c *Client) ShowCreateTablePostgreSQL(tables []string, seperator string) (s
 		}
 	}()
 
+	statements = make(map[string]string, len(tables))
 	for _, t := range tables {
 		query = fmt.Sprintf(_sql.PostgreSQLShowCreate, c.Schema.Name, t)
 		err = c.Database.QueryRow(query).Scan(&sqlStatement)
 		if err != nil {
-			return builder.String(), err
+			return statements, err
 		}
-		builder.WriteString(seperator + "\n")
-		builder.WriteString("===== TABLE: " + t + " =====" + "\n")
-		builder.WriteString(sqlStatement + "\n")
+		creates, owners, err = postgresSequencesHelper(c.Database, c.Schema.Name, t)
+		if err != nil {
+			return statements, err
+		}
+		triggers, err = postgresTriggersHelper(c.Database, c.Schema.Name, t)
+		if err != nil {
+			return statements, err
+		}
+		// sequences are created before the table that uses them, and owned by its columns afterwards
+		bundle = append(creates, strings.TrimRight(sqlStatement, "\n"))
+		bundle = append(bundle, owners...)
+		statements[t] = joinStatements(append(bundle, triggers...))
 	}
 
-	return builder.String(), nil
+	return statements, nil
 }
 
-func (c *Client) ShowCreateTableMySQL(tables []string, seperator string) (string, error) {
+func (c *Client) createStatementsMySQL(tables []string) (map[string]string, error) {
 	if c.Database == nil {
-		return "", fmt.Errorf("database connection is nil")
+		return nil, fmt.Errorf("database connection is nil")
 	}
 
 	var (
 		err          error
 		tableName    string
 		sqlStatement string
-		builder      strings.Builder
 		query        string
+		triggers     []string
+		statements   map[string]string
 	)
 
+	statements = make(map[string]string, len(tables))
 	for _, t := range tables {
 		query = fmt.Sprintf(_sql.MySQLShowCreateTable, c.Schema.Name, t)
 		err = c.Database.QueryRow(query).Scan(&tableName, &sqlStatement)
 		if err != nil {
-			return builder.String(), err
+			return statements, err
 		}
-
-		builder.WriteString(seperator + "\n")
-		builder.WriteString("===== TABLE: " + tableName + " =====" + "\n")
-		builder.WriteString(sqlStatement + "\n")
+		// SHOW CREATE TABLE includes the indexes but not the triggers
+		triggers, err = mysqlTriggersHelper(c.Database, c.Schema.Name, t)
+		if err != nil {
+			return statements, err
+		}
+		statements[t] = joinStatements(append([]string{sqlStatement}, triggers...))
 	}
 
-	return builder.String(), nil
+	return statements, nil
 }
 
-func (c *Client) ShowCreateTableSQLite(tables []string, seperator string) (string, error) {
+func (c *Client) createStatementsSQLite(tables []string) (map[string]string, error) {
 	if c.Database == nil {
-		return "", fmt.Errorf("database connection is nil")
+		return nil, fmt.Errorf("database connection is nil")
 	}
 
 	var (
 		err          error
 		tableName    string
 		sqlStatement string
-		builder      strings.Builder
 		query        string
+		objects      []string
+		statements   map[string]string
 	)
 
+	statements = make(map[string]string, len(tables))
 	for _, t := range tables {
 		query = fmt.Sprintf(_sql.SQLiteShowCreateTable, t)
 		err = c.Database.QueryRow(query).Scan(&tableName, &sqlStatement)
 		if err != nil {
-			return builder.String(), err
+			return statements, err
+		}
+		// indexes and triggers are stored as objects of their own
+		objects, err = getStatementsHelper(fmt.Sprintf(_sql.SQLiteTableObjects, t), c.Database)
+		if err != nil {
+			return statements, err
 		}
+		statements[t] = joinStatements(append([]string{sqlStatement}, objects...))
+	}
 
-		builder.WriteString(seperator + "\n")
-		builder.WriteString("===== TABLE: " + tableName + " =====" + "\n")
-		builder.WriteString(sqlStatement + "\n")
+	return statements, nil
+}
+
+func (c *Client) ShowCreateTablePostgreSQL(tables []string, seperator string) (string, error) {
+	statements, err := c.createStatementsPostgreSQL(tables)
+	if err != nil {
+		return joinCreateStatements(tables, statements, seperator), err
 	}
+	return joinCreateStatements(tables, statements, seperator), nil
+}
 
-	return builder.String(), nil
+func (c *Client) ShowCreateTableMySQL(tables []string, seperator string) (string, error) {
+	statements, err := c.createStatementsMySQL(tables)
+	if err != nil {
+		return joinCreateStatements(tables, statements, seperator), err
+	}
+	return joinCreateStatements(tables, statements, seperator), nil
+}
+
+func (c *Client) ShowCreateTableSQLite(tables []string, seperator string) (string, error) {
+	statements, err := c.createStatementsSQLite(tables)
+	if err != nil {
+		return joinCreateStatements(tables, statements, seperator), err
+	}
+	return joinCreateStatements(tables, statements, seperator), nil
+}
+
+// SQLitePragmas are the settings SQLite connections are opened with.
+type SQLitePragmas struct {
+	BusyTimeout int    `json:"busy_timeout"`
+	JournalMode string `json:"journal_mode"`
+	ForeignKeys bool   `json:"foreign_keys"`
+}
+
+// GetSQLitePragmas returns the effective settings of a connection of the pool.
+func (c *Client) GetSQLitePragmas() (*SQLitePragmas, error) {
+	if c.Database == nil {
+		return nil, errors.New("database connection is nil")
+	}
+	if !strings.EqualFold(c.Type.String(), _sql.SQLite.String()) {
+		return nil, fmt.Errorf("pragmas are only available for SQLite, not %s", c.Type.String())
+	}
+	pragmas := &SQLitePragmas{}
+	err := c.Database.QueryRow(_sql.SQLiteConnectionPragmas).Scan(&pragmas.BusyTimeout, &pragmas.JournalMode, &pragmas.ForeignKeys)
+	if err != nil {
+		return nil, err
+	}
+	return pragmas, nil
 }
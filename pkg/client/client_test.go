@@ -1,14 +1,26 @@
 package client
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	_conn "github.com/yazeed1s/sqlweb/db/connection"
 	_sql "github.com/yazeed1s/sqlweb/db/sql"
+	"github.com/yazeed1s/sqlweb/pkg/util"
 
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/mattn/go-sqlite3"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -280,3 +292,1666 @@ func TestGetTablesSize(t *testing.T) {
 	assert.Equal(t, expectedSizes, tableSizes)
 	client.Database.Close()
 }
+
+func TestGetTableCommentMySQL(t *testing.T) {
+	client, err := SetupMySQLConnection()
+	require.NoError(t, err, "Failed to set up MySQL connection")
+	defer client.Database.Close()
+
+	_, err = client.Database.Exec(`
+		CREATE TABLE classicmodels.test_commented (
+			id INT PRIMARY KEY COMMENT 'row identifier'
+		) COMMENT = 'table used by the comment test'
+	`)
+	require.NoError(t, err)
+	defer client.Database.Exec(`DROP TABLE classicmodels.test_commented`)
+
+	comment, err := client.GetTableComment("test_commented")
+	require.NoError(t, err)
+	assert.Equal(t, "table used by the comment test", comment)
+
+	data, err := client.GetColumnsData("test_commented")
+	require.NoError(t, err)
+	assert.Equal(t, "table used by the comment test", data.Comment)
+	require.Len(t, data.Columns, 1)
+	assert.Equal(t, "row identifier", data.Columns[0].Comment)
+}
+
+func TestGetColumnsGeneratedSQLite(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE items (
+		id INTEGER PRIMARY KEY,
+		price REAL NOT NULL DEFAULT 0,
+		quantity INTEGER,
+		total REAL GENERATED ALWAYS AS (price * quantity) VIRTUAL
+	)`)
+	require.NoError(t, err)
+
+	client := &Client{Type: _sql.SQLite, Database: db}
+	cols, err := client.GetColumns("items")
+	require.NoError(t, err)
+	require.Len(t, cols, 4)
+
+	byName := make(map[string]Column)
+	for _, col := range cols {
+		byName[col.Field] = col
+	}
+	require.NotNil(t, byName["price"].Default)
+	assert.Equal(t, "0", *byName["price"].Default)
+	assert.False(t, byName["price"].IsGenerated)
+	assert.Nil(t, byName["quantity"].Default)
+	assert.True(t, byName["total"].IsGenerated)
+}
+
+func TestGetColumnsGeneratedMySQL(t *testing.T) {
+	client, err := SetupMySQLConnection()
+	require.NoError(t, err, "Failed to set up MySQL connection")
+	defer client.Database.Close()
+
+	_, err = client.Database.Exec(`
+		CREATE TABLE classicmodels.test_generated (
+			id INT PRIMARY KEY,
+			price DECIMAL(10, 2) NOT NULL DEFAULT 0,
+			quantity INT,
+			total DECIMAL(10, 2) GENERATED ALWAYS AS (price * quantity) STORED
+		)
+	`)
+	require.NoError(t, err)
+	defer client.Database.Exec(`DROP TABLE classicmodels.test_generated`)
+
+	cols, err := client.GetColumns("test_generated")
+	require.NoError(t, err)
+	byName := make(map[string]Column)
+	for _, col := range cols {
+		byName[col.Field] = col
+	}
+	require.NotNil(t, byName["price"].Default)
+	assert.Equal(t, "0.00", *byName["price"].Default)
+	assert.True(t, byName["total"].IsGenerated)
+	assert.False(t, byName["quantity"].IsGenerated)
+}
+
+func TestBuildSelectByKeys(t *testing.T) {
+	cols := []Column{{Field: "id"}, {Field: "item"}}
+	query, args := buildSelectByKeys("PostgreSQL", "public", "orders", cols, []string{"id"},
+		[][]interface{}{{1}, {2}})
+	assert.Equal(t, `SELECT "id", "item" FROM "public"."orders" WHERE ("id") IN (($1), ($2))`, query)
+	assert.Equal(t, []interface{}{1, 2}, args)
+
+	query, _ = buildSelectByKeys("MySQL", "shop", "lines", cols, []string{"order_id", "line"},
+		[][]interface{}{{1, 1}})
+	assert.Equal(t, "SELECT `id`, `item` FROM `shop`.`lines` WHERE (`order_id`, `line`) IN ((?, ?))", query)
+}
+
+func TestGetRowsByKeysChunked(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE numbers (n INTEGER PRIMARY KEY)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`WITH RECURSIVE seq(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM seq WHERE n < 2000)
+		INSERT INTO numbers SELECT n FROM seq`)
+	require.NoError(t, err)
+
+	keys := make([][]interface{}, 0, 2001)
+	for i := 1; i <= 2001; i++ {
+		keys = append(keys, []interface{}{i})
+	}
+	client := &Client{Type: _sql.SQLite, Database: db}
+	selection, err := client.GetRowsByKeys("numbers", []string{"n"}, keys)
+	require.NoError(t, err)
+	assert.Len(t, selection.Rows, 2000)
+	assert.Equal(t, [][]interface{}{{2001}}, selection.Missing)
+}
+
+func TestFilterWhere(t *testing.T) {
+	filter := Filter{
+		{Column: "status", Operator: "=", Value: "open"},
+		{Column: "id", Operator: "in", Value: []interface{}{1, 2}},
+		{Column: "deleted_at", Operator: "IS NULL"},
+	}
+	where, args, err := filter.Where("PostgreSQL", 3)
+	require.NoError(t, err)
+	assert.Equal(t, `"status" = $3 AND "id" IN ($4, $5) AND "deleted_at" IS NULL`, where)
+	assert.Equal(t, []interface{}{"open", 1, 2}, args)
+
+	_, _, err = Filter{{Column: "id", Operator: "IN", Value: []interface{}{}}}.Where("MySQL", 1)
+	assert.Error(t, err)
+}
+
+func TestFingerprint(t *testing.T) {
+	cols := []Column{{Field: "id", Type: "int"}, {Field: "name", Type: "varchar(50)"}}
+	same := []Column{{Field: "id", Type: "int", Comment: "key"}, {Field: "name", Type: "varchar(50)"}}
+	retyped := []Column{{Field: "id", Type: "bigint"}, {Field: "name", Type: "varchar(50)"}}
+	reordered := []Column{{Field: "name", Type: "varchar(50)"}, {Field: "id", Type: "int"}}
+
+	assert.Equal(t, Fingerprint(cols), Fingerprint(same))
+	assert.NotEqual(t, Fingerprint(cols), Fingerprint(retyped))
+	assert.NotEqual(t, Fingerprint(cols), Fingerprint(reordered))
+}
+
+func TestExportToCSVNullPlaceholder(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT, email TEXT)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO people VALUES (1, 'ada', NULL), (2, NULL, 'alan@example.com')`)
+	require.NoError(t, err)
+
+	tests := []struct {
+		placeholder string
+		want        string
+	}{
+		{"", "id,name,email\n1,ada,\n2,,alan@example.com\n"},
+		{"NULL", "id,name,email\n1,ada,NULL\n2,NULL,alan@example.com\n"},
+		{`\N`, "id,name,email\n1,ada,\\N\n2,\\N,alan@example.com\n"},
+	}
+	for _, tt := range tests {
+		client := &Client{
+			Type:     _sql.SQLite,
+			Schema:   Schema{Name: "main"},
+			Database: db,
+			Nulls:    NullFormat{Placeholder: tt.placeholder},
+		}
+
+		csv, _, err := client.ExportToCSV("people", nil)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, csv, tt.placeholder)
+
+		selection, err := client.GetRowsByKeys("people", []string{"id"}, [][]interface{}{{1}, {2}})
+		require.NoError(t, err)
+		data, err := selection.CSV()
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, string(data), tt.placeholder)
+	}
+}
+
+func TestExportToJsonNullPlaceholder(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE people (id INTEGER PRIMARY KEY, email TEXT)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO people VALUES (1, NULL)`)
+	require.NoError(t, err)
+
+	client := &Client{Type: _sql.SQLite, Schema: Schema{Name: "main"}, Database: db, Nulls: NullFormat{Placeholder: "NULL"}}
+	data, _, err := client.ExportToJson("people", nil)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"email": null`)
+
+	client.Nulls.InJSON = true
+	data, _, err = client.ExportToJson("people", nil)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"email": "NULL"`)
+}
+
+func TestTableBloatClassify(t *testing.T) {
+	tests := []struct {
+		used, free int64
+		severity   string
+	}{
+		{used: 100 << 20, free: 0, severity: BloatNone},
+		{used: 1 << 10, free: 100 << 10, severity: BloatNone},
+		{used: 90 << 20, free: 15 << 20, severity: BloatLow},
+		{used: 60 << 20, free: 30 << 20, severity: BloatMedium},
+		{used: 10 << 20, free: 30 << 20, severity: BloatHigh},
+	}
+	for _, tt := range tests {
+		bloat := &TableBloat{UsedBytes: tt.used, FreeBytes: tt.free}
+		bloat.classify()
+		assert.Equal(t, tt.severity, bloat.Severity, "used %d free %d", tt.used, tt.free)
+	}
+}
+
+func TestGetTableBloatSQLite(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE blobs (id INTEGER PRIMARY KEY, data BLOB)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`WITH RECURSIVE seq(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM seq WHERE n < 2000)
+		INSERT INTO blobs SELECT n, randomblob(2048) FROM seq`)
+	require.NoError(t, err)
+	_, err = db.Exec(`DELETE FROM blobs WHERE id > 200`)
+	require.NoError(t, err)
+
+	client := &Client{Type: _sql.SQLite, Database: db}
+	bloat, err := client.GetTableBloat("blobs")
+	require.NoError(t, err)
+	assert.Equal(t, "database", bloat.Scope)
+	assert.Greater(t, bloat.FreeBytes, int64(1<<20))
+	assert.Greater(t, bloat.Ratio, 0.5)
+	assert.Equal(t, BloatHigh, bloat.Severity)
+
+	_, err = db.Exec(`VACUUM`)
+	require.NoError(t, err)
+	bloat, err = client.GetTableBloat("blobs")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), bloat.FreeBytes)
+	assert.Equal(t, BloatNone, bloat.Severity)
+
+	_, err = client.GetTableBloat("missing")
+	assert.ErrorContains(t, err, "not found")
+}
+
+func TestExportToCSVFloatFormat(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE readings (id INTEGER PRIMARY KEY, value REAL);
+		INSERT INTO readings VALUES (1, 1e22), (2, 3.14159), (3, 0.00000025)`)
+	require.NoError(t, err)
+
+	tests := []struct {
+		floats FloatFormat
+		want   []string
+	}{
+		{FloatFormat{}, []string{"1" + strings.Repeat("0", 22), "3.14159", "0.00000025"}},
+		{FloatFormat{Precision: 2}, []string{"1" + strings.Repeat("0", 22) + ".00", "3.14", "0.00"}},
+		{FloatFormat{Scientific: true}, []string{"1e+22", "3.14159", "2.5e-07"}},
+	}
+	for _, tt := range tests {
+		client := &Client{Type: _sql.SQLite, Schema: Schema{Name: "main"}, Database: db, Floats: tt.floats}
+		want := "id,value\n1," + tt.want[0] + "\n2," + tt.want[1] + "\n3," + tt.want[2] + "\n"
+
+		csv, _, err := client.ExportToCSV("readings", nil)
+		require.NoError(t, err)
+		assert.Equal(t, want, csv, "%+v", tt.floats)
+		if !tt.floats.Scientific {
+			assert.NotContains(t, csv, "e+")
+			assert.NotContains(t, csv, "e-")
+		}
+
+		selection, err := client.GetRowsByKeys("readings", []string{"id"}, [][]interface{}{{1}, {2}, {3}})
+		require.NoError(t, err)
+		data, err := selection.CSV()
+		require.NoError(t, err)
+		assert.Equal(t, want, string(data), "%+v", tt.floats)
+	}
+}
+
+func TestExportToCSVFileQuoting(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE notes (id INTEGER PRIMARY KEY, body TEXT)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO notes VALUES (1, 'milk, eggs'), (2, 'line one
+line two'), (3, 'say "hi"')`)
+	require.NoError(t, err)
+
+	client := &Client{Type: _sql.SQLite, Schema: Schema{Name: "main"}, Database: db}
+	n, err := client.ExportToCSVFile(context.Background(), "notes")
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join(home, "sqlweb", "notes.csv"))
+	require.NoError(t, err)
+	assert.Equal(t, len(data), n)
+
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"id", "body"},
+		{"1", "milk, eggs"},
+		{"2", "line one\nline two"},
+		{"3", `say "hi"`},
+	}, records)
+}
+
+func TestGetColumnDependenciesSQLite(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`
+		CREATE TABLE customers (id INTEGER PRIMARY KEY, email TEXT, name TEXT);
+		CREATE TABLE orders (id INTEGER PRIMARY KEY, customer_id INTEGER REFERENCES customers (id));
+		CREATE VIEW customer_emails AS SELECT id, email FROM customers;
+		CREATE VIEW customer_names AS SELECT id, name FROM customers;
+	`)
+	require.NoError(t, err)
+
+	client := &Client{Type: _sql.SQLite, Database: db}
+	deps, err := client.GetColumnDependencies("customers", "email")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"customer_emails"}, deps.Views)
+	assert.Empty(t, deps.ForeignKeys)
+
+	deps, err = client.GetColumnDependencies("customers", "id")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"customer_emails", "customer_names"}, deps.Views)
+	assert.Equal(t, []ForeignKeyRef{{Table: "orders", Column: "customer_id"}}, deps.ForeignKeys)
+}
+
+func TestGetReferencingTablesSQLite(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`
+		CREATE TABLE customers (id INTEGER PRIMARY KEY, region TEXT, UNIQUE (id, region));
+		CREATE TABLE orders (id INTEGER PRIMARY KEY, customer_id INTEGER REFERENCES customers ON DELETE CASCADE);
+		CREATE TABLE invoices (
+			id INTEGER PRIMARY KEY, customer_id INTEGER, region TEXT,
+			FOREIGN KEY (customer_id, region) REFERENCES customers (id, region)
+		);
+		CREATE TABLE notes (id INTEGER PRIMARY KEY);
+	`)
+	require.NoError(t, err)
+
+	client := &Client{Type: _sql.SQLite, Database: db}
+	refs, err := client.GetReferencingTables("customers")
+	require.NoError(t, err)
+	assert.Equal(t, []ReferencingTable{
+		{
+			FromTable: "invoices", FromColumns: []string{"customer_id", "region"},
+			ToColumns: []string{"id", "region"}, OnDelete: "NO ACTION",
+		},
+		{FromTable: "orders", FromColumns: []string{"customer_id"}, ToColumns: []string{}, OnDelete: "CASCADE"},
+	}, refs)
+
+	refs, err = client.GetReferencingTables("notes")
+	require.NoError(t, err)
+	assert.Empty(t, refs)
+}
+
+func TestGetTablesLastModifiedSQLite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE orders (id INTEGER PRIMARY KEY)`)
+	require.NoError(t, err)
+
+	before := time.Now().Add(-time.Minute)
+	client := &Client{Type: _sql.SQLite, Database: db, Path: path}
+	modified, err := client.GetTableLastModified("orders")
+	require.NoError(t, err)
+	require.NotNil(t, modified)
+	require.NotNil(t, modified.At)
+	assert.True(t, modified.At.After(before))
+	assert.True(t, modified.Approximate)
+
+	modified, err = client.GetTableLastModified("missing")
+	require.NoError(t, err)
+	assert.Nil(t, modified)
+
+	assert.Nil(t, sqliteFileModTime(":memory:"))
+	assert.Nil(t, sqliteFileModTime("file::memory:?cache=shared"))
+}
+
+func TestListTablesSQLite(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT);
+		CREATE VIEW people_names AS SELECT name FROM people`)
+	require.NoError(t, err)
+
+	client := &Client{Type: _sql.SQLite, Schema: Schema{Name: "main"}, Database: db}
+	tables, err := client.ListTables()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []TableInfo{{Name: "people"}, {Name: "people_names", IsView: true}}, tables)
+
+	isView, err := client.IsView("people_names")
+	require.NoError(t, err)
+	assert.True(t, isView)
+	isView, err = client.IsView("people")
+	require.NoError(t, err)
+	assert.False(t, isView)
+	isView, err = client.IsView("missing")
+	require.NoError(t, err)
+	assert.False(t, isView)
+}
+
+func TestGetViewDefinitionSQLite(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT);
+		CREATE VIEW people_names AS SELECT name FROM people WHERE name IS NOT NULL`)
+	require.NoError(t, err)
+
+	client := &Client{Type: _sql.SQLite, Schema: Schema{Name: "main"}, Database: db}
+	definition, err := client.GetViewDefinition("people_names")
+	require.NoError(t, err)
+	assert.Equal(t, "CREATE VIEW people_names AS SELECT name FROM people WHERE name IS NOT NULL", definition)
+
+	_, err = client.GetViewDefinition("people")
+	assert.Error(t, err)
+
+	views, err := client.GetViews()
+	require.NoError(t, err)
+	assert.Equal(t, []View{{Name: "people_names", Definition: definition}}, views)
+}
+
+func TestGetRoutinesMySQL(t *testing.T) {
+	client, err := SetupMySQLConnection()
+	require.NoError(t, err, "Failed to set up MySQL connection")
+	defer client.Database.Close()
+	_, err = client.Database.Exec(`DROP FUNCTION IF EXISTS sqlweb_double`)
+	require.NoError(t, err)
+	_, err = client.Database.Exec(`CREATE FUNCTION sqlweb_double(n INT) RETURNS INT DETERMINISTIC RETURN n * 2`)
+	require.NoError(t, err)
+	defer client.Database.Exec(`DROP FUNCTION sqlweb_double`)
+
+	routines, err := client.GetRoutines()
+	require.NoError(t, err)
+	var found *Routine
+	for i := range routines {
+		if routines[i].Name == "sqlweb_double" {
+			found = &routines[i]
+		}
+	}
+	require.NotNil(t, found)
+	assert.Equal(t, "FUNCTION", found.Type)
+	assert.Contains(t, found.Definition, "n * 2")
+}
+
+func TestGetRoutinesSQLite(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	client := &Client{Type: _sql.SQLite, Schema: Schema{Name: "main"}, Database: db}
+	routines, err := client.GetRoutines()
+	require.NoError(t, err)
+	assert.Empty(t, routines)
+	assert.NotNil(t, routines)
+}
+
+func TestGetCharsetsMySQL(t *testing.T) {
+	client, err := SetupMySQLConnection()
+	require.NoError(t, err, "Failed to set up MySQL connection")
+	defer client.Database.Close()
+
+	charsets, err := client.GetCharsets()
+	require.NoError(t, err)
+	assert.NotEmpty(t, charsets.Charsets)
+	assert.NotEmpty(t, charsets.Collations)
+	names := make([]string, 0, len(charsets.Charsets))
+	for _, charset := range charsets.Charsets {
+		names = append(names, charset.Name)
+	}
+	assert.Contains(t, names, "utf8mb4")
+}
+
+func TestGetCharsetsSQLite(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	client := &Client{Type: _sql.SQLite, Database: db}
+	charsets, err := client.GetCharsets()
+	require.NoError(t, err)
+	assert.Empty(t, charsets.Charsets)
+	assert.Contains(t, charsets.Collations, Collation{Name: "NOCASE"})
+	assert.Contains(t, charsets.Collations, Collation{Name: "BINARY", IsDefault: true})
+}
+
+func TestCellLimitValue(t *testing.T) {
+	limit := CellLimit{MaxChars: 10}
+
+	value, truncated := limit.Value([]byte("short"))
+	assert.False(t, truncated)
+	assert.Equal(t, "short", value)
+
+	value, truncated = limit.Value(int64(12345678901))
+	assert.False(t, truncated)
+	assert.Equal(t, int64(12345678901), value)
+
+	// characters are counted, not bytes
+	value, truncated = limit.Value("éééééééééé")
+	assert.False(t, truncated)
+	assert.Equal(t, "éééééééééé", value)
+
+	value, truncated = limit.Value([]byte("ééééééééééé"))
+	assert.True(t, truncated)
+	assert.Equal(t, &TruncatedCell{Truncated: true, Bytes: 22, Preview: "éééééééééé…"}, value)
+
+	big := strings.Repeat("ü", 10000)
+	value, truncated = CellLimit{MaxChars: 5000}.Value(big)
+	assert.True(t, truncated)
+	assert.Equal(t, strings.Repeat("ü", cellPreviewChars)+"…", value.(*TruncatedCell).Preview)
+
+	value, truncated = CellLimit{}.Value(big)
+	assert.False(t, truncated)
+	assert.Equal(t, big, value)
+}
+
+func TestWideTextTruncatedInBrowseOnly(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	long := strings.Repeat("lorem ipsum ", 50)
+	_, err = db.Exec(`CREATE TABLE articles (id INTEGER PRIMARY KEY, body TEXT, summary TEXT)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO articles VALUES (1, ?, 'short')`, long)
+	require.NoError(t, err)
+
+	client := &Client{
+		Type: _sql.SQLite, Schema: Schema{Name: "main"}, Database: db,
+		Cells: CellLimit{MaxChars: 100, FullExports: true},
+	}
+	table, err := client.GetTable("articles", 1, 10)
+	require.NoError(t, err)
+	require.Len(t, table.Data, 1)
+	assert.Equal(t, &TruncatedCell{Truncated: true, Bytes: len(long), Preview: long[:100] + "…"}, table.Data[0]["body"])
+	assert.Equal(t, "short", table.Data[0]["summary"])
+	assert.Equal(t, []CellWarning{{Row: 0, Column: "body", Bytes: len(long)}}, table.Warnings)
+
+	data, _, err := client.ExportToJson("articles", nil)
+	require.NoError(t, err)
+	var exported []map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &exported))
+	assert.Equal(t, long, exported[0]["body"])
+
+	csvData, _, err := client.ExportToCSV("articles", nil)
+	require.NoError(t, err)
+	assert.Contains(t, csvData, long)
+
+	// truncation is off without a limit
+	client.Cells = CellLimit{}
+	table, err = client.GetTable("articles", 1, 10)
+	require.NoError(t, err)
+	assert.Equal(t, long, table.Data[0]["body"])
+}
+
+func TestUnreadableCell(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	// 9e999 overflows to +Inf, which JSON cannot encode
+	_, err = db.Exec(`CREATE TABLE measures (id INTEGER PRIMARY KEY, value REAL, label TEXT);
+		INSERT INTO measures VALUES (1, 9e999, 'overflow'), (2, 1.5, 'fine')`)
+	require.NoError(t, err)
+
+	client := &Client{Type: _sql.SQLite, Schema: Schema{Name: "main"}, Database: db}
+	table, err := client.GetTable("measures", 1, 10)
+	require.NoError(t, err)
+	require.Len(t, table.Data, 2)
+	unreadable, ok := table.Data[0]["value"].(*UnreadableCell)
+	require.True(t, ok, "%#v", table.Data[0]["value"])
+	assert.Equal(t, "float64", unreadable.Type)
+	assert.Equal(t, int64(1), table.Data[0]["id"])
+	assert.Equal(t, "overflow", table.Data[0]["label"])
+	assert.Equal(t, 1.5, table.Data[1]["value"])
+
+	encoded, err := json.Marshal(table.Data)
+	require.NoError(t, err)
+	assert.Contains(t, string(encoded), `"value":{"unreadable":true,"type":"float64","error":"json: unsupported value: +Inf"}`)
+
+	data, _, err := client.ExportToJson("measures", nil)
+	require.NoError(t, err)
+	var exported []map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &exported))
+	assert.Equal(t, "overflow", exported[0]["label"])
+	assert.Equal(t, true, exported[0]["value"].(map[string]interface{})["unreadable"])
+
+	assert.Equal(t, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), readable("day", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)))
+	assert.IsType(t, &UnreadableCell{}, readable("day", time.Date(12024, 1, 2, 0, 0, 0, 0, time.UTC)))
+}
+
+func TestResultBudget(t *testing.T) {
+	// the estimate matches the encoding of the values rows are read as
+	values := []interface{}{nil, "a \"quoted\" text", true, int64(-42), 3.25, time.Date(2024, 1, 2, 3, 4, 5, 6, time.FixedZone("", 3*3600))}
+	for _, value := range values {
+		encoded, err := json.Marshal(value)
+		require.NoError(t, err)
+		assert.InDelta(t, len(encoded), encodedSize(value), 4, "%v", value)
+	}
+
+	assert.Nil(t, CellLimit{}.Budget())
+	assert.NoError(t, CellLimit{}.Budget().Charge("id", int64(1)))
+
+	budget := CellLimit{MaxResultBytes: 32}.Budget()
+	require.NoError(t, budget.Charge("name", "ada"))
+	require.NoError(t, budget.Charge("name", "grace"))
+	err := budget.Charge("name", "linus")
+	assert.ErrorIs(t, err, util.ErrResultTooLarge)
+
+	// exports are not bounded
+	assert.Nil(t, CellLimit{MaxChars: 10, MaxResultBytes: 32}.export().Budget())
+}
+
+func TestMentionsIdentifier(t *testing.T) {
+	assert.True(t, MentionsIdentifier("SELECT email FROM customers", "email"))
+	assert.True(t, MentionsIdentifier("SELECT `EMAIL` FROM customers", "email"))
+	assert.True(t, MentionsIdentifier(`SELECT c."email" FROM customers c`, "email"))
+	assert.False(t, MentionsIdentifier("SELECT email_verified FROM customers", "email"))
+	assert.False(t, MentionsIdentifier("SELECT work_email FROM customers", "email"))
+}
+
+// setupWideTable creates a table with the given number of TEXT columns and rows.
+func setupWideTable(tb testing.TB, columns, rows int) *sql.DB {
+	db, err := sql.Open("sqlite3", filepath.Join(tb.TempDir(), "test.db"))
+	require.NoError(tb, err)
+	tb.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	defs := make([]string, columns)
+	values := make([]string, columns)
+	for i := range defs {
+		defs[i] = fmt.Sprintf("c%d TEXT", i)
+		values[i] = fmt.Sprintf("'value %d'", i)
+	}
+	_, err = db.Exec(fmt.Sprintf(`CREATE TABLE wide (id INTEGER PRIMARY KEY, %s)`, strings.Join(defs, ", ")))
+	require.NoError(tb, err)
+	_, err = db.Exec(fmt.Sprintf(`WITH RECURSIVE seq(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM seq WHERE n < %d)
+		INSERT INTO wide SELECT n, %s FROM seq`, rows, strings.Join(values, ", ")))
+	require.NoError(tb, err)
+	return db
+}
+
+func TestGetRowSetHelper(t *testing.T) {
+	db := setupWideTable(t, 3, 600)
+
+	rowSet, _, err := getRowSetHelper(context.Background(), `SELECT * FROM wide ORDER BY id`, db, CellLimit{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"id", "c0", "c1", "c2"}, rowSet.Columns)
+	require.Len(t, rowSet.Rows, 600)
+	assert.Equal(t, []interface{}{int64(1), "value 0", "value 1", "value 2"}, rowSet.Rows[0])
+	assert.Equal(t, []interface{}{int64(600), "value 0", "value 1", "value 2"}, rowSet.Rows[599])
+
+	data, _, err := getTableHelper(context.Background(), `SELECT * FROM wide ORDER BY id`, db, CellLimit{})
+	require.NoError(t, err)
+	for i, row := range data.Maps() {
+		for j, column := range rowSet.Columns {
+			assert.Equal(t, row[column], rowSet.Rows[i][j])
+		}
+	}
+}
+
+// readRowMaps reads the rows of the query into a map per row, the way results were read before Rows,
+// to compare the allocations of both.
+func readRowMaps(db *sql.DB, query string) ([]Row, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	columns, _ = DistinctColumns(columns)
+	var results []Row
+	values := make([]interface{}, len(columns))
+	valuePtrs := make([]interface{}, len(columns))
+	for rows.Next() {
+		row := make(Row, len(columns))
+		for i := range columns {
+			valuePtrs[i] = &values[i]
+		}
+		if err = rows.Scan(valuePtrs...); err != nil {
+			return nil, err
+		}
+		for i, col := range columns {
+			row[col], _ = CellLimit{}.Value(values[i])
+		}
+		results = append(results, row)
+	}
+	return results, rows.Err()
+}
+
+func TestRowsMarshalLikeMaps(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE samples (id INTEGER, name TEXT, score REAL, payload BLOB, active BOOLEAN, created DATETIME, mixed)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO samples VALUES
+		(1, '<b>&amp;</b>', 1.5, x'00ff', 1, '2024-01-02 03:04:05', 42),
+		(2, 'quote " \ tab' || char(9) || char(31), 1e-7, NULL, 0, NULL, 'text'),
+		(3, 'ünï 😀' || char(8232) || char(8233), 1e21, x'68', NULL, '2024-06-30 23:59:59.5', 2.5),
+		(NULL, NULL, NULL, NULL, NULL, NULL, NULL),
+		(5, CAST(x'ff41' AS TEXT), -0.000001, x'', 1, '2000-02-29', 9007199254740993)`)
+	require.NoError(t, err)
+
+	for _, query := range []string{
+		`SELECT * FROM samples`,
+		// columns of the same name are told apart
+		`SELECT id AS a, name AS a, mixed AS a, score FROM samples`,
+		`SELECT * FROM samples WHERE id < 0`,
+	} {
+		maps, err := readRowMaps(db, query)
+		require.NoError(t, err)
+		data, _, err := getTableHelper(context.Background(), query, db, CellLimit{})
+		require.NoError(t, err)
+		assert.Equal(t, maps, data.Maps(), query)
+
+		for _, marshal := range []func(interface{}) ([]byte, error){
+			json.Marshal,
+			func(v interface{}) ([]byte, error) { return json.MarshalIndent(v, "", "\t") },
+			func(v interface{}) ([]byte, error) {
+				var buffer bytes.Buffer
+				encoder := json.NewEncoder(&buffer)
+				encoder.SetEscapeHTML(false)
+				err := encoder.Encode(v)
+				return buffer.Bytes(), err
+			},
+		} {
+			want, err := marshal(maps)
+			require.NoError(t, err)
+			got, err := marshal(data)
+			require.NoError(t, err)
+			assert.Equal(t, string(want), string(got), query)
+		}
+
+		var decoded *Rows
+		encoded, err := json.Marshal(data)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(encoded, &decoded))
+		reencoded, err := json.Marshal(decoded)
+		require.NoError(t, err)
+		assert.JSONEq(t, string(encoded), string(reencoded))
+	}
+}
+
+func TestDistinctColumns(t *testing.T) {
+	names, renamed := DistinctColumns([]string{"id", "name"})
+	assert.Equal(t, []string{"id", "name"}, names)
+	assert.Nil(t, renamed)
+
+	// id_2 is taken by a column of the result, so the second id is id_3
+	names, renamed = DistinctColumns([]string{"id", "name", "id", "id_2", "name", "id"})
+	assert.Equal(t, []string{"id", "name", "id_3", "id_2", "name_2", "id_4"}, names)
+	assert.Equal(t, []ColumnRename{
+		{Index: 2, Column: "id", Name: "id_3"},
+		{Index: 4, Column: "name", Name: "name_2"},
+		{Index: 5, Column: "id", Name: "id_4"},
+	}, renamed)
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE authors (id INTEGER PRIMARY KEY, name TEXT);
+		CREATE TABLE books (id INTEGER PRIMARY KEY, author INTEGER, name TEXT);
+		INSERT INTO authors VALUES (1, 'ada');
+		INSERT INTO books VALUES (7, 1, 'notes')`)
+	require.NoError(t, err)
+	query := `SELECT a.id, b.id, a.name, b.name FROM authors a JOIN books b ON b.author = a.id`
+
+	data, _, err := getTableHelper(context.Background(), query, db, CellLimit{})
+	require.NoError(t, err)
+	assert.Equal(t, Row{"id": int64(1), "id_2": int64(7), "name": "ada", "name_2": "notes"}, data.Row(0))
+	assert.Equal(t, []ColumnRename{{Index: 1, Column: "id", Name: "id_2"}, {Index: 3, Column: "name", Name: "name_2"}}, data.Renamed())
+
+	rowSet, _, err := getRowSetHelper(context.Background(), query, db, CellLimit{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"id", "id_2", "name", "name_2"}, rowSet.Columns)
+	assert.Equal(t, data.Renamed(), rowSet.Renamed)
+
+	// exports use the same headers
+	rows, err := db.Query(query)
+	require.NoError(t, err)
+	defer rows.Close()
+	csv, err := sqlToCsv(rows, NullFormat{}, FloatFormat{}, CellLimit{})
+	require.NoError(t, err)
+	assert.Equal(t, "id,id_2,name,name_2\n1,7,ada,notes\n", csv)
+
+	var buffer bytes.Buffer
+	rows, err = db.Query(query)
+	require.NoError(t, err)
+	defer rows.Close()
+	require.NoError(t, writeRowsJSON(&buffer, rows, NullFormat{}, CellLimit{}, nil))
+	assert.JSONEq(t, `[{"id": 1, "id_2": 7, "name": "ada", "name_2": "notes"}]`, buffer.String())
+}
+
+// TestRowsAllocations checks that reading rows into Rows and encoding them, as /table, /execute and the JSON
+// export do, allocates at most half of what maps do.
+func TestRowsAllocations(t *testing.T) {
+	db := setupWideTable(t, 50, 200)
+	query := `SELECT * FROM wide`
+
+	maps := testing.AllocsPerRun(5, func() {
+		rows, err := readRowMaps(db, query)
+		require.NoError(t, err)
+		_, err = json.Marshal(rows)
+		require.NoError(t, err)
+	})
+	columnar := testing.AllocsPerRun(5, func() {
+		data, _, err := getTableHelper(context.Background(), query, db, CellLimit{})
+		require.NoError(t, err)
+		_, err = json.Marshal(data)
+		require.NoError(t, err)
+	})
+	t.Logf("allocations per row: %.1f with maps, %.1f with Rows", maps/200, columnar/200)
+	assert.LessOrEqual(t, columnar, maps/2)
+}
+
+func BenchmarkGetTableHelper(b *testing.B) {
+	db := setupWideTable(b, 100, 2000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := getTableHelper(context.Background(), `SELECT * FROM wide`, db, CellLimit{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReadRowMaps(b *testing.B) {
+	db := setupWideTable(b, 100, 2000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := readRowMaps(db, `SELECT * FROM wide`); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkTableJSON reads and encodes the rows, as the JSON export does.
+func BenchmarkTableJSON(b *testing.B) {
+	db := setupWideTable(b, 100, 2000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		data, _, err := getTableHelper(context.Background(), `SELECT * FROM wide`, db, CellLimit{})
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err = json.Marshal(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkTableJSONMaps(b *testing.B) {
+	db := setupWideTable(b, 100, 2000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rows, err := readRowMaps(db, `SELECT * FROM wide`)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err = json.Marshal(rows); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetTableHelperRowSet(b *testing.B) {
+	db := setupWideTable(b, 100, 2000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := getRowSetHelper(context.Background(), `SELECT * FROM wide`, db, CellLimit{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestGetTableSQLiteIdentifierCase(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE "People" ("Id" INTEGER PRIMARY KEY, "Full Name" TEXT)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO "People" VALUES (1, 'Ada Lovelace')`)
+	require.NoError(t, err)
+
+	client := &Client{Type: _sql.SQLite, Schema: Schema{Name: "main"}, Database: db}
+	table, err := client.GetTable("PEOPLE", 1, 10)
+	require.NoError(t, err)
+	assert.Equal(t, "People", table.Name)
+	require.Len(t, table.Data, 1)
+	assert.Equal(t, "Ada Lovelace", table.Data[0]["Full Name"])
+
+	// the cache is shared by every casing of the table name
+	cols, err := client.GetCachedColumns("main", "people")
+	require.NoError(t, err)
+	assert.Equal(t, table.Columns, cols)
+
+	column, err := client.StoredColumnName("people", "full name")
+	require.NoError(t, err)
+	assert.Equal(t, "Full Name", column)
+
+	name, err := client.StoredTableName("missing")
+	require.NoError(t, err)
+	assert.Equal(t, "missing", name)
+}
+
+func TestGetSchemasSQLite(t *testing.T) {
+	dir := t.TempDir()
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "main.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	// attached databases belong to the connection they were attached on
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(`ATTACH DATABASE ? AS archive`, filepath.Join(dir, "archive.db"))
+	require.NoError(t, err)
+
+	client := &Client{Type: _sql.SQLite, Database: db}
+	names, err := client.GetSchemaNames()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"main", "archive"}, names)
+
+	schemas, err := client.GetSchemas()
+	require.NoError(t, err)
+	require.Len(t, schemas, 2)
+	assert.Equal(t, "main", schemas[0].Name)
+	assert.Equal(t, filepath.Join(dir, "main.db"), schemas[0].File)
+	assert.Equal(t, SchemaInfo{Name: "archive", File: filepath.Join(dir, "archive.db")}, schemas[1])
+
+	client.Type = _sql.Unsupported
+	_, err = client.GetSchemaNames()
+	assert.Error(t, err)
+}
+
+// schemaObjects returns the stored SQL of every table, index and trigger, keyed by type and name.
+func schemaObjects(t *testing.T, db *sql.DB) map[string]string {
+	rows, err := db.Query(`SELECT type, name, sql FROM sqlite_master WHERE sql IS NOT NULL`)
+	require.NoError(t, err)
+	defer rows.Close()
+	objects := make(map[string]string)
+	for rows.Next() {
+		var kind, name, definition string
+		require.NoError(t, rows.Scan(&kind, &name, &definition))
+		objects[kind+" "+name] = definition
+	}
+	require.NoError(t, rows.Err())
+	return objects
+}
+
+func TestCreateStatementsReplaySQLite(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`
+		CREATE TABLE products (id INTEGER PRIMARY KEY, name TEXT, updated_at TEXT);
+		CREATE INDEX products_name ON products (name);
+		CREATE TRIGGER products_touch AFTER UPDATE ON products
+		BEGIN
+			UPDATE products SET updated_at = 'now' WHERE id = NEW.id;
+		END;
+	`)
+	require.NoError(t, err)
+	before := schemaObjects(t, db)
+
+	client := &Client{Type: _sql.SQLite, Database: db}
+	statements, err := client.GetCreateStatements()
+	require.NoError(t, err)
+	bundle := statements["products"]
+	assert.Contains(t, bundle, "CREATE INDEX products_name")
+	assert.Contains(t, bundle, "CREATE TRIGGER products_touch")
+
+	_, err = db.Exec(`DROP TABLE products`)
+	require.NoError(t, err)
+	require.Empty(t, schemaObjects(t, db))
+
+	_, err = db.Exec(bundle)
+	require.NoError(t, err)
+	assert.Equal(t, before, schemaObjects(t, db))
+}
+
+func TestCreateStatementsReplayMySQL(t *testing.T) {
+	client, err := SetupMySQLConnection()
+	require.NoError(t, err, "Failed to set up MySQL connection")
+	defer client.Database.Close()
+
+	script, err := _conn.ConnectForScript(&_conn.Connection{
+		Host:     client.Host,
+		Port:     client.Port,
+		User:     client.User,
+		Password: client.Password,
+		Name:     client.Name,
+		Type:     client.Type,
+	})
+	require.NoError(t, err)
+	defer script.Close()
+
+	_, err = script.Exec(`
+		CREATE TABLE test_replay (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			name VARCHAR(50),
+			updated_at DATETIME,
+			KEY test_replay_name (name)
+		);
+		CREATE TRIGGER test_replay_touch BEFORE UPDATE ON test_replay
+		FOR EACH ROW SET NEW.updated_at = NOW();
+	`)
+	require.NoError(t, err)
+	defer client.Database.Exec(`DROP TABLE IF EXISTS test_replay`)
+
+	statements, err := client.GetCreateStatements()
+	require.NoError(t, err)
+	before := statements["test_replay"]
+	assert.Contains(t, before, "KEY `test_replay_name`")
+	assert.Contains(t, before, "TRIGGER `test_replay_touch`")
+
+	_, err = client.Database.Exec(`DROP TABLE test_replay`)
+	require.NoError(t, err)
+	_, err = script.Exec(before)
+	require.NoError(t, err)
+
+	statements, err = client.GetCreateStatements()
+	require.NoError(t, err)
+	assert.Equal(t, before, statements["test_replay"])
+}
+
+// exportFiles lists the files in the export directory under home.
+func exportFiles(t *testing.T, home string) []string {
+	entries, err := os.ReadDir(filepath.Join(home, "sqlweb"))
+	require.NoError(t, err)
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+// sqliteConnector opens a database with a driver that is not registered, e.g. one with custom functions.
+type sqliteConnector struct {
+	dsn    string
+	driver *sqlite3.SQLiteDriver
+}
+
+func (c *sqliteConnector) Connect(context.Context) (driver.Conn, error) { return c.driver.Open(c.dsn) }
+
+func (c *sqliteConnector) Driver() driver.Driver { return c.driver }
+
+func TestExportToCSVFileCancelled(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// cancel_at cancels the export while the rows are being read
+	db := sql.OpenDB(&sqliteConnector{
+		dsn: filepath.Join(t.TempDir(), "test.db"),
+		driver: &sqlite3.SQLiteDriver{
+			ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+				return conn.RegisterFunc("cancel_at", func(id int64) int64 {
+					if id == 100 {
+						cancel()
+					}
+					return id
+				}, false)
+			},
+		},
+	})
+	defer db.Close()
+	_, err := db.Exec(`
+		CREATE TABLE numbers (id INTEGER PRIMARY KEY, padding TEXT);
+		WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 20000)
+		INSERT INTO numbers SELECT i, hex(randomblob(32)) FROM n;
+		CREATE VIEW slow_numbers AS SELECT cancel_at(id) AS id, padding FROM numbers;
+	`)
+	require.NoError(t, err)
+
+	client := &Client{Type: _sql.SQLite, Schema: Schema{Name: "main"}, Database: db}
+	_, err = client.ExportToCSVFile(ctx, "slow_numbers")
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, exportFiles(t, home))
+}
+
+func TestExportToCSVFileFailsMidway(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`
+		CREATE TABLE numbers (id INTEGER PRIMARY KEY, padding TEXT);
+		WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 5000)
+		INSERT INTO numbers SELECT i, hex(randomblob(32)) FROM n;
+		CREATE VIEW broken AS
+			SELECT id, CASE WHEN id = 4000 THEN abs(-9223372036854775808) ELSE 0 END AS overflow, padding FROM numbers;
+	`)
+	require.NoError(t, err)
+	client := &Client{Type: _sql.SQLite, Schema: Schema{Name: "main"}, Database: db}
+
+	// an earlier export is kept when a later one fails
+	require.NoError(t, os.MkdirAll(filepath.Join(home, "sqlweb"), os.ModePerm))
+	previous := filepath.Join(home, "sqlweb", "broken.csv")
+	require.NoError(t, os.WriteFile(previous, []byte("id\n1\n"), 0666))
+
+	_, err = client.ExportToCSVFile(context.Background(), "broken")
+	require.Error(t, err)
+	assert.Equal(t, []string{"broken.csv"}, exportFiles(t, home))
+	data, err := os.ReadFile(previous)
+	require.NoError(t, err)
+	assert.Equal(t, "id\n1\n", string(data))
+
+	// a successful export replaces it
+	n, err := client.ExportToCSVFile(context.Background(), "numbers")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"broken.csv", "numbers.csv"}, exportFiles(t, home))
+	info, err := os.Stat(filepath.Join(home, "sqlweb", "numbers.csv"))
+	require.NoError(t, err)
+	assert.Equal(t, info.Size(), int64(n))
+	// exports may hold anything the database does, so only their owner can read them
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestAbortPartialFiles(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	file, err := createPartial("dump.sql")
+	require.NoError(t, err)
+	_, err = file.WriteString("CREATE TABLE")
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(file.Name(), partialSuffix))
+
+	AbortPartialFiles()
+	assert.Empty(t, exportFiles(t, home))
+	assert.Error(t, file.commit())
+	assert.Empty(t, exportFiles(t, home))
+}
+
+func TestSweepPartialFiles(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	dir := filepath.Join(home, "sqlweb")
+	require.NoError(t, os.MkdirAll(dir, os.ModePerm))
+
+	stale := filepath.Join(dir, "people.csv.123"+partialSuffix)
+	fresh := filepath.Join(dir, "orders.csv.456"+partialSuffix)
+	for _, name := range []string{stale, fresh, filepath.Join(dir, "people.csv")} {
+		require.NoError(t, os.WriteFile(name, []byte("id\n"), 0666))
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	require.NoError(t, os.Chtimes(stale, old, old))
+
+	removed, err := SweepPartialFiles(24 * time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	assert.Equal(t, []string{"orders.csv.456" + partialSuffix, "people.csv"}, exportFiles(t, home))
+}
+
+func TestExportWithTemplate(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT, email TEXT, age INTEGER)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO people VALUES (1, 'ada', 'ada@example.com', 36), (2, 'alan', NULL, 41), (3, 'grace', 'grace@example.com', 85)`)
+	require.NoError(t, err)
+	client := &Client{Type: _sql.SQLite, Schema: Schema{Name: "main"}, Database: db}
+
+	template := ExportTemplate{
+		Name:    "adults",
+		Table:   "people",
+		Columns: []TemplateColumn{{Source: "email", Header: "Email"}, {Source: "name"}},
+		Format:  TemplateCSV,
+		Filter:  Filter{{Column: "age", Operator: "<", Value: 50}},
+	}
+	var out bytes.Buffer
+	require.NoError(t, client.ExportWithTemplate(context.Background(), &template, nil, &out))
+	assert.Equal(t, "Email,name\nada@example.com,ada\n,alan\n", out.String())
+
+	template.Format = TemplateJSON
+	out.Reset()
+	require.NoError(t, client.ExportWithTemplate(context.Background(), &template, nil, &out))
+	assert.Equal(t, "[\n\t{\"Email\": \"ada@example.com\", \"name\": \"ada\"},\n\t{\"Email\": null, \"name\": \"alan\"}\n]", out.String())
+
+	_, err = db.Exec(`ALTER TABLE people DROP COLUMN email`)
+	require.NoError(t, err)
+	out.Reset()
+	err = client.ExportWithTemplate(context.Background(), &template, nil, &out)
+	require.EqualError(t, err, `template "adults": column "email" no longer exists in table "people"`)
+	assert.Empty(t, out.String())
+
+	template.Columns = []TemplateColumn{{Source: "name", Header: "n"}, {Source: "id", Header: "n"}}
+	assert.EqualError(t, template.Validate(), `template "adults": header "n" is used twice`)
+}
+
+func TestExportExcludedColumns(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT, email TEXT, ssn TEXT)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO people VALUES (1, 'ada', 'ada@example.com', '123-45-6789')`)
+	require.NoError(t, err)
+	client := &Client{
+		Type:     _sql.SQLite,
+		Schema:   Schema{Name: "main"},
+		Database: db,
+		Settings: _conn.Settings{ExportExcludedColumns: []string{"people.ssn"}},
+	}
+
+	csvData, omitted, err := client.ExportToCSV("people", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ssn"}, omitted)
+	assert.Equal(t, "id,name,email\n1,ada,ada@example.com\n", csvData)
+
+	data, omitted, err := client.ExportToJson("people", []string{"EMAIL"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"email", "ssn"}, omitted)
+	assert.NotContains(t, string(data), "ssn")
+	assert.NotContains(t, string(data), "ada@example.com")
+
+	_, _, err = client.ExportColumns("people", []string{"phone"})
+	assert.EqualError(t, err, "cannot exclude column 'phone': not found in table 'people'")
+	_, _, err = client.ExportColumns("people", []string{"id", "name", "email"})
+	assert.EqualError(t, err, "every column of table 'people' is excluded from exports")
+
+	err = client.CheckExportPolicy("people", []string{"name", "ssn"})
+	assert.ErrorIs(t, err, util.ErrPolicyViolation)
+
+	template := ExportTemplate{
+		Name:    "contacts",
+		Table:   "people",
+		Columns: []TemplateColumn{{Source: "name"}, {Source: "ssn"}},
+		Format:  TemplateCSV,
+	}
+	var out bytes.Buffer
+	err = client.ExportWithTemplate(context.Background(), &template, nil, &out)
+	assert.ErrorIs(t, err, util.ErrPolicyViolation)
+	assert.Empty(t, out.String())
+
+	template.Columns = []TemplateColumn{{Source: "name"}, {Source: "email"}}
+	require.NoError(t, client.ExportWithTemplate(context.Background(), &template, []string{"email"}, &out))
+	assert.Equal(t, "name\nada\n", out.String())
+
+	template.Columns = []TemplateColumn{{Source: "name"}}
+	err = client.ExportWithTemplate(context.Background(), &template, []string{"email"}, &out)
+	assert.EqualError(t, err, `template "contacts": cannot exclude column "email", the template does not export it`)
+}
+
+func TestSearchTableLikeSQLite(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE notes (id INTEGER PRIMARY KEY, title TEXT, body TEXT)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO notes VALUES
+		(1, 'Groceries', 'milk and eggs'),
+		(2, 'Work', 'send the 100% report'),
+		(3, 'MILK run', NULL),
+		(4, 'Other', 'nothing here')`)
+	require.NoError(t, err)
+
+	client := &Client{Type: _sql.SQLite, Schema: Schema{Name: "main"}, Database: db}
+	table, err := client.SearchTable("notes", "milk", 1, 10, false)
+	require.NoError(t, err)
+	require.NotNil(t, table.Search)
+	assert.Equal(t, SearchLike, table.Search.Strategy)
+	assert.False(t, table.Search.Ranked)
+	assert.Equal(t, 2, table.Search.Matches)
+	require.Len(t, table.Data, 2)
+	assert.Equal(t, int64(1), table.Data[0]["id"])
+	assert.Equal(t, int64(3), table.Data[1]["id"])
+
+	// wildcards are matched as is
+	table, err = client.SearchTable("notes", "0%", 1, 10, true)
+	require.NoError(t, err)
+	assert.Equal(t, 1, table.Search.Matches)
+	require.Len(t, table.Rows.Rows, 1)
+
+	// matches are counted across pages
+	table, err = client.SearchTable("notes", "e", 2, 1, false)
+	require.NoError(t, err)
+	assert.Equal(t, 3, table.Search.Matches)
+	require.Len(t, table.Data, 1)
+	assert.Equal(t, int64(2), table.Data[0]["id"])
+}
+
+func TestSearchTableFTS5SQLite(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`CREATE VIRTUAL TABLE docs USING fts5(title, body)`)
+	if err != nil && strings.Contains(err.Error(), "no such module") {
+		t.Skip("sqlite3 was built without FTS5, run the tests with -tags sqlite_fts5")
+	}
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO docs VALUES
+		('cooking', 'a recipe for bread'),
+		('bread', 'bread bread and more bread'),
+		('gardening', 'tomatoes')`)
+	require.NoError(t, err)
+
+	client := &Client{Type: _sql.SQLite, Schema: Schema{Name: "main"}, Database: db}
+	table, err := client.SearchTable("docs", "bread", 1, 10, false)
+	require.NoError(t, err)
+	assert.Equal(t, SearchFTS5, table.Search.Strategy)
+	assert.True(t, table.Search.Ranked)
+	assert.Equal(t, 2, table.Search.Matches)
+	require.Len(t, table.Data, 2)
+	assert.Equal(t, "bread", table.Data[0]["title"])
+
+	// FTS5 query syntax in the text is searched for as words
+	_, err = client.SearchTable("docs", `"bread -`, 1, 10, false)
+	require.NoError(t, err)
+}
+
+func TestSearchTableMySQL(t *testing.T) {
+	client, err := SetupMySQLConnection()
+	require.NoError(t, err, "Failed to set up MySQL connection")
+	defer client.Database.Close()
+
+	_, err = client.Database.Exec(`
+		CREATE TABLE classicmodels.test_search (
+			id INT PRIMARY KEY,
+			title VARCHAR(100),
+			body TEXT,
+			FULLTEXT INDEX ft_title (title),
+			FULLTEXT INDEX ft_all (title, body)
+		) ENGINE = InnoDB
+	`)
+	require.NoError(t, err)
+	defer client.Database.Exec(`DROP TABLE classicmodels.test_search`)
+	_, err = client.Database.Exec(`INSERT INTO classicmodels.test_search VALUES
+		(1, 'cooking', 'a recipe for bread'),
+		(2, 'bread', 'bread bread and more bread'),
+		(3, 'gardening', 'tomatoes')`)
+	require.NoError(t, err)
+
+	table, err := client.SearchTable("test_search", "bread", 1, 10, false)
+	require.NoError(t, err)
+	assert.Equal(t, SearchMatch, table.Search.Strategy)
+	assert.Equal(t, []string{"title", "body"}, table.Search.Columns)
+	assert.Equal(t, 2, table.Search.Matches)
+	require.Len(t, table.Data, 2)
+	assert.Equal(t, int32(2), table.Data[0]["id"])
+}
+
+func TestBuildSearch(t *testing.T) {
+	cols := []Column{{Field: "id"}, {Field: "title"}}
+
+	clause := buildSearch("PostgreSQL", "posts", SearchTsquery, "go sql", []string{"doc"}, cols)
+	query, args, count := buildSearchSelect("PostgreSQL", "public", "posts", cols, clause, 10, 20)
+	assert.Equal(t, `SELECT "id", "title" FROM "public"."posts" WHERE ("doc" @@ plainto_tsquery($1)) ORDER BY ts_rank("doc", plainto_tsquery($1)) DESC LIMIT 10 OFFSET 20`, query)
+	assert.Equal(t, []interface{}{"go sql"}, args)
+	assert.Equal(t, `SELECT COUNT(*) FROM "public"."posts" WHERE ("doc" @@ plainto_tsquery($1))`, count)
+
+	clause = buildSearch("PostgreSQL", "posts", SearchLike, "50%_off!", nil, cols)
+	assert.Equal(t, `(CAST("id" AS TEXT) ILIKE $1 ESCAPE '!' OR CAST("title" AS TEXT) ILIKE $1 ESCAPE '!')`, clause.where)
+	assert.Equal(t, []interface{}{"%50!%!_off!!%"}, clause.whereArgs)
+
+	clause = buildSearch("MySQL", "posts", SearchMatch, "go", []string{"title"}, cols)
+	query, args, _ = buildSearchSelect("MySQL", "blog", "posts", cols, clause, 10, 0)
+	assert.Equal(t, "SELECT `id`, `title` FROM `blog`.`posts` WHERE MATCH (`title`) AGAINST (? IN NATURAL LANGUAGE MODE) ORDER BY MATCH (`title`) AGAINST (? IN NATURAL LANGUAGE MODE) DESC LIMIT 10 OFFSET 0", query)
+	assert.Equal(t, []interface{}{"go", "go"}, args)
+}
+
+func TestGetTableImplicitOrderSQLite(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	// rows are stored in insertion order, which is not the order of the text key
+	_, err = db.Exec(`CREATE TABLE codes (code TEXT PRIMARY KEY, label TEXT)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO codes VALUES ('e', '5'), ('b', '2'), ('d', '4'), ('a', '1'), ('c', '3')`)
+	require.NoError(t, err)
+	_, err = db.Exec(`CREATE TABLE tags (name TEXT, weight INTEGER)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO tags VALUES ('go', 2), ('sql', 1), ('go', 1)`)
+	require.NoError(t, err)
+	client := &Client{Type: _sql.SQLite, Schema: Schema{Name: "main"}, Database: db}
+
+	var codes []interface{}
+	for page := 1; page <= 3; page++ {
+		table, err := client.GetTable("codes", page, 2)
+		require.NoError(t, err)
+		assert.Equal(t, &TableOrder{Columns: []string{"code"}, By: OrderPrimaryKey}, table.Order)
+		for _, row := range table.Data {
+			codes = append(codes, row["code"])
+		}
+	}
+	assert.Equal(t, []interface{}{"a", "b", "c", "d", "e"}, codes)
+
+	table, err := client.GetTable("tags", 1, 10)
+	require.NoError(t, err)
+	assert.Equal(t, &TableOrder{Columns: []string{"name", "weight"}, By: OrderAllColumns}, table.Order)
+	require.Len(t, table.Data, 3)
+	assert.Equal(t, int64(1), table.Data[0]["weight"])
+	assert.Equal(t, "sql", table.Data[2]["name"])
+
+	table, err = client.SearchTable("codes", "a", 1, 10, false)
+	require.NoError(t, err)
+	assert.Equal(t, OrderPrimaryKey, table.Order.By)
+}
+
+func TestImplicitOrder(t *testing.T) {
+	cols := []Column{
+		{Field: "tenant_id", Key: "PRI"},
+		{Field: "tenant_id", Key: "MUL", ReferencedTable: "tenants"},
+		{Field: "id", Key: "PRI"},
+		{Field: "doc", Type: "json"},
+	}
+	order := implicitOrder("PostgreSQL", cols)
+	assert.Equal(t, &TableOrder{Columns: []string{"tenant_id", "id"}, By: OrderPrimaryKey}, order)
+	// a key column may come first as a foreign or unique key
+	assert.Equal(t, order, implicitOrder("PostgreSQL", []Column{cols[1], cols[0], cols[2], cols[3]}))
+	assert.Equal(t, order, implicitOrder("PostgreSQL", []Column{
+		{Field: "tenant_id", Key: "UNI"}, {Field: "tenant_id", Key: "PRI"}, {Field: "id", Key: "PRI"}, {Field: "doc", Type: "json"},
+	}))
+	assert.Equal(t, "SELECT `id` FROM app.events ORDER BY `tenant_id`, `id` LIMIT 10 OFFSET 20",
+		buildSelectAll(cols[2:3], "MySQL", "app", "events", order, 10, 20))
+
+	keyless := []Column{{Field: "doc", Type: "json"}, {Field: "name", Type: "text"}}
+	assert.Equal(t, &TableOrder{Columns: []string{"name"}, By: OrderAllColumns}, implicitOrder("PostgreSQL", keyless))
+	assert.Equal(t, &TableOrder{Columns: []string{"doc", "name"}, By: OrderAllColumns}, implicitOrder("MySQL", keyless))
+	assert.Nil(t, implicitOrder("PostgreSQL", keyless[:1]))
+
+	sqlite := []Column{{Field: "a", Key: "2"}, {Field: "b", Key: "0"}, {Field: "c", Key: "1"}}
+	assert.Equal(t, []string{"c", "a"}, implicitOrder("SQLite", sqlite).Columns)
+	assert.Equal(t, `SELECT "a", "b", "c" FROM "t" ORDER BY "c", "a" LIMIT 5 OFFSET 0`,
+		buildSelectAll(sqlite, "SQLite", "main", "t", implicitOrder("SQLite", sqlite), 5, 0))
+}
+
+func TestSchemaDocumentSQLite(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, email VARCHAR(255) NOT NULL, created_at DATETIME DEFAULT CURRENT_TIMESTAMP)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`CREATE TABLE user_roles (user_id INTEGER NOT NULL REFERENCES users(id), role TEXT NOT NULL, meta JSON, PRIMARY KEY (role, user_id))`)
+	require.NoError(t, err)
+
+	client := &Client{Type: _sql.SQLite, Schema: Schema{Name: "main"}, Database: db}
+	doc, err := client.GetSchemaDocument()
+	require.NoError(t, err)
+	assert.Equal(t, "main", doc.Schema)
+	require.Len(t, doc.Tables, 2)
+
+	tables := make(map[string]SchemaTable)
+	for _, table := range doc.Tables {
+		tables[table.Name] = table
+	}
+	users := tables["users"]
+	assert.Equal(t, []string{"id"}, users.PrimaryKey)
+	require.Len(t, users.Columns, 3)
+	assert.Equal(t, _sql.BigInt, users.Columns[0].PortableType)
+	assert.Equal(t, _sql.String, users.Columns[1].PortableType)
+	assert.False(t, users.Columns[1].Nullable)
+	assert.Equal(t, _sql.Timestamp, users.Columns[2].PortableType)
+	assert.True(t, users.Columns[2].Nullable)
+	require.NotNil(t, users.Columns[2].Default)
+	assert.Equal(t, "CURRENT_TIMESTAMP", *users.Columns[2].Default)
+
+	roles := tables["user_roles"]
+	assert.Equal(t, []string{"role", "user_id"}, roles.PrimaryKey)
+	require.NotNil(t, roles.Columns[0].ForeignKey)
+	assert.Equal(t, ColumnRef{Table: "users", Column: "id"}, *roles.Columns[0].ForeignKey)
+	assert.Nil(t, roles.Columns[1].ForeignKey)
+
+	src, err := doc.GoStructs("models")
+	require.NoError(t, err)
+	code := string(src)
+	assert.Contains(t, code, "package models")
+	assert.Contains(t, code, "\"encoding/json\"")
+	assert.Contains(t, code, "\"time\"")
+	assert.Contains(t, code, "type UserRoles struct {")
+	assert.Contains(t, code, "UserID int64           `db:\"user_id\" json:\"user_id\"`")
+	assert.Contains(t, code, "Meta   json.RawMessage `db:\"meta\" json:\"meta\"`")
+	assert.Contains(t, code, "CreatedAt *time.Time `db:\"created_at\" json:\"created_at\"`")
+}
+
+func TestGoName(t *testing.T) {
+	assert.Equal(t, "UserID", goName("user_id"))
+	assert.Equal(t, "APIKeyURL", goName("api-key url"))
+	assert.Equal(t, "CreatedAt", goName("createdAt"))
+	assert.Equal(t, "X2fa", goName("2fa"))
+	assert.Equal(t, "X", goName("__"))
+}
+
+// recordingConnector opens connections that record the queries they get and answer them with canned
+// rows, standing in for a server whose state cannot be set up in a test, e.g. its lock waits.
+type recordingConnector struct {
+	queries []string
+	rows    map[string][][]driver.Value
+	errs    map[string]error
+}
+
+func (c *recordingConnector) Connect(context.Context) (driver.Conn, error) {
+	return &recordingConn{connector: c}, nil
+}
+
+func (c *recordingConnector) Driver() driver.Driver { return nil }
+
+type recordingConn struct {
+	connector *recordingConnector
+}
+
+func (c *recordingConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	c.connector.queries = append(c.connector.queries, query)
+	if err := c.connector.errs[query]; err != nil {
+		return nil, err
+	}
+	return &recordingRows{values: c.connector.rows[query]}, nil
+}
+
+func (c *recordingConn) Prepare(string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("prepared statements are not supported")
+}
+
+func (c *recordingConn) Close() error { return nil }
+
+func (c *recordingConn) Begin() (driver.Tx, error) {
+	return nil, fmt.Errorf("transactions are not supported")
+}
+
+type recordingRows struct {
+	values [][]driver.Value
+}
+
+func (r *recordingRows) Columns() []string {
+	return []string{"blocked_pid", "blocked_user", "blocked_query", "blocking_pid", "blocking_user",
+		"blocking_query", "object", "lock_mode", "wait_seconds"}
+}
+
+func (r *recordingRows) Close() error { return nil }
+
+func (r *recordingRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func TestGetLockWaits(t *testing.T) {
+	blocked := []driver.Value{int64(42), "app", "UPDATE accounts SET balance = 0 WHERE id = 1", int64(7), "admin", "", "public.accounts", "RowExclusiveLock", int64(12)}
+
+	t.Run("postgresql", func(t *testing.T) {
+		connector := &recordingConnector{rows: map[string][][]driver.Value{_sql.PostgreSQLLockWaits: {blocked}}}
+		db := sql.OpenDB(connector)
+		defer db.Close()
+
+		client := &Client{Type: _sql.PostgreSQL, Database: db}
+		waits, err := client.GetLockWaits()
+		require.NoError(t, err)
+		assert.Equal(t, []string{_sql.PostgreSQLLockWaits}, connector.queries)
+		assert.Equal(t, []LockWait{{
+			Blocked:     LockSession{PID: 42, User: "app", Query: "UPDATE accounts SET balance = 0 WHERE id = 1"},
+			Blocking:    LockSession{PID: 7, User: "admin"},
+			Object:      "public.accounts",
+			LockMode:    "RowExclusiveLock",
+			WaitSeconds: 12,
+		}}, waits)
+	})
+
+	t.Run("mysql", func(t *testing.T) {
+		connector := &recordingConnector{rows: map[string][][]driver.Value{_sql.MySQLLockWaits: {}}}
+		db := sql.OpenDB(connector)
+		defer db.Close()
+
+		client := &Client{Type: _sql.MySQL, Database: db}
+		waits, err := client.GetLockWaits()
+		require.NoError(t, err)
+		assert.Equal(t, []string{_sql.MySQLLockWaits}, connector.queries)
+		assert.NotNil(t, waits)
+		assert.Empty(t, waits)
+	})
+
+	t.Run("mysql 5.7", func(t *testing.T) {
+		missing := fmt.Errorf("Table 'performance_schema.data_lock_waits' doesn't exist")
+		connector := &recordingConnector{
+			rows: map[string][][]driver.Value{_sql.MySQLLegacyLockWaits: {blocked}},
+			errs: map[string]error{_sql.MySQLLockWaits: missing},
+		}
+		db := sql.OpenDB(connector)
+		defer db.Close()
+
+		client := &Client{Type: _sql.MySQL, Database: db}
+		waits, err := client.GetLockWaits()
+		require.NoError(t, err)
+		assert.Equal(t, []string{_sql.MySQLLockWaits, _sql.MySQLLegacyLockWaits}, connector.queries)
+		require.Len(t, waits, 1)
+		assert.Equal(t, int64(42), waits[0].Blocked.PID)
+		assert.Equal(t, int64(7), waits[0].Blocking.PID)
+
+		// the error of the current query is kept when neither works
+		connector.errs[_sql.MySQLLegacyLockWaits] = fmt.Errorf("access denied")
+		_, err = client.GetLockWaits()
+		assert.ErrorIs(t, err, missing)
+	})
+
+	t.Run("sqlite", func(t *testing.T) {
+		connector := &recordingConnector{}
+		db := sql.OpenDB(connector)
+		defer db.Close()
+
+		client := &Client{Type: _sql.SQLite, Database: db}
+		waits, err := client.GetLockWaits()
+		require.NoError(t, err)
+		assert.Empty(t, connector.queries)
+		assert.NotNil(t, waits)
+		assert.Empty(t, waits)
+	})
+}
+
+func TestRefreshColumns(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE orders (id INTEGER PRIMARY KEY, total REAL)`)
+	require.NoError(t, err)
+
+	client := &Client{Type: _sql.SQLite, Schema: Schema{Name: "main"}, Database: db}
+	tables, err := client.RefreshColumns()
+	require.NoError(t, err)
+	assert.Equal(t, 1, tables)
+
+	cached := func(table string) bool {
+		client.cacheMu.Lock()
+		defer client.cacheMu.Unlock()
+		_, ok := client.columnCache[client.columnCacheKey("main", table)]
+		return ok
+	}
+	assert.True(t, cached("orders"))
+
+	// a table created by another client is not cached until the next refresh
+	_, err = db.Exec(`CREATE TABLE customers (id INTEGER PRIMARY KEY, name TEXT)`)
+	require.NoError(t, err)
+	assert.False(t, cached("customers"))
+
+	tables, err = client.RefreshColumns()
+	require.NoError(t, err)
+	assert.Equal(t, 2, tables)
+	assert.True(t, cached("customers"))
+	assert.True(t, cached("orders"))
+}
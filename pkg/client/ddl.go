@@ -0,0 +1,184 @@
+package client
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	_sql "github.com/yazeed1s/sqlweb/db/sql"
+)
+
+// terminateStatement ends a statement with a semicolon, so the statements of a DDL bundle can be run as a script.
+func terminateStatement(statement string) string {
+	statement = strings.TrimRight(statement, " \t\r\n")
+	if strings.HasSuffix(statement, ";") {
+		return statement
+	}
+	return statement + ";"
+}
+
+// joinStatements terminates the statements and puts each on its own line.
+func joinStatements(statements []string) string {
+	terminated := make([]string, 0, len(statements))
+	for _, s := range statements {
+		terminated = append(terminated, terminateStatement(s))
+	}
+	return strings.Join(terminated, "\n")
+}
+
+// getStatementsHelper runs a query returning one text column and returns its values.
+func getStatementsHelper(query string, db *sql.DB) ([]string, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("error executing query: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	statements := make([]string, 0)
+	for rows.Next() {
+		var statement string
+		if err = rows.Scan(&statement); err != nil {
+			return nil, err
+		}
+		statements = append(statements, statement)
+	}
+	return statements, rows.Err()
+}
+
+// mysqlTriggersHelper returns the CREATE TRIGGER statements of a table in the order the triggers fire.
+func mysqlTriggersHelper(db *sql.DB, schema, table string) ([]string, error) {
+	names, err := getStatementsHelper(fmt.Sprintf(_sql.MySQLTableTriggers, schema, table), db)
+	if err != nil {
+		return nil, err
+	}
+
+	statements := make([]string, 0, len(names))
+	for _, name := range names {
+		statement, err := mysqlShowCreateTrigger(db, schema, name)
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, statement)
+	}
+	return statements, nil
+}
+
+// mysqlShowCreateTrigger returns the "SQL Original Statement" column of SHOW CREATE TRIGGER.
+// The columns are read by name because their number differs between server versions.
+func mysqlShowCreateTrigger(db *sql.DB, schema, name string) (string, error) {
+	query := fmt.Sprintf(_sql.MySQLShowCreateTrigger,
+		QuoteIdentifier(_sql.MySQL.String(), schema), QuoteIdentifier(_sql.MySQL.String(), name))
+	rows, err := db.Query(query)
+	if err != nil {
+		return "", fmt.Errorf("error executing query: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return "", err
+	}
+	if !rows.Next() {
+		if err = rows.Err(); err != nil {
+			return "", err
+		}
+		return "", fmt.Errorf("trigger %s not found", name)
+	}
+	values := make([]sql.NullString, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	if err = rows.Scan(pointers...); err != nil {
+		return "", err
+	}
+	for i, column := range columns {
+		if strings.EqualFold(column, "SQL Original Statement") {
+			return values[i].String, nil
+		}
+	}
+	return "", fmt.Errorf("SHOW CREATE TRIGGER returned no statement for %s", name)
+}
+
+// postgresSequencesHelper returns the statements recreating the sequences owned by the columns of a table:
+// the CREATE SEQUENCE statements go before the table, which refers to them in its column defaults,
+// and the ALTER SEQUENCE ... OWNED BY statements after it.
+func postgresSequencesHelper(db *sql.DB, schema, table string) ([]string, []string, error) {
+	rows, err := db.Query(fmt.Sprintf(_sql.PostgreSQLOwnedSequences, schema, table))
+	if err != nil {
+		return nil, nil, fmt.Errorf("error executing query: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	var (
+		creates []string
+		owners  []string
+		target  = QualifiedTable(_sql.PostgreSQL.String(), schema, table)
+	)
+	for rows.Next() {
+		var (
+			sequence, column                     string
+			increment, minValue, maxValue, start int64
+			cycle                                bool
+		)
+		if err = rows.Scan(&sequence, &column, &increment, &minValue, &maxValue, &start, &cycle); err != nil {
+			return nil, nil, err
+		}
+		cycleOption := "NO CYCLE"
+		if cycle {
+			cycleOption = "CYCLE"
+		}
+		creates = append(creates, fmt.Sprintf(
+			"CREATE SEQUENCE IF NOT EXISTS %s INCREMENT BY %d MINVALUE %d MAXVALUE %d START WITH %d %s;",
+			sequence, increment, minValue, maxValue, start, cycleOption))
+		owners = append(owners, fmt.Sprintf("ALTER SEQUENCE %s OWNED BY %s.%s;", sequence, target, column))
+	}
+	return creates, owners, rows.Err()
+}
+
+// postgresTriggersHelper returns the CREATE TRIGGER statements of a table, each preceded by the
+// definition of its trigger function unless an earlier trigger already uses it.
+func postgresTriggersHelper(db *sql.DB, schema, table string) ([]string, error) {
+	rows, err := db.Query(fmt.Sprintf(_sql.PostgreSQLTableTriggers, schema, table))
+	if err != nil {
+		return nil, fmt.Errorf("error executing query: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	var (
+		statements []string
+		functions  = make(map[string]bool)
+	)
+	for rows.Next() {
+		var function, trigger string
+		if err = rows.Scan(&function, &trigger); err != nil {
+			return nil, err
+		}
+		if !functions[function] {
+			functions[function] = true
+			statements = append(statements, function)
+		}
+		statements = append(statements, trigger)
+	}
+	return statements, rows.Err()
+}
@@ -0,0 +1,232 @@
+package client
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	_sql "github.com/yazeed1s/sqlweb/db/sql"
+)
+
+// ForeignKeyRef is a foreign key column of another table that references a column.
+type ForeignKeyRef struct {
+	Table      string `json:"table"`
+	Column     string `json:"column"`
+	Constraint string `json:"constraint"`
+}
+
+// ColumnDependencies lists the database objects that would break if a column were renamed or dropped.
+type ColumnDependencies struct {
+	Views       []string        `json:"views"`
+	ForeignKeys []ForeignKeyRef `json:"foreign_keys"`
+}
+
+// ReferencingTable is a foreign key of another table referencing a table, one entry per constraint.
+// SQLite foreign keys have no name, so Constraint is empty for them.
+type ReferencingTable struct {
+	FromTable   string   `json:"fromTable"`
+	FromColumns []string `json:"fromColumns"`
+	ToColumns   []string `json:"toColumns"`
+	Constraint  string   `json:"constraint"`
+	OnDelete    string   `json:"onDelete"`
+}
+
+// MentionsIdentifier reports whether the SQL text mentions the identifier as a whole word,
+// bare or quoted, ignoring case. It is a text search: it may report an identifier that only
+// appears inside a string literal, which is the safe side for a dependency check.
+func MentionsIdentifier(text, identifier string) bool {
+	pattern := `(?i)(^|[^A-Za-z0-9_$])` + regexp.QuoteMeta(identifier) + `($|[^A-Za-z0-9_$])`
+	return regexp.MustCompile(pattern).MatchString(text)
+}
+
+// GetColumnDependencies finds the views and foreign keys that depend on the column.
+// PostgreSQL tracks view dependencies in pg_depend; MySQL and SQLite views are found by searching
+// their definitions for both the table and the column name.
+func (c *Client) GetColumnDependencies(table, column string) (*ColumnDependencies, error) {
+	if c.Database == nil {
+		return nil, errors.New("database connection is nil")
+	}
+
+	var (
+		err   error
+		deps  *ColumnDependencies
+		query string
+	)
+
+	deps = &ColumnDependencies{Views: make([]string, 0), ForeignKeys: make([]ForeignKeyRef, 0)}
+	switch strings.ToLower(c.Type.String()) {
+	case strings.ToLower(_sql.MySQL.String()):
+		query = fmt.Sprintf(_sql.MySQLViewDefinitions, c.Schema.Name)
+		deps.Views, err = viewsMentioningHelper(query, c.Database, table, column)
+		if err != nil {
+			return nil, err
+		}
+		query = fmt.Sprintf(_sql.MySQLReferencingForeignKeys, c.Schema.Name, table, column)
+	case strings.ToLower(_sql.PostgreSQL.String()):
+		query = fmt.Sprintf(_sql.PostgreSQLDependentViews, c.Schema.Name, table, column)
+		deps.Views, err = getDependentViewsHelper(query, c.Database)
+		if err != nil {
+			return nil, err
+		}
+		query = fmt.Sprintf(_sql.PostgreSQLReferencingForeignKeys, c.Schema.Name, table, column)
+	case strings.ToLower(_sql.SQLite.String()):
+		deps.Views, err = viewsMentioningHelper(_sql.SQLiteViewDefinitions, c.Database, table, column)
+		if err != nil {
+			return nil, err
+		}
+		query = fmt.Sprintf(_sql.SQLiteReferencingForeignKeys, table, column)
+	default:
+		return nil, fmt.Errorf("unsupported database type: %s", c.Type.String())
+	}
+
+	deps.ForeignKeys, err = getForeignKeyRefsHelper(query, c.Database)
+	if err != nil {
+		return nil, err
+	}
+	return deps, nil
+}
+
+// viewsMentioningHelper runs a query returning view names and definitions, and keeps
+// the views whose definition mentions both the table and the column.
+func viewsMentioningHelper(query string, db *sql.DB, table, column string) ([]string, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("error executing query: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	views := make([]string, 0)
+	for rows.Next() {
+		var (
+			name       string
+			definition sql.NullString
+		)
+		if err = rows.Scan(&name, &definition); err != nil {
+			return nil, err
+		}
+		if MentionsIdentifier(definition.String, table) && MentionsIdentifier(definition.String, column) {
+			views = append(views, name)
+		}
+	}
+	return views, rows.Err()
+}
+
+func getDependentViewsHelper(query string, db *sql.DB) ([]string, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("error executing query: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	views := make([]string, 0)
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		views = append(views, name)
+	}
+	return views, rows.Err()
+}
+
+func getForeignKeyRefsHelper(query string, db *sql.DB) ([]ForeignKeyRef, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("error executing query: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	refs := make([]ForeignKeyRef, 0)
+	for rows.Next() {
+		var ref ForeignKeyRef
+		if err = rows.Scan(&ref.Table, &ref.Column, &ref.Constraint); err != nil {
+			return nil, err
+		}
+		refs = append(refs, ref)
+	}
+	return refs, rows.Err()
+}
+
+// GetReferencingTables lists the foreign keys of other tables referencing the table, the reverse of
+// the table's own foreign keys. SQLite has no catalog of them: the foreign keys of every table are searched.
+func (c *Client) GetReferencingTables(table string) ([]ReferencingTable, error) {
+	if c.Database == nil {
+		return nil, errors.New("database connection is nil")
+	}
+
+	var query string
+	switch strings.ToLower(c.Type.String()) {
+	case strings.ToLower(_sql.MySQL.String()):
+		query = fmt.Sprintf(_sql.MySQLReferencingTables, c.Schema.Name, table)
+	case strings.ToLower(_sql.PostgreSQL.String()):
+		query = fmt.Sprintf(_sql.PostgreSQLReferencingTables, c.Schema.Name, table)
+	case strings.ToLower(_sql.SQLite.String()):
+		query = fmt.Sprintf(_sql.SQLiteReferencingTables, table)
+	default:
+		return nil, fmt.Errorf("unsupported database type: %s", c.Type.String())
+	}
+	return getReferencingTablesHelper(query, c.Database)
+}
+
+// getReferencingTablesHelper runs a query returning one row per foreign key column, ordered by
+// table, constraint and column position, and groups the rows by constraint.
+func getReferencingTablesHelper(query string, db *sql.DB) ([]ReferencingTable, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("error executing query: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	var (
+		refs    = make([]ReferencingTable, 0)
+		lastKey string
+	)
+	for rows.Next() {
+		var (
+			table, key, name, from, onDelete string
+			// a SQLite foreign key to the primary key may leave the referenced column out
+			to sql.NullString
+		)
+		if err = rows.Scan(&table, &key, &name, &from, &to, &onDelete); err != nil {
+			return nil, err
+		}
+		if len(refs) == 0 || refs[len(refs)-1].FromTable != table || lastKey != key {
+			refs = append(refs, ReferencingTable{
+				FromTable:   table,
+				FromColumns: make([]string, 0),
+				ToColumns:   make([]string, 0),
+				Constraint:  name,
+				OnDelete:    onDelete,
+			})
+			lastKey = key
+		}
+		ref := &refs[len(refs)-1]
+		ref.FromColumns = append(ref.FromColumns, from)
+		if to.Valid {
+			ref.ToColumns = append(ref.ToColumns, to.String)
+		}
+	}
+	return refs, rows.Err()
+}
@@ -0,0 +1,87 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yazeed1s/sqlweb/pkg/util"
+)
+
+// ExportColumns splits the columns of a table between those its exports write, in table order, and those they omit:
+// the columns given in exclude and those the ExportExcludedColumns setting of the connection excludes. Both are nil
+// when nothing is omitted, and the table is then exported as is. Excluding a column the table does not have, or
+// every column, is an error.
+func (c *Client) ExportColumns(tableName string, exclude []string) (columns, omitted []string, err error) {
+	if len(exclude) == 0 && len(c.Settings.ExportExcludedColumns) == 0 {
+		return nil, nil, nil
+	}
+
+	cols, err := c.GetColumns(tableName)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(cols) == 0 {
+		return nil, nil, fmt.Errorf("table '%s' not found", tableName)
+	}
+
+	var (
+		seen    = make(map[string]bool, len(cols))
+		matched = make([]bool, len(exclude))
+	)
+	for _, col := range cols {
+		// the columns query returns a row per key a column is part of
+		if seen[col.Field] {
+			continue
+		}
+		seen[col.Field] = true
+
+		excluded := c.Settings.ExcludesFromExport(tableName, col.Field)
+		for i, name := range exclude {
+			if c.SameIdentifier(name, col.Field) {
+				excluded, matched[i] = true, true
+			}
+		}
+		if excluded {
+			omitted = append(omitted, col.Field)
+		} else {
+			columns = append(columns, col.Field)
+		}
+	}
+
+	for i, name := range exclude {
+		if !matched[i] {
+			return nil, nil, fmt.Errorf("cannot exclude column '%s': not found in table '%s'", name, tableName)
+		}
+	}
+	if len(columns) == 0 {
+		return nil, nil, fmt.Errorf("every column of table '%s' is excluded from exports", tableName)
+	}
+	if len(omitted) == 0 {
+		return nil, nil, nil
+	}
+	return columns, omitted, nil
+}
+
+// CheckExportPolicy fails with util.ErrPolicyViolation when an export asks for a column the
+// ExportExcludedColumns setting of the connection excludes, naming the columns.
+func (c *Client) CheckExportPolicy(tableName string, columns []string) error {
+	var excluded []string
+	for _, column := range columns {
+		if c.Settings.ExcludesFromExport(tableName, column) {
+			excluded = append(excluded, column)
+		}
+	}
+	if len(excluded) > 0 {
+		return fmt.Errorf("%s.%s: %w", tableName, strings.Join(excluded, ", "), util.ErrPolicyViolation)
+	}
+	return nil
+}
+
+// exportQuery returns the query an export of the table reads it with, and the columns it omits, see ExportColumns.
+func (c *Client) exportQuery(tableName string, exclude []string) (string, []string, error) {
+	columns, omitted, err := c.ExportColumns(tableName, exclude)
+	if err != nil {
+		return "", nil, err
+	}
+	return c.selectAllQuery(tableName, columns), omitted, nil
+}
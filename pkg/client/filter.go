@@ -0,0 +1,79 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Condition restricts the rows of a table on a single column, e.g. {"column": "qty", "operator": ">", "value": 3}.
+type Condition struct {
+	Column   string      `json:"column"`
+	Operator string      `json:"operator"`
+	Value    interface{} `json:"value"`
+}
+
+// Filter is a list of conditions that must all hold (they are joined with AND).
+type Filter []Condition
+
+// filterOperators lists the supported operators; any other operator is rejected.
+var filterOperators = map[string]bool{
+	"=":           true,
+	"!=":          true,
+	"<>":          true,
+	"<":           true,
+	"<=":          true,
+	">":           true,
+	">=":          true,
+	"LIKE":        true,
+	"NOT LIKE":    true,
+	"IN":          true,
+	"NOT IN":      true,
+	"IS NULL":     true,
+	"IS NOT NULL": true,
+}
+
+// Where builds a parameterized WHERE clause (without the WHERE keyword) from the filter.
+// Bind parameters are numbered from 'start' for databases that use numbered placeholders,
+// so the clause can follow other parameters in the same statement.
+func (f Filter) Where(dbType string, start int) (string, []interface{}, error) {
+	var (
+		clauses []string
+		args    []interface{}
+		n       int
+	)
+
+	n = start - 1
+	for _, cond := range f {
+		operator := strings.ToUpper(strings.TrimSpace(cond.Operator))
+		if !filterOperators[operator] {
+			return "", nil, fmt.Errorf("unsupported filter operator: %s", cond.Operator)
+		}
+		if cond.Column == "" {
+			return "", nil, fmt.Errorf("filter condition is missing a column")
+		}
+		column := QuoteIdentifier(dbType, cond.Column)
+
+		switch operator {
+		case "IS NULL", "IS NOT NULL":
+			clauses = append(clauses, column+" "+operator)
+		case "IN", "NOT IN":
+			values, ok := cond.Value.([]interface{})
+			if !ok || len(values) == 0 {
+				return "", nil, fmt.Errorf("operator %s on '%s' needs a non-empty list of values", operator, cond.Column)
+			}
+			params := make([]string, len(values))
+			for i, v := range values {
+				n++
+				params[i] = Placeholder(dbType, n)
+				args = append(args, v)
+			}
+			clauses = append(clauses, fmt.Sprintf("%s %s (%s)", column, operator, strings.Join(params, ", ")))
+		default:
+			n++
+			clauses = append(clauses, fmt.Sprintf("%s %s %s", column, operator, Placeholder(dbType, n)))
+			args = append(args, cond.Value)
+		}
+	}
+
+	return strings.Join(clauses, " AND "), args, nil
+}
@@ -0,0 +1,75 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/yazeed1s/sqlweb/pkg/util"
+)
+
+// Fingerprint hashes the ordered column names and types of a table. Two reads of a table
+// return the same fingerprint as long as no column was added, dropped, renamed, reordered or retyped.
+func Fingerprint(cols []Column) string {
+	hash := sha256.New()
+	for _, col := range cols {
+		fmt.Fprintf(hash, "%s\x00%s\n", col.Field, col.Type)
+	}
+	return hex.EncodeToString(hash.Sum(nil)[:8])
+}
+
+// TableFingerprint returns the fingerprint of the table from the column metadata cache.
+func (c *Client) TableFingerprint(tableName string) (string, error) {
+	cols, err := c.GetCachedColumns(c.Schema.Name, tableName)
+	if err != nil {
+		return "", err
+	}
+	return Fingerprint(cols), nil
+}
+
+// RefreshedColumnData is the column data of a table read again from the database,
+// with the fingerprint of its fresh columns.
+type RefreshedColumnData struct {
+	ColumnData
+	Fingerprint string `json:"fingerprint"`
+}
+
+// RefreshColumnsData reads the columns of the table again, with their keys and references and the foreign
+// keys referencing the table, and replaces its cached columns, e.g. after a migration run by another client.
+// It tells whether the fingerprint changed; a table whose columns were not cached yet has not changed.
+func (c *Client) RefreshColumnsData(tableName string) (RefreshedColumnData, bool, error) {
+	data, err := c.GetColumnsData(tableName)
+	if err != nil {
+		return RefreshedColumnData{}, false, err
+	}
+
+	key := c.columnCacheKey(c.Schema.Name, tableName)
+	c.cacheMu.Lock()
+	cached, ok := c.columnCache[key]
+	delete(c.columnCache, key)
+	c.cacheMu.Unlock()
+	c.cacheColumns(c.Schema.Name, tableName, data.Columns)
+
+	fingerprint := Fingerprint(data.Columns)
+	return RefreshedColumnData{ColumnData: data, Fingerprint: fingerprint}, ok && Fingerprint(cached) != fingerprint, nil
+}
+
+// CheckFingerprint re-reads the table's columns and fails with util.ErrSchemaChanged when they no longer
+// match the fingerprint the caller saw. The fresh columns replace the cached ones, so the check doubles
+// as the metadata lookup of the write that follows. An empty fingerprint skips the check.
+func (c *Client) CheckFingerprint(tableName, fingerprint string) error {
+	if fingerprint == "" {
+		return nil
+	}
+
+	cols, err := c.GetColumns(tableName)
+	if err != nil {
+		return err
+	}
+	c.cacheColumns(c.Schema.Name, tableName, cols)
+
+	if Fingerprint(cols) != fingerprint {
+		return fmt.Errorf("%s: %w", tableName, util.ErrSchemaChanged)
+	}
+	return nil
+}
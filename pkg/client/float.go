@@ -0,0 +1,30 @@
+package client
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// FloatFormat controls how floats are rendered in CSV exports.
+// The zero value writes them in fixed notation with as many decimals as they need to read back the same.
+type FloatFormat struct {
+	// Precision is the number of decimals written, 0 writes as many as the value needs
+	Precision int
+	// Scientific writes floats the way Go does by default, in scientific notation when large or small
+	Scientific bool
+}
+
+// Text renders a float of the given bit size, 32 or 64, for a text output such as CSV.
+func (f FloatFormat) Text(v float64, bitSize int) string {
+	if f.Scientific {
+		if bitSize == 32 {
+			return fmt.Sprintf("%v", float32(v))
+		}
+		return fmt.Sprintf("%v", v)
+	}
+	precision := f.Precision
+	if precision <= 0 {
+		precision = -1
+	}
+	return strconv.FormatFloat(v, 'f', precision, bitSize)
+}
@@ -0,0 +1,71 @@
+package client
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	_sql "github.com/yazeed1s/sqlweb/db/sql"
+)
+
+// isSQLite reports whether the client is connected to SQLite, whose identifiers are
+// case-insensitive but keep the case they were created with.
+func (c *Client) isSQLite() bool {
+	return strings.EqualFold(c.Type.String(), _sql.SQLite.String())
+}
+
+// SameIdentifier reports whether two names refer to the same table or column:
+// ignoring case for SQLite, exactly for the other databases.
+func (c *Client) SameIdentifier(a, b string) bool {
+	if c.isSQLite() {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// StoredTableName returns the table name as stored in the schema. For SQLite the name is looked up
+// ignoring case, so a table created as "People" is found as "people"; the other databases get the
+// name back unchanged. A table that does not exist is returned unchanged too, leaving the error to
+// the query that uses it.
+func (c *Client) StoredTableName(tableName string) (string, error) {
+	if !c.isSQLite() {
+		return tableName, nil
+	}
+	if c.Database == nil {
+		return "", errors.New("database connection is nil")
+	}
+	schema, table, err := c.sourceOf(tableName)
+	if err != nil {
+		return "", err
+	}
+	stored, err := storedNameHelper(fmt.Sprintf(_sql.SQLiteStoredTableName, schema, table), c.Database, table)
+	if err != nil || schema == "main" {
+		return stored, err
+	}
+	// a table of an attached database keeps the alias it is read with
+	return schema + "." + stored, nil
+}
+
+// StoredColumnName returns the column name as stored in the table, see StoredTableName.
+func (c *Client) StoredColumnName(tableName, column string) (string, error) {
+	if !c.isSQLite() {
+		return column, nil
+	}
+	if c.Database == nil {
+		return "", errors.New("database connection is nil")
+	}
+	return storedNameHelper(fmt.Sprintf(_sql.SQLiteStoredColumnName, tableName, column), c.Database, column)
+}
+
+func storedNameHelper(query string, db *sql.DB, name string) (string, error) {
+	var stored string
+	err := db.QueryRow(query).Scan(&stored)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return name, nil
+		}
+		return "", fmt.Errorf("error executing query: %w", err)
+	}
+	return stored, nil
+}
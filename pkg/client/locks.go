@@ -0,0 +1,90 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	_sql "github.com/yazeed1s/sqlweb/db/sql"
+)
+
+// LockSession is a session taking part in a lock wait.
+type LockSession struct {
+	// PID is the connection id on MySQL, the backend pid on PostgreSQL
+	PID  int64  `json:"pid"`
+	User string `json:"user"`
+	// Query is the statement the session runs, empty when it is idle in its transaction
+	Query string `json:"query"`
+}
+
+// LockWait is a session waiting for a lock held by another. A session blocked by several others
+// is reported once per blocker.
+type LockWait struct {
+	Blocked  LockSession `json:"blocked"`
+	Blocking LockSession `json:"blocking"`
+	// Object is the locked table as schema.table, or the kind of lock when it is not on a table
+	Object   string `json:"object"`
+	LockMode string `json:"lock_mode"`
+	// WaitSeconds is how long the blocked session has been waiting
+	WaitSeconds int64 `json:"wait_seconds"`
+}
+
+// GetLockWaits returns the sessions waiting for a lock, each paired with a session blocking it, longest waits
+// first. MySQL 8.0 reports them in performance_schema, and MySQL 5.7 in information_schema.INNODB_LOCK_WAITS,
+// which is queried when the former is missing. SQLite locks the whole file without reporting who holds it,
+// so the list is empty.
+func (c *Client) GetLockWaits() ([]LockWait, error) {
+	if c.Database == nil {
+		return nil, errors.New("database connection is nil")
+	}
+
+	var (
+		dbType = c.Type.String()
+		waits  []LockWait
+		err    error
+	)
+
+	switch strings.ToLower(dbType) {
+	case strings.ToLower(_sql.MySQL.String()):
+		waits, err = c.queryLockWaits(_sql.MySQLLockWaits)
+		if err != nil {
+			// performance_schema.data_lock_waits is new in MySQL 8.0
+			legacy, legacyErr := c.queryLockWaits(_sql.MySQLLegacyLockWaits)
+			if legacyErr != nil {
+				return nil, err
+			}
+			return legacy, nil
+		}
+		return waits, nil
+	case strings.ToLower(_sql.PostgreSQL.String()):
+		return c.queryLockWaits(_sql.PostgreSQLLockWaits)
+	case strings.ToLower(_sql.SQLite.String()):
+		return make([]LockWait, 0), nil
+	default:
+		return nil, fmt.Errorf("unsupported database type: %s", dbType)
+	}
+}
+
+// queryLockWaits runs one of the lock wait queries, whose columns are the pid, user and query of
+// the blocked session, then of the blocking one, the locked object, the lock mode and the wait.
+func (c *Client) queryLockWaits(query string) ([]LockWait, error) {
+	rows, err := c.Database.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	waits := make([]LockWait, 0)
+	for rows.Next() {
+		var wait LockWait
+		if err = rows.Scan(
+			&wait.Blocked.PID, &wait.Blocked.User, &wait.Blocked.Query,
+			&wait.Blocking.PID, &wait.Blocking.User, &wait.Blocking.Query,
+			&wait.Object, &wait.LockMode, &wait.WaitSeconds,
+		); err != nil {
+			return nil, err
+		}
+		waits = append(waits, wait)
+	}
+	return waits, rows.Err()
+}
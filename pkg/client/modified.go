@@ -0,0 +1,138 @@
+package client
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	_sql "github.com/yazeed1s/sqlweb/db/sql"
+)
+
+// LastModified tells when a table was last changed, as far as the database can tell.
+// At is nil when it is unknown. Approximate is set when At is not the time of the last write itself,
+// and Source names where At was read from.
+type LastModified struct {
+	At          *time.Time `json:"at"`
+	Approximate bool       `json:"approximate"`
+	Source      string     `json:"source"`
+	// ChangesSince is the number of rows changed after At, when the database counts them
+	ChangesSince int64 `json:"changesSince,omitempty"`
+}
+
+// GetTablesLastModified reads when each table of the schema was last modified, keyed by table name.
+//   - MySQL reports UPDATE_TIME, which InnoDB keeps in memory only: it is lost on restart and may be missing.
+//   - PostgreSQL has no modification time. The last vacuum or analyze of the table is used, with the number
+//     of rows changed since; any change means the table was modified after At.
+//   - SQLite has no per-table information either, so every table gets the modification time of the database
+//     file, or of its write-ahead log when that is newer.
+func (c *Client) GetTablesLastModified() (map[string]LastModified, error) {
+	if c.Database == nil {
+		return nil, errors.New("database connection is nil")
+	}
+
+	switch strings.ToLower(c.Type.String()) {
+	case strings.ToLower(_sql.MySQL.String()):
+		return getLastModifiedHelper(fmt.Sprintf(_sql.MySQLTablesLastModified, c.Schema.Name), c.Database,
+			LastModified{Approximate: true, Source: "information_schema.TABLES.UPDATE_TIME"})
+	case strings.ToLower(_sql.PostgreSQL.String()):
+		return getLastModifiedHelper(fmt.Sprintf(_sql.PostgreSQLTablesLastModified, c.Schema.Name), c.Database,
+			LastModified{Approximate: true, Source: "pg_stat_user_tables"})
+	case strings.ToLower(_sql.SQLite.String()):
+		tables, err := c.GetTableNames()
+		if err != nil {
+			return nil, err
+		}
+		modified := LastModified{At: sqliteFileModTime(c.Path), Approximate: true, Source: "file mtime"}
+		res := make(map[string]LastModified, len(tables))
+		for _, table := range tables {
+			res[table] = modified
+		}
+		return res, nil
+	}
+
+	return nil, fmt.Errorf("unsupported database type: %s", c.Type.String())
+}
+
+// GetTableLastModified reads when the table was last modified, see GetTablesLastModified.
+// It returns nil for a table the database reports nothing about.
+func (c *Client) GetTableLastModified(table string) (*LastModified, error) {
+	modified, err := c.GetTablesLastModified()
+	if err != nil {
+		return nil, err
+	}
+	if m, ok := modified[table]; ok {
+		return &m, nil
+	}
+	return nil, nil
+}
+
+// getLastModifiedHelper runs a query returning table names and nullable Unix times, followed on
+// PostgreSQL by the number of rows changed since, and fills a copy of base for each table.
+func getLastModifiedHelper(query string, db *sql.DB, base LastModified) (map[string]LastModified, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("error executing query: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]LastModified)
+	for rows.Next() {
+		var (
+			table    string
+			unixTime sql.NullFloat64
+			changes  sql.NullInt64
+			modified = base
+		)
+		if len(columns) > 2 {
+			err = rows.Scan(&table, &unixTime, &changes)
+		} else {
+			err = rows.Scan(&table, &unixTime)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if unixTime.Valid {
+			at := time.Unix(0, int64(unixTime.Float64*float64(time.Second))).UTC()
+			modified.At = &at
+		}
+		modified.ChangesSince = changes.Int64
+		res[table] = modified
+	}
+	return res, rows.Err()
+}
+
+// sqliteFileModTime returns the modification time of the database file or its write-ahead log,
+// whichever is newer, or nil for in-memory databases and files that cannot be read.
+func sqliteFileModTime(path string) *time.Time {
+	if path == "" || strings.Contains(path, ":memory:") || strings.Contains(path, "mode=memory") {
+		return nil
+	}
+	path = strings.TrimPrefix(path, "file:")
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+
+	var latest *time.Time
+	for _, name := range []string{path, path + "-wal"} {
+		info, err := os.Stat(name)
+		if err != nil {
+			continue
+		}
+		if mod := info.ModTime().UTC(); latest == nil || mod.After(*latest) {
+			latest = &mod
+		}
+	}
+	return latest
+}
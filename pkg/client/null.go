@@ -0,0 +1,38 @@
+package client
+
+import "fmt"
+
+// NullFormat controls how NULL values are rendered in exports.
+// The zero value renders NULL as an empty CSV field and as null in JSON.
+type NullFormat struct {
+	// Placeholder replaces NULL in CSV output, e.g. "NULL" or `\N` for mysqlimport
+	Placeholder string
+	// InJSON renders NULL as Placeholder in JSON output as well, instead of null
+	InJSON bool
+}
+
+// Text renders a value for a text output such as CSV.
+func (n NullFormat) Text(v interface{}) string {
+	if v == nil {
+		return n.Placeholder
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// JSON returns the value to encode in a JSON output.
+func (n NullFormat) JSON(v interface{}) interface{} {
+	if v == nil && n.InJSON {
+		return n.Placeholder
+	}
+	return v
+}
+
+// JSONRows applies the format to every value of the rows, in place.
+func (n NullFormat) JSONRows(rows *Rows) *Rows {
+	if !n.InJSON || rows == nil {
+		return rows
+	}
+	placeholder := n.Placeholder
+	rows.null = &placeholder
+	return rows
+}
@@ -0,0 +1,125 @@
+package client
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	_sql "github.com/yazeed1s/sqlweb/db/sql"
+)
+
+// What the implicit order of a table is based on, see TableOrder.
+const (
+	OrderPrimaryKey = "primary_key"
+	OrderAllColumns = "all_columns"
+)
+
+// TableOrder is the order the rows of a table are read in when no other order is asked for. Without one,
+// MySQL and PostgreSQL return rows in no particular order, so a row could show up on two pages or on none.
+type TableOrder struct {
+	Columns []string `json:"columns"`
+	// By is OrderPrimaryKey, or OrderAllColumns for tables without a primary key
+	By string `json:"by"`
+	// Collation is the collation the text columns are sorted with when one was asked for, see collate;
+	// Collated lists those columns, the others following their own collation
+	Collation string   `json:"collation,omitempty"`
+	Collated  []string `json:"collated,omitempty"`
+}
+
+// unorderableTypes are the PostgreSQL data types without a default ordering, which cannot be sorted on.
+var unorderableTypes = map[string]bool{
+	"json": true, "xml": true, "point": true, "line": true, "lseg": true,
+	"box": true, "path": true, "polygon": true, "circle": true,
+}
+
+// implicitOrder returns the order the rows of the table are read in: by its primary key, in key order,
+// or by every column when it has none, leaving out PostgreSQL columns that cannot be sorted on.
+// It is nil when there is no column to sort on.
+func implicitOrder(dbType string, cols []Column) *TableOrder {
+	var (
+		sqlite   = strings.EqualFold(dbType, _sql.SQLite.String())
+		seen     = make(map[string]bool, len(cols))
+		primary  = make(map[string]bool)
+		key      []Column
+		sortable []string
+	)
+	// the columns query returns a row per key a column is part of, in any order
+	for _, col := range cols {
+		// SQLite reports the position of the column in the primary key, 0 when it is not part of it
+		if (sqlite && col.Key != "" && col.Key != "0") || (!sqlite && col.Key == "PRI") {
+			if !primary[col.Field] {
+				key = append(key, col)
+			}
+			primary[col.Field] = true
+		}
+	}
+	for _, col := range cols {
+		if seen[col.Field] {
+			continue
+		}
+		seen[col.Field] = true
+		if strings.EqualFold(dbType, _sql.PostgreSQL.String()) && unorderableTypes[strings.ToLower(col.Type)] {
+			continue
+		}
+		sortable = append(sortable, col.Field)
+	}
+
+	if len(key) > 0 {
+		if sqlite {
+			sort.SliceStable(key, func(i, j int) bool {
+				a, _ := strconv.Atoi(key[i].Key)
+				b, _ := strconv.Atoi(key[j].Key)
+				return a < b
+			})
+		}
+		order := &TableOrder{By: OrderPrimaryKey}
+		for _, col := range key {
+			order.Columns = append(order.Columns, col.Field)
+		}
+		return order
+	}
+	if len(sortable) == 0 {
+		return nil
+	}
+	return &TableOrder{Columns: sortable, By: OrderAllColumns}
+}
+
+// orderBy returns the quoted columns of the order, to follow ORDER BY, with a COLLATE clause on the collated ones.
+func (o *TableOrder) orderBy(dbType string) string {
+	quoted := make([]string, len(o.Columns))
+	for i, column := range o.Columns {
+		quoted[i] = QuoteIdentifier(dbType, column)
+		if slices.Contains(o.Collated, column) {
+			quoted[i] = fmt.Sprintf(_sql.SQLCollate, quoted[i], QuoteIdentifier(dbType, o.Collation))
+		}
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// collate sorts the text columns of the order with the collation, which must be one the server offers,
+// see checkCollation. Other columns have no collation and keep their order.
+func (o *TableOrder) collate(collation string, cols []Column) {
+	o.Collation = collation
+	for _, column := range o.Columns {
+		for _, col := range cols {
+			if col.Field == column && isTextType(col.Type) {
+				o.Collated = append(o.Collated, column)
+				break
+			}
+		}
+	}
+}
+
+// isTextType tells whether a column of the type holds text, which a collation applies to:
+// the CHAR, VARCHAR and TEXT types of every database, and SQLite types of text affinity.
+func isTextType(columnType string) bool {
+	columnType = strings.ToLower(columnType)
+	for _, text := range []string{"char", "text", "clob", "enum", "set("} {
+		if strings.Contains(columnType, text) {
+			return true
+		}
+	}
+	return false
+}
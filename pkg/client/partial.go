@@ -0,0 +1,135 @@
+package client
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// partialSuffix ends the name of a file being written, so it is never mistaken for a finished export.
+const partialSuffix = ".partial"
+
+// partialFile is an export being written under a temporary name next to its final one.
+// The file only gets its final name, atomically, once every byte is written.
+type partialFile struct {
+	*os.File
+	final string
+}
+
+var (
+	// partialFiles holds the exports in progress, so AbortPartialFiles can remove them
+	partialFiles   = make(map[*partialFile]struct{})
+	partialFilesMu sync.Mutex
+)
+
+// exportDir returns the directory exports are written to, creating it if it does not exist yet.
+func exportDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	appPath := filepath.Join(homeDir, "sqlweb")
+	if err = os.MkdirAll(appPath, os.ModePerm); err != nil {
+		return "", err
+	}
+	return appPath, nil
+}
+
+// createPartial opens a temporary file for the export named fileName in the export directory,
+// only readable by its owner. It must be finished with commit or abort.
+func createPartial(fileName string) (*partialFile, error) {
+	dir, err := exportDir()
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.CreateTemp(dir, fileName+".*"+partialSuffix)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &partialFile{File: file, final: filepath.Join(dir, fileName)}
+	partialFilesMu.Lock()
+	partialFiles[p] = struct{}{}
+	partialFilesMu.Unlock()
+	return p, nil
+}
+
+// commit syncs the file and renames it to its final name, replacing an earlier export.
+// The file is removed instead if it was aborted in the meantime.
+func (p *partialFile) commit() error {
+	partialFilesMu.Lock()
+	defer partialFilesMu.Unlock()
+	if _, ok := partialFiles[p]; !ok {
+		return errors.New("export was cancelled")
+	}
+	delete(partialFiles, p)
+
+	err := p.Sync()
+	if err == nil {
+		err = p.Close()
+	} else {
+		_ = p.Close()
+	}
+	if err == nil {
+		err = os.Rename(p.Name(), p.final)
+	}
+	if err != nil {
+		_ = os.Remove(p.Name())
+	}
+	return err
+}
+
+// abort closes and removes the file. It does nothing once the file is committed or already aborted.
+func (p *partialFile) abort() {
+	partialFilesMu.Lock()
+	defer partialFilesMu.Unlock()
+	if _, ok := partialFiles[p]; !ok {
+		return
+	}
+	delete(partialFiles, p)
+	_ = p.Close()
+	_ = os.Remove(p.Name())
+}
+
+// AbortPartialFiles removes the exports still being written, e.g. when the server shuts down.
+// The exports writing them fail instead of producing a file.
+func AbortPartialFiles() {
+	partialFilesMu.Lock()
+	defer partialFilesMu.Unlock()
+	for p := range partialFiles {
+		_ = p.Close()
+		_ = os.Remove(p.Name())
+		delete(partialFiles, p)
+	}
+}
+
+// SweepPartialFiles removes the files left in the export directory by exports that never finished,
+// such as those of a crashed server, once they are older than maxAge. It returns how many it removed.
+func SweepPartialFiles(maxAge time.Duration) (int, error) {
+	dir, err := exportDir()
+	if err != nil {
+		return 0, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), partialSuffix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < maxAge {
+			continue
+		}
+		if err = os.Remove(filepath.Join(dir, entry.Name())); err == nil {
+			removed++
+		}
+	}
+	return removed, nil
+}
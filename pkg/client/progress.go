@@ -0,0 +1,68 @@
+package client
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	_sql "github.com/yazeed1s/sqlweb/db/sql"
+)
+
+// ExportProgress follows a streamed export, see ExportWithTemplate.
+type ExportProgress interface {
+	// ExpectRows is called before anything is written with the estimated number of rows, -1 without one
+	ExpectRows(rows int64)
+	// RowWritten is called once each row has been written
+	RowWritten()
+}
+
+// estimateTemplateRows returns the number of rows the template is expected to export, from the statistics
+// the database keeps on its table, or -1 when there are none or the template filters the rows.
+// It runs a single query on the statistics, never counts the rows.
+func (c *Client) estimateTemplateRows(ctx context.Context, t *ExportTemplate) int64 {
+	if len(t.Filter) > 0 {
+		return -1
+	}
+	rows := c.estimateRows(ctx, t.Table)
+	if rows >= 0 && c.Settings.MaxExportRows > 0 && rows > int64(c.Settings.MaxExportRows) {
+		rows = int64(c.Settings.MaxExportRows)
+	}
+	return rows
+}
+
+// estimateRows returns the row count of the table kept in the statistics of the database: TABLE_ROWS in MySQL,
+// reltuples in PostgreSQL and sqlite_stat1 in SQLite, once analyzed. It is -1 when there is none.
+func (c *Client) estimateRows(ctx context.Context, table string) int64 {
+	var (
+		dbType = c.Type.String()
+		query  string
+		rows   sql.NullInt64
+		stat   sql.NullString
+		err    error
+	)
+
+	switch strings.ToLower(dbType) {
+	case strings.ToLower(_sql.MySQL.String()):
+		query = fmt.Sprintf(_sql.MySQLEstimateRows, QuoteLiteral(dbType, c.Schema.Name), QuoteLiteral(dbType, table))
+		err = c.Database.QueryRowContext(ctx, query).Scan(&rows)
+	case strings.ToLower(_sql.PostgreSQL.String()):
+		query = fmt.Sprintf(_sql.PostgreSQLEstimateRows, QuoteLiteral(dbType, c.Schema.Name), QuoteLiteral(dbType, table))
+		err = c.Database.QueryRowContext(ctx, query).Scan(&rows)
+	case strings.ToLower(_sql.SQLite.String()):
+		query = fmt.Sprintf(_sql.SQLiteEstimateRows, QuoteLiteral(dbType, table))
+		err = c.Database.QueryRowContext(ctx, query).Scan(&stat)
+		// the stat starts with the number of rows of the table, followed by those of the index when it is one
+		if fields := strings.Fields(stat.String); err == nil && len(fields) > 0 {
+			rows.Int64, err = strconv.ParseInt(fields[0], 10, 64)
+			rows.Valid = err == nil
+		}
+	default:
+		return -1
+	}
+	if err != nil || !rows.Valid || rows.Int64 < 0 {
+		return -1
+	}
+	return rows.Int64
+}
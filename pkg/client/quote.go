@@ -0,0 +1,34 @@
+package client
+
+import (
+	"strings"
+
+	_sql "github.com/yazeed1s/sqlweb/db/sql"
+)
+
+// QuoteIdentifier quotes a table, column or schema name for the given database type,
+// doubling any quote character the name itself contains.
+func QuoteIdentifier(dbType, name string) string {
+	if strings.EqualFold(dbType, _sql.MySQL.String()) {
+		return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// QualifiedTable returns the quoted schema.table name for the given database type.
+// The schemas of SQLite are its attached databases, so the table name alone is returned for main.
+func QualifiedTable(dbType, schema, table string) string {
+	if schema == "" || strings.EqualFold(dbType, _sql.SQLite.String()) && strings.EqualFold(schema, "main") {
+		return QuoteIdentifier(dbType, table)
+	}
+	return QuoteIdentifier(dbType, schema) + "." + QuoteIdentifier(dbType, table)
+}
+
+// QuoteLiteral quotes a string literal for the given database type.
+// MySQL also treats backslashes as escape characters, so they are doubled as well.
+func QuoteLiteral(dbType, value string) string {
+	if strings.EqualFold(dbType, _sql.MySQL.String()) {
+		value = strings.ReplaceAll(value, `\`, `\\`)
+	}
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
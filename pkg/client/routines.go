@@ -0,0 +1,61 @@
+package client
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	_sql "github.com/yazeed1s/sqlweb/db/sql"
+)
+
+// Routine is a stored procedure or function of the schema.
+type Routine struct {
+	Name string `json:"name"`
+	// Type is PROCEDURE or FUNCTION
+	Type string `json:"type"`
+	// Definition is the body of the routine, empty when the user cannot read it
+	Definition string `json:"definition"`
+}
+
+// GetRoutines returns the stored procedures and functions of the schema, from information_schema.ROUTINES.
+// SQLite has no routines, so the list is empty.
+func (c *Client) GetRoutines() ([]Routine, error) {
+	if c.Database == nil {
+		return nil, errors.New("database connection is nil")
+	}
+
+	var (
+		dbType   = c.Type.String()
+		query    string
+		rows     *sql.Rows
+		err      error
+		routines = make([]Routine, 0)
+	)
+
+	switch strings.ToLower(dbType) {
+	case strings.ToLower(_sql.MySQL.String()):
+		query = fmt.Sprintf(_sql.MySQLRoutines, QuoteLiteral(dbType, c.Schema.Name))
+	case strings.ToLower(_sql.PostgreSQL.String()):
+		query = fmt.Sprintf(_sql.PostgreSQLRoutines, QuoteLiteral(dbType, c.Schema.Name))
+	case strings.ToLower(_sql.SQLite.String()):
+		return routines, nil
+	default:
+		return nil, fmt.Errorf("unsupported database type: %s", dbType)
+	}
+
+	rows, err = c.Database.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var routine Routine
+		if err = rows.Scan(&routine.Name, &routine.Type, &routine.Definition); err != nil {
+			return nil, err
+		}
+		routines = append(routines, routine)
+	}
+	return routines, rows.Err()
+}
@@ -0,0 +1,652 @@
+package client
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// Rows holds the rows of a result column by column. Each column keeps its values in a slice of their type
+// with a bitmap of the NULL ones, so reading a row allocates neither a map nor an interface per value.
+// Rows are encoded to JSON as an array of objects keyed by column, exactly like a []Row of the same values,
+// see MarshalJSON. A nil *Rows is encoded as null and holds no rows.
+type Rows struct {
+	names   []string
+	columns []column
+	n       int
+	// keys are the keys of a row object, sorted the way encoding/json sorts the keys of a map
+	keys []rowKey
+	// null replaces NULL values in JSON when set, see NullFormat.JSONRows
+	null *string
+	// renamed lists the columns renamed by DistinctColumns
+	renamed []ColumnRename
+}
+
+// rowKey is a key of the row objects and the column it holds.
+type rowKey struct {
+	name    string
+	column  int
+	encoded []byte
+}
+
+// columnKind is the type of the values a column holds.
+type columnKind uint8
+
+const (
+	// kindNull is the kind of a column that has only held NULL values so far
+	kindNull columnKind = iota
+	kindInt
+	kindFloat
+	kindBool
+	kindString
+	kindTime
+	// kindAny holds values of another type, or of several types, as interfaces
+	kindAny
+)
+
+// column holds the values of a column; only the slice of its kind is used, and it holds a zero value for every NULL.
+type column struct {
+	kind   columnKind
+	nulls  []uint64
+	ints   []int64
+	floats []float64
+	bools  []bool
+	strs   []string
+	times  []time.Time
+	values []interface{}
+}
+
+// NewRows returns an empty result with the given columns, in the order the query returned them.
+func NewRows(columns []string) *Rows {
+	names, renamed := DistinctColumns(columns)
+	rows := &Rows{names: names, columns: make([]column, len(names)), renamed: renamed}
+	rows.keys = make([]rowKey, 0, len(names))
+	for i, name := range names {
+		encoded := appendJSONString(nil, name)
+		rows.keys = append(rows.keys, rowKey{name: name, column: i, encoded: append(encoded, ':')})
+	}
+	sort.Slice(rows.keys, func(i, j int) bool { return rows.keys[i].name < rows.keys[j].name })
+	return rows
+}
+
+// ColumnRename reports a column of a result renamed because an earlier column has the same name,
+// like the second id of SELECT a.id, b.id FROM a JOIN b, which would otherwise replace the first in rows.
+type ColumnRename struct {
+	// Index is the position of the column in the result, from 0
+	Index  int    `json:"index"`
+	Column string `json:"column"`
+	Name   string `json:"name"`
+}
+
+// DistinctColumns renames the columns named like an earlier column with the first free suffix
+// of _2, _3 and so on, and returns the names along with the renames. Drivers do not tell the table
+// of a column, so the names cannot be prefixed with it.
+func DistinctColumns(columns []string) ([]string, []ColumnRename) {
+	var (
+		taken   = make(map[string]bool, len(columns))
+		names   []string
+		renamed []ColumnRename
+	)
+	for _, name := range columns {
+		taken[name] = true
+	}
+	if len(taken) == len(columns) {
+		return columns, nil
+	}
+
+	names = make([]string, len(columns))
+	seen := make(map[string]bool, len(columns))
+	for i, name := range columns {
+		names[i] = name
+		if !seen[name] {
+			seen[name] = true
+			continue
+		}
+		for n := 2; ; n++ {
+			candidate := fmt.Sprintf("%s_%d", name, n)
+			if !taken[candidate] {
+				taken[candidate] = true
+				names[i] = candidate
+				break
+			}
+		}
+		renamed = append(renamed, ColumnRename{Index: i, Column: name, Name: names[i]})
+	}
+	return names, renamed
+}
+
+// Renamed returns the columns renamed because an earlier column has the same name, see DistinctColumns.
+func (r *Rows) Renamed() []ColumnRename {
+	if r == nil {
+		return nil
+	}
+	return r.renamed
+}
+
+// Len returns the number of rows.
+func (r *Rows) Len() int {
+	if r == nil {
+		return 0
+	}
+	return r.n
+}
+
+// Columns returns the columns of the rows, in the order the query returned them.
+func (r *Rows) Columns() []string {
+	if r == nil {
+		return nil
+	}
+	return r.names
+}
+
+// Row returns the i-th row as a map, as it is encoded to JSON.
+func (r *Rows) Row(i int) Row {
+	row := make(Row, len(r.keys))
+	for _, key := range r.keys {
+		row[key.name] = r.value(i, key.column)
+	}
+	return row
+}
+
+// Maps returns every row as a map, nil when there are none.
+func (r *Rows) Maps() []Row {
+	if r.Len() == 0 {
+		return nil
+	}
+	rows := make([]Row, r.n)
+	for i := range rows {
+		rows[i] = r.Row(i)
+	}
+	return rows
+}
+
+// Append adds a row, its values ordered like the columns.
+func (r *Rows) Append(values ...interface{}) {
+	for i, v := range values {
+		r.columns[i].append(r.n, v)
+	}
+	r.n++
+}
+
+// value returns the value of a row in a column, the NULL placeholder when it is set and the value is NULL.
+func (r *Rows) value(row, col int) interface{} {
+	c := &r.columns[col]
+	if c.isNull(row) {
+		if r.null != nil {
+			return *r.null
+		}
+		return nil
+	}
+	switch c.kind {
+	case kindInt:
+		return c.ints[row]
+	case kindFloat:
+		return c.floats[row]
+	case kindBool:
+		return c.bools[row]
+	case kindString:
+		return c.strs[row]
+	case kindTime:
+		return c.times[row]
+	default:
+		return c.values[row]
+	}
+}
+
+// MarshalJSON writes the rows as an array of objects straight from the columns, the way encoding/json
+// writes a []Row: keys sorted and values encoded alike. HTML characters are left to the encoder to escape.
+func (r *Rows) MarshalJSON() ([]byte, error) {
+	if r == nil {
+		return []byte("null"), nil
+	}
+
+	return r.appendJSON(make([]byte, 0, 64))
+}
+
+// appendJSON appends the rows as MarshalJSON encodes them.
+func (r *Rows) appendJSON(b []byte) ([]byte, error) {
+	if r == nil {
+		return append(b, "null"...), nil
+	}
+
+	var (
+		start = len(b)
+		err   error
+	)
+
+	b = append(b, '[')
+	for row := 0; row < r.n; row++ {
+		if row > 0 {
+			b = append(b, ',')
+		}
+		b = append(b, '{')
+		for k, key := range r.keys {
+			if k > 0 {
+				b = append(b, ',')
+			}
+			b = append(b, key.encoded...)
+			if b, err = r.appendValue(b, row, key.column); err != nil {
+				return nil, err
+			}
+		}
+		b = append(b, '}')
+		if row == 0 {
+			// the rest of the rows likely take as much room as the first
+			first := len(b) - start
+			b = slices.Grow(b, first*(r.n-1)+first/8)
+		}
+	}
+	return append(b, ']'), nil
+}
+
+// MarshalWithRows encodes v, whose field named key is encoded as null, with the rows in place of that null.
+// It lets a struct keep its public []Row field nil and have its rows encoded straight from their columns.
+// No field encoded before the key may hold the key itself. When rows is nil, v is encoded as it is.
+// HTML characters are left to the encoder to escape, as in MarshalJSON.
+func MarshalWithRows(v interface{}, key string, rows *Rows) ([]byte, error) {
+	encoded, err := appendMarshalled(nil, v)
+	if err != nil || rows == nil {
+		return encoded, err
+	}
+	field := appendJSONString(nil, key)
+	field = append(field, ":null"...)
+	i := bytes.Index(encoded, field)
+	if i < 0 {
+		return nil, fmt.Errorf("no null %s field to encode the rows in", key)
+	}
+	i += len(field) - len("null")
+
+	b := make([]byte, 0, len(encoded))
+	b = append(b, encoded[:i]...)
+	if b, err = rows.appendJSON(b); err != nil {
+		return nil, err
+	}
+	return append(b, encoded[i+len("null"):]...), nil
+}
+
+// UnmarshalJSON reads an array of row objects, such as MarshalJSON writes. The columns are the keys of
+// the objects, sorted, and a key missing from an object is NULL.
+func (r *Rows) UnmarshalJSON(data []byte) error {
+	var (
+		maps  []Row
+		names []string
+		seen  = make(map[string]bool)
+	)
+	if err := json.Unmarshal(data, &maps); err != nil {
+		return err
+	}
+	for _, row := range maps {
+		for name := range row {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	*r = *NewRows(names)
+	values := make([]interface{}, len(names))
+	for _, row := range maps {
+		for i, name := range names {
+			values[i] = row[name]
+		}
+		r.Append(values...)
+	}
+	return nil
+}
+
+// appendValue appends the JSON encoding of the value of a row in a column.
+func (r *Rows) appendValue(b []byte, row, col int) ([]byte, error) {
+	c := &r.columns[col]
+	if c.isNull(row) {
+		if r.null != nil {
+			return appendJSONString(b, *r.null), nil
+		}
+		return append(b, "null"...), nil
+	}
+	switch c.kind {
+	case kindInt:
+		return strconv.AppendInt(b, c.ints[row], 10), nil
+	case kindFloat:
+		return appendJSONFloat(b, c.floats[row])
+	case kindBool:
+		return strconv.AppendBool(b, c.bools[row]), nil
+	case kindString:
+		return appendJSONString(b, c.strs[row]), nil
+	case kindTime:
+		return appendJSONValue(b, c.times[row])
+	default:
+		return appendJSONValue(b, c.values[row])
+	}
+}
+
+// isNull tells whether the value of the row is NULL.
+func (c *column) isNull(row int) bool {
+	word := row / 64
+	return word < len(c.nulls) && c.nulls[word]&(1<<(row%64)) != 0
+}
+
+// append adds the value of the row, the number of values the column holds.
+func (c *column) append(row int, v interface{}) {
+	switch val := v.(type) {
+	case nil:
+		c.appendNull(row)
+	case int64:
+		if c.prepare(kindInt, row) {
+			c.ints = append(c.ints, val)
+			return
+		}
+		c.values = append(c.values, v)
+	case float64:
+		if c.prepare(kindFloat, row) {
+			c.floats = append(c.floats, val)
+			return
+		}
+		c.values = append(c.values, v)
+	case bool:
+		if c.prepare(kindBool, row) {
+			c.bools = append(c.bools, val)
+			return
+		}
+		c.values = append(c.values, v)
+	case string:
+		c.appendString(row, val)
+	case time.Time:
+		if c.prepare(kindTime, row) {
+			c.times = append(c.times, val)
+			return
+		}
+		c.values = append(c.values, v)
+	default:
+		c.prepare(kindAny, row)
+		c.values = append(c.values, v)
+	}
+}
+
+// appendString adds a string without boxing it, unless the column holds values of other types.
+func (c *column) appendString(row int, s string) {
+	if c.prepare(kindString, row) {
+		c.strs = append(c.strs, s)
+		return
+	}
+	c.values = append(c.values, s)
+}
+
+// appendNull adds a NULL: its bit is set and the slice of the column's kind gets a zero value.
+func (c *column) appendNull(row int) {
+	for len(c.nulls) <= row/64 {
+		c.nulls = append(c.nulls, 0)
+	}
+	c.nulls[row/64] |= 1 << (row % 64)
+	switch c.kind {
+	case kindInt:
+		c.ints = append(c.ints, 0)
+	case kindFloat:
+		c.floats = append(c.floats, 0)
+	case kindBool:
+		c.bools = append(c.bools, false)
+	case kindString:
+		c.strs = append(c.strs, "")
+	case kindTime:
+		c.times = append(c.times, time.Time{})
+	case kindAny:
+		c.values = append(c.values, nil)
+	}
+}
+
+// prepare readies the column for a value of the kind at the row. A column of NULLs takes the kind; a column
+// of another kind becomes a kindAny column, in which case prepare returns false and the value goes to values.
+func (c *column) prepare(kind columnKind, row int) bool {
+	switch c.kind {
+	case kind:
+		return true
+	case kindNull:
+		c.kind = kind
+		switch kind {
+		case kindInt:
+			c.ints = make([]int64, row)
+		case kindFloat:
+			c.floats = make([]float64, row)
+		case kindBool:
+			c.bools = make([]bool, row)
+		case kindString:
+			c.strs = make([]string, row)
+		case kindTime:
+			c.times = make([]time.Time, row)
+		default:
+			c.values = make([]interface{}, row)
+		}
+		return kind != kindAny
+	case kindAny:
+		return false
+	}
+
+	values := make([]interface{}, row, 2*row+1)
+	for i := range values {
+		if c.isNull(i) {
+			continue
+		}
+		switch c.kind {
+		case kindInt:
+			values[i] = c.ints[i]
+		case kindFloat:
+			values[i] = c.floats[i]
+		case kindBool:
+			values[i] = c.bools[i]
+		case kindString:
+			values[i] = c.strs[i]
+		case kindTime:
+			values[i] = c.times[i]
+		}
+	}
+	*c = column{kind: kindAny, nulls: c.nulls, values: values}
+	return false
+}
+
+// appendJSONString appends s as a JSON string the way encoding/json does, apart from the HTML escapes left to the encoder.
+// Strings needing escapes other than a quote or a backslash are left to encoding/json itself.
+func appendJSONString(b []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 || c == '"' || c == '\\' || c >= utf8.RuneSelf {
+			return appendEscapedString(b, s)
+		}
+	}
+	b = append(b, '"')
+	b = append(b, s...)
+	return append(b, '"')
+}
+
+func appendEscapedString(b []byte, s string) []byte {
+	start := len(b)
+	b = append(b, '"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				b = append(b, '\\', c)
+			case c < 0x20:
+				b, _ = appendMarshalled(b[:start], s)
+				return b
+			default:
+				b = append(b, c)
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 || r == '\u2028' || r == '\u2029' {
+			b, _ = appendMarshalled(b[:start], s)
+			return b
+		}
+		b = append(b, s[i:i+size]...)
+		i += size
+	}
+	return append(b, '"')
+}
+
+// appendJSONFloat appends f the way encoding/json encodes a float64.
+func appendJSONFloat(b []byte, f float64) ([]byte, error) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		// encoding/json refuses them
+		_, err := json.Marshal(f)
+		return nil, err
+	}
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	b = strconv.AppendFloat(b, f, format, -1, 64)
+	if format == 'e' {
+		// clean up e-09 to e-9
+		if n := len(b); n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+	}
+	return b, nil
+}
+
+// appendJSONValue appends the JSON encoding of a value of a kindAny column.
+func appendJSONValue(b []byte, v interface{}) ([]byte, error) {
+	switch val := v.(type) {
+	case nil:
+		return append(b, "null"...), nil
+	case int64:
+		return strconv.AppendInt(b, val, 10), nil
+	case float64:
+		return appendJSONFloat(b, val)
+	case bool:
+		return strconv.AppendBool(b, val), nil
+	case string:
+		return appendJSONString(b, val), nil
+	case time.Time:
+		encoded, err := val.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		return append(b, encoded...), nil
+	default:
+		return appendMarshalled(b, v)
+	}
+}
+
+// appendMarshalled appends the encoding of v by encoding/json, without escaping HTML characters, which
+// the encoder of the whole response does or not.
+func appendMarshalled(b []byte, v interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return append(b, bytes.TrimSuffix(buffer.Bytes(), []byte("\n"))...), nil
+}
+
+// rowReader reads the rows of a query into Rows, see ReadRows.
+type rowReader struct {
+	rows     *Rows
+	limit    CellLimit
+	budget   *ResultBudget
+	warnings []CellWarning
+	err      error
+}
+
+// cellScanner scans the values of a column straight into Rows: as a sql.Scanner it gets the value
+// the driver returned, which spares copying bytes into an interface{} only to convert them to a string.
+type cellScanner struct {
+	reader *rowReader
+	column int
+}
+
+func (s *cellScanner) Scan(src interface{}) error {
+	s.reader.scan(s.column, src)
+	return nil
+}
+
+// scan adds a value of the row being read: bytes become a string, values longer than the limit
+// become a *TruncatedCell and values that cannot be encoded an *UnreadableCell. The first error
+// of the budget is kept for ReadRows to return.
+func (r *rowReader) scan(i int, src interface{}) {
+	var (
+		row  = r.rows.n
+		name = r.rows.names[i]
+		c    = &r.rows.columns[i]
+		size int
+	)
+
+	switch v := src.(type) {
+	case []byte:
+		if r.limit.fitsBytes(v) {
+			c.appendString(row, string(v))
+			size = len(v) + 2
+		} else {
+			size = r.truncate(i, src)
+		}
+	case string:
+		if r.limit.fits(v) {
+			c.appendString(row, v)
+			size = len(v) + 2
+		} else {
+			size = r.truncate(i, src)
+		}
+	default:
+		src = readable(name, src)
+		c.append(row, src)
+		if r.budget != nil {
+			size = encodedSize(src)
+		}
+	}
+	if r.err == nil {
+		r.err = r.budget.charge(name, size)
+	}
+}
+
+// truncate adds the value as a *TruncatedCell and reports it, returning its encoded size.
+func (r *rowReader) truncate(i int, src interface{}) int {
+	value, _ := r.limit.Value(src)
+	cell := value.(*TruncatedCell)
+	r.warnings = append(r.warnings, CellWarning{Row: r.rows.n, Column: r.rows.names[i], Bytes: cell.Bytes})
+	r.rows.columns[i].append(r.rows.n, value)
+	return encodedSize(value)
+}
+
+// ReadRows reads the rows of the current result set. Values longer than the limit are truncated and reported
+// in the warnings, see CellLimit, and reading stops with util.ErrResultTooLarge once the rows are over the budget.
+func ReadRows(rows *sql.Rows, limit CellLimit, budget *ResultBudget) (*Rows, []CellWarning, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		reader   = &rowReader{rows: NewRows(columns), limit: limit, budget: budget}
+		scanners = make([]cellScanner, len(columns))
+		dest     = make([]interface{}, len(columns))
+	)
+	for i := range scanners {
+		scanners[i] = cellScanner{reader: reader, column: i}
+		dest[i] = &scanners[i]
+	}
+	for rows.Next() {
+		if err = rows.Scan(dest...); err != nil {
+			return nil, nil, err
+		}
+		if reader.err != nil {
+			return nil, nil, reader.err
+		}
+		reader.rows.n++
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	return reader.rows, reader.warnings, nil
+}
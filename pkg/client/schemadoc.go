@@ -0,0 +1,256 @@
+package client
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"go/format"
+	"strconv"
+	"strings"
+	"unicode"
+
+	_sql "github.com/yazeed1s/sqlweb/db/sql"
+)
+
+// SchemaDocument describes every table of the schema for code generators: its columns with their
+// portable type, nullability, default and keys.
+type SchemaDocument struct {
+	Dialect string        `json:"dialect"`
+	Schema  string        `json:"schema"`
+	Tables  []SchemaTable `json:"tables"`
+}
+
+// SchemaTable is a table of a SchemaDocument. PrimaryKey lists its key columns in key order.
+type SchemaTable struct {
+	Name       string         `json:"name"`
+	Comment    string         `json:"comment,omitempty"`
+	Columns    []SchemaColumn `json:"columns"`
+	PrimaryKey []string       `json:"primaryKey"`
+}
+
+// SchemaColumn is a column of a SchemaTable. Type is the type as the database reports it and
+// PortableType its cross-dialect equivalent, see _sql.NormalizeType.
+type SchemaColumn struct {
+	Name         string            `json:"name"`
+	Type         string            `json:"type"`
+	PortableType _sql.PortableType `json:"portableType"`
+	Nullable     bool              `json:"nullable"`
+	Default      *string           `json:"default"`
+	PrimaryKey   bool              `json:"primaryKey"`
+	Generated    bool              `json:"generated"`
+	ForeignKey   *ColumnRef        `json:"foreignKey,omitempty"`
+	Comment      string            `json:"comment,omitempty"`
+}
+
+// ColumnRef is the column a foreign key column references.
+type ColumnRef struct {
+	Table  string `json:"table"`
+	Column string `json:"column"`
+}
+
+// GetSchemaDocument describes every table of the schema, see SchemaDocument.
+func (c *Client) GetSchemaDocument() (*SchemaDocument, error) {
+	if c.Database == nil {
+		return nil, errors.New("database connection is nil")
+	}
+
+	var (
+		err    error
+		tables []string
+		doc    = &SchemaDocument{Dialect: c.Type.String(), Schema: c.Schema.Name, Tables: make([]SchemaTable, 0)}
+	)
+
+	tables, err = c.GetTableNames()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range tables {
+		table, err := c.schemaTable(name)
+		if err != nil {
+			return nil, fmt.Errorf("table %s: %w", name, err)
+		}
+		doc.Tables = append(doc.Tables, table)
+	}
+	return doc, nil
+}
+
+// schemaTable describes a table. The columns query returns a row per key a column is part of,
+// so the rows of a column are merged into one.
+func (c *Client) schemaTable(name string) (SchemaTable, error) {
+	var (
+		err         error
+		cols        []Column
+		foreignKeys map[string]ColumnRef
+		primary     = make(map[string]int)
+		index       = make(map[string]int)
+		table       = SchemaTable{Name: name, Columns: make([]SchemaColumn, 0), PrimaryKey: make([]string, 0)}
+	)
+
+	cols, err = c.GetColumns(name)
+	if err != nil {
+		return SchemaTable{}, err
+	}
+	table.Comment, err = c.GetTableComment(name)
+	if err != nil {
+		return SchemaTable{}, err
+	}
+	if c.Type == _sql.SQLite {
+		foreignKeys, err = getSQLiteForeignKeysHelper(fmt.Sprintf(_sql.SQLiteForeignKeys, name), c.Database)
+		if err != nil {
+			return SchemaTable{}, err
+		}
+	}
+
+	for _, col := range cols {
+		i, seen := index[col.Field]
+		if !seen {
+			i = len(table.Columns)
+			index[col.Field] = i
+			table.Columns = append(table.Columns, SchemaColumn{
+				Name:         col.Field,
+				Type:         col.Type,
+				PortableType: _sql.NormalizeType(c.Type, col.Type),
+				Nullable:     col.Nullable,
+				Default:      col.Default,
+				Generated:    col.IsGenerated,
+				Comment:      col.Comment,
+			})
+		}
+		column := &table.Columns[i]
+
+		switch {
+		case c.Type == _sql.SQLite:
+			// the key of a SQLite column is its position in the primary key, 0 when not part of it
+			if position, _ := strconv.Atoi(col.Key); position > 0 {
+				column.PrimaryKey, primary[col.Field] = true, position
+			}
+			if ref, ok := foreignKeys[col.Field]; ok {
+				column.ForeignKey = &ref
+			}
+		case col.Key == "PRI" && (col.ReferencedTable == "" || c.Type == _sql.PostgreSQL):
+			// PostgreSQL reports the table itself as the one a primary key references
+			if !column.PrimaryKey {
+				column.PrimaryKey, primary[col.Field] = true, len(primary)+1
+			}
+		case col.ReferencedTable != "" && (c.Type == _sql.MySQL || col.Key == "MUL"):
+			column.ForeignKey = &ColumnRef{Table: col.ReferencedTable, Column: col.ReferencedColumn}
+		}
+	}
+
+	table.PrimaryKey = make([]string, len(primary))
+	for field, position := range primary {
+		table.PrimaryKey[position-1] = field
+	}
+	return table, nil
+}
+
+// getSQLiteForeignKeysHelper reads the foreign keys of a SQLite table by their column.
+func getSQLiteForeignKeysHelper(query string, db *sql.DB) (map[string]ColumnRef, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("error executing query: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	foreignKeys := make(map[string]ColumnRef)
+	for rows.Next() {
+		var (
+			column string
+			ref    ColumnRef
+			to     sql.NullString
+		)
+		if err = rows.Scan(&column, &ref.Table, &to); err != nil {
+			return nil, err
+		}
+		// a foreign key without a column references the primary key of the other table
+		ref.Column = to.String
+		foreignKeys[column] = ref
+	}
+	return foreignKeys, rows.Err()
+}
+
+// goInitialisms are the words Go names spell in capitals.
+var goInitialisms = map[string]bool{
+	"api": true, "db": true, "html": true, "http": true, "id": true, "ip": true, "json": true,
+	"sql": true, "ssn": true, "uid": true, "uri": true, "url": true, "uuid": true, "xml": true,
+}
+
+// goName turns a table or column name into an exported Go identifier, e.g. user_id into UserID.
+func goName(name string) string {
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var b strings.Builder
+	for _, word := range words {
+		if goInitialisms[strings.ToLower(word)] {
+			b.WriteString(strings.ToUpper(word))
+			continue
+		}
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		b.WriteString(string(runes))
+	}
+	identifier := b.String()
+	if identifier == "" || !unicode.IsLetter([]rune(identifier)[0]) {
+		identifier = "X" + identifier
+	}
+	return identifier
+}
+
+// uniqueName returns name, or name with a number appended when it is already taken.
+func uniqueName(name string, taken map[string]bool) string {
+	unique := name
+	for i := 2; taken[unique]; i++ {
+		unique = name + strconv.Itoa(i)
+	}
+	taken[unique] = true
+	return unique
+}
+
+// GoStructs renders the document as Go source: a struct per table, its fields typed after the portable
+// type of their column, see _sql.PortableType.GoType, and tagged with the column name for db and json.
+func (d *SchemaDocument) GoStructs(packageName string) ([]byte, error) {
+	var (
+		body    bytes.Buffer
+		src     bytes.Buffer
+		imports = make(map[string]bool)
+		types   = make(map[string]bool)
+	)
+
+	for _, table := range d.Tables {
+		typeName := uniqueName(goName(table.Name), types)
+		fmt.Fprintf(&body, "\n// %s is a row of the %s table.\n", typeName, table.Name)
+		fmt.Fprintf(&body, "type %s struct {\n", typeName)
+		fields := make(map[string]bool)
+		for _, column := range table.Columns {
+			goType := column.PortableType.GoType(column.Nullable)
+			switch {
+			case strings.Contains(goType, "time."):
+				imports["time"] = true
+			case strings.Contains(goType, "json."):
+				imports["encoding/json"] = true
+			}
+			fmt.Fprintf(&body, "\t%s %s `db:%q json:%q`\n", uniqueName(goName(column.Name), fields), goType, column.Name, column.Name)
+		}
+		body.WriteString("}\n")
+	}
+
+	fmt.Fprintf(&src, "// Code generated by sqlweb from the %s schema (%s). DO NOT EDIT.\n\npackage %s\n", d.Schema, d.Dialect, packageName)
+	if len(imports) > 0 {
+		src.WriteString("\nimport (\n")
+		for _, path := range []string{"encoding/json", "time"} {
+			if imports[path] {
+				fmt.Fprintf(&src, "\t%q\n", path)
+			}
+		}
+		src.WriteString(")\n")
+	}
+	src.Write(body.Bytes())
+	return format.Source(src.Bytes())
+}
@@ -0,0 +1,250 @@
+package client
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	_sql "github.com/yazeed1s/sqlweb/db/sql"
+)
+
+// Search strategies, from the full-text index of the table when it has one.
+const (
+	// SearchMatch uses MATCH ... AGAINST on a MySQL FULLTEXT index
+	SearchMatch = "match"
+	// SearchTsquery matches the tsvector columns of a PostgreSQL table, ranked with ts_rank
+	SearchTsquery = "tsquery"
+	// SearchFTS5 uses MATCH on a SQLite FTS5 table
+	SearchFTS5 = "fts5"
+	// SearchLike looks for the text in every column with LIKE, unranked
+	SearchLike = "like"
+)
+
+// Search reports how a table was searched and how many rows matched in all.
+type Search struct {
+	Query    string   `json:"query"`
+	Strategy string   `json:"strategy"`
+	Columns  []string `json:"columns,omitempty"`
+	// Ranked is set when the rows are ordered by relevance, the best match first
+	Ranked  bool `json:"ranked"`
+	Matches int  `json:"matches"`
+}
+
+// searchClause is the condition of a search and the order of its matches, with their arguments.
+type searchClause struct {
+	where     string
+	whereArgs []interface{}
+	orderBy   string
+	orderArgs []interface{}
+}
+
+// SearchTable reads a page of the rows of the table that contain the text, see GetTable.
+// Tables with a full-text index are searched with it and their rows ranked; the others are
+// searched with LIKE on every column. Table.Search tells which strategy was used.
+func (c *Client) SearchTable(tableName, text string, page, perPage int, compact bool) (*Table, error) {
+	return c.getTable(context.Background(), tableName, TableQuery{Page: page, PerPage: perPage, Compact: compact, Search: text})
+}
+
+// SearchTableContext is like SearchTable, traced as a child of the span of ctx and cancelled with it.
+func (c *Client) SearchTableContext(ctx context.Context, tableName, text string, page, perPage int, compact bool) (*Table, error) {
+	return c.getTable(ctx, tableName, TableQuery{Page: page, PerPage: perPage, Compact: compact, Search: text})
+}
+
+// fullTextIndex finds the full-text index of the table: the columns of its widest FULLTEXT index
+// on MySQL, its tsvector columns on PostgreSQL, and on SQLite whether it is an FTS5 table.
+// The strategy is SearchLike when there is none.
+func (c *Client) fullTextIndex(tableName string) (string, []string, error) {
+	var (
+		err      error
+		query    string
+		tableSQL string
+		columns  []string
+	)
+
+	switch strings.ToLower(c.Type.String()) {
+	case strings.ToLower(_sql.MySQL.String()):
+		query = fmt.Sprintf(_sql.MySQLFullTextIndexes, c.Schema.Name, tableName)
+		columns, err = getFullTextColumnsHelper(query, c.Database)
+		if err != nil || len(columns) == 0 {
+			return SearchLike, nil, err
+		}
+		return SearchMatch, columns, nil
+	case strings.ToLower(_sql.PostgreSQL.String()):
+		query = fmt.Sprintf(_sql.PostgreSQLTsvectorColumns, c.Schema.Name, tableName)
+		columns, err = getFullTextColumnsHelper(query, c.Database)
+		if err != nil || len(columns) == 0 {
+			return SearchLike, nil, err
+		}
+		return SearchTsquery, columns, nil
+	case strings.ToLower(_sql.SQLite.String()):
+		err = c.Database.QueryRow(fmt.Sprintf(_sql.SQLiteTableSQL, tableName)).Scan(&tableSQL)
+		if err != nil && err != sql.ErrNoRows {
+			return SearchLike, nil, err
+		}
+		if strings.Contains(strings.ToUpper(tableSQL), "USING FTS5") {
+			return SearchFTS5, nil, nil
+		}
+		return SearchLike, nil, nil
+	default:
+		return "", nil, fmt.Errorf("unsupported database type: %s", c.Type.String())
+	}
+}
+
+// getFullTextColumnsHelper reads (index, column) rows and returns the columns of the index with the most.
+func getFullTextColumnsHelper(query string, db *sql.DB) ([]string, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("error executing query: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	var (
+		order   []string
+		indexes = make(map[string][]string)
+	)
+	for rows.Next() {
+		var index, column string
+		if err = rows.Scan(&index, &column); err != nil {
+			return nil, err
+		}
+		if _, ok := indexes[index]; !ok {
+			order = append(order, index)
+		}
+		indexes[index] = append(indexes[index], column)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var widest []string
+	for _, index := range order {
+		if len(indexes[index]) > len(widest) {
+			widest = indexes[index]
+		}
+	}
+	return widest, nil
+}
+
+// buildSearch builds the condition and order of a search with the given strategy. Full-text
+// columns are only used by SearchMatch and SearchTsquery, SearchLike searches every column.
+func buildSearch(dbType, table, strategy, text string, fullText []string, cols []Column) searchClause {
+	var (
+		clause searchClause
+		parts  []string
+		ranks  []string
+	)
+
+	switch strategy {
+	case SearchMatch:
+		quoted := make([]string, len(fullText))
+		for i, column := range fullText {
+			quoted[i] = QuoteIdentifier(dbType, column)
+		}
+		match := fmt.Sprintf("MATCH (%s) AGAINST (? IN NATURAL LANGUAGE MODE)", strings.Join(quoted, ", "))
+		clause.where, clause.whereArgs = match, []interface{}{text}
+		clause.orderBy, clause.orderArgs = match+" DESC", []interface{}{text}
+	case SearchTsquery:
+		for _, column := range fullText {
+			parts = append(parts, fmt.Sprintf("%s @@ plainto_tsquery($1)", QuoteIdentifier(dbType, column)))
+			ranks = append(ranks, fmt.Sprintf("ts_rank(%s, plainto_tsquery($1))", QuoteIdentifier(dbType, column)))
+		}
+		clause.where, clause.whereArgs = "("+strings.Join(parts, " OR ")+")", []interface{}{text}
+		clause.orderBy = strings.Join(ranks, " + ") + " DESC"
+	case SearchFTS5:
+		clause.where, clause.whereArgs = QuoteIdentifier(dbType, table)+" MATCH ?", []interface{}{fts5Query(text)}
+		clause.orderBy = "rank"
+	default:
+		like, cast := "LIKE", "TEXT"
+		switch strings.ToLower(dbType) {
+		case strings.ToLower(_sql.MySQL.String()):
+			cast = "CHAR"
+		case strings.ToLower(_sql.PostgreSQL.String()):
+			// LIKE ignores case on MySQL and, for ASCII, on SQLite
+			like = "ILIKE"
+		}
+		pattern := "%" + escapeLike(text) + "%"
+		for i, col := range cols {
+			placeholder := Placeholder(dbType, 1)
+			if placeholder == "?" {
+				clause.whereArgs = append(clause.whereArgs, pattern)
+			} else if i == 0 {
+				clause.whereArgs = []interface{}{pattern}
+			}
+			parts = append(parts, fmt.Sprintf("CAST(%s AS %s) %s %s ESCAPE '!'",
+				QuoteIdentifier(dbType, col.Field), cast, like, placeholder))
+		}
+		clause.where = "(" + strings.Join(parts, " OR ") + ")"
+	}
+	return clause
+}
+
+// escapeLike escapes the wildcards of LIKE, and '!' which escapes them, so the text is matched as is.
+func escapeLike(text string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(text)
+}
+
+// fts5Query quotes each word of the text as an FTS5 string, so that the text is searched for
+// as words rather than parsed as an FTS5 query, which fails on e.g. a lone quote or a dash.
+func fts5Query(text string) string {
+	words := strings.Fields(text)
+	for i, word := range words {
+		words[i] = `"` + strings.ReplaceAll(word, `"`, `""`) + `"`
+	}
+	return strings.Join(words, " ")
+}
+
+// buildSearchSelect builds the query reading a page of the matches, and the query counting them all.
+func buildSearchSelect(dbType, schema, table string, cols []Column, clause searchClause, perPage, offset int) (string, []interface{}, string) {
+	columnList := make([]string, len(cols))
+	for i, col := range cols {
+		columnList[i] = QuoteIdentifier(dbType, col.Field)
+	}
+	from := QualifiedTable(dbType, schema, table) + " WHERE " + clause.where
+
+	query := "SELECT " + strings.Join(columnList, ", ") + " FROM " + from
+	args := append([]interface{}{}, clause.whereArgs...)
+	if clause.orderBy != "" {
+		query += " ORDER BY " + clause.orderBy
+		args = append(args, clause.orderArgs...)
+	}
+	query += fmt.Sprintf(" LIMIT %d OFFSET %d", perPage, offset)
+	return query, args, "SELECT COUNT(*) FROM " + from
+}
+
+// searchTable builds the query reading a page of the rows matching the text and counts the matches.
+// Ranked matches are sorted by relevance, the others in the given order, which is returned when it is used.
+func (c *Client) searchTable(ctx context.Context, tableName, text string, cols []Column, order *TableOrder, perPage, offset int) (*Search, *TableOrder, string, []interface{}, error) {
+	strategy, fullText, err := c.fullTextIndex(tableName)
+	if err != nil {
+		return nil, nil, "", nil, err
+	}
+
+	clause := buildSearch(c.Type.String(), tableName, strategy, text, fullText, cols)
+	if clause.orderBy != "" {
+		order = nil
+	} else if order != nil {
+		clause.orderBy = order.orderBy(c.Type.String())
+	}
+	schema, table, err := c.sourceOf(tableName)
+	if err != nil {
+		return nil, nil, "", nil, err
+	}
+	query, args, countQuery := buildSearchSelect(c.Type.String(), schema, table, cols, clause, perPage, offset)
+
+	search := &Search{
+		Query:    text,
+		Strategy: strategy,
+		Columns:  fullText,
+		Ranked:   strategy != SearchLike,
+	}
+	if err = c.Database.QueryRowContext(ctx, countQuery, clause.whereArgs...).Scan(&search.Matches); err != nil {
+		return nil, nil, "", nil, fmt.Errorf("error counting matches: %w", err)
+	}
+	return search, order, query, args, nil
+}
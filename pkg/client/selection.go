@@ -0,0 +1,357 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	_sql "github.com/yazeed1s/sqlweb/db/sql"
+)
+
+// maxPlaceholdersPerQuery keeps every chunk of a key lookup below the smallest bind-parameter
+// limit of the supported drivers (999 for older SQLite builds).
+const maxPlaceholdersPerQuery = 900
+
+// Selection holds rows picked by key, in the table's column order.
+type Selection struct {
+	Columns []Column
+	Rows    []Row
+	// Missing lists the requested keys that matched no row
+	Missing [][]interface{}
+	// Nulls is how NULL values are rendered by CSV and JSON
+	Nulls NullFormat
+	// Floats is how floats are rendered by CSV
+	Floats FloatFormat
+}
+
+// Placeholder returns the n-th (1-based) bind parameter for the given database type.
+func Placeholder(dbType string, n int) string {
+	if strings.EqualFold(dbType, _sql.PostgreSQL.String()) {
+		return fmt.Sprintf("$%d", n)
+	}
+	return "?"
+}
+
+// buildSelectByKeys builds a SELECT of the given columns restricted to the given key tuples
+// with a parameterized IN clause, and returns it with its arguments.
+func buildSelectByKeys(dbType, schema, table string, cols []Column, keyColumns []string, keys [][]interface{}) (string, []interface{}) {
+	var (
+		columnList []string
+		keyList    []string
+		tuples     []string
+		args       []interface{}
+		n          int
+	)
+
+	for _, col := range cols {
+		columnList = append(columnList, QuoteIdentifier(dbType, col.Field))
+	}
+	for _, key := range keyColumns {
+		keyList = append(keyList, QuoteIdentifier(dbType, key))
+	}
+
+	for _, key := range keys {
+		params := make([]string, len(key))
+		for i, v := range key {
+			n++
+			params[i] = Placeholder(dbType, n)
+			args = append(args, v)
+		}
+		tuples = append(tuples, "("+strings.Join(params, ", ")+")")
+	}
+
+	query := fmt.Sprintf(
+		"SELECT %s FROM %s WHERE (%s) IN (%s)",
+		strings.Join(columnList, ", "),
+		QualifiedTable(dbType, schema, table),
+		strings.Join(keyList, ", "),
+		strings.Join(tuples, ", "),
+	)
+	return query, args
+}
+
+// keyString renders a key tuple so that values decoded from JSON and values scanned
+// from the database compare equal.
+func keyString(values []interface{}) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		if b, ok := v.([]byte); ok {
+			v = string(b)
+		}
+		parts[i] = fmt.Sprintf("%v", v)
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// GetRowsByKeys fetches exactly the rows whose key columns match one of the given key tuples.
+// Keys are looked up in chunks so that large selections stay within placeholder limits.
+// Keys that match no row are reported in Selection.Missing instead of failing the lookup.
+func (c *Client) GetRowsByKeys(tableName string, keyColumns []string, keys [][]interface{}) (*Selection, error) {
+	var (
+		err       error
+		selection *Selection
+	)
+
+	selection = &Selection{Rows: make([]Row, 0, len(keys)), Nulls: c.Nulls, Floats: c.Floats}
+	selection.Columns, selection.Missing, err = c.rowsByKeys(context.Background(), tableName, keyColumns, keys,
+		func(rows []Row) error {
+			selection.Rows = append(selection.Rows, rows...)
+			return nil
+		}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return selection, nil
+}
+
+// WriteRowsByKeys is like GetRowsByKeys but streams the rows to w as each chunk of keys is read, in format
+// (csv or json) and in the layout of Selection.CSV and Selection.JSON, without the omitted columns.
+// Nothing is written when the lookup fails before its first chunk. It returns the keys that matched no row.
+// A w implementing ExportProgress follows the rows as they are written.
+func (c *Client) WriteRowsByKeys(ctx context.Context, tableName string, keyColumns []string, keys [][]interface{},
+	omitted []string, format string, w io.Writer) ([][]interface{}, error) {
+	var (
+		err      error
+		missing  [][]interface{}
+		writer   *selectionWriter
+		progress ExportProgress
+	)
+
+	progress, _ = w.(ExportProgress)
+	if progress != nil {
+		progress.ExpectRows(int64(len(keys)))
+	}
+	_, missing, err = c.rowsByKeys(ctx, tableName, keyColumns, keys, func(rows []Row) error {
+		for _, row := range rows {
+			if err := writer.row(row); err != nil {
+				return err
+			}
+			if progress != nil {
+				if err := writer.flush(); err != nil {
+					return err
+				}
+				progress.RowWritten()
+			}
+		}
+		return writer.flush()
+	}, func(cols []Column) error {
+		selection := &Selection{Columns: cols, Nulls: c.Nulls, Floats: c.Floats}
+		selection.Omit(omitted)
+		writer = newSelectionWriter(w, format, selection)
+		return writer.begin()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return missing, writer.end()
+}
+
+// rowsByKeys looks up the rows matching the keys by chunks, passing those of each chunk to each, and returns
+// the columns of the table and the keys that matched no row. begin, when not nil, is called with the columns
+// before the first chunk is read.
+func (c *Client) rowsByKeys(ctx context.Context, tableName string, keyColumns []string, keys [][]interface{},
+	each func(rows []Row) error, begin func(cols []Column) error) ([]Column, [][]interface{}, error) {
+	if c.Database == nil {
+		return nil, nil, errors.New("database connection is nil")
+	}
+	if len(keyColumns) == 0 {
+		return nil, nil, errors.New("at least one key column is required")
+	}
+	for _, key := range keys {
+		if len(key) != len(keyColumns) {
+			return nil, nil, fmt.Errorf("key %v does not match key columns %v", key, keyColumns)
+		}
+	}
+
+	var (
+		err       error
+		cols      []Column
+		missing   [][]interface{}
+		found     map[string]bool
+		chunkSize int
+	)
+
+	cols, err = c.GetColumns(tableName)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(cols) == 0 {
+		return nil, nil, fmt.Errorf("table '%s' not found", tableName)
+	}
+	if begin != nil {
+		if err = begin(cols); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	found = make(map[string]bool, len(keys))
+	chunkSize = maxPlaceholdersPerQuery / len(keyColumns)
+	for start := 0; start < len(keys); start += chunkSize {
+		end := start + chunkSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		query, args := buildSelectByKeys(c.Type.String(), c.Schema.Name, tableName, cols, keyColumns, keys[start:end])
+		data, _, err := getTableHelper(ctx, query, c.Database, c.Cells.export(), args...)
+		if err != nil {
+			return nil, nil, err
+		}
+		rows := data.Maps()
+		for _, row := range rows {
+			values := make([]interface{}, len(keyColumns))
+			for i, key := range keyColumns {
+				values[i] = row[key]
+			}
+			found[keyString(values)] = true
+		}
+		if err = each(rows); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for _, key := range keys {
+		if !found[keyString(key)] {
+			missing = append(missing, key)
+		}
+	}
+	return cols, missing, nil
+}
+
+// Omit leaves the given columns out of the selection when it is rendered, e.g. those ExportColumns omits.
+func (s *Selection) Omit(columns []string) {
+	omitted := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		omitted[column] = true
+	}
+	kept := make([]Column, 0, len(s.Columns))
+	for _, col := range s.Columns {
+		if !omitted[col.Field] {
+			kept = append(kept, col)
+		}
+	}
+	s.Columns = kept
+}
+
+// CSV renders the selection as CSV, with a header row and columns in table order.
+func (s *Selection) CSV() ([]byte, error) {
+	return s.render("csv")
+}
+
+// JSON renders the selection as an array of objects whose keys follow the table's column order.
+func (s *Selection) JSON() ([]byte, error) {
+	return s.render("json")
+}
+
+func (s *Selection) render(format string) ([]byte, error) {
+	var buffer bytes.Buffer
+
+	writer := newSelectionWriter(&buffer, format, s)
+	if err := writer.begin(); err != nil {
+		return nil, err
+	}
+	for _, row := range s.Rows {
+		if err := writer.row(row); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.end(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// selectionWriter writes the rows of a selection to w one at a time, as CSV or as JSON.
+type selectionWriter struct {
+	w         io.Writer
+	selection *Selection
+	json      bool
+	csv       *csv.Writer
+	record    []string
+	rows      int
+	buffer    bytes.Buffer
+}
+
+// newSelectionWriter returns a writer of the rows of the selection's columns in format, JSON unless it is csv.
+func newSelectionWriter(w io.Writer, format string, s *Selection) *selectionWriter {
+	writer := &selectionWriter{w: w, selection: s, json: !strings.EqualFold(format, "csv")}
+	if !writer.json {
+		writer.csv = csv.NewWriter(w)
+		writer.record = make([]string, len(s.Columns))
+	}
+	return writer
+}
+
+// begin writes what comes before the rows: the header row of CSV, the opening bracket of JSON.
+func (s *selectionWriter) begin() error {
+	if s.json {
+		_, err := io.WriteString(s.w, "[")
+		return err
+	}
+	for i, col := range s.selection.Columns {
+		s.record[i] = col.Field
+	}
+	return s.csv.Write(s.record)
+}
+
+// row writes a row. CSV rows are buffered until the next flush.
+func (s *selectionWriter) row(row Row) error {
+	if !s.json {
+		for i, col := range s.selection.Columns {
+			if f, ok := row[col.Field].(float64); ok {
+				s.record[i] = s.selection.Floats.Text(f, 64)
+				continue
+			}
+			s.record[i] = s.selection.Nulls.Text(row[col.Field])
+		}
+		return s.csv.Write(s.record)
+	}
+
+	s.buffer.Reset()
+	if s.rows > 0 {
+		s.buffer.WriteString(",")
+	}
+	s.rows++
+	s.buffer.WriteString("\n\t{")
+	for i, col := range s.selection.Columns {
+		if i > 0 {
+			s.buffer.WriteString(", ")
+		}
+		key, err := json.Marshal(col.Field)
+		if err != nil {
+			return err
+		}
+		value, err := json.Marshal(s.selection.Nulls.JSON(row[col.Field]))
+		if err != nil {
+			return err
+		}
+		s.buffer.Write(key)
+		s.buffer.WriteString(": ")
+		s.buffer.Write(value)
+	}
+	s.buffer.WriteString("}")
+	_, err := s.buffer.WriteTo(s.w)
+	return err
+}
+
+// flush writes the CSV rows buffered.
+func (s *selectionWriter) flush() error {
+	if s.json {
+		return nil
+	}
+	s.csv.Flush()
+	return s.csv.Error()
+}
+
+// end writes what comes after the rows, and flushes them.
+func (s *selectionWriter) end() error {
+	if s.json {
+		_, err := io.WriteString(s.w, "\n]")
+		return err
+	}
+	return s.flush()
+}
@@ -0,0 +1,268 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Export formats of an export template.
+const (
+	TemplateCSV  = "csv"
+	TemplateJSON = "json"
+)
+
+// TemplateColumn is a column of an export template: the table column it reads
+// and the header it is exported under, which defaults to the column name.
+type TemplateColumn struct {
+	Source string `json:"source"`
+	Header string `json:"header,omitempty"`
+}
+
+// ExportTemplate describes a recurring export of a table: which columns, in which order and
+// under which headers, in which format, and the filter the exported rows must match.
+type ExportTemplate struct {
+	Name    string           `json:"name"`
+	Table   string           `json:"table"`
+	Columns []TemplateColumn `json:"columns"`
+	Format  string           `json:"format"`
+	Filter  Filter           `json:"filter,omitempty"`
+}
+
+// header returns the header a column is exported under.
+func (tc TemplateColumn) header() string {
+	if tc.Header != "" {
+		return tc.Header
+	}
+	return tc.Source
+}
+
+// Validate checks the template on its own, without looking at the table: see CheckTemplateColumns
+// for the columns it reads.
+func (t *ExportTemplate) Validate() error {
+	if strings.TrimSpace(t.Name) == "" {
+		return errors.New("template name is required")
+	}
+	if t.Table == "" {
+		return fmt.Errorf("template %q: table is required", t.Name)
+	}
+	if len(t.Columns) == 0 {
+		return fmt.Errorf("template %q: at least one column is required", t.Name)
+	}
+	switch strings.ToLower(t.Format) {
+	case TemplateCSV, TemplateJSON:
+	default:
+		return fmt.Errorf("template %q: unsupported format %q, expected csv or json", t.Name, t.Format)
+	}
+
+	headers := make(map[string]bool, len(t.Columns))
+	for i, column := range t.Columns {
+		if column.Source == "" {
+			return fmt.Errorf("template %q: column %d has no source", t.Name, i+1)
+		}
+		if headers[column.header()] {
+			return fmt.Errorf("template %q: header %q is used twice", t.Name, column.header())
+		}
+		headers[column.header()] = true
+	}
+	// the placeholders do not matter here, only the operators and values are checked
+	if _, _, err := t.Filter.Where("", 1); err != nil {
+		return fmt.Errorf("template %q: %w", t.Name, err)
+	}
+	return nil
+}
+
+// CheckTemplateColumns checks that every column the template exports or filters on still exists in its table.
+func (c *Client) CheckTemplateColumns(t *ExportTemplate) error {
+	columns, err := c.GetColumns(t.Table)
+	if err != nil {
+		return err
+	}
+	if len(columns) == 0 {
+		return fmt.Errorf("template %q: table %q does not exist", t.Name, t.Table)
+	}
+	exists := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		exists[column.Field] = true
+	}
+	for _, column := range t.Columns {
+		if !exists[column.Source] {
+			return fmt.Errorf("template %q: column %q no longer exists in table %q", t.Name, column.Source, t.Table)
+		}
+	}
+	for _, condition := range t.Filter {
+		if !exists[condition.Column] {
+			return fmt.Errorf("template %q: filter column %q no longer exists in table %q", t.Name, condition.Column, t.Table)
+		}
+	}
+	return nil
+}
+
+// templateQuery builds the statement selecting the template's columns, renamed to their headers, and the filter's arguments.
+func (c *Client) templateQuery(t *ExportTemplate) (string, []interface{}, error) {
+	dbType := c.Type.String()
+	selected := make([]string, len(t.Columns))
+	for i, column := range t.Columns {
+		selected[i] = QuoteIdentifier(dbType, column.Source) + " AS " + QuoteIdentifier(dbType, column.header())
+	}
+	query := "SELECT " + strings.Join(selected, ", ") + " FROM " + QualifiedTable(dbType, c.Schema.Name, t.Table)
+	if len(t.Filter) == 0 {
+		return c.limitExport(query), nil, nil
+	}
+	where, args, err := t.Filter.Where(dbType, 1)
+	if err != nil {
+		return "", nil, err
+	}
+	return c.limitExport(query + " WHERE " + where), args, nil
+}
+
+// ExportWithTemplate streams the rows the template selects to w, in the template's format, without the
+// columns read from one of the excluded columns. The template and its columns are checked first, so nothing
+// is written when they are invalid, when an excluded column is not one the template reads, or when the template
+// reads a column the connection excludes from exports, see CheckExportPolicy.
+// A w implementing ExportProgress follows the rows as they are written.
+func (c *Client) ExportWithTemplate(ctx context.Context, t *ExportTemplate, exclude []string, w io.Writer) error {
+	if c.Database == nil {
+		return errors.New("database connection is nil")
+	}
+	if err := c.CheckExportPolicy(t.Table, t.Sources()); err != nil {
+		return fmt.Errorf("template %q: %w", t.Name, err)
+	}
+	if err := t.omit(exclude); err != nil {
+		return err
+	}
+	if err := t.Validate(); err != nil {
+		return err
+	}
+	if err := c.CheckTemplateColumns(t); err != nil {
+		return err
+	}
+
+	query, args, err := c.templateQuery(t)
+	if err != nil {
+		return err
+	}
+	progress, _ := w.(ExportProgress)
+	if progress != nil {
+		progress.ExpectRows(c.estimateTemplateRows(ctx, t))
+	}
+	rows, err := c.Database.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer func(rows *sql.Rows) {
+		if err := rows.Close(); err != nil {
+			return
+		}
+	}(rows)
+
+	var rowWritten func()
+	if progress != nil {
+		rowWritten = progress.RowWritten
+	}
+	if strings.EqualFold(t.Format, TemplateJSON) {
+		return writeRowsJSON(w, rows, c.Nulls, c.Cells.export(), rowWritten)
+	}
+	return writeRowsCSV(w, rows, c.Nulls, c.Floats, c.Cells.export(), rowWritten)
+}
+
+// writeRowsJSON writes the rows to w one at a time, in the layout of Selection.JSON:
+// a JSON array with one object per line and the keys of each object in column order.
+// rowWritten, when not nil, is called once each row is written to w.
+func writeRowsJSON(w io.Writer, rows *sql.Rows, nulls NullFormat, limit CellLimit, rowWritten func()) error {
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	columns, _ = DistinctColumns(columns)
+	keys := make([][]byte, len(columns))
+	for i, column := range columns {
+		if keys[i], err = json.Marshal(column); err != nil {
+			return err
+		}
+	}
+	values := make([]interface{}, len(columns))
+	valuePtrs := make([]interface{}, len(columns))
+	for i := range values {
+		valuePtrs[i] = &values[i]
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteString("[")
+	for r := 0; rows.Next(); r++ {
+		if err = rows.Scan(valuePtrs...); err != nil {
+			return err
+		}
+		if r > 0 {
+			buffer.WriteString(",")
+		}
+		buffer.WriteString("\n\t{")
+		for i, value := range values {
+			value, _ = limit.Value(value)
+			encoded, err := json.Marshal(nulls.JSON(readable(columns[i], value)))
+			if err != nil {
+				return err
+			}
+			if i > 0 {
+				buffer.WriteString(", ")
+			}
+			buffer.Write(keys[i])
+			buffer.WriteString(": ")
+			buffer.Write(encoded)
+		}
+		buffer.WriteString("}")
+		if _, err = w.Write(buffer.Bytes()); err != nil {
+			return err
+		}
+		buffer.Reset()
+		if rowWritten != nil {
+			rowWritten()
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	buffer.WriteString("\n]")
+	_, err = w.Write(buffer.Bytes())
+	return err
+}
+
+// Sources returns the table columns the template reads, in order.
+func (t *ExportTemplate) Sources() []string {
+	sources := make([]string, len(t.Columns))
+	for i, column := range t.Columns {
+		sources[i] = column.Source
+	}
+	return sources
+}
+
+// omit removes the columns read from one of the excluded columns from the template.
+// Excluding a column the template does not read is an error.
+func (t *ExportTemplate) omit(exclude []string) error {
+	var (
+		kept    = make([]TemplateColumn, 0, len(t.Columns))
+		matched = make(map[string]bool, len(exclude))
+	)
+	for _, name := range exclude {
+		matched[name] = false
+	}
+	for _, column := range t.Columns {
+		if _, excluded := matched[column.Source]; excluded {
+			matched[column.Source] = true
+			continue
+		}
+		kept = append(kept, column)
+	}
+	for _, name := range exclude {
+		if !matched[name] {
+			return fmt.Errorf("template %q: cannot exclude column %q, the template does not export it", t.Name, name)
+		}
+	}
+	t.Columns = kept
+	return nil
+}
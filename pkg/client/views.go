@@ -0,0 +1,160 @@
+package client
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	_sql "github.com/yazeed1s/sqlweb/db/sql"
+)
+
+// TableInfo is a table of the schema and whether it is a view rather than a base table.
+type TableInfo struct {
+	Name   string `json:"name"`
+	IsView bool   `json:"is_view"`
+}
+
+// ListTables returns the tables and views of the schema, telling them apart by the TABLE_TYPE of
+// information_schema in MySQL and PostgreSQL, and by the type of sqlite_master in SQLite.
+// The tables of attached SQLite databases follow, named alias.table.
+func (c *Client) ListTables() ([]TableInfo, error) {
+	if c.Database == nil {
+		return nil, errors.New("database connection is nil")
+	}
+
+	var (
+		dbType = c.Type.String()
+		query  string
+		rows   *sql.Rows
+		err    error
+		tables []TableInfo
+	)
+
+	switch strings.ToLower(dbType) {
+	case strings.ToLower(_sql.MySQL.String()):
+		query = fmt.Sprintf(_sql.MySQLTableTypes, QuoteLiteral(dbType, c.Schema.Name))
+	case strings.ToLower(_sql.PostgreSQL.String()):
+		query = fmt.Sprintf(_sql.PostgreSQLTableTypes, QuoteLiteral(dbType, c.Schema.Name))
+	case strings.ToLower(_sql.SQLite.String()):
+		query = _sql.SQLiteTableTypes
+	default:
+		return nil, fmt.Errorf("unsupported database type: %s", dbType)
+	}
+
+	rows, err = c.Database.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var table TableInfo
+		if err = rows.Scan(&table.Name, &table.IsView); err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	attached, err := c.AttachedTables()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range attached {
+		tables = append(tables, TableInfo{Name: name})
+	}
+	return tables, nil
+}
+
+// IsView tells whether the table is a view. A table that does not exist is not a view.
+func (c *Client) IsView(table string) (bool, error) {
+	if c.Database == nil {
+		return false, errors.New("database connection is nil")
+	}
+
+	var (
+		dbType = c.Type.String()
+		query  string
+		isView bool
+	)
+
+	switch strings.ToLower(dbType) {
+	case strings.ToLower(_sql.MySQL.String()):
+		query = fmt.Sprintf(_sql.MySQLIsView, QuoteLiteral(dbType, c.Schema.Name), QuoteLiteral(dbType, table))
+	case strings.ToLower(_sql.PostgreSQL.String()):
+		query = fmt.Sprintf(_sql.PostgreSQLIsView, QuoteLiteral(dbType, c.Schema.Name), QuoteLiteral(dbType, table))
+	case strings.ToLower(_sql.SQLite.String()):
+		query = fmt.Sprintf(_sql.SQLiteIsView, QuoteLiteral(dbType, table))
+	default:
+		return false, fmt.Errorf("unsupported database type: %s", dbType)
+	}
+
+	err := c.Database.QueryRow(query).Scan(&isView)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return isView, err
+}
+
+// View is a view of the schema and the query defining it.
+type View struct {
+	Name string `json:"name"`
+	// Definition is the CREATE VIEW statement in MySQL and SQLite, and the SELECT of the view in PostgreSQL
+	Definition string `json:"definition"`
+}
+
+// GetViews returns the views of the schema with their definitions.
+func (c *Client) GetViews() ([]View, error) {
+	tables, err := c.ListTables()
+	if err != nil {
+		return nil, err
+	}
+	views := make([]View, 0)
+	for _, table := range tables {
+		if !table.IsView {
+			continue
+		}
+		definition, err := c.GetViewDefinition(table.Name)
+		if err != nil {
+			return nil, err
+		}
+		views = append(views, View{Name: table.Name, Definition: definition})
+	}
+	return views, nil
+}
+
+// GetViewDefinition returns the definition of a view: what SHOW CREATE VIEW returns in MySQL,
+// pg_get_viewdef in PostgreSQL and the statement kept in sqlite_master in SQLite.
+func (c *Client) GetViewDefinition(name string) (string, error) {
+	if c.Database == nil {
+		return "", errors.New("database connection is nil")
+	}
+
+	var (
+		dbType     = c.Type.String()
+		definition string
+		err        error
+	)
+
+	switch strings.ToLower(dbType) {
+	case strings.ToLower(_sql.MySQL.String()):
+		var view, charset, collation string
+		query := fmt.Sprintf(_sql.MySQLShowCreateView, QualifiedTable(dbType, c.Schema.Name, name))
+		err = c.Database.QueryRow(query).Scan(&view, &definition, &charset, &collation)
+	case strings.ToLower(_sql.PostgreSQL.String()):
+		query := fmt.Sprintf(_sql.PostgreSQLViewDefinition, QuoteLiteral(dbType, c.Schema.Name), QuoteLiteral(dbType, name))
+		err = c.Database.QueryRow(query).Scan(&definition)
+	case strings.ToLower(_sql.SQLite.String()):
+		query := fmt.Sprintf(_sql.SQLiteViewDefinition, QuoteLiteral(dbType, name))
+		err = c.Database.QueryRow(query).Scan(&definition)
+	default:
+		return "", fmt.Errorf("unsupported database type: %s", dbType)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("view not found: %s", name)
+	}
+	return definition, err
+}
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// appFilePath returns the full path of a file kept in sqlweb's config directory,
+// creating the directory if it does not exist yet.
+func appFilePath(fileName string) (string, error) {
+	var (
+		err        error
+		configDir  string
+		appDirPath string
+	)
+	configDir, err = os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	appDirPath = filepath.Join(configDir, appDirName)
+	if _, err = os.Stat(appDirPath); errors.Is(err, os.ErrNotExist) {
+		err = os.MkdirAll(appDirPath, os.ModePerm)
+		if err != nil {
+			return "", err
+		}
+	}
+	return filepath.Join(appDirPath, fileName), nil
+}
+
+// writeFileAtomic replaces the content of fileName with data without ever leaving
+// a half-written file behind: the data goes to a temporary file in the same directory
+// which is synced and then renamed over the target. The file is only readable by its owner,
+// as the saved connections hold passwords.
+func writeFileAtomic(fileName string, data []byte) error {
+	var (
+		err  error
+		tmp  *os.File
+		name string
+	)
+	tmp, err = os.CreateTemp(filepath.Dir(fileName), filepath.Base(fileName)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	name = tmp.Name()
+	defer func() {
+		if err != nil {
+			_ = os.Remove(name)
+		}
+	}()
+
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(name, 0600); err != nil {
+		return err
+	}
+	err = os.Rename(name, fileName)
+	return err
+}
+
+// CheckConfigDir returns sqlweb's config directory, creating it if needed, after checking
+// that a file can be written to it.
+func CheckConfigDir() (string, error) {
+	fileName, err := appFilePath(configFileName)
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Dir(fileName)
+	tmp, err := os.CreateTemp(dir, ".write-check.*.tmp")
+	if err != nil {
+		return dir, err
+	}
+	_ = tmp.Close()
+	return dir, os.Remove(tmp.Name())
+}
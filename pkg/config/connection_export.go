@@ -0,0 +1,38 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/yazeed1s/sqlweb/db/connection"
+)
+
+// ExportConnections returns the saved connections as a JSON array that ParseConnections reads back.
+// Passwords are left out unless includePasswords is set.
+func ExportConnections(includePasswords bool) ([]byte, error) {
+	connectionsMu.Lock()
+	saved, err := readConnectionHistory()
+	connectionsMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	connections := make([]connection.Connection, 0, len(saved))
+	for _, conn := range saved {
+		if !includePasswords {
+			conn.Connection = conn.Connection.Redacted()
+		}
+		connections = append(connections, conn.Connection)
+	}
+	return json.MarshalIndent(connections, "", "\t")
+}
+
+// ExportConnectionsToFile writes the saved connections to fileName, see ExportConnections.
+// The file is only readable by its owner, as it may hold passwords.
+func ExportConnectionsToFile(fileName string, includePasswords bool) error {
+	data, err := ExportConnections(includePasswords)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fileName, data, 0600)
+}
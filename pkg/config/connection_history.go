@@ -4,10 +4,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"log"
 	"os"
-	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
 
 	"github.com/yazeed1s/sqlweb/db/connection"
 )
@@ -18,19 +18,59 @@ import (
 type ConnectionHistory struct {
 	Schema     string                `json:"key"`
 	Connection connection.Connection `json:"connection"`
+	// SavedAt orders the saved connections when the oldest are evicted
+	SavedAt time.Time `json:"savedAt"`
 }
 
 const (
 	//configDirName  = ".config"
 	appDirName     = "sqlweb"
 	configFileName = "connection_history.json"
+	// DefaultMaxSavedConnections is the number of saved connections kept unless SetMaxSavedConnections changes it
+	DefaultMaxSavedConnections = 50
 )
 
+var (
+	// maxSavedConnections is the number of saved connections kept, 0 keeps them all
+	maxSavedConnections = DefaultMaxSavedConnections
+	// connectionsMu serializes read-modify-write cycles on the connection history file.
+	connectionsMu sync.Mutex
+)
+
+// SetMaxSavedConnections sets how many saved connections are kept; saving one more evicts the oldest.
+// A max of 0 or less keeps them all.
+func SetMaxSavedConnections(max int) {
+	connectionsMu.Lock()
+	defer connectionsMu.Unlock()
+	if max < 0 {
+		max = 0
+	}
+	maxSavedConnections = max
+}
+
+// colorPattern accepts the colors a saved connection may be tinted with:
+// a hex color such as #d33 or #dd3333, or a color name such as red.
+var colorPattern = regexp.MustCompile(`^(#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})|[a-zA-Z]+)$`)
+
+// ValidateColor checks that color is empty, a hex color or a color name, so it is safe to use as a CSS value.
+func ValidateColor(color string) error {
+	if color == "" || colorPattern.MatchString(color) {
+		return nil
+	}
+	return fmt.Errorf("invalid connection color: %q", color)
+}
+
 // NewConnectionConfig creates a new ConnectionHistory object with the provided key and connection data.
 func NewConnectionConfig(key string, connection *connection.Connection) *ConnectionHistory {
+	saved := *connection
+	// the password of a connection using a credential provider is minted when connecting, never stored
+	if saved.HasCredentialProvider() {
+		saved.Password = ""
+	}
 	return &ConnectionHistory{
 		Schema:     key,
-		Connection: *connection,
+		Connection: saved,
+		SavedAt:    time.Now(),
 	}
 }
 
@@ -38,115 +78,138 @@ func NewConnectionConfig(key string, connection *connection.Connection) *Connect
 // ensuring that the file maintains an array of JSON objects.
 //
 // If the file doesn't exist, it creates the file and initializes it with a JSON array containing the provided object.
-// If the file already exists, it appends the JSON object to the existing array.
+// If the file already exists, it appends the JSON object to the existing array, and then evicts the connections
+// saved the longest ago while there are more than the maximum set with SetMaxSavedConnections.
 func WriteToFile(conf *ConnectionHistory) (int, error) {
-	// os.UserHomeDir():
-	// - On Unix, including macOS, it returns the $HOME environment variable
-	// - On Windows, it returns %USERPROFILE%
-	// - On Plan 9, it returns the $home environment variable
-	// os.UserConfigDir():
-	//   - On Unix systems, it returns $XDG_CONFIG_HOME as specified by
-	//     https://specifications.freedesktop.org/basedir-spec/basedir-spec-latest.html
-	//     if non-empty, else $HOME/.config.
-	//   - On Darwin, it returns $HOME/Library/Application Support
-	//   - On Windows, it returns %AppData%
-	//   - On Plan 9, it returns $home/lib.
 	var (
-		err        error
-		file       *os.File
-		appDirPath string
-		fileName   string
-		data       []byte
-		configDir  string
-		bits       int
+		err         error
+		data        []byte
+		connections []ConnectionHistory
 	)
-	configDir, err = os.UserConfigDir()
+	connectionsMu.Lock()
+	defer connectionsMu.Unlock()
+
+	connections, err = readConnectionHistory()
 	if err != nil {
 		return 0, err
 	}
-	appDirPath = filepath.Join(configDir, appDirName)
-	if _, err = os.Stat(appDirPath); errors.Is(err, os.ErrNotExist) {
-		err = os.MkdirAll(appDirPath, os.ModePerm)
-		if err != nil {
-			log.Println(err)
-		}
-	}
-	fileName = filepath.Join(appDirPath, configFileName)
-
-	data, err = json.MarshalIndent(conf, "", "\t")
+	connections = evictOldest(append(connections, *conf), maxSavedConnections)
+	data, err = writeConnectionHistory(connections)
 	if err != nil {
 		return 0, err
 	}
+	return len(data), nil
+}
 
-	if _, err = os.Stat(fileName); errors.Is(err, os.ErrNotExist) {
-		file, err = os.Create(fileName)
-		if err != nil {
-			return 0, err
+// TouchConnection records that the saved connection with the given key was just connected to,
+// and returns it with its new LastUsedAt.
+func TouchConnection(key string) (connection.Connection, error) {
+	connectionsMu.Lock()
+	defer connectionsMu.Unlock()
+
+	connections, err := readConnectionHistory()
+	if err != nil {
+		return connection.Connection{}, err
+	}
+	for i := range connections {
+		if connections[i].Schema != key {
+			continue
 		}
-		// Insert the JSON object between [ ] to represent a JSON array of objects.
-		bits, err = file.WriteString("[\n" + string(data) + "\n]")
-		if err != nil {
-			return 0, err
+		now := time.Now()
+		connections[i].Connection.LastUsedAt = &now
+		if _, err = writeConnectionHistory(connections); err != nil {
+			return connection.Connection{}, err
 		}
-		return bits, nil
+		return connections[i].Connection, nil
 	}
+	return connection.Connection{}, fmt.Errorf("connection not found for key: %s", key)
+}
 
-	file, err = os.OpenFile(fileName, os.O_RDWR, 0666)
-	if err != nil {
-		return 0, err
+// readConnectionHistory reads every saved connection. A missing file is not an error and yields none.
+// The caller holds connectionsMu, see loadConnectionHistory.
+func readConnectionHistory() ([]ConnectionHistory, error) {
+	connections, err := loadConnectionHistory()
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
 	}
+	return connections, err
+}
 
-	// Move the file pointer to the end, just before the closing square bracket.
-	_, err = file.Seek(-2, io.SeekEnd)
+// loadConnectionHistory reads every saved connection. A file of an older format is upgraded to the
+// current one and written back, so the caller holds connectionsMu.
+//
+// os.UserConfigDir():
+//   - On Unix systems, it returns $XDG_CONFIG_HOME as specified by
+//     https://specifications.freedesktop.org/basedir-spec/basedir-spec-latest.html
+//     if non-empty, else $HOME/.config.
+//   - On Darwin, it returns $HOME/Library/Application Support
+//   - On Windows, it returns %AppData%
+//   - On Plan 9, it returns $home/lib.
+func loadConnectionHistory() ([]ConnectionHistory, error) {
+	var (
+		err         error
+		fileName    string
+		bytes       []byte
+		connections []ConnectionHistory
+		migrated    bool
+	)
+	fileName, err = appFilePath(configFileName)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-
-	// Append the new ConnectionHistory object to the existing file.
-	bits, err = file.WriteString("\n," + string(data) + "\n]")
+	bytes, err = os.ReadFile(fileName)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-
-	defer func(file *os.File) {
-		cerr := file.Close()
-		if cerr != nil {
-			return
+	connections, migrated, err = parseConnectionHistory(bytes)
+	if err != nil {
+		return nil, err
+	}
+	if migrated {
+		if _, err = writeConnectionHistory(connections); err != nil {
+			return nil, err
 		}
-	}(file)
-
-	return bits, nil
+	}
+	return connections, nil
 }
 
-// ReadFromFile reads a ConnectionHistory object from the configuration file based on the provided key.
-func ReadFromFile(key string) (connection.Connection, error) {
-	var (
-		err          error
-		file         *os.File
-		fullFilePath string
-		bytes        []byte
-		configDir    string
-	)
-	configDir, err = os.UserConfigDir()
-	fullFilePath = filepath.Join(configDir, appDirName, configFileName)
-	file, err = os.Open(fullFilePath)
+// writeConnectionHistory replaces the saved connections and returns the data written.
+func writeConnectionHistory(connections []ConnectionHistory) ([]byte, error) {
+	fileName, err := appFilePath(configFileName)
 	if err != nil {
-		return connection.Connection{}, err
+		return nil, err
+	}
+	if connections == nil {
+		connections = []ConnectionHistory{}
+	}
+	data, err := json.MarshalIndent(connectionHistoryFile{Version: connectionHistoryVersion, Connections: connections}, "", "\t")
+	if err != nil {
+		return nil, err
 	}
+	return data, writeFileAtomic(fileName, data)
+}
 
-	defer func(file *os.File) {
-		cerr := file.Close()
-		if cerr != nil {
-			return
+// evictOldest removes the connections saved the longest ago until at most max remain, keeping the order
+// of the others. Connections saved before savedAt was recorded count as the oldest. A max of 0 keeps them all.
+func evictOldest(connections []ConnectionHistory, max int) []ConnectionHistory {
+	for max > 0 && len(connections) > max {
+		oldest := 0
+		for i, conn := range connections {
+			if conn.SavedAt.Before(connections[oldest].SavedAt) {
+				oldest = i
+			}
 		}
-	}(file)
-
-	bytes, err = io.ReadAll(file)
-	if err != nil {
-		return connection.Connection{}, err
+		connections = append(connections[:oldest], connections[oldest+1:]...)
 	}
-	var connections []ConnectionHistory
-	err = json.Unmarshal(bytes, &connections)
+	return connections
+}
+
+// ReadFromFile reads a ConnectionHistory object from the configuration file based on the provided key.
+func ReadFromFile(key string) (connection.Connection, error) {
+	connectionsMu.Lock()
+	defer connectionsMu.Unlock()
+
+	connections, err := loadConnectionHistory()
 	if err != nil {
 		return connection.Connection{}, err
 	}
@@ -162,34 +225,16 @@ func ReadFromFile(key string) (connection.Connection, error) {
 func GetSavedConnections() ([]connection.Connection, error) {
 	var (
 		err              error
-		file             *os.File
-		fullFilePath     string
-		bytes            []byte
-		configDir        string
 		connections      []ConnectionHistory
 		savedConnections []connection.Connection
 	)
-	configDir, err = os.UserConfigDir()
-	if err != nil {
-		return nil, err
-	}
-	fullFilePath = filepath.Join(configDir, appDirName, configFileName)
-	file, err = os.Open(fullFilePath)
-	if err != nil {
-		return nil, err
-	}
-
-	defer file.Close()
-	bytes, err = io.ReadAll(file)
-	if err != nil {
-		return nil, err
-	}
+	connectionsMu.Lock()
+	defer connectionsMu.Unlock()
 
-	err = json.Unmarshal(bytes, &connections)
+	connections, err = loadConnectionHistory()
 	if err != nil {
 		return nil, err
 	}
-
 	for _, conn := range connections {
 		savedConnections = append(savedConnections, conn.Connection)
 	}
@@ -0,0 +1,319 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yazeed1s/sqlweb/db/connection"
+	_sql "github.com/yazeed1s/sqlweb/db/sql"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSavedConnectionLabelAndColor(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	prod := &connection.Connection{
+		Host: "db.internal", Port: 5432, User: "app", Name: "shop", Type: _sql.PostgreSQL,
+		Label: "prod", Color: "#dd3333", Environment: "production",
+	}
+	dev := &connection.Connection{Type: _sql.SQLite, Name: "dev", Path: "/tmp/dev.db"}
+	_, err := WriteToFile(NewConnectionConfig(prod.Name, prod))
+	require.NoError(t, err)
+	_, err = WriteToFile(NewConnectionConfig(dev.Name, dev))
+	require.NoError(t, err)
+
+	saved, err := GetSavedConnections()
+	require.NoError(t, err)
+	require.Len(t, saved, 2)
+	assert.Equal(t, *prod, saved[0])
+	assert.Empty(t, saved[1].Label)
+	assert.Empty(t, saved[1].Color)
+
+	read, err := ReadFromFile("shop")
+	require.NoError(t, err)
+	assert.Equal(t, "prod", read.Label)
+	assert.Equal(t, "#dd3333", read.Color)
+	assert.True(t, read.IsProduction())
+}
+
+func TestSavedConnectionsArePrivate(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	_, err := WriteToFile(NewConnectionConfig("shop", &connection.Connection{
+		Host: "db.internal", Port: 5432, User: "app", Password: "hunter2", Name: "shop", Type: _sql.PostgreSQL,
+	}))
+	require.NoError(t, err)
+	fileName, err := appFilePath(configFileName)
+	require.NoError(t, err)
+	info, err := os.Stat(fileName)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestValidateColor(t *testing.T) {
+	for _, color := range []string{"", "red", "#d33", "#DD3333"} {
+		assert.NoError(t, ValidateColor(color), color)
+	}
+	for _, color := range []string{"#dd33", "red;", "url(x)", "#gggggg"} {
+		assert.Error(t, ValidateColor(color), color)
+	}
+}
+
+func TestSavedConnectionsEvictOldest(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	SetMaxSavedConnections(2)
+	defer SetMaxSavedConnections(DefaultMaxSavedConnections)
+
+	saved := time.Now()
+	for i, name := range []string{"first", "second", "third"} {
+		conf := NewConnectionConfig(name, &connection.Connection{Type: _sql.SQLite, Name: name})
+		conf.SavedAt = saved.Add(time.Duration(i) * time.Second)
+		_, err := WriteToFile(conf)
+		require.NoError(t, err)
+	}
+
+	connections, err := GetSavedConnections()
+	require.NoError(t, err)
+	require.Len(t, connections, 2)
+	assert.Equal(t, "second", connections[0].Name)
+	assert.Equal(t, "third", connections[1].Name)
+	_, err = ReadFromFile("first")
+	assert.Error(t, err)
+}
+
+func TestEvictOldestWithoutSavedAt(t *testing.T) {
+	now := time.Now()
+	connections := []ConnectionHistory{
+		{Schema: "recent", SavedAt: now},
+		{Schema: "legacy"},
+		{Schema: "newest", SavedAt: now.Add(time.Second)},
+	}
+	kept := evictOldest(connections, 2)
+	require.Len(t, kept, 2)
+	assert.Equal(t, "recent", kept[0].Schema)
+	assert.Equal(t, "newest", kept[1].Schema)
+	assert.Len(t, evictOldest(kept, 0), 2)
+}
+
+func TestImportConnections(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	shop := &connection.Connection{Host: "db.internal", Port: 5432, User: "app", Name: "shop", Type: _sql.PostgreSQL}
+	_, err := WriteToFile(NewConnectionConfig(shop.Name, shop))
+	require.NoError(t, err)
+
+	file := []byte(`[
+		{"host": "db.internal", "port": 5432, "user": "app", "database": "shop", "databaseType": "postgresql"},
+		{"host": "db.internal", "port": 3306, "user": "ro", "database": "analytics", "databaseType": "mysql", "label": "bi"},
+		{"host": "db.internal", "port": 3306, "user": "ro", "database": "analytics", "databaseType": "mysql"},
+		{"database": "local", "databaseType": "sqlite"},
+		{"key": "notes", "connection": {"database": "notes", "databaseType": "sqlite", "path": "/tmp/notes.db"}}
+	]`)
+	connections, err := ParseConnections(file)
+	require.NoError(t, err)
+	require.Len(t, connections, 5)
+
+	result, err := ImportConnections(connections)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"analytics", "notes"}, result.Added)
+	assert.Equal(t, []SkippedImport{
+		{Key: "shop", Reason: "already saved"},
+		{Key: "analytics", Reason: "already saved"},
+		{Key: "local", Reason: "path is required for SQLite"},
+	}, result.Skipped)
+
+	saved, err := GetSavedConnections()
+	require.NoError(t, err)
+	require.Len(t, saved, 3)
+	assert.Equal(t, "shop", saved[0].Name)
+	assert.Equal(t, "bi", saved[1].Label)
+	assert.Equal(t, "/tmp/notes.db", saved[2].Path)
+
+	// importing the same file again adds nothing
+	result, err = ImportConnections(connections)
+	require.NoError(t, err)
+	assert.Empty(t, result.Added)
+	assert.Len(t, result.Skipped, 5)
+
+	_, err = ParseConnections([]byte(`{"database": "shop"}`))
+	assert.Error(t, err)
+}
+
+func TestValidateConnection(t *testing.T) {
+	valid := []connection.Connection{
+		{Name: "dev", Type: _sql.SQLite, Path: "/tmp/dev.db"},
+		{Name: "shop", Type: _sql.MySQL, Host: "localhost", Port: 3306, User: "root"},
+	}
+	for _, conn := range valid {
+		assert.NoError(t, ValidateConnection(&conn), conn.Name)
+	}
+	invalid := []connection.Connection{
+		{Type: _sql.SQLite, Path: "/tmp/dev.db"},
+		{Name: "shop", Type: _sql.Unsupported},
+		{Name: "shop", Type: _sql.PostgreSQL, Host: "localhost", Port: 0, User: "app"},
+		{Name: "shop", Type: _sql.PostgreSQL, Port: 5432, User: "app"},
+		{Name: "dev", Type: _sql.SQLite, Path: "/tmp/dev.db", Color: "url(x)"},
+	}
+	for _, conn := range invalid {
+		assert.Error(t, ValidateConnection(&conn), conn.Name)
+	}
+}
+
+func TestExportConnectionsOmitsPasswords(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	shop := &connection.Connection{Host: "db.internal", Port: 5432, User: "app", Password: "s3cret", Name: "shop", Type: _sql.PostgreSQL}
+	_, err := WriteToFile(NewConnectionConfig(shop.Name, shop))
+	require.NoError(t, err)
+
+	fileName := filepath.Join(t.TempDir(), "connections.json")
+	require.NoError(t, ExportConnectionsToFile(fileName, false))
+	data, err := os.ReadFile(fileName)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "s3cret")
+	assert.NotContains(t, string(data), "password")
+	exported, err := ParseConnections(data)
+	require.NoError(t, err)
+	require.Len(t, exported, 1)
+	assert.Equal(t, "shop", exported[0].Name)
+	assert.Equal(t, "app", exported[0].User)
+
+	require.NoError(t, ExportConnectionsToFile(fileName, true))
+	data, err = os.ReadFile(fileName)
+	require.NoError(t, err)
+	exported, err = ParseConnections(data)
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", exported[0].Password)
+
+	// the saved connection keeps its password
+	read, err := ReadFromFile("shop")
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", read.Password)
+}
+
+// writeHistoryFixture copies a connection history of testdata/connection_history to the config directory
+// and returns where it was copied.
+func writeHistoryFixture(t *testing.T, fixture string) string {
+	data, err := os.ReadFile(filepath.Join("testdata", "connection_history", fixture))
+	require.NoError(t, err)
+	fileName, err := appFilePath(configFileName)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(fileName, data, 0o644))
+	return fileName
+}
+
+func TestConnectionHistoryMigrations(t *testing.T) {
+	require.Len(t, historyMigrations, connectionHistoryVersion, "each version needs a migration from the one before")
+
+	for _, fixture := range []string{"v0_baseline.json", "v0_labels.json", "v0_credentials.json", "v1.json"} {
+		t.Run(fixture, func(t *testing.T) {
+			t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+			t.Setenv("HOME", t.TempDir())
+			fileName := writeHistoryFixture(t, fixture)
+
+			saved, err := GetSavedConnections()
+			require.NoError(t, err)
+			require.Len(t, saved, 2)
+			assert.Equal(t, "shop", saved[0].Name)
+			assert.Equal(t, "notes", saved[1].Name)
+			assert.Equal(t, _sql.SQLite, saved[1].Type)
+			assert.Equal(t, "/tmp/notes.db", saved[1].Path)
+
+			data, err := os.ReadFile(fileName)
+			require.NoError(t, err)
+			version, err := historyVersion(data)
+			require.NoError(t, err)
+			assert.Equal(t, connectionHistoryVersion, version)
+			parsed, err := ParseConnections(data)
+			require.NoError(t, err)
+			assert.Equal(t, saved, parsed)
+
+			// the upgraded file reads the same and is left as is
+			again, err := GetSavedConnections()
+			require.NoError(t, err)
+			assert.Equal(t, saved, again)
+			unchanged, err := os.ReadFile(fileName)
+			require.NoError(t, err)
+			assert.Equal(t, data, unchanged)
+		})
+	}
+}
+
+func TestConnectionHistoryMigrationKeepsFields(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	writeHistoryFixture(t, "v0_credentials.json")
+
+	shop, err := ReadFromFile("shop")
+	require.NoError(t, err)
+	assert.Equal(t, _sql.PostgreSQL, shop.Type)
+	assert.Equal(t, "prod", shop.Label)
+	require.NotNil(t, shop.LastUsedAt)
+	assert.Equal(t, time.Date(2024, 6, 1, 9, 30, 0, 0, time.UTC), shop.LastUsedAt.UTC())
+	require.NotNil(t, shop.Credentials)
+	assert.Equal(t, connection.ProviderAWSIAM, shop.Credentials.Provider)
+	assert.Equal(t, "eu-west-1", shop.Credentials.Params["region"])
+	assert.Equal(t, 100, shop.Settings.DefaultPerPage)
+
+	saved, err := readConnectionHistory()
+	require.NoError(t, err)
+	require.Len(t, saved, 2)
+	assert.Equal(t, time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC), saved[1].SavedAt.UTC())
+}
+
+func TestConnectionHistoryTooNew(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	fileName, err := appFilePath(configFileName)
+	require.NoError(t, err)
+	future := []byte(`{"version": 99, "connections": [{"key": "shop", "connection": {"database": "shop"}, "vault": "x"}]}`)
+	require.NoError(t, os.WriteFile(fileName, future, 0o644))
+
+	_, err = GetSavedConnections()
+	assert.ErrorIs(t, err, ErrHistoryTooNew)
+	_, err = WriteToFile(NewConnectionConfig("dev", &connection.Connection{Type: _sql.SQLite, Name: "dev", Path: "/tmp/dev.db"}))
+	assert.ErrorIs(t, err, ErrHistoryTooNew)
+
+	// the newer file is never downgraded
+	data, err := os.ReadFile(fileName)
+	require.NoError(t, err)
+	assert.Equal(t, future, data)
+
+	require.NoError(t, os.WriteFile(fileName, []byte(`{"connections": []}`), 0o644))
+	_, err = GetSavedConnections()
+	assert.Error(t, err)
+}
+
+func TestConnectionHistoryConcurrentMigration(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	writeHistoryFixture(t, "v0_baseline.json")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := GetSavedConnections()
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+
+	saved, err := GetSavedConnections()
+	require.NoError(t, err)
+	assert.Len(t, saved, 2)
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// connectionHistoryVersion is the format connection_history.json is written in. Changing the format
+// bumps it and appends the migration from the previous version to historyMigrations.
+const connectionHistoryVersion = 1
+
+// ErrHistoryTooNew is returned for a connection history written by a newer sqlweb. It is neither read
+// nor rewritten, so the fields this version does not know are not lost.
+var ErrHistoryTooNew = errors.New("connection history was written by a newer version of sqlweb")
+
+// connectionHistoryFile is the content of connection_history.json since version 1.
+type connectionHistoryFile struct {
+	Version     int                 `json:"version"`
+	Connections []ConnectionHistory `json:"connections"`
+}
+
+// historyMigrations upgrade a connection history from one version to the next, historyMigrations[v]
+// from version v to v+1. They work on the raw JSON, leaving the fields they do not change untouched.
+var historyMigrations = []func(data []byte) ([]byte, error){
+	migrateHistoryV0,
+}
+
+// migrateHistoryV0 wraps the bare array of saved connections of version 0 in a versioned object.
+func migrateHistoryV0(data []byte) ([]byte, error) {
+	var connections []json.RawMessage
+	if err := json.Unmarshal(data, &connections); err != nil {
+		return nil, err
+	}
+	if connections == nil {
+		connections = []json.RawMessage{}
+	}
+	return json.Marshal(struct {
+		Version     int               `json:"version"`
+		Connections []json.RawMessage `json:"connections"`
+	}{1, connections})
+}
+
+// historyVersion returns the version of a connection history: 0 for the bare array it started as,
+// else its 'version' field.
+func historyVersion(data []byte) (int, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		return 0, nil
+	}
+	var header struct {
+		Version *int `json:"version"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return 0, err
+	}
+	if header.Version == nil || *header.Version < 1 {
+		return 0, errors.New("connection history has no valid version")
+	}
+	return *header.Version, nil
+}
+
+// parseConnectionHistory reads a connection history of any version up to the current one,
+// and tells whether it had to be upgraded.
+func parseConnectionHistory(data []byte) ([]ConnectionHistory, bool, error) {
+	var (
+		err     error
+		version int
+		file    connectionHistoryFile
+	)
+	version, err = historyVersion(data)
+	if err != nil {
+		return nil, false, err
+	}
+	if version > connectionHistoryVersion {
+		return nil, false, fmt.Errorf("%w: the file is version %d, this one reads up to version %d",
+			ErrHistoryTooNew, version, connectionHistoryVersion)
+	}
+	for v := version; v < connectionHistoryVersion; v++ {
+		data, err = historyMigrations[v](data)
+		if err != nil {
+			return nil, false, fmt.Errorf("upgrading connection history from version %d: %w", v, err)
+		}
+	}
+	if err = json.Unmarshal(data, &file); err != nil {
+		return nil, false, err
+	}
+	return file.Connections, version < connectionHistoryVersion, nil
+}
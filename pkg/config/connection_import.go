@@ -0,0 +1,145 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/yazeed1s/sqlweb/db/connection"
+	_sql "github.com/yazeed1s/sqlweb/db/sql"
+)
+
+// ImportResult reports which connection definitions an import added and which it skipped.
+type ImportResult struct {
+	Added   []string        `json:"added"`
+	Skipped []SkippedImport `json:"skipped"`
+}
+
+// SkippedImport is a connection definition that was not imported, along with the reason.
+type SkippedImport struct {
+	Key    string `json:"key"`
+	Reason string `json:"reason"`
+}
+
+// ValidateConnection checks that a connection definition has what connecting to its database needs.
+func ValidateConnection(conn *connection.Connection) error {
+	if conn.Name == "" {
+		return errors.New("database name is required")
+	}
+	switch conn.Type {
+	case _sql.SQLite:
+		if conn.Path == "" {
+			return errors.New("path is required for SQLite")
+		}
+	case _sql.MySQL, _sql.PostgreSQL:
+		if conn.Host == "" {
+			return errors.New("host is required")
+		}
+		if conn.Port < 1 || conn.Port > 65535 {
+			return fmt.Errorf("invalid port number: %d", conn.Port)
+		}
+		if conn.User == "" {
+			return errors.New("user is required")
+		}
+	default:
+		return errors.New("unsupported database type")
+	}
+	if err := conn.CheckCredentials(); err != nil {
+		return err
+	}
+	if err := conn.CheckApplicationName(); err != nil {
+		return err
+	}
+	if err := conn.Settings.Validate(); err != nil {
+		return err
+	}
+	return ValidateColor(conn.Color)
+}
+
+// ParseConnections reads a JSON array of connection definitions. The entries may be connections,
+// as sent to /connect, or saved connections as found in connection_history.json, which is also
+// read whole in any version this one supports.
+func ParseConnections(data []byte) ([]connection.Connection, error) {
+	var entries []json.RawMessage
+	if version, err := historyVersion(data); err == nil && version > 0 {
+		saved, _, err := parseConnectionHistory(data)
+		if err != nil {
+			return nil, err
+		}
+		connections := make([]connection.Connection, 0, len(saved))
+		for _, conn := range saved {
+			connections = append(connections, conn.Connection)
+		}
+		return connections, nil
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("expected a JSON array of connections: %w", err)
+	}
+
+	connections := make([]connection.Connection, 0, len(entries))
+	for i, entry := range entries {
+		var (
+			saved struct {
+				Connection json.RawMessage `json:"connection"`
+			}
+			conn connection.Connection
+		)
+		if err := json.Unmarshal(entry, &saved); err != nil {
+			return nil, fmt.Errorf("connection %d: %w", i, err)
+		}
+		if saved.Connection != nil {
+			entry = saved.Connection
+		}
+		if err := json.Unmarshal(entry, &conn); err != nil {
+			return nil, fmt.Errorf("connection %d: %w", i, err)
+		}
+		connections = append(connections, conn)
+	}
+	return connections, nil
+}
+
+// ImportConnections saves the valid connections whose key, their database name, is not saved yet,
+// and reports the others as skipped. The oldest saved connections are evicted past the limit,
+// as when saving one.
+func ImportConnections(connections []connection.Connection) (ImportResult, error) {
+	connectionsMu.Lock()
+	defer connectionsMu.Unlock()
+
+	result := ImportResult{Added: []string{}, Skipped: []SkippedImport{}}
+	saved, err := readConnectionHistory()
+	if err != nil {
+		return result, err
+	}
+	keys := make(map[string]bool, len(saved))
+	for _, conn := range saved {
+		keys[conn.Schema] = true
+	}
+
+	now := time.Now()
+	for _, conn := range connections {
+		if err = ValidateConnection(&conn); err != nil {
+			result.Skipped = append(result.Skipped, SkippedImport{Key: conn.Name, Reason: err.Error()})
+			continue
+		}
+		if keys[conn.Name] {
+			result.Skipped = append(result.Skipped, SkippedImport{Key: conn.Name, Reason: "already saved"})
+			continue
+		}
+		keys[conn.Name] = true
+		// an imported connection has not been used here yet
+		conn.LastUsedAt = nil
+		history := NewConnectionConfig(conn.Name, &conn)
+		history.SavedAt = now
+		saved = append(saved, *history)
+		result.Added = append(result.Added, conn.Name)
+	}
+
+	if len(result.Added) == 0 {
+		return result, nil
+	}
+	if _, err = writeConnectionHistory(evictOldest(saved, maxSavedConnections)); err != nil {
+		return ImportResult{}, err
+	}
+	return result, nil
+}
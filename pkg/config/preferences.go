@@ -0,0 +1,281 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	_client "github.com/yazeed1s/sqlweb/pkg/client"
+)
+
+const (
+	preferencesFileName = "preferences.json"
+	// maxRecentTables is the number of recently opened tables kept per connection
+	maxRecentTables = 20
+	// maxTableRenames is the number of table renames kept per connection
+	maxTableRenames = 100
+)
+
+// RecentTable records when a table was last opened. Schema is empty for the tables of SQLite connections
+// and for those recorded before recent tables were kept per schema.
+type RecentTable struct {
+	Schema   string    `json:"schema,omitempty"`
+	Table    string    `json:"table"`
+	OpenedAt time.Time `json:"lastOpenedAt"`
+}
+
+// TableRename records a table renamed through sqlweb, so the saved queries and export templates
+// naming it can be pointed at its new name.
+type TableRename struct {
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	RenamedAt time.Time `json:"renamedAt"`
+}
+
+// Preferences holds the per-connection UI state that survives restarts,
+// such as favorite tables, the most recently opened ones (newest first), export templates
+// and the tables renamed, oldest first.
+type Preferences struct {
+	Favorites []string                 `json:"favorites"`
+	Recent    []RecentTable            `json:"recent"`
+	Templates []_client.ExportTemplate `json:"templates,omitempty"`
+	Renames   []TableRename            `json:"renames,omitempty"`
+}
+
+// preferencesMu serializes read-modify-write cycles on the preferences file.
+var preferencesMu sync.Mutex
+
+// readPreferences loads every connection's preferences, keyed by connection key.
+// A missing file is not an error and yields an empty map.
+func readPreferences() (map[string]*Preferences, error) {
+	var (
+		err      error
+		fileName string
+		bytes    []byte
+		prefs    map[string]*Preferences
+	)
+	fileName, err = appFilePath(preferencesFileName)
+	if err != nil {
+		return nil, err
+	}
+	prefs = make(map[string]*Preferences)
+	bytes, err = os.ReadFile(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return prefs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(bytes, &prefs); err != nil {
+		return nil, err
+	}
+	return prefs, nil
+}
+
+// writePreferences persists every connection's preferences.
+func writePreferences(prefs map[string]*Preferences) error {
+	var (
+		err      error
+		fileName string
+		data     []byte
+	)
+	fileName, err = appFilePath(preferencesFileName)
+	if err != nil {
+		return err
+	}
+	data, err = json.MarshalIndent(prefs, "", "\t")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(fileName, data)
+}
+
+// updatePreferences applies fn to the preferences of the given connection and saves the result.
+func updatePreferences(key string, fn func(p *Preferences)) (Preferences, error) {
+	preferencesMu.Lock()
+	defer preferencesMu.Unlock()
+
+	prefs, err := readPreferences()
+	if err != nil {
+		return Preferences{}, err
+	}
+	p, ok := prefs[key]
+	if !ok {
+		p = &Preferences{}
+		prefs[key] = p
+	}
+	fn(p)
+	if err = writePreferences(prefs); err != nil {
+		return Preferences{}, err
+	}
+	return *p, nil
+}
+
+// GetPreferences returns the saved preferences of the given connection.
+func GetPreferences(key string) (Preferences, error) {
+	preferencesMu.Lock()
+	defer preferencesMu.Unlock()
+
+	prefs, err := readPreferences()
+	if err != nil {
+		return Preferences{}, err
+	}
+	if p, ok := prefs[key]; ok {
+		return *p, nil
+	}
+	return Preferences{}, nil
+}
+
+// RecordTableOpens adds the tables opened to the connection's recent list, see MergeRecentTables.
+func RecordTableOpens(key string, opened []RecentTable) error {
+	_, err := updatePreferences(key, func(p *Preferences) {
+		p.Recent = MergeRecentTables(p.Recent, opened)
+	})
+	return err
+}
+
+// MergeRecentTables returns the recent list with the tables opened moved to the front, newest first.
+// A table is listed once per schema, and the oldest entries beyond maxRecentTables are evicted.
+func MergeRecentTables(recent, opened []RecentTable) []RecentTable {
+	all := make([]RecentTable, 0, len(recent)+len(opened))
+	all = append(all, opened...)
+	all = append(all, recent...)
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].OpenedAt.After(all[j].OpenedAt)
+	})
+
+	type tableKey struct{ schema, table string }
+	seen := make(map[tableKey]bool, len(all))
+	merged := make([]RecentTable, 0, len(all))
+	for _, r := range all {
+		key := tableKey{schema: r.Schema, table: r.Table}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		merged = append(merged, r)
+	}
+	if len(merged) > maxRecentTables {
+		merged = merged[:maxRecentTables]
+	}
+	return merged
+}
+
+// ToggleFavorite adds the table to the connection's favorites, or removes it if it is already one.
+// It returns whether the table is a favorite after the toggle.
+func ToggleFavorite(key, table string) (bool, error) {
+	var favorite bool
+	_, err := updatePreferences(key, func(p *Preferences) {
+		favorites := make([]string, 0, len(p.Favorites)+1)
+		for _, f := range p.Favorites {
+			if f != table {
+				favorites = append(favorites, f)
+			}
+		}
+		favorite = len(favorites) == len(p.Favorites)
+		if favorite {
+			favorites = append(favorites, table)
+		}
+		p.Favorites = favorites
+	})
+	if err != nil {
+		return false, err
+	}
+	return favorite, nil
+}
+
+// IsFavorite reports whether the table is one of the favorites.
+func (p Preferences) IsFavorite(table string) bool {
+	for _, f := range p.Favorites {
+		if f == table {
+			return true
+		}
+	}
+	return false
+}
+
+// LastOpened returns when the table of the schema was last opened, or nil if it is not in the recent list.
+func (p Preferences) LastOpened(schema, table string) *time.Time {
+	for _, r := range p.Recent {
+		if r.Schema == schema && r.Table == table {
+			openedAt := r.OpenedAt
+			return &openedAt
+		}
+	}
+	return nil
+}
+
+// SaveExportTemplate saves the template for the given connection, replacing the one with the same name.
+func SaveExportTemplate(key string, template _client.ExportTemplate) error {
+	_, err := updatePreferences(key, func(p *Preferences) {
+		for i, t := range p.Templates {
+			if t.Name == template.Name {
+				p.Templates[i] = template
+				return
+			}
+		}
+		p.Templates = append(p.Templates, template)
+	})
+	return err
+}
+
+// DeleteExportTemplate deletes the named template of the given connection.
+// It returns whether there was one to delete.
+func DeleteExportTemplate(key, name string) (bool, error) {
+	var deleted bool
+	_, err := updatePreferences(key, func(p *Preferences) {
+		templates := make([]_client.ExportTemplate, 0, len(p.Templates))
+		for _, t := range p.Templates {
+			if t.Name != name {
+				templates = append(templates, t)
+			}
+		}
+		deleted = len(templates) != len(p.Templates)
+		p.Templates = templates
+	})
+	if err != nil {
+		return false, err
+	}
+	return deleted, nil
+}
+
+// ExportTemplate returns the named template, or false if there is none.
+func (p Preferences) ExportTemplate(name string) (_client.ExportTemplate, bool) {
+	for _, t := range p.Templates {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return _client.ExportTemplate{}, false
+}
+
+// RecordTableRename adds the rename of a table to the connection's rename log,
+// dropping the oldest renames beyond maxTableRenames.
+func RecordTableRename(key, from, to string) error {
+	_, err := updatePreferences(key, func(p *Preferences) {
+		p.Renames = append(p.Renames, TableRename{From: from, To: to, RenamedAt: time.Now()})
+		if len(p.Renames) > maxTableRenames {
+			p.Renames = p.Renames[len(p.Renames)-maxTableRenames:]
+		}
+	})
+	return err
+}
+
+// RenamedTo follows the renames of the table in the order they were made, and returns the name
+// it ends up with, or false if it was not renamed or was renamed back.
+func (p Preferences) RenamedTo(table string) (string, bool) {
+	var (
+		name    = table
+		renamed bool
+	)
+	for _, rename := range p.Renames {
+		if rename.From == name {
+			name = rename.To
+			renamed = true
+		}
+	}
+	return name, renamed && name != table
+}
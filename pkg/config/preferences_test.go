@@ -0,0 +1,85 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToggleFavorite(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	key := "mysql://root@localhost:3306/shop"
+
+	favorite, err := ToggleFavorite(key, "orders")
+	require.NoError(t, err)
+	assert.True(t, favorite)
+
+	prefs, err := GetPreferences(key)
+	require.NoError(t, err)
+	assert.True(t, prefs.IsFavorite("orders"))
+
+	favorite, err = ToggleFavorite(key, "orders")
+	require.NoError(t, err)
+	assert.False(t, favorite)
+
+	prefs, err = GetPreferences(key)
+	require.NoError(t, err)
+	assert.False(t, prefs.IsFavorite("orders"))
+}
+
+func TestRecordTableOpens(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	key := "postgresql://postgres@localhost:5432/shop"
+	start := time.Now()
+
+	opened := make([]RecentTable, 0, maxRecentTables+5)
+	for i := 0; i < maxRecentTables+5; i++ {
+		opened = append(opened, RecentTable{Schema: "public", Table: fmt.Sprintf("table_%d", i), OpenedAt: start.Add(time.Duration(i) * time.Second)})
+	}
+	require.NoError(t, RecordTableOpens(key, opened))
+	require.NoError(t, RecordTableOpens(key, []RecentTable{
+		{Schema: "public", Table: "table_10", OpenedAt: start.Add(time.Minute)},
+		{Schema: "audit", Table: "table_10", OpenedAt: start.Add(time.Minute - time.Second)},
+	}))
+
+	prefs, err := GetPreferences(key)
+	require.NoError(t, err)
+	assert.Len(t, prefs.Recent, maxRecentTables)
+	assert.Equal(t, RecentTable{Schema: "public", Table: "table_10"}, RecentTable{Schema: prefs.Recent[0].Schema, Table: prefs.Recent[0].Table})
+	assert.Equal(t, RecentTable{Schema: "audit", Table: "table_10"}, RecentTable{Schema: prefs.Recent[1].Schema, Table: prefs.Recent[1].Table})
+	assert.Equal(t, "table_24", prefs.Recent[2].Table)
+	assert.NotNil(t, prefs.LastOpened("public", "table_10"))
+	assert.NotNil(t, prefs.LastOpened("audit", "table_10"))
+	assert.Nil(t, prefs.LastOpened("audit", "table_11"))
+	assert.Nil(t, prefs.LastOpened("public", "table_0"))
+
+	other, err := GetPreferences("sqlite:///tmp/shop.db")
+	require.NoError(t, err)
+	assert.Empty(t, other.Recent)
+}
+
+func TestRecordTableRename(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	key := "sqlite:///tmp/shop.db"
+
+	require.NoError(t, RecordTableRename(key, "orders", "purchases"))
+	require.NoError(t, RecordTableRename(key, "purchases", "sales"))
+	require.NoError(t, RecordTableRename(key, "items", "products"))
+	require.NoError(t, RecordTableRename(key, "products", "items"))
+
+	prefs, err := GetPreferences(key)
+	require.NoError(t, err)
+	renamed, ok := prefs.RenamedTo("orders")
+	assert.True(t, ok)
+	assert.Equal(t, "sales", renamed)
+	_, ok = prefs.RenamedTo("items")
+	assert.False(t, ok, "a table renamed back keeps its name")
+	_, ok = prefs.RenamedTo("customers")
+	assert.False(t, ok)
+}
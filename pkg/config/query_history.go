@@ -0,0 +1,165 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	queryHistoryFileName = "query_history.json"
+	// maxQueryHistory is the number of executed queries kept across all connections
+	maxQueryHistory = 500
+)
+
+// QueryHistoryEntry records one execution of a query from the editor.
+// The ID is generated once when the entry is created and never changes.
+type QueryHistoryEntry struct {
+	ID           string    `json:"id"`
+	Connection   string    `json:"connection"`
+	Query        string    `json:"query"`
+	AffectedRows int64     `json:"affected_rows"`
+	Time         string    `json:"time_taken"`
+	ExecutedAt   time.Time `json:"executed_at"`
+}
+
+// queryHistoryMu serializes read-modify-write cycles on the query history file.
+var queryHistoryMu sync.Mutex
+
+func readQueryHistory() ([]QueryHistoryEntry, error) {
+	var (
+		err      error
+		fileName string
+		bytes    []byte
+		entries  []QueryHistoryEntry
+	)
+	fileName, err = appFilePath(queryHistoryFileName)
+	if err != nil {
+		return nil, err
+	}
+	bytes, err = os.ReadFile(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(bytes, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func writeQueryHistory(entries []QueryHistoryEntry) error {
+	var (
+		err      error
+		fileName string
+		data     []byte
+	)
+	fileName, err = appFilePath(queryHistoryFileName)
+	if err != nil {
+		return err
+	}
+	data, err = json.MarshalIndent(entries, "", "\t")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(fileName, data)
+}
+
+// newHistoryID returns a random identifier for a history entry.
+func newHistoryID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// AppendQueryHistory stores a new entry, newest first, dropping the oldest ones
+// beyond maxQueryHistory. The ID and execution time are filled in and the stored entry is returned.
+func AppendQueryHistory(entry QueryHistoryEntry) (QueryHistoryEntry, error) {
+	queryHistoryMu.Lock()
+	defer queryHistoryMu.Unlock()
+
+	entries, err := readQueryHistory()
+	if err != nil {
+		return QueryHistoryEntry{}, err
+	}
+	entry.ID, err = newHistoryID()
+	if err != nil {
+		return QueryHistoryEntry{}, err
+	}
+	entry.ExecutedAt = time.Now()
+
+	entries = append([]QueryHistoryEntry{entry}, entries...)
+	if len(entries) > maxQueryHistory {
+		entries = entries[:maxQueryHistory]
+	}
+	if err = writeQueryHistory(entries); err != nil {
+		return QueryHistoryEntry{}, err
+	}
+	return entry, nil
+}
+
+// GetQueryHistory returns the history of the given connection, newest first.
+func GetQueryHistory(key string) ([]QueryHistoryEntry, error) {
+	queryHistoryMu.Lock()
+	defer queryHistoryMu.Unlock()
+
+	entries, err := readQueryHistory()
+	if err != nil {
+		return nil, err
+	}
+	history := make([]QueryHistoryEntry, 0)
+	for _, e := range entries {
+		if e.Connection == key {
+			history = append(history, e)
+		}
+	}
+	return history, nil
+}
+
+// FindQueryHistory returns the history entry with the given ID.
+func FindQueryHistory(id string) (QueryHistoryEntry, error) {
+	queryHistoryMu.Lock()
+	defer queryHistoryMu.Unlock()
+
+	entries, err := readQueryHistory()
+	if err != nil {
+		return QueryHistoryEntry{}, err
+	}
+	for _, e := range entries {
+		if e.ID == id {
+			return e, nil
+		}
+	}
+	return QueryHistoryEntry{}, fmt.Errorf("query history entry not found for id: %s", id)
+}
+
+// UpdateQueryHistory replaces the query of the history entry with the given ID, keeping its place.
+func UpdateQueryHistory(id, query string) (QueryHistoryEntry, error) {
+	queryHistoryMu.Lock()
+	defer queryHistoryMu.Unlock()
+
+	entries, err := readQueryHistory()
+	if err != nil {
+		return QueryHistoryEntry{}, err
+	}
+	for i := range entries {
+		if entries[i].ID != id {
+			continue
+		}
+		entries[i].Query = query
+		if err = writeQueryHistory(entries); err != nil {
+			return QueryHistoryEntry{}, err
+		}
+		return entries[i], nil
+	}
+	return QueryHistoryEntry{}, fmt.Errorf("query history entry not found for id: %s", id)
+}
@@ -0,0 +1,146 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+const savedQueriesFileName = "saved_queries.json"
+
+// SavedQuery is a named query of a connection, kept to be run again. Params names its :name
+// placeholders, which are bound to the values given when it runs.
+type SavedQuery struct {
+	Name        string    `json:"name"`
+	Connection  string    `json:"connection"`
+	Query       string    `json:"query"`
+	Description string    `json:"description,omitempty"`
+	Params      []string  `json:"params"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// savedQueriesMu serializes read-modify-write cycles on the saved queries file.
+var savedQueriesMu sync.Mutex
+
+func readSavedQueries() ([]SavedQuery, error) {
+	var (
+		err      error
+		fileName string
+		bytes    []byte
+		queries  []SavedQuery
+	)
+	fileName, err = appFilePath(savedQueriesFileName)
+	if err != nil {
+		return nil, err
+	}
+	bytes, err = os.ReadFile(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return queries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(bytes, &queries); err != nil {
+		return nil, err
+	}
+	return queries, nil
+}
+
+func writeSavedQueries(queries []SavedQuery) error {
+	fileName, err := appFilePath(savedQueriesFileName)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(queries, "", "\t")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(fileName, data)
+}
+
+// GetSavedQueries returns the saved queries of the given connection, in the order they were first saved.
+func GetSavedQueries(key string) ([]SavedQuery, error) {
+	savedQueriesMu.Lock()
+	defer savedQueriesMu.Unlock()
+
+	saved, err := readSavedQueries()
+	if err != nil {
+		return nil, err
+	}
+	queries := make([]SavedQuery, 0)
+	for _, q := range saved {
+		if q.Connection == key {
+			queries = append(queries, q)
+		}
+	}
+	return queries, nil
+}
+
+// FindSavedQuery returns the named saved query of the given connection, or false if there is none.
+func FindSavedQuery(key, name string) (SavedQuery, bool, error) {
+	queries, err := GetSavedQueries(key)
+	if err != nil {
+		return SavedQuery{}, false, err
+	}
+	for _, q := range queries {
+		if q.Name == name {
+			return q, true, nil
+		}
+	}
+	return SavedQuery{}, false, nil
+}
+
+// SaveQuery saves the query, replacing the one of the same connection with the same name and keeping
+// its creation time. The stored query is returned.
+func SaveQuery(query SavedQuery) (SavedQuery, error) {
+	savedQueriesMu.Lock()
+	defer savedQueriesMu.Unlock()
+
+	saved, err := readSavedQueries()
+	if err != nil {
+		return SavedQuery{}, err
+	}
+	query.UpdatedAt = time.Now()
+	query.CreatedAt = query.UpdatedAt
+	replaced := false
+	for i, q := range saved {
+		if q.Connection == query.Connection && q.Name == query.Name {
+			query.CreatedAt = q.CreatedAt
+			saved[i] = query
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		saved = append(saved, query)
+	}
+	if err = writeSavedQueries(saved); err != nil {
+		return SavedQuery{}, err
+	}
+	return query, nil
+}
+
+// DeleteSavedQuery deletes the named saved query of the given connection.
+// It returns whether there was one to delete.
+func DeleteSavedQuery(key, name string) (bool, error) {
+	savedQueriesMu.Lock()
+	defer savedQueriesMu.Unlock()
+
+	saved, err := readSavedQueries()
+	if err != nil {
+		return false, err
+	}
+	kept := make([]SavedQuery, 0, len(saved))
+	for _, q := range saved {
+		if q.Connection != key || q.Name != name {
+			kept = append(kept, q)
+		}
+	}
+	if len(kept) == len(saved) {
+		return false, nil
+	}
+	return true, writeSavedQueries(kept)
+}
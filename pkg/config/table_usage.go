@@ -0,0 +1,161 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const tableUsageFileName = "table_usage.json"
+
+// TableUsage counts the operations run on a table of a connection through sqlweb:
+// the pages of it viewed, its exports and the edits of its rows.
+type TableUsage struct {
+	Connection   string    `json:"connection"`
+	Table        string    `json:"table"`
+	Views        int64     `json:"views"`
+	Exports      int64     `json:"exports"`
+	Edits        int64     `json:"edits"`
+	LastAccessAt time.Time `json:"lastAccessAt"`
+}
+
+// Total is the number of operations counted.
+func (u TableUsage) Total() int64 {
+	return u.Views + u.Exports + u.Edits
+}
+
+// add adds the counts of other, keeping the latest access.
+func (u *TableUsage) add(other TableUsage) {
+	u.Views += other.Views
+	u.Exports += other.Exports
+	u.Edits += other.Edits
+	if other.LastAccessAt.After(u.LastAccessAt) {
+		u.LastAccessAt = other.LastAccessAt
+	}
+}
+
+// tableUsageMu serializes read-modify-write cycles on the table usage file.
+var tableUsageMu sync.Mutex
+
+func readTableUsage() ([]TableUsage, error) {
+	var (
+		err      error
+		fileName string
+		bytes    []byte
+		usage    []TableUsage
+	)
+	fileName, err = appFilePath(tableUsageFileName)
+	if err != nil {
+		return nil, err
+	}
+	bytes, err = os.ReadFile(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return usage, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(bytes, &usage); err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+func writeTableUsage(usage []TableUsage) error {
+	fileName, err := appFilePath(tableUsageFileName)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(usage, "", "\t")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(fileName, data)
+}
+
+// MergeTableUsage adds the counts of each table to the saved ones, see SortTableUsage.
+func MergeTableUsage(saved, counts []TableUsage) []TableUsage {
+	type key struct{ connection, table string }
+	merged := make([]TableUsage, 0, len(saved)+len(counts))
+	index := make(map[key]int, len(saved)+len(counts))
+	for _, list := range [][]TableUsage{saved, counts} {
+		for _, u := range list {
+			k := key{u.Connection, u.Table}
+			if i, ok := index[k]; ok {
+				merged[i].add(u)
+				continue
+			}
+			index[k] = len(merged)
+			merged = append(merged, u)
+		}
+	}
+	return merged
+}
+
+// SortTableUsage sorts the tables the most used first, then by connection and table.
+func SortTableUsage(usage []TableUsage) {
+	sort.Slice(usage, func(i, j int) bool {
+		a, b := usage[i], usage[j]
+		if a.Total() != b.Total() {
+			return a.Total() > b.Total()
+		}
+		if a.Connection != b.Connection {
+			return a.Connection < b.Connection
+		}
+		return a.Table < b.Table
+	})
+}
+
+// AddTableUsage adds the counts to those saved.
+func AddTableUsage(counts []TableUsage) error {
+	if len(counts) == 0 {
+		return nil
+	}
+	tableUsageMu.Lock()
+	defer tableUsageMu.Unlock()
+
+	saved, err := readTableUsage()
+	if err != nil {
+		return err
+	}
+	return writeTableUsage(MergeTableUsage(saved, counts))
+}
+
+// GetTableUsage returns the saved usage of the tables of the connection, of every connection when key is empty.
+func GetTableUsage(key string) ([]TableUsage, error) {
+	tableUsageMu.Lock()
+	defer tableUsageMu.Unlock()
+
+	saved, err := readTableUsage()
+	if err != nil {
+		return nil, err
+	}
+	usage := make([]TableUsage, 0, len(saved))
+	for _, u := range saved {
+		if key == "" || u.Connection == key {
+			usage = append(usage, u)
+		}
+	}
+	return usage, nil
+}
+
+// ResetTableUsage forgets the saved usage of the tables of the connection, of every connection when key is empty.
+func ResetTableUsage(key string) error {
+	tableUsageMu.Lock()
+	defer tableUsageMu.Unlock()
+
+	saved, err := readTableUsage()
+	if err != nil {
+		return err
+	}
+	kept := make([]TableUsage, 0, len(saved))
+	for _, u := range saved {
+		if key != "" && u.Connection != key {
+			kept = append(kept, u)
+		}
+	}
+	return writeTableUsage(kept)
+}
@@ -0,0 +1,186 @@
+// Package doctor checks the environment sqlweb runs in: its config files, its saved connections
+// and the address it listens on, and reports what would get in the way.
+package doctor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/yazeed1s/sqlweb/db/connection"
+	_sql "github.com/yazeed1s/sqlweb/db/sql"
+	"github.com/yazeed1s/sqlweb/pkg/config"
+)
+
+// DefaultTimeout bounds each connection attempt unless Options.Timeout is set.
+const DefaultTimeout = 5 * time.Second
+
+// Status is the outcome of a check.
+type Status string
+
+const (
+	Pass Status = "pass"
+	// Warn does not fail the report, e.g. there are no saved connections yet
+	Warn Status = "warn"
+	Fail Status = "fail"
+)
+
+// Check is the outcome of a single check and what it found.
+type Check struct {
+	Name   string `json:"name"`
+	Status Status `json:"status"`
+	Detail string `json:"detail"`
+}
+
+// Report lists the checks in the order they ran.
+type Report struct {
+	Checks []Check `json:"checks"`
+}
+
+// Options tell what to check.
+type Options struct {
+	// Addr is the address the server would listen on, e.g. ":3000"
+	Addr string
+	// APIAddr is the address the API would listen on when it has a port of its own, empty otherwise
+	APIAddr string
+	// Timeout bounds each connection attempt, DefaultTimeout when 0
+	Timeout time.Duration
+}
+
+// Failed reports whether any check failed.
+func (r *Report) Failed() bool {
+	for _, check := range r.Checks {
+		if check.Status == Fail {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Report) add(name string, status Status, detail string) {
+	r.Checks = append(r.Checks, Check{Name: name, Status: status, Detail: detail})
+}
+
+// Write prints the report as a table, one check per line.
+func (r *Report) Write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, check := range r.Checks {
+		if _, err := fmt.Fprintf(tw, "%s\t%s\t%s\n", strings.ToUpper(string(check.Status)), check.Name, check.Detail); err != nil {
+			return err
+		}
+	}
+	return tw.Flush()
+}
+
+// WriteJSON prints the report as JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(r)
+}
+
+// Run runs every check. Saved connections are tried one at a time, each within opts.Timeout.
+func Run(ctx context.Context, opts Options) *Report {
+	var (
+		report      = &Report{Checks: make([]Check, 0)}
+		connections []connection.Connection
+		parsed      bool
+	)
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+
+	checkConfigDir(report)
+	connections, parsed = checkConnectionHistory(report)
+	if parsed {
+		for i := range connections {
+			checkConnection(ctx, report, &connections[i], opts.Timeout)
+		}
+	}
+	if opts.Addr != "" {
+		checkAddr(report, "listen address", opts.Addr)
+	}
+	if opts.APIAddr != "" {
+		checkAddr(report, "API listen address", opts.APIAddr)
+	}
+	return report
+}
+
+func checkConfigDir(report *Report) {
+	dir, err := config.CheckConfigDir()
+	if err != nil {
+		report.add("config directory", Fail, fmt.Sprintf("%s is not writable: %v", dir, err))
+		return
+	}
+	report.add("config directory", Pass, fmt.Sprintf("%s is writable", dir))
+}
+
+// checkConnectionHistory reads the saved connections, reporting whether the file could be parsed.
+func checkConnectionHistory(report *Report) ([]connection.Connection, bool) {
+	connections, err := config.GetSavedConnections()
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		report.add("connection history", Warn, "no saved connections yet")
+		return nil, false
+	case err != nil:
+		report.add("connection history", Fail, fmt.Sprintf("cannot be read: %v", err))
+		return nil, false
+	}
+	report.add("connection history", Pass, fmt.Sprintf("%d saved connection(s)", len(connections)))
+	return connections, true
+}
+
+// checkConnection tries to connect to a saved connection. A SQLite file that is missing is reported
+// as such rather than as unreachable.
+func checkConnection(ctx context.Context, report *Report, conn *connection.Connection, timeout time.Duration) {
+	name := fmt.Sprintf("connection %s", connectionName(conn))
+
+	if conn.Type == _sql.SQLite && !isMemory(conn.Path) {
+		if _, err := os.Stat(conn.Path); err != nil {
+			report.add(name, Fail, fmt.Sprintf("sqlite file %s: %v", conn.Path, err))
+			return
+		}
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	if err := connection.Probe(probeCtx, conn); err != nil {
+		report.add(name, Fail, fmt.Sprintf("unreachable: %v", err))
+		return
+	}
+	report.add(name, Pass, fmt.Sprintf("%s reachable in %s", conn.Type.String(), time.Since(start).Round(time.Millisecond)))
+}
+
+func checkAddr(report *Report, name, addr string) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		report.add(name, Fail, fmt.Sprintf("%s is not available: %v", addr, err))
+		return
+	}
+	_ = listener.Close()
+	report.add(name, Pass, fmt.Sprintf("%s is available", addr))
+}
+
+// connectionName names a saved connection by its label, falling back to its database or file.
+func connectionName(conn *connection.Connection) string {
+	switch {
+	case conn.Label != "":
+		return conn.Label
+	case conn.Name != "":
+		return conn.Name
+	default:
+		return conn.Path
+	}
+}
+
+func isMemory(path string) bool {
+	return path == ":memory:" || strings.Contains(path, "mode=memory")
+}
@@ -0,0 +1,88 @@
+package doctor
+
+import (
+	"context"
+	"database/sql"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yazeed1s/sqlweb/db/connection"
+	_sql "github.com/yazeed1s/sqlweb/db/sql"
+	"github.com/yazeed1s/sqlweb/pkg/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func checkStatus(t *testing.T, report *Report, name string) Status {
+	for _, check := range report.Checks {
+		if check.Name == name {
+			return check.Status
+		}
+	}
+	t.Fatalf("no check named %q in %+v", name, report.Checks)
+	return ""
+}
+
+func TestRunWithoutSavedConnections(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	report := Run(context.Background(), Options{Addr: "127.0.0.1:0"})
+
+	assert.Equal(t, Pass, checkStatus(t, report, "config directory"))
+	assert.Equal(t, Warn, checkStatus(t, report, "connection history"))
+	assert.Equal(t, Pass, checkStatus(t, report, "listen address"))
+	assert.False(t, report.Failed())
+}
+
+func TestRunReportsFailures(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	dir := t.TempDir()
+	present := filepath.Join(dir, "present.db")
+	db, err := sql.Open("sqlite3", present)
+	require.NoError(t, err)
+	_, err = db.Exec("CREATE TABLE t (id INTEGER)")
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	for _, conn := range []*connection.Connection{
+		{Type: _sql.SQLite, Name: "present", Path: present},
+		{Type: _sql.SQLite, Name: "missing", Path: filepath.Join(dir, "missing.db")},
+	} {
+		_, err = config.WriteToFile(config.NewConnectionConfig(conn.Name, conn))
+		require.NoError(t, err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	report := Run(context.Background(), Options{Addr: "127.0.0.1:0", APIAddr: listener.Addr().String()})
+
+	assert.Equal(t, Pass, checkStatus(t, report, "connection history"))
+	assert.Equal(t, Pass, checkStatus(t, report, "connection present"))
+	assert.Equal(t, Fail, checkStatus(t, report, "connection missing"))
+	assert.Equal(t, Pass, checkStatus(t, report, "listen address"))
+	assert.Equal(t, Fail, checkStatus(t, report, "API listen address"))
+	assert.True(t, report.Failed())
+	_, err = os.Stat(filepath.Join(dir, "missing.db"))
+	assert.True(t, os.IsNotExist(err), "checking a missing SQLite file must not create it")
+}
+
+func TestRunReportsUnparseableHistory(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configDir)
+	t.Setenv("HOME", t.TempDir())
+	require.NoError(t, os.MkdirAll(filepath.Join(configDir, "sqlweb"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(configDir, "sqlweb", "connection_history.json"), []byte("{"), 0o644))
+
+	report := Run(context.Background(), Options{})
+
+	assert.Equal(t, Fail, checkStatus(t, report, "connection history"))
+	assert.True(t, report.Failed())
+}
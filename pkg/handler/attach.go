@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/yazeed1s/sqlweb/db/connection"
+	_sql "github.com/yazeed1s/sqlweb/db/sql"
+	"github.com/yazeed1s/sqlweb/pkg/api"
+)
+
+// AttachDatabaseHandler attaches a SQLite database file to the connection under an alias,
+// its tables then being browsed as alias.table. The file is attached again on every reconnect.
+func (h *Handler) AttachDatabaseHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		var (
+			err        error
+			attachment connection.Attachment
+			tables     []string
+			res        api.AttachData
+			msg        string
+		)
+
+		if !strings.EqualFold(h.client.Type.String(), _sql.SQLite.String()) {
+			handleBadRequest(writer, "Databases can only be attached to a SQLite connection", nil)
+			return
+		}
+		err = json.NewDecoder(request.Body).Decode(&attachment)
+		if err != nil {
+			handleBadRequest(writer, "Invalid JSON", err)
+			return
+		}
+
+		err = connection.Attach(h.client.Database, attachment)
+		if err != nil {
+			msg = fmt.Sprintf("Failed to attach %s as %s", attachment.Path, attachment.Alias)
+			handleBadRequest(writer, msg, err)
+			return
+		}
+		h.attachedChanged()
+
+		tables, err = h.client.AttachedTables()
+		if err != nil {
+			handleErrorRequest(writer, http.StatusInternalServerError, "Failed to list the attached tables", err)
+			return
+		}
+		res = api.AttachData{AttachedData: api.AttachedData{Attached: connection.Attached(h.client.Database)}, Tables: tables}
+		handleSuccessRequest(writer, fmt.Sprintf("Attached %s as %s", attachment.Path, attachment.Alias), res)
+	}
+}
+
+// DetachDatabaseHandler detaches the SQLite database attached under the alias given as name.
+func (h *Handler) DetachDatabaseHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		var (
+			err   error
+			alias string
+			res   api.AttachedData
+		)
+
+		err = checkURLParams(request.URL, 1)
+		if err != nil {
+			handleBadRequest(writer, "", err)
+			return
+		}
+		if !strings.EqualFold(h.client.Type.String(), _sql.SQLite.String()) {
+			handleBadRequest(writer, "Databases can only be detached from a SQLite connection", nil)
+			return
+		}
+
+		alias = request.URL.Query().Get("name")
+		err = connection.Detach(h.client.Database, alias)
+		if err != nil {
+			handleBadRequest(writer, fmt.Sprintf("Failed to detach %s", alias), err)
+			return
+		}
+		h.attachedChanged()
+
+		res = api.AttachedData{Attached: connection.Attached(h.client.Database)}
+		handleSuccessRequest(writer, fmt.Sprintf("Detached %s", alias), res)
+	}
+}
+
+// attachedChanged records the databases now attached with the session's connection, so a resumed
+// connection attaches them again, and bumps the schema version as their tables came or went.
+func (h *Handler) attachedChanged() {
+	h.session.mu.Lock()
+	if h.session.conn != nil {
+		h.session.conn.Attached = connection.Attached(h.client.Database)
+	}
+	h.session.mu.Unlock()
+	h.schemaChanged()
+}
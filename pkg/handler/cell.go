@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/yazeed1s/sqlweb/pkg/query"
+)
+
+// CellDownloadRequest identifies the cell to download by its table, column and row key,
+// e.g. one listed in the warnings of a result.
+type CellDownloadRequest struct {
+	Table      string        `json:"table"`
+	Column     string        `json:"column"`
+	KeyColumns []string      `json:"keyColumns"`
+	KeyValues  []interface{} `json:"keyValues"`
+}
+
+// CellDownloadHandler sends the whole value of a single cell as a file, however large.
+// Values larger than the cell limit are only sent truncated in results.
+func (h *Handler) CellDownloadHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		var (
+			err  error
+			req  CellDownloadRequest
+			data []byte
+			msg  string
+		)
+
+		err = json.NewDecoder(request.Body).Decode(&req)
+		if err != nil {
+			handleBadRequest(writer, "Invalid JSON", err)
+			return
+		}
+		if req.Table == "" || req.Column == "" {
+			handleBadRequest(writer, "Table or column name is missing or empty", nil)
+			return
+		}
+
+		data, err = query.ReadCell(h.client, query.Cell{
+			Table:      req.Table,
+			Column:     req.Column,
+			KeyColumns: req.KeyColumns,
+			KeyValues:  req.KeyValues,
+		})
+		if err != nil {
+			msg = fmt.Sprintf("Failed to read %s.%s", req.Table, req.Column)
+			handleBadRequest(writer, msg, err)
+			return
+		}
+
+		handleSuccessFileRequest(writer, fmt.Sprintf("%s_%s", req.Table, req.Column), "application/octet-stream", data)
+	}
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/yazeed1s/sqlweb/pkg/api"
+	"github.com/yazeed1s/sqlweb/pkg/query"
+	"github.com/yazeed1s/sqlweb/pkg/util"
+)
+
+// ErrCodeConfirmationRequired is the response code sent when a destructive operation must be confirmed.
+const ErrCodeConfirmationRequired = "confirmation_required"
+
+// SetConfirmDestructive sets whether destructive operations (dropping or truncating tables and schemas,
+// deleting or updating rows) must be confirmed. Connections tagged production always require confirmation.
+func (h *Handler) SetConfirmDestructive(confirm bool) {
+	h.confirmDestructive = confirm
+}
+
+// production reports whether the active connection is tagged as production.
+func (s *session) production() bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conn != nil && s.conn.IsProduction()
+}
+
+// requiresConfirmation reports whether destructive operations must be confirmed on the active connection.
+func (h *Handler) requiresConfirmation() bool {
+	return h.confirmDestructive || h.session.production()
+}
+
+// rejectDestructive sends a 403 response and returns true when destructive operations must be confirmed
+// and the request does not carry a valid override. The token is the one rejectSystemTable hands out for
+// the same operation, so one confirmation covers both checks. An empty table targets the whole schema.
+func (h *Handler) rejectDestructive(writer http.ResponseWriter, operation, schema, table string, override SystemOverride) bool {
+	if !h.requiresConfirmation() {
+		return false
+	}
+	subject := operation + ":" + schema + "." + table
+	if override.allows(subject) {
+		return false
+	}
+	h.handleConfirmation(writer, []query.TableRef{{Schema: schema, Table: table}}, confirmationToken(subject))
+	return true
+}
+
+// rejectDestructiveQuery is rejectDestructive for queries that drop or truncate objects, or delete or update
+// rows without a WHERE clause, see query.IsDestructiveStatement.
+func (h *Handler) rejectDestructiveQuery(writer http.ResponseWriter, sqlQuery string, override SystemOverride) bool {
+	if !h.requiresConfirmation() || !query.IsDestructiveStatement(h.client.Type.String(), sqlQuery) || override.allows(sqlQuery) {
+		return false
+	}
+	h.handleConfirmation(writer, query.DestructiveTargets(h.client.Type.String(), h.client.Schema.Name, sqlQuery), confirmationToken(sqlQuery))
+	return true
+}
+
+// handleConfirmation sends a JSON response listing the targets along with the token the client must send back,
+// together with allowSystem, to confirm the operation.
+func (h *Handler) handleConfirmation(writer http.ResponseWriter, targets []query.TableRef, token string) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusForbidden)
+	response := Response{
+		Message: "Destructive operation needs confirmation",
+		Error:   util.ErrConfirmation.Error(),
+		Code:    ErrCodeConfirmationRequired,
+		Data:    api.ConfirmationData{Targets: targets, Production: h.session.production(), ConfirmToken: token},
+	}
+	if err := json.NewEncoder(writer).Encode(response); err != nil {
+		http.Error(writer, "Error encoding JSON response", http.StatusInternalServerError)
+	}
+}
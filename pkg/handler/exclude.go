@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/yazeed1s/sqlweb/pkg/util"
+)
+
+// ErrCodePolicyViolation is sent in Response.Code when an export asks for a column the connection
+// excludes from exports.
+const ErrCodePolicyViolation = "policy_violation"
+
+// omittedColumnsHeader lists the columns an export left out, comma separated.
+const omittedColumnsHeader = "X-Omitted-Columns"
+
+// exportExclude returns the columns of the 'exclude' param, a comma separated list.
+func exportExclude(params url.Values) []string {
+	var exclude []string
+	for _, value := range params["exclude"] {
+		for _, column := range strings.Split(value, ",") {
+			if column = strings.TrimSpace(column); column != "" {
+				exclude = append(exclude, column)
+			}
+		}
+	}
+	return exclude
+}
+
+// setOmittedColumns records the columns an export left out on the response, before it is written.
+func setOmittedColumns(writer http.ResponseWriter, omitted []string) {
+	if len(omitted) > 0 {
+		writer.Header().Set(omittedColumnsHeader, strings.Join(omitted, ","))
+	}
+}
+
+// handleExportError sends a 403 response with the policy_violation code when an export asked for a column
+// the connection excludes from exports, and a 400 response for any other error.
+func handleExportError(writer http.ResponseWriter, message string, e error) {
+	if !errors.Is(e, util.ErrPolicyViolation) {
+		handleBadRequest(writer, message, e)
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusForbidden)
+	response := Response{
+		Message: "The connection excludes these columns from exports",
+		Error:   e.Error(),
+		Code:    ErrCodePolicyViolation,
+	}
+	if err := json.NewEncoder(writer).Encode(response); err != nil {
+		http.Error(writer, "Error encoding JSON response", http.StatusInternalServerError)
+	}
+}
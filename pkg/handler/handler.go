@@ -15,37 +15,70 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"math"
+	"log"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/yazeed1s/sqlweb/db/connection"
 	_sql "github.com/yazeed1s/sqlweb/db/sql"
+	"github.com/yazeed1s/sqlweb/pkg/api"
 	_client "github.com/yazeed1s/sqlweb/pkg/client"
 	"github.com/yazeed1s/sqlweb/pkg/config"
 	"github.com/yazeed1s/sqlweb/pkg/query"
+	"github.com/yazeed1s/sqlweb/pkg/util"
 )
 
 type Handler struct {
-	client *_client.Client
+	client      *_client.Client
+	readOnly    bool
+	session     *session
+	idleTimeout time.Duration
+	nulls       _client.NullFormat
+	floats      _client.FloatFormat
+	cells       _client.CellLimit
+	// defaultLimit is appended to the SELECTs run through /execute that have no LIMIT, see query.WithDefaultLimit
+	defaultLimit int
+	// multiStatements allows scripts on MySQL connections, see connection.ConnectForScript
+	multiStatements bool
+	// confirmDestructive requires confirming destructive operations on every connection, see rejectDestructive
+	confirmDestructive bool
+	uploads            *uploads
+	// usage counts the views, exports and edits of each table, see TableUsageHandler
+	usage *tableUsage
+	// recent holds the tables opened since the recent tables were last saved, see RecentTablesHandler
+	recent *recentTables
+	// noLegacyPagination stops /table from repeating the pagination in its data, see SetLegacyPagination
+	noLegacyPagination bool
+	// connectMu serializes connects and their responses, so that repeated ones share a single pool, see reuseConnection
+	connectMu sync.Mutex
+	// schemaVersion counts the schema changes run through the handler, see SchemaVersion
+	schemaVersion atomic.Uint64
+	// version is the sqlweb version reported in the reproductions of shareable queries, see SetVersion
+	version string
 }
 
 // Response represents a standard response structure for API responses.
-type Response struct {
-	Message string      `json:"message"`
-	Data    interface{} `json:"data,omitempty"`
-	Error   string      `json:"error,omitempty"`
-}
+// It is defined in pkg/api so that the Go client decodes exactly what the handlers encode.
+type Response = api.Response
 
 func NewHandler() *Handler {
 	return &Handler{
-		client: &_client.Client{},
+		client:  &_client.Client{},
+		session: &session{},
+		uploads: newUploads(),
+		usage:   newTableUsage(),
+		recent:  newRecentTables(),
 	}
 }
 
@@ -53,6 +86,81 @@ func (h *Handler) GetDB() *sql.DB {
 	return h.client.Database
 }
 
+// SetReadOnly turns read-only mode on or off. In read-only mode, handlers that change
+// the schema or the data are rejected.
+func (h *Handler) SetReadOnly(readOnly bool) {
+	h.readOnly = readOnly
+}
+
+// SetMultiStatements sets whether scripts of several statements may run against MySQL.
+func (h *Handler) SetMultiStatements(multiStatements bool) {
+	h.multiStatements = multiStatements
+}
+
+// SetNullFormat sets how NULL values are rendered in exports, for this and every later connection.
+func (h *Handler) SetNullFormat(nulls _client.NullFormat) {
+	h.nulls = nulls
+	h.client.Nulls = nulls
+}
+
+// SetDefaultLimit sets the LIMIT appended to the SELECTs run through /execute that have none,
+// for this and every later connection. Zero appends none.
+func (h *Handler) SetDefaultLimit(limit int) {
+	h.defaultLimit = limit
+	h.client.DefaultLimit = limit
+}
+
+// SetFloatFormat sets how floats are rendered in CSV exports, for this and every later connection.
+func (h *Handler) SetFloatFormat(floats _client.FloatFormat) {
+	h.floats = floats
+	h.client.Floats = floats
+}
+
+// SetCellLimit sets how large a value may be before it is truncated in results, for this and every later connection.
+func (h *Handler) SetCellLimit(cells _client.CellLimit) {
+	h.cells = cells
+	h.client.Cells = cells
+}
+
+// rejectReadOnly sends a 403 response and returns true when the handler runs in read-only mode.
+func (h *Handler) rejectReadOnly(writer http.ResponseWriter) bool {
+	if !h.readOnly {
+		return false
+	}
+	handleErrorRequest(writer, http.StatusForbidden, "Operation not allowed", util.ErrReadOnly)
+	return true
+}
+
+// ErrCodeSchemaChanged is the response code sent when a table changed since the client loaded it.
+const ErrCodeSchemaChanged = "schema_changed"
+
+// rejectSchemaChanged sends a 409 response and returns true when the table no longer matches
+// the fingerprint the client loaded it with. The response carries the current fingerprint.
+func (h *Handler) rejectSchemaChanged(writer http.ResponseWriter, table, fingerprint string) bool {
+	err := h.client.CheckFingerprint(table, fingerprint)
+	if err == nil {
+		return false
+	}
+	if !errors.Is(err, util.ErrSchemaChanged) {
+		handleBadRequest(writer, "Failed to check table structure", err)
+		return true
+	}
+
+	current, _ := h.client.TableFingerprint(table)
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusConflict)
+	response := Response{
+		Message: "Table structure changed, please reload it",
+		Error:   err.Error(),
+		Code:    ErrCodeSchemaChanged,
+		Data:    api.FingerprintData{Fingerprint: current},
+	}
+	if err = json.NewEncoder(writer).Encode(response); err != nil {
+		http.Error(writer, "Error encoding JSON response", http.StatusInternalServerError)
+	}
+	return true
+}
+
 // jsonResponse sends a JSON response with the specified HTTP status code.
 func jsonResponse(writer http.ResponseWriter, status int, data interface{}) {
 	writer.WriteHeader(status)
@@ -64,8 +172,55 @@ func jsonResponse(writer http.ResponseWriter, status int, data interface{}) {
 
 // handleBadRequest sends a JSON response for a bad request.
 func handleBadRequest(writer http.ResponseWriter, message string, e error) {
+	handleErrorRequest(writer, http.StatusBadRequest, message, e)
+}
+
+// ErrCodeResultTooLarge is the response code sent when a result is larger than the result size limit.
+const ErrCodeResultTooLarge = "result_too_large"
+
+// handleResultError sends a 413 response when reading a result stopped at the result size limit,
+// see _client.CellLimit, and a 400 response for any other error.
+func handleResultError(writer http.ResponseWriter, message string, e error) {
+	if !errors.Is(e, util.ErrResultTooLarge) {
+		handleBadRequest(writer, message, e)
+		return
+	}
 	writer.Header().Set("Content-Type", "application/json")
-	writer.WriteHeader(http.StatusBadRequest)
+	writer.WriteHeader(http.StatusRequestEntityTooLarge)
+	response := Response{
+		Message: "Result is too large to display, add a LIMIT or select fewer columns",
+		Error:   e.Error(),
+		Code:    ErrCodeResultTooLarge,
+	}
+	if err := json.NewEncoder(writer).Encode(response); err != nil {
+		http.Error(writer, "Error encoding JSON response", http.StatusInternalServerError)
+	}
+}
+
+// ErrCodeUnknownCollation is the response code sent when a table is sorted with a collation the server does not offer.
+const ErrCodeUnknownCollation = "unknown_collation"
+
+// handleTableError sends a 400 response listing the collations of the server when reading a table failed
+// on an unknown collation, and otherwise responds like handleResultError.
+func handleTableError(writer http.ResponseWriter, message string, e error) {
+	var unknown *_client.UnknownCollationError
+	if !errors.As(e, &unknown) {
+		handleResultError(writer, message, e)
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	jsonResponse(writer, http.StatusBadRequest, Response{
+		Message: message,
+		Error:   e.Error(),
+		Code:    ErrCodeUnknownCollation,
+		Data:    api.CollationsData{Available: unknown.Available},
+	})
+}
+
+// handleErrorRequest sends a JSON error response with the specified HTTP status code.
+func handleErrorRequest(writer http.ResponseWriter, status int, message string, e error) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
 
 	var (
 		response Response
@@ -73,11 +228,9 @@ func handleBadRequest(writer http.ResponseWriter, message string, e error) {
 	)
 
 	encoder = json.NewEncoder(writer)
+	response = Response{Message: message}
 	if e != nil {
-		response = Response{
-			Message: message,
-			Error:   e.Error(),
-		}
+		response.Error = e.Error()
 	}
 
 	if err := encoder.Encode(response); err != nil {
@@ -180,6 +333,15 @@ func parseConnectionRequest(request *http.Request) (*connection.Connection, erro
 	if err != nil {
 		return nil, err
 	}
+	if err = conn.CheckRequired(); err != nil {
+		return nil, err
+	}
+	if err = conn.CheckApplicationName(); err != nil {
+		return nil, err
+	}
+	if err = conn.Settings.Validate(); err != nil {
+		return nil, err
+	}
 
 	return &conn, nil
 }
@@ -193,6 +355,11 @@ func createClient(conn *connection.Connection) *_client.Client {
 		Password: conn.Password,
 		Name:     conn.Name,
 		Type:     conn.Type,
+		Path:     conn.Path,
+
+		Credentials:     conn.Credentials,
+		ApplicationName: conn.ApplicationName,
+		Settings:        conn.Settings,
 	}
 }
 
@@ -205,14 +372,27 @@ func setSchemaName(client *_client.Client) {
 	}
 }
 
-// getColumnsDataForTables retrieves column data for a list of tables.
-func getColumnsDataForTables(client *_client.Client, tableNames []string) ([]_client.ColumnData, error) {
+// getColumnsDataForTables retrieves column data for a list of tables,
+// flagging views, the favorites of prefs and when each table was last opened.
+func getColumnsDataForTables(client *_client.Client, tables []_client.TableInfo, prefs config.Preferences) ([]_client.ColumnData, error) {
 	columnsData := make([]_client.ColumnData, 0)
-	for _, tableName := range tableNames {
+	modified, err := client.GetTablesLastModified()
+	if err != nil {
+		log.Println("failed to read when tables were last modified:", err)
+	}
+	for _, table := range tables {
+		tableName := table.Name
 		columns, err := client.GetColumnsData(tableName)
 		if err != nil {
 			return columnsData, err
 		}
+		flagProtectedColumns(client, &columns)
+		columns.IsView = table.IsView
+		columns.Favorite = prefs.IsFavorite(tableName)
+		columns.LastOpenedAt = prefs.LastOpened(client.Schema.Name, tableName)
+		if m, ok := modified[tableName]; ok {
+			columns.LastModified = &m
+		}
 		columnsData = append(columnsData, columns)
 	}
 
@@ -274,6 +454,11 @@ func (h *Handler) SaveConnection() http.HandlerFunc {
 			return
 		}
 
+		if err = config.ValidateColor(conn.Color); err != nil {
+			handleBadRequest(writer, "Invalid connection color", err)
+			return
+		}
+
 		savedClient := config.NewConnectionConfig(conn.Name, conn)
 		b, err := config.WriteToFile(savedClient)
 		if err != nil {
@@ -282,7 +467,7 @@ func (h *Handler) SaveConnection() http.HandlerFunc {
 		}
 
 		if b == 0 {
-			msg := fmt.Sprintf("Error Saving connection info: %s", savedClient)
+			msg := fmt.Sprintf("Error Saving connection info: %v", savedClient)
 			handleBadRequest(writer, msg, err)
 			return
 		}
@@ -291,6 +476,78 @@ func (h *Handler) SaveConnection() http.HandlerFunc {
 	}
 }
 
+// ImportConnectionsHandler saves a batch of connection definitions, read from a JSON file sent as the body,
+// and reports which were added and which were skipped as invalid or already saved.
+func (h *Handler) ImportConnectionsHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		var (
+			body        []byte
+			connections []connection.Connection
+			result      config.ImportResult
+			err         error
+		)
+
+		reader, ok := requestBody(writer, request)
+		if !ok {
+			return
+		}
+		// the body as sent is capped by -mb like any other, and the decoded stream here, so that a small
+		// compressed body cannot expand without bound
+		body, err = io.ReadAll(http.MaxBytesReader(writer, io.NopCloser(reader), maxChunkSize))
+		if err != nil {
+			handleBadRequest(writer, "Failed to read connections", err)
+			return
+		}
+		connections, err = config.ParseConnections(body)
+		if err != nil {
+			handleBadRequest(writer, "Invalid connections file", err)
+			return
+		}
+
+		result, err = config.ImportConnections(connections)
+		if err != nil {
+			handleErrorRequest(writer, http.StatusInternalServerError, "Failed to import connections", err)
+			return
+		}
+		msg := fmt.Sprintf("Imported %d connections, skipped %d", len(result.Added), len(result.Skipped))
+		handleSuccessRequest(writer, msg, result)
+	}
+}
+
+// ExportConnectionsHandler sends the saved connections as a JSON file that /connections/import reads back.
+// Passwords are left out unless includePasswords is true.
+func (h *Handler) ExportConnectionsHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		var (
+			data             []byte
+			includePasswords bool
+			err              error
+		)
+
+		includePasswords, _ = strconv.ParseBool(request.URL.Query().Get("includePasswords"))
+		data, err = config.ExportConnections(includePasswords)
+		if err != nil {
+			handleErrorRequest(writer, http.StatusInternalServerError, "Failed to export connections", err)
+			return
+		}
+		handleSuccessFileRequest(writer, "connections.json", "application/json", data)
+	}
+}
+
 func (h *Handler) SavedConnectionsHandler() http.HandlerFunc {
 	return func(writer http.ResponseWriter, request *http.Request) {
 		defer func(Body io.ReadCloser) {
@@ -305,12 +562,23 @@ func (h *Handler) SavedConnectionsHandler() http.HandlerFunc {
 			err         error
 		)
 
+		page, perPage, paginated, err := pageParams(request.URL.Query())
+		if err != nil {
+			handleBadRequest(writer, "Invalid pagination parameters", err)
+			return
+		}
+
 		connections, err = config.GetSavedConnections()
 		if err != nil {
 			handleBadRequest(writer, "Error retrieving saved connections: ", err)
 			return
 		}
 
+		if paginated {
+			items, pagination := paginate(connections, page, perPage)
+			handlePaginatedRequest(writer, "Success: connection saved", items, pagination)
+			return
+		}
 		handleSuccessRequest(writer, "Success: connection saved", connections)
 	}
 }
@@ -325,63 +593,177 @@ func (h *Handler) ConnectHandler() http.HandlerFunc {
 		}(request.Body)
 
 		var (
-			conn        *connection.Connection
-			client      *_client.Client
-			db          *sql.DB
-			data        map[string]interface{}
-			err         error
-			msg         string
-			tableNames  []string
-			schema      string
-			columnsData []_client.ColumnData
+			conn    *connection.Connection
+			preview tablePreview
+			err     error
+			msg     string
 		)
 
 		conn, err = parseConnectionRequest(request)
 		if err != nil {
-			msg = fmt.Sprintf("Invalid request body: %v", request.Body)
+			msg = fmt.Sprintf("Invalid connection: %v", err)
 			handleBadRequest(writer, msg, err)
 			return
 		}
-
-		client = createClient(conn)
-		h.client = client
-		db, err = connection.ConnectToDatabase(conn, conn.Type.String())
+		preview, err = parseTablePreview(request.URL.Query())
 		if err != nil {
-			handleBadRequest(writer, "Failed to connect to the database", err)
+			handleBadRequest(writer, "Invalid table preview", err)
 			return
 		}
 
-		h.client.Database = db
-		if !strings.EqualFold(h.client.Type.String(), _sql.SQLite.String()) {
-			setSchemaName(h.client)
+		h.connectMu.Lock()
+		defer h.connectMu.Unlock()
+		if err = h.open(conn); err != nil {
+			handleBadRequest(writer, "Failed to connect to the database", err)
+			return
 		}
+		h.handleConnected(writer, preview)
+	}
+}
 
-		tableNames, err = h.client.GetTableNames()
+// ConnectSavedHandler connects to a saved connection, given by its key, and records it as used.
+func (h *Handler) ConnectSavedHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		var (
+			conn    connection.Connection
+			preview tablePreview
+			err     error
+			key     string
+		)
+
+		preview, err = parseTablePreview(request.URL.Query())
 		if err != nil {
-			msg = fmt.Sprintf("Failed to get available tables from %s", h.client.Name)
-			handleBadRequest(writer, msg, err)
+			handleBadRequest(writer, "Invalid table preview", err)
 			return
 		}
-
-		columnsData, err = getColumnsDataForTables(h.client, tableNames)
+		key = request.URL.Query().Get("key")
+		conn, err = config.ReadFromFile(key)
 		if err != nil {
-			msg = fmt.Sprintf("Failed to get columns data for tables from %s", h.client.Name)
-			handleBadRequest(writer, msg, err)
+			handleErrorRequest(writer, http.StatusNotFound, "Saved connection not found", err)
 			return
 		}
 
-		h.client.Schema.NumTables = len(tableNames)
-		msg = fmt.Sprintf("Successfully connected to %s", h.client.Name)
-		// for PostgreSQL, avoid sending 'public' as schema name to the frontend
-		if strings.EqualFold(h.client.Type.String(), _sql.PostgreSQL.String()) {
-			schema = h.client.Name
-		} else {
-			schema = h.client.Schema.Name
+		h.connectMu.Lock()
+		defer h.connectMu.Unlock()
+		if err = h.open(&conn); err != nil {
+			handleBadRequest(writer, "Failed to connect to the database", err)
+			return
+		}
+		if _, err = config.TouchConnection(key); err != nil {
+			log.Println("failed to record connection use:", err)
 		}
-		data = map[string]interface{}{"schema": schema, "tables": columnsData}
-		// log.Println("hey", h.client.Schema.Name)
-		handleSuccessRequest(writer, msg, data)
+		h.handleConnected(writer, preview)
+	}
+}
+
+// ConnectSaved connects to the saved connection with the given key and records it as used,
+// as the -c flag does at startup.
+func (h *Handler) ConnectSaved(key string) error {
+	conn, err := config.ReadFromFile(key)
+	if err != nil {
+		return err
+	}
+	h.connectMu.Lock()
+	defer h.connectMu.Unlock()
+	if err = h.open(&conn); err != nil {
+		return err
+	}
+	_, err = config.TouchConnection(key)
+	return err
+}
+
+// open connects to the database described by conn and makes it the active connection. When conn
+// reaches the database already connected to, its pool is kept; otherwise the previous pool is closed.
+// Callers hold connectMu.
+func (h *Handler) open(conn *connection.Connection) error {
+	var (
+		client *_client.Client
+		db     *sql.DB
+		err    error
+	)
+
+	if h.reuseConnection(conn) {
+		return nil
+	}
+	h.closeConnection()
+
+	client = createClient(conn)
+	client.Nulls = h.nulls
+	client.Floats = h.floats
+	client.Cells = h.cells
+	client.DefaultLimit = h.defaultLimit
+	h.client = client
+	db, err = connection.ConnectToDatabase(conn, conn.Type.String())
+	if err != nil {
+		return err
+	}
+
+	h.client.Database = db
+	h.session.connected(conn)
+	if !strings.EqualFold(h.client.Type.String(), _sql.SQLite.String()) {
+		setSchemaName(h.client)
 	}
+	return nil
+}
+
+// handleConnected sends the response of a successful connection: the schema and the columns of its tables.
+func (h *Handler) handleConnected(writer http.ResponseWriter, preview tablePreview) {
+	var (
+		data        api.ConnectData
+		err         error
+		msg         string
+		tables      []_client.TableInfo
+		tableNames  []string
+		schema      string
+		columnsData []_client.ColumnData
+		previewData *_client.Table
+		prefs       config.Preferences
+	)
+
+	tables, err = h.client.ListTables()
+	if err != nil {
+		msg = fmt.Sprintf("Failed to get available tables from %s", h.client.Name)
+		handleBadRequest(writer, msg, err)
+		return
+	}
+	for _, table := range tables {
+		tableNames = append(tableNames, table.Name)
+	}
+
+	prefs, err = h.preferences()
+	if err != nil {
+		log.Println("failed to read preferences:", err)
+	}
+	columnsData, err = getColumnsDataForTables(h.client, tables, prefs)
+	if err != nil {
+		msg = fmt.Sprintf("Failed to get columns data for tables from %s", h.client.Name)
+		handleBadRequest(writer, msg, err)
+		return
+	}
+
+	h.client.Schema.NumTables = len(tableNames)
+	msg = fmt.Sprintf("Successfully connected to %s", h.client.Name)
+	// for PostgreSQL, avoid sending 'public' as schema name to the frontend
+	if strings.EqualFold(h.client.Type.String(), _sql.PostgreSQL.String()) {
+		schema = h.client.Name
+	} else {
+		schema = h.client.Schema.Name
+	}
+	data = api.ConnectData{Schema: schema, Tables: columnsData, Settings: h.client.Settings}
+	// the connection is open either way, so a preview that cannot be read is reported rather than failing the connect
+	previewData, err = preview.read(h.client, tableNames)
+	if err != nil {
+		data.PreviewError = err.Error()
+	}
+	data.Preview = previewData
+	handleSuccessRequest(writer, msg, data)
 }
 
 func (h *Handler) DbDisconnect() http.HandlerFunc {
@@ -398,6 +780,7 @@ func (h *Handler) DbDisconnect() http.HandlerFunc {
 			handleBadRequest(writer, "Failed to disconnect from database", err)
 			return
 		}
+		h.session.disconnected()
 		handleSuccessRequest(writer, "Disconnected successfully")
 	}
 }
@@ -413,10 +796,10 @@ func (h *Handler) ShowSchemas() http.HandlerFunc {
 
 		var (
 			err     error
-			schemas []string
+			schemas []_client.SchemaInfo
 		)
 
-		schemas, err = h.client.GetSchemaNames()
+		schemas, err = h.client.GetSchemas()
 		if err != nil {
 			handleBadRequest(writer, "Failed to get schemas from database", err)
 			return
@@ -438,6 +821,7 @@ func (h *Handler) ShowTablesHandler() http.HandlerFunc {
 		var (
 			err        error
 			tableNames []string
+			attached   []string
 			msg        string
 		)
 
@@ -447,6 +831,13 @@ func (h *Handler) ShowTablesHandler() http.HandlerFunc {
 			handleBadRequest(writer, msg, err)
 			return
 		}
+		// the tables of attached SQLite databases are listed after those of main, as alias.table
+		attached, err = h.client.AttachedTables()
+		if err != nil {
+			handleBadRequest(writer, "Failed to get the tables of the attached databases", err)
+			return
+		}
+		tableNames = append(tableNames, attached...)
 
 		h.client.Schema.NumTables = len(tableNames)
 		handleSuccessRequest(writer, "", tableNames)
@@ -464,7 +855,7 @@ func (h *Handler) CountTableColumnsHandler() http.HandlerFunc {
 
 		var (
 			err       error
-			res       map[string]interface{}
+			res       api.ColumnCountData
 			msg       string
 			tableName string
 			cols      int
@@ -484,10 +875,7 @@ func (h *Handler) CountTableColumnsHandler() http.HandlerFunc {
 			return
 		}
 
-		res = map[string]interface{}{
-			"table":   tableName,
-			"columns": cols,
-		}
+		res = api.ColumnCountData{Table: tableName, Columns: cols}
 		handleSuccessRequest(writer, "", res)
 	}
 }
@@ -503,7 +891,7 @@ func (h *Handler) CountTableRowsHandler() http.HandlerFunc {
 
 		var (
 			err       error
-			res       map[string]interface{}
+			res       api.RowCountData
 			msg       string
 			tableName string
 			rows      int
@@ -523,10 +911,7 @@ func (h *Handler) CountTableRowsHandler() http.HandlerFunc {
 			return
 		}
 
-		res = map[string]interface{}{
-			"table": tableName,
-			"rows":  rows,
-		}
+		res = api.RowCountData{Table: tableName, Rows: rows}
 		handleSuccessRequest(writer, "", res)
 	}
 }
@@ -560,11 +945,19 @@ func (h *Handler) GetColumnData() http.HandlerFunc {
 			handleBadRequest(writer, msg, err)
 			return
 		}
+		flagProtectedColumns(h.client, &cols)
+		cols.LastModified, err = h.client.GetTableLastModified(tableName)
+		if err != nil {
+			log.Println("failed to read when the table was last modified:", err)
+		}
 		handleSuccessRequest(writer, "", cols)
 	}
 }
 
-func (h *Handler) ShowCreateTable() http.HandlerFunc {
+// RefreshTableMetadataHandler reads the columns, keys and foreign keys of one table again, replacing its
+// cached columns, so that a table changed by another client is seen without reconnecting. The schema
+// version changes when the columns do.
+func (h *Handler) RefreshTableMetadataHandler() http.HandlerFunc {
 	return func(writer http.ResponseWriter, request *http.Request) {
 		defer func(Body io.ReadCloser) {
 			err := Body.Close()
@@ -574,22 +967,40 @@ func (h *Handler) ShowCreateTable() http.HandlerFunc {
 		}(request.Body)
 
 		var (
-			err  error
-			data string
-			msg  string
+			err       error
+			data      _client.RefreshedColumnData
+			changed   bool
+			msg       string
+			tableName string
 		)
 
-		data, err = h.client.ShowCreateTable()
+		err = checkURLParams(request.URL, 1)
 		if err != nil {
-			msg = "Failed to get table statement for tables"
 			handleBadRequest(writer, msg, err)
 			return
 		}
-		handleSuccessDownloadRequest(writer, data)
+
+		tableName = request.URL.Query().Get("name")
+		data, changed, err = h.client.RefreshColumnsData(tableName)
+		if err != nil {
+			msg = fmt.Sprintf("Failed to refresh columns data for table %s", tableName)
+			handleBadRequest(writer, msg, err)
+			return
+		}
+		if changed {
+			// only this table's columns are stale, the others stay cached
+			h.schemaVersion.Add(1)
+		}
+		flagProtectedColumns(h.client, &data.ColumnData)
+		data.LastModified, err = h.client.GetTableLastModified(tableName)
+		if err != nil {
+			log.Println("failed to read when the table was last modified:", err)
+		}
+		handleSuccessRequest(writer, "", data)
 	}
 }
 
-func (h *Handler) TableDataHandler() http.HandlerFunc {
+func (h *Handler) ShowCreateTable() http.HandlerFunc {
 	return func(writer http.ResponseWriter, request *http.Request) {
 		defer func(Body io.ReadCloser) {
 			err := Body.Close()
@@ -600,71 +1011,95 @@ func (h *Handler) TableDataHandler() http.HandlerFunc {
 
 		var (
 			err        error
-			tableData  *_client.Table
-			res        map[string]interface{}
+			data       string
 			msg        string
-			tableName  string
-			page       string
-			perPage    string
-			rows       int
-			pageInt    int
-			perPageInt int
-			totalPages float64
+			statements map[string]string
 		)
 
-		err = checkURLParams(request.URL, 3)
-		if err != nil {
-			handleBadRequest(writer, msg, err)
+		if wantsJSON(request) {
+			statements, err = h.client.GetCreateStatements()
+			if err != nil {
+				msg = "Failed to get table statement for tables"
+				handleBadRequest(writer, msg, err)
+				return
+			}
+			handleSuccessRequest(writer, "", statements)
 			return
 		}
 
-		tableName = request.URL.Query().Get("name")
-		page = request.URL.Query().Get("page")
-		perPage = request.URL.Query().Get("perPage")
-		pageInt, err = strconv.Atoi(page)
+		data, err = h.client.ShowCreateTable()
 		if err != nil {
-			msg = fmt.Sprintf("invalid 'page' parameter: %s", page)
+			msg = "Failed to get table statement for tables"
 			handleBadRequest(writer, msg, err)
 			return
 		}
+		handleSuccessDownloadRequest(writer, data)
+	}
+}
 
-		perPageInt, err = strconv.Atoi(perPage)
-		if err != nil {
-			msg = fmt.Sprintf("invalid 'perPage' parameter: %s", perPage)
-			handleBadRequest(writer, msg, err)
+// SchemaExportHandler exports every table of the schema with its columns as a JSON document, or
+// as Go structs with 'target=golang'.
+func (h *Handler) SchemaExportHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		var (
+			err    error
+			msg    string
+			data   []byte
+			doc    *_client.SchemaDocument
+			target = strings.ToLower(request.URL.Query().Get("target"))
+		)
+
+		if target != "" && target != "json" && target != "golang" {
+			msg = "target must be json or golang"
+			handleBadRequest(writer, msg, fmt.Errorf("unknown target: %s", target))
 			return
 		}
 
-		rows, err = h.client.CountTableRows(tableName)
+		doc, err = h.client.GetSchemaDocument()
 		if err != nil {
-			msg = fmt.Sprintf("Failed to count table rows: %s", tableName)
+			msg = "Failed to describe the schema"
 			handleBadRequest(writer, msg, err)
 			return
 		}
-		totalPages = float64(rows) / float64(perPageInt)
-		if totalPages < 1 {
-			totalPages = 1
-		} else {
-			totalPages = math.Round(totalPages)
+
+		if target == "golang" {
+			data, err = doc.GoStructs("models")
+			if err != nil {
+				msg = "Failed to generate Go structs"
+				handleErrorRequest(writer, http.StatusInternalServerError, msg, err)
+				return
+			}
+			handleSuccessFileRequest(writer, fmt.Sprintf("%s.go", doc.Schema), "text/x-go", data)
+			return
 		}
 
-		tableData, err = h.client.GetTable(tableName, pageInt, perPageInt)
+		data, err = json.MarshalIndent(doc, "", "  ")
 		if err != nil {
-			msg = fmt.Sprintf("Failed to get table data: %s", tableName)
-			handleBadRequest(writer, msg, err)
+			msg = "Failed to encode the schema"
+			handleErrorRequest(writer, http.StatusInternalServerError, msg, err)
 			return
 		}
+		handleSuccessFileRequest(writer, fmt.Sprintf("%s.schema.json", doc.Schema), "application/json", data)
+	}
+}
 
-		res = map[string]interface{}{
-			"table":       tableData,
-			"total_rows":  rows,
-			"total_pages": totalPages,
-		}
-		handleSuccessRequest(writer, "", res)
+// wantsJSON reports whether the caller asked for a JSON body rather than a file download,
+// either with the 'format=json' param or an Accept header of application/json.
+func wantsJSON(request *http.Request) bool {
+	if strings.EqualFold(request.URL.Query().Get("format"), "json") {
+		return true
 	}
+	return strings.Contains(request.Header.Get("Accept"), "application/json")
 }
 
-func (h *Handler) TableSizeHandler() http.HandlerFunc {
+func (h *Handler) TableDataHandler() http.HandlerFunc {
 	return func(writer http.ResponseWriter, request *http.Request) {
 		defer func(Body io.ReadCloser) {
 			err := Body.Close()
@@ -674,41 +1109,1227 @@ func (h *Handler) TableSizeHandler() http.HandlerFunc {
 		}(request.Body)
 
 		var (
-			err          error
+			err        error
+			tableData  *_client.Table
+			res        api.TablePage
+			msg        string
+			tableName  string
+			page       string
+			perPage    string
+			rows       int
+			pageInt    int
+			perPageInt int
+			pagination *api.Pagination
+			compact    bool
+			search     string
+			collate    string
+			optional   int
+			tableQuery _client.TableQuery
+		)
+
+		// compact=true returns the rows as value slices, see _client.RowSet
+		if request.URL.Query().Has("compact") {
+			compact, _ = strconv.ParseBool(request.URL.Query().Get("compact"))
+			optional++
+		}
+		// search only returns the rows containing the text, ranked when the table has a full-text index
+		if request.URL.Query().Has("search") {
+			search = request.URL.Query().Get("search")
+			optional++
+		}
+		// collate sorts the text columns with a collation of the server, see _client.TableOrder
+		if request.URL.Query().Has("collate") {
+			collate = request.URL.Query().Get("collate")
+			optional++
+		}
+		// page defaults to the first, and perPage to the defaultPerPage setting of the connection
+		if request.URL.Query().Has("page") {
+			optional++
+		}
+		if request.URL.Query().Has("perPage") || h.client.Settings.DefaultPerPage == 0 {
+			optional++
+		}
+
+		err = checkURLParams(request.URL, 1+optional)
+		if err != nil {
+			handleBadRequest(writer, msg, err)
+			return
+		}
+
+		tableName = request.URL.Query().Get("name")
+		page = request.URL.Query().Get("page")
+		perPage = request.URL.Query().Get("perPage")
+		pageInt = 1
+		if page != "" {
+			pageInt, err = strconv.Atoi(page)
+			if err != nil {
+				msg = fmt.Sprintf("invalid 'page' parameter: %s", page)
+				handleBadRequest(writer, msg, err)
+				return
+			}
+		}
+
+		perPageInt = h.client.Settings.DefaultPerPage
+		if perPage != "" || perPageInt == 0 {
+			perPageInt, err = strconv.Atoi(perPage)
+			if err != nil {
+				msg = fmt.Sprintf("invalid 'perPage' parameter: %s", perPage)
+				handleBadRequest(writer, msg, err)
+				return
+			}
+		}
+
+		// the rows are only encoded, so they are kept column by column
+		tableQuery = _client.TableQuery{Page: pageInt, PerPage: perPageInt, Compact: compact, Columnar: true, Search: search, Collation: collate}
+		if search != "" {
+			tableData, err = h.client.GetTablePageContext(request.Context(), tableName, tableQuery)
+			if err != nil {
+				msg = fmt.Sprintf("Failed to search table: %s", tableName)
+				handleTableError(writer, msg, err)
+				return
+			}
+			rows = tableData.Search.Matches
+		} else {
+			rows, err = h.client.CountTableRowsContext(request.Context(), tableName)
+			if err != nil {
+				msg = fmt.Sprintf("Failed to count table rows: %s", tableName)
+				handleBadRequest(writer, msg, err)
+				return
+			}
+			tableData, err = h.client.GetTablePageContext(request.Context(), tableName, tableQuery)
+			if err != nil {
+				msg = fmt.Sprintf("Failed to get table data: %s", tableName)
+				handleTableError(writer, msg, err)
+				return
+			}
+		}
+		pagination = api.NewPagination(pageInt, perPageInt, rows)
+
+		h.recordOpen(tableName)
+		h.recordUsage(tableName, usageView)
+
+		if h.noLegacyPagination {
+			handlePaginatedRequest(writer, "", api.TableData{Table: tableData}, pagination)
+			return
+		}
+		res = api.TablePage{
+			TableData:  api.TableData{Table: tableData},
+			TotalRows:  rows,
+			TotalPages: float64(pagination.TotalPages),
+		}
+		handlePaginatedRequest(writer, "", res, pagination)
+	}
+}
+
+func (h *Handler) RecentTablesHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		var (
+			err   error
+			prefs config.Preferences
+			res   api.RecentTablesData
+		)
+
+		prefs, err = h.preferences()
+		if err != nil {
+			handleBadRequest(writer, "Failed to read recent tables", err)
+			return
+		}
+
+		res = api.RecentTablesData{Recent: prefs.Recent, Favorites: prefs.Favorites}
+		handleSuccessRequest(writer, "", res)
+	}
+}
+
+func (h *Handler) ToggleFavoriteTableHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		var (
+			err       error
+			res       api.FavoriteData
+			msg       string
+			tableName string
+			favorite  bool
+		)
+
+		err = checkURLParams(request.URL, 1)
+		if err != nil {
+			handleBadRequest(writer, msg, err)
+			return
+		}
+
+		tableName = request.URL.Query().Get("name")
+		if tableName == "" {
+			handleBadRequest(writer, "Table name is missing or empty", nil)
+			return
+		}
+
+		favorite, err = config.ToggleFavorite(h.client.Key(), tableName)
+		if err != nil {
+			msg = fmt.Sprintf("Failed to toggle favorite for table %s", tableName)
+			handleBadRequest(writer, msg, err)
+			return
+		}
+
+		res = api.FavoriteData{Table: tableName, Favorite: favorite}
+		handleSuccessRequest(writer, "", res)
+	}
+}
+
+func (h *Handler) TableSizeHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		var (
+			err          error
 			tableSize    _client.TableSize
-			responseData map[string]interface{}
+			responseData api.TableSizeData
+			tableName    string
+		)
+
+		err = checkURLParams(request.URL, 1)
+		if err != nil {
+			handleBadRequest(writer, "", err)
+			return
+		}
+
+		tableName = request.URL.Query().Get("name")
+		if tableName == "" {
+			handleBadRequest(writer, "Table name is missing or empty", nil)
+			return
+		}
+
+		tableSize, err = h.client.GetTableSize(tableName)
+		if err != nil {
+			handleBadRequest(writer, fmt.Sprintf("Failed to get table size for %s", tableName), err)
+			return
+		}
+
+		responseData = api.TableSizeData{Table: api.NamedTableSize{Name: tableName, Size: tableSize}}
+		handleSuccessRequest(writer, "", responseData)
+	}
+}
+
+func (h *Handler) TableBloatHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		var (
+			err          error
+			bloat        *_client.TableBloat
+			responseData api.TableBloatData
 			tableName    string
 		)
 
-		err = checkURLParams(request.URL, 1)
-		if err != nil {
-			handleBadRequest(writer, "", err)
+		err = checkURLParams(request.URL, 1)
+		if err != nil {
+			handleBadRequest(writer, "", err)
+			return
+		}
+
+		tableName = request.URL.Query().Get("name")
+		if tableName == "" {
+			handleBadRequest(writer, "Table name is missing or empty", nil)
+			return
+		}
+
+		bloat, err = h.client.GetTableBloat(tableName)
+		if err != nil {
+			handleBadRequest(writer, fmt.Sprintf("Failed to get table bloat for %s", tableName), err)
+			return
+		}
+
+		responseData = api.TableBloatData{Result: bloat}
+		handleSuccessRequest(writer, "", responseData)
+	}
+}
+
+func (h *Handler) TableSizesHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		var (
+			err       error
+			tableSize []_client.TableSize
+			res       api.TableSizesData
+		)
+
+		tableSize, err = h.client.GetTablesSize()
+		if err != nil {
+			handleBadRequest(writer, "Failed to get table size", err)
+			return
+		}
+
+		res = api.TableSizesData{TableSize: tableSize}
+		handleSuccessRequest(writer, "", res)
+	}
+}
+
+// UpdateRowRequest is a single cell edit: the new value of ParentColumn on the row
+// whose key column (HeaderValue) holds CellValue. An editedCellValue of null sets the cell
+// to NULL, and "" to an empty string.
+type UpdateRowRequest struct {
+	CellValue       string  `json:"cellValue"`
+	EditedCellValue *string `json:"editedCellValue"`
+	HeaderValue     string  `json:"headerValue"`
+	ParentColumn    string  `json:"parentColumn"`
+	TableName       string  `json:"tableName"`
+	Fingerprint     string  `json:"fingerprint"`
+	SystemOverride
+}
+
+func (r UpdateRowRequest) rowUpdate() query.RowUpdate {
+	return query.RowUpdate{
+		Table:     r.TableName,
+		Column:    r.ParentColumn,
+		Value:     r.EditedCellValue,
+		KeyValue:  r.CellValue,
+		KeyColumn: r.HeaderValue,
+	}
+}
+
+func (h *Handler) UpdateRowHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		if h.rejectReadOnly(writer) {
+			return
+		}
+
+		var (
+			err    error
+			result *query.Result
+			res    api.ResultData
+			msg    string
+			req    UpdateRowRequest
+		)
+
+		err = json.NewDecoder(request.Body).Decode(&req)
+		if err != nil {
+			handleBadRequest(writer, "Invalid JSON", err)
+			return
+		}
+
+		if h.rejectSystemTable(writer, "update", h.client.Schema.Name, req.TableName, req.SystemOverride) {
+			return
+		}
+
+		if h.rejectProtectedColumns(writer, req.TableName, []string{req.ParentColumn}) {
+			return
+		}
+
+		if h.rejectSchemaChanged(writer, req.TableName, req.Fingerprint) {
+			return
+		}
+
+		result, err = query.UpdateRow(
+			req.TableName, req.ParentColumn,
+			req.EditedCellValue, req.CellValue,
+			req.HeaderValue, h.client,
+		)
+
+		if err != nil {
+			msg = "Failed to update row table data"
+			handleBadRequest(writer, msg, err)
+			return
+		}
+		h.recordUsage(req.TableName, usageEdit)
+
+		res = api.ResultData{Result: result}
+		handleSuccessRequest(writer, "", res)
+	}
+}
+
+// UpdateRowBatchHandler applies several cell edits in a single transaction.
+// If any edit fails, none of them is applied.
+func (h *Handler) UpdateRowBatchHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		if h.rejectReadOnly(writer) {
+			return
+		}
+
+		var (
+			err     error
+			results []*query.Result
+			res     api.ResultsData
+			msg     string
+			reqs    []UpdateRowRequest
+			updates []query.RowUpdate
+			checked map[string]bool
+		)
+
+		err = json.NewDecoder(request.Body).Decode(&reqs)
+		if err != nil {
+			handleBadRequest(writer, "Invalid JSON", err)
+			return
+		}
+
+		if len(reqs) == 0 {
+			handleBadRequest(writer, "No updates to apply", nil)
+			return
+		}
+
+		checked = make(map[string]bool)
+		for _, req := range reqs {
+			if h.rejectSystemTable(writer, "update", h.client.Schema.Name, req.TableName, req.SystemOverride) {
+				return
+			}
+			if h.rejectProtectedColumns(writer, req.TableName, []string{req.ParentColumn}) {
+				return
+			}
+			// every edit of a table carries the same fingerprint, so it is checked once per table
+			if !checked[req.TableName] {
+				if h.rejectSchemaChanged(writer, req.TableName, req.Fingerprint) {
+					return
+				}
+				checked[req.TableName] = true
+			}
+			updates = append(updates, req.rowUpdate())
+		}
+
+		results, err = query.UpdateRowBatch(updates, h.client)
+		if err != nil {
+			msg = "Failed to update rows, no changes were applied"
+			handleBadRequest(writer, msg, err)
+			return
+		}
+		for table := range checked {
+			h.recordUsage(table, usageEdit)
+		}
+
+		res = api.ResultsData{Result: results}
+		handleSuccessRequest(writer, "", res)
+	}
+}
+
+// RowEditRequest is the body of the whole-row edit endpoint. The row is identified by KeyColumns
+// and KeyValues; every column in Values is set in a single update.
+type RowEditRequest struct {
+	Table          string                 `json:"table"`
+	KeyColumns     []string               `json:"keyColumns"`
+	KeyValues      []interface{}          `json:"keyValues"`
+	Values         map[string]interface{} `json:"values"`
+	ReturnRow      bool                   `json:"returnRow"`
+	AllowKeyChange bool                   `json:"allowKeyChange"`
+	Fingerprint    string                 `json:"fingerprint"`
+	SystemOverride
+}
+
+func (h *Handler) RowEditHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		if h.rejectReadOnly(writer) {
+			return
+		}
+
+		var (
+			err    error
+			result *query.RowEditResult
+			res    api.RowEditData
+			msg    string
+			req    RowEditRequest
+		)
+
+		err = json.NewDecoder(request.Body).Decode(&req)
+		if err != nil {
+			handleBadRequest(writer, "Invalid JSON", err)
+			return
+		}
+
+		if req.Table == "" {
+			handleBadRequest(writer, "Table name is missing or empty", nil)
+			return
+		}
+
+		if len(req.Values) == 0 {
+			handleBadRequest(writer, "No values to update", nil)
+			return
+		}
+
+		if h.rejectSystemTable(writer, "update", h.client.Schema.Name, req.Table, req.SystemOverride) {
+			return
+		}
+
+		if h.rejectProtectedColumns(writer, req.Table, mapKeys(req.Values)) {
+			return
+		}
+
+		if h.rejectSchemaChanged(writer, req.Table, req.Fingerprint) {
+			return
+		}
+
+		result, err = query.UpdateWholeRow(query.RowEdit{
+			Table:          req.Table,
+			KeyColumns:     req.KeyColumns,
+			KeyValues:      req.KeyValues,
+			Values:         req.Values,
+			AllowKeyChange: req.AllowKeyChange,
+		}, h.client)
+		if err != nil {
+			msg = fmt.Sprintf("Failed to update row of table %s", req.Table)
+			handleBadRequest(writer, msg, err)
+			return
+		}
+		h.recordUsage(req.Table, usageEdit)
+
+		if !req.ReturnRow {
+			result.Row = nil
+		}
+
+		res = api.RowEditData{Result: result}
+		handleSuccessRequest(writer, "", res)
+	}
+}
+
+// RowInsertRequest is the body of the row insert endpoint: the values of the columns of the new row,
+// the others taking their default.
+type RowInsertRequest struct {
+	Table  string                 `json:"table"`
+	Values map[string]interface{} `json:"values"`
+	SystemOverride
+}
+
+// RowInsertHandler inserts a row and returns its primary key, when known, in the inserted_key of the result.
+func (h *Handler) RowInsertHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		if h.rejectReadOnly(writer) {
+			return
+		}
+
+		var (
+			err    error
+			result *query.Result
+			res    api.ResultData
+			msg    string
+			req    RowInsertRequest
+		)
+
+		err = json.NewDecoder(request.Body).Decode(&req)
+		if err != nil {
+			handleBadRequest(writer, "Invalid JSON", err)
+			return
+		}
+
+		if req.Table == "" {
+			handleBadRequest(writer, "Table name is missing or empty", nil)
+			return
+		}
+
+		if h.rejectSystemTable(writer, "insert", h.client.Schema.Name, req.Table, req.SystemOverride) {
+			return
+		}
+
+		result, err = query.InsertRow(req.Table, req.Values, h.client)
+		if err != nil {
+			msg = fmt.Sprintf("Failed to insert row into table %s", req.Table)
+			handleBadRequest(writer, msg, err)
+			return
+		}
+		h.recordUsage(req.Table, usageEdit)
+
+		res = api.ResultData{Result: result}
+		handleSuccessRequest(writer, "", res)
+	}
+}
+
+// ErrCodeDependenciesFound is the response code sent when a column rename is refused
+// because other objects depend on the column.
+const ErrCodeDependenciesFound = "dependencies_found"
+
+// ColumnImpact lists what depends on a column: database objects, and the saved queries of the
+// connection that mention it.
+type ColumnImpact struct {
+	_client.ColumnDependencies
+	SavedQueries []config.SavedQuery `json:"saved_queries"`
+}
+
+// empty reports whether nothing depends on the column.
+func (i *ColumnImpact) empty() bool {
+	return len(i.Views) == 0 && len(i.ForeignKeys) == 0 && len(i.SavedQueries) == 0
+}
+
+// ColumnImpactData is the data of a /table/column/dependencies response, and of a column rename refused for
+// the dependencies it found.
+type ColumnImpactData struct {
+	Result *ColumnImpact `json:"result"`
+}
+
+// RenameColumnData is the data of a column rename: its result, and what depended on the column.
+type RenameColumnData struct {
+	Result       *query.Result `json:"result"`
+	Dependencies *ColumnImpact `json:"dependencies"`
+}
+
+// columnImpact scans the database and the saved queries for dependencies on the column.
+func (h *Handler) columnImpact(table, column string) (*ColumnImpact, error) {
+	deps, err := h.client.GetColumnDependencies(table, column)
+	if err != nil {
+		return nil, err
+	}
+
+	saved, err := config.GetSavedQueries(h.client.Key())
+	if err != nil {
+		return nil, err
+	}
+
+	impact := &ColumnImpact{ColumnDependencies: *deps, SavedQueries: make([]config.SavedQuery, 0)}
+	for _, q := range saved {
+		if _client.MentionsIdentifier(q.Query, table) && _client.MentionsIdentifier(q.Query, column) {
+			impact.SavedQueries = append(impact.SavedQueries, q)
+		}
+	}
+	return impact, nil
+}
+
+func (h *Handler) ColumnDependenciesHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		var (
+			err       error
+			impact    *ColumnImpact
+			res       ColumnImpactData
+			msg       string
+			tableName string
+			column    string
+		)
+
+		err = checkURLParams(request.URL, 2)
+		if err != nil {
+			handleBadRequest(writer, msg, err)
+			return
+		}
+
+		tableName = request.URL.Query().Get("table")
+		column = request.URL.Query().Get("column")
+		if tableName == "" || column == "" {
+			handleBadRequest(writer, "Table or column name is missing or empty", nil)
+			return
+		}
+
+		impact, err = h.columnImpact(tableName, column)
+		if err != nil {
+			msg = fmt.Sprintf("Failed to find dependencies of column %s.%s", tableName, column)
+			handleBadRequest(writer, msg, err)
+			return
+		}
+
+		res = ColumnImpactData{Result: impact}
+		handleSuccessRequest(writer, "", res)
+	}
+}
+
+// ViewsHandler lists the views of the schema with their definitions.
+func (h *Handler) ViewsHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		var (
+			err   error
+			views []_client.View
+			res   api.ViewsData
+			msg   string
+		)
+
+		views, err = h.client.GetViews()
+		if err != nil {
+			msg = fmt.Sprintf("Failed to get the views of %s", h.client.Schema.Name)
+			handleBadRequest(writer, msg, err)
+			return
+		}
+
+		res = api.ViewsData{Result: views}
+		handleSuccessRequest(writer, "", res)
+	}
+}
+
+// RoutinesHandler lists the stored procedures and functions of the schema with their definitions.
+func (h *Handler) RoutinesHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		var (
+			err      error
+			routines []_client.Routine
+			res      api.RoutinesData
+			msg      string
+		)
+
+		routines, err = h.client.GetRoutines()
+		if err != nil {
+			msg = fmt.Sprintf("Failed to get the routines of %s", h.client.Schema.Name)
+			handleBadRequest(writer, msg, err)
+			return
+		}
+
+		res = api.RoutinesData{Result: routines}
+		handleSuccessRequest(writer, "", res)
+	}
+}
+
+// LockWaitsHandler lists the sessions waiting for a lock, each paired with a session blocking it.
+func (h *Handler) LockWaitsHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		var (
+			err   error
+			waits []_client.LockWait
+		)
+
+		waits, err = h.client.GetLockWaits()
+		if err != nil {
+			handleBadRequest(writer, "Failed to get the lock waits of the server", err)
+			return
+		}
+		handleSuccessRequest(writer, "", api.LockWaitsData{Result: waits})
+	}
+}
+
+// ReferencedByHandler lists the foreign keys of other tables referencing a table.
+func (h *Handler) ReferencedByHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		var (
+			err       error
+			refs      []_client.ReferencingTable
+			res       api.ReferencesData
+			msg       string
+			tableName string
+		)
+
+		err = checkURLParams(request.URL, 1)
+		if err != nil {
+			handleBadRequest(writer, msg, err)
+			return
+		}
+
+		tableName = request.URL.Query().Get("name")
+		if tableName == "" {
+			handleBadRequest(writer, "Table name is missing or empty", nil)
+			return
+		}
+
+		refs, err = h.client.GetReferencingTables(tableName)
+		if err != nil {
+			msg = fmt.Sprintf("Failed to find the tables referencing %s", tableName)
+			handleBadRequest(writer, msg, err)
+			return
+		}
+
+		res = api.ReferencesData{Result: refs}
+		handleSuccessRequest(writer, "", res)
+	}
+}
+
+// RenameColumnRequest is the body of the column rename endpoint. The rename is refused when
+// something depends on the column, unless AcknowledgeDependencies is set.
+type RenameColumnRequest struct {
+	TableName               string `json:"tableName"`
+	Column                  string `json:"column"`
+	NewName                 string `json:"newName"`
+	AcknowledgeDependencies bool   `json:"acknowledgeDependencies"`
+	SystemOverride
+}
+
+func (h *Handler) RenameColumnHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		if h.rejectReadOnly(writer) {
+			return
+		}
+
+		var (
+			err    error
+			result *query.Result
+			impact *ColumnImpact
+			res    RenameColumnData
+			msg    string
+			req    RenameColumnRequest
+		)
+
+		err = json.NewDecoder(request.Body).Decode(&req)
+		if err != nil {
+			handleBadRequest(writer, "Invalid JSON", err)
+			return
+		}
+
+		if req.TableName == "" || req.Column == "" || req.NewName == "" {
+			handleBadRequest(writer, "Table, column or new column name is missing or empty", nil)
+			return
+		}
+
+		if h.rejectSystemTable(writer, "rename", h.client.Schema.Name, req.TableName, req.SystemOverride) {
+			return
+		}
+
+		impact, err = h.columnImpact(req.TableName, req.Column)
+		if err != nil {
+			msg = fmt.Sprintf("Failed to find dependencies of column %s.%s", req.TableName, req.Column)
+			handleBadRequest(writer, msg, err)
+			return
+		}
+
+		if !impact.empty() && !req.AcknowledgeDependencies {
+			writer.Header().Set("Content-Type", "application/json")
+			jsonResponse(writer, http.StatusConflict, Response{
+				Message: "Other objects depend on this column, acknowledge them to rename it",
+				Code:    ErrCodeDependenciesFound,
+				Data:    ColumnImpactData{Result: impact},
+			})
+			return
+		}
+
+		result, err = query.RenameColumn(req.TableName, req.Column, req.NewName, h.client)
+		if err != nil {
+			msg = fmt.Sprintf("Failed to rename column %s.%s", req.TableName, req.Column)
+			handleBadRequest(writer, msg, err)
+			return
+		}
+		h.schemaChanged()
+
+		res = RenameColumnData{Result: result, Dependencies: impact}
+		handleSuccessRequest(writer, "", res)
+	}
+}
+
+// CommentRequest is the body of the table and column comment endpoints.
+type CommentRequest struct {
+	TableName  string `json:"tableName"`
+	ColumnName string `json:"columnName"`
+	Comment    string `json:"comment"`
+	SystemOverride
+}
+
+func (h *Handler) TableCommentHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		if h.rejectReadOnly(writer) {
+			return
+		}
+
+		var (
+			err    error
+			result *query.Result
+			res    api.ResultData
+			msg    string
+			req    CommentRequest
+		)
+
+		err = json.NewDecoder(request.Body).Decode(&req)
+		if err != nil {
+			handleBadRequest(writer, "Invalid JSON", err)
+			return
+		}
+
+		if req.TableName == "" {
+			handleBadRequest(writer, "Table name is missing or empty", nil)
+			return
+		}
+
+		if h.rejectSystemTable(writer, "comment", h.client.Schema.Name, req.TableName, req.SystemOverride) {
+			return
+		}
+
+		result, err = query.SetTableComment(req.TableName, req.Comment, h.client)
+		if err != nil {
+			msg = fmt.Sprintf("Failed to set comment on table %s", req.TableName)
+			handleBadRequest(writer, msg, err)
+			return
+		}
+		h.schemaChanged()
+
+		res = api.ResultData{Result: result}
+		handleSuccessRequest(writer, "", res)
+	}
+}
+
+func (h *Handler) ColumnCommentHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		if h.rejectReadOnly(writer) {
+			return
+		}
+
+		var (
+			err    error
+			result *query.Result
+			res    api.ResultData
+			msg    string
+			req    CommentRequest
+		)
+
+		err = json.NewDecoder(request.Body).Decode(&req)
+		if err != nil {
+			handleBadRequest(writer, "Invalid JSON", err)
+			return
+		}
+
+		if req.TableName == "" || req.ColumnName == "" {
+			handleBadRequest(writer, "Table or column name is missing or empty", nil)
+			return
+		}
+
+		if h.rejectSystemTable(writer, "comment", h.client.Schema.Name, req.TableName, req.SystemOverride) {
+			return
+		}
+
+		result, err = query.SetColumnComment(req.TableName, req.ColumnName, req.Comment, h.client)
+		if err != nil {
+			msg = fmt.Sprintf("Failed to set comment on column %s.%s", req.TableName, req.ColumnName)
+			handleBadRequest(writer, msg, err)
+			return
+		}
+		h.schemaChanged()
+
+		res = api.ResultData{Result: result}
+		handleSuccessRequest(writer, "", res)
+	}
+}
+
+// FilterRequest is the body of the bulk row endpoints: the table and the filter selecting its rows.
+type FilterRequest struct {
+	TableName string         `json:"tableName"`
+	Filter    _client.Filter `json:"filter"`
+	SystemOverride
+}
+
+func (h *Handler) DeleteRowsHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		if h.rejectReadOnly(writer) {
+			return
+		}
+
+		var (
+			err    error
+			result *query.Result
+			res    api.ResultData
+			msg    string
+			req    FilterRequest
+		)
+
+		err = json.NewDecoder(request.Body).Decode(&req)
+		if err != nil {
+			handleBadRequest(writer, "Invalid JSON", err)
+			return
+		}
+
+		if req.TableName == "" {
+			handleBadRequest(writer, "Table name is missing or empty", nil)
+			return
+		}
+
+		if h.rejectSystemTable(writer, "delete", h.client.Schema.Name, req.TableName, req.SystemOverride) {
+			return
+		}
+		if h.rejectDestructive(writer, "delete", h.client.Schema.Name, req.TableName, req.SystemOverride) {
+			return
+		}
+
+		result, err = query.DeleteWhere(req.TableName, req.Filter, h.client)
+		if err != nil {
+			msg = fmt.Sprintf("Failed to delete rows from table %s", req.TableName)
+			handleBadRequest(writer, msg, err)
+			return
+		}
+		h.recordUsage(req.TableName, usageEdit)
+
+		res = api.ResultData{Result: result}
+		handleSuccessRequest(writer, "", res)
+	}
+}
+
+// UpdateRowsRequest is the body of the bulk update endpoint. ConfirmAll must be set to update every row
+// of the table when no filter is given.
+type UpdateRowsRequest struct {
+	FilterRequest
+	Set         map[string]interface{} `json:"set"`
+	ConfirmAll  bool                   `json:"confirmAll"`
+	Fingerprint string                 `json:"fingerprint"`
+}
+
+func (h *Handler) UpdateRowsHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		if h.rejectReadOnly(writer) {
+			return
+		}
+
+		var (
+			err    error
+			result *query.Result
+			res    api.ResultData
+			msg    string
+			req    UpdateRowsRequest
+		)
+
+		err = json.NewDecoder(request.Body).Decode(&req)
+		if err != nil {
+			handleBadRequest(writer, "Invalid JSON", err)
+			return
+		}
+
+		if req.TableName == "" {
+			handleBadRequest(writer, "Table name is missing or empty", nil)
+			return
+		}
+
+		if h.rejectSystemTable(writer, "update", h.client.Schema.Name, req.TableName, req.SystemOverride) {
+			return
+		}
+		if h.rejectDestructive(writer, "update", h.client.Schema.Name, req.TableName, req.SystemOverride) {
+			return
+		}
+
+		if h.rejectProtectedColumns(writer, req.TableName, mapKeys(req.Set)) {
+			return
+		}
+
+		if h.rejectSchemaChanged(writer, req.TableName, req.Fingerprint) {
+			return
+		}
+
+		if len(req.Filter) == 0 && req.ConfirmAll {
+			result, err = query.UpdateAll(req.TableName, req.Set, h.client)
+		} else {
+			result, err = query.UpdateWhere(req.TableName, req.Set, req.Filter, h.client)
+		}
+		if err != nil {
+			msg = fmt.Sprintf("Failed to update rows of table %s", req.TableName)
+			handleBadRequest(writer, msg, err)
+			return
+		}
+		h.recordUsage(req.TableName, usageEdit)
+
+		res = api.ResultData{Result: result}
+		handleSuccessRequest(writer, "", res)
+	}
+}
+
+func (h *Handler) QueryHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		var (
+			err    error
+			req    QueryRequest
+			q      *query.Query
+			result *query.Result
+			res    api.ResultData
+			msg    string
+		)
+
+		if err = json.NewDecoder(request.Body).Decode(&req); err != nil {
+			msg = fmt.Sprintf("invalid query: %s", req.SQLQuery)
+			handleBadRequest(writer, msg, err)
+			return
+		}
+
+		q = &req.Query
+		if err = h.guardQuery(q); err != nil {
+			handleErrorRequest(writer, http.StatusForbidden, "Query not allowed", err)
+			return
+		}
+
+		if h.rejectSystemQuery(writer, q.SQLQuery, req.SystemOverride) {
+			return
+		}
+		if h.rejectDestructiveQuery(writer, q.SQLQuery, req.SystemOverride) {
+			return
+		}
+		// the checks above run again when the statement comes back with its token
+		if h.holdForConfirmation(request.Context(), writer, q, req.ExecutionToken) {
+			return
+		}
+
+		result, err = h.executeQuery(request.Context(), q)
+		if err != nil {
+			h.handleRunError(writer, request, "Failed to execute query", sharedRun{SQL: q.SQLQuery, TimeoutMs: q.TimeoutMs}, err)
+			return
+		}
+
+		res = api.ResultData{Result: result}
+		if shareable(request) {
+			res.Reproduction = h.reproduction(request, sharedRun{SQL: q.SQLQuery, TimeoutMs: q.TimeoutMs}, result)
+		}
+		handleSuccessRequest(writer, "", res)
+	}
+}
+
+// ScriptHandler runs a script of several statements at once. It is checked like a single query:
+// in read-only mode every statement must be read-only, and writes to system schemas need confirmation.
+func (h *Handler) ScriptHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		var (
+			err    error
+			req    QueryRequest
+			q      *query.Query
+			result *query.Result
+			res    api.ResultData
+		)
+
+		if err = json.NewDecoder(request.Body).Decode(&req); err != nil {
+			handleBadRequest(writer, "Invalid JSON", err)
 			return
 		}
 
-		tableName = request.URL.Query().Get("name")
-		if tableName == "" {
-			handleBadRequest(writer, "Table name is missing or empty", nil)
+		q = &req.Query
+		if err = h.guardQuery(q); err != nil {
+			handleErrorRequest(writer, http.StatusForbidden, "Script not allowed", err)
 			return
 		}
 
-		tableSize, err = h.client.GetTableSize(tableName)
-		if err != nil {
-			handleBadRequest(writer, fmt.Sprintf("Failed to get table size for %s", tableName), err)
+		if h.rejectSystemQuery(writer, q.SQLQuery, req.SystemOverride) {
+			return
+		}
+		if h.rejectDestructiveQuery(writer, q.SQLQuery, req.SystemOverride) {
+			return
+		}
+		// a script cannot be explained as a whole, so safe mode keeps it from running
+		if h.session.inSafeMode() {
+			handleErrorRequest(writer, http.StatusForbidden, "Script not allowed", util.ErrScriptInSafeMode)
 			return
 		}
 
-		responseData = map[string]interface{}{
-			"table": map[string]interface{}{
-				"name": tableName,
-				"size": tableSize,
-			},
+		result, err = query.ExecuteScript(q.SQLQuery, h.client, h.multiStatements)
+		h.schemaChangedBy(q.SQLQuery)
+		if err != nil {
+			if errors.Is(err, util.ErrMultiStatements) {
+				handleErrorRequest(writer, http.StatusForbidden, "Script not allowed", err)
+				return
+			}
+			handleBadRequest(writer, "Failed to execute script", err)
+			return
 		}
-		handleSuccessRequest(writer, "", responseData)
+
+		res = api.ResultData{Result: result}
+		handleSuccessRequest(writer, "", res)
 	}
 }
 
-func (h *Handler) TableSizesHandler() http.HandlerFunc {
+// FormatHandler pretty-prints a query without running it, so it works without a connection.
+func (h *Handler) FormatHandler() http.HandlerFunc {
 	return func(writer http.ResponseWriter, request *http.Request) {
 		defer func(Body io.ReadCloser) {
 			err := Body.Close()
@@ -718,23 +2339,27 @@ func (h *Handler) TableSizesHandler() http.HandlerFunc {
 		}(request.Body)
 
 		var (
-			err       error
-			tableSize []_client.TableSize
-			res       map[string]interface{}
+			err error
+			q   query.Query
 		)
 
-		tableSize, err = h.client.GetTablesSize()
+		err = json.NewDecoder(request.Body).Decode(&q)
 		if err != nil {
-			handleBadRequest(writer, "Failed to get table size", err)
+			handleBadRequest(writer, "Invalid JSON", err)
+			return
+		}
+		if strings.TrimSpace(q.SQLQuery) == "" {
+			handleBadRequest(writer, "Query is missing or empty", nil)
 			return
 		}
 
-		res = map[string]interface{}{"table_size": tableSize}
-		handleSuccessRequest(writer, "", res)
+		handleSuccessRequest(writer, "", api.FormatData{Query: query.FormatQuery(h.client.Type.String(), q.SQLQuery)})
 	}
 }
 
-func (h *Handler) UpdateRowHandler() http.HandlerFunc {
+// ValidateHandler checks a query against the database without running it. An invalid query is
+// a successful response whose data says where the error is.
+func (h *Handler) ValidateHandler() http.HandlerFunc {
 	return func(writer http.ResponseWriter, request *http.Request) {
 		defer func(Body io.ReadCloser) {
 			err := Body.Close()
@@ -743,46 +2368,123 @@ func (h *Handler) UpdateRowHandler() http.HandlerFunc {
 			}
 		}(request.Body)
 
-		type JsonRequest struct {
-			CellValue       string `json:"cellValue"`
-			EditedCellValue string `json:"editedCellValue"`
-			HeaderValue     string `json:"headerValue"`
-			ParentColumn    string `json:"parentColumn"`
-			TableName       string `json:"tableName"`
-		}
-
 		var (
-			err    error
-			result *query.Result
-			res    map[string]interface{}
-			msg    string
-			req    JsonRequest
+			err        error
+			q          query.Query
+			validation *query.Validation
 		)
 
-		err = json.NewDecoder(request.Body).Decode(&req)
+		err = json.NewDecoder(request.Body).Decode(&q)
 		if err != nil {
 			handleBadRequest(writer, "Invalid JSON", err)
 			return
 		}
+		if strings.TrimSpace(q.SQLQuery) == "" {
+			handleBadRequest(writer, "Query is missing or empty", nil)
+			return
+		}
 
-		result, err = query.UpdateRow(
-			req.TableName, req.ParentColumn,
-			req.EditedCellValue, req.CellValue,
-			req.HeaderValue, h.client,
-		)
+		// preparing a statement can run it on PostgreSQL, e.g. a second one, so it is guarded like running it
+		if err = h.guardQuery(&q); err != nil {
+			handleErrorRequest(writer, http.StatusForbidden, "Query not allowed", err)
+			return
+		}
 
+		validation, err = query.ValidateQuery(q.SQLQuery, h.client)
 		if err != nil {
-			msg = "Failed to update row table data"
-			handleBadRequest(writer, msg, err)
+			if errors.Is(err, util.ErrNotPreparable) || errors.Is(err, util.ErrSingleStatement) {
+				handleBadRequest(writer, "Query cannot be validated", err)
+				return
+			}
+			handleBadRequest(writer, "Failed to validate query", err)
+			return
+		}
+
+		handleSuccessRequest(writer, "", validation)
+	}
+}
+
+// guardQuery checks that the query may run under the handler's current policy:
+// in read-only mode, only statements that do not modify anything are allowed.
+func (h *Handler) guardQuery(q *query.Query) error {
+	if h.readOnly && !query.IsReadOnlyStatement(h.client.Type.String(), q.SQLQuery) {
+		return util.ErrReadOnly
+	}
+	return nil
+}
+
+// executeQuery runs the query, traced as a child of the span of ctx, and records it in the query history.
+// A query with bound arguments is not recorded: it could not be run again from the history without them.
+func (h *Handler) executeQuery(ctx context.Context, q *query.Query) (*query.Result, error) {
+	// the result is only encoded, so its rows are kept column by column
+	q.Columnar = true
+	result, err := query.ExecuteQueryContext(ctx, q, h.client)
+	h.schemaChangedBy(q.SQLQuery)
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return nil, fmt.Errorf("unsupported database type: %s", h.client.Type.String())
+	}
+	if len(q.Args) > 0 {
+		return result, nil
+	}
+
+	_, err = config.AppendQueryHistory(config.QueryHistoryEntry{
+		Connection:   h.client.Key(),
+		Query:        q.SQLQuery,
+		AffectedRows: result.AffectedRows,
+		Time:         result.Time,
+	})
+	if err != nil {
+		log.Println("failed to record query history:", err)
+	}
+	return result, nil
+}
+
+func (h *Handler) QueryHistoryHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		page, perPage, paginated, err := pageParams(request.URL.Query())
+		if err != nil {
+			handleBadRequest(writer, "Invalid pagination parameters", err)
+			return
+		}
+
+		history, err := config.GetQueryHistory(h.client.Key())
+		if err != nil {
+			handleBadRequest(writer, "Failed to read query history", err)
 			return
 		}
 
-		res = map[string]interface{}{"result": result}
+		// queries naming tables renamed since they ran come with a suggested rewrite, which
+		// POST /queries/history/fix saves
+		var pagination *api.Pagination
+		if paginated {
+			history, pagination = paginate(history, page, perPage)
+		}
+		suggestions, err := h.querySuggestions(history, false)
+		if err != nil {
+			log.Println("failed to check the query history for renamed tables:", err)
+			suggestions = make([]*RenameSuggestion, 0)
+		}
+
+		res := HistoryData{History: history, Renamed: suggestions}
+		if paginated {
+			handlePaginatedRequest(writer, "", res, pagination)
+			return
+		}
 		handleSuccessRequest(writer, "", res)
 	}
 }
 
-func (h *Handler) QueryHandler() http.HandlerFunc {
+func (h *Handler) RerunQueryHandler() http.HandlerFunc {
 	return func(writer http.ResponseWriter, request *http.Request) {
 		defer func(Body io.ReadCloser) {
 			err := Body.Close()
@@ -792,26 +2494,91 @@ func (h *Handler) QueryHandler() http.HandlerFunc {
 		}(request.Body)
 
 		var (
-			err    error
-			q      *query.Query
-			result *query.Result
-			res    map[string]interface{}
-			msg    string
+			err      error
+			id       string
+			msg      string
+			previous config.QueryHistoryEntry
+			q        *query.Query
+			result   *query.Result
+			res      api.RerunData
+			override SystemOverride
+			extra    int
+			fix      bool
+			token    string
+			renamed  []*RenameSuggestion
 		)
 
-		if err = json.NewDecoder(request.Body).Decode(&q); err != nil {
-			msg = fmt.Sprintf("invalid query: %s", q)
+		override, extra = systemOverrideFromURL(request.URL)
+		if request.URL.Query().Has("autoFix") {
+			fix = autoFix(request.URL.Query())
+			extra++
+		}
+		if request.URL.Query().Has("executionToken") {
+			token = request.URL.Query().Get("executionToken")
+			extra++
+		}
+		err = checkURLParams(request.URL, 1+extra)
+		if err != nil {
 			handleBadRequest(writer, msg, err)
 			return
 		}
 
-		result, err = query.ExecuteQuery(q, h.client)
+		id = request.URL.Query().Get("id")
+		previous, err = config.FindQueryHistory(id)
+		if err != nil {
+			handleErrorRequest(writer, http.StatusNotFound, "Failed to find query", err)
+			return
+		}
+
+		if previous.Connection != h.client.Key() {
+			msg = "Query was run against another connection"
+			handleBadRequest(writer, msg, fmt.Errorf("history entry %s belongs to %s", id, previous.Connection))
+			return
+		}
+
+		entries := []config.QueryHistoryEntry{previous}
+		renamed, err = h.querySuggestions(entries, fix)
+		if err != nil {
+			handleBadRequest(writer, "Failed to check the query for renamed tables", err)
+			return
+		}
+		if len(renamed) > 0 && !fix {
+			handleTableRenamed(writer, "The query names tables renamed since it ran, rerun it with autoFix to use their new names", renamed[0])
+			return
+		}
+
+		// the policy is checked again: the query may have been allowed when it first ran
+		q = &query.Query{SQLQuery: entries[0].Query}
+		if err = h.guardQuery(q); err != nil {
+			handleErrorRequest(writer, http.StatusForbidden, "Query not allowed", err)
+			return
+		}
+
+		if h.rejectSystemQuery(writer, q.SQLQuery, override) {
+			return
+		}
+		if h.rejectDestructiveQuery(writer, q.SQLQuery, override) {
+			return
+		}
+		if h.holdForConfirmation(request.Context(), writer, q, token) {
+			return
+		}
+
+		result, err = h.executeQuery(request.Context(), q)
 		if err != nil {
 			handleBadRequest(writer, "Failed to execute query", err)
 			return
 		}
 
-		res = map[string]interface{}{"result": result}
+		res = api.RerunData{
+			Result: result,
+			Previous: api.PreviousRun{
+				ID:           previous.ID,
+				AffectedRows: previous.AffectedRows,
+				Time:         previous.Time,
+				ExecutedAt:   previous.ExecutedAt,
+			},
+		}
 		handleSuccessRequest(writer, "", res)
 	}
 }
@@ -828,26 +2595,37 @@ func (h *Handler) DropTableHandler() http.HandlerFunc {
 		var (
 			err       error
 			result    *query.Result
-			res       map[string]interface{}
+			res       api.ResultData
 			tableName string
 			msg       string
+			override  SystemOverride
+			extra     int
 		)
 
-		err = checkURLParams(request.URL, 1)
+		override, extra = systemOverrideFromURL(request.URL)
+		err = checkURLParams(request.URL, 1+extra)
 		if err != nil {
 			handleBadRequest(writer, msg, err)
 			return
 		}
 
 		tableName = request.URL.Query().Get("name")
+		if h.rejectSystemTable(writer, "drop", h.client.Schema.Name, tableName, override) {
+			return
+		}
+		if h.rejectDestructive(writer, "drop", h.client.Schema.Name, tableName, override) {
+			return
+		}
+
 		result, err = query.DropTable(tableName, h.client.Schema.Name, h.client.Database)
 		if err != nil {
 			msg = fmt.Sprintf("Failed to drop table: %s", tableName)
 			handleBadRequest(writer, msg, err)
 			return
 		}
+		h.schemaChanged()
 
-		res = map[string]interface{}{"result": result}
+		res = api.ResultData{Result: result}
 		handleSuccessRequest(writer, "", res)
 	}
 }
@@ -864,18 +2642,40 @@ func (h *Handler) TruncateTableHandler() http.HandlerFunc {
 		var (
 			err       error
 			result    *query.Result
-			res       map[string]interface{}
+			res       api.ResultData
 			tableName string
 			msg       string
+			override  SystemOverride
+			extra     int
+			isView    bool
 		)
 
-		err = checkURLParams(request.URL, 1)
+		override, extra = systemOverrideFromURL(request.URL)
+		err = checkURLParams(request.URL, 1+extra)
 		if err != nil {
 			handleBadRequest(writer, msg, err)
 			return
 		}
 
 		tableName = request.URL.Query().Get("name")
+		if h.rejectSystemTable(writer, "truncate", h.client.Schema.Name, tableName, override) {
+			return
+		}
+		if h.rejectDestructive(writer, "truncate", h.client.Schema.Name, tableName, override) {
+			return
+		}
+		isView, err = h.client.IsView(tableName)
+		if err != nil {
+			msg = fmt.Sprintf("Failed to truncate table: %s", tableName)
+			handleBadRequest(writer, msg, err)
+			return
+		}
+		if isView {
+			msg = fmt.Sprintf("Failed to truncate table: %s", tableName)
+			handleBadRequest(writer, msg, fmt.Errorf("%s: %w", tableName, util.ErrView))
+			return
+		}
+
 		result, err = query.TruncateTable(tableName, h.client.Schema.Name, h.client.Database)
 		if err != nil {
 			msg = fmt.Sprintf("Failed to truncate table: %s", tableName)
@@ -883,7 +2683,7 @@ func (h *Handler) TruncateTableHandler() http.HandlerFunc {
 			return
 		}
 
-		res = map[string]interface{}{"result": result}
+		res = api.ResultData{Result: result}
 		handleSuccessRequest(writer, "", res)
 	}
 }
@@ -898,14 +2698,17 @@ func (h *Handler) DropDatabaseHandler() http.HandlerFunc {
 		}(request.Body)
 
 		var (
-			err    error
-			result *query.Result
-			res    map[string]interface{}
-			dbName string
-			msg    string
+			err      error
+			result   *query.Result
+			res      api.ResultData
+			dbName   string
+			msg      string
+			override SystemOverride
+			extra    int
 		)
 
-		err = checkURLParams(request.URL, 1)
+		override, extra = systemOverrideFromURL(request.URL)
+		err = checkURLParams(request.URL, 1+extra)
 		if err != nil {
 			handleBadRequest(writer, msg, err)
 
@@ -913,14 +2716,22 @@ func (h *Handler) DropDatabaseHandler() http.HandlerFunc {
 		}
 
 		dbName = request.URL.Query().Get("name")
-		result, err = query.DropDatabase(dbName, h.client.Database)
+		if h.rejectSystemTable(writer, "drop", dbName, "", override) {
+			return
+		}
+		if h.rejectDestructive(writer, "drop", dbName, "", override) {
+			return
+		}
+
+		result, err = query.DropDatabase(dbName, h.client)
 		if err != nil {
 			msg = fmt.Sprintf("Failed to drop database: %s", dbName)
 			handleBadRequest(writer, msg, err)
 			return
 		}
+		h.schemaChanged()
 
-		res = map[string]interface{}{"result": result}
+		res = api.ResultData{Result: result}
 		handleSuccessRequest(writer, "", res)
 	}
 }
@@ -935,28 +2746,66 @@ func (h *Handler) CreateDatabaseHandler() http.HandlerFunc {
 		}(request.Body)
 
 		var (
-			err    error
-			result *query.Result
-			res    map[string]interface{}
-			dbName string
-			msg    string
+			err     error
+			result  *query.Result
+			res     api.ResultData
+			dbName  string
+			msg     string
+			options query.DatabaseOptions
+			extra   int
 		)
 
-		err = checkURLParams(request.URL, 1)
+		// charset and collation are optional
+		options.Charset = request.URL.Query().Get("charset")
+		options.Collation = request.URL.Query().Get("collation")
+		for _, key := range []string{"charset", "collation"} {
+			if request.URL.Query().Has(key) {
+				extra++
+			}
+		}
+		err = checkURLParams(request.URL, 1+extra)
 		if err != nil {
 			handleBadRequest(writer, msg, err)
 			return
 		}
 
 		dbName = request.URL.Query().Get("name")
-		result, err = query.CreateDatabase(dbName, h.client.Database)
+		result, err = query.CreateDatabase(dbName, h.client, options)
 		if err != nil {
 			msg = fmt.Sprintf("Failed to create database: %s", dbName)
 			handleBadRequest(writer, msg, err)
 			return
 		}
+		h.schemaChanged()
+
+		res = api.ResultData{Result: result}
+		handleSuccessRequest(writer, "", res)
+	}
+}
+
+// CharsetsHandler lists the charsets and collations databases and tables can be created with.
+func (h *Handler) CharsetsHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		var (
+			err      error
+			charsets *_client.Charsets
+			res      api.CharsetsData
+		)
+
+		charsets, err = h.client.GetCharsets()
+		if err != nil {
+			handleBadRequest(writer, "Failed to get charsets and collations", err)
+			return
+		}
 
-		res = map[string]interface{}{"result": result}
+		res = api.CharsetsData{Result: charsets}
 		handleSuccessRequest(writer, "", res)
 	}
 }
@@ -975,22 +2824,29 @@ func (h *Handler) ExportTableToJson() http.HandlerFunc {
 			tableName string
 			msg       string
 			data      []byte
+			omitted   []string
+			extra     int
 		)
 
-		err = checkURLParams(request.URL, 1)
+		if request.URL.Query().Has("exclude") {
+			extra = 1
+		}
+		err = checkURLParams(request.URL, 1+extra)
 		if err != nil {
 			handleBadRequest(writer, msg, err)
 			return
 		}
 
 		tableName = request.URL.Query().Get("name")
-		data, err = h.client.ExportToJson(tableName)
+		data, omitted, err = h.client.ExportToJson(tableName, exportExclude(request.URL.Query()))
 		if err != nil {
 			msg = fmt.Sprintf("Failed to export table data: %s", tableName)
 			handleBadRequest(writer, msg, err)
 			return
 		}
 
+		h.recordUsage(tableName, usageExport)
+		setOmittedColumns(writer, omitted)
 		handleSuccessDownloadRequest(writer, string(data))
 	}
 }
@@ -1009,25 +2865,176 @@ func (h *Handler) ExportTableToCSV() http.HandlerFunc {
 			tableName string
 			msg       string
 			data      string
+			omitted   []string
+			extra     int
 		)
 
-		err = checkURLParams(request.URL, 1)
+		if request.URL.Query().Has("exclude") {
+			extra = 1
+		}
+		err = checkURLParams(request.URL, 1+extra)
 		if err != nil {
 			handleBadRequest(writer, msg, err)
 			return
 		}
 
 		tableName = request.URL.Query().Get("name")
-		data, err = h.client.ExportToCSV(tableName)
+		data, omitted, err = h.client.ExportToCSV(tableName, exportExclude(request.URL.Query()))
 		if err != nil {
 			msg = fmt.Sprintf("Failed to export table data: %s", tableName)
 			handleBadRequest(writer, msg, err)
 			return
 		}
+		h.recordUsage(tableName, usageExport)
+		setOmittedColumns(writer, omitted)
 		handleSuccessDownloadRequest(writer, data)
 	}
 }
 
+const (
+	// maxMissingKeys is the most keys listed in the missingKeysTrailer of /export/rows
+	maxMissingKeys = 100
+
+	missingKeysTrailer     = "X-Missing-Keys"
+	missingKeyCountTrailer = "X-Missing-Key-Count"
+)
+
+// ExportRowsRequest is the body of /export/rows. Rows are identified either by a single
+// key column and its values, or by several key columns and one tuple of values per row.
+type ExportRowsRequest struct {
+	Table      string          `json:"table"`
+	Format     string          `json:"format"`
+	KeyColumn  string          `json:"keyColumn"`
+	KeyValues  []interface{}   `json:"keyValues"`
+	KeyColumns []string        `json:"keyColumns"`
+	KeyTuples  [][]interface{} `json:"keyTuples"`
+	// Exclude lists columns to leave out of the export, along with those the connection excludes
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// keys normalizes the request into key columns and one value tuple per requested row.
+func (r *ExportRowsRequest) keys() ([]string, [][]interface{}) {
+	if r.KeyColumn == "" {
+		return r.KeyColumns, r.KeyTuples
+	}
+	tuples := make([][]interface{}, len(r.KeyValues))
+	for i, v := range r.KeyValues {
+		tuples[i] = []interface{}{v}
+	}
+	return []string{r.KeyColumn}, tuples
+}
+
+func (h *Handler) ExportRowsHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		var (
+			err         error
+			req         ExportRowsRequest
+			decoder     *json.Decoder
+			download    *downloadWriter
+			keyColumns  []string
+			keys        [][]interface{}
+			missing     [][]interface{}
+			omitted     []string
+			contentType string
+			msg         string
+		)
+
+		decoder = json.NewDecoder(request.Body)
+		decoder.UseNumber()
+		if err = decoder.Decode(&req); err != nil {
+			handleBadRequest(writer, "Invalid JSON", err)
+			return
+		}
+
+		keyColumns, keys = req.keys()
+		if req.Table == "" || len(keyColumns) == 0 || len(keys) == 0 {
+			handleBadRequest(writer, "Table, key columns and key values are required", nil)
+			return
+		}
+
+		_, omitted, err = h.client.ExportColumns(req.Table, req.Exclude)
+		if err != nil {
+			msg = fmt.Sprintf("Failed to export selected rows: %s", req.Table)
+			handleBadRequest(writer, msg, err)
+			return
+		}
+
+		switch strings.ToLower(req.Format) {
+		case "csv":
+			contentType = "text/csv"
+		case "json", "":
+			req.Format = "json"
+			contentType = "application/json"
+		default:
+			handleBadRequest(writer, "Unsupported export format", fmt.Errorf("unknown format: %s", req.Format))
+			return
+		}
+
+		download = newDownloadWriter(writer, fmt.Sprintf("%s_selection.%s", req.Table, strings.ToLower(req.Format)), contentType,
+			h.client.Settings.StreamBatchRows)
+		download.omitted = omitted
+		download.trailers = []string{missingKeysTrailer, missingKeyCountTrailer}
+		missing, err = h.client.WriteRowsByKeys(request.Context(), req.Table, keyColumns, keys, omitted, req.Format, download)
+		if err != nil && !download.started {
+			msg = fmt.Sprintf("Failed to export selected rows: %s", req.Table)
+			handleBadRequest(writer, msg, err)
+			return
+		}
+		if err != nil {
+			// the rows written before the export failed are still sent
+			_ = download.flush()
+			return
+		}
+		h.recordUsage(req.Table, usageExport)
+		if err = download.finish(); err != nil {
+			return
+		}
+		setMissingKeys(writer, len(keyColumns), missing)
+	}
+}
+
+// setMissingKeys sends the requested keys that matched no row in trailers: the first maxMissingKeys of them,
+// as values for a single key column and as tuples otherwise, and how many there are.
+func setMissingKeys(writer http.ResponseWriter, keyColumns int, missing [][]interface{}) {
+	writer.Header().Set(missingKeyCountTrailer, strconv.Itoa(len(missing)))
+	if len(missing) == 0 {
+		return
+	}
+	if len(missing) > maxMissingKeys {
+		missing = missing[:maxMissingKeys]
+	}
+	var keys interface{} = missing
+	if keyColumns == 1 {
+		flat := make([]interface{}, len(missing))
+		for i, key := range missing {
+			flat[i] = key[0]
+		}
+		keys = flat
+	}
+	if data, err := json.Marshal(keys); err == nil {
+		writer.Header().Set(missingKeysTrailer, string(data))
+	}
+}
+
+// handleSuccessFileRequest sends data as a named file attachment.
+func handleSuccessFileRequest(writer http.ResponseWriter, fileName, contentType string, data []byte) {
+	writer.Header().Set("Content-Type", contentType)
+	writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+	writer.WriteHeader(http.StatusAccepted)
+	_, err := writer.Write(data)
+	if err != nil {
+		http.Error(writer, "Error writing response", http.StatusInternalServerError)
+		return
+	}
+}
+
 func handleSuccessDownloadRequest(writer http.ResponseWriter, data string) {
 	writer.Header().Set("Content-Type", "application/octet-stream")
 	// writer.Header().Set("Filename", fileName)
@@ -1,3 +1,3170 @@
 package handler
 
-// TODO: test handlers
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yazeed1s/sqlweb/db/connection"
+	_sql "github.com/yazeed1s/sqlweb/db/sql"
+	"github.com/yazeed1s/sqlweb/pkg/api"
+	_client "github.com/yazeed1s/sqlweb/pkg/client"
+	"github.com/yazeed1s/sqlweb/pkg/config"
+	"github.com/yazeed1s/sqlweb/pkg/query"
+	"github.com/yazeed1s/sqlweb/pkg/util"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TODO: test remaining handlers
+
+func SetupSQLiteHandler(t testing.TB) *Handler {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	return &Handler{
+		client: &_client.Client{
+			Type:     _sql.SQLite,
+			Database: db,
+		},
+	}
+}
+
+func TestShowCreateTableJSON(t *testing.T) {
+	h := SetupSQLiteHandler(t)
+	_, err := h.client.Database.Exec(`CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT)`)
+	require.NoError(t, err)
+
+	request := httptest.NewRequest(http.MethodGet, "/export/sql?format=json", nil)
+	recorder := httptest.NewRecorder()
+	h.ShowCreateTable()(recorder, request)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	var response struct {
+		Data map[string]string `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+	assert.Contains(t, response.Data["people"], "CREATE TABLE people")
+}
+
+func TestShowCreateTableDownload(t *testing.T) {
+	h := SetupSQLiteHandler(t)
+	_, err := h.client.Database.Exec(`CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT)`)
+	require.NoError(t, err)
+
+	request := httptest.NewRequest(http.MethodGet, "/export/sql", nil)
+	recorder := httptest.NewRecorder()
+	h.ShowCreateTable()(recorder, request)
+
+	assert.Equal(t, http.StatusAccepted, recorder.Code)
+	assert.Equal(t, "application/octet-stream", recorder.Header().Get("Content-Type"))
+	assert.Contains(t, recorder.Body.String(), "===== TABLE: people =====")
+}
+
+func TestSchemaExport(t *testing.T) {
+	h := SetupSQLiteHandler(t)
+	h.client.Schema.Name = "main"
+	_, err := h.client.Database.Exec(`CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT NOT NULL, born DATE)`)
+	require.NoError(t, err)
+
+	request := httptest.NewRequest(http.MethodGet, "/export/schema-json", nil)
+	recorder := httptest.NewRecorder()
+	h.SchemaExportHandler()(recorder, request)
+
+	assert.Equal(t, http.StatusAccepted, recorder.Code)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	assert.Contains(t, recorder.Header().Get("Content-Disposition"), "main.schema.json")
+	var doc _client.SchemaDocument
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&doc))
+	require.Len(t, doc.Tables, 1)
+	assert.Equal(t, []string{"id"}, doc.Tables[0].PrimaryKey)
+	assert.Equal(t, _sql.Date, doc.Tables[0].Columns[2].PortableType)
+
+	request = httptest.NewRequest(http.MethodGet, "/export/schema-json?target=golang", nil)
+	recorder = httptest.NewRecorder()
+	h.SchemaExportHandler()(recorder, request)
+
+	assert.Equal(t, http.StatusAccepted, recorder.Code)
+	assert.Equal(t, "text/x-go", recorder.Header().Get("Content-Type"))
+	assert.Contains(t, recorder.Body.String(), "type People struct {")
+	assert.Contains(t, recorder.Body.String(), "Born *time.Time `db:\"born\" json:\"born\"`")
+
+	request = httptest.NewRequest(http.MethodGet, "/export/schema-json?target=rust", nil)
+	recorder = httptest.NewRecorder()
+	h.SchemaExportHandler()(recorder, request)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestPing(t *testing.T) {
+	h := SetupSQLiteHandler(t)
+
+	request := httptest.NewRequest(http.MethodGet, "/ping", nil)
+	recorder := httptest.NewRecorder()
+	h.PingHandler()(recorder, request)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var response struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+	assert.Equal(t, true, response.Data["reachable"])
+	require.IsType(t, float64(0), response.Data["latencyMs"])
+	assert.GreaterOrEqual(t, response.Data["latencyMs"].(float64), 0.0)
+
+	// a closed pool fails the ping
+	require.NoError(t, h.client.Database.Close())
+	recorder = httptest.NewRecorder()
+	h.PingHandler()(recorder, request)
+
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	var failed Response
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&failed))
+	assert.Equal(t, ErrCodePingFailed, failed.Code)
+	assert.NotEmpty(t, failed.Error)
+	assert.Contains(t, failed.Data, "latencyMs")
+
+	request = httptest.NewRequest(http.MethodGet, "/ping?timeout=soon", nil)
+	recorder = httptest.NewRecorder()
+	h.PingHandler()(recorder, request)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestTableCommentReadOnly(t *testing.T) {
+	h := SetupSQLiteHandler(t)
+	h.SetReadOnly(true)
+
+	body := strings.NewReader(`{"tableName": "people", "comment": "everyone"}`)
+	request := httptest.NewRequest(http.MethodPost, "/table/comment", body)
+	recorder := httptest.NewRecorder()
+	h.TableCommentHandler()(recorder, request)
+
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "read-only")
+}
+
+func TestTableCommentSQLiteUnsupported(t *testing.T) {
+	h := SetupSQLiteHandler(t)
+
+	body := strings.NewReader(`{"tableName": "people", "comment": "everyone"}`)
+	request := httptest.NewRequest(http.MethodPost, "/table/comment", body)
+	recorder := httptest.NewRecorder()
+	h.TableCommentHandler()(recorder, request)
+
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "does not support table or column comments")
+}
+
+func TestIdleConnectionSuspendAndResume(t *testing.T) {
+	conn := &connection.Connection{
+		Type: _sql.SQLite,
+		Path: filepath.Join(t.TempDir(), "idle.db"),
+	}
+	db, err := connection.ConnectToDatabase(conn, conn.Type.String())
+	require.NoError(t, err)
+	h := NewHandler()
+	h.client = &_client.Client{Type: _sql.SQLite, Path: conn.Path, Database: db}
+	h.session.connected(conn)
+	h.SetIdleTimeout(time.Minute)
+	t.Cleanup(func() {
+		_ = h.client.Database.Close()
+	})
+
+	h.checkIdle(time.Now())
+	assert.Equal(t, stateActive, h.stats().State)
+
+	h.checkIdle(time.Now().Add(2 * time.Minute))
+	assert.Equal(t, stateSuspended, h.stats().State)
+	assert.Error(t, db.Ping(), "suspended connection should be closed")
+
+	called := false
+	tracked := h.Track(func(writer http.ResponseWriter, request *http.Request) {
+		called = true
+		assert.NoError(t, h.client.Database.Ping())
+	})
+	tracked(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/schemas", nil))
+	assert.True(t, called)
+	assert.Equal(t, stateActive, h.stats().State)
+}
+
+func TestIdleSuspensionWaitsForRequests(t *testing.T) {
+	conn := &connection.Connection{
+		Type: _sql.SQLite,
+		Path: filepath.Join(t.TempDir(), "idle.db"),
+	}
+	db, err := connection.ConnectToDatabase(conn, conn.Type.String())
+	require.NoError(t, err)
+	h := NewHandler()
+	h.client = &_client.Client{Type: _sql.SQLite, Path: conn.Path, Database: db}
+	h.session.connected(conn)
+	h.SetIdleTimeout(time.Minute)
+	t.Cleanup(func() {
+		_ = h.client.Database.Close()
+	})
+
+	started, release, finished := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(finished)
+		h.Track(func(writer http.ResponseWriter, request *http.Request) {
+			close(started)
+			<-release
+			assert.NoError(t, h.client.Database.Ping(), "the connection must stay open under a running request")
+		})(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/schemas", nil))
+	}()
+	<-started
+	h.checkIdle(time.Now().Add(time.Hour))
+	assert.NotEqual(t, stateSuspended, h.stats().State)
+	close(release)
+	<-finished
+	h.checkIdle(time.Now().Add(time.Hour))
+	assert.Equal(t, stateSuspended, h.stats().State)
+
+	// requests resuming the connection race with suspensions; run with -race
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			h.Track(func(writer http.ResponseWriter, request *http.Request) {
+				assert.NoError(t, h.client.Database.Ping())
+			})(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/schemas", nil))
+		}()
+		go func() {
+			defer wg.Done()
+			h.checkIdle(time.Now().Add(time.Hour))
+		}()
+	}
+	wg.Wait()
+}
+
+func TestSuspendedConnectionLost(t *testing.T) {
+	dir := t.TempDir()
+	conn := &connection.Connection{
+		Type: _sql.SQLite,
+		Path: filepath.Join(dir, "idle.db"),
+	}
+	db, err := connection.ConnectToDatabase(conn, conn.Type.String())
+	require.NoError(t, err)
+	h := NewHandler()
+	h.client = &_client.Client{Type: _sql.SQLite, Path: conn.Path, Database: db}
+	h.session.connected(conn)
+	h.SetIdleTimeout(time.Minute)
+
+	h.checkIdle(time.Now().Add(2 * time.Minute))
+	conn.Path = filepath.Join(dir, "missing", "idle.db")
+
+	recorder := httptest.NewRecorder()
+	h.Track(func(writer http.ResponseWriter, request *http.Request) {
+		t.Fatal("handler must not run when the connection cannot be reopened")
+	})(recorder, httptest.NewRequest(http.MethodGet, "/schemas", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), ErrCodeConnectionLost)
+}
+
+func TestRerunQueryHistory(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	h := SetupSQLiteHandler(t)
+	_, err := h.client.Database.Exec(`CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT)`)
+	require.NoError(t, err)
+	_, err = h.client.Database.Exec(`INSERT INTO people (name) VALUES ('ada')`)
+	require.NoError(t, err)
+
+	body := strings.NewReader(`{"query": "SELECT * FROM people"}`)
+	recorder := httptest.NewRecorder()
+	h.QueryHandler()(recorder, httptest.NewRequest(http.MethodPost, "/execute", body))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	history, err := config.GetQueryHistory(h.client.Key())
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, int64(1), history[0].AffectedRows)
+
+	_, err = h.client.Database.Exec(`INSERT INTO people (name) VALUES ('grace')`)
+	require.NoError(t, err)
+
+	recorder = httptest.NewRecorder()
+	h.RerunQueryHandler()(recorder, httptest.NewRequest(http.MethodPost, "/queries/history/rerun?id="+history[0].ID, nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var response struct {
+		Data struct {
+			Result   query.Result `json:"result"`
+			Previous struct {
+				ID           string `json:"id"`
+				AffectedRows int64  `json:"affected_rows"`
+			} `json:"previous"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+	assert.Equal(t, int64(2), response.Data.Result.AffectedRows)
+	assert.Equal(t, int64(1), response.Data.Previous.AffectedRows)
+	assert.Equal(t, history[0].ID, response.Data.Previous.ID)
+}
+
+func TestRenameTableFixesSavedQueriesAndTemplates(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	h := SetupSQLiteHandler(t)
+	_, err := h.client.Database.Exec(`CREATE TABLE orders (id INTEGER PRIMARY KEY, item TEXT);
+		CREATE TABLE orders_archive (id INTEGER PRIMARY KEY);
+		INSERT INTO orders (item) VALUES ('pen')`)
+	require.NoError(t, err)
+
+	body := strings.NewReader(`{"query": "SELECT item, 'orders' AS source FROM orders WHERE id NOT IN (SELECT id FROM orders_archive)"}`)
+	recorder := httptest.NewRecorder()
+	h.QueryHandler()(recorder, httptest.NewRequest(http.MethodPost, "/execute", body))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	history, err := config.GetQueryHistory(h.client.Key())
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	require.NoError(t, config.SaveExportTemplate(h.client.Key(), _client.ExportTemplate{
+		Name: "items", Table: "orders", Format: "csv", Columns: []_client.TemplateColumn{{Source: "item"}},
+	}))
+
+	recorder = httptest.NewRecorder()
+	body = strings.NewReader(`{"tableName": "orders", "newName": "purchases"}`)
+	h.RenameTableHandler()(recorder, httptest.NewRequest(http.MethodPost, "/table/rename", body))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	rewritten := "SELECT item, 'orders' AS source FROM purchases WHERE id NOT IN (SELECT id FROM orders_archive)"
+	recorder = httptest.NewRecorder()
+	h.QueryHistoryHandler()(recorder, httptest.NewRequest(http.MethodGet, "/queries/history", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var listed struct {
+		Data struct {
+			Renamed []RenameSuggestion `json:"renamed"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&listed))
+	require.Len(t, listed.Data.Renamed, 1)
+	assert.Equal(t, history[0].ID, listed.Data.Renamed[0].ID)
+	assert.Equal(t, rewritten, listed.Data.Renamed[0].Query)
+	assert.Equal(t, map[string]string{"orders": "purchases"}, listed.Data.Renamed[0].Renames)
+	assert.False(t, listed.Data.Renamed[0].Applied)
+
+	recorder = httptest.NewRecorder()
+	h.RerunQueryHandler()(recorder, httptest.NewRequest(http.MethodPost, "/queries/history/rerun?id="+history[0].ID, nil))
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), ErrCodeTableRenamed)
+
+	// listing the history never saves the rewrite, fixing it does
+	recorder = httptest.NewRecorder()
+	h.QueryHistoryHandler()(recorder, httptest.NewRequest(http.MethodGet, "/queries/history?autoFix=true", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	saved, err := config.FindQueryHistory(history[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, history[0].Query, saved.Query)
+	recorder = httptest.NewRecorder()
+	h.FixQueryHistoryHandler()(recorder, httptest.NewRequest(http.MethodPost, "/queries/history/fix?id="+history[0].ID, nil))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Contains(t, recorder.Body.String(), `"applied":true`)
+	saved, err = config.FindQueryHistory(history[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, rewritten, saved.Query)
+
+	recorder = httptest.NewRecorder()
+	h.RerunQueryHandler()(recorder, httptest.NewRequest(http.MethodPost, "/queries/history/rerun?id="+history[0].ID, nil))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	recorder = httptest.NewRecorder()
+	h.RunExportTemplateHandler()(recorder, httptest.NewRequest(http.MethodGet, "/export/templates/run?name=items", nil))
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `"table":"purchases"`)
+
+	// running the template does not save the fix
+	recorder = httptest.NewRecorder()
+	h.RunExportTemplateHandler()(recorder, httptest.NewRequest(http.MethodGet, "/export/templates/run?name=items&autoFix=true", nil))
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	recorder = httptest.NewRecorder()
+	h.FixExportTemplateHandler()(recorder, httptest.NewRequest(http.MethodPost, "/export/templates/fix?name=items", nil))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Contains(t, recorder.Body.String(), `"applied":true`)
+	recorder = httptest.NewRecorder()
+	h.RunExportTemplateHandler()(recorder, httptest.NewRequest(http.MethodGet, "/export/templates/run?name=items", nil))
+	require.Equal(t, http.StatusAccepted, recorder.Code, recorder.Body.String())
+	assert.Equal(t, "item\npen\n", recorder.Body.String())
+	prefs, err := config.GetPreferences(h.client.Key())
+	require.NoError(t, err)
+	template, found := prefs.ExportTemplate("items")
+	require.True(t, found)
+	assert.Equal(t, "purchases", template.Table)
+}
+
+func TestRerunWriteQueryReadOnly(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	h := SetupSQLiteHandler(t)
+	_, err := h.client.Database.Exec(`CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT)`)
+	require.NoError(t, err)
+
+	body := strings.NewReader(`{"query": "INSERT INTO people (name) VALUES ('ada')"}`)
+	recorder := httptest.NewRecorder()
+	h.QueryHandler()(recorder, httptest.NewRequest(http.MethodPost, "/execute", body))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	history, err := config.GetQueryHistory(h.client.Key())
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+
+	h.SetReadOnly(true)
+	recorder = httptest.NewRecorder()
+	h.RerunQueryHandler()(recorder, httptest.NewRequest(http.MethodPost, "/queries/history/rerun?id="+history[0].ID, nil))
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+
+	var count int
+	require.NoError(t, h.client.Database.QueryRow(`SELECT COUNT(*) FROM people`).Scan(&count))
+	assert.Equal(t, 1, count)
+}
+
+func TestExportRowsCSV(t *testing.T) {
+	h := SetupSQLiteHandler(t)
+	_, err := h.client.Database.Exec(`CREATE TABLE orders (id INTEGER PRIMARY KEY, item TEXT, qty INTEGER)`)
+	require.NoError(t, err)
+	_, err = h.client.Database.Exec(`INSERT INTO orders VALUES (1, 'pen', 2), (2, 'ink', 1), (3, 'pad', 5)`)
+	require.NoError(t, err)
+
+	body := strings.NewReader(`{"table": "orders", "format": "csv", "keyColumn": "id", "keyValues": [3, 1, 99]}`)
+	recorder := httptest.NewRecorder()
+	h.ExportRowsHandler()(recorder, httptest.NewRequest(http.MethodPost, "/export/rows", body))
+
+	assert.Equal(t, http.StatusAccepted, recorder.Code)
+	assert.Equal(t, `attachment; filename="orders_selection.csv"`, recorder.Header().Get("Content-Disposition"))
+	assert.Equal(t, `[99]`, recorder.Result().Trailer.Get("X-Missing-Keys"))
+	assert.Equal(t, "1", recorder.Result().Trailer.Get("X-Missing-Key-Count"))
+	assert.Equal(t, "2", recorder.Result().Trailer.Get("X-Exported-Rows"))
+	assert.Equal(t, "id,item,qty\n1,pen,2\n3,pad,5\n", recorder.Body.String())
+}
+
+func TestExportRowsMissingKeysCapped(t *testing.T) {
+	h := SetupSQLiteHandler(t)
+	_, err := h.client.Database.Exec(`CREATE TABLE orders (id INTEGER PRIMARY KEY, item TEXT)`)
+	require.NoError(t, err)
+	_, err = h.client.Database.Exec(`INSERT INTO orders VALUES (1, 'pen')`)
+	require.NoError(t, err)
+
+	// more keys than a lookup chunk holds, all but one of them missing
+	keys := make([]string, 2000)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i + 1)
+	}
+	body := strings.NewReader(`{"table": "orders", "format": "csv", "keyColumn": "id", "keyValues": [` + strings.Join(keys, ",") + `]}`)
+	recorder := httptest.NewRecorder()
+	h.ExportRowsHandler()(recorder, httptest.NewRequest(http.MethodPost, "/export/rows", body))
+
+	require.Equal(t, http.StatusAccepted, recorder.Code)
+	assert.Empty(t, recorder.Result().Header.Get("X-Missing-Keys"))
+	var missing []int
+	require.NoError(t, json.Unmarshal([]byte(recorder.Result().Trailer.Get("X-Missing-Keys")), &missing))
+	assert.Len(t, missing, maxMissingKeys)
+	assert.Equal(t, 2, missing[0])
+	assert.Equal(t, "1999", recorder.Result().Trailer.Get("X-Missing-Key-Count"))
+	assert.Equal(t, "id,item\n1,pen\n", recorder.Body.String())
+}
+
+func TestExportRowsCompositeKeyJSON(t *testing.T) {
+	h := SetupSQLiteHandler(t)
+	_, err := h.client.Database.Exec(`CREATE TABLE lines (order_id INTEGER, line INTEGER, item TEXT, PRIMARY KEY (order_id, line))`)
+	require.NoError(t, err)
+	_, err = h.client.Database.Exec(`INSERT INTO lines VALUES (1, 1, 'pen'), (1, 2, 'ink'), (2, 1, 'pad')`)
+	require.NoError(t, err)
+
+	body := strings.NewReader(`{"table": "lines", "keyColumns": ["order_id", "line"], "keyTuples": [[1, 2], [2, 2]]}`)
+	recorder := httptest.NewRecorder()
+	h.ExportRowsHandler()(recorder, httptest.NewRequest(http.MethodPost, "/export/rows", body))
+
+	assert.Equal(t, http.StatusAccepted, recorder.Code)
+	assert.Equal(t, `attachment; filename="lines_selection.json"`, recorder.Header().Get("Content-Disposition"))
+	assert.Equal(t, `[[2,2]]`, recorder.Result().Trailer.Get("X-Missing-Keys"))
+	assert.Equal(t, "[\n\t{\"order_id\": 1, \"line\": 2, \"item\": \"ink\"}\n]", recorder.Body.String())
+}
+
+func TestExportExcludedColumns(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	h := SetupSQLiteHandler(t)
+	_, err := h.client.Database.Exec(`CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT, email TEXT, ssn TEXT)`)
+	require.NoError(t, err)
+	_, err = h.client.Database.Exec(`INSERT INTO people VALUES (1, 'ada', 'ada@example.com', '123-45-6789')`)
+	require.NoError(t, err)
+	h.client.Settings.ExportExcludedColumns = []string{"people.ssn"}
+
+	recorder := httptest.NewRecorder()
+	h.ExportTableToCSV()(recorder, httptest.NewRequest(http.MethodGet, "/export/csv?name=people&exclude=email", nil))
+	assert.Equal(t, http.StatusAccepted, recorder.Code)
+	assert.Equal(t, "email,ssn", recorder.Header().Get("X-Omitted-Columns"))
+	assert.Equal(t, "id,name\n1,ada\n", recorder.Body.String())
+
+	body := strings.NewReader(`{"table": "people", "format": "csv", "keyColumn": "id", "keyValues": [1], "exclude": ["name"]}`)
+	recorder = httptest.NewRecorder()
+	h.ExportRowsHandler()(recorder, httptest.NewRequest(http.MethodPost, "/export/rows", body))
+	assert.Equal(t, http.StatusAccepted, recorder.Code)
+	assert.Equal(t, "name,ssn", recorder.Header().Get("X-Omitted-Columns"))
+	assert.Equal(t, "id,email\n1,ada@example.com\n", recorder.Body.String())
+
+	body = strings.NewReader(`{"name": "contacts", "table": "people", "format": "csv",
+		"columns": [{"source": "name"}, {"source": "ssn"}]}`)
+	recorder = httptest.NewRecorder()
+	h.SaveExportTemplateHandler()(recorder, httptest.NewRequest(http.MethodPost, "/export/templates/save", body))
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `"code":"policy_violation"`)
+
+	body = strings.NewReader(`{"name": "contacts", "table": "people", "format": "csv",
+		"columns": [{"source": "name"}, {"source": "email"}]}`)
+	recorder = httptest.NewRecorder()
+	h.SaveExportTemplateHandler()(recorder, httptest.NewRequest(http.MethodPost, "/export/templates/save", body))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	recorder = httptest.NewRecorder()
+	h.RunExportTemplateHandler()(recorder, httptest.NewRequest(http.MethodGet, "/export/templates/run?name=contacts&exclude=email", nil))
+	assert.Equal(t, http.StatusAccepted, recorder.Code)
+	assert.Equal(t, "email", recorder.Header().Get("X-Omitted-Columns"))
+	assert.Equal(t, "name\nada\n", recorder.Body.String())
+
+	h.client.Settings.ExportExcludedColumns = []string{"people.e*"}
+	recorder = httptest.NewRecorder()
+	h.RunExportTemplateHandler()(recorder, httptest.NewRequest(http.MethodGet, "/export/templates/run?name=contacts", nil))
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `"code":"policy_violation"`)
+}
+
+func TestQuerySystemTableRequiresConfirmation(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	h := SetupSQLiteHandler(t)
+	_, err := h.client.Database.Exec(`CREATE TABLE people (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT)`)
+	require.NoError(t, err)
+	_, err = h.client.Database.Exec(`INSERT INTO people (name) VALUES ('ada')`)
+	require.NoError(t, err)
+
+	body := strings.NewReader(`{"query": "DELETE FROM sqlite_sequence", "allowSystem": true}`)
+	recorder := httptest.NewRecorder()
+	h.QueryHandler()(recorder, httptest.NewRequest(http.MethodPost, "/execute", body))
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+
+	var response struct {
+		Code string `json:"code"`
+		Data struct {
+			Targets      []query.TableRef `json:"targets"`
+			ConfirmToken string           `json:"confirm_token"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+	assert.Equal(t, ErrCodeSystemSchema, response.Code)
+	assert.Equal(t, []query.TableRef{{Table: "sqlite_sequence"}}, response.Data.Targets)
+	require.NotEmpty(t, response.Data.ConfirmToken)
+
+	var count int
+	require.NoError(t, h.client.Database.QueryRow(`SELECT COUNT(*) FROM sqlite_sequence`).Scan(&count))
+	assert.Equal(t, 1, count)
+
+	// the token is bound to the statement it was issued for
+	body = strings.NewReader(`{"query": "DELETE FROM sqlite_sequence WHERE 1", "allowSystem": true, "confirmToken": "` +
+		response.Data.ConfirmToken + `"}`)
+	recorder = httptest.NewRecorder()
+	h.QueryHandler()(recorder, httptest.NewRequest(http.MethodPost, "/execute", body))
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+
+	body = strings.NewReader(`{"query": "DELETE FROM sqlite_sequence", "allowSystem": true, "confirmToken": "` +
+		response.Data.ConfirmToken + `"}`)
+	recorder = httptest.NewRecorder()
+	h.QueryHandler()(recorder, httptest.NewRequest(http.MethodPost, "/execute", body))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	require.NoError(t, h.client.Database.QueryRow(`SELECT COUNT(*) FROM sqlite_sequence`).Scan(&count))
+	assert.Equal(t, 0, count)
+}
+
+func TestDeleteRowsSystemSchema(t *testing.T) {
+	h := SetupSQLiteHandler(t)
+	h.client.Type = _sql.MySQL
+	h.client.Schema.Name = "mysql"
+
+	body := strings.NewReader(`{"tableName": "user", "filter": [{"column": "user", "operator": "=", "value": "root"}]}`)
+	recorder := httptest.NewRecorder()
+	h.DeleteRowsHandler()(recorder, httptest.NewRequest(http.MethodPost, "/rows/delete", body))
+
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), ErrCodeSystemSchema)
+}
+
+func TestUpdateRowsSchemaChanged(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	h := SetupSQLiteHandler(t)
+	_, err := h.client.Database.Exec(`CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT)`)
+	require.NoError(t, err)
+	_, err = h.client.Database.Exec(`INSERT INTO people (name) VALUES ('ada')`)
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	h.TableDataHandler()(recorder, httptest.NewRequest(http.MethodGet, "/table?name=people&page=1&perPage=10", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var table struct {
+		Data struct {
+			Table _client.Table `json:"table"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&table))
+	loaded := table.Data.Table.Fingerprint
+	require.NotEmpty(t, loaded)
+
+	_, err = h.client.Database.Exec(`ALTER TABLE people ADD COLUMN email TEXT`)
+	require.NoError(t, err)
+
+	update := func(fingerprint string) *httptest.ResponseRecorder {
+		body := strings.NewReader(`{"tableName": "people", "set": {"name": "grace"},
+			"filter": [{"column": "id", "operator": "=", "value": 1}], "fingerprint": "` + fingerprint + `"}`)
+		recorder := httptest.NewRecorder()
+		h.UpdateRowsHandler()(recorder, httptest.NewRequest(http.MethodPost, "/rows/update", body))
+		return recorder
+	}
+
+	recorder = update(loaded)
+	require.Equal(t, http.StatusConflict, recorder.Code)
+	var response struct {
+		Code string `json:"code"`
+		Data struct {
+			Fingerprint string `json:"fingerprint"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+	assert.Equal(t, ErrCodeSchemaChanged, response.Code)
+	assert.NotEqual(t, loaded, response.Data.Fingerprint)
+
+	var name string
+	require.NoError(t, h.client.Database.QueryRow(`SELECT name FROM people WHERE id = 1`).Scan(&name))
+	assert.Equal(t, "ada", name)
+
+	recorder = update(response.Data.Fingerprint)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.NoError(t, h.client.Database.QueryRow(`SELECT name FROM people WHERE id = 1`).Scan(&name))
+	assert.Equal(t, "grace", name)
+}
+
+func TestRowEditHandler(t *testing.T) {
+	h := SetupSQLiteHandler(t)
+	_, err := h.client.Database.Exec(`CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT, age INTEGER)`)
+	require.NoError(t, err)
+	_, err = h.client.Database.Exec(`INSERT INTO people VALUES (1, 'ada', 36)`)
+	require.NoError(t, err)
+
+	body := strings.NewReader(`{"table": "people", "keyColumns": ["id"], "keyValues": [1], "values": {}}`)
+	recorder := httptest.NewRecorder()
+	h.RowEditHandler()(recorder, httptest.NewRequest(http.MethodPost, "/row/update", body))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	body = strings.NewReader(`{"table": "people", "keyColumns": ["id"], "keyValues": [1],
+		"values": {"name": "grace", "age": 36}, "returnRow": true}`)
+	recorder = httptest.NewRecorder()
+	h.RowEditHandler()(recorder, httptest.NewRequest(http.MethodPost, "/row/update", body))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var response struct {
+		Data struct {
+			Result struct {
+				Row     map[string]interface{} `json:"row"`
+				Changed []string               `json:"changed"`
+			} `json:"result"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+	assert.Equal(t, []string{"name"}, response.Data.Result.Changed)
+	assert.Equal(t, "grace", response.Data.Result.Row["name"])
+}
+
+func TestViewsHandler(t *testing.T) {
+	h := SetupSQLiteHandler(t)
+	_, err := h.client.Database.Exec(`
+		CREATE TABLE orders (id INTEGER PRIMARY KEY, total REAL);
+		CREATE VIEW large_orders AS SELECT id FROM orders WHERE total > 100;
+	`)
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	h.ViewsHandler()(recorder, httptest.NewRequest(http.MethodGet, "/views", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var response struct {
+		Data struct {
+			Result []_client.View `json:"result"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+	require.Len(t, response.Data.Result, 1)
+	assert.Equal(t, "large_orders", response.Data.Result[0].Name)
+	assert.Contains(t, response.Data.Result[0].Definition, "WHERE total > 100")
+}
+
+func TestReferencedByHandler(t *testing.T) {
+	h := SetupSQLiteHandler(t)
+	_, err := h.client.Database.Exec(`
+		CREATE TABLE customers (id INTEGER PRIMARY KEY);
+		CREATE TABLE orders (id INTEGER PRIMARY KEY, customer_id INTEGER REFERENCES customers (id) ON DELETE SET NULL);
+	`)
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	h.ReferencedByHandler()(recorder, httptest.NewRequest(http.MethodGet, "/table/referenced-by?name=customers", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var response struct {
+		Data struct {
+			Result []_client.ReferencingTable `json:"result"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+	require.Len(t, response.Data.Result, 1)
+	assert.Equal(t, "orders", response.Data.Result[0].FromTable)
+	assert.Equal(t, []string{"customer_id"}, response.Data.Result[0].FromColumns)
+	assert.Equal(t, "SET NULL", response.Data.Result[0].OnDelete)
+
+	recorder = httptest.NewRecorder()
+	h.GetColumnData()(recorder, httptest.NewRequest(http.MethodGet, "/columns/table?name=customers", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var columns struct {
+		Data _client.ColumnData `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&columns))
+	assert.Equal(t, response.Data.Result, columns.Data.ReferencedBy)
+
+	recorder = httptest.NewRecorder()
+	h.ReferencedByHandler()(recorder, httptest.NewRequest(http.MethodGet, "/table/referenced-by", nil))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestRenameColumnDependencies(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	h := SetupSQLiteHandler(t)
+	_, err := h.client.Database.Exec(`
+		CREATE TABLE customers (id INTEGER PRIMARY KEY, email TEXT);
+		CREATE VIEW customer_emails AS SELECT id, email FROM customers;
+	`)
+	require.NoError(t, err)
+
+	// queries that only ran are not saved queries
+	body := strings.NewReader(`{"query": "SELECT email FROM customers WHERE id = 2"}`)
+	recorder := httptest.NewRecorder()
+	h.QueryHandler()(recorder, httptest.NewRequest(http.MethodPost, "/execute", body))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	_, err = config.SaveQuery(config.SavedQuery{
+		Name: "emails", Connection: h.client.Key(), Query: "SELECT email FROM customers WHERE id = :id",
+	})
+	require.NoError(t, err)
+
+	recorder = httptest.NewRecorder()
+	h.ColumnDependenciesHandler()(recorder,
+		httptest.NewRequest(http.MethodGet, "/table/column/dependencies?table=customers&column=email", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var response struct {
+		Code string `json:"code"`
+		Data struct {
+			Result ColumnImpact `json:"result"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+	assert.Equal(t, []string{"customer_emails"}, response.Data.Result.Views)
+	require.Len(t, response.Data.Result.SavedQueries, 1)
+	assert.Equal(t, "emails", response.Data.Result.SavedQueries[0].Name)
+
+	rename := func(ack bool) *httptest.ResponseRecorder {
+		body := strings.NewReader(fmt.Sprintf(`{"tableName": "customers", "column": "email",
+			"newName": "contact_email", "acknowledgeDependencies": %t}`, ack))
+		recorder := httptest.NewRecorder()
+		h.RenameColumnHandler()(recorder, httptest.NewRequest(http.MethodPost, "/table/column/rename", body))
+		return recorder
+	}
+
+	recorder = rename(false)
+	require.Equal(t, http.StatusConflict, recorder.Code)
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+	assert.Equal(t, ErrCodeDependenciesFound, response.Code)
+
+	recorder = rename(true)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	cols, err := h.client.GetColumns("customers")
+	require.NoError(t, err)
+	assert.Equal(t, "contact_email", cols[1].Field)
+}
+
+func TestUpdateRowNullAndEmptyString(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	h := SetupSQLiteHandler(t)
+	_, err := h.client.Database.Exec(`CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT)`)
+	require.NoError(t, err)
+	_, err = h.client.Database.Exec(`INSERT INTO people VALUES (1, 'ada'), (2, 'alan')`)
+	require.NoError(t, err)
+
+	update := func(id, value string) {
+		body := strings.NewReader(`{"tableName": "people", "parentColumn": "name", "headerValue": "id",
+			"cellValue": "` + id + `", "editedCellValue": ` + value + `}`)
+		recorder := httptest.NewRecorder()
+		h.UpdateRowHandler()(recorder, httptest.NewRequest(http.MethodPost, "/update", body))
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+	update("1", `null`)
+	update("2", `""`)
+
+	recorder := httptest.NewRecorder()
+	h.TableDataHandler()(recorder, httptest.NewRequest(http.MethodGet, "/table?name=people&page=1&perPage=10", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var table struct {
+		Data struct {
+			Table _client.Table `json:"table"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&table))
+	require.Len(t, table.Data.Table.Data, 2)
+	assert.Nil(t, table.Data.Table.Data[0]["name"])
+	assert.Equal(t, "", table.Data.Table.Data[1]["name"])
+}
+
+func TestUpdateRowReadOnly(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	h := SetupSQLiteHandler(t)
+	_, err := h.client.Database.Exec(`CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT);
+		INSERT INTO people VALUES (1, 'ada')`)
+	require.NoError(t, err)
+	h.SetReadOnly(true)
+
+	body := strings.NewReader(`{"tableName": "people", "parentColumn": "name", "headerValue": "id",
+		"cellValue": "1", "editedCellValue": "grace"}`)
+	recorder := httptest.NewRecorder()
+	h.UpdateRowHandler()(recorder, httptest.NewRequest(http.MethodPost, "/update", body))
+
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "read-only")
+	var name string
+	require.NoError(t, h.client.Database.QueryRow(`SELECT name FROM people WHERE id = 1`).Scan(&name))
+	assert.Equal(t, "ada", name)
+}
+
+func TestTableCollate(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	h := SetupSQLiteHandler(t)
+	_, err := h.client.Database.Exec(`CREATE TABLE words (word TEXT, n INTEGER);
+		INSERT INTO words VALUES ('cherry', 1), ('Banana', 2), ('apple', 3)`)
+	require.NoError(t, err)
+	read := func(query string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		h.TableDataHandler()(recorder, httptest.NewRequest(http.MethodGet, "/table?name=words&page=1&perPage=10"+query, nil))
+		return recorder
+	}
+	words := func(recorder *httptest.ResponseRecorder) (*_client.TableOrder, []interface{}) {
+		var page struct {
+			Data api.TablePage `json:"data"`
+		}
+		require.NoError(t, json.NewDecoder(recorder.Body).Decode(&page))
+		var words []interface{}
+		for _, row := range page.Data.Table.Data {
+			words = append(words, row["word"])
+		}
+		return page.Data.Table.Order, words
+	}
+
+	recorder := read("")
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	order, sorted := words(recorder)
+	assert.Empty(t, order.Collation)
+	assert.Equal(t, []interface{}{"Banana", "apple", "cherry"}, sorted)
+
+	// the name is matched ignoring case, and reported as the server lists it
+	recorder = read("&collate=nocase")
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	order, sorted = words(recorder)
+	assert.Equal(t, "NOCASE", order.Collation)
+	assert.Equal(t, []string{"word"}, order.Collated)
+	assert.Equal(t, []interface{}{"apple", "Banana", "cherry"}, sorted)
+
+	recorder = read("&collate=" + url.QueryEscape("NOCASE; DROP TABLE words"))
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	var failed struct {
+		Code string `json:"code"`
+		Data struct {
+			Available []string `json:"available"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&failed))
+	assert.Equal(t, ErrCodeUnknownCollation, failed.Code)
+	assert.Contains(t, failed.Data.Available, "NOCASE")
+	assert.Contains(t, failed.Data.Available, "BINARY")
+}
+
+func TestDropTableProductionRequiresConfirmation(t *testing.T) {
+	h := SetupSQLiteHandler(t)
+	_, err := h.client.Database.Exec(`CREATE TABLE orders (id INTEGER PRIMARY KEY)`)
+	require.NoError(t, err)
+	h.session = &session{}
+	h.session.connected(&connection.Connection{Type: _sql.SQLite, Name: "shop", Environment: "Production"})
+
+	recorder := httptest.NewRecorder()
+	h.DropTableHandler()(recorder, httptest.NewRequest(http.MethodPost, "/table/drop?name=orders", nil))
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+
+	var response struct {
+		Code string `json:"code"`
+		Data struct {
+			Production   bool   `json:"production"`
+			ConfirmToken string `json:"confirm_token"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+	assert.Equal(t, ErrCodeConfirmationRequired, response.Code)
+	assert.True(t, response.Data.Production)
+	require.NotEmpty(t, response.Data.ConfirmToken)
+
+	var count int
+	require.NoError(t, h.client.Database.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name = 'orders'`).Scan(&count))
+	assert.Equal(t, 1, count)
+
+	// query.DropTable only speaks MySQL, so the confirmed drop fails further down on SQLite,
+	// but it gets past the confirmation
+	recorder = httptest.NewRecorder()
+	h.DropTableHandler()(recorder, httptest.NewRequest(http.MethodPost,
+		"/table/drop?name=orders&allowSystem=true&confirmToken="+response.Data.ConfirmToken, nil))
+	assert.NotEqual(t, http.StatusForbidden, recorder.Code)
+	assert.NotContains(t, recorder.Body.String(), ErrCodeConfirmationRequired)
+}
+
+func TestUpdateRowsProductionRequiresConfirmation(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	h := SetupSQLiteHandler(t)
+	_, err := h.client.Database.Exec(`CREATE TABLE orders (id INTEGER PRIMARY KEY, total REAL);
+		INSERT INTO orders (total) VALUES (10), (20)`)
+	require.NoError(t, err)
+	h.session = &session{}
+	h.session.connected(&connection.Connection{Type: _sql.SQLite, Name: "shop", Environment: "Production"})
+	sum := func() float64 {
+		var total float64
+		require.NoError(t, h.client.Database.QueryRow(`SELECT SUM(total) FROM orders`).Scan(&total))
+		return total
+	}
+	var response struct {
+		Code string `json:"code"`
+		Data struct {
+			ConfirmToken string `json:"confirm_token"`
+		} `json:"data"`
+	}
+
+	update := func(confirm string) *httptest.ResponseRecorder {
+		body := strings.NewReader(`{"tableName": "orders", "set": {"total": 0}, "confirmAll": true` + confirm + `}`)
+		recorder := httptest.NewRecorder()
+		h.UpdateRowsHandler()(recorder, httptest.NewRequest(http.MethodPost, "/rows/update", body))
+		return recorder
+	}
+	recorder := update("")
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+	assert.Equal(t, ErrCodeConfirmationRequired, response.Code)
+	assert.Equal(t, float64(30), sum())
+	recorder = update(`, "allowSystem": true, "confirmToken": "` + response.Data.ConfirmToken + `"`)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Equal(t, float64(0), sum())
+
+	// so are queries deleting or updating every row
+	for _, q := range []string{"UPDATE orders SET total = 1", "DELETE FROM orders"} {
+		recorder = httptest.NewRecorder()
+		h.QueryHandler()(recorder, httptest.NewRequest(http.MethodPost, "/execute", strings.NewReader(`{"query": "`+q+`"}`)))
+		require.Equal(t, http.StatusForbidden, recorder.Code, q)
+		assert.Contains(t, recorder.Body.String(), ErrCodeConfirmationRequired, q)
+	}
+	recorder = httptest.NewRecorder()
+	h.QueryHandler()(recorder, httptest.NewRequest(http.MethodPost, "/execute", strings.NewReader(`{"query": "UPDATE orders SET total = 1 WHERE id = 1"}`)))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Equal(t, float64(1), sum())
+}
+
+func TestDropTableBumpsSchemaVersion(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	h := SetupSQLiteHandler(t)
+	h.client.Schema = _client.Schema{Name: "main"}
+	_, err := h.client.Database.Exec(`CREATE TABLE orders (id INTEGER PRIMARY KEY)`)
+	require.NoError(t, err)
+	version := func() string {
+		recorder := httptest.NewRecorder()
+		h.Versioned(h.SchemaVersionHandler())(recorder, httptest.NewRequest(http.MethodGet, "/schema/version", nil))
+		require.Equal(t, http.StatusOK, recorder.Code)
+		var response struct {
+			Data struct {
+				Version string `json:"version"`
+			} `json:"data"`
+		}
+		require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+		assert.Equal(t, response.Data.Version, recorder.Header().Get(SchemaVersionHeader))
+		return response.Data.Version
+	}
+	execute := func(sqlQuery string) {
+		body, err := json.Marshal(map[string]string{"query": sqlQuery})
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		h.QueryHandler()(recorder, httptest.NewRequest(http.MethodPost, "/execute", bytes.NewReader(body)))
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+
+	before := version()
+	require.NotEmpty(t, before)
+	recorder := httptest.NewRecorder()
+	h.Versioned(h.DropTableHandler())(recorder, httptest.NewRequest(http.MethodPost, "/table/drop?name=orders", nil))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	dropped := version()
+	assert.NotEqual(t, before, dropped)
+	// the response to the drop already carries the new version
+	assert.Equal(t, dropped, recorder.Header().Get(SchemaVersionHeader))
+
+	// a failed drop changes nothing
+	recorder = httptest.NewRecorder()
+	h.DropTableHandler()(recorder, httptest.NewRequest(http.MethodPost, "/table/drop?name=orders", nil))
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Equal(t, dropped, version())
+
+	execute(`SELECT 1`)
+	assert.Equal(t, dropped, version())
+	execute(`CREATE TABLE invoices (id INTEGER PRIMARY KEY)`)
+	assert.NotEqual(t, dropped, version())
+}
+
+func TestRefreshTableMetadata(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	h := SetupSQLiteHandler(t)
+	h.client.Schema = _client.Schema{Name: "main"}
+	_, err := h.client.Database.Exec(`CREATE TABLE orders (id INTEGER PRIMARY KEY, total REAL)`)
+	require.NoError(t, err)
+	before, err := h.client.TableFingerprint("orders")
+	require.NoError(t, err)
+
+	// a migration run by another client goes unnoticed by the cache
+	_, err = h.client.Database.Exec(`ALTER TABLE orders ADD COLUMN note TEXT`)
+	require.NoError(t, err)
+	cached, err := h.client.TableFingerprint("orders")
+	require.NoError(t, err)
+	require.Equal(t, before, cached)
+
+	refresh := func() _client.RefreshedColumnData {
+		recorder := httptest.NewRecorder()
+		h.RefreshTableMetadataHandler()(recorder, httptest.NewRequest(http.MethodPost, "/table/metadata/refresh?name=orders", nil))
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+		var response struct {
+			Data _client.RefreshedColumnData `json:"data"`
+		}
+		require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+		return response.Data
+	}
+	version := h.SchemaVersion()
+	data := refresh()
+	assert.Equal(t, "orders", data.TableName)
+	var fields []string
+	for _, column := range data.Columns {
+		fields = append(fields, column.Field)
+	}
+	assert.Equal(t, []string{"id", "total", "note"}, fields)
+	assert.NotEqual(t, before, data.Fingerprint)
+	fingerprint, err := h.client.TableFingerprint("orders")
+	require.NoError(t, err)
+	assert.Equal(t, data.Fingerprint, fingerprint)
+	assert.NotEqual(t, version, h.SchemaVersion())
+
+	// nothing changed since
+	version = h.SchemaVersion()
+	assert.Equal(t, fingerprint, refresh().Fingerprint)
+	assert.Equal(t, version, h.SchemaVersion())
+
+	recorder := httptest.NewRecorder()
+	h.RefreshTableMetadataHandler()(recorder, httptest.NewRequest(http.MethodPost, "/table/metadata/refresh", nil))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestCacheRefresh(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	h := SetupSQLiteHandler(t)
+	h.client.Schema = _client.Schema{Name: "main"}
+	_, err := h.client.Database.Exec(`CREATE TABLE orders (id INTEGER PRIMARY KEY, total REAL)`)
+	require.NoError(t, err)
+
+	refresh := func() int {
+		recorder := httptest.NewRecorder()
+		h.CacheRefreshHandler()(recorder, httptest.NewRequest(http.MethodPost, "/cache/refresh", nil))
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+		var response struct {
+			Data struct {
+				Tables  int    `json:"tables"`
+				Version string `json:"version"`
+			} `json:"data"`
+		}
+		require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+		assert.Equal(t, h.SchemaVersion(), response.Data.Version)
+		return response.Data.Tables
+	}
+	assert.Equal(t, 1, refresh())
+
+	// a table created by another client is counted once the cache is refreshed
+	_, err = h.client.Database.Exec(`CREATE TABLE customers (id INTEGER PRIMARY KEY)`)
+	require.NoError(t, err)
+	version := h.SchemaVersion()
+	assert.Equal(t, 2, refresh())
+	assert.NotEqual(t, version, h.SchemaVersion())
+
+	// a cached table altered by another client is stale until the cache is refreshed
+	var (
+		seq  int
+		name string
+		path string
+	)
+	require.NoError(t, h.client.Database.QueryRow(`PRAGMA database_list`).Scan(&seq, &name, &path))
+	other, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	defer other.Close()
+	_, err = other.Exec(`ALTER TABLE orders ADD COLUMN placed_at TEXT`)
+	require.NoError(t, err)
+
+	fields := func() []string {
+		columns, err := h.client.GetCachedColumns("main", "orders")
+		require.NoError(t, err)
+		var names []string
+		for _, column := range columns {
+			names = append(names, column.Field)
+		}
+		return names
+	}
+	assert.Equal(t, []string{"id", "total"}, fields())
+	version = h.SchemaVersion()
+	assert.Equal(t, 2, refresh())
+	assert.Equal(t, []string{"id", "total", "placed_at"}, fields())
+	assert.NotEqual(t, version, h.SchemaVersion())
+}
+
+func TestReproduction(t *testing.T) {
+	secrets := []string{"hunter2", "s3cr3t", "aws-secret-key", "sqlite-pass", "tok-123", "db-user"}
+	clients := []*_client.Client{
+		{
+			Type: _sql.PostgreSQL, Host: "db.example.com", Port: 5432, User: "db-user", Password: "hunter2", Name: "shop",
+			Schema:      _client.Schema{Name: "public"},
+			Credentials: &connection.Credentials{Provider: connection.ProviderAWSIAM, Params: map[string]string{"secretAccessKey": "aws-secret-key"}},
+		},
+		{Type: _sql.MySQL, Host: "db-user:hunter2@db.example.com", Port: 3306, User: "db-user", Password: "hunter2", Name: "shop"},
+		{Type: _sql.SQLite, Path: "/data/shop.db?_auth&_auth_user=db-user&_auth_pass=sqlite-pass"},
+	}
+	runs := []sharedRun{
+		{SQL: "SELECT * FROM users WHERE name = 'it''s' AND password = 's3cr3t'", TimeoutMs: 500},
+		{SQL: "ALTER USER 'app'@'%' IDENTIFIED WITH mysql_native_password BY 'hunter2'"},
+		{SQL: "CREATE ROLE app LOGIN ENCRYPTED PASSWORD 'hunter2'"},
+		{SQL: "SET PASSWORD FOR 'app'@'%' = PASSWORD('s3cr3t')"},
+		{SQL: "SELECT * FROM users WHERE id = :id AND api_token = :api_token", Name: "user", Params: map[string]interface{}{"id": 7, "api_token": "tok-123"}},
+	}
+
+	for _, c := range clients {
+		for _, run := range runs {
+			reproduction := newReproduction(c, "0.1.0", "http://localhost:3000", run, &query.Result{TimeMS: 12})
+			data, err := json.Marshal(reproduction)
+			require.NoError(t, err)
+			for _, secret := range secrets {
+				assert.NotContains(t, string(data), secret, "%s on %s", run.SQL, c.Type)
+			}
+			assert.Equal(t, "0.1.0", reproduction.Version)
+			assert.Equal(t, int64(12), reproduction.TimeMS)
+			assert.Equal(t, strings.ToLower(c.Type.String()), reproduction.Connection.Type)
+		}
+	}
+
+	// literals end where the database ends them
+	dialectRuns := []struct {
+		client *_client.Client
+		sql    string
+	}{
+		{clients[1], `ALTER USER 'app'@'%' IDENTIFIED BY 'p\'ssword' REPLACE 'hunter2'`},
+		{clients[1], `CREATE USER app IDENTIFIED BY "p\"ssword"`},
+		{clients[0], `ALTER ROLE app PASSWORD $$p'ssword$$`},
+		{clients[0], `ALTER ROLE app PASSWORD $pw$p'ssword$pw$ VALID UNTIL 'infinity'`},
+		{clients[0], `ALTER ROLE app PASSWORD E'p\'ssword'`},
+	}
+	for _, run := range dialectRuns {
+		reproduction := newReproduction(run.client, "0.1.0", "http://localhost:3000", sharedRun{SQL: run.sql}, nil)
+		assert.NotContains(t, reproduction.SQL, "ssword", run.sql)
+		assert.NotContains(t, reproduction.SQL, "hunter2", run.sql)
+		assert.Contains(t, reproduction.SQL, "'<redacted>'", run.sql)
+	}
+	assert.Equal(t, "SELECT replace(name, 'a', 'b') FROM users",
+		newReproduction(clients[1], "0.1.0", "http://localhost:3000", sharedRun{SQL: "SELECT replace(name, 'a', 'b') FROM users"}, nil).SQL)
+
+	reproduction := newReproduction(clients[0], "0.1.0", "http://localhost:3000/", runs[0], nil)
+	assert.Equal(t, "SELECT * FROM users WHERE name = 'it''s' AND password = '<redacted>'", reproduction.SQL)
+	assert.Equal(t, api.SharedConnection{Type: "postgresql", Host: "db.example.com", Port: 5432, Database: "shop", Schema: "public"}, reproduction.Connection)
+	assert.Equal(t, `curl -X POST 'http://localhost:3000/execute' -H 'Content-Type: application/json' `+
+		`--data-raw '{"query":"SELECT * FROM users WHERE name = '\''it'\'''\''s'\'' AND password = '\''<redacted>'\''","timeoutMs":500}'`,
+		reproduction.Curl)
+
+	reproduction = newReproduction(clients[2], "0.1.0", "http://localhost:3000", runs[4], nil)
+	assert.Equal(t, map[string]interface{}{"id": 7, "api_token": "<redacted>"}, reproduction.Params)
+	assert.Equal(t, "/data/shop.db", reproduction.Connection.Path)
+	assert.Contains(t, reproduction.Curl, `'http://localhost:3000/queries/run'`)
+	assert.Contains(t, reproduction.Curl, `{"name":"user","params":{"api_token":"<redacted>","id":7}}`)
+
+	// /execute adds the reproduction only when asked
+	h := SetupSQLiteHandler(t)
+	h.client.Password = "hunter2"
+	h.SetVersion("0.1.0")
+	execute := func(target string) api.ResultData {
+		recorder := httptest.NewRecorder()
+		h.QueryHandler()(recorder, httptest.NewRequest(http.MethodPost, target, strings.NewReader(`{"query": "SELECT 1 AS one"}`)))
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+		assert.NotContains(t, recorder.Body.String(), "hunter2")
+		var response struct {
+			Data api.ResultData `json:"data"`
+		}
+		require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+		return response.Data
+	}
+	assert.Nil(t, execute("/execute").Reproduction)
+	shared := execute("http://sqlweb.local:3000/execute?shareable=true").Reproduction
+	require.NotNil(t, shared)
+	assert.Equal(t, "SELECT 1 AS one", shared.SQL)
+	assert.Equal(t, "0.1.0", shared.Version)
+	assert.Equal(t, `curl -X POST 'http://sqlweb.local:3000/execute' -H 'Content-Type: application/json' --data-raw '{"query":"SELECT 1 AS one"}'`, shared.Curl)
+
+	// a failed run is shared too
+	recorder := httptest.NewRecorder()
+	h.QueryHandler()(recorder, httptest.NewRequest(http.MethodPost, "http://sqlweb.local:3000/execute?shareable=true",
+		strings.NewReader(`{"query": "SELECT * FROM missing WHERE password = 'hunter2'"}`)))
+	require.Equal(t, http.StatusBadRequest, recorder.Code, recorder.Body.String())
+	assert.NotContains(t, recorder.Body.String(), "hunter2")
+	var failed struct {
+		Error string `json:"error"`
+		Data  struct {
+			Reproduction api.Reproduction `json:"reproduction"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&failed))
+	assert.Contains(t, failed.Error, "no such table")
+	assert.Equal(t, "SELECT * FROM missing WHERE password = '<redacted>'", failed.Data.Reproduction.SQL)
+	assert.Contains(t, failed.Data.Reproduction.Curl, `'http://sqlweb.local:3000/execute'`)
+}
+
+func TestAttachDatabase(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	archive, err := sql.Open("sqlite3", filepath.Join(dir, "archive.db"))
+	require.NoError(t, err)
+	_, err = archive.Exec(`CREATE TABLE orders (id INTEGER PRIMARY KEY, total REAL)`)
+	require.NoError(t, err)
+	_, err = archive.Exec(`INSERT INTO orders (total) VALUES (9.5), (20)`)
+	require.NoError(t, err)
+	require.NoError(t, archive.Close())
+
+	conn := &connection.Connection{Type: _sql.SQLite, Name: "shop", Path: filepath.Join(dir, "shop.db")}
+	db, err := connection.ConnectToDatabase(conn, conn.Type.String())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = connection.Disconnect(db)
+	})
+	h := &Handler{client: &_client.Client{Type: _sql.SQLite, Database: db}, session: &session{}}
+	h.session.connected(conn)
+
+	attach := func(body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		h.AttachDatabaseHandler()(recorder, httptest.NewRequest(http.MethodPost, "/sqlite/attach", strings.NewReader(body)))
+		return recorder
+	}
+	version := h.SchemaVersion()
+	recorder := attach(fmt.Sprintf(`{"alias": "archive", "path": %q}`, filepath.Join(dir, "archive.db")))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Contains(t, recorder.Body.String(), `"archive.orders"`)
+	assert.NotEqual(t, version, h.SchemaVersion())
+	assert.Equal(t, []connection.Attachment{{Alias: "archive", Path: filepath.Join(dir, "archive.db")}}, conn.Attached)
+
+	// every connection of the pool reads the attached file
+	for i := 0; i < 3; i++ {
+		var total float64
+		require.NoError(t, db.QueryRow(`SELECT SUM(total) FROM archive.orders`).Scan(&total))
+		assert.Equal(t, 29.5, total)
+	}
+	schemas, err := h.client.GetSchemaNames()
+	require.NoError(t, err)
+	assert.Contains(t, schemas, "archive")
+	tables, err := h.client.ListTables()
+	require.NoError(t, err)
+	assert.Contains(t, tables, _client.TableInfo{Name: "archive.orders"})
+	table, err := h.client.GetTable("ARCHIVE.Orders", 1, 10)
+	require.NoError(t, err)
+	assert.Equal(t, "archive.orders", table.Name)
+	assert.Equal(t, 2, table.N_rows)
+	assert.Len(t, table.Columns, 2)
+
+	// the alias is taken, and a missing file is not created
+	assert.Equal(t, http.StatusBadRequest, attach(fmt.Sprintf(`{"alias": "archive", "path": %q}`, filepath.Join(dir, "archive.db"))).Code)
+	assert.Equal(t, http.StatusBadRequest, attach(fmt.Sprintf(`{"alias": "other", "path": %q}`, filepath.Join(dir, "missing.db"))).Code)
+	assert.NoFileExists(t, filepath.Join(dir, "missing.db"))
+
+	recorder = httptest.NewRecorder()
+	h.DetachDatabaseHandler()(recorder, httptest.NewRequest(http.MethodPost, "/sqlite/detach?name=archive", nil))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Empty(t, conn.Attached)
+	_, err = db.Exec(`SELECT * FROM archive.orders`)
+	assert.Error(t, err)
+}
+
+func TestDropTableConfirmation(t *testing.T) {
+	h := SetupSQLiteHandler(t)
+	h.session = &session{}
+	h.session.connected(&connection.Connection{Type: _sql.SQLite, Name: "shop", Environment: "staging"})
+
+	// without the global setting, only production connections need confirmation
+	recorder := httptest.NewRecorder()
+	h.DropTableHandler()(recorder, httptest.NewRequest(http.MethodPost, "/table/drop?name=a", nil))
+	assert.NotContains(t, recorder.Body.String(), ErrCodeConfirmationRequired)
+
+	h.SetConfirmDestructive(true)
+	recorder = httptest.NewRecorder()
+	h.DropTableHandler()(recorder, httptest.NewRequest(http.MethodPost, "/table/drop?name=b", nil))
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), ErrCodeConfirmationRequired)
+
+	recorder = httptest.NewRecorder()
+	h.QueryHandler()(recorder, httptest.NewRequest(http.MethodPost, "/execute", strings.NewReader(`{"query": "DROP TABLE b"}`)))
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), ErrCodeConfirmationRequired)
+}
+
+func putChunk(h *Handler, id string, offset int, chunk string) *httptest.ResponseRecorder {
+	sum := sha256.Sum256([]byte(chunk))
+	target := fmt.Sprintf("/upload/chunk?id=%s&offset=%d&sha256=%s", id, offset, hex.EncodeToString(sum[:]))
+	recorder := httptest.NewRecorder()
+	h.UploadChunkHandler()(recorder, httptest.NewRequest(http.MethodPut, target, strings.NewReader(chunk)))
+	return recorder
+}
+
+func TestChunkedUploadImport(t *testing.T) {
+	h := SetupSQLiteHandler(t)
+	h.uploads = newUploads()
+	t.Cleanup(func() {
+		_ = h.CloseUploads()
+	})
+	script := "CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT);\nINSERT INTO people (name) VALUES ('ada'), ('linus');\n"
+	first, second := script[:40], script[40:]
+
+	recorder := httptest.NewRecorder()
+	body := strings.NewReader(fmt.Sprintf(`{"size": %d, "pipeline": "sql"}`, len(script)))
+	h.UploadInitHandler()(recorder, httptest.NewRequest(http.MethodPost, "/upload/init", body))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var started struct {
+		Data UploadStatus `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&started))
+	id := started.Data.ID
+	require.NotEmpty(t, id)
+
+	require.Equal(t, http.StatusOK, putChunk(h, id, 0, first).Code)
+
+	// a corrupted chunk is not committed
+	sum := sha256.Sum256([]byte(second))
+	recorder = httptest.NewRecorder()
+	h.UploadChunkHandler()(recorder, httptest.NewRequest(http.MethodPut,
+		fmt.Sprintf("/upload/chunk?id=%s&offset=40&sha256=%s", id, hex.EncodeToString(sum[:])), strings.NewReader(strings.ToUpper(second))))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	// a chunk sent twice is refused with the committed offset
+	recorder = putChunk(h, id, 0, first)
+	require.Equal(t, http.StatusConflict, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), ErrCodeUploadOffset)
+
+	// completing early is refused, and the status tells where to resume
+	recorder = httptest.NewRecorder()
+	h.UploadCompleteHandler()(recorder, httptest.NewRequest(http.MethodPost, "/upload/complete", strings.NewReader(`{"id": "`+id+`"}`)))
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	h.UploadStatusHandler()(recorder, httptest.NewRequest(http.MethodGet, "/upload/status?id="+id, nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var status struct {
+		Data UploadStatus `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&status))
+	assert.Equal(t, int64(40), status.Data.Offset)
+
+	require.Equal(t, http.StatusOK, putChunk(h, id, 40, second).Code)
+	recorder = httptest.NewRecorder()
+	h.UploadCompleteHandler()(recorder, httptest.NewRequest(http.MethodPost, "/upload/complete", strings.NewReader(`{"id": "`+id+`"}`)))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	var count int
+	require.NoError(t, h.client.Database.QueryRow(`SELECT COUNT(*) FROM people`).Scan(&count))
+	assert.Equal(t, 2, count)
+
+	// the upload is gone once imported
+	recorder = httptest.NewRecorder()
+	h.UploadStatusHandler()(recorder, httptest.NewRequest(http.MethodGet, "/upload/status?id="+id, nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+// startUpload starts an upload of the given size to the sql pipeline and returns its id.
+func startUpload(t *testing.T, h *Handler, size int) string {
+	recorder := httptest.NewRecorder()
+	body := strings.NewReader(fmt.Sprintf(`{"size": %d, "pipeline": "sql"}`, size))
+	h.UploadInitHandler()(recorder, httptest.NewRequest(http.MethodPost, "/upload/init", body))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var started struct {
+		Data UploadStatus `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&started))
+	return started.Data.ID
+}
+
+func TestUploadSizeCap(t *testing.T) {
+	h := SetupSQLiteHandler(t)
+	h.uploads = newUploads()
+	h.uploads.max = 64
+	t.Cleanup(func() {
+		_ = h.CloseUploads()
+	})
+
+	recorder := httptest.NewRecorder()
+	h.UploadInitHandler()(recorder, httptest.NewRequest(http.MethodPost, "/upload/init", strings.NewReader(`{"size": 65, "pipeline": "sql"}`)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+
+	// an upload of unknown size is capped all the same
+	id := startUpload(t, h, 0)
+	chunk := strings.Repeat("SELECT 1;\n", 5)
+	require.Equal(t, http.StatusOK, putChunk(h, id, 0, chunk).Code)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, putChunk(h, id, len(chunk), chunk).Code)
+	require.Equal(t, http.StatusOK, putChunk(h, id, len(chunk), "SELECT 2;").Code)
+}
+
+func TestFailedImportKeepsUpload(t *testing.T) {
+	h := SetupSQLiteHandler(t)
+	h.uploads = newUploads()
+	t.Cleanup(func() {
+		_ = h.CloseUploads()
+	})
+	script := "CREATE TABLE IF NOT EXISTS tags (name TEXT);\nINSERT INTO tags (name) VALUES ('a;b');\nINSERT INTO labels (name) VALUES ('c');\n"
+
+	id := startUpload(t, h, len(script))
+	require.Equal(t, http.StatusOK, putChunk(h, id, 0, script).Code)
+	recorder := httptest.NewRecorder()
+	h.UploadCompleteHandler()(recorder, httptest.NewRequest(http.MethodPost, "/upload/complete", strings.NewReader(`{"id": "`+id+`"}`)))
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "statement 3")
+
+	// the statements before the failure ran, and the upload is kept to be completed again
+	var count int
+	require.NoError(t, h.client.Database.QueryRow(`SELECT COUNT(*) FROM tags`).Scan(&count))
+	assert.Equal(t, 1, count)
+	recorder = httptest.NewRecorder()
+	h.UploadStatusHandler()(recorder, httptest.NewRequest(http.MethodGet, "/upload/status?id="+id, nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	_, err := h.client.Database.Exec(`CREATE TABLE labels (name TEXT)`)
+	require.NoError(t, err)
+	recorder = httptest.NewRecorder()
+	h.UploadCompleteHandler()(recorder, httptest.NewRequest(http.MethodPost, "/upload/complete", strings.NewReader(`{"id": "`+id+`"}`)))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	require.NoError(t, h.client.Database.QueryRow(`SELECT COUNT(*) FROM tags`).Scan(&count))
+	assert.Equal(t, 2, count)
+}
+
+func TestUploadsExpire(t *testing.T) {
+	u := newUploads()
+	t.Cleanup(func() {
+		_ = u.close()
+	})
+	now := time.Now()
+	u.now = func() time.Time { return now }
+
+	up, err := u.create(0, "sql")
+	require.NoError(t, err)
+	require.FileExists(t, up.path)
+
+	now = now.Add(uploadTTL + time.Second)
+	u.sweep()
+	assert.Nil(t, u.get(up.status.ID))
+	assert.NoFileExists(t, up.path)
+
+	up, err = u.create(0, "sql")
+	require.NoError(t, err)
+	dir := u.dir
+	require.NoError(t, u.close())
+	assert.NoFileExists(t, up.path)
+	assert.NoDirExists(t, dir)
+}
+
+func TestUploadsAreCapped(t *testing.T) {
+	h := NewHandler()
+	t.Cleanup(func() {
+		_ = h.uploads.close()
+	})
+	h.uploads.maxSessions, h.uploads.maxReserved = 2, 100
+	now := time.Now()
+	h.uploads.now = func() time.Time { return now }
+	initUpload := func(size int) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		body := strings.NewReader(fmt.Sprintf(`{"size": %d, "pipeline": "sql"}`, size))
+		h.UploadInitHandler()(recorder, httptest.NewRequest(http.MethodPost, "/upload/init", body))
+		return recorder
+	}
+
+	require.Equal(t, http.StatusOK, initUpload(60).Code)
+	recorder := initUpload(50)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), util.ErrUploadReserve.Error())
+	require.Equal(t, http.StatusOK, initUpload(40).Code)
+	recorder = initUpload(1)
+	assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), util.ErrTooManyUploads.Error())
+
+	// expired uploads free their place
+	now = now.Add(uploadTTL + time.Second)
+	assert.Equal(t, http.StatusOK, initUpload(100).Code)
+}
+
+func TestFormatHandler(t *testing.T) {
+	h := NewHandler()
+	recorder := httptest.NewRecorder()
+	body := strings.NewReader(`{"query": "select a, b from t where a = 1"}`)
+	h.FormatHandler()(recorder, httptest.NewRequest(http.MethodPost, "/format", body))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var response struct {
+		Data struct {
+			Query string `json:"query"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+	assert.Equal(t, "SELECT\n  a,\n  b\nFROM\n  t\nWHERE\n  a = 1", response.Data.Query)
+
+	recorder = httptest.NewRecorder()
+	h.FormatHandler()(recorder, httptest.NewRequest(http.MethodPost, "/format", strings.NewReader(`{"query": " "}`)))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestValidateHandlerSyntaxError(t *testing.T) {
+	h := SetupSQLiteHandler(t)
+	recorder := httptest.NewRecorder()
+	body := strings.NewReader(`{"query": "SELEC 1"}`)
+	h.ValidateHandler()(recorder, httptest.NewRequest(http.MethodPost, "/validate", body))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var response struct {
+		Data query.Validation `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+	assert.False(t, response.Data.Valid)
+	assert.Contains(t, response.Data.Error, "syntax error")
+	assert.Equal(t, 1, response.Data.Position)
+}
+
+func TestValidateHandlerGuarded(t *testing.T) {
+	h := SetupSQLiteHandler(t)
+	recorder := httptest.NewRecorder()
+	h.ValidateHandler()(recorder, httptest.NewRequest(http.MethodPost, "/validate",
+		strings.NewReader(`{"query": "SELECT 1; DROP TABLE people"}`)))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), util.ErrSingleStatement.Error())
+
+	h.SetReadOnly(true)
+	recorder = httptest.NewRecorder()
+	h.ValidateHandler()(recorder, httptest.NewRequest(http.MethodPost, "/validate",
+		strings.NewReader(`{"query": "DELETE FROM people"}`)))
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), util.ErrReadOnly.Error())
+}
+
+// paginatedResponse decodes a response envelope, keeping its data raw.
+func paginatedResponse(t *testing.T, recorder *httptest.ResponseRecorder) (json.RawMessage, *api.Pagination) {
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var response struct {
+		Data       json.RawMessage `json:"data"`
+		Pagination *api.Pagination `json:"pagination"`
+	}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+	return response.Data, response.Pagination
+}
+
+func TestTableDataPagination(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	h := SetupSQLiteHandler(t)
+	_, err := h.client.Database.Exec(`CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT)`)
+	require.NoError(t, err)
+	_, err = h.client.Database.Exec(`INSERT INTO people (name) VALUES ('ada'), ('grace'), ('linus'), ('ken'), ('dennis')`)
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	h.TableDataHandler()(recorder, httptest.NewRequest(http.MethodGet, "/table?name=people&page=2&perPage=2", nil))
+	data, pagination := paginatedResponse(t, recorder)
+	assert.Equal(t, &api.Pagination{Page: 2, PerPage: 2, TotalRows: 5, TotalPages: 3, HasMore: true}, pagination)
+	var legacy map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(data, &legacy))
+	assert.JSONEq(t, "5", string(legacy["total_rows"]))
+	assert.JSONEq(t, "3", string(legacy["total_pages"]))
+
+	h.SetLegacyPagination(false)
+	recorder = httptest.NewRecorder()
+	h.TableDataHandler()(recorder, httptest.NewRequest(http.MethodGet, "/table?name=people&page=3&perPage=2", nil))
+	data, pagination = paginatedResponse(t, recorder)
+	assert.Equal(t, &api.Pagination{Page: 3, PerPage: 2, TotalRows: 5, TotalPages: 3, HasMore: false}, pagination)
+	var current map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(data, &current))
+	assert.Contains(t, current, "table")
+	assert.NotContains(t, current, "total_rows")
+	assert.NotContains(t, current, "total_pages")
+}
+
+func TestTableDataSearch(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	h := SetupSQLiteHandler(t)
+	_, err := h.client.Database.Exec(`CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT)`)
+	require.NoError(t, err)
+	_, err = h.client.Database.Exec(`INSERT INTO people (name) VALUES ('ada'), ('grace'), ('linus'), ('ken'), ('dennis')`)
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	h.TableDataHandler()(recorder, httptest.NewRequest(http.MethodGet, "/table?name=people&page=1&perPage=1&search=n", nil))
+	data, pagination := paginatedResponse(t, recorder)
+	assert.Equal(t, &api.Pagination{Page: 1, PerPage: 1, TotalRows: 3, TotalPages: 3, HasMore: true}, pagination)
+	var page struct {
+		Table _client.Table `json:"table"`
+	}
+	require.NoError(t, json.Unmarshal(data, &page))
+	assert.Equal(t, &_client.Search{Query: "n", Strategy: _client.SearchLike, Matches: 3}, page.Table.Search)
+	require.Len(t, page.Table.Data, 1)
+	assert.Equal(t, "linus", page.Table.Data[0]["name"])
+}
+
+func TestResultSizeLimit(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	h := SetupSQLiteHandler(t)
+	h.client.Cells = _client.CellLimit{MaxResultBytes: 4 << 10}
+	_, err := h.client.Database.Exec(`CREATE TABLE logs (id INTEGER PRIMARY KEY, line TEXT)`)
+	require.NoError(t, err)
+	_, err = h.client.Database.Exec(`WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 200)
+		INSERT INTO logs (line) SELECT printf('%0100d', i) FROM n`)
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	h.QueryHandler()(recorder, httptest.NewRequest(http.MethodPost, "/execute", strings.NewReader(`{"query": "SELECT * FROM logs"}`)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), ErrCodeResultTooLarge)
+
+	recorder = httptest.NewRecorder()
+	h.QueryHandler()(recorder, httptest.NewRequest(http.MethodPost, "/execute", strings.NewReader(`{"query": "SELECT * FROM logs LIMIT 10"}`)))
+	assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	recorder = httptest.NewRecorder()
+	h.TableDataHandler()(recorder, httptest.NewRequest(http.MethodGet, "/table?name=logs&page=1&perPage=200&compact=true", nil))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), ErrCodeResultTooLarge)
+
+	// exports are not bounded
+	recorder = httptest.NewRecorder()
+	h.ExportTableToCSV()(recorder, httptest.NewRequest(http.MethodGet, "/export/csv?name=logs", nil))
+	assert.Equal(t, http.StatusAccepted, recorder.Code)
+}
+
+func TestQueryHistoryPagination(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	h := SetupSQLiteHandler(t)
+	for i := 0; i < 3; i++ {
+		body := strings.NewReader(fmt.Sprintf(`{"query": "SELECT %d"}`, i))
+		recorder := httptest.NewRecorder()
+		h.QueryHandler()(recorder, httptest.NewRequest(http.MethodPost, "/execute", body))
+		require.Equal(t, http.StatusOK, recorder.Code)
+	}
+
+	recorder := httptest.NewRecorder()
+	h.QueryHistoryHandler()(recorder, httptest.NewRequest(http.MethodGet, "/queries/history?page=1&perPage=2", nil))
+	data, pagination := paginatedResponse(t, recorder)
+	assert.Equal(t, &api.Pagination{Page: 1, PerPage: 2, TotalRows: 3, TotalPages: 2, HasMore: true}, pagination)
+	var page struct {
+		History []config.QueryHistoryEntry `json:"history"`
+	}
+	require.NoError(t, json.Unmarshal(data, &page))
+	require.Len(t, page.History, 2)
+	assert.Equal(t, "SELECT 2", page.History[0].Query)
+
+	// without page and perPage the whole history is returned
+	recorder = httptest.NewRecorder()
+	h.QueryHistoryHandler()(recorder, httptest.NewRequest(http.MethodGet, "/queries/history", nil))
+	data, pagination = paginatedResponse(t, recorder)
+	assert.Nil(t, pagination)
+	require.NoError(t, json.Unmarshal(data, &page))
+	assert.Len(t, page.History, 3)
+
+	recorder = httptest.NewRecorder()
+	h.QueryHistoryHandler()(recorder, httptest.NewRequest(http.MethodGet, "/queries/history?page=0&perPage=2", nil))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestSavedConnectionsPagination(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	h := SetupSQLiteHandler(t)
+	for _, name := range []string{"first", "second", "third"} {
+		_, err := config.WriteToFile(config.NewConnectionConfig(name, &connection.Connection{Type: _sql.SQLite, Name: name}))
+		require.NoError(t, err)
+	}
+
+	recorder := httptest.NewRecorder()
+	h.SavedConnectionsHandler()(recorder, httptest.NewRequest(http.MethodGet, "/saved/connections?page=2&perPage=2", nil))
+	data, pagination := paginatedResponse(t, recorder)
+	assert.Equal(t, &api.Pagination{Page: 2, PerPage: 2, TotalRows: 3, TotalPages: 2, HasMore: false}, pagination)
+	var connections []connection.Connection
+	require.NoError(t, json.Unmarshal(data, &connections))
+	require.Len(t, connections, 1)
+	assert.Equal(t, "third", connections[0].Name)
+
+	// a page past the end is empty
+	recorder = httptest.NewRecorder()
+	h.SavedConnectionsHandler()(recorder, httptest.NewRequest(http.MethodGet, "/saved/connections?page=5&perPage=2", nil))
+	data, pagination = paginatedResponse(t, recorder)
+	assert.Equal(t, 5, pagination.Page)
+	assert.False(t, pagination.HasMore)
+	require.NoError(t, json.Unmarshal(data, &connections))
+	assert.Empty(t, connections)
+}
+
+func TestConnectSavedRecordsLastUsed(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	saved := &connection.Connection{Type: _sql.SQLite, Name: "shop", Path: filepath.Join(t.TempDir(), "shop.db")}
+	_, err := config.WriteToFile(config.NewConnectionConfig(saved.Name, saved))
+	require.NoError(t, err)
+	read, err := config.ReadFromFile("shop")
+	require.NoError(t, err)
+	require.Nil(t, read.LastUsedAt)
+
+	h := NewHandler()
+	t.Cleanup(func() { _ = h.GetDB().Close() })
+	before := time.Now()
+	recorder := httptest.NewRecorder()
+	h.ConnectSavedHandler()(recorder, httptest.NewRequest(http.MethodPost, "/connect/saved?key=shop", nil))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	read, err = config.ReadFromFile("shop")
+	require.NoError(t, err)
+	require.NotNil(t, read.LastUsedAt)
+	assert.False(t, read.LastUsedAt.Before(before))
+
+	// the saved connections carry it
+	recorder = httptest.NewRecorder()
+	h.SavedConnectionsHandler()(recorder, httptest.NewRequest(http.MethodGet, "/saved/connections", nil))
+	var response struct {
+		Data []map[string]interface{} `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+	require.Len(t, response.Data, 1)
+	assert.Contains(t, response.Data[0], "lastUsedAt")
+
+	recorder = httptest.NewRecorder()
+	h.ConnectSavedHandler()(recorder, httptest.NewRequest(http.MethodPost, "/connect/saved?key=missing", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestCompressedUploadImport(t *testing.T) {
+	h := SetupSQLiteHandler(t)
+	h.uploads = newUploads()
+	t.Cleanup(func() {
+		_ = h.CloseUploads()
+	})
+	script := "CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT);\nINSERT INTO people (name) VALUES ('ada'), ('linus');\n"
+	up, err := h.uploads.create(int64(len(script)), "sql")
+	require.NoError(t, err)
+	id := up.status.ID
+
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	_, err = zw.Write([]byte(script))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	sum := sha256.Sum256([]byte(script))
+	target := fmt.Sprintf("/upload/chunk?id=%s&offset=0&sha256=%s", id, hex.EncodeToString(sum[:]))
+
+	// a corrupt body or an unknown encoding is refused and nothing is committed
+	request := httptest.NewRequest(http.MethodPut, target, bytes.NewReader(compressed.Bytes()[:compressed.Len()-8]))
+	request.Header.Set("Content-Encoding", "gzip")
+	recorder := httptest.NewRecorder()
+	h.UploadChunkHandler()(recorder, request)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "Corrupt compressed chunk")
+
+	request = httptest.NewRequest(http.MethodPut, target, strings.NewReader("not gzip"))
+	request.Header.Set("Content-Encoding", "gzip")
+	recorder = httptest.NewRecorder()
+	h.UploadChunkHandler()(recorder, request)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	request = httptest.NewRequest(http.MethodPut, target, bytes.NewReader(compressed.Bytes()))
+	request.Header.Set("Content-Encoding", "br")
+	recorder = httptest.NewRecorder()
+	h.UploadChunkHandler()(recorder, request)
+	assert.Equal(t, http.StatusUnsupportedMediaType, recorder.Code)
+	assert.Equal(t, int64(0), up.status.Offset)
+
+	request = httptest.NewRequest(http.MethodPut, target, bytes.NewReader(compressed.Bytes()))
+	request.Header.Set("Content-Encoding", "gzip")
+	recorder = httptest.NewRecorder()
+	h.UploadChunkHandler()(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Equal(t, int64(len(script)), up.status.Offset)
+
+	recorder = httptest.NewRecorder()
+	h.UploadCompleteHandler()(recorder, httptest.NewRequest(http.MethodPost, "/upload/complete", strings.NewReader(`{"id": "`+id+`"}`)))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var count int
+	require.NoError(t, h.client.Database.QueryRow(`SELECT COUNT(*) FROM people`).Scan(&count))
+	assert.Equal(t, 2, count)
+}
+
+func TestImportConnectionsDeflate(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	h := SetupSQLiteHandler(t)
+
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	_, err := zw.Write([]byte(`[{"database": "notes", "databaseType": "sqlite", "path": "/tmp/notes.db"}]`))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	request := httptest.NewRequest(http.MethodPost, "/connections/import", &compressed)
+	request.Header.Set("Content-Encoding", "deflate")
+	recorder := httptest.NewRecorder()
+	h.ImportConnectionsHandler()(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	read, err := config.ReadFromFile("notes")
+	require.NoError(t, err)
+	assert.Equal(t, "/tmp/notes.db", read.Path)
+}
+
+func TestImportConnectionsDecodedCap(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	h := SetupSQLiteHandler(t)
+
+	// a small body expanding past the cap once decoded is refused
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	_, err := zw.Write(bytes.Repeat([]byte(" "), maxChunkSize+1))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	require.Less(t, compressed.Len(), 1<<20)
+
+	request := httptest.NewRequest(http.MethodPost, "/connections/import", &compressed)
+	request.Header.Set("Content-Encoding", "deflate")
+	recorder := httptest.NewRecorder()
+	h.ImportConnectionsHandler()(recorder, request)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "too large")
+}
+
+func TestImportConnectionsHandler(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	saved := &connection.Connection{Type: _sql.SQLite, Name: "shop", Path: "/tmp/shop.db"}
+	_, err := config.WriteToFile(config.NewConnectionConfig(saved.Name, saved))
+	require.NoError(t, err)
+	h := SetupSQLiteHandler(t)
+
+	body := strings.NewReader(`[
+		{"database": "shop", "databaseType": "sqlite", "path": "/tmp/other.db"},
+		{"database": "notes", "databaseType": "sqlite", "path": "/tmp/notes.db"}
+	]`)
+	recorder := httptest.NewRecorder()
+	h.ImportConnectionsHandler()(recorder, httptest.NewRequest(http.MethodPost, "/connections/import", body))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var response struct {
+		Data config.ImportResult `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+	assert.Equal(t, []string{"notes"}, response.Data.Added)
+	assert.Equal(t, []config.SkippedImport{{Key: "shop", Reason: "already saved"}}, response.Data.Skipped)
+
+	read, err := config.ReadFromFile("shop")
+	require.NoError(t, err)
+	assert.Equal(t, "/tmp/shop.db", read.Path)
+
+	recorder = httptest.NewRecorder()
+	h.ImportConnectionsHandler()(recorder, httptest.NewRequest(http.MethodPost, "/connections/import", strings.NewReader(`not json`)))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestExportTemplateHandlers(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	h := SetupSQLiteHandler(t)
+	_, err := h.client.Database.Exec(`CREATE TABLE orders (id INTEGER PRIMARY KEY, item TEXT, qty INTEGER)`)
+	require.NoError(t, err)
+	_, err = h.client.Database.Exec(`INSERT INTO orders VALUES (1, 'pen', 2), (2, 'ink', 1), (3, 'pad', 5)`)
+	require.NoError(t, err)
+
+	body := strings.NewReader(`{"name": "bulk", "table": "orders", "format": "CSV",
+		"columns": [{"source": "item", "header": "Item"}, {"source": "qty", "header": "Quantity"}],
+		"filter": [{"column": "qty", "operator": ">", "value": 1}]}`)
+	recorder := httptest.NewRecorder()
+	h.SaveExportTemplateHandler()(recorder, httptest.NewRequest(http.MethodPost, "/export/templates/save", body))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	recorder = httptest.NewRecorder()
+	body = strings.NewReader(`{"name": "bad", "table": "orders", "format": "xml", "columns": [{"source": "id"}]}`)
+	h.SaveExportTemplateHandler()(recorder, httptest.NewRequest(http.MethodPost, "/export/templates/save", body))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	h.ExportTemplatesHandler()(recorder, httptest.NewRequest(http.MethodGet, "/export/templates", nil))
+	var response struct {
+		Data []_client.ExportTemplate `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+	require.Len(t, response.Data, 1)
+	assert.Equal(t, "csv", response.Data[0].Format)
+
+	recorder = httptest.NewRecorder()
+	h.RunExportTemplateHandler()(recorder, httptest.NewRequest(http.MethodGet, "/export/templates/run?name=bulk", nil))
+	assert.Equal(t, http.StatusAccepted, recorder.Code)
+	assert.Equal(t, `attachment; filename="bulk.csv"`, recorder.Header().Get("Content-Disposition"))
+	assert.Equal(t, "Item,Quantity\npen,2\npad,5\n", recorder.Body.String())
+
+	_, err = h.client.Database.Exec(`ALTER TABLE orders DROP COLUMN qty`)
+	require.NoError(t, err)
+	recorder = httptest.NewRecorder()
+	h.RunExportTemplateHandler()(recorder, httptest.NewRequest(http.MethodGet, "/export/templates/run?name=bulk", nil))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `column \"qty\" no longer exists in table \"orders\"`)
+
+	recorder = httptest.NewRecorder()
+	h.DeleteExportTemplateHandler()(recorder, httptest.NewRequest(http.MethodPost, "/export/templates/delete?name=bulk", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	recorder = httptest.NewRecorder()
+	h.RunExportTemplateHandler()(recorder, httptest.NewRequest(http.MethodGet, "/export/templates/run?name=bulk", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestExportTemplateProgress(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	h := SetupSQLiteHandler(t)
+	_, err := h.client.Database.Exec(`CREATE TABLE events (id INTEGER PRIMARY KEY, name TEXT);
+		WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 12000)
+		INSERT INTO events (name) SELECT printf('event %05d', i) FROM n;
+		CREATE TABLE tags (id INTEGER PRIMARY KEY, name TEXT);
+		INSERT INTO tags (name) VALUES ('a'), ('b')`)
+	require.NoError(t, err)
+	for _, template := range []string{
+		`{"name": "events", "table": "events", "format": "csv", "columns": [{"source": "name"}]}`,
+		`{"name": "tags", "table": "tags", "format": "csv", "columns": [{"source": "name"}]}`,
+	} {
+		recorder := httptest.NewRecorder()
+		h.SaveExportTemplateHandler()(recorder, httptest.NewRequest(http.MethodPost, "/export/templates/save", strings.NewReader(template)))
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+	run := func(query string) *http.Response {
+		recorder := httptest.NewRecorder()
+		h.RunExportTemplateHandler()(recorder, httptest.NewRequest(http.MethodGet, "/export/templates/run?"+query, nil))
+		require.Equal(t, http.StatusAccepted, recorder.Code, recorder.Body.String())
+		return recorder.Result()
+	}
+
+	// without statistics there is nothing to estimate from
+	response := run("name=events")
+	assert.Empty(t, response.Header.Get(expectedRowsHeader))
+	assert.Empty(t, response.Header.Get(estimatedBytesHeader))
+	unsampled, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "12000", response.Trailer.Get(exportedRowsTrailer))
+
+	_, err = h.client.Database.Exec(`ANALYZE`)
+	require.NoError(t, err)
+	response = run("name=events")
+	assert.Equal(t, "12000", response.Header.Get(expectedRowsHeader))
+	estimated, err := strconv.Atoi(response.Header.Get(estimatedBytesHeader))
+	require.NoError(t, err)
+	sampled, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	assert.Equal(t, unsampled, sampled, "sampling must not change the download")
+	assert.InEpsilon(t, len(sampled), estimated, 0.01)
+	assert.Equal(t, "12000", response.Trailer.Get(exportedRowsTrailer))
+
+	// a download smaller than the sample is sent with its exact size
+	response = run("name=tags")
+	data, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "name\na\nb\n", string(data))
+	assert.Equal(t, "2", response.Header.Get(expectedRowsHeader))
+	assert.Equal(t, strconv.Itoa(len(data)), response.Header.Get(estimatedBytesHeader))
+
+	response = run("name=events&progressComments=true")
+	data, err = io.ReadAll(response.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "\nevent 10000\n# 10000 rows exported\nevent 10001\n")
+	assert.Equal(t, 1, strings.Count(string(data), "#"))
+}
+
+// flushRecorder counts the flushes of a download.
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	flushes int
+}
+
+func (r *flushRecorder) Flush() {
+	r.flushes++
+	r.ResponseRecorder.Flush()
+}
+
+// setupStreamedExport creates a table of the given number of rows and a CSV export template of it, "events".
+func setupStreamedExport(tb testing.TB, rows int) *Handler {
+	tb.Setenv("XDG_CONFIG_HOME", tb.TempDir())
+	tb.Setenv("HOME", tb.TempDir())
+	h := SetupSQLiteHandler(tb)
+	_, err := h.client.Database.Exec(fmt.Sprintf(`CREATE TABLE events (id INTEGER PRIMARY KEY, name TEXT);
+		WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < %d)
+		INSERT INTO events (name) SELECT printf('event %%05d', i) FROM n`, rows))
+	require.NoError(tb, err)
+	recorder := httptest.NewRecorder()
+	h.SaveExportTemplateHandler()(recorder, httptest.NewRequest(http.MethodPost, "/export/templates/save",
+		strings.NewReader(`{"name": "events", "table": "events", "format": "csv", "columns": [{"source": "id"}, {"source": "name"}]}`)))
+	require.Equal(tb, http.StatusOK, recorder.Code, recorder.Body.String())
+	return h
+}
+
+func TestExportTemplateBatches(t *testing.T) {
+	h := setupStreamedExport(t, 250)
+	run := func(batch int) *flushRecorder {
+		h.client.Settings.StreamBatchRows = batch
+		recorder := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+		h.RunExportTemplateHandler()(recorder, httptest.NewRequest(http.MethodGet, "/export/templates/run?name=events", nil))
+		require.Equal(t, http.StatusAccepted, recorder.Code, recorder.Body.String())
+		assert.Equal(t, "250", recorder.Result().Trailer.Get(exportedRowsTrailer))
+		return recorder
+	}
+
+	// every batch is flushed, and what is left once the export is done
+	rowByRow := run(1)
+	assert.Equal(t, 251, rowByRow.flushes)
+	batched := run(0)
+	assert.Equal(t, 3, batched.flushes)
+	assert.Equal(t, rowByRow.Body.String(), batched.Body.String())
+	batched = run(1000)
+	assert.Equal(t, 1, batched.flushes)
+	assert.Equal(t, rowByRow.Body.String(), batched.Body.String())
+}
+
+// BenchmarkStreamBatchRows streams an export to a client over HTTP with rows sent by batches of different sizes.
+func BenchmarkStreamBatchRows(b *testing.B) {
+	const rows = 20000
+	h := setupStreamedExport(b, rows)
+	server := httptest.NewServer(h.RunExportTemplateHandler())
+	defer server.Close()
+
+	for _, batch := range []int{1, 10, 100, 1000} {
+		b.Run(fmt.Sprintf("batch=%d", batch), func(b *testing.B) {
+			h.client.Settings.StreamBatchRows = batch
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				response, err := http.Get(server.URL + "?name=events")
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err = io.Copy(io.Discard, response.Body); err != nil {
+					b.Fatal(err)
+				}
+				response.Body.Close()
+			}
+			b.ReportMetric(float64(rows*b.N)/b.Elapsed().Seconds(), "rows/s")
+		})
+	}
+}
+
+func TestTestConnectionsHandler(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "shop.db"))
+	require.NoError(t, err)
+	_, err = db.Exec(`CREATE TABLE items (id INTEGER PRIMARY KEY)`)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	saved := []*connection.Connection{
+		{Type: _sql.SQLite, Name: "shop", Path: filepath.Join(dir, "shop.db")},
+		{Type: _sql.SQLite, Name: "gone", Path: filepath.Join(dir, "gone.db")},
+		{Type: _sql.PostgreSQL, Name: "remote", Host: "127.0.0.1", Port: 1, User: "app"},
+	}
+	for _, conn := range saved {
+		_, err = config.WriteToFile(config.NewConnectionConfig(conn.Name, conn))
+		require.NoError(t, err)
+	}
+	h := SetupSQLiteHandler(t)
+	active := h.client
+
+	recorder := httptest.NewRecorder()
+	h.TestConnectionsHandler()(recorder, httptest.NewRequest(http.MethodGet, "/connections/test?timeout=2s", nil))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var response struct {
+		Message string        `json:"message"`
+		Data    []ProbeResult `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+	require.Len(t, response.Data, 3)
+	assert.Equal(t, "1 of 3 saved connections reachable", response.Message)
+	assert.Equal(t, "shop", response.Data[0].Key)
+	assert.True(t, response.Data[0].Reachable)
+	assert.Empty(t, response.Data[0].Error)
+	assert.False(t, response.Data[1].Reachable)
+	assert.NoFileExists(t, filepath.Join(dir, "gone.db"))
+	assert.False(t, response.Data[2].Reachable)
+	assert.NotEmpty(t, response.Data[2].Error)
+	assert.Same(t, active, h.client)
+
+	recorder = httptest.NewRecorder()
+	h.TestConnectionsHandler()(recorder, httptest.NewRequest(http.MethodGet, "/connections/test?timeout=soon", nil))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestSQLiteConcurrentReadsAndWrites(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "shop.db")
+	h := NewHandler()
+	require.NoError(t, h.open(&connection.Connection{Type: _sql.SQLite, Name: "shop", Path: path}))
+	t.Cleanup(func() { _ = h.GetDB().Close() })
+	_, err := h.client.Database.Exec(`CREATE TABLE items (id INTEGER PRIMARY KEY, qty INTEGER)`)
+	require.NoError(t, err)
+	for i := 1; i <= 20; i++ {
+		_, err = h.client.Database.Exec(`INSERT INTO items VALUES (?, 0)`, i)
+		require.NoError(t, err)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		failures = make(chan string, 80)
+	)
+	for w := 0; w < 4; w++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				recorder := httptest.NewRecorder()
+				h.TableDataHandler()(recorder, httptest.NewRequest(http.MethodGet, "/table?name=items&page=1&perPage=20", nil))
+				if recorder.Code != http.StatusOK {
+					failures <- recorder.Body.String()
+				}
+			}
+		}()
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				body := strings.NewReader(fmt.Sprintf(`{"tableName": "items", "parentColumn": "qty", "headerValue": "id",
+					"cellValue": "%d", "editedCellValue": "%d"}`, w*2+i%2+1, i))
+				recorder := httptest.NewRecorder()
+				h.UpdateRowHandler()(recorder, httptest.NewRequest(http.MethodPost, "/update", body))
+				if recorder.Code != http.StatusOK {
+					failures <- recorder.Body.String()
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(failures)
+	for failure := range failures {
+		t.Error(failure)
+	}
+
+	stats := h.stats()
+	require.NotNil(t, stats.SQLite)
+	assert.Equal(t, _client.SQLitePragmas{BusyTimeout: connection.DefaultBusyTimeout, JournalMode: "wal", ForeignKeys: true}, *stats.SQLite)
+}
+
+func TestLargeCellTruncatedAndDownloaded(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	h := SetupSQLiteHandler(t)
+	h.SetCellLimit(_client.CellLimit{MaxChars: 1000, FullExports: true})
+	big := strings.Repeat("a", 5000)
+	_, err := h.client.Database.Exec(`CREATE TABLE docs (id INTEGER PRIMARY KEY, body TEXT)`)
+	require.NoError(t, err)
+	_, err = h.client.Database.Exec(`INSERT INTO docs VALUES (1, ?), (2, 'short')`, big)
+	require.NoError(t, err)
+
+	body := strings.NewReader(`{"query": "SELECT id, body FROM docs ORDER BY id"}`)
+	recorder := httptest.NewRecorder()
+	h.QueryHandler()(recorder, httptest.NewRequest(http.MethodPost, "/execute", body))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var response struct {
+		Data struct {
+			Result struct {
+				Data     []map[string]interface{} `json:"data"`
+				Warnings []_client.CellWarning    `json:"warnings"`
+			} `json:"result"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+	result := response.Data.Result
+	assert.Equal(t, []_client.CellWarning{{Row: 0, Column: "body", Bytes: 5000}}, result.Warnings)
+	placeholder := result.Data[0]["body"].(map[string]interface{})
+	assert.Equal(t, true, placeholder["truncated"])
+	assert.Equal(t, strings.Repeat("a", 1000)+"…", placeholder["preview"])
+	assert.Equal(t, "short", result.Data[1]["body"])
+
+	body = strings.NewReader(`{"table": "docs", "column": "body", "keyColumns": ["id"], "keyValues": [1]}`)
+	recorder = httptest.NewRecorder()
+	h.CellDownloadHandler()(recorder, httptest.NewRequest(http.MethodPost, "/cell/download", body))
+	assert.Equal(t, http.StatusAccepted, recorder.Code)
+	assert.Equal(t, big, recorder.Body.String())
+
+	// exports write the value in full
+	body = strings.NewReader(`{"table": "docs", "format": "csv", "keyColumn": "id", "keyValues": [1]}`)
+	recorder = httptest.NewRecorder()
+	h.ExportRowsHandler()(recorder, httptest.NewRequest(http.MethodPost, "/export/rows", body))
+	assert.Equal(t, http.StatusAccepted, recorder.Code)
+	assert.Equal(t, "id,body\n1,"+big+"\n", recorder.Body.String())
+}
+
+func TestConnectionSettings(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "settings.db")
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	_, err = db.Exec(`CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT);
+		INSERT INTO people (name) VALUES ('ada'), ('grace'), ('linus'), ('ken'), ('dennis')`)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	h := NewHandler()
+	body := strings.NewReader(fmt.Sprintf(`{"databaseType": "sqlite", "database": "settings", "path": %q,
+		"settings": {"defaultPerPage": 2, "statementTimeoutMs": 50, "maxExportRows": 3}}`, path))
+	recorder := httptest.NewRecorder()
+	h.ConnectHandler()(recorder, httptest.NewRequest(http.MethodPost, "/connect", body))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	t.Cleanup(func() {
+		_ = h.client.Database.Close()
+	})
+	var connected struct {
+		Data api.ConnectData `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&connected))
+	assert.Equal(t, connection.Settings{DefaultPerPage: 2, StatementTimeoutMs: 50, MaxExportRows: 3}, connected.Data.Settings)
+
+	// the page size defaults to the connection's, a request can still set its own
+	recorder = httptest.NewRecorder()
+	h.TableDataHandler()(recorder, httptest.NewRequest(http.MethodGet, "/table?name=people", nil))
+	_, pagination := paginatedResponse(t, recorder)
+	assert.Equal(t, 1, pagination.Page)
+	assert.Equal(t, 2, pagination.PerPage)
+	recorder = httptest.NewRecorder()
+	h.TableDataHandler()(recorder, httptest.NewRequest(http.MethodGet, "/table?name=people&page=1&perPage=4", nil))
+	_, pagination = paginatedResponse(t, recorder)
+	assert.Equal(t, 4, pagination.PerPage)
+
+	recorder = httptest.NewRecorder()
+	h.ExportTableToCSV()(recorder, httptest.NewRequest(http.MethodGet, "/export/csv?name=people", nil))
+	require.Equal(t, http.StatusAccepted, recorder.Code)
+	assert.Equal(t, "id,name\n1,ada\n2,grace\n3,linus\n", recorder.Body.String())
+
+	slow := `WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 100000000) SELECT count(*) FROM n`
+	recorder = httptest.NewRecorder()
+	h.QueryHandler()(recorder, httptest.NewRequest(http.MethodPost, "/execute", strings.NewReader(fmt.Sprintf(`{"query": %q}`, slow))))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "statement timed out")
+
+	recorder = httptest.NewRecorder()
+	h.QueryHandler()(recorder, httptest.NewRequest(http.MethodPost, "/execute", strings.NewReader(`{"query": "SELECT 1", "timeoutMs": 5000}`)))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	body = strings.NewReader(fmt.Sprintf(`{"databaseType": "sqlite", "database": "settings", "path": %q,
+		"settings": {"defaultPerPage": -1}}`, path))
+	recorder = httptest.NewRecorder()
+	NewHandler().ConnectHandler()(recorder, httptest.NewRequest(http.MethodPost, "/connect", body))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestRowInsertHandler(t *testing.T) {
+	h := SetupSQLiteHandler(t)
+	_, err := h.client.Database.Exec(`CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT)`)
+	require.NoError(t, err)
+
+	body := strings.NewReader(`{"table": "people", "values": {"name": "ada"}}`)
+	recorder := httptest.NewRecorder()
+	h.RowInsertHandler()(recorder, httptest.NewRequest(http.MethodPost, "/row/insert", body))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var response struct {
+		Data struct {
+			Result query.Result `json:"result"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+	assert.Equal(t, map[string]interface{}{"id": float64(1)}, response.Data.Result.InsertedKey)
+	require.NotNil(t, response.Data.Result.LastInsertID)
+	assert.Equal(t, int64(1), *response.Data.Result.LastInsertID)
+
+	h.SetReadOnly(true)
+	recorder = httptest.NewRecorder()
+	h.RowInsertHandler()(recorder, httptest.NewRequest(http.MethodPost, "/row/insert", strings.NewReader(`{"table": "people", "values": {}}`)))
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+}
+
+func TestProtectedColumns(t *testing.T) {
+	h := SetupSQLiteHandler(t)
+	h.client.Settings.ProtectedColumns = []string{"*.created_at", "people.legacy_*"}
+	_, err := h.client.Database.Exec(`CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT, legacy_id INTEGER, created_at TEXT);
+		INSERT INTO people VALUES (1, 'ada', 7, '2020-01-01')`)
+	require.NoError(t, err)
+
+	requests := []struct {
+		handler http.HandlerFunc
+		body    string
+	}{
+		{h.UpdateRowHandler(), `{"tableName": "people", "parentColumn": "created_at", "editedCellValue": "x", "headerValue": "id", "cellValue": "1"}`},
+		{h.UpdateRowBatchHandler(), `[{"tableName": "people", "parentColumn": "name", "editedCellValue": "x", "headerValue": "id", "cellValue": "1"},
+			{"tableName": "people", "parentColumn": "CREATED_AT", "editedCellValue": "x", "headerValue": "id", "cellValue": "1"}]`},
+		{h.RowEditHandler(), `{"table": "people", "keyColumns": ["id"], "keyValues": [1], "values": {"name": "x", "legacy_id": 8}}`},
+		{h.UpdateRowsHandler(), `{"tableName": "people", "filter": [{"column": "id", "operator": "=", "value": 1}], "set": {"legacy_id": 8}}`},
+	}
+	for _, r := range requests {
+		recorder := httptest.NewRecorder()
+		r.handler(recorder, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(r.body)))
+		assert.Equal(t, http.StatusForbidden, recorder.Code, r.body)
+		assert.Contains(t, recorder.Body.String(), ErrCodeColumnProtected, r.body)
+	}
+	var name string
+	require.NoError(t, h.client.Database.QueryRow(`SELECT name FROM people`).Scan(&name))
+	assert.Equal(t, "ada", name)
+
+	// the other columns can still be edited
+	recorder := httptest.NewRecorder()
+	h.RowEditHandler()(recorder, httptest.NewRequest(http.MethodPost, "/row/update",
+		strings.NewReader(`{"table": "people", "keyColumns": ["id"], "keyValues": [1], "values": {"name": "grace"}}`)))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	recorder = httptest.NewRecorder()
+	h.GetColumnData()(recorder, httptest.NewRequest(http.MethodGet, "/columns/table?name=people", nil))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var response struct {
+		Data _client.ColumnData `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+	protected := make(map[string]bool)
+	for _, col := range response.Data.Columns {
+		protected[col.Field] = col.Protected
+	}
+	assert.Equal(t, map[string]bool{"id": false, "name": false, "legacy_id": true, "created_at": true}, protected)
+}
+
+func connectRapidly(t *testing.T, h *Handler, body string, times int) {
+	var wg sync.WaitGroup
+	codes := make([]int, times)
+	for i := 0; i < times; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			recorder := httptest.NewRecorder()
+			h.ConnectHandler()(recorder, httptest.NewRequest(http.MethodPost, "/connect", strings.NewReader(body)))
+			codes[i] = recorder.Code
+		}(i)
+	}
+	wg.Wait()
+	for _, code := range codes {
+		require.Equal(t, http.StatusOK, code)
+	}
+}
+
+func TestConnectRejectsIncompleteRequest(t *testing.T) {
+	h := NewHandler()
+	for body, expected := range map[string]string{
+		`{"databaseType": "mysql8", "host": "db.internal"}`: `invalid databaseType \"mysql8\"`,
+		`{"host": "db.internal", "database": "shop"}`:       "databaseType is required",
+		`{"databaseType": "Postgres", "database": "shop"}`:  "host is required for PostgreSQL connections",
+		`{"databaseType": "sqlite", "database": "shop"}`:    "path is required for SQLite connections",
+	} {
+		recorder := httptest.NewRecorder()
+		h.ConnectHandler()(recorder, httptest.NewRequest(http.MethodPost, "/connect", strings.NewReader(body)))
+		assert.Equal(t, http.StatusBadRequest, recorder.Code, body)
+		assert.Contains(t, recorder.Body.String(), expected, body)
+		assert.Nil(t, h.client.Database, body)
+	}
+}
+
+func TestConnectTablePreview(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "preview.db")
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	_, err = db.Exec(`CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT);
+		INSERT INTO people (name) VALUES ('ada'), ('grace'), ('linus');
+		CREATE TABLE teams (id INTEGER PRIMARY KEY, name TEXT);
+		INSERT INTO teams (name) VALUES ('core')`)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	h := NewHandler()
+	connect := func(query string) api.ConnectData {
+		body := strings.NewReader(fmt.Sprintf(`{"databaseType": "sqlite", "database": "preview", "path": %q}`, path))
+		recorder := httptest.NewRecorder()
+		h.ConnectHandler()(recorder, httptest.NewRequest(http.MethodPost, "/connect"+query, body))
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+		var connected struct {
+			Data api.ConnectData `json:"data"`
+		}
+		require.NoError(t, json.NewDecoder(recorder.Body).Decode(&connected))
+		return connected.Data
+	}
+	t.Cleanup(func() {
+		if h.client != nil && h.client.Database != nil {
+			_ = h.client.Database.Close()
+		}
+	})
+
+	data := connect("")
+	assert.Nil(t, data.Preview)
+
+	data = connect("?preview=2")
+	require.NotNil(t, data.Preview)
+	assert.Equal(t, data.Tables[0].TableName, data.Preview.Name)
+
+	data = connect("?preview=2&previewTable=people")
+	require.NotNil(t, data.Preview)
+	assert.Equal(t, "people", data.Preview.Name)
+	require.Len(t, data.Preview.Data, 2)
+	assert.Equal(t, "ada", data.Preview.Data[0]["name"])
+	assert.Equal(t, "grace", data.Preview.Data[1]["name"])
+
+	data = connect("?preview=2&previewTable=missing")
+	assert.Nil(t, data.Preview)
+	assert.NotEmpty(t, data.PreviewError)
+
+	recorder := httptest.NewRecorder()
+	body := strings.NewReader(fmt.Sprintf(`{"databaseType": "sqlite", "database": "preview", "path": %q}`, path))
+	h.ConnectHandler()(recorder, httptest.NewRequest(http.MethodPost, "/connect?preview=1000", body))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestViewsAreListedAndReadOnly(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "views.db")
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	_, err = db.Exec(`CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT);
+		INSERT INTO people (name) VALUES ('ada');
+		CREATE VIEW people_names AS SELECT id, name FROM people`)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	h := NewHandler()
+	body := strings.NewReader(fmt.Sprintf(`{"databaseType": "sqlite", "database": "views", "path": %q}`, path))
+	recorder := httptest.NewRecorder()
+	h.ConnectHandler()(recorder, httptest.NewRequest(http.MethodPost, "/connect", body))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	t.Cleanup(func() {
+		_ = h.client.Database.Close()
+	})
+	var connected struct {
+		Data api.ConnectData `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&connected))
+	views := make(map[string]bool)
+	for _, table := range connected.Data.Tables {
+		views[table.TableName] = table.IsView
+	}
+	assert.Equal(t, map[string]bool{"people": false, "people_names": true}, views)
+
+	recorder = httptest.NewRecorder()
+	h.UpdateRowHandler()(recorder, httptest.NewRequest(http.MethodPost, "/update", strings.NewReader(
+		`{"tableName": "people_names", "parentColumn": "name", "headerValue": "id", "cellValue": "1", "editedCellValue": "x"}`)))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), util.ErrView.Error())
+
+	recorder = httptest.NewRecorder()
+	h.TruncateTableHandler()(recorder, httptest.NewRequest(http.MethodPost, "/truncate?name=people_names", nil))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), util.ErrView.Error())
+
+	var rows int
+	require.NoError(t, h.client.Database.QueryRow(`SELECT COUNT(*) FROM people WHERE name = 'ada'`).Scan(&rows))
+	assert.Equal(t, 1, rows)
+}
+
+func TestConnectReusesConnection(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	h := NewHandler()
+	body := func(path string) string {
+		return fmt.Sprintf(`{"databaseType": "sqlite", "database": "shop", "path": %q}`, path)
+	}
+
+	connectRapidly(t, h, body(filepath.Join(dir, "shop.db")), 5)
+	first := h.client.Database
+	connectRapidly(t, h, body(filepath.Join(dir, ".", "shop.db")), 5)
+	assert.Same(t, first, h.client.Database)
+	require.NoError(t, first.Ping())
+
+	// so is one opened with other pragmas
+	connectRapidly(t, h, `{"databaseType": "sqlite", "database": "shop", "journalMode": "DELETE", "path": `+
+		strconv.Quote(filepath.Join(dir, "shop.db"))+`}`, 1)
+	assert.NotSame(t, first, h.client.Database)
+	first = h.client.Database
+
+	// a dead pool is replaced
+	require.NoError(t, first.Close())
+	connectRapidly(t, h, body(filepath.Join(dir, "shop.db")), 1)
+	second := h.client.Database
+	assert.NotSame(t, first, second)
+	require.NoError(t, second.Ping())
+
+	// connecting elsewhere closes the previous pool
+	connectRapidly(t, h, body(filepath.Join(dir, "other.db")), 1)
+	assert.NotSame(t, second, h.client.Database)
+	assert.Error(t, second.Ping())
+	t.Cleanup(func() {
+		_ = h.client.Database.Close()
+	})
+}
+
+func TestConnectReusesConnectionMySQL(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	conn := &connection.Connection{Host: "localhost", Port: 3306, User: "root", Password: "11221122", Name: "classicmodels", Type: _sql.MySQL}
+	observer, err := connection.ConnectToDatabase(conn, conn.Type.String())
+	require.NoError(t, err, "Failed to set up MySQL connection")
+	defer observer.Close()
+	observer.SetMaxOpenConns(1)
+	countSessions := func() int {
+		var n int
+		require.NoError(t, observer.QueryRow(`SELECT COUNT(*) FROM information_schema.PROCESSLIST WHERE USER = ? AND DB = ?`,
+			conn.User, conn.Name).Scan(&n))
+		return n
+	}
+	before := countSessions()
+
+	h := NewHandler()
+	body, err := json.Marshal(conn)
+	require.NoError(t, err)
+	connectRapidly(t, h, string(body), 5)
+	defer h.client.Database.Close()
+
+	// only the sessions of a single pool were added
+	assert.Equal(t, before+h.client.Database.Stats().OpenConnections, countSessions())
+}
+
+// updateGolden rewrites the golden responses of testdata/golden instead of comparing with them.
+var updateGolden = flag.Bool("update", false, "rewrite the golden responses")
+
+// volatileResponse matches the parts of a response that change from run to run.
+var volatileResponse = regexp.MustCompile(`"time_taken":"[0-9.]+"|"time_ms":[0-9]+|time taken [0-9.]+`)
+
+// assertGolden compares the response body with testdata/golden/<name>, once the timings are blanked.
+func assertGolden(t *testing.T, name string, body []byte) {
+	t.Helper()
+	body = volatileResponse.ReplaceAll(body, []byte("<time>"))
+	path := filepath.Join("testdata", "golden", name)
+	if *updateGolden {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, body, 0o644))
+	}
+	golden, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, string(golden), string(body))
+}
+
+// setupGoldenTable creates a table holding values that are encoded in every way a result value can be:
+// numbers, text to escape, invalid UTF-8, blobs, booleans, times, NULLs and columns of mixed types.
+func setupGoldenTable(t *testing.T) *Handler {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	h := SetupSQLiteHandler(t)
+	_, err := h.client.Database.Exec(`CREATE TABLE samples (
+		id INTEGER PRIMARY KEY, name TEXT, score REAL, payload BLOB, active BOOLEAN, created DATETIME, note TEXT, mixed)`)
+	require.NoError(t, err)
+	_, err = h.client.Database.Exec(`INSERT INTO samples VALUES
+		(1, 'Ada <ada@example.com> & co', 1.5, x'00ff', 1, '2024-01-02 03:04:05', NULL, 42),
+		(2, 'quote " and \ backslash', 1e-7, NULL, 0, NULL, 'tab' || char(9) || 'and' || char(10) || 'newline', 'text'),
+		(3, 'ünïcödé 😀 line' || char(8232) || 'separator', 1e21, x'68656c6c6f', NULL, '2024-06-30 23:59:59.123456', '', 2.5),
+		(4, NULL, NULL, NULL, NULL, NULL, NULL, NULL),
+		(5, 'control' || char(1) || CAST(x'ff41' AS TEXT), -12345.678, x'', 1, '2000-02-29', 'x', 9007199254740993)`)
+	require.NoError(t, err)
+	return h
+}
+
+func TestGoldenTableResponse(t *testing.T) {
+	h := setupGoldenTable(t)
+
+	recorder := httptest.NewRecorder()
+	h.TableDataHandler()(recorder, httptest.NewRequest(http.MethodGet, "/table?name=samples&page=1&perPage=10", nil))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assertGolden(t, "table.json", recorder.Body.Bytes())
+
+	h.client.Cells = _client.CellLimit{MaxChars: 8}
+	recorder = httptest.NewRecorder()
+	h.TableDataHandler()(recorder, httptest.NewRequest(http.MethodGet, "/table?name=samples&page=1&perPage=10", nil))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assertGolden(t, "table_truncated.json", recorder.Body.Bytes())
+
+	recorder = httptest.NewRecorder()
+	h.TableDataHandler()(recorder, httptest.NewRequest(http.MethodGet, "/table?name=samples&page=2&perPage=10", nil))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assertGolden(t, "table_empty.json", recorder.Body.Bytes())
+}
+
+func TestGoldenExecuteResponse(t *testing.T) {
+	h := setupGoldenTable(t)
+
+	for name, q := range map[string]string{
+		// the second id and name are told apart from the first ones, see _client.DistinctColumns
+		"execute.json":       `SELECT s.id, s.name AS id, s.*, s.id * 2 AS name FROM samples s ORDER BY s.id`,
+		"execute_empty.json": `SELECT * FROM samples WHERE id < 0`,
+	} {
+		body, err := json.Marshal(map[string]string{"query": q})
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		h.QueryHandler()(recorder, httptest.NewRequest(http.MethodPost, "/execute", bytes.NewReader(body)))
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+		assertGolden(t, name, recorder.Body.Bytes())
+	}
+}
+
+func TestGoldenExportJSON(t *testing.T) {
+	h := setupGoldenTable(t)
+
+	recorder := httptest.NewRecorder()
+	h.ExportTableToJson()(recorder, httptest.NewRequest(http.MethodGet, "/export/json?name=samples", nil))
+	require.Equal(t, http.StatusAccepted, recorder.Code, recorder.Body.String())
+	assertGolden(t, "export.json", recorder.Body.Bytes())
+
+	h.client.Nulls = _client.NullFormat{Placeholder: "NULL", InJSON: true}
+	recorder = httptest.NewRecorder()
+	h.ExportTableToJson()(recorder, httptest.NewRequest(http.MethodGet, "/export/json?name=samples", nil))
+	require.Equal(t, http.StatusAccepted, recorder.Code, recorder.Body.String())
+	assertGolden(t, "export_nulls.json", recorder.Body.Bytes())
+}
+
+func TestTableUsage(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	h := SetupSQLiteHandler(t)
+	h.usage = newTableUsage()
+	h.recent = newRecentTables()
+	_, err := h.client.Database.Exec(`CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT);
+		CREATE TABLE pets (id INTEGER PRIMARY KEY);
+		INSERT INTO people (name) VALUES ('ada')`)
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		recorder := httptest.NewRecorder()
+		h.TableDataHandler()(recorder, httptest.NewRequest(http.MethodGet, "/table?name=people&page=1&perPage=10", nil))
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+	recorder := httptest.NewRecorder()
+	h.ExportTableToJson()(recorder, httptest.NewRequest(http.MethodGet, "/export/json?name=people", nil))
+	require.Equal(t, http.StatusAccepted, recorder.Code, recorder.Body.String())
+	recorder = httptest.NewRecorder()
+	h.TableDataHandler()(recorder, httptest.NewRequest(http.MethodGet, "/table?name=pets&page=1&perPage=10", nil))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	// a failed edit is not counted
+	body := strings.NewReader(`{"tableName": "missing", "filter": [{"column": "id", "operator": "=", "value": 1}]}`)
+	recorder = httptest.NewRecorder()
+	h.DeleteRowsHandler()(recorder, httptest.NewRequest(http.MethodPost, "/rows/delete", body))
+	require.NotEqual(t, http.StatusOK, recorder.Code)
+
+	usage := func() []config.TableUsage {
+		recorder := httptest.NewRecorder()
+		h.TableUsageHandler()(recorder, httptest.NewRequest(http.MethodGet, "/usage/tables", nil))
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+		var res struct {
+			Data []config.TableUsage `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+		return res.Data
+	}
+
+	check := func(usage []config.TableUsage) {
+		require.Len(t, usage, 2)
+		assert.Equal(t, "people", usage[0].Table)
+		assert.Equal(t, h.client.Key(), usage[0].Connection)
+		assert.Equal(t, int64(2), usage[0].Views)
+		assert.Equal(t, int64(1), usage[0].Exports)
+		assert.Equal(t, int64(0), usage[0].Edits)
+		assert.False(t, usage[0].LastAccessAt.IsZero())
+		assert.Equal(t, "pets", usage[1].Table)
+		assert.Equal(t, int64(1), usage[1].Views)
+	}
+	// counted in memory only, then saved
+	check(usage())
+	saved, err := config.GetTableUsage("")
+	require.NoError(t, err)
+	assert.Empty(t, saved)
+	require.NoError(t, h.FlushUsage())
+	saved, err = config.GetTableUsage(h.client.Key())
+	require.NoError(t, err)
+	assert.Len(t, saved, 2)
+	check(usage())
+
+	// the saved counts add up with those counted since
+	body = strings.NewReader(`{"tableName": "people", "filter": [{"column": "id", "operator": "=", "value": 1}]}`)
+	recorder = httptest.NewRecorder()
+	h.DeleteRowsHandler()(recorder, httptest.NewRequest(http.MethodPost, "/rows/delete", body))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	require.NoError(t, h.FlushUsage())
+	assert.Equal(t, int64(1), usage()[0].Edits)
+	assert.Equal(t, int64(2), usage()[0].Views)
+
+	recorder = httptest.NewRecorder()
+	h.ResetTableUsageHandler()(recorder, httptest.NewRequest(http.MethodPost, "/usage/tables/reset?connection="+url.QueryEscape(h.client.Key()), nil))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Empty(t, usage())
+}
+
+func TestRecentTables(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	h := SetupSQLiteHandler(t)
+	h.usage = newTableUsage()
+	h.recent = newRecentTables()
+	_, err := h.client.Database.Exec(`CREATE TABLE people (id INTEGER PRIMARY KEY);
+		CREATE TABLE pets (id INTEGER PRIMARY KEY)`)
+	require.NoError(t, err)
+
+	open := func(table string) {
+		recorder := httptest.NewRecorder()
+		h.TableDataHandler()(recorder, httptest.NewRequest(http.MethodGet, "/table?name="+table+"&page=1&perPage=10", nil))
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+	recent := func() []string {
+		recorder := httptest.NewRecorder()
+		h.RecentTablesHandler()(recorder, httptest.NewRequest(http.MethodGet, "/tables/recent", nil))
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+		var res struct {
+			Data api.RecentTablesData `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+		tables := make([]string, 0, len(res.Data.Recent))
+		for _, r := range res.Data.Recent {
+			tables = append(tables, r.Table)
+		}
+		return tables
+	}
+
+	open("people")
+	open("pets")
+	open("people")
+	// kept in memory only, then saved
+	assert.Equal(t, []string{"people", "pets"}, recent())
+	prefs, err := config.GetPreferences(h.client.Key())
+	require.NoError(t, err)
+	assert.Empty(t, prefs.Recent)
+	require.NoError(t, h.FlushUsage())
+	prefs, err = config.GetPreferences(h.client.Key())
+	require.NoError(t, err)
+	require.Len(t, prefs.Recent, 2)
+	assert.Equal(t, "people", prefs.Recent[0].Table)
+
+	// the tables opened since come first
+	open("pets")
+	assert.Equal(t, []string{"pets", "people"}, recent())
+}
+
+func TestSavedQueries(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	h := SetupSQLiteHandler(t)
+	_, err := h.client.Database.Exec(`CREATE TABLE orders (id INTEGER PRIMARY KEY, customer TEXT, total REAL);
+		INSERT INTO orders (customer, total) VALUES ('ada', 5), ('ada', 20), ('bob', 30)`)
+	require.NoError(t, err)
+
+	body := strings.NewReader(`{"name": "big orders", "query": "SELECT id FROM orders WHERE customer = :customer AND total > :min ORDER BY id"}`)
+	recorder := httptest.NewRecorder()
+	h.SaveQueryHandler()(recorder, httptest.NewRequest(http.MethodPost, "/queries", body))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	recorder = httptest.NewRecorder()
+	h.SavedQueriesHandler()(recorder, httptest.NewRequest(http.MethodGet, "/queries", nil))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var list struct {
+		Data []config.SavedQuery `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &list))
+	require.Len(t, list.Data, 1)
+	assert.Equal(t, "big orders", list.Data[0].Name)
+	assert.Equal(t, []string{"customer", "min"}, list.Data[0].Params)
+
+	run := func(body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		h.RunSavedQueryHandler()(recorder, httptest.NewRequest(http.MethodPost, "/queries/run", strings.NewReader(body)))
+		return recorder
+	}
+	// the value is bound, not spliced into the query
+	recorder = run(`{"name": "big orders", "params": {"customer": "ada' OR '1'='1", "min": 0}}`)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Contains(t, recorder.Body.String(), `"affected_rows":0`)
+
+	recorder = run(`{"name": "big orders", "params": {"customer": "ada", "min": 10}}`)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var res struct {
+		Data struct {
+			Result query.Result `json:"result"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+	assert.Equal(t, int64(1), res.Data.Result.AffectedRows)
+	assert.Contains(t, recorder.Body.String(), `"id":2`)
+
+	recorder = run(`{"name": "big orders", "params": {"customer": "ada"}}`)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), ErrCodeMissingParams)
+	recorder = run(`{"name": "missing", "params": {}}`)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	h.DeleteSavedQueryHandler()(recorder, httptest.NewRequest(http.MethodDelete, "/queries?name="+url.QueryEscape("big orders"), nil))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	queries, err := config.GetSavedQueries(h.client.Key())
+	require.NoError(t, err)
+	assert.Empty(t, queries)
+}
+
+func TestSafeMode(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	h := SetupSQLiteHandler(t)
+	_, err := h.client.Database.Exec(`CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT)`)
+	require.NoError(t, err)
+	h.session = &session{}
+	h.session.connected(&connection.Connection{Type: _sql.SQLite, Name: "shop", SafeMode: true})
+
+	type planResponse struct {
+		Code string       `json:"code"`
+		Data SafeModePlan `json:"data"`
+	}
+	execute := func(body map[string]interface{}) (*httptest.ResponseRecorder, planResponse) {
+		payload, err := json.Marshal(body)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		h.QueryHandler()(recorder, httptest.NewRequest(http.MethodPost, "/execute", bytes.NewReader(payload)))
+		var response planResponse
+		_ = json.Unmarshal(recorder.Body.Bytes(), &response)
+		return recorder, response
+	}
+	count := func() int {
+		var n int
+		require.NoError(t, h.client.Database.QueryRow(`SELECT COUNT(*) FROM people`).Scan(&n))
+		return n
+	}
+	insert := "INSERT INTO people (name) VALUES ('ada')"
+
+	// the statement is explained, not run
+	recorder, plan := execute(map[string]interface{}{"query": insert})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	require.NotEmpty(t, plan.Data.ExecutionToken)
+	require.NotNil(t, plan.Data.Plan)
+	assert.WithinDuration(t, time.Now().Add(executionTokenTTL), plan.Data.ExpiresAt, time.Minute)
+	assert.Equal(t, 0, count())
+
+	// the token only runs the statement it was issued for
+	recorder, response := execute(map[string]interface{}{"query": "DELETE FROM people", "executionToken": plan.Data.ExecutionToken})
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.Equal(t, ErrCodeExecutionToken, response.Code)
+	recorder, plan = execute(map[string]interface{}{"query": insert})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	recorder, _ = execute(map[string]interface{}{"query": insert, "executionToken": plan.Data.ExecutionToken})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Equal(t, 1, count())
+	// and only once
+	recorder, response = execute(map[string]interface{}{"query": insert, "executionToken": plan.Data.ExecutionToken})
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.Equal(t, ErrCodeExecutionToken, response.Code)
+	assert.Equal(t, 1, count())
+
+	// tokens expire
+	now := time.Now()
+	token, _, err := h.session.issueExecution(insert, now)
+	require.NoError(t, err)
+	assert.ErrorIs(t, h.session.redeemExecution(token, insert, now.Add(executionTokenTTL)), util.ErrExecutionToken)
+	token, _, err = h.session.issueExecution(insert, now)
+	require.NoError(t, err)
+	assert.NoError(t, h.session.redeemExecution(token, insert, now.Add(executionTokenTTL-time.Second)))
+
+	// a statement the database cannot explain can still be confirmed
+	recorder, plan = execute(map[string]interface{}{"query": "SELECT * FROM missing"})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Nil(t, plan.Data.Plan)
+	assert.Contains(t, plan.Data.PlanError, "no such table")
+	assert.NotEmpty(t, plan.Data.ExecutionToken)
+
+	// explaining never runs a statement hidden after the first one, or one behind an EXPLAIN option list
+	for q, planErr := range map[string]error{
+		"SELECT 1; INSERT INTO people (name) VALUES ('eve')":    util.ErrSingleStatement,
+		"SELECT '--'; INSERT INTO people (name) VALUES ('eve')": util.ErrSingleStatement,
+		"(ANALYZE) DELETE FROM people":                          util.ErrNotExplainable,
+		"ANALYZE DELETE FROM people":                            util.ErrNotExplainable,
+	} {
+		recorder, plan = execute(map[string]interface{}{"query": q})
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+		assert.Nil(t, plan.Data.Plan, q)
+		assert.Equal(t, planErr.Error(), plan.Data.PlanError, q)
+	}
+	assert.Equal(t, 1, count())
+
+	// read-only mode refuses writes before they are explained, and again when they come back
+	recorder, plan = execute(map[string]interface{}{"query": insert})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	h.SetReadOnly(true)
+	recorder, _ = execute(map[string]interface{}{"query": insert})
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.NotContains(t, recorder.Body.String(), "executionToken")
+	recorder, _ = execute(map[string]interface{}{"query": insert, "executionToken": plan.Data.ExecutionToken})
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), util.ErrReadOnly.Error())
+	assert.Equal(t, 1, count())
+	h.SetReadOnly(false)
+
+	// a destructive statement is confirmed first, then explained and confirmed again
+	h.SetConfirmDestructive(true)
+	drop := "DROP TABLE people"
+	recorder, response = execute(map[string]interface{}{"query": drop})
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.Equal(t, ErrCodeConfirmationRequired, response.Code)
+	override := confirmationToken(drop)
+	recorder, plan = execute(map[string]interface{}{"query": drop, "allowSystem": true, "confirmToken": override})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	require.NotEmpty(t, plan.Data.ExecutionToken)
+	recorder, response = execute(map[string]interface{}{"query": drop, "executionToken": plan.Data.ExecutionToken})
+	assert.Equal(t, ErrCodeConfirmationRequired, response.Code)
+	assert.Equal(t, 1, count())
+
+	// turned off, statements run at once
+	recorder = httptest.NewRecorder()
+	h.SafeModeHandler()(recorder, httptest.NewRequest(http.MethodPost, "/connection/safe-mode?enabled=false", nil))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.False(t, h.stats().SafeMode)
+	recorder, _ = execute(map[string]interface{}{"query": insert})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Equal(t, 2, count())
+
+	h.session.disconnected()
+	recorder = httptest.NewRecorder()
+	h.SafeModeHandler()(recorder, httptest.NewRequest(http.MethodPost, "/connection/safe-mode?enabled=true", nil))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestSafeModeSavedQuery(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	h := SetupSQLiteHandler(t)
+	_, err := h.client.Database.Exec(`CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT)`)
+	require.NoError(t, err)
+	_, err = config.SaveQuery(config.SavedQuery{
+		Name:       "add person",
+		Connection: h.client.Key(),
+		Query:      "INSERT INTO people (name) VALUES (:name)",
+		Params:     []string{"name"},
+	})
+	require.NoError(t, err)
+	h.session = &session{}
+	h.session.connected(&connection.Connection{Type: _sql.SQLite, Name: "shop", SafeMode: true})
+
+	run := func(body string) (*httptest.ResponseRecorder, SafeModePlan) {
+		recorder := httptest.NewRecorder()
+		h.RunSavedQueryHandler()(recorder, httptest.NewRequest(http.MethodPost, "/queries/run", strings.NewReader(body)))
+		var response struct {
+			Data SafeModePlan `json:"data"`
+		}
+		_ = json.Unmarshal(recorder.Body.Bytes(), &response)
+		return recorder, response.Data
+	}
+	count := func() int {
+		var n int
+		require.NoError(t, h.client.Database.QueryRow(`SELECT COUNT(*) FROM people`).Scan(&n))
+		return n
+	}
+
+	recorder, plan := run(`{"name": "add person", "params": {"name": "ada"}}`)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	require.NotEmpty(t, plan.ExecutionToken)
+	assert.Equal(t, 0, count())
+
+	// the token is bound to the params too
+	recorder, _ = run(`{"name": "add person", "params": {"name": "eve"}, "executionToken": "` + plan.ExecutionToken + `"}`)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), ErrCodeExecutionToken)
+	assert.Equal(t, 0, count())
+
+	_, plan = run(`{"name": "add person", "params": {"name": "ada"}}`)
+	recorder, _ = run(`{"name": "add person", "params": {"name": "ada"}, "executionToken": "` + plan.ExecutionToken + `"}`)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Equal(t, 1, count())
+}
+
+func TestSafeModeRerun(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	h := SetupSQLiteHandler(t)
+	_, err := h.client.Database.Exec(`CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT)`)
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	h.QueryHandler()(recorder, httptest.NewRequest(http.MethodPost, "/execute", strings.NewReader(`{"query": "INSERT INTO people (name) VALUES ('ada')"}`)))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	history, err := config.GetQueryHistory(h.client.Key())
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	h.session = &session{}
+	h.session.connected(&connection.Connection{Type: _sql.SQLite, Name: "shop", SafeMode: true})
+
+	rerun := func(params string) (*httptest.ResponseRecorder, SafeModePlan) {
+		recorder := httptest.NewRecorder()
+		h.RerunQueryHandler()(recorder, httptest.NewRequest(http.MethodPost, "/queries/history/rerun?id="+history[0].ID+params, nil))
+		var response struct {
+			Data SafeModePlan `json:"data"`
+		}
+		_ = json.Unmarshal(recorder.Body.Bytes(), &response)
+		return recorder, response.Data
+	}
+	count := func() int {
+		var n int
+		require.NoError(t, h.client.Database.QueryRow(`SELECT COUNT(*) FROM people`).Scan(&n))
+		return n
+	}
+
+	recorder, plan := rerun("")
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	require.NotEmpty(t, plan.ExecutionToken)
+	assert.Equal(t, 1, count())
+
+	recorder, _ = rerun("&executionToken=unknown")
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.Equal(t, 1, count())
+
+	recorder, _ = rerun("&executionToken=" + plan.ExecutionToken)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Equal(t, 2, count())
+}
+
+func TestSafeModeScript(t *testing.T) {
+	h := SetupSQLiteHandler(t)
+	_, err := h.client.Database.Exec(`CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT)`)
+	require.NoError(t, err)
+	h.session = &session{}
+	h.session.connected(&connection.Connection{Type: _sql.SQLite, Name: "shop", SafeMode: true})
+
+	script := `{"query": "INSERT INTO people (name) VALUES ('ada'); INSERT INTO people (name) VALUES ('grace')"}`
+	recorder := httptest.NewRecorder()
+	h.ScriptHandler()(recorder, httptest.NewRequest(http.MethodPost, "/execute/script", strings.NewReader(script)))
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), util.ErrScriptInSafeMode.Error())
+	var n int
+	require.NoError(t, h.client.Database.QueryRow(`SELECT COUNT(*) FROM people`).Scan(&n))
+	assert.Equal(t, 0, n)
+
+	require.True(t, h.session.setSafeMode(false))
+	recorder = httptest.NewRecorder()
+	h.ScriptHandler()(recorder, httptest.NewRequest(http.MethodPost, "/execute/script", strings.NewReader(script)))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	require.NoError(t, h.client.Database.QueryRow(`SELECT COUNT(*) FROM people`).Scan(&n))
+	assert.Equal(t, 2, n)
+}
+
+func TestRunSavedQueryParams(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	h := SetupSQLiteHandler(t)
+	_, err := h.client.Database.Exec(`CREATE TABLE events (id INTEGER PRIMARY KEY, kind TEXT, happened_on TEXT);
+		INSERT INTO events (kind, happened_on) VALUES ('signup', '2024-01-05'), ('signup', '2024-02-10'), ('login', '2024-02-11')`)
+	require.NoError(t, err)
+	_, err = config.SaveQuery(config.SavedQuery{
+		Name:       "events between",
+		Connection: h.client.Key(),
+		Query:      "SELECT id FROM events WHERE kind = :kind AND happened_on BETWEEN :start_date AND :end_date ORDER BY id",
+		Params:     []string{"kind", "start_date", "end_date"},
+	})
+	require.NoError(t, err)
+
+	run := func(params string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		body := strings.NewReader(`{"name": "events between", "params": ` + params + `}`)
+		h.RunSavedQueryHandler()(recorder, httptest.NewRequest(http.MethodPost, "/queries/run", body))
+		return recorder
+	}
+
+	recorder := run(`{"kind": "signup", "start_date": "2024-02-01", "end_date": "2024-02-28"}`)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var res struct {
+		Data struct {
+			Result query.Result `json:"result"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+	assert.Equal(t, int64(1), res.Data.Result.AffectedRows)
+	assert.Contains(t, recorder.Body.String(), `"id":2`)
+
+	recorder = run(`{"kind": "signup"}`)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	var failed struct {
+		Message string `json:"message"`
+		Code    string `json:"code"`
+		Data    struct {
+			Missing []string `json:"missing"`
+			Params  []string `json:"params"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &failed))
+	assert.Equal(t, ErrCodeMissingParams, failed.Code)
+	assert.Equal(t, []string{"start_date", "end_date"}, failed.Data.Missing)
+	assert.Equal(t, []string{"kind", "start_date", "end_date"}, failed.Data.Params)
+	assert.Contains(t, failed.Message, "start_date, end_date")
+
+	// a value for a placeholder the query does not have is refused too
+	recorder = run(`{"kind": "signup", "start_date": "2024-02-01", "end_date": "2024-02-28", "limit": 3}`)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "unknown parameter limit")
+}
+
+func TestScriptReadOnly(t *testing.T) {
+	h := SetupSQLiteHandler(t)
+	_, err := h.client.Database.Exec(`CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT)`)
+	require.NoError(t, err)
+	h.SetReadOnly(true)
+
+	// a comment marker inside a string must not hide the DROP
+	for _, script := range []string{"SELECT '--'; DROP TABLE people", "SELECT '/*'; DROP TABLE people; SELECT '*/'"} {
+		body, err := json.Marshal(map[string]string{"query": script})
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		h.ScriptHandler()(recorder, httptest.NewRequest(http.MethodPost, "/execute/script", bytes.NewReader(body)))
+		assert.Equal(t, http.StatusForbidden, recorder.Code, script)
+		assert.Contains(t, recorder.Body.String(), util.ErrReadOnly.Error())
+	}
+
+	var rows int
+	require.NoError(t, h.client.Database.QueryRow(`SELECT COUNT(*) FROM people`).Scan(&rows))
+	assert.Equal(t, 0, rows)
+}
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/yazeed1s/sqlweb/pkg/api"
+)
+
+// SetLegacyPagination sets whether /table still sends total_rows and total_pages in its data,
+// next to the pagination of the response envelope. It is on by default for one release.
+func (h *Handler) SetLegacyPagination(legacy bool) {
+	h.noLegacyPagination = !legacy
+}
+
+// pageParams reads the page and perPage query parameters of endpoints where they are optional.
+// ok is false when neither is set; both must be set otherwise, page from 1 and perPage above 0.
+func pageParams(params url.Values) (page, perPage int, ok bool, err error) {
+	if !params.Has("page") && !params.Has("perPage") {
+		return 0, 0, false, nil
+	}
+	page, err = strconv.Atoi(params.Get("page"))
+	if err != nil || page < 1 {
+		return 0, 0, false, fmt.Errorf("invalid 'page' parameter: %s", params.Get("page"))
+	}
+	perPage, err = strconv.Atoi(params.Get("perPage"))
+	if err != nil || perPage < 1 {
+		return 0, 0, false, fmt.Errorf("invalid 'perPage' parameter: %s", params.Get("perPage"))
+	}
+	return page, perPage, true, nil
+}
+
+// paginate returns the items on the given page along with the pagination describing it.
+// A page past the end is empty.
+func paginate[T any](items []T, page, perPage int) ([]T, *api.Pagination) {
+	pagination := api.NewPagination(page, perPage, len(items))
+	start := (page - 1) * perPage
+	if start >= len(items) {
+		return []T{}, pagination
+	}
+	end := start + perPage
+	if end > len(items) {
+		end = len(items)
+	}
+	return items[start:end], pagination
+}
+
+// handlePaginatedRequest sends a JSON response for a successful request holding one page of data.
+func handlePaginatedRequest(writer http.ResponseWriter, message string, data interface{}, pagination *api.Pagination) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusOK)
+
+	response := Response{
+		Message:    message,
+		Data:       data,
+		Pagination: pagination,
+	}
+	if err := json.NewEncoder(writer).Encode(response); err != nil {
+		http.Error(writer, "Error encoding JSON response", http.StatusInternalServerError)
+	}
+}
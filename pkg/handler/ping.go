@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// pingTimeout bounds the ping of /ping unless a timeout is given.
+const pingTimeout = 5 * time.Second
+
+// ErrCodePingFailed is sent in Response.Code when the database of the active connection did not answer a ping.
+const ErrCodePingFailed = "ping_failed"
+
+// PingResult is the round trip of a ping to the database of the active connection.
+type PingResult struct {
+	Reachable bool `json:"reachable"`
+	// LatencyMs is how long the ping took, or waited before failing, in milliseconds
+	LatencyMs float64 `json:"latencyMs"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// ping times a ping of the database, bounded by timeout. The pool may open a connection
+// to answer it, which is then part of the latency.
+func (h *Handler) ping(ctx context.Context, timeout time.Duration) PingResult {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := h.client.Database.PingContext(ctx)
+	result := PingResult{
+		Reachable: err == nil,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// PingHandler pings the database of the active connection and returns the round trip latency.
+// A failed ping answers with a 503, the ping_failed code and how long it waited.
+func (h *Handler) PingHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		var (
+			err     error
+			result  PingResult
+			timeout = pingTimeout
+		)
+
+		if value := request.URL.Query().Get("timeout"); value != "" {
+			timeout, err = time.ParseDuration(value)
+			if err != nil || timeout <= 0 {
+				handleBadRequest(writer, fmt.Sprintf("invalid 'timeout' parameter: %s", value), err)
+				return
+			}
+		}
+
+		if h.client.Database == nil {
+			handleBadRequest(writer, "No active connection", errors.New("database connection is nil"))
+			return
+		}
+
+		result = h.ping(request.Context(), timeout)
+		if !result.Reachable {
+			handlePingFailed(writer, result)
+			return
+		}
+		handleSuccessRequest(writer, fmt.Sprintf("Database answered in %.3fms", result.LatencyMs), result)
+	}
+}
+
+// handlePingFailed sends a 503 response carrying the failed ping.
+func handlePingFailed(writer http.ResponseWriter, result PingResult) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusServiceUnavailable)
+	response := Response{
+		Message: fmt.Sprintf("Database did not answer the ping after %.3fms", result.LatencyMs),
+		Data:    result,
+		Error:   result.Error,
+		Code:    ErrCodePingFailed,
+	}
+	if err := json.NewEncoder(writer).Encode(response); err != nil {
+		http.Error(writer, "Error encoding JSON response", http.StatusInternalServerError)
+	}
+}
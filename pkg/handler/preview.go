@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+
+	_client "github.com/yazeed1s/sqlweb/pkg/client"
+)
+
+// maxPreviewRows caps the rows of the table preview of a connect response.
+const maxPreviewRows = 100
+
+// tablePreview asks for the first rows of a table in a connect response, so the UI has something to show
+// without another request. Rows is 0 when no preview is asked for.
+type tablePreview struct {
+	// Table is the table to preview, the first one of the schema when empty
+	Table string
+	Rows  int
+}
+
+// parseTablePreview reads the 'preview' param, the number of rows to preview, and the optional
+// 'previewTable' param.
+func parseTablePreview(params url.Values) (tablePreview, error) {
+	var (
+		preview tablePreview
+		err     error
+	)
+
+	preview.Table = params.Get("previewTable")
+	value := params.Get("preview")
+	if value == "" {
+		if preview.Table != "" {
+			return tablePreview{}, fmt.Errorf("'previewTable' needs the 'preview' parameter")
+		}
+		return preview, nil
+	}
+	preview.Rows, err = strconv.Atoi(value)
+	if err != nil || preview.Rows < 0 || preview.Rows > maxPreviewRows {
+		return tablePreview{}, fmt.Errorf("invalid 'preview' parameter: %s, expected up to %d rows", value, maxPreviewRows)
+	}
+	return preview, nil
+}
+
+// read reads the first rows of the table to preview, nil when no preview is asked for or the schema has no table.
+func (p tablePreview) read(client *_client.Client, tableNames []string) (*_client.Table, error) {
+	table := p.Table
+	if p.Rows == 0 {
+		return nil, nil
+	}
+	if table == "" {
+		if len(tableNames) == 0 {
+			return nil, nil
+		}
+		table = tableNames[0]
+	}
+	return client.GetTable(table, 1, p.Rows)
+}
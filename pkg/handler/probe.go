@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/yazeed1s/sqlweb/db/connection"
+	"github.com/yazeed1s/sqlweb/pkg/config"
+)
+
+const (
+	// probeTimeout bounds each connection attempt of /connections/test unless a timeout is given
+	probeTimeout = 5 * time.Second
+	// probeWorkers is the number of saved connections tested at once
+	probeWorkers = 8
+)
+
+// ProbeResult tells whether a saved connection could be reached, and why not.
+type ProbeResult struct {
+	Key       string `json:"key"`
+	Type      string `json:"databaseType"`
+	Reachable bool   `json:"reachable"`
+	Error     string `json:"error,omitempty"`
+	// LatencyMs is how long the attempt took, in milliseconds
+	LatencyMs int64 `json:"latencyMs"`
+}
+
+// probeConnections tries to connect to each connection, at most probeWorkers at a time, and
+// returns the results in the order of the connections. Every connection opened is closed.
+func probeConnections(ctx context.Context, connections []connection.Connection, timeout time.Duration) []ProbeResult {
+	var (
+		results = make([]ProbeResult, len(connections))
+		jobs    = make(chan int)
+		wg      sync.WaitGroup
+	)
+
+	workers := probeWorkers
+	if len(connections) < workers {
+		workers = len(connections)
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				conn := connections[i]
+				probeCtx, cancel := context.WithTimeout(ctx, timeout)
+				start := time.Now()
+				err := connection.Probe(probeCtx, &conn)
+				cancel()
+
+				results[i] = ProbeResult{
+					Key:       conn.Name,
+					Type:      conn.Type.String(),
+					Reachable: err == nil,
+					LatencyMs: time.Since(start).Milliseconds(),
+				}
+				if err != nil {
+					results[i].Error = err.Error()
+				}
+			}
+		}()
+	}
+	for i := range connections {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+// TestConnectionsHandler tries to connect to every saved connection and reports which are reachable.
+// The active connection is left as it is.
+func (h *Handler) TestConnectionsHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		var (
+			connections []connection.Connection
+			results     []ProbeResult
+			timeout     = probeTimeout
+			reachable   int
+			err         error
+		)
+
+		if value := request.URL.Query().Get("timeout"); value != "" {
+			timeout, err = time.ParseDuration(value)
+			if err != nil || timeout <= 0 {
+				handleBadRequest(writer, fmt.Sprintf("invalid 'timeout' parameter: %s", value), err)
+				return
+			}
+		}
+
+		connections, err = config.GetSavedConnections()
+		if err != nil {
+			handleBadRequest(writer, "Error retrieving saved connections: ", err)
+			return
+		}
+
+		results = probeConnections(request.Context(), connections, timeout)
+		for _, result := range results {
+			if result.Reachable {
+				reachable++
+			}
+		}
+		msg := fmt.Sprintf("%d of %d saved connections reachable", reachable, len(results))
+		handleSuccessRequest(writer, msg, results)
+	}
+}
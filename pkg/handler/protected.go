@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/yazeed1s/sqlweb/pkg/api"
+	_client "github.com/yazeed1s/sqlweb/pkg/client"
+	"github.com/yazeed1s/sqlweb/pkg/util"
+)
+
+// ErrCodeColumnProtected is the response code sent when an edit sets a column protected by the
+// protectedColumns setting of the connection.
+const ErrCodeColumnProtected = "column_protected"
+
+// protectedColumns returns the columns of the table the connection protects, in the order given.
+func (h *Handler) protectedColumns(table string, columns []string) []string {
+	var protected []string
+	for _, column := range columns {
+		if h.client.Settings.Protects(table, column) {
+			protected = append(protected, column)
+		}
+	}
+	return protected
+}
+
+// rejectProtectedColumns sends a 403 response and returns true when any of the columns of the table is protected.
+// Unlike system schemas and destructive operations there is no override: the rule is lifted by editing the connection.
+func (h *Handler) rejectProtectedColumns(writer http.ResponseWriter, table string, columns []string) bool {
+	protected := h.protectedColumns(table, columns)
+	if len(protected) == 0 {
+		return false
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusForbidden)
+	response := Response{
+		Message: "Column is protected",
+		Error:   util.ErrColumnProtected.Error(),
+		Code:    ErrCodeColumnProtected,
+		Data:    api.ProtectedColumnsData{Table: table, Columns: protected},
+	}
+	if err := json.NewEncoder(writer).Encode(response); err != nil {
+		http.Error(writer, "Error encoding JSON response", http.StatusInternalServerError)
+	}
+	return true
+}
+
+// flagProtectedColumns marks the protected columns of the table, so that they are shown read-only.
+func flagProtectedColumns(client *_client.Client, data *_client.ColumnData) {
+	for i := range data.Columns {
+		data.Columns[i].Protected = client.Settings.Protects(data.TableName, data.Columns[i].Field)
+	}
+}
+
+// mapKeys returns the keys of the values of a row, the columns they set.
+func mapKeys(values map[string]interface{}) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
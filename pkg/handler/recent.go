@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"sync"
+	"time"
+
+	"github.com/yazeed1s/sqlweb/pkg/config"
+)
+
+type recentKey struct {
+	connection string
+	schema     string
+	table      string
+}
+
+// recentTables keeps the tables opened since the last flush in memory, so that opening a table does not
+// rewrite the preferences file; flush adds them to the saved recent tables with the table usage, off the requests.
+type recentTables struct {
+	mu     sync.Mutex
+	opened map[recentKey]time.Time
+	// flushMu serializes flushes and reads, so tables taken by a flush are saved before a read looks for them
+	flushMu sync.Mutex
+}
+
+func newRecentTables() *recentTables {
+	return &recentTables{opened: make(map[recentKey]time.Time)}
+}
+
+func (r *recentTables) record(connection, schema, table string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.opened[recentKey{connection: connection, schema: schema, table: table}] = time.Now()
+}
+
+// pending returns the tables opened since the last flush, by connection. With take, they are
+// removed, handing them over to the caller.
+func (r *recentTables) pending(take bool) map[string][]config.RecentTable {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	opened := make(map[string][]config.RecentTable)
+	for key, at := range r.opened {
+		opened[key.connection] = append(opened[key.connection], config.RecentTable{Schema: key.schema, Table: key.table, OpenedAt: at})
+	}
+	if take {
+		r.opened = make(map[recentKey]time.Time)
+	}
+	return opened
+}
+
+// flush adds the tables opened since the last flush to the recent tables of their connection. Those
+// that cannot be saved are put back, unless opened again since, to be saved by the next flush.
+func (r *recentTables) flush() error {
+	r.flushMu.Lock()
+	defer r.flushMu.Unlock()
+
+	var err error
+	for connection, opened := range r.pending(true) {
+		if e := config.RecordTableOpens(connection, opened); e != nil {
+			err = e
+			r.putBack(connection, opened)
+		}
+	}
+	return err
+}
+
+func (r *recentTables) putBack(connection string, opened []config.RecentTable) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, t := range opened {
+		key := recentKey{connection: connection, schema: t.Schema, table: t.Table}
+		if at, ok := r.opened[key]; !ok || at.Before(t.OpenedAt) {
+			r.opened[key] = t.OpenedAt
+		}
+	}
+}
+
+// preferences returns the saved preferences of the connection, with the tables opened since the last flush
+// in their recent list.
+func (r *recentTables) preferences(connection string) (config.Preferences, error) {
+	r.flushMu.Lock()
+	defer r.flushMu.Unlock()
+
+	prefs, err := config.GetPreferences(connection)
+	if err != nil {
+		return prefs, err
+	}
+	prefs.Recent = config.MergeRecentTables(prefs.Recent, r.pending(false)[connection])
+	return prefs, nil
+}
+
+// recordOpen records that a table of the active connection was opened.
+func (h *Handler) recordOpen(table string) {
+	if h.recent == nil || table == "" {
+		return
+	}
+	h.recent.record(h.client.Key(), h.client.Schema.Name, table)
+}
+
+// preferences returns the saved preferences of the active connection, with the tables opened since the
+// last flush in their recent list.
+func (h *Handler) preferences() (config.Preferences, error) {
+	if h.recent == nil {
+		return config.GetPreferences(h.client.Key())
+	}
+	return h.recent.preferences(h.client.Key())
+}
@@ -0,0 +1,330 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/yazeed1s/sqlweb/pkg/api"
+	_client "github.com/yazeed1s/sqlweb/pkg/client"
+	"github.com/yazeed1s/sqlweb/pkg/config"
+	"github.com/yazeed1s/sqlweb/pkg/query"
+)
+
+// ErrCodeTableRenamed is the response code sent when a saved query or export template names a table
+// renamed since it was saved. The response carries the suggested rewrite, which autoFix or the fix endpoints apply.
+const ErrCodeTableRenamed = "table_renamed"
+
+// RenameTableRequest is the body of the table rename endpoint.
+type RenameTableRequest struct {
+	TableName string `json:"tableName"`
+	NewName   string `json:"newName"`
+	SystemOverride
+}
+
+// RenameSuggestion offers a saved query or an export template rewritten to name the new names of
+// the tables renamed since it was saved.
+type RenameSuggestion struct {
+	// ID is the history entry of a saved query, Template the name of an export template
+	ID       string `json:"id,omitempty"`
+	Template string `json:"template,omitempty"`
+	// Renames maps the tables that no longer exist to their new names
+	Renames map[string]string `json:"renames"`
+	// Query is the rewritten query, Table the new table of the template
+	Query string `json:"query,omitempty"`
+	Table string `json:"table,omitempty"`
+	// Applied tells whether the rewrite was saved
+	Applied bool `json:"applied"`
+}
+
+// HistoryData is the data of a /queries/history response: the history, and the rewrites suggested
+// for the queries naming renamed tables.
+type HistoryData struct {
+	History []config.QueryHistoryEntry `json:"history"`
+	Renamed []*RenameSuggestion        `json:"renamed"`
+}
+
+// RenamedQueriesData is the data of a /queries/history/fix response: the rewrites that were saved.
+type RenamedQueriesData struct {
+	Renamed []*RenameSuggestion `json:"renamed"`
+}
+
+// RenamedTemplateData is the data of an /export/templates/fix response: the rewrite of the template,
+// null when its table was not renamed.
+type RenamedTemplateData struct {
+	Renamed *RenameSuggestion `json:"renamed"`
+}
+
+// SuggestionData is the data of a table_renamed error: the suggested rewrite.
+type SuggestionData struct {
+	Suggestion *RenameSuggestion `json:"suggestion"`
+}
+
+// tableRenames tells which tables named by saved queries and export templates no longer exist
+// but were renamed through sqlweb.
+type tableRenames struct {
+	dbType string
+	prefs  config.Preferences
+	tables map[string]bool
+}
+
+// loadTableRenames returns the renames of the connection's tables, nil when it has none.
+// The tables are only listed when there are renames to check.
+func (h *Handler) loadTableRenames(prefs config.Preferences) (*tableRenames, error) {
+	if len(prefs.Renames) == 0 {
+		return nil, nil
+	}
+	tables, err := h.client.ListTables()
+	if err != nil {
+		return nil, err
+	}
+	renames := &tableRenames{dbType: h.client.Type.String(), prefs: prefs, tables: make(map[string]bool, len(tables))}
+	for _, table := range tables {
+		renames.tables[table.Name] = true
+	}
+	return renames, nil
+}
+
+// renamed returns the new name of a table that no longer exists, or false when it exists, was not renamed,
+// or its new name is gone as well.
+func (r *tableRenames) renamed(table string) (string, bool) {
+	if r == nil || r.tables[table] {
+		return "", false
+	}
+	to, ok := r.prefs.RenamedTo(table)
+	return to, ok && r.tables[to]
+}
+
+// query returns the suggested rewrite of a saved query, nil when it names no renamed table.
+func (r *tableRenames) query(entry config.QueryHistoryEntry) *RenameSuggestion {
+	if r == nil {
+		return nil
+	}
+	suggestion := &RenameSuggestion{ID: entry.ID, Renames: make(map[string]string), Query: entry.Query}
+	for _, rename := range r.prefs.Renames {
+		if _, done := suggestion.Renames[rename.From]; done {
+			continue
+		}
+		to, ok := r.renamed(rename.From)
+		if !ok {
+			continue
+		}
+		rewritten, changed := query.RenameIdentifier(r.dbType, suggestion.Query, rename.From, to)
+		if changed {
+			suggestion.Query = rewritten
+			suggestion.Renames[rename.From] = to
+		}
+	}
+	if len(suggestion.Renames) == 0 {
+		return nil
+	}
+	return suggestion
+}
+
+// template returns the suggested rewrite of an export template, nil when its table was not renamed.
+func (r *tableRenames) template(t _client.ExportTemplate) *RenameSuggestion {
+	to, ok := r.renamed(t.Table)
+	if !ok {
+		return nil
+	}
+	return &RenameSuggestion{Template: t.Name, Renames: map[string]string{t.Table: to}, Table: to}
+}
+
+// FixQueryHistoryHandler saves the suggested rewrites of the saved queries naming tables renamed since they ran,
+// or of the one with the id param, and returns them.
+func (h *Handler) FixQueryHistoryHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		var (
+			err         error
+			entries     []config.QueryHistoryEntry
+			suggestions []*RenameSuggestion
+			id          = request.URL.Query().Get("id")
+		)
+
+		if id == "" {
+			entries, err = config.GetQueryHistory(h.client.Key())
+			if err != nil {
+				handleBadRequest(writer, "Failed to read query history", err)
+				return
+			}
+		} else {
+			var entry config.QueryHistoryEntry
+			entry, err = config.FindQueryHistory(id)
+			if err != nil {
+				handleErrorRequest(writer, http.StatusNotFound, "Failed to find query", err)
+				return
+			}
+			if entry.Connection != h.client.Key() {
+				handleBadRequest(writer, "Query was run against another connection", fmt.Errorf("history entry %s belongs to %s", id, entry.Connection))
+				return
+			}
+			entries = []config.QueryHistoryEntry{entry}
+		}
+
+		suggestions, err = h.querySuggestions(entries, true)
+		if err != nil {
+			handleBadRequest(writer, "Failed to rewrite queries naming renamed tables", err)
+			return
+		}
+		handleSuccessRequest(writer, "", RenamedQueriesData{Renamed: suggestions})
+	}
+}
+
+// FixExportTemplateHandler points the named export template at the new name of its renamed table, and returns
+// the rewrite. A template whose table was not renamed is left as is, with a null rewrite.
+func (h *Handler) FixExportTemplateHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		var (
+			err      error
+			prefs    config.Preferences
+			template _client.ExportTemplate
+			found    bool
+			renames  *tableRenames
+			renamed  *RenameSuggestion
+			name     = request.URL.Query().Get("name")
+		)
+
+		if name == "" {
+			handleBadRequest(writer, "Template name is missing or empty", nil)
+			return
+		}
+		prefs, err = config.GetPreferences(h.client.Key())
+		if err != nil {
+			handleBadRequest(writer, "Failed to read export templates", err)
+			return
+		}
+		template, found = prefs.ExportTemplate(name)
+		if !found {
+			handleErrorRequest(writer, http.StatusNotFound, fmt.Sprintf("Export template %s not found", name), nil)
+			return
+		}
+		renames, err = h.loadTableRenames(prefs)
+		if err != nil {
+			handleBadRequest(writer, "Failed to check the template for a renamed table", err)
+			return
+		}
+		if renamed = renames.template(template); renamed != nil {
+			template.Table = renamed.Table
+			if err = config.SaveExportTemplate(h.client.Key(), template); err != nil {
+				handleErrorRequest(writer, http.StatusInternalServerError, "Failed to save export template", err)
+				return
+			}
+			renamed.Applied = true
+		}
+		handleSuccessRequest(writer, "", RenamedTemplateData{Renamed: renamed})
+	}
+}
+
+// autoFix reads the 'autoFix' param, set to save the suggested rewrites.
+func autoFix(params url.Values) bool {
+	fix, _ := strconv.ParseBool(params.Get("autoFix"))
+	return fix
+}
+
+// handleTableRenamed sends a 409 response with the table_renamed code and the suggested rewrite.
+func handleTableRenamed(writer http.ResponseWriter, message string, suggestion *RenameSuggestion) {
+	writer.Header().Set("Content-Type", "application/json")
+	jsonResponse(writer, http.StatusConflict, Response{
+		Message: message,
+		Code:    ErrCodeTableRenamed,
+		Data:    SuggestionData{Suggestion: suggestion},
+	})
+}
+
+// querySuggestions returns the suggested rewrites of the saved queries, saving them when fix is set.
+func (h *Handler) querySuggestions(entries []config.QueryHistoryEntry, fix bool) ([]*RenameSuggestion, error) {
+	prefs, err := config.GetPreferences(h.client.Key())
+	if err != nil {
+		return nil, err
+	}
+	renames, err := h.loadTableRenames(prefs)
+	if err != nil {
+		return nil, err
+	}
+	suggestions := make([]*RenameSuggestion, 0)
+	for i, entry := range entries {
+		suggestion := renames.query(entry)
+		if suggestion == nil {
+			continue
+		}
+		if fix {
+			if entries[i], err = config.UpdateQueryHistory(entry.ID, suggestion.Query); err != nil {
+				return nil, err
+			}
+			suggestion.Applied = true
+		}
+		suggestions = append(suggestions, suggestion)
+	}
+	return suggestions, nil
+}
+
+func (h *Handler) RenameTableHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		if h.rejectReadOnly(writer) {
+			return
+		}
+
+		var (
+			err    error
+			result *query.Result
+			res    api.ResultData
+			msg    string
+			req    RenameTableRequest
+		)
+
+		err = json.NewDecoder(request.Body).Decode(&req)
+		if err != nil {
+			handleBadRequest(writer, "Invalid JSON", err)
+			return
+		}
+
+		if req.TableName == "" || req.NewName == "" {
+			handleBadRequest(writer, "Table or new table name is missing or empty", nil)
+			return
+		}
+
+		if h.rejectSystemTable(writer, "rename", h.client.Schema.Name, req.TableName, req.SystemOverride) {
+			return
+		}
+
+		result, err = query.RenameTable(req.TableName, req.NewName, h.client)
+		if err != nil {
+			msg = fmt.Sprintf("Failed to rename table %s", req.TableName)
+			handleBadRequest(writer, msg, err)
+			return
+		}
+		h.schemaChanged()
+		if err = config.RecordTableRename(h.client.Key(), req.TableName, req.NewName); err != nil {
+			msg = fmt.Sprintf("Table %s was renamed, but the rename could not be recorded", req.TableName)
+			handleErrorRequest(writer, http.StatusInternalServerError, msg, err)
+			return
+		}
+
+		res = api.ResultData{Result: result}
+		handleSuccessRequest(writer, "", res)
+	}
+}
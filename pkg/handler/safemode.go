@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/yazeed1s/sqlweb/pkg/api"
+	"github.com/yazeed1s/sqlweb/pkg/query"
+	"github.com/yazeed1s/sqlweb/pkg/util"
+)
+
+// ErrCodeExecutionToken is the response code sent when a statement is resubmitted in safe mode
+// with a token that cannot run it.
+const ErrCodeExecutionToken = "execution_token_invalid"
+
+// executionTokenTTL is how long a statement explained in safe mode may be confirmed for.
+const executionTokenTTL = 5 * time.Minute
+
+// pendingExecution is a statement explained in safe mode, waiting for its token to come back.
+type pendingExecution struct {
+	query     string
+	expiresAt time.Time
+}
+
+// SafeModePlan is the data of an /execute response in safe mode: the plan of the statement, or why it
+// could not be explained, and the token to send back with the same statement to run it.
+type SafeModePlan struct {
+	Plan           *query.Result `json:"plan,omitempty"`
+	PlanError      string        `json:"planError,omitempty"`
+	ExecutionToken string        `json:"executionToken"`
+	ExpiresAt      time.Time     `json:"expiresAt"`
+}
+
+// inSafeMode reports whether statements must be confirmed before they run on the active connection.
+func (s *session) inSafeMode() bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conn != nil && s.safeMode
+}
+
+// setSafeMode turns safe mode on or off until the next connect. It reports false when there is no connection.
+func (s *session) setSafeMode(enabled bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return false
+	}
+	s.safeMode = enabled
+	if !enabled {
+		s.executions = nil
+	}
+	return true
+}
+
+// issueExecution holds the statement until now+executionTokenTTL and returns the token that runs it.
+// Expired statements are forgotten on the way.
+func (s *session) issueExecution(sqlQuery string, now time.Time) (string, time.Time, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", time.Time{}, err
+	}
+	token := hex.EncodeToString(b)
+	expiresAt := now.Add(executionTokenTTL)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.executions == nil {
+		s.executions = make(map[string]pendingExecution)
+	}
+	for t, pending := range s.executions {
+		if !now.Before(pending.expiresAt) {
+			delete(s.executions, t)
+		}
+	}
+	s.executions[token] = pendingExecution{query: sqlQuery, expiresAt: expiresAt}
+	return token, expiresAt, nil
+}
+
+// redeemExecution checks that the token was issued for this very statement and has not expired.
+// A token is used up by its first redemption, whether it succeeds or not.
+func (s *session) redeemExecution(token, sqlQuery string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pending, ok := s.executions[token]
+	delete(s.executions, token)
+	if !ok || !now.Before(pending.expiresAt) || pending.query != sqlQuery {
+		return util.ErrExecutionToken
+	}
+	return nil
+}
+
+// executionKey is what a token is issued for: the statement and, for saved queries, the values bound to it,
+// so a token cannot run the same statement with other values.
+func executionKey(q *query.Query) string {
+	if len(q.Args) == 0 {
+		return q.SQLQuery
+	}
+	return fmt.Sprintf("%s\x00%#v", q.SQLQuery, q.Args)
+}
+
+// holdForConfirmation applies safe mode to a statement about to run, from /execute, a saved query or the
+// history. Without a token, it answers with the plan of the statement and a token to run it, and returns
+// true. With the token the statement was issued, it returns false so the statement runs. Any other token
+// is refused.
+func (h *Handler) holdForConfirmation(ctx context.Context, writer http.ResponseWriter, q *query.Query, token string) bool {
+	if !h.session.inSafeMode() {
+		return false
+	}
+
+	if token != "" {
+		if err := h.session.redeemExecution(token, executionKey(q), time.Now()); err != nil {
+			writer.Header().Set("Content-Type", "application/json")
+			jsonResponse(writer, http.StatusForbidden, Response{
+				Message: "Statement not confirmed, submit it again without a token to get a new one",
+				Error:   err.Error(),
+				Code:    ErrCodeExecutionToken,
+			})
+			return true
+		}
+		return false
+	}
+
+	var (
+		err  error
+		plan SafeModePlan
+	)
+	plan.Plan, err = query.Explain(ctx, q, h.client)
+	if err != nil {
+		// the statement can still be confirmed, without its plan
+		plan.Plan, plan.PlanError = nil, err.Error()
+	}
+	plan.ExecutionToken, plan.ExpiresAt, err = h.session.issueExecution(executionKey(q), time.Now())
+	if err != nil {
+		handleErrorRequest(writer, http.StatusInternalServerError, "Failed to issue an execution token", err)
+		return true
+	}
+	handleSuccessRequest(writer, "Safe mode: review the plan and submit the statement again with its executionToken to run it", plan)
+	return true
+}
+
+// SafeModeHandler turns the safe mode of the active connection on or off, until the next connect;
+// connections start in the mode saved with them.
+func (h *Handler) SafeModeHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		enabled, err := strconv.ParseBool(request.URL.Query().Get("enabled"))
+		if err != nil {
+			handleBadRequest(writer, "Invalid enabled parameter", err)
+			return
+		}
+		if !h.session.setSafeMode(enabled) {
+			handleBadRequest(writer, "No active connection", fmt.Errorf("connect before setting safe mode"))
+			return
+		}
+		handleSuccessRequest(writer, "", api.SafeModeData{SafeMode: enabled})
+	}
+}
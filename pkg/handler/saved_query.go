@@ -0,0 +1,226 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/yazeed1s/sqlweb/pkg/api"
+	"github.com/yazeed1s/sqlweb/pkg/config"
+	"github.com/yazeed1s/sqlweb/pkg/query"
+)
+
+// ErrCodeMissingParams is the response code sent when a saved query is run without a value for each of its params.
+const ErrCodeMissingParams = "missing_params"
+
+// SaveQueryRequest is the body of the endpoint saving a query. The query may hold :name placeholders,
+// bound to the values given when it runs.
+type SaveQueryRequest struct {
+	Name        string `json:"name"`
+	Query       string `json:"query"`
+	Description string `json:"description"`
+}
+
+// RunSavedQueryRequest is the body of the endpoint running a saved query, with a value for each of its params.
+type RunSavedQueryRequest struct {
+	Name   string                 `json:"name"`
+	Params map[string]interface{} `json:"params"`
+	SystemOverride
+	// ExecutionToken runs a saved query explained in safe mode, with the same params
+	ExecutionToken string `json:"executionToken,omitempty"`
+}
+
+// SavedQueriesHandler lists the saved queries of the connection.
+func (h *Handler) SavedQueriesHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		queries, err := config.GetSavedQueries(h.client.Key())
+		if err != nil {
+			handleErrorRequest(writer, http.StatusInternalServerError, "Failed to read saved queries", err)
+			return
+		}
+		handleSuccessRequest(writer, "", queries)
+	}
+}
+
+// SaveQueryHandler saves a named query of the connection, replacing the one with the same name.
+func (h *Handler) SaveQueryHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		var (
+			err   error
+			req   SaveQueryRequest
+			saved config.SavedQuery
+		)
+
+		if err = json.NewDecoder(request.Body).Decode(&req); err != nil {
+			handleBadRequest(writer, "Invalid JSON", err)
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" {
+			handleBadRequest(writer, "Query name is missing or empty", nil)
+			return
+		}
+		if strings.TrimSpace(req.Query) == "" {
+			handleBadRequest(writer, "Query is missing or empty", nil)
+			return
+		}
+
+		saved, err = config.SaveQuery(config.SavedQuery{
+			Name:        req.Name,
+			Connection:  h.client.Key(),
+			Query:       req.Query,
+			Description: req.Description,
+			Params:      query.QueryParams(h.client.Type.String(), req.Query),
+		})
+		if err != nil {
+			handleErrorRequest(writer, http.StatusInternalServerError, "Failed to save query", err)
+			return
+		}
+		handleSuccessRequest(writer, fmt.Sprintf("Query %s saved", saved.Name), saved)
+	}
+}
+
+// DeleteSavedQueryHandler deletes the named saved query of the connection.
+func (h *Handler) DeleteSavedQueryHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		var (
+			err     error
+			name    string
+			deleted bool
+		)
+
+		name = request.URL.Query().Get("name")
+		if name == "" {
+			handleBadRequest(writer, "Query name is missing or empty", nil)
+			return
+		}
+
+		deleted, err = config.DeleteSavedQuery(h.client.Key(), name)
+		if err != nil {
+			handleErrorRequest(writer, http.StatusInternalServerError, "Failed to delete saved query", err)
+			return
+		}
+		if !deleted {
+			handleErrorRequest(writer, http.StatusNotFound, fmt.Sprintf("Saved query %s not found", name), nil)
+			return
+		}
+		handleSuccessRequest(writer, fmt.Sprintf("Saved query %s deleted", name), nil)
+	}
+}
+
+// RunSavedQueryHandler runs a saved query of the connection. Its placeholders are bound as parameters,
+// never written into the query, and it is checked like a query sent to /execute.
+func (h *Handler) RunSavedQueryHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		var (
+			err     error
+			req     RunSavedQueryRequest
+			decoder *json.Decoder
+			saved   config.SavedQuery
+			found   bool
+			q       *query.Query
+			result  *query.Result
+		)
+
+		decoder = json.NewDecoder(request.Body)
+		decoder.UseNumber()
+		if err = decoder.Decode(&req); err != nil {
+			handleBadRequest(writer, "Invalid JSON", err)
+			return
+		}
+		if req.Name == "" {
+			handleBadRequest(writer, "Query name is missing or empty", nil)
+			return
+		}
+
+		saved, found, err = config.FindSavedQuery(h.client.Key(), req.Name)
+		if err != nil {
+			handleErrorRequest(writer, http.StatusInternalServerError, "Failed to read saved queries", err)
+			return
+		}
+		if !found {
+			handleErrorRequest(writer, http.StatusNotFound, fmt.Sprintf("Saved query %s not found", req.Name), nil)
+			return
+		}
+
+		q = &query.Query{}
+		q.SQLQuery, q.Args, err = query.BindParams(h.client.Type.String(), saved.Query, req.Params)
+		if err != nil {
+			handleParamsError(writer, saved, err)
+			return
+		}
+		if err = h.guardQuery(q); err != nil {
+			handleErrorRequest(writer, http.StatusForbidden, "Query not allowed", err)
+			return
+		}
+
+		if h.rejectSystemQuery(writer, q.SQLQuery, req.SystemOverride) {
+			return
+		}
+		if h.rejectDestructiveQuery(writer, q.SQLQuery, req.SystemOverride) {
+			return
+		}
+		if h.holdForConfirmation(request.Context(), writer, q, req.ExecutionToken) {
+			return
+		}
+
+		result, err = h.executeQuery(request.Context(), q)
+		if err != nil {
+			h.handleRunError(writer, request, "Failed to execute query", sharedRun{SQL: saved.Query, Name: saved.Name, Params: req.Params}, err)
+			return
+		}
+		res := api.SavedQueryRunData{Result: result, Query: saved}
+		if shareable(request) {
+			res.Reproduction = h.reproduction(request, sharedRun{SQL: saved.Query, Name: saved.Name, Params: req.Params}, result)
+		}
+		handleSuccessRequest(writer, "", res)
+	}
+}
+
+// handleParamsError sends a 400 response for parameters that cannot be bound to the saved query. When some
+// are missing, it lists them along with every param of the query.
+func handleParamsError(writer http.ResponseWriter, saved config.SavedQuery, e error) {
+	var missing *query.MissingParamsError
+	if !errors.As(e, &missing) {
+		handleBadRequest(writer, fmt.Sprintf("Invalid parameters for saved query %s", saved.Name), e)
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	jsonResponse(writer, http.StatusBadRequest, Response{
+		Message: fmt.Sprintf("Saved query %s needs a value for %s", saved.Name, strings.Join(missing.Names, ", ")),
+		Error:   e.Error(),
+		Code:    ErrCodeMissingParams,
+		Data:    api.MissingParamsData{Missing: missing.Names, Params: saved.Params},
+	})
+}
@@ -0,0 +1,292 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yazeed1s/sqlweb/db/connection"
+	_sql "github.com/yazeed1s/sqlweb/db/sql"
+	_client "github.com/yazeed1s/sqlweb/pkg/client"
+)
+
+// ErrCodeConnectionLost is sent in Response.Code when a suspended connection could not be reopened.
+const ErrCodeConnectionLost = "connection_lost"
+
+// keepAliveInterval is how often an active connection is pinged so that it is not dropped
+// by the server or a proxy, and how often idleness is checked.
+const keepAliveInterval = time.Minute
+
+// Connection states reported by /connection/stats.
+const (
+	stateDisconnected = "disconnected"
+	stateActive       = "active"
+	stateIdle         = "idle"
+	stateSuspended    = "suspended"
+)
+
+// session tracks the activity of the connection the handler is bound to.
+// When the connection stays idle longer than the idle timeout, its *sql.DB is closed
+// and the session is marked suspended; the connection details are kept so that the
+// next request can transparently reopen it. mu guards the client's Database as well,
+// which is only replaced while no request uses it.
+type session struct {
+	mu           sync.Mutex
+	conn         *connection.Connection
+	lastActivity time.Time
+	suspended    bool
+	// inFlight counts the tracked requests running, during which the connection is never suspended
+	inFlight int
+	// safeMode holds statements sent to /execute back until confirmed with a token of executions, see safemode.go
+	safeMode   bool
+	executions map[string]pendingExecution
+}
+
+// connected records a freshly opened connection.
+func (s *session) connected(conn *connection.Connection) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conn = conn
+	s.lastActivity = time.Now()
+	s.suspended = false
+	s.safeMode = conn.SafeMode
+	s.executions = nil
+}
+
+// disconnected forgets the connection after an explicit disconnect.
+func (s *session) disconnected() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conn = nil
+	s.suspended = false
+	s.safeMode = false
+	s.executions = nil
+}
+
+// reuseConnection keeps the active connection when conn has the same data source, its password
+// and options included, and its pool still answers, so that a double-clicked or retried connect does not open a second pool. The
+// settings of conn replace the current ones and the column cache is dropped, the connect response
+// then reads fresh metadata. It reports whether the connection was kept.
+func (h *Handler) reuseConnection(conn *connection.Connection) bool {
+	h.session.mu.Lock()
+	defer h.session.mu.Unlock()
+
+	if h.session.conn == nil || h.session.suspended || h.client.Database == nil || !connection.SameDataSource(h.session.conn, conn) {
+		return false
+	}
+	if err := h.client.Database.Ping(); err != nil {
+		log.Printf("connection to %s is unhealthy, reconnecting: %v", h.client.Name, err)
+		return false
+	}
+	h.client.Settings = conn.Settings
+	h.client.ResetColumns()
+	// the pool keeps the databases attached to it
+	conn.Attached = connection.Attached(h.client.Database)
+	h.session.conn = conn
+	h.session.safeMode = conn.SafeMode
+	h.session.executions = nil
+	h.session.lastActivity = time.Now()
+	return true
+}
+
+// closeConnection closes the pool of the active connection before it is replaced. Pools already
+// closed, by a disconnect or a suspension, are left alone.
+func (h *Handler) closeConnection() {
+	h.session.mu.Lock()
+	defer h.session.mu.Unlock()
+
+	if h.session.conn == nil || h.session.suspended || h.client.Database == nil {
+		return
+	}
+	if err := connection.Disconnect(h.client.Database); err != nil {
+		log.Println("failed to close the previous connection:", err)
+	}
+}
+
+// SessionStats describes the state of the current connection.
+type SessionStats struct {
+	State           string  `json:"state"`
+	LastActivity    string  `json:"last_activity,omitempty"`
+	IdleSeconds     float64 `json:"idle_seconds"`
+	IdleTimeout     string  `json:"idle_timeout"`
+	OpenConnections int     `json:"open_connections"`
+	InUse           int     `json:"in_use"`
+	Idle            int     `json:"idle"`
+	// MaxOpenConnections is the limit of the pool, 0 when it has none
+	MaxOpenConnections int `json:"max_open_connections"`
+	// SQLite holds the effective settings of SQLite connections
+	SQLite *_client.SQLitePragmas `json:"sqlite,omitempty"`
+	// SafeMode tells whether statements sent to /execute are explained and held until confirmed
+	SafeMode bool `json:"safe_mode"`
+}
+
+// SetIdleTimeout sets how long a connection may stay unused before it is suspended.
+// A zero timeout never suspends connections.
+func (h *Handler) SetIdleTimeout(timeout time.Duration) {
+	h.idleTimeout = timeout
+}
+
+// StartIdleMonitor starts the background goroutine that keeps active connections alive
+// and suspends idle ones. It runs for the lifetime of the process.
+func (h *Handler) StartIdleMonitor() {
+	interval := keepAliveInterval
+	if h.idleTimeout > 0 && h.idleTimeout/2 < interval {
+		interval = h.idleTimeout / 2
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			h.checkIdle(now)
+		}
+	}()
+}
+
+// checkIdle suspends the connection if it has been idle longer than the idle timeout and no request uses it,
+// and pings it otherwise. Suspended connections are left alone.
+func (h *Handler) checkIdle(now time.Time) {
+	h.session.mu.Lock()
+	defer h.session.mu.Unlock()
+
+	if h.session.conn == nil || h.session.suspended || h.client.Database == nil {
+		return
+	}
+
+	if h.idleTimeout > 0 && now.Sub(h.session.lastActivity) >= h.idleTimeout && h.session.inFlight == 0 {
+		if err := connection.Disconnect(h.client.Database); err != nil {
+			log.Println("failed to close idle connection:", err)
+		}
+		h.session.suspended = true
+		log.Printf("connection to %s suspended after %s of inactivity", h.client.Name, h.idleTimeout)
+		return
+	}
+
+	if err := h.client.Database.Ping(); err != nil {
+		log.Println("keep-alive ping failed:", err)
+	}
+}
+
+// resume marks activity on the session and reopens the connection if it was suspended. Once it returns
+// without an error, the request is counted in flight until done is called.
+func (h *Handler) resume() error {
+	h.session.mu.Lock()
+	defer h.session.mu.Unlock()
+
+	h.session.lastActivity = time.Now()
+	if !h.session.suspended {
+		h.session.inFlight++
+		return nil
+	}
+
+	var (
+		db  *sql.DB
+		err error
+	)
+	db, err = connection.ConnectToDatabase(h.session.conn, h.session.conn.Type.String())
+	if err != nil {
+		return err
+	}
+	h.client.Database = db
+	h.session.suspended = false
+	h.session.inFlight++
+	log.Printf("connection to %s resumed", h.client.Name)
+	return nil
+}
+
+// done marks the end of a request counted by resume. The connection has been idle since.
+func (h *Handler) done() {
+	h.session.mu.Lock()
+	defer h.session.mu.Unlock()
+
+	h.session.inFlight--
+	h.session.lastActivity = time.Now()
+}
+
+// Track wraps a handler that uses the database connection: it records the activity and
+// reopens a suspended connection first, answering with the connection_lost code if that fails.
+// The connection is not suspended while the handler runs.
+func (h *Handler) Track(next http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if err := h.resume(); err != nil {
+			handleConnectionLost(writer, err)
+			return
+		}
+		defer h.done()
+		next(writer, request)
+	}
+}
+
+// handleConnectionLost sends a JSON response telling the client the connection must be re-established.
+func handleConnectionLost(writer http.ResponseWriter, e error) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusServiceUnavailable)
+	response := Response{
+		Message: "Connection lost, please reconnect",
+		Error:   e.Error(),
+		Code:    ErrCodeConnectionLost,
+	}
+	if err := json.NewEncoder(writer).Encode(response); err != nil {
+		http.Error(writer, "Error encoding JSON response", http.StatusInternalServerError)
+	}
+}
+
+// stats returns the current state of the session.
+func (h *Handler) stats() SessionStats {
+	h.session.mu.Lock()
+	defer h.session.mu.Unlock()
+
+	stats := SessionStats{
+		State:       stateDisconnected,
+		IdleTimeout: h.idleTimeout.String(),
+	}
+	if h.session.conn == nil {
+		return stats
+	}
+
+	idle := time.Since(h.session.lastActivity)
+	stats.SafeMode = h.session.safeMode
+	stats.LastActivity = h.session.lastActivity.Format(time.RFC3339)
+	stats.IdleSeconds = idle.Seconds()
+	switch {
+	case h.session.suspended:
+		stats.State = stateSuspended
+	case idle >= keepAliveInterval:
+		stats.State = stateIdle
+	default:
+		stats.State = stateActive
+	}
+
+	if !h.session.suspended && h.client.Database != nil {
+		dbStats := h.client.Database.Stats()
+		stats.OpenConnections = dbStats.OpenConnections
+		stats.InUse = dbStats.InUse
+		stats.Idle = dbStats.Idle
+		stats.MaxOpenConnections = dbStats.MaxOpenConnections
+		if strings.EqualFold(h.client.Type.String(), _sql.SQLite.String()) {
+			pragmas, err := h.client.GetSQLitePragmas()
+			if err != nil {
+				log.Println("failed to read SQLite pragmas:", err)
+			}
+			stats.SQLite = pragmas
+		}
+	}
+	return stats
+}
+
+func (h *Handler) ConnectionStatsHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		handleSuccessRequest(writer, "", h.stats())
+	}
+}
@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/yazeed1s/sqlweb/pkg/api"
+	_client "github.com/yazeed1s/sqlweb/pkg/client"
+	"github.com/yazeed1s/sqlweb/pkg/query"
+	"github.com/yazeed1s/sqlweb/pkg/util"
+)
+
+// redacted replaces the secrets left out of a reproduction.
+const redacted = "<redacted>"
+
+// secretParam matches the names of the params whose values are redacted
+var secretParam = regexp.MustCompile(`(?i)pass|secret|token|credential|api_?key`)
+
+// SetVersion sets the sqlweb version reported in the reproductions of shareable queries.
+func (h *Handler) SetVersion(version string) {
+	h.version = version
+}
+
+// shareable reports whether the request asks for a reproduction of its query with shareable=true.
+func shareable(request *http.Request) bool {
+	share, _ := strconv.ParseBool(request.URL.Query().Get("shareable"))
+	return share
+}
+
+// sharedRun is a query that ran, as it is shared: the SQL of /execute, or a saved query with its params.
+type sharedRun struct {
+	SQL string
+	// Name is the saved query run with Params, empty for /execute
+	Name      string
+	Params    map[string]interface{}
+	TimeoutMs int
+}
+
+// reproduction builds the reproduction of a query that ran on the handler's connection, its curl command
+// targeting the API the request came through.
+func (h *Handler) reproduction(request *http.Request, run sharedRun, result *query.Result) *api.Reproduction {
+	scheme := "http"
+	if request.TLS != nil {
+		scheme = "https"
+	}
+	return newReproduction(h.client, h.version, scheme+"://"+request.Host, run, result)
+}
+
+// handleRunError sends the error response of a query that failed, with the reproduction of the run in its
+// data when the request asks for one, so that the failure can be shared as well.
+func (h *Handler) handleRunError(writer http.ResponseWriter, request *http.Request, message string, run sharedRun, e error) {
+	if !shareable(request) || errors.Is(e, util.ErrResultTooLarge) {
+		handleResultError(writer, message, e)
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	jsonResponse(writer, http.StatusBadRequest, Response{
+		Message: message,
+		Error:   e.Error(),
+		Data:    api.ReproductionData{Reproduction: h.reproduction(request, run, nil)},
+	})
+}
+
+// newReproduction describes the run for sharing. Only the type, address, database and schema of the client are
+// kept, passwords in the SQL are redacted and so are the params whose names look secret, e.g. api_key.
+func newReproduction(c *_client.Client, version, baseURL string, run sharedRun, result *query.Result) *api.Reproduction {
+	var (
+		sqlQuery = query.RedactSecrets(c.Type.String(), run.SQL, redacted)
+		params   map[string]interface{}
+		path     string
+		body     = make(map[string]interface{})
+	)
+
+	if run.Name == "" {
+		path = "/execute"
+		body["query"] = sqlQuery
+		if run.TimeoutMs > 0 {
+			body["timeoutMs"] = run.TimeoutMs
+		}
+	} else {
+		path = "/queries/run"
+		params = make(map[string]interface{}, len(run.Params))
+		for name, value := range run.Params {
+			if secretParam.MatchString(name) {
+				value = redacted
+			}
+			params[name] = value
+		}
+		body["name"] = run.Name
+		body["params"] = params
+	}
+
+	reproduction := &api.Reproduction{
+		SQL:        sqlQuery,
+		Params:     params,
+		Connection: sharedConnection(c),
+		Version:    version,
+		Curl:       curlCommand(strings.TrimSuffix(baseURL, "/")+path, body),
+	}
+	if result != nil {
+		reproduction.TimeMS = result.TimeMS
+	}
+	return reproduction
+}
+
+// sharedConnection describes the database of the client, leaving out its user, password and credentials.
+func sharedConnection(c *_client.Client) api.SharedConnection {
+	host := c.Host
+	// a host is never given with credentials, but one that is must not leak them
+	if i := strings.LastIndexByte(host, '@'); i >= 0 {
+		host = host[i+1:]
+	}
+	path, _, _ := strings.Cut(c.Path, "?")
+	return api.SharedConnection{
+		Type:     strings.ToLower(c.Type.String()),
+		Host:     host,
+		Port:     c.Port,
+		Database: c.Name,
+		Path:     path,
+		Schema:   c.Schema.Name,
+	}
+}
+
+// curlCommand returns a curl command posting the body to the url, quoted for POSIX shells.
+func curlCommand(url string, body map[string]interface{}) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	// keep the SQL readable, e.g. a < comparison
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(body); err != nil {
+		// the body only holds values decoded from JSON
+		return ""
+	}
+	return fmt.Sprintf("curl -X POST %s -H %s --data-raw %s",
+		shellQuote(url), shellQuote("Content-Type: application/json"), shellQuote(strings.TrimSuffix(buf.String(), "\n")))
+}
+
+// shellQuote quotes s in single quotes, closing and reopening them around the single quotes it holds.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/yazeed1s/sqlweb/pkg/api"
+	"github.com/yazeed1s/sqlweb/pkg/query"
+	"github.com/yazeed1s/sqlweb/pkg/util"
+)
+
+// ErrCodeSystemSchema is the response code sent when a mutation targets a system schema.
+const ErrCodeSystemSchema = "system_schema"
+
+// confirmKey signs the confirmation tokens handed out when a mutation is refused.
+// It is generated per process, so tokens do not survive a restart.
+var confirmKey = newConfirmKey()
+
+func newConfirmKey() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// SystemOverride lets a request mutate a system schema, or run a destructive operation that needs
+// confirmation. Both fields are required: AllowSystem states the intent and ConfirmToken is the token
+// returned by the refused attempt.
+type SystemOverride struct {
+	AllowSystem  bool   `json:"allowSystem"`
+	ConfirmToken string `json:"confirmToken"`
+}
+
+// QueryRequest is the body of the query endpoint.
+type QueryRequest struct {
+	query.Query
+	SystemOverride
+	// ExecutionToken runs a statement explained in safe mode, see SafeModePlan
+	ExecutionToken string `json:"executionToken,omitempty"`
+}
+
+// systemOverrideFromURL reads the override from the optional allowSystem and confirmToken URL parameters,
+// and returns the number of parameters it consumed so they can be discounted by checkURLParams.
+func systemOverrideFromURL(u *url.URL) (SystemOverride, int) {
+	var (
+		override SystemOverride
+		params   url.Values
+		count    int
+	)
+
+	params = u.Query()
+	if params.Has("allowSystem") {
+		override.AllowSystem, _ = strconv.ParseBool(params.Get("allowSystem"))
+		count++
+	}
+	if params.Has("confirmToken") {
+		override.ConfirmToken = params.Get("confirmToken")
+		count++
+	}
+	return override, count
+}
+
+// confirmationToken signs the operation so that the token is only valid for that exact operation.
+func confirmationToken(subject string) string {
+	mac := hmac.New(sha256.New, confirmKey)
+	mac.Write([]byte(subject))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// allows reports whether the override confirms the operation identified by subject.
+func (o SystemOverride) allows(subject string) bool {
+	return o.AllowSystem && hmac.Equal([]byte(o.ConfirmToken), []byte(confirmationToken(subject)))
+}
+
+// rejectSystemQuery sends a 403 response and returns true when the query writes to a system schema
+// and the request does not carry a valid override.
+func (h *Handler) rejectSystemQuery(writer http.ResponseWriter, sqlQuery string, override SystemOverride) bool {
+	targets := query.SystemTargets(h.client.Type.String(), h.client.Schema.Name, sqlQuery)
+	if len(targets) == 0 || override.allows(sqlQuery) {
+		return false
+	}
+	handleSystemSchema(writer, targets, confirmationToken(sqlQuery))
+	return true
+}
+
+// rejectSystemTable sends a 403 response and returns true when the operation targets a system table
+// or schema and the request does not carry a valid override. An empty table targets the whole schema.
+func (h *Handler) rejectSystemTable(writer http.ResponseWriter, operation, schema, table string, override SystemOverride) bool {
+	if !query.IsSystemTable(h.client.Type.String(), schema, table) {
+		return false
+	}
+	subject := operation + ":" + schema + "." + table
+	if override.allows(subject) {
+		return false
+	}
+	handleSystemSchema(writer, []query.TableRef{{Schema: schema, Table: table}}, confirmationToken(subject))
+	return true
+}
+
+// handleSystemSchema sends a JSON response listing the protected targets along with the token
+// the client must send back, together with allowSystem, to confirm the operation.
+func handleSystemSchema(writer http.ResponseWriter, targets []query.TableRef, token string) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusForbidden)
+	response := Response{
+		Message: "Operation targets a system schema",
+		Error:   util.ErrSystemSchema.Error(),
+		Code:    ErrCodeSystemSchema,
+		Data:    api.SystemSchemaData{Targets: targets, ConfirmToken: token},
+	}
+	if err := json.NewEncoder(writer).Encode(response); err != nil {
+		http.Error(writer, "Error encoding JSON response", http.StatusInternalServerError)
+	}
+}
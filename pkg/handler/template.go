@@ -0,0 +1,334 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	_client "github.com/yazeed1s/sqlweb/pkg/client"
+	"github.com/yazeed1s/sqlweb/pkg/config"
+)
+
+const (
+	// sampleRows is the number of rows of a download buffered before streaming it, to estimate its size
+	sampleRows = 100
+	// progressCommentRows is how often a CSV download asked for progress comments reports the rows written
+	progressCommentRows = 10000
+	// defaultStreamBatchRows is how many rows of a download are sent at once unless the streamBatchRows setting changes it
+	defaultStreamBatchRows = 100
+
+	expectedRowsHeader   = "X-Expected-Rows"
+	estimatedBytesHeader = "X-Estimated-Bytes"
+	exportedRowsTrailer  = "X-Exported-Rows"
+)
+
+// downloadWriter sends the headers of a file download on the first write, so an export
+// that fails before writing anything can still be answered with a JSON error.
+//
+// Told how many rows to expect, see client.ExportProgress, it buffers the first rows and sends
+// the expected rows along with a size estimated from their average width. The number of rows
+// written is sent in a trailer once the download is finished.
+//
+// The rows are sent and flushed to the client by batches of batch rows, fewer writes and flushes
+// trading a little latency for throughput.
+type downloadWriter struct {
+	writer      http.ResponseWriter
+	fileName    string
+	contentType string
+	// omitted are the columns left out of the download, see setOmittedColumns
+	omitted []string
+	// trailers are sent once the download is finished, along with exportedRowsTrailer
+	trailers []string
+	// comments writes a '# <rows> rows exported' line every progressCommentRows rows, for CSV downloads only
+	comments bool
+	started  bool
+	// expected is the estimated number of rows, -1 without an estimate
+	expected int64
+	rows     int64
+	sample   bytes.Buffer
+	// batch is the number of rows sent at once, pending holds those of the batch being written
+	batch   int64
+	pending bytes.Buffer
+	// err is the error of sending a batch, returned by the next write
+	err error
+}
+
+// newDownloadWriter returns a downloadWriter without an estimate of its rows, sending them by batches of batch rows,
+// defaultStreamBatchRows when batch is 0.
+func newDownloadWriter(writer http.ResponseWriter, fileName, contentType string, batch int) *downloadWriter {
+	if batch <= 0 {
+		batch = defaultStreamBatchRows
+	}
+	return &downloadWriter{writer: writer, fileName: fileName, contentType: contentType, expected: -1, batch: int64(batch)}
+}
+
+// sampling tells whether the rows are buffered to estimate the size of the download.
+func (d *downloadWriter) sampling() bool {
+	return !d.started && d.expected >= 0
+}
+
+func (d *downloadWriter) Write(p []byte) (int, error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+	if d.sampling() {
+		return d.sample.Write(p)
+	}
+	if !d.started {
+		d.start(-1)
+	}
+	return d.pending.Write(p)
+}
+
+// ExpectRows records the estimated number of rows of the download, see client.ExportProgress.
+func (d *downloadWriter) ExpectRows(rows int64) {
+	d.expected = rows
+}
+
+// RowWritten counts the rows written, see client.ExportProgress. The download starts once the sample is complete,
+// and a batch is sent every batch rows; an error sending them surfaces on the next write.
+func (d *downloadWriter) RowWritten() {
+	d.rows++
+	if d.sampling() && d.rows == sampleRows {
+		d.sendSample(false)
+	}
+	if d.comments && d.rows%progressCommentRows == 0 {
+		_, _ = fmt.Fprintf(d, "# %d rows exported\n", d.rows)
+	}
+	if d.started && d.err == nil && d.rows%d.batch == 0 {
+		d.err = d.flush()
+	}
+}
+
+// sendSample starts the download with the size estimated from the sampled rows, the exact one when
+// the download is done, and adds them to the batch being written.
+func (d *downloadWriter) sendSample(done bool) {
+	size := int64(d.sample.Len())
+	if done {
+		d.expected = d.rows
+	} else if d.expected > d.rows {
+		size = int64(float64(size) / float64(d.rows) * float64(d.expected))
+	}
+	d.start(size)
+	_, _ = d.sample.WriteTo(&d.pending)
+}
+
+// flush sends the rows of the batch being written and flushes them to the client.
+func (d *downloadWriter) flush() error {
+	if _, err := d.pending.WriteTo(d.writer); err != nil {
+		return err
+	}
+	err := http.NewResponseController(d.writer).Flush()
+	if errors.Is(err, http.ErrNotSupported) {
+		return nil
+	}
+	return err
+}
+
+// start sends the headers of the download, with the expected rows and the estimated size when known.
+func (d *downloadWriter) start(size int64) {
+	d.started = true
+	setOmittedColumns(d.writer, d.omitted)
+	d.writer.Header().Set("Content-Type", d.contentType)
+	d.writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", d.fileName))
+	if d.expected >= 0 {
+		d.writer.Header().Set(expectedRowsHeader, strconv.FormatInt(d.expected, 10))
+	}
+	if size >= 0 {
+		d.writer.Header().Set(estimatedBytesHeader, strconv.FormatInt(size, 10))
+	}
+	d.writer.Header().Set("Trailer", strings.Join(append([]string{exportedRowsTrailer}, d.trailers...), ", "))
+	d.writer.WriteHeader(http.StatusAccepted)
+}
+
+// finish sends the rows still buffered and the number of rows written, once the export is done.
+func (d *downloadWriter) finish() error {
+	if d.sampling() {
+		d.sendSample(true)
+	}
+	if !d.started {
+		d.start(-1)
+	}
+	if err := d.flush(); err != nil {
+		return err
+	}
+	d.writer.Header().Set(exportedRowsTrailer, strconv.FormatInt(d.rows, 10))
+	return nil
+}
+
+func (h *Handler) ExportTemplatesHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		var (
+			err   error
+			prefs config.Preferences
+		)
+
+		prefs, err = config.GetPreferences(h.client.Key())
+		if err != nil {
+			handleBadRequest(writer, "Failed to read export templates", err)
+			return
+		}
+		templates := prefs.Templates
+		if templates == nil {
+			templates = []_client.ExportTemplate{}
+		}
+		handleSuccessRequest(writer, "", templates)
+	}
+}
+
+// SaveExportTemplateHandler saves the template sent as the body, replacing the one with the same name.
+// Its columns are only checked against the table when it runs, since the table may change in between.
+func (h *Handler) SaveExportTemplateHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		var (
+			err      error
+			template _client.ExportTemplate
+			decoder  *json.Decoder
+		)
+
+		decoder = json.NewDecoder(request.Body)
+		decoder.UseNumber()
+		if err = decoder.Decode(&template); err != nil {
+			handleBadRequest(writer, "Invalid JSON", err)
+			return
+		}
+		template.Format = strings.ToLower(template.Format)
+		if err = template.Validate(); err != nil {
+			handleBadRequest(writer, "Invalid export template", err)
+			return
+		}
+		if err = h.client.CheckExportPolicy(template.Table, template.Sources()); err != nil {
+			handleExportError(writer, "Invalid export template", err)
+			return
+		}
+
+		if err = config.SaveExportTemplate(h.client.Key(), template); err != nil {
+			handleErrorRequest(writer, http.StatusInternalServerError, "Failed to save export template", err)
+			return
+		}
+		handleSuccessRequest(writer, fmt.Sprintf("Export template %s saved", template.Name), template)
+	}
+}
+
+func (h *Handler) DeleteExportTemplateHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		var (
+			err     error
+			name    string
+			deleted bool
+		)
+
+		name = request.URL.Query().Get("name")
+		if name == "" {
+			handleBadRequest(writer, "Template name is missing or empty", nil)
+			return
+		}
+
+		deleted, err = config.DeleteExportTemplate(h.client.Key(), name)
+		if err != nil {
+			handleErrorRequest(writer, http.StatusInternalServerError, "Failed to delete export template", err)
+			return
+		}
+		if !deleted {
+			handleErrorRequest(writer, http.StatusNotFound, fmt.Sprintf("Export template %s not found", name), nil)
+			return
+		}
+		handleSuccessRequest(writer, fmt.Sprintf("Export template %s deleted", name), nil)
+	}
+}
+
+// RunExportTemplateHandler streams the export the named template describes. A template referring to
+// a column that no longer exists fails before anything is sent, naming the column.
+func (h *Handler) RunExportTemplateHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		var (
+			err      error
+			name     string
+			prefs    config.Preferences
+			template _client.ExportTemplate
+			found    bool
+			download *downloadWriter
+			renames  *tableRenames
+			renamed  *RenameSuggestion
+		)
+
+		name = request.URL.Query().Get("name")
+		if name == "" {
+			handleBadRequest(writer, "Template name is missing or empty", nil)
+			return
+		}
+
+		prefs, err = config.GetPreferences(h.client.Key())
+		if err != nil {
+			handleBadRequest(writer, "Failed to read export templates", err)
+			return
+		}
+		template, found = prefs.ExportTemplate(name)
+		if !found {
+			handleErrorRequest(writer, http.StatusNotFound, fmt.Sprintf("Export template %s not found", name), nil)
+			return
+		}
+		renames, err = h.loadTableRenames(prefs)
+		if err != nil {
+			handleBadRequest(writer, "Failed to check the template for a renamed table", err)
+			return
+		}
+		if renamed = renames.template(template); renamed != nil {
+			handleTableRenamed(writer, fmt.Sprintf("The table of export template %s was renamed, fix the template to use its new name", name), renamed)
+			return
+		}
+
+		download = newDownloadWriter(writer, template.Name+"."+template.Format, "text/csv", h.client.Settings.StreamBatchRows)
+		if template.Format == _client.TemplateJSON {
+			download.contentType = "application/json"
+		} else {
+			download.comments, _ = strconv.ParseBool(request.URL.Query().Get("progressComments"))
+		}
+		download.omitted = exportExclude(request.URL.Query())
+		err = h.client.ExportWithTemplate(request.Context(), &template, download.omitted, download)
+		if err != nil && !download.started {
+			handleExportError(writer, fmt.Sprintf("Failed to run export template %s", name), err)
+			return
+		}
+		if err == nil {
+			h.recordUsage(template.Table, usageExport)
+			_ = download.finish()
+		} else {
+			// the rows written before the export failed are still sent
+			_ = download.flush()
+		}
+	}
+}
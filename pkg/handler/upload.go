@@ -0,0 +1,689 @@
+package handler
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yazeed1s/sqlweb/pkg/api"
+	"github.com/yazeed1s/sqlweb/pkg/query"
+	"github.com/yazeed1s/sqlweb/pkg/util"
+)
+
+// ErrCodeUploadOffset is the response code sent when a chunk does not start at the committed offset
+// of its upload, or an upload is completed before all of its bytes arrived. The response carries the
+// upload status, so the client can resume from the committed offset.
+const ErrCodeUploadOffset = "upload_offset"
+
+const (
+	// maxChunkSize bounds the body of a single chunk
+	maxChunkSize = 16 << 20
+	// maxUploadSize bounds the size of an upload, announced or not
+	maxUploadSize = 1 << 30
+	// maxUploadSessions bounds the number of uploads in progress at once
+	maxUploadSessions = 8
+	// maxUploadReserved bounds the bytes the uploads in progress may hold together; an upload left open
+	// reserves maxUploadSize
+	maxUploadReserved = 4 << 30
+	// uploadTTL is how long an upload is kept after its last chunk
+	uploadTTL = 24 * time.Hour
+	// uploadSweepInterval is how often expired uploads are removed
+	uploadSweepInterval = 10 * time.Minute
+)
+
+// importers are the pipelines a completed upload can be handed to, by name. An importer writes the response
+// and reports whether it consumed the file; a refused or failed import keeps the upload so it can be completed
+// again, e.g. with a confirmation token.
+// The importer reads at most maxSize bytes of the file.
+var importers = map[string]func(h *Handler, writer http.ResponseWriter, path string, maxSize int64, override SystemOverride) bool{
+	"sql": (*Handler).importSQL,
+}
+
+// UploadInitRequest is the body of /upload/init. Size is the total size of the file in bytes;
+// 0 leaves it open, and the upload is then complete whenever the client says so.
+type UploadInitRequest struct {
+	Size     int64  `json:"size"`
+	Pipeline string `json:"pipeline"`
+}
+
+// UploadCompleteRequest is the body of /upload/complete.
+type UploadCompleteRequest struct {
+	ID string `json:"id"`
+	SystemOverride
+}
+
+// UploadStatus describes an upload. Offset is the number of bytes committed so far,
+// where the next chunk must start.
+type UploadStatus struct {
+	ID        string    `json:"id"`
+	Pipeline  string    `json:"pipeline"`
+	Size      int64     `json:"size"`
+	Offset    int64     `json:"offset"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// upload is a file being received chunk by chunk into a temporary file.
+// Its mutex serializes chunks, so a retried chunk racing the original is refused by the offset check.
+type upload struct {
+	mu     sync.Mutex
+	status UploadStatus
+	path   string
+	// max is the number of bytes the upload may hold: its size, or the upload cap when it is left open
+	max int64
+}
+
+// uploads keeps the upload sessions. The temporary directory is created with the first upload.
+type uploads struct {
+	mu       sync.Mutex
+	dir      string
+	sessions map[string]*upload
+	now      func() time.Time
+	// max bounds the size of an upload
+	max int64
+	// maxSessions and maxReserved bound the uploads in progress, see maxUploadSessions and maxUploadReserved
+	maxSessions int
+	maxReserved int64
+}
+
+func newUploads() *uploads {
+	return &uploads{
+		sessions:    make(map[string]*upload),
+		now:         time.Now,
+		max:         maxUploadSize,
+		maxSessions: maxUploadSessions,
+		maxReserved: maxUploadReserved,
+	}
+}
+
+// create starts an upload with an empty temporary file. It fails with util.ErrTooManyUploads when
+// as many uploads are in progress as allowed, and with util.ErrUploadReserve when the upload does not
+// fit in the bytes they may hold together. Expired uploads are removed first, so they do not count.
+func (u *uploads) create(size int64, pipeline string) (*upload, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	var (
+		err      error
+		id       []byte
+		file     *os.File
+		reserved int64
+		reserve  = size
+		now      = u.now()
+	)
+
+	if size == 0 {
+		reserve = u.max
+	}
+	for key, up := range u.sessions {
+		if now.After(up.status.ExpiresAt) {
+			u.removeLocked(key)
+			continue
+		}
+		reserved += up.max
+	}
+	if len(u.sessions) >= u.maxSessions {
+		return nil, util.ErrTooManyUploads
+	}
+	if reserved+reserve > u.maxReserved {
+		return nil, util.ErrUploadReserve
+	}
+
+	if u.dir == "" {
+		u.dir, err = os.MkdirTemp("", "sqlweb-uploads-")
+		if err != nil {
+			return nil, err
+		}
+	}
+	id = make([]byte, 16)
+	if _, err = rand.Read(id); err != nil {
+		return nil, err
+	}
+	up := &upload{
+		status: UploadStatus{
+			ID:        hex.EncodeToString(id),
+			Pipeline:  pipeline,
+			Size:      size,
+			ExpiresAt: now.Add(uploadTTL),
+		},
+		max: reserve,
+	}
+	up.path = filepath.Join(u.dir, up.status.ID)
+	file, err = os.OpenFile(up.path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err = file.Close(); err != nil {
+		return nil, err
+	}
+	u.sessions[up.status.ID] = up
+	return up, nil
+}
+
+// get returns the upload with the given id, or nil when there is none or it expired.
+func (u *uploads) get(id string) *upload {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	up, ok := u.sessions[id]
+	if !ok {
+		return nil
+	}
+	if u.now().After(up.status.ExpiresAt) {
+		u.removeLocked(id)
+		return nil
+	}
+	return up
+}
+
+// remove forgets the upload and deletes its file.
+func (u *uploads) remove(id string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.removeLocked(id)
+}
+
+func (u *uploads) removeLocked(id string) {
+	up, ok := u.sessions[id]
+	if !ok {
+		return
+	}
+	delete(u.sessions, id)
+	if err := os.Remove(up.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Println("failed to remove upload:", err)
+	}
+}
+
+// sweep removes the expired uploads.
+func (u *uploads) sweep() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	now := u.now()
+	for id, up := range u.sessions {
+		if now.After(up.status.ExpiresAt) {
+			u.removeLocked(id)
+		}
+	}
+}
+
+// close removes every upload along with the temporary directory.
+func (u *uploads) close() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for id := range u.sessions {
+		u.removeLocked(id)
+	}
+	if u.dir == "" {
+		return nil
+	}
+	dir := u.dir
+	u.dir = ""
+	return os.RemoveAll(dir)
+}
+
+// StartUploadSweeper starts the background goroutine that removes expired uploads.
+// It runs for the lifetime of the process.
+func (h *Handler) StartUploadSweeper() {
+	go func() {
+		ticker := time.NewTicker(uploadSweepInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			h.uploads.sweep()
+		}
+	}()
+}
+
+// CloseUploads removes every pending upload. It is called on shutdown.
+func (h *Handler) CloseUploads() error {
+	return h.uploads.close()
+}
+
+// UploadInitHandler starts an upload and returns its id.
+func (h *Handler) UploadInitHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		if h.rejectReadOnly(writer) {
+			return
+		}
+
+		var (
+			err error
+			req UploadInitRequest
+			up  *upload
+		)
+
+		err = json.NewDecoder(request.Body).Decode(&req)
+		if err != nil {
+			handleBadRequest(writer, "Invalid JSON", err)
+			return
+		}
+		if _, ok := importers[req.Pipeline]; !ok {
+			handleBadRequest(writer, "Unknown import pipeline", fmt.Errorf("pipeline %q is not one of: %s", req.Pipeline, pipelineNames()))
+			return
+		}
+		if req.Size < 0 {
+			handleBadRequest(writer, "Invalid upload size", fmt.Errorf("size must not be negative"))
+			return
+		}
+		if req.Size > h.uploads.max {
+			handleErrorRequest(writer, http.StatusRequestEntityTooLarge, "Upload too large",
+				fmt.Errorf("size must not exceed %d bytes", h.uploads.max))
+			return
+		}
+
+		up, err = h.uploads.create(req.Size, req.Pipeline)
+		switch {
+		case errors.Is(err, util.ErrTooManyUploads):
+			handleErrorRequest(writer, http.StatusTooManyRequests, "Too many uploads in progress", err)
+			return
+		case errors.Is(err, util.ErrUploadReserve):
+			handleErrorRequest(writer, http.StatusRequestEntityTooLarge, "Upload too large", err)
+			return
+		case err != nil:
+			handleErrorRequest(writer, http.StatusInternalServerError, "Failed to start upload", err)
+			return
+		}
+		handleSuccessRequest(writer, "", up.status)
+	}
+}
+
+// UploadChunkHandler appends a chunk to an upload. The chunk must start at the committed offset
+// and match its SHA-256 checksum; a chunk that fails either check is not committed. A compressed chunk
+// is decompressed first, its checksum and size are those of the decompressed bytes.
+func (h *Handler) UploadChunkHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		var (
+			err    error
+			up     *upload
+			offset int64
+			params = request.URL.Query()
+		)
+
+		err = checkURLParams(request.URL, 3)
+		if err != nil {
+			handleBadRequest(writer, "", err)
+			return
+		}
+		offset, err = strconv.ParseInt(params.Get("offset"), 10, 64)
+		if err != nil {
+			handleBadRequest(writer, "Invalid offset", err)
+			return
+		}
+
+		up = h.uploads.get(params.Get("id"))
+		if up == nil {
+			handleErrorRequest(writer, http.StatusNotFound, "Upload not found", fmt.Errorf("no upload with id %q, it may have expired", params.Get("id")))
+			return
+		}
+		body, ok := requestBody(writer, request)
+		if !ok {
+			return
+		}
+
+		up.mu.Lock()
+		defer up.mu.Unlock()
+		if offset != up.status.Offset {
+			handleUploadOffset(writer, "Chunk does not start at the committed offset", up.status)
+			return
+		}
+
+		written, err := appendChunk(writer, body, up, strings.ToLower(params.Get("sha256")))
+		if err != nil {
+			var tooBig *http.MaxBytesError
+			switch {
+			case errors.As(err, &tooBig):
+				handleErrorRequest(writer, http.StatusRequestEntityTooLarge, "Chunk too large", err)
+			case errors.Is(err, errChecksum):
+				handleBadRequest(writer, "Chunk checksum mismatch", err)
+			case errors.Is(err, errCorruptBody):
+				handleBadRequest(writer, "Corrupt compressed chunk", err)
+			default:
+				handleBadRequest(writer, "Failed to write chunk", err)
+			}
+			return
+		}
+
+		up.status.Offset += written
+		up.status.ExpiresAt = h.uploads.now().Add(uploadTTL)
+		handleSuccessRequest(writer, "", up.status)
+	}
+}
+
+var errChecksum = errors.New("chunk does not match its sha256 checksum")
+
+// errCorruptBody is returned while reading a compressed request body that does not decompress.
+var errCorruptBody = errors.New("corrupt compressed body")
+
+// requestBody returns the body of an import request, decompressed per its Content-Encoding: gzip, deflate
+// or none. A corrupt body fails to read with errCorruptBody. Other encodings are refused with a 415.
+func requestBody(writer http.ResponseWriter, request *http.Request) (io.Reader, bool) {
+	var (
+		err    error
+		reader io.Reader
+	)
+
+	switch encoding := strings.ToLower(strings.TrimSpace(request.Header.Get("Content-Encoding"))); encoding {
+	case "", "identity":
+		return request.Body, true
+	case "gzip", "x-gzip":
+		reader, err = gzip.NewReader(request.Body)
+	case "deflate":
+		reader, err = zlib.NewReader(request.Body)
+	default:
+		handleErrorRequest(writer, http.StatusUnsupportedMediaType, "Unsupported Content-Encoding",
+			fmt.Errorf("%q is not one of: gzip, deflate", encoding))
+		return nil, false
+	}
+	if err != nil {
+		handleBadRequest(writer, "Corrupt compressed body", fmt.Errorf("%w: %v", errCorruptBody, err))
+		return nil, false
+	}
+	return corruptBodyReader{reader}, true
+}
+
+// corruptBodyReader reports the errors of a decompressor as errCorruptBody.
+type corruptBodyReader struct {
+	io.Reader
+}
+
+func (r corruptBodyReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err != nil && err != io.EOF {
+		err = fmt.Errorf("%w: %v", errCorruptBody, err)
+	}
+	return n, err
+}
+
+// appendChunk writes the chunk at the committed offset of the upload and returns its length. A chunk going past
+// the size of the upload, or the upload cap when it has none, is too large. On any error the file is truncated
+// back to the committed offset.
+func appendChunk(writer http.ResponseWriter, body io.Reader, up *upload, checksum string) (int64, error) {
+	var (
+		err     error
+		file    *os.File
+		written int64
+		limit   int64
+	)
+
+	file, err = os.OpenFile(up.path, os.O_WRONLY, 0o600)
+	if err != nil {
+		return 0, err
+	}
+	defer func(file *os.File) {
+		err := file.Close()
+		if err != nil {
+			return
+		}
+	}(file)
+
+	limit = maxChunkSize
+	if up.max-up.status.Offset < limit {
+		limit = up.max - up.status.Offset
+	}
+	hash := sha256.New()
+	dst := io.MultiWriter(io.NewOffsetWriter(file, up.status.Offset), hash)
+	written, err = io.Copy(dst, http.MaxBytesReader(writer, io.NopCloser(body), limit))
+	if err == nil && hex.EncodeToString(hash.Sum(nil)) != checksum {
+		err = errChecksum
+	}
+	if err != nil {
+		if truncErr := file.Truncate(up.status.Offset); truncErr != nil {
+			return 0, truncErr
+		}
+		return 0, err
+	}
+	return written, nil
+}
+
+// UploadStatusHandler returns the status of an upload, including the committed offset to resume from.
+func (h *Handler) UploadStatusHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		var (
+			err error
+			up  *upload
+			id  string
+		)
+
+		err = checkURLParams(request.URL, 1)
+		if err != nil {
+			handleBadRequest(writer, "", err)
+			return
+		}
+
+		id = request.URL.Query().Get("id")
+		up = h.uploads.get(id)
+		if up == nil {
+			handleErrorRequest(writer, http.StatusNotFound, "Upload not found", fmt.Errorf("no upload with id %q, it may have expired", id))
+			return
+		}
+
+		up.mu.Lock()
+		defer up.mu.Unlock()
+		handleSuccessRequest(writer, "", up.status)
+	}
+}
+
+// UploadCompleteHandler hands a fully received upload to its import pipeline.
+func (h *Handler) UploadCompleteHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		if h.rejectReadOnly(writer) {
+			return
+		}
+
+		var (
+			err error
+			req UploadCompleteRequest
+			up  *upload
+		)
+
+		err = json.NewDecoder(request.Body).Decode(&req)
+		if err != nil {
+			handleBadRequest(writer, "Invalid JSON", err)
+			return
+		}
+
+		up = h.uploads.get(req.ID)
+		if up == nil {
+			handleErrorRequest(writer, http.StatusNotFound, "Upload not found", fmt.Errorf("no upload with id %q, it may have expired", req.ID))
+			return
+		}
+
+		up.mu.Lock()
+		defer up.mu.Unlock()
+		if up.status.Size > 0 && up.status.Offset != up.status.Size {
+			handleUploadOffset(writer, "Upload is incomplete", up.status)
+			return
+		}
+
+		if importers[up.status.Pipeline](h, writer, up.path, up.max, req.SystemOverride) {
+			h.uploads.remove(up.status.ID)
+		}
+	}
+}
+
+// importSQL runs the uploaded file as a script, under the same checks as /execute/script. The file is streamed
+// twice, never held in memory: once to check its statements, then to run them one at a time. A confirmation
+// covers the content of the file, and a file over maxSize bytes is refused and dropped. An import that fails
+// keeps the upload so it can be completed again; the statements that ran before the failure are not rolled back.
+func (h *Handler) importSQL(writer http.ResponseWriter, path string, maxSize int64, override SystemOverride) bool {
+	var (
+		err     error
+		file    *os.File
+		result  *query.Result
+		checked sqlImport
+	)
+
+	checked, err = h.checkSQLImport(path, maxSize)
+	switch {
+	case errors.Is(err, errUploadTooLarge):
+		handleErrorRequest(writer, http.StatusRequestEntityTooLarge, "Upload too large", err)
+		return true
+	case errors.Is(err, util.ErrReadOnly):
+		handleErrorRequest(writer, http.StatusForbidden, "Script not allowed", err)
+		return false
+	case err != nil:
+		handleErrorRequest(writer, http.StatusInternalServerError, "Failed to read upload", err)
+		return false
+	}
+
+	subject := "import:" + checked.checksum
+	if len(checked.system) > 0 && !override.allows(subject) {
+		handleSystemSchema(writer, checked.system, confirmationToken(subject))
+		return false
+	}
+	if len(checked.destructive) > 0 && !override.allows(subject) {
+		h.handleConfirmation(writer, checked.destructive, confirmationToken(subject))
+		return false
+	}
+
+	file, err = os.Open(path)
+	if err != nil {
+		handleErrorRequest(writer, http.StatusInternalServerError, "Failed to read upload", err)
+		return false
+	}
+	defer func(file *os.File) {
+		err := file.Close()
+		if err != nil {
+			return
+		}
+	}(file)
+
+	result, err = query.ExecuteScriptReader(io.LimitReader(file, maxSize), h.client, h.multiStatements)
+	if checked.changesSchema {
+		h.schemaChanged()
+	}
+	if err != nil {
+		if errors.Is(err, util.ErrMultiStatements) {
+			handleErrorRequest(writer, http.StatusForbidden, "Script not allowed", err)
+			return false
+		}
+		handleBadRequest(writer, "Failed to import script", err)
+		return false
+	}
+
+	handleSuccessRequest(writer, "", api.ResultData{Result: result})
+	return true
+}
+
+var errUploadTooLarge = errors.New("upload is too large")
+
+// sqlImport is what checkSQLImport finds in an uploaded script.
+type sqlImport struct {
+	// checksum is the SHA-256 of the file
+	checksum string
+	// system and destructive are the targets of the statements writing to system schemas, and of those
+	// needing a confirmation
+	system        []query.TableRef
+	destructive   []query.TableRef
+	changesSchema bool
+}
+
+// checkSQLImport reads the statements of the uploaded script, failing with util.ErrReadOnly on the first that
+// may not run in read-only mode, and with errUploadTooLarge when the file holds more than maxSize bytes.
+func (h *Handler) checkSQLImport(path string, maxSize int64) (sqlImport, error) {
+	var (
+		checked sqlImport
+		dbType  = h.client.Type.String()
+		schema  = h.client.Schema.Name
+		confirm = h.requiresConfirmation()
+		hash    = sha256.New()
+	)
+
+	file, err := os.Open(path)
+	if err != nil {
+		return checked, err
+	}
+	defer func(file *os.File) {
+		err := file.Close()
+		if err != nil {
+			return
+		}
+	}(file)
+
+	limited := &io.LimitedReader{R: file, N: maxSize + 1}
+	scanner := query.NewStatementScanner(dbType, io.TeeReader(limited, hash))
+	for scanner.Scan() {
+		statement := scanner.Text()
+		if err = h.guardQuery(&query.Query{SQLQuery: statement}); err != nil {
+			return checked, err
+		}
+		checked.system = append(checked.system, query.SystemTargets(dbType, schema, statement)...)
+		if confirm && query.IsDestructiveStatement(dbType, statement) {
+			checked.destructive = append(checked.destructive, query.DestructiveTargets(dbType, schema, statement)...)
+		}
+		checked.changesSchema = checked.changesSchema || query.ChangesSchema(dbType, statement)
+	}
+	if err = scanner.Err(); err != nil {
+		return checked, err
+	}
+	if limited.N == 0 {
+		return checked, fmt.Errorf("%w: it must not exceed %d bytes", errUploadTooLarge, maxSize)
+	}
+	checked.checksum = hex.EncodeToString(hash.Sum(nil))
+	return checked, nil
+}
+
+// pipelineNames lists the import pipelines for error messages.
+func pipelineNames() string {
+	names := make([]string, 0, len(importers))
+	for name := range importers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// handleUploadOffset sends a 409 response carrying the upload status.
+func handleUploadOffset(writer http.ResponseWriter, message string, status UploadStatus) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusConflict)
+	response := Response{
+		Message: message,
+		Error:   fmt.Sprintf("committed offset is %d", status.Offset),
+		Code:    ErrCodeUploadOffset,
+		Data:    status,
+	}
+	if err := json.NewEncoder(writer).Encode(response); err != nil {
+		http.Error(writer, "Error encoding JSON response", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,201 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yazeed1s/sqlweb/pkg/config"
+)
+
+// usageFlushInterval is how often the table usage counted in memory is added to the saved one.
+const usageFlushInterval = time.Minute
+
+// Operations counted per table, see tableUsage.
+const (
+	usageView = iota
+	usageExport
+	usageEdit
+)
+
+type usageKey struct {
+	connection string
+	table      string
+}
+
+// usageCounter holds the operations on a table counted since the last flush.
+type usageCounter struct {
+	counts [3]atomic.Int64
+	// last is when the table was last accessed, in Unix nanoseconds
+	last atomic.Int64
+}
+
+// tableUsage counts the operations on each table in memory, so that counting is a couple of
+// atomic increments; the counts are written to the config directory by flush, off the requests.
+type tableUsage struct {
+	counters sync.Map
+	// flushMu serializes flushes and resets, so counts taken by one are saved before the other reads the file
+	flushMu sync.Mutex
+}
+
+func newTableUsage() *tableUsage {
+	return &tableUsage{}
+}
+
+func (u *tableUsage) record(connection, table string, operation int) {
+	key := usageKey{connection: connection, table: table}
+	value, ok := u.counters.Load(key)
+	if !ok {
+		value, _ = u.counters.LoadOrStore(key, &usageCounter{})
+	}
+	counter := value.(*usageCounter)
+	counter.counts[operation].Add(1)
+	counter.last.Store(time.Now().UnixNano())
+}
+
+// pending returns the counts not flushed yet of the connection, of every connection when it is empty.
+// With take, the counters are reset, handing the counts over to the caller.
+func (u *tableUsage) pending(connection string, take bool) []config.TableUsage {
+	var counts []config.TableUsage
+	u.counters.Range(func(k, value interface{}) bool {
+		key, counter := k.(usageKey), value.(*usageCounter)
+		if connection != "" && key.connection != connection {
+			return true
+		}
+		var n [3]int64
+		for i := range counter.counts {
+			if take {
+				n[i] = counter.counts[i].Swap(0)
+			} else {
+				n[i] = counter.counts[i].Load()
+			}
+		}
+		if n[usageView]+n[usageExport]+n[usageEdit] == 0 {
+			return true
+		}
+		counts = append(counts, config.TableUsage{
+			Connection:   key.connection,
+			Table:        key.table,
+			Views:        n[usageView],
+			Exports:      n[usageExport],
+			Edits:        n[usageEdit],
+			LastAccessAt: time.Unix(0, counter.last.Load()),
+		})
+		return true
+	})
+	return counts
+}
+
+// flush adds the counts taken from memory to the saved usage. Counts that cannot be saved
+// are put back, to be saved by the next flush.
+func (u *tableUsage) flush() error {
+	u.flushMu.Lock()
+	defer u.flushMu.Unlock()
+
+	counts := u.pending("", true)
+	if err := config.AddTableUsage(counts); err != nil {
+		for _, c := range counts {
+			value, _ := u.counters.LoadOrStore(usageKey{connection: c.Connection, table: c.Table}, &usageCounter{})
+			counter := value.(*usageCounter)
+			counter.counts[usageView].Add(c.Views)
+			counter.counts[usageExport].Add(c.Exports)
+			counter.counts[usageEdit].Add(c.Edits)
+		}
+		return err
+	}
+	return nil
+}
+
+// usage returns the saved usage with the counts not flushed yet, the most used tables first.
+func (u *tableUsage) usage(connection string) ([]config.TableUsage, error) {
+	u.flushMu.Lock()
+	defer u.flushMu.Unlock()
+
+	saved, err := config.GetTableUsage(connection)
+	if err != nil {
+		return nil, err
+	}
+	usage := config.MergeTableUsage(saved, u.pending(connection, false))
+	config.SortTableUsage(usage)
+	return usage, nil
+}
+
+// reset forgets the usage, both saved and not flushed yet, of the connection or of every connection.
+func (u *tableUsage) reset(connection string) error {
+	u.flushMu.Lock()
+	defer u.flushMu.Unlock()
+
+	u.pending(connection, true)
+	return config.ResetTableUsage(connection)
+}
+
+// recordUsage counts an operation on a table of the active connection.
+func (h *Handler) recordUsage(table string, operation int) {
+	if h.usage == nil || table == "" {
+		return
+	}
+	h.usage.record(h.client.Key(), table, operation)
+}
+
+// StartUsageFlusher saves the table usage counted in memory, and the tables opened, every usageFlushInterval.
+func (h *Handler) StartUsageFlusher() {
+	go func() {
+		ticker := time.NewTicker(usageFlushInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := h.usage.flush(); err != nil {
+				log.Println("failed to save table usage:", err)
+			}
+			if err := h.recent.flush(); err != nil {
+				log.Println("failed to save recent tables:", err)
+			}
+		}
+	}()
+}
+
+// FlushUsage saves the table usage counted in memory and the tables opened. It is called on shutdown.
+func (h *Handler) FlushUsage() error {
+	return errors.Join(h.usage.flush(), h.recent.flush())
+}
+
+// TableUsageHandler lists how often each table was viewed, exported and edited through sqlweb, and when it
+// was last accessed, the most used first. The connection parameter keeps the tables of one connection, by key.
+func (h *Handler) TableUsageHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		usage, err := h.usage.usage(request.URL.Query().Get("connection"))
+		if err != nil {
+			handleErrorRequest(writer, http.StatusInternalServerError, "Failed to read the table usage", err)
+			return
+		}
+		handleSuccessRequest(writer, "", usage)
+	}
+}
+
+// ResetTableUsageHandler forgets the usage of the tables of the connection given by key, or of every connection.
+func (h *Handler) ResetTableUsageHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		if err := h.usage.reset(request.URL.Query().Get("connection")); err != nil {
+			handleErrorRequest(writer, http.StatusInternalServerError, "Failed to reset the table usage", err)
+			return
+		}
+		handleSuccessRequest(writer, "Table usage reset", nil)
+	}
+}
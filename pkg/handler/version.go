@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/yazeed1s/sqlweb/pkg/api"
+	"github.com/yazeed1s/sqlweb/pkg/query"
+)
+
+// SchemaVersionHeader carries the schema version in every API response, see SchemaVersion.
+const SchemaVersionHeader = "X-Schema-Version"
+
+// schemaEpoch starts every schema version, so that versions handed out before a restart never
+// match those after it even though the counter starts over.
+var schemaEpoch = strconv.FormatInt(time.Now().UnixNano(), 36)
+
+// SchemaVersion returns a token that changes whenever a schema change runs through sqlweb: a table
+// dropped, renamed or commented on, a database created or dropped, or a query or script creating,
+// altering or dropping anything. Changes made by other clients are not seen.
+func (h *Handler) SchemaVersion() string {
+	return schemaEpoch + "." + strconv.FormatUint(h.schemaVersion.Load(), 10)
+}
+
+// schemaChanged bumps the schema version and forgets the cached columns, which may no longer be right.
+func (h *Handler) schemaChanged() {
+	h.schemaVersion.Add(1)
+	h.client.ResetColumns()
+}
+
+// schemaChangedBy bumps the schema version when the query changes the schema. It is called once the
+// query ran, failed or not, since a script may change the schema before one of its statements fails.
+func (h *Handler) schemaChangedBy(sqlQuery string) {
+	if query.ChangesSchema(h.client.Type.String(), sqlQuery) {
+		h.schemaChanged()
+	}
+}
+
+// SchemaVersionHandler returns the schema version, which the UI polls to know when to reload
+// the tables and columns it shows.
+func (h *Handler) SchemaVersionHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		handleSuccessRequest(writer, "", api.VersionData{Version: h.SchemaVersion()})
+	}
+}
+
+// CacheRefreshHandler reads the columns of every table of the schema again into the cache, for changes made
+// by other clients, and bumps the schema version so the UI reloads its tables. It returns the number of tables.
+func (h *Handler) CacheRefreshHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+				return
+			}
+		}(request.Body)
+
+		tables, err := h.client.RefreshColumns()
+		// the cache was emptied even when it could not be filled again
+		h.schemaVersion.Add(1)
+		if err != nil {
+			handleErrorRequest(writer, http.StatusInternalServerError, "Failed to refresh the cached metadata", err)
+			return
+		}
+		handleSuccessRequest(writer, "", api.CacheRefreshData{Tables: tables, Version: h.SchemaVersion()})
+	}
+}
+
+// Versioned sets SchemaVersionHeader on the responses of next, to the version once next ran
+// up to its first write, so that the response to a schema change carries the bumped version.
+func (h *Handler) Versioned(next http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		next(&versionWriter{ResponseWriter: writer, handler: h}, request)
+	}
+}
+
+// versionWriter sets the schema version header right before the header is written.
+type versionWriter struct {
+	http.ResponseWriter
+	handler *Handler
+	written bool
+}
+
+func (w *versionWriter) WriteHeader(status int) {
+	if !w.written {
+		w.written = true
+		w.Header().Set(SchemaVersionHeader, w.handler.SchemaVersion())
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *versionWriter) Write(data []byte) (int, error) {
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to flush a download.
+func (w *versionWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
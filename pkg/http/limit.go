@@ -0,0 +1,171 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/yazeed1s/sqlweb/pkg/api"
+)
+
+// Response codes sent when a request is refused by the limits.
+const (
+	ErrCodeRateLimited  = "rate_limited"
+	ErrCodeBodyTooLarge = "body_too_large"
+)
+
+// Limits protects an exposed instance from being flooded. The zero value disables every limit.
+type Limits struct {
+	// Rate is the number of requests per second each client IP may send to the execute and
+	// mutation routes, on average; 0 disables rate limiting
+	Rate float64
+	// Burst is the number of such requests a client may send at once
+	Burst int
+	// MaxBody caps the size of request bodies in bytes; 0 disables the cap
+	MaxBody int64
+}
+
+// IsLoopback reports whether the bind address only accepts local connections.
+// An empty host binds every interface, so it is not loopback.
+func IsLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// bucket is a token bucket: it holds up to burst tokens and gains rate tokens per second.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter keeps one token bucket per client IP.
+type rateLimiter struct {
+	rate    float64
+	burst   float64
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+// maxBuckets bounds the number of tracked clients; full buckets are dropped past it,
+// since a client with a full bucket is indistinguishable from a new one.
+const maxBuckets = 10000
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// allow takes a token from the client's bucket. When the bucket is empty it returns false
+// along with how long the client should wait for the next token.
+func (l *rateLimiter) allow(client string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if len(l.buckets) >= maxBuckets {
+		l.evict(now)
+	}
+
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+func (l *rateLimiter) evict(now time.Time) {
+	for client, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// clientIP returns the address the request came from. X-Forwarded-For is not trusted:
+// a client could set it to get a fresh bucket on every request.
+func clientIP(request *http.Request) string {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+	return host
+}
+
+// rateLimit refuses requests from clients that used up their bucket, with 429 and a Retry-After header.
+func rateLimit(limiter *rateLimiter, next http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		ok, wait := limiter.allow(clientIP(request))
+		if !ok {
+			writer.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			handleLimited(writer, http.StatusTooManyRequests, "Too many requests", ErrCodeRateLimited,
+				errors.New("request rate limit exceeded"))
+			return
+		}
+		next(writer, request)
+	}
+}
+
+// limitBody refuses request bodies larger than max with 413. The body is read up front, so a
+// body without a Content-Length is refused the same way instead of failing halfway through decoding.
+func limitBody(max int64, next http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		var (
+			err     error
+			body    []byte
+			tooBig  *http.MaxBytesError
+			refused = errors.New("request body exceeds " + strconv.FormatInt(max, 10) + " bytes")
+		)
+
+		if request.ContentLength > max {
+			handleLimited(writer, http.StatusRequestEntityTooLarge, "Request body too large", ErrCodeBodyTooLarge, refused)
+			return
+		}
+
+		body, err = io.ReadAll(http.MaxBytesReader(writer, request.Body, max))
+		if err != nil {
+			if errors.As(err, &tooBig) {
+				handleLimited(writer, http.StatusRequestEntityTooLarge, "Request body too large", ErrCodeBodyTooLarge, refused)
+				return
+			}
+			handleLimited(writer, http.StatusBadRequest, "Failed to read request body", "", err)
+			return
+		}
+		request.Body = io.NopCloser(bytes.NewReader(body))
+		next(writer, request)
+	}
+}
+
+// handleLimited sends an error response in the same format as the handlers.
+func handleLimited(writer http.ResponseWriter, status int, message, code string, e error) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	response := api.Response{Message: message, Error: e.Error(), Code: code}
+	if err := json.NewEncoder(writer).Encode(response); err != nil {
+		http.Error(writer, "Error encoding JSON response", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,119 @@
+package http
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yazeed1s/sqlweb/pkg/api"
+	_h "github.com/yazeed1s/sqlweb/pkg/handler"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func limitedMux(limits Limits) *http.ServeMux {
+	mux := http.NewServeMux()
+	RegisterAPIRoutes(mux, _h.NewHandler(), limits)
+	return mux
+}
+
+func post(mux *http.ServeMux, path, remoteAddr string, body io.Reader) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, path, body)
+	request.RemoteAddr = remoteAddr
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func decodeLimited(t *testing.T, recorder *httptest.ResponseRecorder) api.Response {
+	var response api.Response
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	return response
+}
+
+func TestRateLimitExecute(t *testing.T) {
+	mux := limitedMux(Limits{Rate: 0.001, Burst: 2})
+	body := `{"query": "SELECT 1"}`
+
+	for i := 0; i < 2; i++ {
+		recorder := post(mux, "/execute", "10.0.0.1:5000", strings.NewReader(body))
+		assert.NotEqual(t, http.StatusTooManyRequests, recorder.Code)
+	}
+	recorder := post(mux, "/execute", "10.0.0.1:5001", strings.NewReader(body))
+	require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	assert.Equal(t, ErrCodeRateLimited, decodeLimited(t, recorder).Code)
+	assert.NotEmpty(t, recorder.Header().Get("Retry-After"))
+
+	// another client has its own bucket
+	recorder = post(mux, "/execute", "10.0.0.2:5000", strings.NewReader(body))
+	assert.NotEqual(t, http.StatusTooManyRequests, recorder.Code)
+
+	// reads are not rate limited
+	for i := 0; i < 3; i++ {
+		request := httptest.NewRequest(http.MethodGet, "/schemas", nil)
+		request.RemoteAddr = "10.0.0.1:5000"
+		recorder = httptest.NewRecorder()
+		mux.ServeHTTP(recorder, request)
+		assert.NotEqual(t, http.StatusTooManyRequests, recorder.Code)
+	}
+}
+
+func TestRateLimiterRefills(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := newRateLimiter(2, 1)
+	limiter.now = func() time.Time { return now }
+
+	ok, _ := limiter.allow("a")
+	assert.True(t, ok)
+	ok, wait := limiter.allow("a")
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	now = now.Add(500 * time.Millisecond)
+	ok, _ = limiter.allow("a")
+	assert.True(t, ok)
+}
+
+func TestBodyLimit(t *testing.T) {
+	mux := limitedMux(Limits{MaxBody: 64})
+	large := `{"query": "SELECT '` + strings.Repeat("x", 100) + `'"}`
+
+	recorder := post(mux, "/execute", "10.0.0.1:5000", strings.NewReader(large))
+	require.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+	assert.Equal(t, ErrCodeBodyTooLarge, decodeLimited(t, recorder).Code)
+
+	// without a Content-Length the body is refused while it is read
+	recorder = post(mux, "/execute", "10.0.0.1:5000", io.MultiReader(strings.NewReader(large)))
+	require.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+	assert.Equal(t, ErrCodeBodyTooLarge, decodeLimited(t, recorder).Code)
+
+	recorder = post(mux, "/execute", "10.0.0.1:5000", strings.NewReader(`{"query": "SELECT 1"}`))
+	assert.NotEqual(t, http.StatusRequestEntityTooLarge, recorder.Code)
+}
+
+func TestNoLimitsByDefault(t *testing.T) {
+	mux := http.NewServeMux()
+	RegisterRoutes(mux, _h.NewHandler())
+	large := `{"query": "SELECT '` + strings.Repeat("x", 2<<20) + `'"}`
+
+	for i := 0; i < 30; i++ {
+		recorder := post(mux, "/execute", "10.0.0.1:5000", strings.NewReader(`{"query": "SELECT 1"}`))
+		require.NotEqual(t, http.StatusTooManyRequests, recorder.Code)
+	}
+	recorder := post(mux, "/execute", "10.0.0.1:5000", strings.NewReader(large))
+	assert.NotEqual(t, http.StatusRequestEntityTooLarge, recorder.Code)
+}
+
+func TestIsLoopback(t *testing.T) {
+	for _, host := range []string{"localhost", "127.0.0.1", "::1"} {
+		assert.True(t, IsLoopback(host), host)
+	}
+	for _, host := range []string{"", "0.0.0.0", "192.168.1.10", "example.com"} {
+		assert.False(t, IsLoopback(host), host)
+	}
+}
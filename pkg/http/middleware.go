@@ -5,15 +5,44 @@ import (
 	"strings"
 )
 
-// CorsMiddleware used for local dev only (when backend/frontend run on diff ports)
-func CorsMiddleware(next http.Handler) http.Handler {
+// DevOrigin is the origin of the UI dev server, when backend and frontend run on different ports in development.
+const DevOrigin = "http://localhost:5173"
+
+// CorsConfig tells which browser origins may call the API.
+type CorsConfig struct {
+	// Origins are the exact origins allowed, e.g. DevOrigin. The API has no authentication, so any page
+	// allowed here can read the databases it connects to.
+	Origins []string
+}
+
+// allows reports whether the origin may call the API.
+func (c CorsConfig) allows(origin string) bool {
+	for _, o := range c.Origins {
+		if strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// CorsMiddleware lets the origins of the config call the API from a browser. Requests from other
+// origins are served without CORS headers, so browsers keep their responses from the page.
+func CorsMiddleware(config CorsConfig, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "http://localhost:5173")
+		w.Header().Add("Vary", "Origin")
+		origin := r.Header.Get("Origin")
+		if origin == "" || !config.allows(origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", origin)
 		w.Header().Set("Access-Control-Allow-Headers", "*")
 		w.Header().Set("Access-Control-Allow-Methods", strings.Join([]string{
 			http.MethodGet,
 			http.MethodPost,
+			http.MethodDelete,
 		}, ","))
+		w.Header().Set("Access-Control-Expose-Headers", "*")
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusNoContent)
 			return
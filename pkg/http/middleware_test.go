@@ -0,0 +1,52 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCorsMiddleware(t *testing.T) {
+	mux := http.NewServeMux()
+	RegisterUIRoutes(mux)
+	api := http.NewServeMux()
+	api.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := CorsMiddleware(CorsConfig{Origins: []string{DevOrigin, "http://localhost:3000"}}, api)
+
+	request := func(method, origin string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/ping", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, r)
+		return recorder
+	}
+
+	for _, origin := range []string{"http://localhost:3000", "HTTP://LOCALHOST:3000", DevOrigin} {
+		recorder := request(http.MethodGet, origin)
+		require.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, origin, recorder.Header().Get("Access-Control-Allow-Origin"), origin)
+	}
+
+	recorder := request(http.MethodOptions, "http://localhost:3000")
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+	assert.Contains(t, recorder.Header().Get("Access-Control-Allow-Methods"), http.MethodDelete)
+
+	// another host on the UI port is a page of someone else's
+	for _, origin := range []string{"http://localhost:4000", "http://evil.example", "http://evil.example:3000", "https://localhost:3000", ""} {
+		recorder = request(http.MethodGet, origin)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Empty(t, recorder.Header().Get("Access-Control-Allow-Origin"), origin)
+	}
+
+	// the UI registers apart from the API
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
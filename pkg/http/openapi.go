@@ -0,0 +1,289 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	_sql "github.com/yazeed1s/sqlweb/db/sql"
+	"github.com/yazeed1s/sqlweb/pkg/api"
+	"github.com/yazeed1s/sqlweb/pkg/cli"
+	_h "github.com/yazeed1s/sqlweb/pkg/handler"
+)
+
+// errorCodes lists the codes an error response may carry for the client to act on.
+var errorCodes = []string{
+	_h.ErrCodeConnectionLost,
+	_h.ErrCodeSystemSchema,
+	_h.ErrCodeSchemaChanged,
+	_h.ErrCodeDependenciesFound,
+	_h.ErrCodeConfirmationRequired,
+	_h.ErrCodeUploadOffset,
+	_h.ErrCodeUnknownCollation,
+	ErrCodeRateLimited,
+	ErrCodeBodyTooLarge,
+}
+
+// schemaBuilder turns Go types into OpenAPI schemas. Named structs are added once
+// to the components and referenced from everywhere else.
+type schemaBuilder struct {
+	components map[string]interface{}
+	names      map[reflect.Type]string
+}
+
+func newSchemaBuilder() *schemaBuilder {
+	return &schemaBuilder{
+		components: make(map[string]interface{}),
+		names:      make(map[reflect.Type]string),
+	}
+}
+
+// of returns the schema of the value's type.
+func (b *schemaBuilder) of(v interface{}) map[string]interface{} {
+	if v == nil {
+		return map[string]interface{}{}
+	}
+	return b.schema(reflect.TypeOf(v))
+}
+
+func (b *schemaBuilder) schema(t reflect.Type) map[string]interface{} {
+	switch t {
+	case reflect.TypeOf(time.Time{}):
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case reflect.TypeOf(_sql.DbType(0)):
+		// connection.Connection marshals its type by name
+		return map[string]interface{}{"type": "string", "enum": []string{
+			_sql.MySQL.String(), _sql.PostgreSQL.String(), _sql.SQLite.String(),
+		}}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return b.schema(t.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + b.component(t)}
+	default:
+		// interface{} holds any JSON value
+		return map[string]interface{}{}
+	}
+}
+
+// component adds the named struct to the components, once, and returns its name.
+// A name already taken by a type of another package is prefixed with the package name.
+func (b *schemaBuilder) component(t reflect.Type) string {
+	if name, ok := b.names[t]; ok {
+		return name
+	}
+
+	name := t.Name()
+	if _, taken := b.components[name]; taken {
+		pkg := t.PkgPath()
+		name = pkg[strings.LastIndex(pkg, "/")+1:] + "." + name
+	}
+	b.names[t] = name
+	// registered before building, so self-referencing types terminate
+	b.components[name] = map[string]interface{}{}
+	b.components[name] = b.object(t)
+	return name
+}
+
+// object builds the schema of a struct the way encoding/json marshals it:
+// fields follow their json tag, and untagged embedded structs are flattened.
+func (b *schemaBuilder) object(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	b.addFields(t, properties)
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+func (b *schemaBuilder) addFields(t reflect.Type, properties map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				b.addFields(embedded, properties)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = b.schema(field.Type)
+	}
+}
+
+// openAPI builds the OpenAPI document describing the routes. Every JSON response is the
+// api.Response envelope; the route's data type describes its data field.
+func openAPI(apiRoutes []route) map[string]interface{} {
+	var (
+		builder  *schemaBuilder
+		paths    map[string]interface{}
+		envelope map[string]interface{}
+		failure  map[string]interface{}
+	)
+
+	builder = newSchemaBuilder()
+	envelope = builder.schema(reflect.TypeOf(api.Response{}))
+	builder.components["Error"] = map[string]interface{}{
+		"allOf": []interface{}{
+			envelope,
+			map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"code": map[string]interface{}{"type": "string", "enum": errorCodes},
+				},
+			},
+		},
+	}
+	failure = map[string]interface{}{
+		"description": "The request failed; code is set when the client is expected to act on the error",
+		"content": map[string]interface{}{
+			"application/json": map[string]interface{}{
+				"schema": map[string]interface{}{"$ref": "#/components/schemas/Error"},
+			},
+		},
+	}
+
+	paths = make(map[string]interface{})
+	for _, r := range apiRoutes {
+		operation := map[string]interface{}{
+			"summary":   r.Summary,
+			"responses": responses(builder, envelope, failure, r),
+		}
+		if len(r.Params) > 0 {
+			operation["parameters"] = parameters(r.Params)
+		}
+		if r.Body != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": builder.of(r.Body)},
+				},
+			}
+		}
+		if r.Upload != "" {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					r.Upload: map[string]interface{}{
+						"schema": map[string]interface{}{"type": "string", "format": "binary"},
+					},
+				},
+			}
+		}
+
+		item, ok := paths[r.Path].(map[string]interface{})
+		if !ok {
+			item = make(map[string]interface{})
+			paths[r.Path] = item
+		}
+		item[strings.ToLower(r.Method)] = operation
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "sqlweb",
+			"version": strings.TrimPrefix(cli.NewArgs().Version, "version "),
+		},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": builder.components},
+	}
+}
+
+func responses(builder *schemaBuilder, envelope, failure map[string]interface{}, r route) map[string]interface{} {
+	result := map[string]interface{}{"default": failure}
+	if r.File != "" {
+		// downloads are answered with 202 Accepted
+		result["202"] = map[string]interface{}{
+			"description": "The file",
+			"content": map[string]interface{}{
+				r.File: map[string]interface{}{
+					"schema": map[string]interface{}{"type": "string", "format": "binary"},
+				},
+			},
+		}
+	}
+	if r.File != "" && r.Data == nil {
+		return result
+	}
+
+	schema := envelope
+	if r.Data != nil {
+		schema = map[string]interface{}{
+			"allOf": []interface{}{
+				envelope,
+				map[string]interface{}{
+					"type":       "object",
+					"properties": map[string]interface{}{"data": builder.of(r.Data)},
+				},
+			},
+		}
+	}
+	result["200"] = map[string]interface{}{
+		"description": "Success",
+		"content": map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": schema},
+		},
+	}
+	return result
+}
+
+func parameters(params []param) []interface{} {
+	list := make([]interface{}, 0, len(params))
+	for _, p := range params {
+		list = append(list, map[string]interface{}{
+			"name":        p.Name,
+			"in":          "query",
+			"required":    p.Required,
+			"description": p.Description,
+			"schema":      map[string]interface{}{"type": p.Type},
+		})
+	}
+	return list
+}
+
+// serveOpenAPI answers with the OpenAPI document of the routes, built once.
+func serveOpenAPI(apiRoutes []route) http.HandlerFunc {
+	document, err := json.Marshal(openAPI(apiRoutes))
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if err != nil {
+			http.Error(writer, "Error encoding OpenAPI document", http.StatusInternalServerError)
+			return
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		_, _ = writer.Write(document)
+	}
+}
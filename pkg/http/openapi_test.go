@@ -0,0 +1,130 @@
+package http
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	_h "github.com/yazeed1s/sqlweb/pkg/handler"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// undocumented lists the paths served outside the API, which have no OpenAPI entry.
+var undocumented = map[string]bool{
+	"/debug/pprof/":        true,
+	"/debug/pprof/cmdline": true,
+	"/debug/pprof/profile": true,
+	"/debug/pprof/symbol":  true,
+	"/debug/pprof/trace":   true,
+	"/openapi.json":        true,
+}
+
+func fetchOpenAPI(t *testing.T) map[string]interface{} {
+	mux := http.NewServeMux()
+	RegisterRoutes(mux, _h.NewHandler())
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var document map[string]interface{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &document))
+	return document
+}
+
+func TestOpenAPIDescribesEveryRoute(t *testing.T) {
+	document := fetchOpenAPI(t)
+	paths := document["paths"].(map[string]interface{})
+
+	for _, r := range routes(_h.NewHandler()) {
+		assert.NotEmpty(t, r.Summary, "%s %s has no summary", r.Method, r.Path)
+		item, ok := paths[r.Path].(map[string]interface{})
+		require.True(t, ok, "%s is not in the OpenAPI document", r.Path)
+		operation, ok := item[strings.ToLower(r.Method)].(map[string]interface{})
+		require.True(t, ok, "%s %s is not in the OpenAPI document", r.Method, r.Path)
+		assert.Contains(t, operation["responses"], "default")
+		if r.Method == "POST" && r.Body != nil {
+			assert.Contains(t, operation, "requestBody", r.Path)
+		}
+	}
+}
+
+// TestRegisteredRoutesAreDocumented fails when a handler is registered on the mux directly
+// instead of through the route list, which would leave it out of the OpenAPI document.
+func TestRegisteredRoutesAreDocumented(t *testing.T) {
+	file, err := parser.ParseFile(token.NewFileSet(), "routes.go", nil, 0)
+	require.NoError(t, err)
+
+	documented := make(map[string]bool)
+	for _, r := range routes(_h.NewHandler()) {
+		documented[r.Path] = true
+	}
+
+	ast.Inspect(file, func(node ast.Node) bool {
+		call, ok := node.(*ast.CallExpr)
+		if !ok || len(call.Args) == 0 {
+			return true
+		}
+		selector, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || (selector.Sel.Name != "HandleFunc" && selector.Sel.Name != "Handle") {
+			return true
+		}
+		literal, ok := call.Args[0].(*ast.BasicLit)
+		if !ok {
+			return true
+		}
+		path, err := strconv.Unquote(literal.Value)
+		require.NoError(t, err)
+		assert.True(t, documented[path] || undocumented[path], "%s is registered without an OpenAPI entry", path)
+		return true
+	})
+}
+
+func TestOpenAPISchemas(t *testing.T) {
+	document := fetchOpenAPI(t)
+	schemas := document["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+
+	// the error model lists the codes clients act on
+	assert.Contains(t, schemas, "Error")
+	assert.Contains(t, schemas, "Response")
+
+	// embedded structs are flattened like encoding/json does
+	request := schemas["QueryRequest"].(map[string]interface{})["properties"].(map[string]interface{})
+	assert.Contains(t, request, "query")
+	assert.Contains(t, request, "allowSystem")
+	assert.Contains(t, request, "confirmToken")
+
+	// the database type is sent by name, not as the enum index
+	conn := schemas["Connection"].(map[string]interface{})["properties"].(map[string]interface{})
+	assert.Equal(t, "string", conn["databaseType"].(map[string]interface{})["type"])
+
+	table := schemas["Table"].(map[string]interface{})["properties"].(map[string]interface{})
+	assert.Contains(t, table, "fingerprint")
+}
+
+func TestRoutesSharingAPath(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	mux := http.NewServeMux()
+	RegisterRoutes(mux, _h.NewHandler())
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/queries", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodDelete, "/queries?name=none", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code, recorder.Body.String())
+
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodPut, "/queries", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
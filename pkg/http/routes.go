@@ -4,7 +4,13 @@ import (
 	"net/http"
 	"net/http/pprof"
 
+	"github.com/yazeed1s/sqlweb/db/connection"
+	"github.com/yazeed1s/sqlweb/pkg/api"
+	_client "github.com/yazeed1s/sqlweb/pkg/client"
+	"github.com/yazeed1s/sqlweb/pkg/config"
 	_h "github.com/yazeed1s/sqlweb/pkg/handler"
+	"github.com/yazeed1s/sqlweb/pkg/query"
+	"github.com/yazeed1s/sqlweb/pkg/tracing"
 )
 
 func handleMethod(method string, handler http.HandlerFunc) http.HandlerFunc {
@@ -17,25 +23,512 @@ func handleMethod(method string, handler http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
-func RegisterRoutes(mux *http.ServeMux, handler _h.Handler) {
+// handleMethods serves the routes sharing a path, each by its method.
+func handleMethods(handlers map[string]http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		handler, ok := handlers[r.Method]
+		if !ok {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// route is an API endpoint along with its description. The same list registers the handlers
+// and generates /openapi.json, so a route cannot be served without being documented.
+type route struct {
+	Path    string
+	Method  string
+	Handler http.HandlerFunc
+	Summary string
+	Params  []param
+	// Body is a value of the request body type, nil when the route reads no body
+	Body interface{}
+	// Upload is the content type of a raw request body, for routes that read bytes instead of JSON.
+	// Such routes bound the body themselves rather than with Limits.MaxBody
+	Upload string
+	// Data is a value of the type sent in the data field of the response, nil when there is none
+	Data interface{}
+	// File is the content type of the file the route answers with, instead of or along with JSON
+	File string
+	// RateLimited marks the execute and mutation routes, which are subject to Limits.Rate
+	RateLimited bool
+}
+
+// param is a URL query parameter.
+type param struct {
+	Name        string
+	Type        string
+	Required    bool
+	Description string
+}
+
+var (
+	nameParam   = param{Name: "name", Type: "string", Required: true, Description: "Table name"}
+	allowSystem = param{Name: "allowSystem", Type: "boolean", Description: "Confirm an operation on a system schema, or a destructive one, along with confirmToken"}
+	uploadID    = param{Name: "id", Type: "string", Required: true, Description: "Upload id returned by /upload/init"}
+	confirm     = param{Name: "confirmToken", Type: "string", Description: "Token returned by the refused system_schema or confirmation_required attempt"}
+	// templateName names an export template of the connection
+	templateName = param{Name: "name", Type: "string", Required: true, Description: "Export template name"}
+	// previewParams add the first rows of a table to a connect response
+	previewParams = []param{
+		{Name: "preview", Type: "integer", Description: "Number of rows of the table to preview, up to 100"},
+		{Name: "previewTable", Type: "string", Description: "Table to preview, the first one of the schema by default"},
+	}
+	// excludeParam leaves columns out of an export, on top of those the connection excludes
+	excludeParam = param{Name: "exclude", Type: "string", Description: "Comma separated columns to leave out of the export"}
+	// autoFixParam saves the suggested rewrite of a saved query naming a renamed table before running it
+	autoFixParam = param{Name: "autoFix", Type: "boolean", Description: "Rewrite and save the query with the new names of the renamed tables it names"}
+	// shareableParam adds a reproduction of the query that ran to the response, to share it or report a bug
+	shareableParam = param{Name: "shareable", Type: "boolean", Description: "Add a reproduction of the query, without secrets, and a curl command running it again"}
+	// usageConnection keeps the table usage of one connection
+	usageConnection = param{Name: "connection", Type: "string", Description: "Key of the connection, every connection by default"}
+	// pageParams paginate the list endpoints that return everything unless asked for a page
+	pageParams = []param{
+		{Name: "page", Type: "integer", Description: "Page number, from 1, along with perPage"},
+		{Name: "perPage", Type: "integer", Description: "Items per page, along with page"},
+	}
+)
+
+func routes(handler *_h.Handler) []route {
+	return []route{
+		{
+			Path: "/connect", Method: "POST", Handler: handler.ConnectHandler(),
+			Summary: "Connect to a database",
+			Params:  previewParams,
+			Body:    connection.Connection{}, Data: api.ConnectData{},
+		},
+		{
+			Path: "/connect/saved", Method: "POST", Handler: handler.ConnectSavedHandler(),
+			Summary: "Connect to a saved connection and record it as used",
+			Params: append([]param{
+				{Name: "key", Type: "string", Required: true, Description: "Key of the saved connection, its database name"},
+			}, previewParams...),
+			Data: api.ConnectData{},
+		},
+		{
+			Path: "/save", Method: "POST", Handler: handler.SaveConnection(),
+			Summary: "Save a connection",
+			Body:    connection.Connection{},
+		},
+		{
+			Path: "/connections/test", Method: "GET", Handler: handler.TestConnectionsHandler(),
+			Summary: "Try to connect to every saved connection and report which are reachable",
+			Params: []param{
+				{Name: "timeout", Type: "string", Description: "Time allowed for each connection, e.g. 2s (default: 5s)"},
+			},
+			Data: []_h.ProbeResult{},
+		},
+		{
+			Path: "/connections/export", Method: "GET", Handler: handler.ExportConnectionsHandler(),
+			Summary: "Export the saved connections as a JSON file, without their passwords by default",
+			Params: []param{
+				{Name: "includePasswords", Type: "boolean", Description: "Include the passwords in the file"},
+			},
+			File: "application/json",
+		},
+		{
+			Path: "/connections/import", Method: "POST", Handler: handler.ImportConnectionsHandler(),
+			Summary: "Save the connections of a JSON file, skipping invalid and already saved ones",
+			Body:    []connection.Connection{}, Data: config.ImportResult{},
+		},
+		{
+			Path: "/saved/connections", Method: "GET", Handler: handler.SavedConnectionsHandler(),
+			Summary: "List saved connections",
+			Params:  pageParams, Data: []connection.Connection{},
+		},
+		{
+			Path: "/disconnect", Method: "POST", Handler: handler.DbDisconnect(),
+			Summary: "Close the database connection",
+		},
+		{
+			Path: "/execute", Method: "POST", Handler: handler.Track(handler.QueryHandler()),
+			Summary: "Execute an SQL query, or in safe mode return its plan and the token to run it with",
+			Params:  []param{shareableParam}, Body: _h.QueryRequest{}, Data: api.ResultData{},
+			RateLimited: true,
+		},
+		{
+			Path: "/execute/script", Method: "POST", Handler: handler.Track(handler.ScriptHandler()),
+			Summary: "Execute a script of several SQL statements",
+			Body:    _h.QueryRequest{}, Data: api.ResultData{},
+			RateLimited: true,
+		},
+		{
+			Path: "/format", Method: "POST", Handler: handler.FormatHandler(),
+			Summary: "Pretty-print a query without running it",
+			Body:    query.Query{}, Data: api.FormatData{},
+		},
+		{
+			Path: "/validate", Method: "POST", Handler: handler.Track(handler.ValidateHandler()),
+			Summary: "Check the syntax of a query without running it",
+			Body:    query.Query{}, Data: query.Validation{},
+		},
+		{
+			Path: "/upload/init", Method: "POST", Handler: handler.UploadInitHandler(),
+			Summary: "Start a chunked upload of a file to import",
+			Body:    _h.UploadInitRequest{}, Data: _h.UploadStatus{},
+			RateLimited: true,
+		},
+		{
+			Path: "/upload/chunk", Method: "PUT", Handler: handler.UploadChunkHandler(),
+			Summary: "Append a chunk to an upload, at its committed offset",
+			Params: []param{
+				uploadID,
+				{Name: "offset", Type: "integer", Required: true, Description: "Offset of the chunk, which must be the committed offset"},
+				{Name: "sha256", Type: "string", Required: true, Description: "Hex SHA-256 checksum of the chunk"},
+			},
+			Upload: "application/octet-stream", Data: _h.UploadStatus{},
+		},
+		{
+			Path: "/upload/status", Method: "GET", Handler: handler.UploadStatusHandler(),
+			Summary: "Get the committed offset of an upload, to resume it",
+			Params:  []param{uploadID},
+			Data:    _h.UploadStatus{},
+		},
+		{
+			Path: "/upload/complete", Method: "POST", Handler: handler.Track(handler.UploadCompleteHandler()),
+			Summary: "Hand a fully received upload to its import pipeline",
+			Body:    _h.UploadCompleteRequest{}, Data: api.ResultData{},
+			RateLimited: true,
+		},
+		{
+			Path: "/queries", Method: "GET", Handler: handler.SavedQueriesHandler(),
+			Summary: "List the saved queries of the connection",
+			Data:    []config.SavedQuery{},
+		},
+		{
+			Path: "/queries", Method: "POST", Handler: handler.SaveQueryHandler(),
+			Summary: "Save a named query, with optional :name placeholders, replacing the one with the same name",
+			Body:    _h.SaveQueryRequest{}, Data: config.SavedQuery{},
+		},
+		{
+			Path: "/queries", Method: "DELETE", Handler: handler.DeleteSavedQueryHandler(),
+			Summary: "Delete a saved query",
+			Params:  []param{{Name: "name", Type: "string", Required: true, Description: "Saved query name"}},
+		},
+		{
+			Path: "/queries/run", Method: "POST", Handler: handler.Track(handler.RunSavedQueryHandler()),
+			Summary: "Run a saved query, binding the values given to its placeholders",
+			Params:  []param{shareableParam}, Body: _h.RunSavedQueryRequest{},
+			Data:        api.SavedQueryRunData{},
+			RateLimited: true,
+		},
+		{
+			Path: "/queries/history", Method: "GET", Handler: handler.QueryHistoryHandler(),
+			Summary: "List the queries run against the connection, newest first",
+			Params:  pageParams,
+			Data:    _h.HistoryData{},
+		},
+		{
+			Path: "/queries/history/fix", Method: "POST", Handler: handler.FixQueryHistoryHandler(),
+			Summary: "Save the suggested rewrites of the queries naming tables renamed since they ran",
+			Params:  []param{{Name: "id", Type: "string", Description: "History entry id, every entry of the connection when omitted"}},
+			Data:    _h.RenamedQueriesData{},
+		},
+		{
+			Path: "/queries/history/rerun", Method: "POST", Handler: handler.Track(handler.RerunQueryHandler()),
+			Summary:     "Run a query from the history again",
+			Params:      []param{{Name: "id", Type: "string", Required: true, Description: "History entry id"}, allowSystem, confirm, autoFixParam},
+			Data:        api.RerunData{},
+			RateLimited: true,
+		},
+		{
+			Path: "/update", Method: "POST", Handler: handler.Track(handler.UpdateRowHandler()),
+			Summary: "Update a cell",
+			Body:    _h.UpdateRowRequest{}, Data: api.ResultData{},
+			RateLimited: true,
+		},
+		{
+			Path: "/update/batch", Method: "POST", Handler: handler.Track(handler.UpdateRowBatchHandler()),
+			Summary: "Update several cells in one transaction",
+			Body:    []_h.UpdateRowRequest{}, Data: api.ResultsData{},
+			RateLimited: true,
+		},
+		{
+			Path: "/row/update", Method: "POST", Handler: handler.Track(handler.RowEditHandler()),
+			Summary: "Update several columns of a row",
+			Body:    _h.RowEditRequest{}, Data: api.RowEditData{},
+			RateLimited: true,
+		},
+		{
+			Path: "/row/insert", Method: "POST", Handler: handler.Track(handler.RowInsertHandler()),
+			Summary: "Insert a row and return its key",
+			Body:    _h.RowInsertRequest{}, Data: api.ResultData{},
+			RateLimited: true,
+		},
+		{
+			Path: "/rows/delete", Method: "POST", Handler: handler.Track(handler.DeleteRowsHandler()),
+			Summary: "Delete the rows matching a filter",
+			Body:    _h.FilterRequest{}, Data: api.ResultData{},
+			RateLimited: true,
+		},
+		{
+			Path: "/rows/update", Method: "POST", Handler: handler.Track(handler.UpdateRowsHandler()),
+			Summary: "Update the rows matching a filter",
+			Body:    _h.UpdateRowsRequest{}, Data: api.ResultData{},
+			RateLimited: true,
+		},
+		{
+			Path: "/export/json", Method: "GET", Handler: handler.Track(handler.ExportTableToJson()),
+			Summary: "Export a table as JSON",
+			Params:  []param{nameParam, excludeParam}, File: "application/octet-stream",
+		},
+		{
+			Path: "/export/csv", Method: "GET", Handler: handler.Track(handler.ExportTableToCSV()),
+			Summary: "Export a table as CSV",
+			Params:  []param{nameParam, excludeParam}, File: "application/octet-stream",
+		},
+		{
+			Path: "/export/rows", Method: "POST", Handler: handler.Track(handler.ExportRowsHandler()),
+			Summary: "Export the selected rows as CSV or JSON",
+			Body:    _h.ExportRowsRequest{}, File: "application/octet-stream",
+		},
+		{
+			Path: "/cell/download", Method: "POST", Handler: handler.Track(handler.CellDownloadHandler()),
+			Summary: "Download the whole value of a cell, e.g. one truncated in a result",
+			Body:    _h.CellDownloadRequest{}, File: "application/octet-stream",
+		},
+		{
+			Path: "/export/templates", Method: "GET", Handler: handler.ExportTemplatesHandler(),
+			Summary: "List the export templates of the connection",
+			Data:    []_client.ExportTemplate{},
+		},
+		{
+			Path: "/export/templates/save", Method: "POST", Handler: handler.SaveExportTemplateHandler(),
+			Summary: "Save an export template, replacing the one with the same name",
+			Body:    _client.ExportTemplate{}, Data: _client.ExportTemplate{},
+		},
+		{
+			Path: "/export/templates/delete", Method: "POST", Handler: handler.DeleteExportTemplateHandler(),
+			Summary: "Delete an export template",
+			Params:  []param{templateName},
+		},
+		{
+			Path: "/export/templates/fix", Method: "POST", Handler: handler.FixExportTemplateHandler(),
+			Summary: "Point an export template at the new name of its renamed table",
+			Params:  []param{templateName},
+			Data:    _h.RenamedTemplateData{},
+		},
+		{
+			Path: "/export/templates/run", Method: "GET", Handler: handler.Track(handler.RunExportTemplateHandler()),
+			Summary: "Export the columns and rows an export template selects, in its format",
+			Params: []param{templateName, excludeParam,
+				{Name: "progressComments", Type: "boolean", Description: "Write a '# <rows> rows exported' line every 10000 rows of a CSV export"},
+			},
+			File: "application/octet-stream",
+		},
+		{
+			Path: "/export/sql", Method: "GET", Handler: handler.Track(handler.ShowCreateTable()),
+			Summary: "Export the CREATE statements of every table",
+			Params:  []param{{Name: "format", Type: "string", Description: "json returns the statements keyed by table instead of a file"}},
+			Data:    map[string]string{}, File: "application/octet-stream",
+		},
+		{
+			Path: "/export/schema-json", Method: "GET", Handler: handler.Track(handler.SchemaExportHandler()),
+			Summary: "Export every table with its columns, normalized types and keys as JSON, or as Go structs",
+			Params:  []param{{Name: "target", Type: "string", Description: "golang renders Go struct definitions instead of the JSON document"}},
+			File:    "application/json",
+		},
+		{
+			Path: "/schemas", Method: "GET", Handler: handler.Track(handler.ShowSchemas()),
+			Summary: "List the schemas, with the database file of each for SQLite",
+			Data:    []_client.SchemaInfo{},
+		},
+		{
+			Path: "/sqlite/attach", Method: "POST", Handler: handler.Track(handler.AttachDatabaseHandler()),
+			Summary: "Attach a SQLite database file under an alias, its tables browsed as alias.table",
+			Body:    connection.Attachment{},
+			Data:    api.AttachData{},
+		},
+		{
+			Path: "/sqlite/detach", Method: "POST", Handler: handler.Track(handler.DetachDatabaseHandler()),
+			Summary: "Detach the SQLite database attached under an alias",
+			Params:  []param{{Name: "name", Type: "string", Required: true, Description: "Alias of the attached database"}},
+			Data:    api.AttachedData{},
+		},
+		{
+			Path: "/collations", Method: "GET", Handler: handler.Track(handler.CharsetsHandler()),
+			Summary: "List the charsets and collations databases and tables can be created with",
+			Data:    api.CharsetsData{},
+		},
+		{
+			Path: "/table", Method: "GET", Handler: handler.Track(handler.TableDataHandler()),
+			Summary: "Read a page of a table",
+			Params: []param{
+				nameParam,
+				{Name: "page", Type: "integer", Description: "Page number, from 1 (default: 1)"},
+				{Name: "perPage", Type: "integer", Description: "Rows per page, required unless the connection sets defaultPerPage"},
+				{Name: "compact", Type: "boolean", Description: "Return the rows as value slices"},
+				{Name: "search", Type: "string", Description: "Only return the rows containing the text, ranked by relevance when the table has a full-text index"},
+				{Name: "collate", Type: "string", Description: "Sort the text columns with this collation of the server"},
+			},
+			Data: api.TablePage{},
+		},
+		{
+			Path: "/columns/table", Method: "GET", Handler: handler.Track(handler.GetColumnData()),
+			Summary: "Describe the columns of a table",
+			Params:  []param{nameParam}, Data: _client.ColumnData{},
+		},
+		{
+			Path: "/table/metadata/refresh", Method: "POST", Handler: handler.Track(handler.RefreshTableMetadataHandler()),
+			Summary: "Read the columns, keys and foreign keys of a table again, e.g. after another client changed it",
+			Params:  []param{nameParam}, Data: _client.RefreshedColumnData{},
+		},
+		{
+			Path: "/cache/refresh", Method: "POST", Handler: handler.Track(handler.CacheRefreshHandler()),
+			Summary: "Read the columns of every table of the schema again into the metadata cache, e.g. after other clients changed them",
+			Data:    api.CacheRefreshData{},
+		},
+		{
+			Path: "/table/size/", Method: "GET", Handler: handler.Track(handler.TableSizesHandler()),
+			Summary: "List the size of every table",
+			Data:    api.TableSizesData{},
+		},
+		{
+			Path: "/table/bloat", Method: "GET", Handler: handler.Track(handler.TableBloatHandler()),
+			Summary: "Report the reclaimable storage of a table",
+			Params:  []param{nameParam}, Data: api.TableBloatData{},
+		},
+		{
+			Path: "/tables/recent", Method: "GET", Handler: handler.RecentTablesHandler(),
+			Summary: "List the recently opened and favorite tables",
+			Data:    api.RecentTablesData{},
+		},
+		{
+			Path: "/tables/favorite", Method: "POST", Handler: handler.ToggleFavoriteTableHandler(),
+			Summary: "Toggle whether a table is a favorite",
+			Params:  []param{nameParam}, Data: api.FavoriteData{},
+		},
+		{
+			Path: "/usage/tables", Method: "GET", Handler: handler.TableUsageHandler(),
+			Summary: "List how often each table was viewed, exported and edited, the most used first",
+			Params:  []param{usageConnection}, Data: []config.TableUsage{},
+		},
+		{
+			Path: "/usage/tables/reset", Method: "POST", Handler: handler.ResetTableUsageHandler(),
+			Summary: "Forget the table usage of a connection, or of every connection",
+			Params:  []param{usageConnection},
+		},
+		{
+			Path: "/table/comment", Method: "POST", Handler: handler.Track(handler.TableCommentHandler()),
+			Summary: "Set the comment of a table",
+			Body:    _h.CommentRequest{}, Data: api.ResultData{},
+			RateLimited: true,
+		},
+		{
+			Path: "/connection/safe-mode", Method: "POST", Handler: handler.SafeModeHandler(),
+			Summary: "Turn on or off the safe mode of the connection, which explains statements sent to /execute and runs them once confirmed",
+			Params:  []param{{Name: "enabled", Type: "boolean", Required: true, Description: "Whether safe mode is on"}},
+			Data:    api.SafeModeData{},
+		},
+		{
+			Path: "/connection/stats", Method: "GET", Handler: handler.ConnectionStatsHandler(),
+			Summary: "Report the state of the connection pool",
+			Data:    _h.SessionStats{},
+		},
+		{
+			Path: "/ping", Method: "GET", Handler: handler.Track(handler.PingHandler()),
+			Summary: "Ping the database of the active connection and return the round trip latency",
+			Params:  []param{{Name: "timeout", Type: "string", Description: "Time allowed for the ping, e.g. 2s (default: 5s)"}},
+			Data:    _h.PingResult{},
+		},
+		{
+			Path: "/column/comment", Method: "POST", Handler: handler.Track(handler.ColumnCommentHandler()),
+			Summary: "Set the comment of a column",
+			Body:    _h.CommentRequest{}, Data: api.ResultData{},
+			RateLimited: true,
+		},
+		{
+			Path: "/table/column/dependencies", Method: "GET", Handler: handler.Track(handler.ColumnDependenciesHandler()),
+			Summary: "List the views, foreign keys and saved queries depending on a column",
+			Params: []param{
+				{Name: "table", Type: "string", Required: true, Description: "Table name"},
+				{Name: "column", Type: "string", Required: true, Description: "Column name"},
+			},
+			Data: _h.ColumnImpactData{},
+		},
+		{
+			Path: "/views", Method: "GET", Handler: handler.Track(handler.ViewsHandler()),
+			Summary: "List the views of the schema with their definitions",
+			Data:    api.ViewsData{},
+		},
+		{
+			Path: "/schema/version", Method: "GET", Handler: handler.SchemaVersionHandler(),
+			Summary: "Get the schema version, which changes with every schema change run through sqlweb",
+			Data:    api.VersionData{},
+		},
+		{
+			Path: "/routines", Method: "GET", Handler: handler.Track(handler.RoutinesHandler()),
+			Summary: "List the stored procedures and functions of the schema with their definitions",
+			Data:    api.RoutinesData{},
+		},
+		{
+			Path: "/server/locks", Method: "GET", Handler: handler.Track(handler.LockWaitsHandler()),
+			Summary: "List the sessions waiting for a lock, each paired with a session blocking it",
+			Data:    api.LockWaitsData{},
+		},
+		{
+			Path: "/table/referenced-by", Method: "GET", Handler: handler.Track(handler.ReferencedByHandler()),
+			Summary: "List the foreign keys of other tables referencing a table",
+			Params:  []param{nameParam}, Data: api.ReferencesData{},
+		},
+		{
+			Path: "/table/rename", Method: "POST", Handler: handler.Track(handler.RenameTableHandler()),
+			Summary: "Rename a table, recording the rename so saved queries and export templates can follow it",
+			Body:    _h.RenameTableRequest{}, Data: api.ResultData{},
+			RateLimited: true,
+		},
+		{
+			Path: "/table/column/rename", Method: "POST", Handler: handler.Track(handler.RenameColumnHandler()),
+			Summary: "Rename a column",
+			Body:    _h.RenameColumnRequest{}, Data: _h.RenameColumnData{},
+			RateLimited: true,
+		},
+	}
+}
+
+// RegisterRoutes registers the API without any limits, see RegisterAPIRoutes.
+func RegisterRoutes(mux *http.ServeMux, handler *_h.Handler) {
+	RegisterAPIRoutes(mux, handler, Limits{})
+}
+
+// RegisterAPIRoutes registers the API, capping request bodies and rate limiting the execute
+// and mutation routes per client IP. The UI is registered apart, see RegisterUIRoutes.
+func RegisterAPIRoutes(mux *http.ServeMux, handler *_h.Handler, limits Limits) {
+	var limiter *rateLimiter
+	if limits.Rate > 0 {
+		limiter = newRateLimiter(limits.Rate, limits.Burst)
+	}
+
 	mux.HandleFunc("/debug/pprof/", pprof.Index)
 	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
 	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
 	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
 	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
-	mux.HandleFunc("/connect", handleMethod("POST", handler.ConnectHandler()))
-	mux.HandleFunc("/save", handleMethod("POST", handler.SaveConnection()))
-	mux.HandleFunc("/saved/connections", handleMethod("GET", handler.SavedConnectionsHandler()))
-	mux.HandleFunc("/disconnect", handleMethod("POST", handler.DbDisconnect()))
-	mux.HandleFunc("/execute", handleMethod("POST", handler.QueryHandler()))
-	mux.HandleFunc("/update", handleMethod("POST", handler.UpdateRowHandler()))
-	mux.HandleFunc("/export/json", handleMethod("GET", handler.ExportTableToJson()))
-	mux.HandleFunc("/export/csv", handleMethod("GET", handler.ExportTableToCSV()))
-	mux.HandleFunc("/export/sql", handleMethod("GET", handler.ShowCreateTable()))
-	mux.HandleFunc("/schemas", handleMethod("GET", handler.ShowSchemas()))
-	mux.HandleFunc("/table", handleMethod("GET", handler.TableDataHandler()))
-	mux.HandleFunc("/columns/table", handleMethod("GET", handler.GetColumnData()))
-	mux.HandleFunc("/table/size/", handleMethod("GET", handler.TableSizesHandler()))
+
+	apiRoutes := routes(handler)
+	// several routes may share a path, like GET and POST /queries, so the mux serves each path once
+	byPath := make(map[string]map[string]http.HandlerFunc)
+	for _, r := range apiRoutes {
+		h := r.Handler
+		if limits.MaxBody > 0 && r.Body != nil {
+			h = limitBody(limits.MaxBody, h)
+		}
+		if limiter != nil && r.RateLimited {
+			h = rateLimit(limiter, h)
+		}
+		h = handler.Versioned(h)
+		h = tracing.Route(r.Method, r.Path, h)
+		if byPath[r.Path] == nil {
+			byPath[r.Path] = make(map[string]http.HandlerFunc)
+		}
+		byPath[r.Path][r.Method] = h
+	}
+	for path, handlers := range byPath {
+		mux.HandleFunc(path, handleMethods(handlers))
+	}
+	mux.HandleFunc("/openapi.json", handleMethod("GET", serveOpenAPI(apiRoutes)))
 	// mux.HandleFunc("/client", handleMethod("GET", handler.ShowConnectedClient))
 	// mux.HandleFunc("/schema/:name/drop", handleMethod("POST", handler.DropDatabaseHandler))
 	// mux.HandleFunc("/schema/create/:name", handleMethod("POST", handler.CreateDatabaseHandler))
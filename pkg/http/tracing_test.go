@@ -0,0 +1,85 @@
+package http
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_h "github.com/yazeed1s/sqlweb/pkg/handler"
+	"github.com/yazeed1s/sqlweb/pkg/tracing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func spanAttribute(span sdktrace.ReadOnlySpan, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestTraceTableRequest(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+	})
+
+	path := filepath.Join(t.TempDir(), "traced.db")
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	_, err = db.Exec(`CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT);
+		INSERT INTO people (name) VALUES ('ada'), ('grace'), ('linus')`)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	handler := _h.NewHandler()
+	mux := http.NewServeMux()
+	RegisterRoutes(mux, handler)
+	body := strings.NewReader(fmt.Sprintf(`{"databaseType": "sqlite", "database": "traced", "path": %q}`, path))
+	response := httptest.NewRecorder()
+	mux.ServeHTTP(response, httptest.NewRequest(http.MethodPost, "/connect", body))
+	require.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	t.Cleanup(func() {
+		_ = handler.GetDB().Close()
+	})
+
+	response = httptest.NewRecorder()
+	mux.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/table?name=people&page=1&perPage=2", nil))
+	require.Equal(t, http.StatusOK, response.Code, response.Body.String())
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	request, ok := spans["GET /table"]
+	require.True(t, ok, "no span for the request")
+	assert.Equal(t, int64(http.StatusOK), spanAttribute(request, "http.response.status_code").AsInt64())
+
+	count, ok := spans["CountTableRows"]
+	require.True(t, ok, "no span for the count query")
+	assert.Equal(t, request.SpanContext().SpanID(), count.Parent().SpanID())
+	assert.Equal(t, "people", spanAttribute(count, tracing.TableAttribute).AsString())
+	assert.Equal(t, int64(3), spanAttribute(count, tracing.RowsAttribute).AsInt64())
+
+	page, ok := spans["GetTable"]
+	require.True(t, ok, "no span for the data query")
+	assert.Equal(t, request.SpanContext().SpanID(), page.Parent().SpanID())
+	assert.Equal(t, "SELECT", spanAttribute(page, "db.operation.name").AsString())
+	assert.Equal(t, int64(2), spanAttribute(page, tracing.RowsAttribute).AsInt64())
+}
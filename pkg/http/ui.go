@@ -0,0 +1,13 @@
+package http
+
+import (
+	"net/http"
+
+	_static "github.com/yazeed1s/sqlweb/static"
+)
+
+// RegisterUIRoutes serves the static UI, on its own mux or on the API's: the API routes are more
+// specific, so they keep precedence over the UI's catch-all.
+func RegisterUIRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/", _static.ServeStaticFiles)
+}
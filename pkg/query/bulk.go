@@ -0,0 +1,260 @@
+package query
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	_sql "github.com/yazeed1s/sqlweb/db/sql"
+	_client "github.com/yazeed1s/sqlweb/pkg/client"
+	"github.com/yazeed1s/sqlweb/pkg/util"
+)
+
+// buildDeleteWhere builds a parameterized DELETE restricted by the filter.
+// An empty filter is refused so that a table is never emptied by accident.
+func buildDeleteWhere(dbType, schema, table string, filter _client.Filter) (string, []interface{}, error) {
+	if len(filter) == 0 {
+		return "", nil, util.ErrEmptyFilter
+	}
+	where, args, err := filter.Where(dbType, 1)
+	if err != nil {
+		return "", nil, err
+	}
+	query := fmt.Sprintf("DELETE FROM %s WHERE %s", _client.QualifiedTable(dbType, schema, table), where)
+	return query, args, nil
+}
+
+// DeleteWhere deletes the rows of the table that match the filter and reports how many were removed.
+func DeleteWhere(table string, filter _client.Filter, client *_client.Client) (*Result, error) {
+	if err := checkDatabaseConnection(client.Database); err != nil {
+		return nil, err
+	}
+
+	var (
+		err         error
+		query       string
+		args        []interface{}
+		res         sql.Result
+		startTime   time.Time
+		elapsedTime time.Duration
+		rows        int64
+	)
+
+	query, args, err = buildDeleteWhere(client.Type.String(), client.Schema.Name, table, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	startTime = time.Now()
+	res, err = client.Database.Exec(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	elapsedTime = time.Since(startTime)
+
+	rows, err = res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Result{
+		AffectedRows: rows,
+		Time:         fmt.Sprintf("%.3f", elapsedTime.Seconds()),
+		TimeMS:       elapsedTime.Milliseconds(),
+		Msg:          fmt.Sprintf("Rows deleted successfully (%d rows affected, time taken %.3f)", rows, elapsedTime.Seconds()),
+	}, nil
+}
+
+// columnKey returns the name under which a column is looked up: folded to lower case for SQLite,
+// whose column names are case-insensitive, unchanged for the other databases.
+func columnKey(dbType, name string) string {
+	if strings.EqualFold(dbType, _sql.SQLite.String()) {
+		return strings.ToLower(name)
+	}
+	return name
+}
+
+// bindValue converts a JSON-decoded value to the type the driver should bind for a column of the given data type,
+// so that e.g. 42.0 is sent as an integer to an INT column and numbers are sent as text to a VARCHAR column.
+func bindValue(dataType string, value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	lowerCase := strings.ToLower(dataType)
+	for _, substr := range stringDataTypes {
+		if strings.Contains(lowerCase, substr) {
+			if str, ok := value.(string); ok {
+				return str, nil
+			}
+			return fmt.Sprint(value), nil
+		}
+	}
+
+	switch {
+	case strings.Contains(lowerCase, "bool"):
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			return strconv.ParseBool(v)
+		}
+	case strings.Contains(lowerCase, "int") && !strings.Contains(lowerCase, "point") && !strings.Contains(lowerCase, "interval"):
+		switch v := value.(type) {
+		case json.Number:
+			return v.Int64()
+		case float64:
+			if v == math.Trunc(v) {
+				return int64(v), nil
+			}
+		case string:
+			return strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		case bool, int, int64:
+			return v, nil
+		}
+		return nil, fmt.Errorf("value %v is not a valid %s", value, dataType)
+	}
+
+	if v, ok := value.(json.Number); ok {
+		return v.String(), nil
+	}
+	return value, nil
+}
+
+// buildUpdate builds a parameterized UPDATE setting the given columns on the rows matching the filter.
+// Columns are validated against the table's metadata and bound according to their type; generated columns are refused.
+// An empty filter is refused unless 'all' is set.
+func buildUpdate(
+	dbType, schema, table string,
+	columns []_client.Column,
+	set map[string]interface{},
+	filter _client.Filter,
+	all bool,
+) (string, []interface{}, error) {
+	if len(set) == 0 {
+		return "", nil, fmt.Errorf("no columns to update")
+	}
+	if len(filter) == 0 && !all {
+		return "", nil, util.ErrEmptyFilter
+	}
+
+	var (
+		names       []string
+		assignments []string
+		args        []interface{}
+		types       map[string]_client.Column
+	)
+
+	types = make(map[string]_client.Column, len(columns))
+	for _, col := range columns {
+		types[columnKey(dbType, col.Field)] = col
+	}
+
+	names = sortedNames(set)
+
+	for i, name := range names {
+		col, ok := types[columnKey(dbType, name)]
+		if !ok {
+			return "", nil, fmt.Errorf("column '%s' not found in table '%s'", name, table)
+		}
+		if col.IsGenerated {
+			return "", nil, fmt.Errorf("%s.%s: %w", table, name, util.ErrColumnNotWritable)
+		}
+		value, err := bindValue(col.Type, set[name])
+		if err != nil {
+			return "", nil, fmt.Errorf("column '%s': %w", name, err)
+		}
+		assignments = append(assignments, fmt.Sprintf("%s = %s",
+			_client.QuoteIdentifier(dbType, col.Field), _client.Placeholder(dbType, i+1)))
+		args = append(args, value)
+	}
+
+	query := fmt.Sprintf("UPDATE %s SET %s",
+		_client.QualifiedTable(dbType, schema, table), strings.Join(assignments, ", "))
+	if len(filter) == 0 {
+		return query, args, nil
+	}
+
+	where, whereArgs, err := filter.Where(dbType, len(args)+1)
+	if err != nil {
+		return "", nil, err
+	}
+	return query + " WHERE " + where, append(args, whereArgs...), nil
+}
+
+// UpdateWhere sets the given column values on every row of the table that matches the filter
+// and reports how many rows were changed. The filter is required, see UpdateAll to update every row.
+func UpdateWhere(table string, set map[string]interface{}, filter _client.Filter, client *_client.Client) (*Result, error) {
+	return updateRows(table, set, filter, false, client)
+}
+
+// UpdateAll sets the given column values on every row of the table.
+// It is the explicit counterpart of UpdateWhere for table-wide updates.
+func UpdateAll(table string, set map[string]interface{}, client *_client.Client) (*Result, error) {
+	return updateRows(table, set, nil, true, client)
+}
+
+func updateRows(table string, set map[string]interface{}, filter _client.Filter, all bool, client *_client.Client) (*Result, error) {
+	if err := checkDatabaseConnection(client.Database); err != nil {
+		return nil, err
+	}
+
+	var (
+		err         error
+		query       string
+		args        []interface{}
+		columns     []_client.Column
+		res         sql.Result
+		startTime   time.Time
+		elapsedTime time.Duration
+		rows        int64
+	)
+
+	named := sortedNames(set)
+	for _, condition := range filter {
+		named = append(named, condition.Column)
+	}
+	columns, err = client.GetCachedColumnsWith(client.Schema.Name, table, named...)
+	if err != nil {
+		return nil, err
+	}
+
+	query, args, err = buildUpdate(client.Type.String(), client.Schema.Name, table, columns, set, filter, all)
+	if err != nil {
+		return nil, err
+	}
+
+	startTime = time.Now()
+	res, err = client.Database.Exec(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	elapsedTime = time.Since(startTime)
+
+	rows, err = res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Result{
+		AffectedRows: rows,
+		Time:         fmt.Sprintf("%.3f", elapsedTime.Seconds()),
+		TimeMS:       elapsedTime.Milliseconds(),
+		Msg:          fmt.Sprintf("Rows updated successfully (%d rows affected, time taken %.3f)", rows, elapsedTime.Seconds()),
+	}, nil
+}
+
+// sortedNames returns the columns the values are given for, sorted.
+func sortedNames(values map[string]interface{}) []string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,100 @@
+package query
+
+import (
+	"database/sql"
+	"fmt"
+
+	_client "github.com/yazeed1s/sqlweb/pkg/client"
+)
+
+// Cell identifies a single value: a column of the row identified by KeyColumns/KeyValues.
+type Cell struct {
+	Table      string
+	Column     string
+	KeyColumns []string
+	KeyValues  []interface{}
+}
+
+// ReadCell reads the whole value of a cell, never truncated, as the bytes the driver returned.
+// A NULL value reads as nil. It fails if the key matches no row or several.
+func ReadCell(client *_client.Client, cell Cell) ([]byte, error) {
+	if err := checkDatabaseConnection(client.Database); err != nil {
+		return nil, err
+	}
+
+	var (
+		err     error
+		columns []_client.Column
+		column  string
+		bound   []interface{}
+		where   string
+		args    []interface{}
+		rows    *sql.Rows
+		value   interface{}
+		matches int
+		dbType  = client.Type.String()
+	)
+
+	columns, err = client.GetColumns(cell.Table)
+	if err != nil {
+		return nil, err
+	}
+	for _, col := range columns {
+		if columnKey(dbType, col.Field) == columnKey(dbType, cell.Column) {
+			column = col.Field
+		}
+	}
+	if column == "" {
+		return nil, fmt.Errorf("column '%s' not found in table '%s'", cell.Column, cell.Table)
+	}
+
+	bound, err = bindKeyValues(dbType, columns, cell.KeyColumns, cell.KeyValues)
+	if err != nil {
+		return nil, err
+	}
+	where, args, err = keyFilter(cell.KeyColumns, bound).Where(dbType, 1)
+	if err != nil {
+		return nil, err
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s", _client.QuoteIdentifier(dbType, column),
+		_client.QualifiedTable(dbType, client.Schema.Name, cell.Table), where)
+
+	rows, err = client.Database.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	for rows.Next() {
+		if err = rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		matches++
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case matches == 0:
+		return nil, fmt.Errorf("no row of '%s' matches key %v", cell.Table, cell.KeyValues)
+	case matches > 1:
+		return nil, fmt.Errorf("key %v matches %d rows of '%s', it must identify a single row", cell.KeyValues, matches, cell.Table)
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	default:
+		return []byte(fmt.Sprint(v)), nil
+	}
+}
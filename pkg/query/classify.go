@@ -0,0 +1,294 @@
+package query
+
+import (
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+
+	_client "github.com/yazeed1s/sqlweb/pkg/client"
+)
+
+// TableRef is a schema-qualified table referenced by a statement, e.g. `otherdb.sometable`.
+type TableRef struct {
+	Schema string `json:"schema"`
+	Table  string `json:"table"`
+}
+
+// identifier matches a bare, backtick-quoted or double-quoted SQL identifier.
+const identifier = "(`[^`]+`|\"[^\"]+\"|[A-Za-z_][A-Za-z0-9_$]*)"
+
+// qualifiedTablePattern matches `schema.table` following the keywords that introduce a table
+// (FROM, JOIN, UPDATE, INTO, TABLE).
+var qualifiedTablePattern = regexp.MustCompile(
+	`(?i)\b(?:FROM|JOIN|UPDATE|INTO|TABLE)\s+` + identifier + `\s*\.\s*` + identifier,
+)
+
+// unquoteIdentifier strips the surrounding backticks, double quotes or SQLite brackets from an identifier.
+func unquoteIdentifier(ident string) string {
+	if len(ident) >= 2 {
+		first, last := ident[0], ident[len(ident)-1]
+		if (first == '`' && last == '`') || (first == '"' && last == '"') || (first == '[' && last == ']') {
+			return ident[1 : len(ident)-1]
+		}
+	}
+	return ident
+}
+
+// ReferencedTables extracts the schema-qualified tables a statement reads from or writes to.
+// Unqualified tables are ignored since they resolve to the schema the client is browsing.
+// Each table is returned once, in order of first appearance.
+func ReferencedTables(query string) []TableRef {
+	var (
+		refs []TableRef
+		seen map[TableRef]bool
+	)
+
+	seen = make(map[TableRef]bool)
+	for _, match := range qualifiedTablePattern.FindAllStringSubmatch(query, -1) {
+		ref := TableRef{
+			Schema: unquoteIdentifier(match[1]),
+			Table:  unquoteIdentifier(match[2]),
+		}
+		if seen[ref] {
+			continue
+		}
+		seen[ref] = true
+		refs = append(refs, ref)
+	}
+	return refs
+}
+
+// referencedColumns looks up the column metadata of every schema-qualified table in the query,
+// keyed by "schema.table". Tables the user cannot read (or that do not exist) are skipped
+// so that a permission error on another schema never fails the query itself.
+func referencedColumns(query string, client *_client.Client) map[string][]_client.Column {
+	var (
+		refs    []TableRef
+		columns map[string][]_client.Column
+	)
+
+	refs = ReferencedTables(query)
+	if len(refs) == 0 {
+		return nil
+	}
+
+	columns = make(map[string][]_client.Column, len(refs))
+	for _, ref := range refs {
+		cols, err := client.GetCachedColumns(ref.Schema, ref.Table)
+		if err != nil {
+			log.Printf("skipping column metadata for %s.%s: %v", ref.Schema, ref.Table, err)
+			continue
+		}
+		if len(cols) == 0 {
+			continue
+		}
+		columns[ref.Schema+"."+ref.Table] = cols
+	}
+
+	if len(columns) == 0 {
+		return nil
+	}
+	return columns
+}
+
+// readOnlyKeywords are the leading keywords of statements that never modify data or schema.
+var readOnlyKeywords = map[string]bool{
+	"SELECT":   true,
+	"SHOW":     true,
+	"DESCRIBE": true,
+	"DESC":     true,
+	"VALUES":   true,
+	"TABLE":    true,
+}
+
+// writeKeywords are the data-modifying keywords that may appear inside WITH or EXPLAIN statements.
+// INTO also makes a SELECT write, into a table (SELECT ... INTO t), a variable or a file.
+var writeKeywords = map[string]bool{
+	"INSERT":   true,
+	"UPDATE":   true,
+	"DELETE":   true,
+	"MERGE":    true,
+	"REPLACE":  true,
+	"TRUNCATE": true,
+	"DROP":     true,
+	"ALTER":    true,
+	"CREATE":   true,
+	"INTO":     true,
+}
+
+// intoKeyword is the keyword writing the rows of a read-only statement somewhere.
+var intoKeyword = map[string]bool{"INTO": true}
+
+// readOnlyPragmas are the SQLite pragmas taking an argument in parentheses that only read, e.g. table_info(t).
+// Others, such as wal_checkpoint(TRUNCATE), change the database.
+var readOnlyPragmas = map[string]bool{
+	"table_info":        true,
+	"table_xinfo":       true,
+	"index_info":        true,
+	"index_xinfo":       true,
+	"index_list":        true,
+	"foreign_key_list":  true,
+	"foreign_key_check": true,
+	"integrity_check":   true,
+	"quick_check":       true,
+	"table_list":        true,
+	"collation_list":    true,
+	"database_list":     true,
+	"compile_options":   true,
+	"pragma_list":       true,
+	"module_list":       true,
+	"function_list":     true,
+}
+
+// writePragmas are the SQLite pragmas that change the database even without a value.
+var writePragmas = map[string]bool{
+	"optimize":           true,
+	"incremental_vacuum": true,
+	"wal_checkpoint":     true,
+	"shrink_memory":      true,
+}
+
+// leadingKeyword returns the first keyword of a statement, upper-cased, ignoring comments and parentheses.
+func leadingKeyword(statement string) string {
+	for _, tokens := range splitStatements("", statement) {
+		return firstKeyword(tokens)
+	}
+	return ""
+}
+
+// IsReadOnlyStatement reports whether every statement in the query only reads data. The query is split
+// with the lexical rules of the database type, so a semicolon or comment inside a string does not hide
+// a statement. WITH and EXPLAIN statements are read-only as long as they do not embed a write
+// (e.g. a data-modifying CTE or EXPLAIN ANALYZE DELETE), a SELECT as long as it has no INTO, and
+// PRAGMA as long as it neither assigns a value nor is one of the pragmas that write.
+// Anything not recognized is treated as a write.
+func IsReadOnlyStatement(dbType, query string) bool {
+	for _, statement := range splitStatements(dbType, query) {
+		if !isReadOnly(statement) {
+			return false
+		}
+	}
+	return true
+}
+
+// isReadOnly reports whether a single statement only reads data.
+func isReadOnly(statement []token) bool {
+	keyword := firstKeyword(statement)
+	switch {
+	case readOnlyKeywords[keyword]:
+		return !hasWord(statement, intoKeyword)
+	case keyword == "WITH" || keyword == "EXPLAIN":
+		return !hasWord(statement, writeKeywords)
+	case keyword == "PRAGMA":
+		return isReadOnlyPragma(statement)
+	}
+	return false
+}
+
+// isReadOnlyPragma reports whether a PRAGMA statement only reads, e.g. PRAGMA journal_mode
+// or PRAGMA main.table_info(t).
+func isReadOnlyPragma(statement []token) bool {
+	var (
+		name string
+		call bool
+	)
+
+	for _, t := range statement[1:] {
+		switch {
+		case t.kind == tokenOperator && strings.Contains(t.text, "="):
+			return false
+		case t.kind == tokenPunct && t.text == "(":
+			call = true
+		case t.kind == tokenWord || t.kind == tokenQuoted:
+			// the last name before the argument, after an optional schema
+			if !call {
+				name = strings.ToLower(unquoteIdentifier(t.text))
+			}
+		}
+	}
+	if call {
+		return readOnlyPragmas[name]
+	}
+	return !writePragmas[name]
+}
+
+// schemaKeywords are the leading keywords of statements that change the schema rather than the data.
+var schemaKeywords = map[string]bool{
+	"CREATE":  true,
+	"ALTER":   true,
+	"DROP":    true,
+	"RENAME":  true,
+	"COMMENT": true,
+}
+
+// ChangesSchema reports whether any statement in the query creates, alters, drops, renames
+// or comments on an object, after which the tables and columns read before may be stale.
+func ChangesSchema(dbType, query string) bool {
+	for _, statement := range splitStatements(dbType, query) {
+		if schemaKeywords[firstKeyword(statement)] {
+			return true
+		}
+	}
+	return false
+}
+
+// dropKeyword is DROP anywhere in a statement, e.g. ALTER TABLE ... DROP COLUMN.
+var dropKeyword = map[string]bool{"DROP": true}
+
+// isDestructive reports whether a single statement drops or truncates an object, or changes every row of a table.
+func isDestructive(statement []token) bool {
+	switch firstKeyword(statement) {
+	case "DROP", "TRUNCATE":
+		return true
+	case "ALTER":
+		return hasWord(statement, dropKeyword)
+	case "DELETE", "UPDATE", "WITH":
+		return unfiltered(statement)
+	}
+	return false
+}
+
+// unfiltered reports whether the statement is a DELETE or an UPDATE without a WHERE clause of its own:
+// a WHERE in a subquery or a common table expression filters nothing it changes.
+func unfiltered(statement []token) bool {
+	words := topLevelWords(statement)
+	for i, word := range words {
+		switch word {
+		case "DELETE", "UPDATE":
+			return !slices.Contains(words[i+1:], "WHERE")
+		case "SELECT", "INSERT", "REPLACE", "MERGE", "VALUES":
+			// WITH ... SELECT ... FOR UPDATE, WITH ... INSERT ... DO UPDATE
+			return false
+		}
+	}
+	return false
+}
+
+// IsDestructiveStatement reports whether any statement in the query drops or truncates an object, or
+// changes every row of a table: DROP and TRUNCATE statements, ALTER statements that drop a column or
+// constraint, and DELETE and UPDATE statements without a WHERE clause.
+func IsDestructiveStatement(dbType, query string) bool {
+	return len(destructiveStatements(dbType, query)) > 0
+}
+
+// DestructiveTargets returns the tables and schemas named by the destructive statements of the query.
+// Unqualified tables are resolved against defaultSchema. Objects other than tables and schemas are not
+// reported, except for an index dropped ON its table, so the result may be empty for a destructive query.
+func DestructiveTargets(dbType, defaultSchema, query string) []TableRef {
+	var refs []TableRef
+	for _, statement := range destructiveStatements(dbType, query) {
+		refs = append(refs, statementTargets(statement, defaultSchema)...)
+	}
+	return refs
+}
+
+func destructiveStatements(dbType, query string) [][]token {
+	var statements [][]token
+	for _, statement := range splitStatements(dbType, query) {
+		if isDestructive(statement) {
+			statements = append(statements, statement)
+		}
+	}
+	return statements
+}
@@ -0,0 +1,177 @@
+package query
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	_sql "github.com/yazeed1s/sqlweb/db/sql"
+	_client "github.com/yazeed1s/sqlweb/pkg/client"
+	"github.com/yazeed1s/sqlweb/pkg/util"
+)
+
+// buildTableCommentQuery returns the statement that sets a table comment.
+func buildTableCommentQuery(dbType, schema, table, comment string) (string, error) {
+	switch strings.ToLower(dbType) {
+	case strings.ToLower(_sql.MySQL.String()):
+		return fmt.Sprintf(
+			_sql.MySQLSetTableComment,
+			_client.QualifiedTable(dbType, schema, table), _client.QuoteLiteral(dbType, comment),
+		), nil
+	case strings.ToLower(_sql.PostgreSQL.String()):
+		return fmt.Sprintf(
+			_sql.PostgreSQLSetTableComment,
+			_client.QualifiedTable(dbType, schema, table), _client.QuoteLiteral(dbType, comment),
+		), nil
+	}
+	return "", fmt.Errorf("%s: %w", dbType, util.ErrCommentsUnsupported)
+}
+
+// buildColumnCommentQuery returns the statement that sets a column comment.
+// MySQL can only comment a column by redefining it, so 'definition' must hold the column's
+// current definition (type, nullability, default...); it is ignored for PostgreSQL.
+func buildColumnCommentQuery(dbType, schema, table, column, definition, comment string) (string, error) {
+	switch strings.ToLower(dbType) {
+	case strings.ToLower(_sql.MySQL.String()):
+		return fmt.Sprintf(
+			_sql.MySQLModifyColumnComment,
+			_client.QualifiedTable(dbType, schema, table), _client.QuoteIdentifier(dbType, column),
+			definition, _client.QuoteLiteral(dbType, comment),
+		), nil
+	case strings.ToLower(_sql.PostgreSQL.String()):
+		return fmt.Sprintf(
+			_sql.PostgreSQLSetColumnComment,
+			_client.QualifiedTable(dbType, schema, table), _client.QuoteIdentifier(dbType, column),
+			_client.QuoteLiteral(dbType, comment),
+		), nil
+	}
+	return "", fmt.Errorf("%s: %w", dbType, util.ErrCommentsUnsupported)
+}
+
+// mySQLColumnDefinition rebuilds the definition of an existing MySQL column (everything that
+// follows the column name in a MODIFY COLUMN clause, minus the comment).
+func mySQLColumnDefinition(table, schema, column string, db *sql.DB) (string, error) {
+	var (
+		err        error
+		columnType string
+		nullable   string
+		defaultVal sql.NullString
+		extra      string
+		generation string
+		charset    string
+		collation  string
+		builder    strings.Builder
+	)
+
+	err = db.QueryRow(fmt.Sprintf(_sql.MySQLColumnDefinition, schema, table, column)).Scan(
+		&columnType, &nullable, &defaultVal, &extra, &generation, &charset, &collation,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", fmt.Errorf("column '%s' not found in table '%s'", column, table)
+		}
+		return "", err
+	}
+
+	builder.WriteString(columnType)
+	// MODIFY COLUMN resets them to the defaults of the table unless they are given again
+	if charset != "" {
+		builder.WriteString(" CHARACTER SET " + charset)
+	}
+	if collation != "" {
+		builder.WriteString(" COLLATE " + collation)
+	}
+	extra = strings.TrimSpace(extra)
+	if generation != "" {
+		storage := "VIRTUAL"
+		if strings.Contains(strings.ToUpper(extra), "STORED") {
+			storage = "STORED"
+		}
+		builder.WriteString(fmt.Sprintf(" GENERATED ALWAYS AS (%s) %s", generation, storage))
+		extra = ""
+	}
+	if nullable == "NO" {
+		builder.WriteString(" NOT NULL")
+	} else {
+		builder.WriteString(" NULL")
+	}
+	if defaultVal.Valid {
+		if strings.Contains(strings.ToUpper(extra), "DEFAULT_GENERATED") {
+			builder.WriteString(" DEFAULT " + defaultVal.String)
+		} else {
+			builder.WriteString(" DEFAULT " + _client.QuoteLiteral(_sql.MySQL.String(), defaultVal.String))
+		}
+	}
+	extra = strings.TrimSpace(strings.ReplaceAll(extra, "DEFAULT_GENERATED", ""))
+	if extra != "" {
+		builder.WriteString(" " + extra)
+	}
+	return builder.String(), nil
+}
+
+// execSchemaChange runs a DDL statement (comment, rename...) and wraps the outcome in a Result.
+func execSchemaChange(query, msg string, db *sql.DB) (*Result, error) {
+	var (
+		err         error
+		startTime   time.Time
+		elapsedTime time.Duration
+	)
+
+	startTime = time.Now()
+	_, err = db.Exec(query)
+	if err != nil {
+		return nil, err
+	}
+	elapsedTime = time.Since(startTime)
+	return &Result{
+		AffectedRows: 0,
+		Time:         fmt.Sprintf("%.3f", elapsedTime.Seconds()),
+		TimeMS:       elapsedTime.Milliseconds(),
+		Msg:          fmt.Sprintf("%s (%s)", msg, elapsedTime.String()),
+	}, nil
+}
+
+// SetTableComment sets (or, with an empty comment, clears) the comment of a table.
+func SetTableComment(table, comment string, client *_client.Client) (*Result, error) {
+	if err := checkDatabaseConnection(client.Database); err != nil {
+		return nil, err
+	}
+
+	query, err := buildTableCommentQuery(client.Type.String(), client.Schema.Name, table, comment)
+	if err != nil {
+		return nil, err
+	}
+	return execSchemaChange(query, fmt.Sprintf("Comment on table '%s' updated successfully", table), client.Database)
+}
+
+// SetColumnComment sets (or, with an empty comment, clears) the comment of a column.
+func SetColumnComment(table, column, comment string, client *_client.Client) (*Result, error) {
+	if err := checkDatabaseConnection(client.Database); err != nil {
+		return nil, err
+	}
+
+	var (
+		err        error
+		query      string
+		definition string
+	)
+
+	if strings.EqualFold(client.Type.String(), _sql.MySQL.String()) {
+		definition, err = mySQLColumnDefinition(table, client.Schema.Name, column, client.Database)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	query, err = buildColumnCommentQuery(client.Type.String(), client.Schema.Name, table, column, definition, comment)
+	if err != nil {
+		return nil, err
+	}
+	return execSchemaChange(
+		query,
+		fmt.Sprintf("Comment on column '%s.%s' updated successfully", table, column),
+		client.Database,
+	)
+}
@@ -0,0 +1,50 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	_sql "github.com/yazeed1s/sqlweb/db/sql"
+	_client "github.com/yazeed1s/sqlweb/pkg/client"
+	"github.com/yazeed1s/sqlweb/pkg/util"
+)
+
+// explainable are the statements Explain accepts. Anything else, notably an option list such as
+// (ANALYZE) DELETE or ANALYZE DELETE, would turn EXPLAIN into a statement that runs the query.
+var explainable = toSet("SELECT", "INSERT", "UPDATE", "DELETE", "REPLACE", "MERGE", "VALUES", "WITH", "TABLE")
+
+// Explain returns the plan of the query without running it: EXPLAIN on MySQL and PostgreSQL,
+// never with ANALYZE, and EXPLAIN QUERY PLAN on SQLite. The query is appended to EXPLAIN, and the drivers
+// run every statement of a string, so util.ErrSingleStatement is returned for a query holding several and
+// util.ErrNotExplainable for one that does not start with a statement EXPLAIN plans.
+func Explain(ctx context.Context, q *Query, client *_client.Client) (*Result, error) {
+	var (
+		explain    string
+		trimmed    = strings.TrimRight(strings.TrimSpace(q.SQLQuery), "; \t\r\n")
+		statements = splitStatements(client.Type.String(), trimmed)
+	)
+
+	switch {
+	case len(statements) > 1:
+		return nil, util.ErrSingleStatement
+	case len(statements) == 0 || !explainable[firstKeyword(statements[0])]:
+		return nil, util.ErrNotExplainable
+	}
+
+	switch strings.ToLower(client.Type.String()) {
+	case strings.ToLower(_sql.MySQL.String()):
+		explain = _sql.MySQLExplain
+	case strings.ToLower(_sql.PostgreSQL.String()):
+		explain = _sql.PostgreSQLExplain
+	case strings.ToLower(_sql.SQLite.String()):
+		explain = _sql.SQLiteExplain
+	default:
+		return nil, fmt.Errorf("unsupported database type: %s", client.Type.String())
+	}
+	return ExecuteQueryContext(ctx, &Query{
+		SQLQuery:  fmt.Sprintf(explain, trimmed),
+		TimeoutMs: q.TimeoutMs,
+		Args:      q.Args,
+	}, client)
+}
@@ -0,0 +1,244 @@
+package query
+
+import (
+	"strings"
+)
+
+// formatIndent is the indentation of one level.
+const formatIndent = "  "
+
+// formatKeywords are upper-cased by FormatQuery. Anything else keeps its case.
+var formatKeywords = toSet(
+	"SELECT", "FROM", "WHERE", "GROUP", "BY", "ORDER", "HAVING", "LIMIT", "OFFSET", "VALUES", "SET",
+	"UPDATE", "INSERT", "INTO", "DELETE", "RETURNING", "WITH", "RECURSIVE", "UNION", "ALL", "INTERSECT",
+	"EXCEPT", "JOIN", "INNER", "LEFT", "RIGHT", "FULL", "OUTER", "CROSS", "NATURAL", "ON", "USING", "AND",
+	"OR", "NOT", "IN", "IS", "NULL", "AS", "DISTINCT", "CASE", "WHEN", "THEN", "ELSE", "END", "BETWEEN",
+	"LIKE", "ILIKE", "EXISTS", "ASC", "DESC", "CREATE", "TABLE", "ALTER", "DROP", "TRUNCATE", "INDEX",
+	"VIEW", "PRIMARY", "KEY", "FOREIGN", "REFERENCES", "DEFAULT", "UNIQUE", "CHECK", "CONSTRAINT", "IF",
+	"TRUE", "FALSE", "OVER", "PARTITION", "WINDOW",
+)
+
+// formatClauses start a new line at the statement's indentation, and their body goes on the next lines.
+var formatClauses = toSet(
+	"SELECT", "FROM", "WHERE", "GROUP BY", "HAVING", "ORDER BY", "LIMIT", "OFFSET", "VALUES", "SET",
+	"UPDATE", "INSERT INTO", "DELETE FROM", "RETURNING", "WITH", "WITH RECURSIVE",
+)
+
+// formatSetOperators stand on their own line between two queries.
+var formatSetOperators = toSet("UNION", "UNION ALL", "INTERSECT", "EXCEPT")
+
+// formatJoins start a new line in the body of FROM.
+var formatJoins = toSet(
+	"JOIN", "INNER JOIN", "LEFT JOIN", "LEFT OUTER JOIN", "RIGHT JOIN", "RIGHT OUTER JOIN",
+	"FULL JOIN", "FULL OUTER JOIN", "CROSS JOIN", "NATURAL JOIN",
+)
+
+func toSet(words ...string) map[string]bool {
+	set := make(map[string]bool, len(words))
+	for _, word := range words {
+		set[word] = true
+	}
+	return set
+}
+
+// formatter writes the formatted query line by line. base is the indentation of the clauses
+// of the current query; their bodies are indented one level deeper.
+type formatter struct {
+	lines  []string
+	line   strings.Builder
+	indent int
+	base   int
+	// parens holds, for each open parenthesis, the base to restore or -1 for an inline one
+	parens []int
+	// inline counts the open inline parentheses, inside which no line is broken
+	inline  int
+	between bool
+	// prev and before are the last two tokens written
+	prev, before token
+}
+
+// FormatQuery pretty-prints a query: clauses start new lines, their bodies are indented, list items,
+// joins and AND/OR conditions go on lines of their own, subqueries are nested, and keywords are upper-cased.
+// It works on tokens rather than a parse tree, so it accepts any input, valid or not, and only changes whitespace
+// and the case of keywords. Lists inside parentheses, such as function arguments and column definitions, stay on one line.
+// Strings and comments are found with the lexical rules of the database type, e.g. # comments on MySQL.
+func FormatQuery(dbType, sql string) string {
+	var (
+		f      formatter
+		tokens = tokenize(dbType, sql)
+	)
+
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if t.kind == tokenWord && formatKeywords[strings.ToUpper(t.text)] {
+			phrase, n := keywordPhrase(tokens, i)
+			if f.phrase(phrase) {
+				i += n - 1
+				continue
+			}
+			t.text = strings.ToUpper(t.text)
+		}
+		f.token(t, tokens, i)
+	}
+	f.flush()
+	return strings.TrimSpace(strings.Join(f.lines, "\n"))
+}
+
+// keywordPhrase returns the longest clause, join or set operator starting at tokens[i],
+// along with its number of tokens, or the keyword alone.
+func keywordPhrase(tokens []token, i int) (string, int) {
+	for n := 3; n > 1; n-- {
+		if i+n > len(tokens) {
+			continue
+		}
+		words := make([]string, 0, n)
+		for _, t := range tokens[i : i+n] {
+			if t.kind != tokenWord {
+				break
+			}
+			words = append(words, strings.ToUpper(t.text))
+		}
+		phrase := strings.Join(words, " ")
+		if len(words) == n && (formatClauses[phrase] || formatJoins[phrase] || formatSetOperators[phrase]) {
+			return phrase, n
+		}
+	}
+	return strings.ToUpper(tokens[i].text), 1
+}
+
+// phrase writes a clause, join or set operator, and reports false for any other keyword.
+func (f *formatter) phrase(phrase string) bool {
+	switch {
+	case f.inline > 0 && (formatClauses[phrase] || formatJoins[phrase] || formatSetOperators[phrase]):
+		f.word(phrase)
+	case formatClauses[phrase]:
+		f.newline(f.base)
+		f.word(phrase)
+		f.newline(f.base + 1)
+	case formatSetOperators[phrase]:
+		f.newline(f.base)
+		f.word(phrase)
+		f.newline(f.base)
+	case formatJoins[phrase]:
+		f.newline(f.base + 1)
+		f.word(phrase)
+	default:
+		return false
+	}
+	f.before, f.prev = f.prev, token{kind: tokenWord, text: phrase}
+	return true
+}
+
+func (f *formatter) token(t token, tokens []token, i int) {
+	upper := strings.ToUpper(t.text)
+	switch {
+	case t.kind == tokenWord && upper == "BETWEEN":
+		f.between = true
+		f.word(t.text)
+	case t.kind == tokenWord && (upper == "AND" || upper == "OR"):
+		if f.between && upper == "AND" {
+			f.between = false
+			f.word(t.text)
+			break
+		}
+		if f.inline == 0 {
+			f.newline(f.base + 1)
+		}
+		f.word(t.text)
+	case t.kind == tokenPunct && t.text == "(":
+		f.word(t.text)
+		if i+1 < len(tokens) && tokens[i+1].kind == tokenWord &&
+			(strings.EqualFold(tokens[i+1].text, "SELECT") || strings.EqualFold(tokens[i+1].text, "WITH")) && f.inline == 0 {
+			f.parens = append(f.parens, f.base)
+			f.base += 2
+		} else {
+			f.parens = append(f.parens, -1)
+			f.inline++
+		}
+	case t.kind == tokenPunct && t.text == ")":
+		if n := len(f.parens); n > 0 {
+			saved := f.parens[n-1]
+			f.parens = f.parens[:n-1]
+			if saved == -1 {
+				f.inline--
+			} else {
+				f.base = saved
+				f.newline(f.base + 1)
+			}
+		}
+		f.word(t.text)
+	case t.kind == tokenPunct && t.text == ",":
+		f.word(t.text)
+		if f.inline == 0 {
+			f.newline(f.base + 1)
+		}
+	case t.kind == tokenPunct && t.text == ";":
+		f.word(t.text)
+		f.base, f.parens, f.inline, f.between = 0, nil, 0, false
+		f.flush()
+		f.lines = append(f.lines, "")
+		f.indent = 0
+	case t.kind == tokenLineComment:
+		f.word(t.text)
+		f.newline(f.base + 1)
+	default:
+		f.word(t.text)
+	}
+	f.before, f.prev = f.prev, t
+}
+
+// word writes text, preceded by a space unless it starts the line or sticks to the previous token.
+func (f *formatter) word(text string) {
+	if f.line.Len() > 0 && f.spaced(text) {
+		f.line.WriteByte(' ')
+	}
+	f.line.WriteString(text)
+}
+
+// spaced reports whether a space separates the previous token from text.
+func (f *formatter) spaced(text string) bool {
+	prev := f.prev
+	switch {
+	case text == "," || text == ";" || text == ")" || text == "." || text == "::":
+		return false
+	case prev.text == "." || prev.text == "::" || prev.text == "(":
+		return false
+	case text == "(":
+		// function calls stick to their name, keywords such as IN and VALUES and the column list
+		// of INSERT INTO t (...) do not
+		return !(prev.kind == tokenWord || prev.kind == tokenQuoted) || formatKeywords[strings.ToUpper(prev.text)] ||
+			f.before.text == "INSERT INTO" || strings.EqualFold(f.before.text, "TABLE")
+	case prev.kind == tokenOperator && (prev.text == "-" || prev.text == "+") && f.unary():
+		return false
+	}
+	return true
+}
+
+// unary reports whether the sign just written is unary, e.g. in "= -1" or "(-1".
+func (f *formatter) unary() bool {
+	before := f.before
+	switch before.kind {
+	case tokenOperator:
+		return true
+	case tokenPunct:
+		return before.text == "(" || before.text == ","
+	case tokenWord:
+		return formatKeywords[strings.ToUpper(before.text)]
+	}
+	return before.text == ""
+}
+
+// newline ends the current line, unless it is empty, and indents the next one.
+func (f *formatter) newline(level int) {
+	f.flush()
+	f.indent = level
+}
+
+// flush moves the current line, if any, to the output.
+func (f *formatter) flush() {
+	if f.line.Len() == 0 {
+		return
+	}
+	f.lines = append(f.lines, strings.Repeat(formatIndent, f.indent)+f.line.String())
+	f.line.Reset()
+}
@@ -0,0 +1,224 @@
+package query
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	_sql "github.com/yazeed1s/sqlweb/db/sql"
+	_client "github.com/yazeed1s/sqlweb/pkg/client"
+	"github.com/yazeed1s/sqlweb/pkg/util"
+)
+
+// primaryKeyColumns lists the primary key columns of the table in key order. SQLite reports the
+// position of each column in the key, the other databases list them in table order.
+func primaryKeyColumns(dbType string, columns []_client.Column) []_client.Column {
+	keys := make([]_client.Column, 0)
+	for _, col := range columns {
+		if isPrimaryKey(dbType, col) {
+			keys = append(keys, col)
+		}
+	}
+	if strings.EqualFold(dbType, _sql.SQLite.String()) {
+		sort.SliceStable(keys, func(i, j int) bool {
+			a, _ := strconv.Atoi(keys[i].Key)
+			b, _ := strconv.Atoi(keys[j].Key)
+			return a < b
+		})
+	}
+	return keys
+}
+
+// buildInsert builds the parameterized INSERT of a single row, binding each value to the type of its
+// column. Unknown and generated columns are refused. The returning columns are added as a RETURNING clause.
+func buildInsert(
+	dbType, schema, table string,
+	columns []_client.Column,
+	values map[string]interface{},
+	returning []_client.Column,
+) (string, []interface{}, error) {
+	var (
+		names        []string
+		quoted       []string
+		placeholders []string
+		args         []interface{}
+		types        map[string]_client.Column
+		query        string
+	)
+
+	types = make(map[string]_client.Column, len(columns))
+	for _, col := range columns {
+		types[columnKey(dbType, col.Field)] = col
+	}
+
+	names = sortedNames(values)
+
+	for i, name := range names {
+		col, ok := types[columnKey(dbType, name)]
+		if !ok {
+			return "", nil, fmt.Errorf("column '%s' not found in table '%s'", name, table)
+		}
+		if col.IsGenerated {
+			return "", nil, fmt.Errorf("%s.%s: %w", table, name, util.ErrColumnNotWritable)
+		}
+		value, err := bindValue(col.Type, values[name])
+		if err != nil {
+			return "", nil, fmt.Errorf("column '%s': %w", name, err)
+		}
+		quoted = append(quoted, _client.QuoteIdentifier(dbType, col.Field))
+		placeholders = append(placeholders, _client.Placeholder(dbType, i+1))
+		args = append(args, value)
+	}
+
+	switch {
+	case len(names) > 0:
+		query = fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", _client.QualifiedTable(dbType, schema, table),
+			strings.Join(quoted, ", "), strings.Join(placeholders, ", "))
+	case strings.EqualFold(dbType, _sql.MySQL.String()):
+		// MySQL has no DEFAULT VALUES
+		query = fmt.Sprintf("INSERT INTO %s () VALUES ()", _client.QualifiedTable(dbType, schema, table))
+	default:
+		query = fmt.Sprintf("INSERT INTO %s DEFAULT VALUES", _client.QualifiedTable(dbType, schema, table))
+	}
+
+	if len(returning) > 0 {
+		quoted = make([]string, len(returning))
+		for i, col := range returning {
+			quoted[i] = _client.QuoteIdentifier(dbType, col.Field)
+		}
+		query += " RETURNING " + strings.Join(quoted, ", ")
+	}
+	return query, args, nil
+}
+
+// insertedKey works out the primary key of the row inserted on MySQL and SQLite: the values given for the
+// key columns, and the id the database generated for the one left out. MySQL generates it for an
+// AUTO_INCREMENT column, SQLite for an INTEGER PRIMARY KEY, the alias of the rowid. The key is nil
+// when a key column is neither given nor generated, e.g. when the table has no primary key.
+func insertedKey(dbType string, keys []_client.Column, values map[string]interface{}, lastID *int64) map[string]interface{} {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	given := make(map[string]interface{}, len(values))
+	for name, v := range values {
+		given[columnKey(dbType, name)] = v
+	}
+
+	key := make(map[string]interface{}, len(keys))
+	for _, col := range keys {
+		if v, ok := given[columnKey(dbType, col.Field)]; ok {
+			value, err := bindValue(col.Type, v)
+			if err != nil {
+				return nil
+			}
+			key[col.Field] = value
+			continue
+		}
+		generated := lastID != nil && len(keys) == 1
+		if strings.EqualFold(dbType, _sql.SQLite.String()) {
+			generated = generated && strings.EqualFold(col.Type, "INTEGER")
+		}
+		if !generated {
+			return nil
+		}
+		key[col.Field] = *lastID
+	}
+	return key
+}
+
+// InsertRow inserts a single row with the given column values, the others taking their default.
+// The result holds the primary key of the new row, so it can be selected, when it is known:
+// PostgreSQL returns it with RETURNING, and MySQL and SQLite report the id they generated.
+func InsertRow(table string, values map[string]interface{}, client *_client.Client) (*Result, error) {
+	if err := checkDatabaseConnection(client.Database); err != nil {
+		return nil, err
+	}
+
+	var (
+		err         error
+		dbType      string
+		query       string
+		args        []interface{}
+		columns     []_client.Column
+		keys        []_client.Column
+		returning   []_client.Column
+		res         sql.Result
+		result      *Result
+		startTime   time.Time
+		elapsedTime time.Duration
+		rows        int64
+		id          int64
+	)
+
+	dbType = client.Type.String()
+	columns, err = client.GetCachedColumnsWith(client.Schema.Name, table, sortedNames(values)...)
+	if err != nil {
+		return nil, err
+	}
+
+	keys = primaryKeyColumns(dbType, columns)
+	if strings.EqualFold(dbType, _sql.PostgreSQL.String()) {
+		returning = keys
+	}
+	query, args, err = buildInsert(dbType, client.Schema.Name, table, columns, values, returning)
+	if err != nil {
+		return nil, err
+	}
+
+	result = &Result{}
+	startTime = time.Now()
+	if len(returning) > 0 {
+		result.InsertedKey, err = insertReturning(client.Database, query, args, returning)
+		if err != nil {
+			return nil, err
+		}
+		rows = 1
+	} else {
+		res, err = client.Database.Exec(query, args...)
+		if err != nil {
+			return nil, err
+		}
+		rows, err = res.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		// lib/pq does not support LastInsertId, and MySQL reports 0 without an AUTO_INCREMENT column
+		if id, err = res.LastInsertId(); err == nil && id > 0 {
+			result.LastInsertID = &id
+		}
+		result.InsertedKey = insertedKey(dbType, keys, values, result.LastInsertID)
+	}
+	elapsedTime = time.Since(startTime)
+
+	result.AffectedRows = rows
+	result.Time = fmt.Sprintf("%.3f", elapsedTime.Seconds())
+	result.TimeMS = elapsedTime.Milliseconds()
+	result.Msg = fmt.Sprintf("Row inserted successfully (%d rows affected, time taken %.3f)", rows, elapsedTime.Seconds())
+	return result, nil
+}
+
+// insertReturning runs an INSERT ... RETURNING of the key columns and returns the key of the row inserted.
+func insertReturning(db *sql.DB, query string, args []interface{}, keys []_client.Column) (map[string]interface{}, error) {
+	values := make([]interface{}, len(keys))
+	pointers := make([]interface{}, len(keys))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	if err := db.QueryRow(query, args...).Scan(pointers...); err != nil {
+		return nil, err
+	}
+
+	key := make(map[string]interface{}, len(keys))
+	for i, col := range keys {
+		if b, ok := values[i].([]byte); ok {
+			key[col.Field] = string(b)
+			continue
+		}
+		key[col.Field] = values[i]
+	}
+	return key, nil
+}
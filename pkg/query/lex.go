@@ -0,0 +1,327 @@
+package query
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	_sql "github.com/yazeed1s/sqlweb/db/sql"
+)
+
+// tokenKind classifies the tokens of a query.
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenString
+	tokenQuoted
+	tokenNumber
+	tokenOperator
+	tokenPunct
+	tokenLineComment
+	tokenBlockComment
+)
+
+// token is a token of a query, at byte offset pos.
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// dialect holds the lexical rules that differ between databases, and decide where strings and comments end.
+type dialect struct {
+	// backslashEscapes makes a backslash escape the next character of a string (MySQL)
+	backslashEscapes bool
+	// doubleQuotedStrings makes "..." a string rather than an identifier (MySQL)
+	doubleQuotedStrings bool
+	// hashComments makes # start a line comment, and -- only when a space follows it (MySQL)
+	hashComments bool
+	// dollarQuotes enables $tag$...$tag$ strings, E'...' strings with backslash escapes and nested
+	// block comments (PostgreSQL)
+	dollarQuotes bool
+	// brackets makes [...] a quoted identifier (SQLite)
+	brackets bool
+	// versionComments makes the content of /*!...*/ comments run as code (MySQL)
+	versionComments bool
+	// userOperators lets an operator end in + or - when it holds one of ~!@#%^&|`?, as the operators
+	// users define may (PostgreSQL); otherwise a trailing sign is an operator of its own
+	userOperators bool
+}
+
+// dialectOf returns the lexical rules of the database type. An unknown type, e.g. when no database
+// is connected, follows standard SQL: no backslash escapes, and dollar-quoted strings, which never
+// appear outside of PostgreSQL.
+func dialectOf(dbType string) dialect {
+	switch strings.ToLower(dbType) {
+	case strings.ToLower(_sql.MySQL.String()):
+		return dialect{backslashEscapes: true, doubleQuotedStrings: true, hashComments: true, versionComments: true}
+	case strings.ToLower(_sql.SQLite.String()):
+		return dialect{brackets: true}
+	}
+	return dialect{dollarQuotes: true, userOperators: true}
+}
+
+// tokenize splits a query into tokens following the lexical rules of the database type, dropping whitespace.
+// Strings, quoted identifiers and comments are kept verbatim; an unterminated one runs to the end of the query.
+func tokenize(dbType, sql string) []token {
+	return dialectOf(dbType).tokenize(sql, 0)
+}
+
+// tokenize splits the query into tokens from the offset from, which must be where a token starts.
+func (d dialect) tokenize(sql string, from int) []token {
+	var tokens []token
+
+	for i := from; i < len(sql); {
+		r, size := utf8.DecodeRuneInString(sql[i:])
+		start := i
+		if unicode.IsSpace(r) {
+			i += size
+			continue
+		}
+		if end, kind, ok := d.literal(sql, i); ok {
+			text := sql[start:end]
+			if kind == tokenLineComment {
+				text = strings.TrimRight(text, " \t\r")
+			}
+			tokens = append(tokens, token{kind: kind, text: text, pos: start})
+			i = end
+			continue
+		}
+		switch {
+		case unicode.IsDigit(r) || r == '.' && i+1 < len(sql) && isDigit(sql[i+1]):
+			for i < len(sql) && (isDigit(sql[i]) || sql[i] == '.' || sql[i] == 'e' || sql[i] == 'E' ||
+				(sql[i] == '-' || sql[i] == '+') && (sql[i-1] == 'e' || sql[i-1] == 'E')) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: sql[start:i], pos: start})
+			continue
+		case isWordRune(r):
+			for i < len(sql) {
+				r, size = utf8.DecodeRuneInString(sql[i:])
+				if !isWordRune(r) {
+					break
+				}
+				i += size
+			}
+			tokens = append(tokens, token{kind: tokenWord, text: sql[start:i], pos: start})
+			continue
+		case strings.ContainsRune("(),;.?", r):
+			tokens = append(tokens, token{kind: tokenPunct, text: string(r), pos: start})
+			i++
+			continue
+		}
+		for i < len(sql) && strings.IndexByte("<>=!+-*/%|&^~:@#", sql[i]) >= 0 {
+			i++
+			// keep comments out of operator runs, e.g. "=--"
+			if i < len(sql) {
+				if _, _, ok := d.literal(sql, i); ok {
+					break
+				}
+			}
+		}
+		// the sign of "a=-1" is an operator of its own
+		for i-start > 1 && (sql[i-1] == '-' || sql[i-1] == '+') && !(d.userOperators && strings.ContainsAny(sql[start:i], "~!@#%^&|`?")) {
+			i--
+		}
+		if i == start {
+			i += size
+		}
+		tokens = append(tokens, token{kind: tokenOperator, text: sql[start:i], pos: start})
+	}
+	return tokens
+}
+
+// literal reports whether a string, quoted identifier or comment starts at i, and returns where it ends and its kind.
+func (d dialect) literal(sql string, i int) (int, tokenKind, bool) {
+	c := sql[i]
+	next := byte(0)
+	if i+1 < len(sql) {
+		next = sql[i+1]
+	}
+	switch {
+	case c == '-' && next == '-' && (!d.hashComments || i+2 == len(sql) || sql[i+2] <= ' '):
+		return lineEnd(sql, i), tokenLineComment, true
+	case c == '#' && d.hashComments:
+		return lineEnd(sql, i), tokenLineComment, true
+	case c == '/' && next == '*':
+		return d.blockCommentEnd(sql, i), tokenBlockComment, true
+	case c == '\'':
+		return quotedEnd(sql, i, d.backslashEscapes), tokenString, true
+	case c == '"' && d.doubleQuotedStrings:
+		return quotedEnd(sql, i, true), tokenString, true
+	case c == '"' || c == '`':
+		return quotedEnd(sql, i, false), tokenQuoted, true
+	case c == '[' && d.brackets:
+		end := strings.IndexByte(sql[i+1:], ']')
+		if end == -1 {
+			return len(sql), tokenQuoted, true
+		}
+		return i + end + 2, tokenQuoted, true
+	case d.dollarQuotes && (c == 'E' || c == 'e') && next == '\'' && !precededByWord(sql, i):
+		return quotedEnd(sql, i+1, true), tokenString, true
+	case d.dollarQuotes && c == '$' && !precededByWord(sql, i):
+		if tag := dollarTag(sql[i:]); tag != "" {
+			end := strings.Index(sql[i+len(tag):], tag)
+			if end == -1 {
+				return len(sql), tokenString, true
+			}
+			return i + len(tag) + end + len(tag), tokenString, true
+		}
+	}
+	return 0, 0, false
+}
+
+// blockCommentEnd returns the index after the block comment starting at i. PostgreSQL nests them.
+func (d dialect) blockCommentEnd(sql string, i int) int {
+	depth := 0
+	for j := i; j+1 < len(sql); j++ {
+		switch {
+		case sql[j] == '/' && sql[j+1] == '*' && (depth == 0 || d.dollarQuotes):
+			depth++
+			j++
+		case sql[j] == '*' && sql[j+1] == '/':
+			depth--
+			j++
+			if depth == 0 {
+				return j + 1
+			}
+		}
+	}
+	return len(sql)
+}
+
+// lineEnd returns the index of the end of the line holding i.
+func lineEnd(sql string, i int) int {
+	end := strings.IndexByte(sql[i:], '\n')
+	if end == -1 {
+		return len(sql)
+	}
+	return i + end
+}
+
+// quotedEnd returns the index after the quoted token starting at i. A doubled quote is an escaped quote,
+// and so is a backslash-escaped one when backslashes escape.
+func quotedEnd(sql string, i int, backslashEscapes bool) int {
+	quote := sql[i]
+	for i++; i < len(sql); i++ {
+		switch {
+		case sql[i] == '\\' && backslashEscapes:
+			i++
+		case sql[i] == quote && i+1 < len(sql) && sql[i+1] == quote:
+			i++
+		case sql[i] == quote:
+			return i + 1
+		}
+	}
+	return len(sql)
+}
+
+// dollarTag returns the $tag$ opening a dollar-quoted string at the start of s, or "" when there is none,
+// e.g. for the parameter $1.
+func dollarTag(s string) string {
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '$':
+			return s[:i+1]
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80 || i > 1 && isDigit(c):
+		default:
+			return ""
+		}
+	}
+	return ""
+}
+
+// precededByWord reports whether the byte before i belongs to a word, e.g. the $ of a$b.
+func precededByWord(sql string, i int) bool {
+	if i == 0 {
+		return false
+	}
+	r, _ := utf8.DecodeLastRuneInString(sql[:i])
+	return isWordRune(r)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '$'
+}
+
+// splitStatements returns the statements of a query as their tokens, without comments or the semicolons
+// between them. The content of MySQL's /*!...*/ comments is kept, since MySQL runs it.
+func splitStatements(dbType, query string) [][]token {
+	var (
+		statements [][]token
+		current    []token
+		d          = dialectOf(dbType)
+	)
+
+	var add func(tokens []token)
+	add = func(tokens []token) {
+		for _, t := range tokens {
+			switch {
+			case t.kind == tokenBlockComment && d.versionComments && strings.HasPrefix(t.text, "/*!"):
+				inner := strings.TrimSuffix(strings.TrimLeft(t.text[3:], "0123456789"), "*/")
+				add(tokenize(dbType, inner))
+			case t.kind == tokenLineComment || t.kind == tokenBlockComment:
+			case t.kind == tokenPunct && t.text == ";":
+				if len(current) > 0 {
+					statements = append(statements, current)
+				}
+				current = nil
+			default:
+				current = append(current, t)
+			}
+		}
+	}
+	add(tokenize(dbType, query))
+	if len(current) > 0 {
+		statements = append(statements, current)
+	}
+	return statements
+}
+
+// firstKeyword returns the first word of a statement, upper-cased, skipping opening parentheses.
+func firstKeyword(tokens []token) string {
+	for _, t := range tokens {
+		switch {
+		case t.kind == tokenPunct && t.text == "(":
+			continue
+		case t.kind == tokenWord:
+			return strings.ToUpper(t.text)
+		}
+		return ""
+	}
+	return ""
+}
+
+// hasWord reports whether one of the words is a keyword of the statement, outside of its strings and identifiers.
+func hasWord(tokens []token, words map[string]bool) bool {
+	for _, t := range tokens {
+		if t.kind == tokenWord && words[strings.ToUpper(t.text)] {
+			return true
+		}
+	}
+	return false
+}
+
+// topLevelWords returns the words of the tokens outside of parentheses, upper-cased.
+func topLevelWords(tokens []token) []string {
+	var (
+		words []string
+		depth int
+	)
+	for _, t := range tokens {
+		switch {
+		case t.kind == tokenPunct && t.text == "(":
+			depth++
+		case t.kind == tokenPunct && t.text == ")" && depth > 0:
+			depth--
+		case t.kind == tokenWord && depth == 0:
+			words = append(words, strings.ToUpper(t.text))
+		}
+	}
+	return words
+}
@@ -0,0 +1,53 @@
+package query
+
+import (
+	"strconv"
+	"strings"
+)
+
+// rowClauses are the keywords that, at the top level of a SELECT, bound its rows or make a LIMIT
+// appended after them invalid: LIMIT and OFFSET, FETCH FIRST, locking clauses (FOR UPDATE, MySQL's
+// LOCK IN SHARE MODE) and SELECT INTO.
+var rowClauses = map[string]bool{
+	"LIMIT":  true,
+	"OFFSET": true,
+	"FETCH":  true,
+	"FOR":    true,
+	"LOCK":   true,
+	"INTO":   true,
+}
+
+// WithDefaultLimit appends LIMIT limit to a query that is a single SELECT without a LIMIT of its own,
+// and reports whether it did. The query is read with the lexical rules of the database type, so a
+// LIMIT or semicolon in a string or comment does not count, nor does a LIMIT in a subquery, as it does
+// not bound the rows returned. Any other query, or a limit of 0, is returned unchanged.
+func WithDefaultLimit(dbType, query string, limit int) (string, bool) {
+	if limit <= 0 {
+		return query, false
+	}
+	statements := splitStatements(dbType, query)
+	if len(statements) != 1 || firstKeyword(statements[0]) != "SELECT" {
+		return query, false
+	}
+	for _, word := range topLevelWords(statements[0]) {
+		if rowClauses[word] {
+			return query, false
+		}
+	}
+
+	// the statement ends at its semicolon, which drops the comments that follow it
+	end := len(query)
+	for _, t := range tokenize(dbType, query) {
+		if t.kind == tokenPunct && t.text == ";" {
+			end = t.pos
+			break
+		}
+	}
+	// on a line of its own, so a trailing line comment does not swallow it
+	limited := strings.TrimRight(query[:end], " \t\r\n") + "\nLIMIT " + strconv.Itoa(limit)
+	// an unterminated string or comment swallows the LIMIT, which would then not bound anything
+	if tokens := tokenize(dbType, limited); len(tokens) < 2 || !strings.EqualFold(tokens[len(tokens)-2].text, "LIMIT") {
+		return query, false
+	}
+	return limited, true
+}
@@ -0,0 +1,125 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	_client "github.com/yazeed1s/sqlweb/pkg/client"
+	"github.com/yazeed1s/sqlweb/pkg/util"
+)
+
+// MissingParamsError is returned when placeholders of a query have no value. It lists them in order.
+type MissingParamsError struct {
+	Names []string
+}
+
+func (e *MissingParamsError) Error() string {
+	return fmt.Sprintf("%s: %s", util.ErrMissingParams, strings.Join(e.Names, ", "))
+}
+
+func (e *MissingParamsError) Unwrap() error {
+	return util.ErrMissingParams
+}
+
+// scanParams calls found with the position and name of every :name placeholder of a query, skipping
+// its string literals, quoted identifiers and comments as the database type reads them, e.g. backslash
+// escapes on MySQL and dollar-quoted bodies on PostgreSQL. A name starts with a letter or an underscore,
+// so PostgreSQL casts (::int), MySQL assignments (:=) and array slices ([1:2]) are not placeholders.
+func scanParams(dbType, query string, found func(start, end int, name string)) {
+	isStart := func(c byte) bool { return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' }
+	isPart := func(c byte) bool { return isStart(c) || c >= '0' && c <= '9' }
+	d := dialectOf(dbType)
+
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		if end, _, ok := d.literal(query, i); ok {
+			i = end - 1
+			continue
+		}
+		switch {
+		case c == ':' && strings.HasPrefix(query[i:], "::"):
+			i++
+		case c == ':' && i+1 < len(query) && isStart(query[i+1]) && (i == 0 || !isPart(query[i-1])):
+			end := i + 2
+			for end < len(query) && isPart(query[end]) {
+				end++
+			}
+			found(i, end, query[i+1:end])
+			i = end - 1
+		}
+	}
+}
+
+// QueryParams lists the names of the :name placeholders of a query, in the order they first appear.
+func QueryParams(dbType, query string) []string {
+	names := make([]string, 0)
+	seen := make(map[string]bool)
+	scanParams(dbType, query, func(_, _ int, name string) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	})
+	return names
+}
+
+// BindParams replaces the :name placeholders of a query with the bind parameters of the database type
+// and returns the values to bind, in order. Every placeholder needs a value, else a MissingParamsError lists
+// those without one, and every value a placeholder.
+// A name used twice is bound once on PostgreSQL ($1 twice), and once per use with ? placeholders.
+func BindParams(dbType, query string, values map[string]interface{}) (string, []interface{}, error) {
+	var (
+		bound    strings.Builder
+		args     []interface{}
+		numbers  = make(map[string]int)
+		last     int
+		missing  []string
+		numbered = _client.Placeholder(dbType, 1) != "?"
+	)
+
+	scanParams(dbType, query, func(start, end int, name string) {
+		value, ok := values[name]
+		if !ok {
+			if numbers[name] == 0 {
+				missing = append(missing, name)
+			}
+			numbers[name] = -1
+			return
+		}
+		bound.WriteString(query[last:start])
+		last = end
+		n := numbers[name]
+		if n == 0 || !numbered {
+			args = append(args, paramValue(value))
+			n = len(args)
+			numbers[name] = n
+		}
+		bound.WriteString(_client.Placeholder(dbType, n))
+	})
+	if len(missing) > 0 {
+		return "", nil, &MissingParamsError{Names: missing}
+	}
+	for name := range values {
+		if numbers[name] == 0 {
+			return "", nil, fmt.Errorf("unknown parameter %s", name)
+		}
+	}
+	bound.WriteString(query[last:])
+	return bound.String(), args, nil
+}
+
+// paramValue converts a number decoded as json.Number to an int64 when it is whole, a float64 otherwise.
+func paramValue(value interface{}) interface{} {
+	number, ok := value.(json.Number)
+	if !ok {
+		return value
+	}
+	if n, err := number.Int64(); err == nil {
+		return n
+	}
+	if f, err := number.Float64(); err == nil {
+		return f
+	}
+	return number.String()
+}
@@ -10,28 +10,132 @@
 package query
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"fmt"
 	"log"
 	"strings"
 	"time"
 
+	"github.com/lib/pq"
 	_sql "github.com/yazeed1s/sqlweb/db/sql"
 	_client "github.com/yazeed1s/sqlweb/pkg/client"
+	"github.com/yazeed1s/sqlweb/pkg/tracing"
+	"github.com/yazeed1s/sqlweb/pkg/util"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Query represents a SQL query
 type Query struct {
 	SQLQuery string `json:"query"`
+	// TimeoutMs cancels the query after this many milliseconds, overriding the connection's statementTimeoutMs
+	TimeoutMs int `json:"timeoutMs,omitempty"`
+	// Args are bound to the placeholders of the query, see BindParams
+	Args []interface{} `json:"-"`
+	// Columnar leaves Result.Data and the rows of its ResultSets nil and keeps the rows column by column,
+	// encoded to JSON as Data would be. It spares a map per row to results that are only encoded.
+	Columnar bool `json:"-"`
 }
 
 // Result represents the result of a database operation.
 type Result struct {
 	AffectedRows int64                    `json:"affected_rows"`
 	Time         string                   `json:"time_taken"`
+	TimeMS       int64                    `json:"time_ms"`
 	Data         []map[string]interface{} `json:"data"`
 	Msg          string                   `json:"message"`
+	SearchPath   string                   `json:"search_path,omitempty"`
+	// ReferencedColumns holds the columns of schema-qualified tables used by the query, keyed by "schema.table"
+	ReferencedColumns map[string][]_client.Column `json:"referenced_columns,omitempty"`
+	// ResultSets holds every result set when the query returned several, e.g. a MySQL procedure
+	// running more than one SELECT; Data then holds the first of them
+	ResultSets []ResultSet `json:"result_sets,omitempty"`
+	// Warnings lists the values of Data truncated by the cell limit, see _client.CellLimit
+	Warnings []_client.CellWarning `json:"warnings,omitempty"`
+	// Renamed lists the columns of Data renamed because an earlier column has the same name, see _client.DistinctColumns
+	Renamed []_client.ColumnRename `json:"renamed_columns,omitempty"`
+	// LastInsertID is the id MySQL or SQLite generated for the row inserted, see InsertRow
+	LastInsertID *int64 `json:"last_insert_id,omitempty"`
+	// InsertedKey holds the primary key of the row inserted, by column, when it is known
+	InsertedKey map[string]interface{} `json:"inserted_key,omitempty"`
+	// Limited is set when the query was a SELECT without a LIMIT and Limit was appended to it,
+	// see _client.Client.DefaultLimit; more rows may match
+	Limited bool `json:"limited,omitempty"`
+	Limit   int  `json:"limit,omitempty"`
+
+	// rows holds the rows of Data when the query was run with Query.Columnar
+	rows *_client.Rows
+}
+
+// ResultSet is one of the result sets returned by a query, with its columns in order.
+type ResultSet struct {
+	Columns  []string                 `json:"columns"`
+	Rows     []map[string]interface{} `json:"rows"`
+	Warnings []_client.CellWarning    `json:"warnings,omitempty"`
+	Renamed  []_client.ColumnRename   `json:"renamed_columns,omitempty"`
+
+	// rows holds the rows instead of Rows until they are turned into maps, see Result.fillMaps
+	rows *_client.Rows
+}
+
+// MarshalJSON encodes the result, its data straight from the columns of its rows when the query was run
+// with Query.Columnar. The JSON is the same either way.
+func (r Result) MarshalJSON() ([]byte, error) {
+	type result Result
+	if r.Data != nil {
+		r.rows = nil
+	}
+	return _client.MarshalWithRows(result(r), "data", r.rows)
+}
+
+// MarshalJSON encodes the result set like Result.MarshalJSON.
+func (s ResultSet) MarshalJSON() ([]byte, error) {
+	type resultSet ResultSet
+	if s.Rows != nil {
+		s.rows = nil
+	}
+	return _client.MarshalWithRows(resultSet(s), "rows", s.rows)
+}
+
+// fillMaps turns the rows read column by column into the maps of Data and of the rows of the result sets.
+func (r *Result) fillMaps() {
+	for i := range r.ResultSets {
+		r.ResultSets[i].Rows, r.ResultSets[i].rows = rowMaps(r.ResultSets[i].rows), nil
+	}
+	if r.rows == nil {
+		return
+	}
+	if len(r.ResultSets) > 0 {
+		r.Data = r.ResultSets[0].Rows
+	} else {
+		r.Data = rowMaps(r.rows)
+	}
+	r.rows = nil
+}
+
+// rowMaps returns the rows as maps, an empty slice when there are none.
+func rowMaps(rows *_client.Rows) []map[string]interface{} {
+	maps := make([]map[string]interface{}, rows.Len())
+	for i := range maps {
+		maps[i] = rows.Row(i)
+	}
+	return maps
+}
+
+// queryer is satisfied by *sql.DB, *sql.Conn and *sql.Tx, so helpers can run
+// either on the pool, on a single session that carries its own settings, or inside a transaction.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// executor is satisfied by both *sql.DB and *sql.Tx, so a write and the lookups it depends on
+// can run either directly on the pool or inside a caller's transaction.
+type executor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
 }
 
 // stringDataTypes contains substrings of data types
@@ -46,11 +150,7 @@ func checkDatabaseConnection(db *sql.DB) error {
 }
 
 // getColumnDataType returns the data type of a given column
-func getColumnDataType(table, schema, column, dbType string, db *sql.DB) (string, error) {
-	if db == nil {
-		return "", errors.New("database connection is nil")
-	}
-
+func getColumnDataType(table, schema, column, dbType string, db executor) (string, error) {
 	var (
 		query    string
 		err      error
@@ -62,6 +162,8 @@ func getColumnDataType(table, schema, column, dbType string, db *sql.DB) (string
 		query = fmt.Sprintf(_sql.MySQLGetColumnDataType, schema, table, column)
 	case strings.ToLower(_sql.PostgreSQL.String()):
 		query = fmt.Sprintf(_sql.PostgreSQLGetColumnDataType, schema, table, column)
+	case strings.ToLower(_sql.SQLite.String()):
+		query = fmt.Sprintf(_sql.SQLiteGetColumnDataType, table, column)
 	}
 
 	err = db.QueryRow(query).Scan(&dataType)
@@ -72,77 +174,116 @@ func getColumnDataType(table, schema, column, dbType string, db *sql.DB) (string
 	return dataType, nil
 }
 
-// wrapValue: Wraps a value in single quotes if it requires quoting in SQL update statements.
-// This applies to data types containing any of the substrings "char", "text", "date", "time", and "year".
-// it returns the wrapped value if its column's data type matches any of the above substrings,
-// or return the original value otherwise.
-func wrapValue(dataType, value string) string {
-	lowerCase := strings.ToLower(dataType)
-	for _, substr := range stringDataTypes {
-		if strings.Contains(lowerCase, substr) {
-			return fmt.Sprintf("'%s'", value)
+// checkColumnWritable fails if the column does not exist or is generated,
+// so the user gets a clear error instead of the database's own rejection.
+func checkColumnWritable(table, column string, client *_client.Client) error {
+	cols, err := client.GetCachedColumnsWith(client.Schema.Name, table, column)
+	if err != nil {
+		return err
+	}
+	for _, col := range cols {
+		if !client.SameIdentifier(col.Field, column) {
+			continue
 		}
+		if col.IsGenerated {
+			return fmt.Errorf("%s.%s: %w", table, column, util.ErrColumnNotWritable)
+		}
+		return nil
 	}
-	return value
+	return fmt.Errorf("column '%s' not found in table '%s'", column, table)
 }
 
-// wrapPrimaryKey: Wraps the primary key in single quotes if it requires quoting in SQL update statements.
-// This applies to data types containing any of the substrings "char", "text", "date", "time", and "year".
-// it returns the wrapped primary key if its column's data type matches any of the above substrings,
-// or return the original primary key otherwise.
-func wrapPrimaryKey(dataType, priKey string) string {
-	lowerCase := strings.ToLower(dataType)
-	for _, substr := range stringDataTypes {
-		if strings.Contains(lowerCase, substr) {
-			return fmt.Sprintf("'%s'", priKey)
-		}
+// checkNotView refuses to edit the rows of a view, which most views do not allow and which would
+// otherwise change the tables it is defined on.
+func checkNotView(table string, client *_client.Client) error {
+	isView, err := client.IsView(table)
+	if err != nil {
+		return err
 	}
-	return priKey
+	if isView {
+		return fmt.Errorf("%s: %w", table, util.ErrView)
+	}
+	return nil
 }
 
 // UpdateRow constructs and executes an SQL UPDATE statement to modify a row in the specified table.
-// The function handles checking the column data type, and wraps its value in single quotes if necessary.
+// The value and the primary key are bound as parameters, never written into the statement.
+// Dates and timestamps are parsed and bound in a canonical format, see temporalValue.
+// A nil newVal sets the column to NULL, while a pointer to "" sets it to an empty string.
 // Returns the result of the update operation or any encountered errors.
-func UpdateRow(table, parentCol, newVal, priKeyVal, priKeyCol string, client *_client.Client) (*Result, error) {
+func UpdateRow(table, parentCol string, newVal *string, priKeyVal, priKeyCol string, client *_client.Client) (*Result, error) {
 	if err := checkDatabaseConnection(client.Database); err != nil {
 		return nil, err
 	}
+	return updateRow(client.Database, table, parentCol, newVal, priKeyVal, priKeyCol, client)
+}
+
+// UpdateRowTx is like UpdateRow but runs the column lookups and the update inside the given transaction,
+// so it can be combined with other changes that must be applied atomically. The caller commits or rolls back.
+func UpdateRowTx(tx *sql.Tx, table, parentCol string, newVal *string, priKeyVal, priKeyCol string, client *_client.Client) (*Result, error) {
+	if tx == nil {
+		return nil, errors.New("transaction is nil")
+	}
+	return updateRow(tx, table, parentCol, newVal, priKeyVal, priKeyCol, client)
+}
+
+func updateRow(db executor, table, parentCol string, newVal *string, priKeyVal, priKeyCol string, client *_client.Client) (*Result, error) {
 	var (
-		err               error
-		query             string
-		msg               string
-		sqlResult         sql.Result
-		result            *Result
-		startTime         time.Time
-		rows              int64
-		elapsedTime       time.Duration
-		wrappedValue      string
-		wrappedPrimaryKey string
-		columnDataType    string
+		err            error
+		query          string
+		msg            string
+		sqlResult      sql.Result
+		result         *Result
+		startTime      time.Time
+		rows           int64
+		elapsedTime    time.Duration
+		value          string
+		columnDataType string
+		qualifiedTable string
+		placeholder    = _client.Placeholder(client.Type.String(), 1)
+		args           []interface{}
 	)
 
-	columnDataType, err = getColumnDataType(
-		table, client.Schema.Name, parentCol,
-		client.Type.String(), client.Database,
-	)
-	if err != nil {
+	if err = checkNotView(table, client); err != nil {
+		return nil, err
+	}
+	if err = checkColumnWritable(table, parentCol, client); err != nil {
 		return nil, err
 	}
-	wrappedValue = wrapValue(columnDataType, newVal)
 
 	columnDataType, err = getColumnDataType(
-		table, client.Schema.Name, priKeyCol,
-		client.Type.String(), client.Database,
+		table, client.Schema.Name, parentCol,
+		client.Type.String(), db,
 	)
 	if err != nil {
 		return nil, err
 	}
-	wrappedPrimaryKey = wrapPrimaryKey(columnDataType, priKeyVal)
+	value = placeholder
+	switch kind := columnTemporalKind(client.Type.String(), columnDataType); {
+	case newVal == nil:
+		args = append(args, nil)
+	// an empty value is left to the database, as it was before dates were parsed
+	case kind != notTemporal && *newVal != "":
+		var arg string
+		value, arg, err = temporalValue(client.Type.String(), kind, *newVal, placeholder)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", table, parentCol, err)
+		}
+		args = append(args, arg)
+	default:
+		args = append(args, *newVal)
+	}
+	args = append(args, priKeyVal)
 
-	query = fmt.Sprintf(_sql.SQLUpdateRow, table, parentCol, wrappedValue, priKeyCol, wrappedPrimaryKey)
+	// the pooled connections of MySQL do not share a current database, so the table is qualified
+	qualifiedTable = table
+	if client.Type == _sql.MySQL {
+		qualifiedTable = _client.QualifiedTable(client.Type.String(), client.Schema.Name, table)
+	}
+	query = fmt.Sprintf(_sql.SQLUpdateRow, qualifiedTable, parentCol, value, priKeyCol, _client.Placeholder(client.Type.String(), 2))
 	log.Println("query is: ", query)
 	startTime = time.Now()
-	sqlResult, err = client.Database.Exec(query)
+	sqlResult, err = db.Exec(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -160,68 +301,263 @@ func UpdateRow(table, parentCol, newVal, priKeyVal, priKeyCol string, client *_c
 	result = &Result{
 		AffectedRows: rows,
 		Time:         fmt.Sprintf("%.3f", elapsedTime.Seconds()),
+		TimeMS:       elapsedTime.Milliseconds(),
 		Msg:          msg,
 	}
 	return result, nil
 }
 
+// RowUpdate is a single cell change, as sent by the table editor.
+type RowUpdate struct {
+	Table  string
+	Column string
+	// Value is the new value of the cell, nil for NULL
+	Value     *string
+	KeyValue  string
+	KeyColumn string
+}
+
+// UpdateRowBatch applies all the updates in one transaction: either every update is applied or,
+// if any of them fails, none is. It returns one result per update, in order.
+func UpdateRowBatch(updates []RowUpdate, client *_client.Client) ([]*Result, error) {
+	if err := checkDatabaseConnection(client.Database); err != nil {
+		return nil, err
+	}
+
+	var (
+		err     error
+		tx      *sql.Tx
+		result  *Result
+		results []*Result
+	)
+
+	tx, err = client.Database.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, u := range updates {
+		result, err = UpdateRowTx(tx, u.Table, u.Column, u.Value, u.KeyValue, u.KeyColumn, client)
+		if err != nil {
+			_ = tx.Rollback()
+			return nil, fmt.Errorf("%s.%s: %w", u.Table, u.Column, err)
+		}
+		results = append(results, result)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
 func ExecuteQuery(q *Query, client *_client.Client) (*Result, error) {
+	return ExecuteQueryContext(context.Background(), q, client)
+}
+
+// ExecuteQueryContext is like ExecuteQuery, traced as a child of the span of ctx and cancelled with it.
+func ExecuteQueryContext(ctx context.Context, q *Query, client *_client.Client) (*Result, error) {
 	if err := checkDatabaseConnection(client.Database); err != nil {
 		return nil, err
 	}
 
 	var (
-		err   error
-		query string
-		res   *Result
+		err      error
+		res      *Result
+		cancel   context.CancelFunc
+		span     trace.Span
+		timeout  = statementTimeout(q, client)
+		limited  bool
+		sqlQuery string
 	)
 
+	ctx, span = tracing.StartQuery(ctx, "ExecuteQuery", strings.ToLower(client.Type.String()), leadingKeyword(q.SQLQuery), "")
+	defer func() {
+		var rows int64
+		if res != nil {
+			rows = res.AffectedRows
+		}
+		tracing.EndQuery(span, rows, err)
+	}()
+
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	sqlQuery, limited = WithDefaultLimit(client.Type.String(), q.SQLQuery, client.DefaultLimit)
+
 	switch strings.ToLower(strings.ToLower(client.Type.String())) {
 	case strings.ToLower(_sql.MySQL.String()):
-		query = fmt.Sprintf(_sql.MySQLUse, client.Schema.Name)
-		_, err = client.Database.Exec(query)
+		res, err = execMySQLQuery(ctx, client.Database, client.Cells, client.Schema.Name, sqlQuery, q.Args...)
 		if err != nil {
+			err = timeoutError(ctx, timeout, err)
 			return nil, err
 		}
-		query = fmt.Sprintf(q.SQLQuery)
-		res, err = execQueryHelper(client.Database, query)
+		if !q.Columnar {
+			res.fillMaps()
+		}
+		res.limitedTo(limited, client.DefaultLimit)
+		res.ReferencedColumns = referencedColumns(q.SQLQuery, client)
+		return res, nil
+
+	case strings.ToLower(_sql.PostgreSQL.String()):
+		res, err = execPostgreSQLQuery(ctx, client.Database, client.Cells, client.Schema.Name, sqlQuery, q.Args...)
 		if err != nil {
+			err = timeoutError(ctx, timeout, err)
 			return nil, err
 		}
+		if !q.Columnar {
+			res.fillMaps()
+		}
+		res.limitedTo(limited, client.DefaultLimit)
 		return res, nil
 
-	case strings.ToLower(_sql.PostgreSQL.String()):
-		query = fmt.Sprintf(q.SQLQuery)
-		res, err = execQueryHelper(client.Database, query)
+	case strings.ToLower(_sql.SQLite.String()):
+		res, err = execQueryHelper(ctx, client.Database, client.Cells, sqlQuery, q.Args...)
 		if err != nil {
+			err = timeoutError(ctx, timeout, err)
 			return nil, err
 		}
+		if !q.Columnar {
+			res.fillMaps()
+		}
+		res.limitedTo(limited, client.DefaultLimit)
 		return res, nil
 	}
 
 	return nil, nil
 }
 
-func execQueryHelper(db *sql.DB, query string) (*Result, error) {
+// limitedTo flags the result of a query that limit was appended to, see WithDefaultLimit.
+func (r *Result) limitedTo(limited bool, limit int) {
+	if limited {
+		r.Limited, r.Limit = true, limit
+	}
+}
+
+// statementTimeout returns how long the query may run: its own timeout if set, otherwise
+// the statementTimeoutMs setting of the connection. Zero means no timeout.
+func statementTimeout(q *Query, client *_client.Client) time.Duration {
+	if q.TimeoutMs > 0 {
+		return time.Duration(q.TimeoutMs) * time.Millisecond
+	}
+	return time.Duration(client.Settings.StatementTimeoutMs) * time.Millisecond
+}
+
+// timeoutError reports a query cancelled by its timeout as util.ErrStatementTimeout, drivers
+// each describing the cancellation their own way.
+func timeoutError(ctx context.Context, timeout time.Duration, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w after %s: %v", util.ErrStatementTimeout, timeout, err)
+	}
+	return err
+}
+
+// execMySQLQuery runs the query on a dedicated connection using the selected schema. USE is session
+// state, so running it on the pool could leave the query, e.g. an unqualified CALL, on another connection.
+// It is the only statement that relies on the current database: every other one qualifies its tables.
+func execMySQLQuery(ctx context.Context, db *sql.DB, limit _client.CellLimit, schema, query string, args ...interface{}) (*Result, error) {
+	var (
+		err  error
+		conn *sql.Conn
+	)
+
+	conn, err = db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(conn *sql.Conn) {
+		err = conn.Close()
+		if err != nil {
+			return
+		}
+	}(conn)
+
+	if schema != "" {
+		_, err = conn.ExecContext(ctx, fmt.Sprintf(_sql.MySQLUse, _client.QuoteIdentifier(_sql.MySQL.String(), schema)))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return execQueryHelper(ctx, conn, limit, query, args...)
+}
+
+// execPostgreSQLQuery runs the query on a dedicated connection whose search_path is set
+// to the selected schema, so unqualified table names resolve the same way the browsing UI does.
+// The search_path is session state, hence a single sql.Conn rather than the pool.
+func execPostgreSQLQuery(ctx context.Context, db *sql.DB, limit _client.CellLimit, schema, query string, args ...interface{}) (*Result, error) {
+	var (
+		err        error
+		conn       *sql.Conn
+		res        *Result
+		searchPath string
+	)
+
+	conn, err = db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(conn *sql.Conn) {
+		err = conn.Close()
+		if err != nil {
+			return
+		}
+	}(conn)
+
+	if schema != "" {
+		_, err = conn.ExecContext(ctx, fmt.Sprintf(_sql.PostgreSQLSetSearchPath, pq.QuoteIdentifier(schema)))
+		if err != nil {
+			return nil, err
+		}
+		// runs before the connection is closed
+		defer resetSearchPath(conn)
+	}
+
+	err = conn.QueryRowContext(ctx, _sql.PostgreSQLShowSearchPath).Scan(&searchPath)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err = execQueryHelper(ctx, conn, limit, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	res.SearchPath = searchPath
+	return res, nil
+}
+
+// resetSearchPath resets the search_path set on a PostgreSQL connection before it goes back to the pool,
+// so the queries that get it next resolve table names as usual. It runs even when the query was cancelled;
+// a connection that cannot be reset is discarded from the pool instead.
+func resetSearchPath(conn *sql.Conn) {
+	if _, err := conn.ExecContext(context.Background(), _sql.PostgreSQLResetSearchPath); err != nil {
+		_ = conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	}
+}
+
+// execQueryHelper runs the query and reads every result set it returns. Reading them all also
+// leaves a MySQL connection usable after a CALL, which otherwise fails with "commands out of sync".
+// Values longer than the limit are truncated, see _client.CellLimit. The query is cancelled with ctx.
+func execQueryHelper(ctx context.Context, db queryer, limit _client.CellLimit, query string, args ...interface{}) (*Result, error) {
 	var (
 		err       error
-		columns   []string
 		msg       string
 		rows      *sql.Rows
 		startTime time.Time
 		result    *Result
-		row       map[string]interface{}
-		values    []interface{}
-		pointers  []interface{}
+		set       ResultSet
+		sets      []ResultSet
+		budget    = limit.Budget()
 	)
 
 	startTime = time.Now()
 	result = &Result{
 		AffectedRows: 0,
-		Data:         make([]map[string]interface{}, 0),
 	}
 
-	rows, err = db.Query(query)
+	rows, err = db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -233,43 +569,54 @@ func execQueryHelper(db *sql.DB, query string) (*Result, error) {
 		}
 	}(rows)
 
-	columns, err = rows.Columns()
-	if err != nil {
-		return nil, err
-	}
-
-	for rows.Next() {
-		row = make(map[string]interface{})
-		values = make([]interface{}, len(columns))
-		pointers = make([]interface{}, len(columns))
-		for i := range columns {
-			pointers[i] = &values[i]
-		}
-		err = rows.Scan(pointers...)
+	for {
+		set, err = readResultSet(rows, limit, budget)
 		if err != nil {
 			return nil, err
 		}
-		for i, column := range columns {
-			val := values[i]
-			if byteVal, ok := val.([]byte); ok {
-				row[column] = string(byteVal)
-			} else {
-				row[column] = val
-			}
+		sets = append(sets, set)
+		result.AffectedRows += int64(set.rows.Len())
+		if !rows.NextResultSet() {
+			break
 		}
-		result.Data = append(result.Data, row)
 	}
-
 	if err = rows.Err(); err != nil {
 		return nil, err
 	}
-	result.Time = fmt.Sprintf("%.5f", time.Since(startTime).Seconds())
-	result.AffectedRows = int64(len(result.Data))
+
+	result.rows, result.Warnings, result.Renamed = sets[0].rows, sets[0].Warnings, sets[0].Renamed
+	if len(sets) > 1 {
+		result.ResultSets = sets
+	}
+	elapsed := time.Since(startTime)
+	result.Time = fmt.Sprintf("%.5f", elapsed.Seconds())
+	result.TimeMS = elapsed.Milliseconds()
 	msg = fmt.Sprintf("Query executed successfully (%d rows affected, time taken %s)", result.AffectedRows, result.Time)
+	if len(sets) > 1 {
+		msg = fmt.Sprintf("Query executed successfully (%d result sets, %d rows affected, time taken %s)",
+			len(sets), result.AffectedRows, result.Time)
+	}
 	result.Msg = msg
 	return result, nil
 }
 
+// readResultSet reads the rows of the current result set, truncating values longer than the limit.
+// The budget spans every result set of the query.
+func readResultSet(rows *sql.Rows, limit _client.CellLimit, budget *_client.ResultBudget) (ResultSet, error) {
+	var (
+		err  error
+		set  ResultSet
+		read *_client.Rows
+	)
+
+	read, set.Warnings, err = _client.ReadRows(rows, limit, budget)
+	if err != nil {
+		return ResultSet{}, err
+	}
+	set.Columns, set.Renamed, set.rows = read.Columns(), read.Renamed(), read
+	return set, nil
+}
+
 func DropTable(table, dbname string, db *sql.DB) (*Result, error) {
 	if err := checkDatabaseConnection(db); err != nil {
 		return nil, err
@@ -285,13 +632,7 @@ func DropTable(table, dbname string, db *sql.DB) (*Result, error) {
 		rows        int64
 	)
 
-	query = fmt.Sprintf(_sql.MySQLUse, dbname)
-	_, err = db.Exec(query)
-	if err != nil {
-		return nil, err
-	}
-
-	query = fmt.Sprintf(_sql.MySQLDropTable, table)
+	query = fmt.Sprintf(_sql.MySQLDropTable, _client.QualifiedTable(_sql.MySQL.String(), dbname, table))
 	startTime = time.Now()
 	res, err = db.Exec(query)
 	if err != nil {
@@ -307,6 +648,7 @@ func DropTable(table, dbname string, db *sql.DB) (*Result, error) {
 	result = &Result{
 		AffectedRows: rows,
 		Time:         fmt.Sprintf("%.3f", elapsedTime.Seconds()),
+		TimeMS:       elapsedTime.Milliseconds(),
 		Msg:          fmt.Sprintf("Table '%s' dropped successfully (%s)", table, elapsedTime.String()),
 	}
 	return result, nil
@@ -326,12 +668,7 @@ func TruncateTable(table, dbname string, db *sql.DB) (*Result, error) {
 		rows        int64
 	)
 
-	query = fmt.Sprintf(_sql.MySQLUse, dbname)
-	_, err = db.Exec(query)
-	if err != nil {
-		return nil, err
-	}
-	query = fmt.Sprintf(_sql.MySQLTruncateTable, table)
+	query = fmt.Sprintf(_sql.MySQLTruncateTable, _client.QualifiedTable(_sql.MySQL.String(), dbname, table))
 	startTime = time.Now()
 	res, err = db.Exec(query)
 	if err != nil {
@@ -345,62 +682,188 @@ func TruncateTable(table, dbname string, db *sql.DB) (*Result, error) {
 	result = &Result{
 		AffectedRows: rows,
 		Time:         fmt.Sprintf("%.3f", elapsedTime.Seconds()),
+		TimeMS:       elapsedTime.Milliseconds(),
 		Msg:          fmt.Sprintf("Table '%s' truncateed successfully (%s)", table, elapsedTime.String()),
 	}
 	return result, nil
 }
 
-func DropDatabase(dbname string, db *sql.DB) (*Result, error) {
-	if err := checkDatabaseConnection(db); err != nil {
+// DropDatabase drops a database of the server of the client, a schema on MySQL. Dropping a database
+// that does not exist fails on both.
+// PostgreSQL cannot drop the database it is connected to, so that is refused; connect to another
+// database, such as the postgres maintenance database, to drop it. SQLite has no such statement.
+func DropDatabase(dbname string, client *_client.Client) (*Result, error) {
+	if err := checkDatabaseConnection(client.Database); err != nil {
 		return nil, err
 	}
+
 	var (
-		err         error
-		query       string
-		res         sql.Result
-		result      *Result
-		startTime   time.Time
-		elapsedTime time.Duration
-		rows        int64
+		query  string
+		dbType string
 	)
 
-	query = fmt.Sprintf(_sql.MySQLDropDatabase, dbname)
-	startTime = time.Now()
-	res, err = db.Exec(query)
-	if err != nil {
+	if dbname == "" {
+		return nil, errors.New("database name is required")
+	}
+	dbType = client.Type.String()
+	switch strings.ToLower(dbType) {
+	case strings.ToLower(_sql.MySQL.String()):
+		query = fmt.Sprintf(_sql.MySQLDropDatabase, _client.QuoteIdentifier(dbType, dbname))
+	case strings.ToLower(_sql.PostgreSQL.String()):
+		if dbname == client.Name {
+			return nil, util.ErrDropConnectedDatabase
+		}
+		query = fmt.Sprintf(_sql.PostgreSQLDropDatabase, _client.QuoteIdentifier(dbType, dbname))
+	case strings.ToLower(_sql.SQLite.String()):
+		return nil, util.ErrNoDropDatabase
+	default:
+		return nil, fmt.Errorf("unsupported database type: %s", dbType)
+	}
+	return execDatabaseStatement(client, query, dbname, "dropped")
+}
+
+// DatabaseOptions are the optional settings of a new database. Empty fields keep the server defaults.
+// On PostgreSQL, Charset is the encoding and Collation the LC_COLLATE locale.
+type DatabaseOptions struct {
+	Charset   string `json:"charset"`
+	Collation string `json:"collation"`
+}
+
+// CreateDatabase creates a database on the server of the client, as a schema on MySQL, with the
+// charset and collation of options, which must be among those the server offers, see _client.GetCharsets.
+// SQLite has no such statement, as each database is a file of its own.
+func CreateDatabase(dbname string, client *_client.Client, options DatabaseOptions) (*Result, error) {
+	if err := checkDatabaseConnection(client.Database); err != nil {
 		return nil, err
 	}
-	rows, err = res.RowsAffected()
+
+	var (
+		err       error
+		query     string
+		available *_client.Charsets
+	)
+
+	if dbname == "" {
+		return nil, errors.New("database name is required")
+	}
+	if strings.EqualFold(client.Type.String(), _sql.SQLite.String()) {
+		return nil, util.ErrNoCreateDatabase
+	}
+	if options.Charset != "" || options.Collation != "" {
+		available, err = client.GetCharsets()
+		if err != nil {
+			return nil, err
+		}
+		if err = validateDatabaseOptions(client.Type.String(), options, available); err != nil {
+			return nil, err
+		}
+	}
+	query, err = buildCreateDatabase(client.Type.String(), dbname, options)
 	if err != nil {
 		return nil, err
 	}
-	elapsedTime = time.Since(startTime)
-	result = &Result{
-		AffectedRows: rows,
-		Time:         fmt.Sprintf("%.3f", elapsedTime.Seconds()),
-		Msg:          fmt.Sprintf("Database '%s' dropped successfully (%s)", dbname, elapsedTime.String()),
+	return execDatabaseStatement(client, query, dbname, "created")
+}
+
+// buildCreateDatabase builds the CREATE DATABASE statement of the given database type.
+func buildCreateDatabase(dbType, dbname string, options DatabaseOptions) (string, error) {
+	var query string
+	switch strings.ToLower(dbType) {
+	case strings.ToLower(_sql.MySQL.String()):
+		query = fmt.Sprintf(_sql.MySQLCreateDatabase, _client.QuoteIdentifier(dbType, dbname))
+		if options.Charset != "" {
+			query += fmt.Sprintf(_sql.MySQLDatabaseCharset, _client.QuoteLiteral(dbType, options.Charset))
+		}
+		if options.Collation != "" {
+			query += fmt.Sprintf(_sql.MySQLDatabaseCollation, _client.QuoteLiteral(dbType, options.Collation))
+		}
+	case strings.ToLower(_sql.PostgreSQL.String()):
+		query = fmt.Sprintf(_sql.PostgreSQLCreateDatabase, _client.QuoteIdentifier(dbType, dbname))
+		// template1 may have another encoding or locale; template0 accepts any
+		if options.Charset != "" || options.Collation != "" {
+			query += _sql.PostgreSQLTemplate0
+		}
+		if options.Charset != "" {
+			query += fmt.Sprintf(_sql.PostgreSQLDatabaseEncoding, _client.QuoteLiteral(dbType, options.Charset))
+		}
+		if options.Collation != "" {
+			query += fmt.Sprintf(_sql.PostgreSQLDatabaseLocale, _client.QuoteLiteral(dbType, options.Collation))
+		}
+	case strings.ToLower(_sql.SQLite.String()):
+		return "", util.ErrNoCreateDatabase
+	default:
+		return "", fmt.Errorf("unsupported database type: %s", dbType)
 	}
-	return result, nil
+	return query, nil
 }
 
-func CreateDatabase(dbname string, db *sql.DB) (*Result, error) {
-	if err := checkDatabaseConnection(db); err != nil {
-		return nil, err
+// validateDatabaseOptions checks the charset and collation against those the server offers.
+// On MySQL the collation must also belong to the charset. On PostgreSQL the collation is a locale,
+// checked against the locales of pg_collation. Charsets and MySQL collations compare ignoring case, as
+// the servers do; PostgreSQL locales are the names of the operating system, which are case-sensitive.
+func validateDatabaseOptions(dbType string, options DatabaseOptions, available *_client.Charsets) error {
+	var charsetOK, collationOK bool
+	if options.Charset == "" {
+		charsetOK = true
+	}
+	for _, charset := range available.Charsets {
+		if strings.EqualFold(charset.Name, options.Charset) {
+			charsetOK = true
+		}
+	}
+	if !charsetOK {
+		return fmt.Errorf("unknown charset: %q", options.Charset)
 	}
 
+	if options.Collation == "" {
+		return nil
+	}
+	isPostgres := strings.EqualFold(dbType, _sql.PostgreSQL.String())
+	for _, collation := range available.Collations {
+		name := collation.Name
+		if isPostgres {
+			name = collation.Locale
+		}
+		if isPostgres && name != options.Collation || !strings.EqualFold(name, options.Collation) {
+			continue
+		}
+		collationOK = true
+		if !isPostgres && options.Charset != "" && !strings.EqualFold(collation.Charset, options.Charset) {
+			return fmt.Errorf("collation %q does not belong to charset %q", options.Collation, options.Charset)
+		}
+	}
+	if !collationOK {
+		return fmt.Errorf("unknown collation: %q", options.Collation)
+	}
+	return nil
+}
+
+// execDatabaseStatement runs a CREATE or DROP DATABASE statement. On PostgreSQL these cannot run
+// inside a transaction block, so the statement runs alone on a connection of its own, in autocommit.
+func execDatabaseStatement(client *_client.Client, query, dbname, done string) (*Result, error) {
 	var (
 		err         error
-		query       string
+		ctx         = context.Background()
+		conn        *sql.Conn
 		res         sql.Result
-		result      *Result
 		startTime   time.Time
 		elapsedTime time.Duration
 		rows        int64
 	)
 
-	query = fmt.Sprintf(_sql.MySQLCreateDatabase, dbname)
+	conn, err = client.Database.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func(conn *sql.Conn) {
+		err := conn.Close()
+		if err != nil {
+			return
+		}
+	}(conn)
+
 	startTime = time.Now()
-	res, err = db.Exec(query)
+	res, err = conn.ExecContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -409,10 +872,10 @@ func CreateDatabase(dbname string, db *sql.DB) (*Result, error) {
 		return nil, err
 	}
 	elapsedTime = time.Since(startTime)
-	result = &Result{
+	return &Result{
 		AffectedRows: rows,
 		Time:         fmt.Sprintf("%.3f", elapsedTime.Seconds()),
-		Msg:          fmt.Sprintf("Database '%s' dropped successfully (%s)", dbname, elapsedTime.String()),
-	}
-	return result, nil
+		TimeMS:       elapsedTime.Milliseconds(),
+		Msg:          fmt.Sprintf("Database '%s' %s successfully (%s)", dbname, done, elapsedTime.String()),
+	}, nil
 }
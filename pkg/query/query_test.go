@@ -1,15 +1,27 @@
 package query
 
 import (
+	"database/sql"
+	"encoding/json"
 	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"testing/iotest"
 
 	_conn "github.com/yazeed1s/sqlweb/db/connection"
 	_sql "github.com/yazeed1s/sqlweb/db/sql"
 	_cl "github.com/yazeed1s/sqlweb/pkg/client"
+	"github.com/yazeed1s/sqlweb/pkg/util"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func SetupMySQLConnection() (*_cl.Client, error) {
@@ -39,6 +51,33 @@ func SetupMySQLConnection() (*_cl.Client, error) {
 	}, nil
 }
 
+func SetupPostgreSQLConnection() (*_cl.Client, error) {
+	client := &_conn.Connection{
+		Host:     "localhost",
+		Port:     5432,
+		User:     "postgres",
+		Password: "11221122",
+		Name:     "postgres",
+		Type:     _sql.PostgreSQL,
+	}
+	db, err := _conn.ConnectToDatabase(client, client.Type.String())
+	if err != nil {
+		return nil, err
+	}
+	return &_cl.Client{
+		Host:     client.Host,
+		Port:     client.Port,
+		User:     client.User,
+		Password: client.Password,
+		Name:     client.Name,
+		Type:     client.Type,
+		Database: db,
+		Schema: _cl.Schema{
+			Name: "public",
+		},
+	}, nil
+}
+
 func TestDropTable(t *testing.T) {
 	// Set up the MySQL connection
 	client, err := SetupMySQLConnection()
@@ -136,3 +175,1771 @@ func TestTruncateTable(t *testing.T) {
 		return
 	}
 }
+
+func TestExecuteQueryPostgreSQLSearchPath(t *testing.T) {
+	client, err := SetupPostgreSQLConnection()
+	require.NoError(t, err, "Failed to set up PostgreSQL connection")
+	defer client.Database.Close()
+
+	setup := []string{
+		`CREATE SCHEMA IF NOT EXISTS sp_one`,
+		`CREATE SCHEMA IF NOT EXISTS sp_two`,
+		`CREATE TABLE sp_one.sp_items (origin text)`,
+		`CREATE TABLE sp_two.sp_items (origin text)`,
+		`INSERT INTO sp_one.sp_items VALUES ('one')`,
+		`INSERT INTO sp_two.sp_items VALUES ('two')`,
+	}
+	for _, stmt := range setup {
+		_, err = client.Database.Exec(stmt)
+		require.NoError(t, err)
+	}
+	defer func() {
+		_, _ = client.Database.Exec(`DROP SCHEMA sp_one CASCADE`)
+		_, _ = client.Database.Exec(`DROP SCHEMA sp_two CASCADE`)
+	}()
+
+	for _, schema := range []string{"sp_one", "sp_two"} {
+		client.Schema.Name = schema
+		result, err := ExecuteQuery(&Query{SQLQuery: "SELECT origin FROM sp_items"}, client)
+		require.NoError(t, err)
+		require.Len(t, result.Data, 1)
+		assert.Equal(t, strings.TrimPrefix(schema, "sp_"), result.Data[0]["origin"])
+		assert.Equal(t, schema, result.SearchPath)
+	}
+
+	// the connection goes back to the pool with the default search path
+	var before, after string
+	client.Database.SetMaxOpenConns(1)
+	client.Schema.Name = ""
+	require.NoError(t, client.Database.QueryRow(`SHOW search_path`).Scan(&before))
+	client.Schema.Name = "sp_one"
+	_, err = ExecuteQuery(&Query{SQLQuery: "SELECT origin FROM sp_items"}, client)
+	require.NoError(t, err)
+	_, err = ExecuteScript("SELECT origin FROM sp_items; SELECT 1", client, true)
+	require.NoError(t, err)
+	_, err = ValidateQuery("SELECT origin FROM sp_items", client)
+	require.NoError(t, err)
+	require.NoError(t, client.Database.QueryRow(`SHOW search_path`).Scan(&after))
+	assert.Equal(t, before, after)
+}
+
+func TestExecuteQueryMySQLProcedureResultSets(t *testing.T) {
+	client, err := SetupMySQLConnection()
+	require.NoError(t, err, "Failed to set up MySQL connection")
+	defer client.Database.Close()
+
+	_, err = client.Database.Exec(`DROP PROCEDURE IF EXISTS rs_two_selects`)
+	require.NoError(t, err)
+	_, err = client.Database.Exec(`CREATE PROCEDURE rs_two_selects()
+		BEGIN
+			SELECT 1 AS id, 'pen' AS item UNION ALL SELECT 2, 'ink';
+			SELECT 3 AS total;
+		END`)
+	require.NoError(t, err)
+	defer func() {
+		_, _ = client.Database.Exec(`DROP PROCEDURE IF EXISTS rs_two_selects`)
+	}()
+
+	// the connection stays usable after each call, rather than failing with "commands out of sync"
+	for i := 0; i < 3; i++ {
+		result, err := ExecuteQuery(&Query{SQLQuery: "CALL rs_two_selects()"}, client)
+		require.NoError(t, err)
+		require.Len(t, result.ResultSets, 2)
+		assert.Equal(t, []string{"id", "item"}, result.ResultSets[0].Columns)
+		assert.Len(t, result.ResultSets[0].Rows, 2)
+		assert.Equal(t, []string{"total"}, result.ResultSets[1].Columns)
+		assert.Equal(t, "3", fmt.Sprint(result.ResultSets[1].Rows[0]["total"]))
+		assert.Equal(t, result.ResultSets[0].Rows, result.Data)
+		assert.Equal(t, int64(3), result.AffectedRows)
+	}
+
+	result, err := ExecuteQuery(&Query{SQLQuery: "SELECT 1 AS one"}, client)
+	require.NoError(t, err)
+	assert.Len(t, result.Data, 1)
+	assert.Nil(t, result.ResultSets)
+}
+
+// TestExecuteQueryResultTypesMySQL pins the types of the values read over the text protocol, which
+// go-sql-driver/mysql 1.8 parses into numbers.
+func TestExecuteQueryResultTypesMySQL(t *testing.T) {
+	client, err := SetupMySQLConnection()
+	require.NoError(t, err, "Failed to set up MySQL connection")
+	defer client.Database.Close()
+
+	result, err := ExecuteQuery(&Query{SQLQuery: `SELECT CAST(42 AS SIGNED) AS i, CAST(18446744073709551615 AS UNSIGNED) AS u,
+		1.5e0 AS d, CAST(1.50 AS DECIMAL(4,2)) AS amount, 'pen' AS s, NULL AS n`}, client)
+	require.NoError(t, err)
+	require.Len(t, result.Data, 1)
+	row := result.Data[0]
+	assert.Equal(t, int64(42), row["i"])
+	assert.Equal(t, uint64(18446744073709551615), row["u"])
+	assert.Equal(t, 1.5, row["d"])
+	assert.Equal(t, "1.50", row["amount"], "DECIMAL values stay strings")
+	assert.Equal(t, "pen", row["s"])
+	assert.Nil(t, row["n"])
+
+	data, err := json.Marshal(row)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"i": 42, "u": 18446744073709551615, "d": 1.5, "amount": "1.50", "s": "pen", "n": null}`, string(data))
+}
+
+func TestSchemaSwitchingConcurrentMySQL(t *testing.T) {
+	client, err := SetupMySQLConnection()
+	require.NoError(t, err, "Failed to set up MySQL connection")
+	defer client.Database.Close()
+
+	schemas := []string{"sqlweb_switch_a", "sqlweb_switch_b"}
+	for _, schema := range schemas {
+		_, err = client.Database.Exec(fmt.Sprintf("DROP DATABASE IF EXISTS %s", schema))
+		require.NoError(t, err)
+		_, err = client.Database.Exec(fmt.Sprintf("CREATE DATABASE %s", schema))
+		require.NoError(t, err)
+		_, err = client.Database.Exec(fmt.Sprintf("CREATE TABLE %s.marker_%s (name VARCHAR(32))", schema, schema))
+		require.NoError(t, err)
+		_, err = client.Database.Exec(fmt.Sprintf("INSERT INTO %s.marker_%s VALUES ('%s')", schema, schema, schema))
+		require.NoError(t, err)
+	}
+	defer func() {
+		for _, schema := range schemas {
+			_, _ = client.Database.Exec(fmt.Sprintf("DROP DATABASE IF EXISTS %s", schema))
+		}
+	}()
+
+	// each client selects one of the schemas and shares the pool with the other
+	var wg sync.WaitGroup
+	for i := 0; i < 40; i++ {
+		schema := schemas[i%2]
+		c := _cl.Client{Type: client.Type, Name: client.Name, Database: client.Database, Schema: _cl.Schema{Name: schema}}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tables, err := c.GetTableNames()
+			if assert.NoError(t, err) {
+				assert.Equal(t, []string{"marker_" + schema}, tables)
+			}
+			result, err := ExecuteQuery(&Query{SQLQuery: fmt.Sprintf("SELECT name FROM marker_%s", schema)}, &c)
+			if assert.NoError(t, err) && assert.Len(t, result.Data, 1) {
+				assert.Equal(t, schema, fmt.Sprint(result.Data[0]["name"]))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestCreateDatabaseSQLiteUnsupported(t *testing.T) {
+	client := SetupSQLiteClient(t)
+	_, err := CreateDatabase("shop", client, DatabaseOptions{})
+	assert.ErrorIs(t, err, util.ErrNoCreateDatabase)
+}
+
+func TestCreateDatabaseMySQL(t *testing.T) {
+	client, err := SetupMySQLConnection()
+	require.NoError(t, err, "Failed to set up MySQL connection")
+	defer client.Database.Close()
+	_, _ = client.Database.Exec("DROP DATABASE IF EXISTS sqlweb_created")
+	defer func() {
+		_, _ = client.Database.Exec("DROP DATABASE IF EXISTS sqlweb_created")
+	}()
+
+	result, err := CreateDatabase("sqlweb_created", client, DatabaseOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, result.Msg, "created")
+}
+
+func TestCreateDatabasePostgreSQL(t *testing.T) {
+	client, err := SetupPostgreSQLConnection()
+	require.NoError(t, err, "Failed to set up PostgreSQL connection")
+	defer client.Database.Close()
+	_, _ = client.Database.Exec("DROP DATABASE IF EXISTS sqlweb_created")
+	defer func() {
+		_, _ = client.Database.Exec("DROP DATABASE IF EXISTS sqlweb_created")
+	}()
+
+	result, err := CreateDatabase("sqlweb_created", client, DatabaseOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, result.Msg, "created")
+}
+
+func TestBuildCreateDatabase(t *testing.T) {
+	query, err := buildCreateDatabase("MySQL", "shop", DatabaseOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "CREATE DATABASE `shop`", query)
+
+	query, err = buildCreateDatabase("MySQL", "shop", DatabaseOptions{Charset: "utf8mb4", Collation: "utf8mb4_bin"})
+	require.NoError(t, err)
+	assert.Equal(t, "CREATE DATABASE `shop` CHARACTER SET 'utf8mb4' COLLATE 'utf8mb4_bin'", query)
+
+	query, err = buildCreateDatabase("PostgreSQL", "shop", DatabaseOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, `CREATE DATABASE "shop"`, query)
+
+	query, err = buildCreateDatabase("PostgreSQL", "shop", DatabaseOptions{Charset: "UTF8", Collation: "en_US.utf8"})
+	require.NoError(t, err)
+	assert.Equal(t, `CREATE DATABASE "shop" TEMPLATE template0 ENCODING 'UTF8' LC_COLLATE 'en_US.utf8'`, query)
+
+	_, err = buildCreateDatabase("SQLite", "shop", DatabaseOptions{})
+	assert.ErrorIs(t, err, util.ErrNoCreateDatabase)
+}
+
+func TestValidateDatabaseOptions(t *testing.T) {
+	mysql := &_cl.Charsets{
+		Charsets: []_cl.Charset{{Name: "utf8mb4"}, {Name: "latin1"}},
+		Collations: []_cl.Collation{
+			{Name: "utf8mb4_bin", Charset: "utf8mb4"},
+			{Name: "latin1_swedish_ci", Charset: "latin1"},
+		},
+	}
+	assert.NoError(t, validateDatabaseOptions("MySQL", DatabaseOptions{Charset: "utf8mb4", Collation: "utf8mb4_bin"}, mysql))
+	assert.NoError(t, validateDatabaseOptions("MySQL", DatabaseOptions{Collation: "LATIN1_SWEDISH_CI"}, mysql))
+	assert.ErrorContains(t, validateDatabaseOptions("MySQL", DatabaseOptions{Charset: "klingon"}, mysql), "unknown charset")
+	assert.ErrorContains(t, validateDatabaseOptions("MySQL", DatabaseOptions{Collation: "utf8mb4_nope"}, mysql), "unknown collation")
+	assert.ErrorContains(t,
+		validateDatabaseOptions("MySQL", DatabaseOptions{Charset: "latin1", Collation: "utf8mb4_bin"}, mysql),
+		"does not belong")
+
+	postgres := &_cl.Charsets{
+		Charsets:   []_cl.Charset{{Name: "UTF8"}, {Name: "LATIN1"}},
+		Collations: []_cl.Collation{{Name: "en_US", Locale: "en_US.utf8"}, {Name: "C", Locale: "C"}},
+	}
+	assert.NoError(t, validateDatabaseOptions("PostgreSQL", DatabaseOptions{Charset: "utf8", Collation: "en_US.utf8"}, postgres))
+	assert.NoError(t, validateDatabaseOptions("PostgreSQL", DatabaseOptions{Charset: "LATIN1", Collation: "C"}, postgres))
+	assert.ErrorContains(t, validateDatabaseOptions("PostgreSQL", DatabaseOptions{Collation: "en_US"}, postgres), "unknown collation")
+	assert.ErrorContains(t, validateDatabaseOptions("PostgreSQL", DatabaseOptions{Collation: "EN_US.UTF8"}, postgres), "unknown collation")
+}
+
+func TestDropDatabaseSQLiteUnsupported(t *testing.T) {
+	client := SetupSQLiteClient(t)
+	_, err := DropDatabase("main", client)
+	assert.ErrorIs(t, err, util.ErrNoDropDatabase)
+}
+
+func TestDropDatabaseMySQL(t *testing.T) {
+	client, err := SetupMySQLConnection()
+	require.NoError(t, err, "Failed to set up MySQL connection")
+	defer client.Database.Close()
+	_, err = client.Database.Exec("CREATE DATABASE IF NOT EXISTS sqlweb_dropped")
+	require.NoError(t, err)
+
+	result, err := DropDatabase("sqlweb_dropped", client)
+	require.NoError(t, err)
+	assert.Contains(t, result.Msg, "dropped")
+
+	// a missing database is an error, as on PostgreSQL
+	_, err = DropDatabase("sqlweb_dropped", client)
+	assert.Error(t, err)
+}
+
+func TestDropDatabasePostgreSQL(t *testing.T) {
+	client, err := SetupPostgreSQLConnection()
+	require.NoError(t, err, "Failed to set up PostgreSQL connection")
+	defer client.Database.Close()
+	_, _ = client.Database.Exec("DROP DATABASE IF EXISTS sqlweb_dropped")
+	_, err = client.Database.Exec("CREATE DATABASE sqlweb_dropped")
+	require.NoError(t, err)
+
+	result, err := DropDatabase("sqlweb_dropped", client)
+	require.NoError(t, err)
+	assert.Contains(t, result.Msg, "dropped")
+
+	// a missing database is an error, as on MySQL
+	_, err = DropDatabase("sqlweb_dropped", client)
+	assert.Error(t, err)
+
+	_, err = DropDatabase(client.Name, client)
+	assert.ErrorIs(t, err, util.ErrDropConnectedDatabase)
+}
+
+func TestReferencedTables(t *testing.T) {
+	query := "SELECT o.id, c.name FROM otherdb.orders o " +
+		"JOIN `crm`.`customers` c ON c.id = o.customer_id " +
+		"LEFT JOIN local_table l ON l.id = o.id " +
+		"WHERE o.id IN (SELECT id FROM otherdb.orders)"
+	refs := ReferencedTables(query)
+	assert.Equal(t, []TableRef{
+		{Schema: "otherdb", Table: "orders"},
+		{Schema: "crm", Table: "customers"},
+	}, refs)
+
+	assert.Empty(t, ReferencedTables("SELECT * FROM employees"))
+	assert.Equal(t, []TableRef{{Schema: "archive", Table: "logs"}},
+		ReferencedTables("insert into archive . logs select * from logs"))
+}
+
+func TestBuildCommentQueries(t *testing.T) {
+	query, err := buildTableCommentQuery("MySQL", "shop", "orders", "customer's orders")
+	assert.NoError(t, err)
+	assert.Equal(t, "ALTER TABLE `shop`.`orders` COMMENT = 'customer''s orders'", query)
+
+	query, err = buildTableCommentQuery("PostgreSQL", "public", "orders", "customer's orders")
+	assert.NoError(t, err)
+	assert.Equal(t, `COMMENT ON TABLE "public"."orders" IS 'customer''s orders'`, query)
+
+	query, err = buildColumnCommentQuery("MySQL", "shop", "orders", "id", "int NOT NULL auto_increment", "key")
+	assert.NoError(t, err)
+	assert.Equal(t, "ALTER TABLE `shop`.`orders` MODIFY COLUMN `id` int NOT NULL auto_increment COMMENT 'key'", query)
+
+	query, err = buildColumnCommentQuery("PostgreSQL", "public", "orders", "id", "", "key")
+	assert.NoError(t, err)
+	assert.Equal(t, `COMMENT ON COLUMN "public"."orders"."id" IS 'key'`, query)
+
+	_, err = buildTableCommentQuery("SQLite", "", "orders", "key")
+	assert.ErrorIs(t, err, util.ErrCommentsUnsupported)
+	_, err = buildColumnCommentQuery("SQLite", "", "orders", "id", "", "key")
+	assert.ErrorIs(t, err, util.ErrCommentsUnsupported)
+}
+
+func TestSetCommentsMySQL(t *testing.T) {
+	client, err := SetupMySQLConnection()
+	require.NoError(t, err, "Failed to set up MySQL connection")
+	defer client.Database.Close()
+
+	_, err = client.Database.Exec(`CREATE TABLE test_comments (
+		id INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+		name VARCHAR(64) NOT NULL DEFAULT 'none'
+	)`)
+	require.NoError(t, err)
+	defer client.Database.Exec(`DROP TABLE test_comments`)
+
+	_, err = SetTableComment("test_comments", "people we know", client)
+	require.NoError(t, err)
+	_, err = SetColumnComment("test_comments", "name", "full name", client)
+	require.NoError(t, err)
+
+	data, err := client.GetColumnsData("test_comments")
+	require.NoError(t, err)
+	assert.Equal(t, "people we know", data.Comment)
+	for _, col := range data.Columns {
+		if col.Field == "name" {
+			assert.Equal(t, "full name", col.Comment)
+			assert.Equal(t, "varchar(64)", col.Type)
+		}
+	}
+}
+
+func TestSetColumnCommentKeepsCollationMySQL(t *testing.T) {
+	client, err := SetupMySQLConnection()
+	require.NoError(t, err, "Failed to set up MySQL connection")
+	defer client.Database.Close()
+
+	_, err = client.Database.Exec(`CREATE TABLE test_comment_collation (
+		id INT NOT NULL PRIMARY KEY,
+		code VARCHAR(16) CHARACTER SET latin1 COLLATE latin1_bin NOT NULL
+	) DEFAULT CHARSET = utf8mb4`)
+	require.NoError(t, err)
+	defer client.Database.Exec(`DROP TABLE test_comment_collation`)
+
+	_, err = SetColumnComment("test_comment_collation", "code", "case-sensitive code", client)
+	require.NoError(t, err)
+
+	var charset, collation string
+	err = client.Database.QueryRow(`SELECT CHARACTER_SET_NAME, COLLATION_NAME FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'test_comment_collation' AND COLUMN_NAME = 'code'`).Scan(&charset, &collation)
+	require.NoError(t, err)
+	assert.Equal(t, "latin1", charset)
+	assert.Equal(t, "latin1_bin", collation)
+}
+
+func TestSetCommentsPostgreSQL(t *testing.T) {
+	client, err := SetupPostgreSQLConnection()
+	require.NoError(t, err, "Failed to set up PostgreSQL connection")
+	defer client.Database.Close()
+
+	_, err = client.Database.Exec(`CREATE TABLE public.test_comments (id int PRIMARY KEY, name text)`)
+	require.NoError(t, err)
+	defer client.Database.Exec(`DROP TABLE public.test_comments`)
+
+	_, err = SetTableComment("test_comments", "people we know", client)
+	require.NoError(t, err)
+	_, err = SetColumnComment("test_comments", "name", "full name", client)
+	require.NoError(t, err)
+
+	data, err := client.GetColumnsData("test_comments")
+	require.NoError(t, err)
+	assert.Equal(t, "people we know", data.Comment)
+	for _, col := range data.Columns {
+		if col.Field == "name" {
+			assert.Equal(t, "full name", col.Comment)
+		}
+	}
+}
+
+func TestIsReadOnlyStatement(t *testing.T) {
+	readOnly := []string{
+		"SELECT * FROM employees",
+		"  -- list them\n select 1; SHOW TABLES;",
+		"(SELECT 1) UNION (SELECT 2)",
+		"WITH t AS (SELECT 1) SELECT * FROM t",
+		"EXPLAIN SELECT * FROM employees",
+		"PRAGMA table_info('employees')",
+		"PRAGMA main.index_list(employees)",
+		"PRAGMA journal_mode",
+		"/* comment */ DESCRIBE employees",
+		"SELECT 'a;b -- c', \"into\" FROM t",
+	}
+	for _, q := range readOnly {
+		assert.True(t, IsReadOnlyStatement("", q), q)
+	}
+
+	writes := []string{
+		"DELETE FROM employees",
+		"SELECT 1; DROP TABLE employees",
+		"WITH gone AS (DELETE FROM employees RETURNING *) SELECT * FROM gone",
+		"EXPLAIN ANALYZE UPDATE employees SET name = 'x'",
+		"PRAGMA journal_mode = WAL",
+		"PRAGMA wal_checkpoint(TRUNCATE)",
+		"PRAGMA optimize",
+		"CALL do_something()",
+		// comment markers and semicolons inside strings do not hide a statement
+		"SELECT '--'; DROP TABLE employees",
+		"SELECT '/*'; DROP TABLE employees; SELECT '*/'",
+		"SELECT * INTO backup FROM employees",
+		"SELECT $$ ' $$; DROP TABLE employees",
+	}
+	for _, q := range writes {
+		assert.False(t, IsReadOnlyStatement("", q), q)
+	}
+
+	// MySQL escapes quotes with backslashes and starts comments with #
+	mysql := strings.ToLower(_sql.MySQL.String())
+	assert.False(t, IsReadOnlyStatement(mysql, `SELECT 'it\'s'; DROP TABLE employees`))
+	assert.False(t, IsReadOnlyStatement(mysql, "SELECT 1 /*!50000 ; DROP TABLE employees */"))
+	assert.False(t, IsReadOnlyStatement(mysql, "SELECT * FROM employees INTO OUTFILE '/tmp/employees'"))
+	assert.True(t, IsReadOnlyStatement(mysql, "SELECT 1 # ; DROP TABLE employees"))
+}
+
+func TestUpdateRowGeneratedColumn(t *testing.T) {
+	client := SetupSQLiteClient(t)
+	_, err := client.Database.Exec(`CREATE TABLE items (
+		id INTEGER PRIMARY KEY,
+		price REAL,
+		quantity INTEGER,
+		total REAL GENERATED ALWAYS AS (price * quantity) VIRTUAL
+	)`)
+	require.NoError(t, err)
+	_, err = client.Database.Exec(`INSERT INTO items (id, price, quantity) VALUES (1, 2.5, 4)`)
+	require.NoError(t, err)
+
+	_, err = UpdateRow("items", "total", text("99"), "1", "id", client)
+	assert.ErrorIs(t, err, util.ErrColumnNotWritable)
+
+	_, err = UpdateRow("items", "missing", text("99"), "1", "id", client)
+	assert.ErrorContains(t, err, "column 'missing' not found")
+}
+
+func TestUpdateRowBindsValues(t *testing.T) {
+	client := SetupSQLiteClient(t)
+	_, err := client.Database.Exec(`CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT, age INTEGER, code TEXT);
+		INSERT INTO people VALUES (1, 'ada', 36, 'a1'), (2, 'alan', 41, 'b2')`)
+	require.NoError(t, err)
+
+	// values and keys are bound, so quotes and SQL in them are written as they are
+	result, err := UpdateRow("people", "name", text("O'Brien'); DROP TABLE people; --"), "1", "id", client)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), result.AffectedRows)
+	result, err = UpdateRow("people", "age", text("37"), "b2' OR '1'='1", "code", client)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), result.AffectedRows)
+	_, err = UpdateRow("people", "age", nil, "1 OR 1=1", "id", client)
+	require.NoError(t, err)
+
+	var (
+		name string
+		ages []sql.NullInt64
+	)
+	require.NoError(t, client.Database.QueryRow(`SELECT name FROM people WHERE id = 1`).Scan(&name))
+	assert.Equal(t, "O'Brien'); DROP TABLE people; --", name)
+	rows, err := client.Database.Query(`SELECT age FROM people ORDER BY id`)
+	require.NoError(t, err)
+	defer rows.Close()
+	for rows.Next() {
+		var age sql.NullInt64
+		require.NoError(t, rows.Scan(&age))
+		ages = append(ages, age)
+	}
+	assert.Equal(t, []sql.NullInt64{{Int64: 36, Valid: true}, {Int64: 41, Valid: true}}, ages)
+
+	_, err = UpdateRow("people", "age", nil, "1", "id", client)
+	require.NoError(t, err)
+	var age sql.NullInt64
+	require.NoError(t, client.Database.QueryRow(`SELECT age FROM people WHERE id = 1`).Scan(&age))
+	assert.False(t, age.Valid)
+}
+
+func TestWritesSeeColumnsAddedElsewhere(t *testing.T) {
+	client := SetupSQLiteClient(t)
+	_, err := client.Database.Exec(`CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT);
+		INSERT INTO people VALUES (1, 'ada')`)
+	require.NoError(t, err)
+	_, err = client.GetCachedColumns("", "people")
+	require.NoError(t, err)
+	// added by another client, the cached columns do not know about it
+	_, err = client.Database.Exec(`ALTER TABLE people ADD COLUMN email TEXT`)
+	require.NoError(t, err)
+
+	_, err = UpdateRow("people", "email", text("ada@example.com"), "1", "id", client)
+	require.NoError(t, err)
+	client.ResetColumns()
+	_, err = client.GetCachedColumns("", "people")
+	require.NoError(t, err)
+	_, err = client.Database.Exec(`ALTER TABLE people ADD COLUMN city TEXT`)
+	require.NoError(t, err)
+
+	_, err = InsertRow("people", map[string]interface{}{"name": "alan", "city": "wilmslow"}, client)
+	require.NoError(t, err)
+	_, err = UpdateWhere("people", map[string]interface{}{"city": "london"}, _cl.Filter{{Column: "id", Operator: "=", Value: 1}}, client)
+	require.NoError(t, err)
+
+	var email, city string
+	require.NoError(t, client.Database.QueryRow(`SELECT email, city FROM people WHERE id = 1`).Scan(&email, &city))
+	assert.Equal(t, "ada@example.com", email)
+	assert.Equal(t, "london", city)
+}
+
+func TestUpdateRowTimestamp(t *testing.T) {
+	client := SetupSQLiteClient(t)
+	_, err := client.Database.Exec(`CREATE TABLE events (id INTEGER PRIMARY KEY, at TIMESTAMP, day DATE)`)
+	require.NoError(t, err)
+	_, err = client.Database.Exec(`INSERT INTO events (id) VALUES (1)`)
+	require.NoError(t, err)
+
+	stored := func(column string) string {
+		var value string
+		// concatenated so that the driver returns the stored text rather than parsing it
+		require.NoError(t, client.Database.QueryRow(`SELECT `+column+` || '' FROM events WHERE id = 1`).Scan(&value))
+		return value
+	}
+
+	// an instant is stored in UTC
+	_, err = UpdateRow("events", "at", text("2024-03-10T12:30:00.25+02:00"), "1", "id", client)
+	require.NoError(t, err)
+	assert.Equal(t, "2024-03-10 10:30:00.25", stored("at"))
+
+	// a wall clock time is stored as given
+	_, err = UpdateRow("events", "at", text("2024-03-10T12:30"), "1", "id", client)
+	require.NoError(t, err)
+	assert.Equal(t, "2024-03-10 12:30:00", stored("at"))
+
+	_, err = UpdateRow("events", "day", text("2024-03-10"), "1", "id", client)
+	require.NoError(t, err)
+	assert.Equal(t, "2024-03-10", stored("day"))
+
+	_, err = UpdateRow("events", "at", text("next tuesday"), "1", "id", client)
+	assert.ErrorIs(t, err, util.ErrInvalidTime)
+	_, err = UpdateRow("events", "day", text("2024-03-10 08:00:00"), "1", "id", client)
+	assert.ErrorIs(t, err, util.ErrInvalidTime)
+	assert.Equal(t, "2024-03-10 12:30:00", stored("at"))
+}
+
+func TestTemporalValue(t *testing.T) {
+	value := func(dbType, dataType, value string) string {
+		t.Helper()
+		expr, arg, err := temporalValue(dbType, columnTemporalKind(dbType, dataType), value, "?")
+		require.NoError(t, err)
+		return strings.Replace(expr, "?", "'"+arg+"'", 1)
+	}
+
+	assert.Equal(t, "'2024-03-10 12:30:00+02:00'", value("PostgreSQL", "timestamp with time zone", "2024-03-10 12:30:00+02"))
+	assert.Equal(t, "'2024-03-10 10:30:00'", value("PostgreSQL", "timestamp without time zone", "2024-03-10T12:30:00+02:00"))
+	assert.Equal(t, "'2024-03-10 12:30:00.5'", value("PostgreSQL", "timestamp with time zone", "2024-03-10 12:30:00.5"))
+	assert.Equal(t, "FROM_UNIXTIME('1710066600.250000')", value("MySQL", "timestamp", "2024-03-10T12:30:00.25+02:00"))
+	assert.Equal(t, "'2024-03-10 12:30:00'", value("MySQL", "timestamp", "2024-03-10 12:30:00"))
+	assert.Equal(t, "'2024-03-10 10:30:00'", value("MySQL", "datetime", "2024-03-10T10:30:00Z"))
+
+	// MySQL's zero dates are left to the server
+	assert.Equal(t, "'0000-00-00'", value("MySQL", "date", "0000-00-00"))
+	assert.Equal(t, "'0000-00-00 00:00:00'", value("MySQL", "datetime", " 0000-00-00 00:00:00"))
+	_, _, err := temporalValue("PostgreSQL", dateColumn, "0000-00-00", "$1")
+	assert.ErrorIs(t, err, util.ErrInvalidTime)
+
+	assert.Equal(t, notTemporal, columnTemporalKind("MySQL", "time"))
+	assert.Equal(t, notTemporal, columnTemporalKind("MySQL", "year"))
+	assert.Equal(t, zonedColumn, columnTemporalKind("PostgreSQL", "timestamptz"))
+	assert.Equal(t, timestampColumn, columnTemporalKind("SQLite", "DATETIME"))
+	assert.Equal(t, dateColumn, columnTemporalKind("SQLite", "DATE"))
+}
+
+func TestResultTimeMS(t *testing.T) {
+	client := SetupSQLiteClient(t)
+	// a query slow enough to take a few milliseconds
+	q := &Query{SQLQuery: `WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 1000000)
+		SELECT count(*) AS total FROM n`}
+	result, err := ExecuteQuery(q, client)
+	require.NoError(t, err)
+
+	seconds, err := strconv.ParseFloat(result.Time, 64)
+	require.NoError(t, err)
+	assert.Positive(t, result.TimeMS)
+	assert.InDelta(t, seconds*1000, float64(result.TimeMS), 1)
+
+	data, err := json.Marshal(result)
+	require.NoError(t, err)
+	var decoded map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.IsType(t, float64(0), decoded["time_ms"])
+	assert.IsType(t, "", decoded["time_taken"])
+}
+
+func TestColumnarResult(t *testing.T) {
+	client := SetupSQLiteClient(t)
+	_, err := client.Database.Exec(`CREATE TABLE samples (id INTEGER PRIMARY KEY, name TEXT, score REAL, payload BLOB, mixed);
+		INSERT INTO samples VALUES (1, '<b>ada</b> & co', 1.5, x'00ff', 42), (2, NULL, 1e-7, NULL, 'text'), (3, 'ünï', NULL, x'', 2.5)`)
+	require.NoError(t, err)
+
+	for _, sqlQuery := range []string{
+		`SELECT s.id, s.name AS id, s.* FROM samples s ORDER BY s.id`,
+		`SELECT * FROM samples WHERE id < 0`,
+		`UPDATE samples SET score = 2 WHERE id = 3`,
+	} {
+		maps, err := ExecuteQuery(&Query{SQLQuery: sqlQuery}, client)
+		require.NoError(t, err)
+		columnar, err := ExecuteQuery(&Query{SQLQuery: sqlQuery, Columnar: true}, client)
+		require.NoError(t, err)
+		assert.NotNil(t, maps.Data, sqlQuery)
+		assert.Nil(t, columnar.Data, sqlQuery)
+
+		maps.Time, maps.TimeMS, maps.Msg = columnar.Time, columnar.TimeMS, columnar.Msg
+		expected, err := json.Marshal(maps)
+		require.NoError(t, err)
+		encoded, err := json.Marshal(columnar)
+		require.NoError(t, err)
+		assert.Equal(t, string(expected), string(encoded), sqlQuery)
+	}
+}
+
+func TestRowEditResultJSON(t *testing.T) {
+	encoded, err := json.Marshal(RowEditResult{
+		Result:  Result{AffectedRows: 1, Msg: "updated"},
+		Row:     _cl.Row{"id": 1},
+		Changed: []string{"name"},
+	})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"affected_rows":1,"time_taken":"","time_ms":0,"data":null,"message":"updated",
+		"row":{"id":1},"changed":["name"]}`, string(encoded))
+}
+
+// text returns a pointer to s, for the cell values of row updates.
+func text(s string) *string {
+	return &s
+}
+
+func SetupSQLiteClient(t *testing.T) *_cl.Client {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	return &_cl.Client{Type: _sql.SQLite, Database: db}
+}
+
+func TestDeleteWhere(t *testing.T) {
+	client := SetupSQLiteClient(t)
+	_, err := client.Database.Exec(`CREATE TABLE orders (id INTEGER PRIMARY KEY, status TEXT, qty INTEGER)`)
+	require.NoError(t, err)
+	_, err = client.Database.Exec(`INSERT INTO orders VALUES
+		(1, 'open', 1), (2, 'cancelled', 3), (3, 'cancelled', 10), (4, NULL, 2)`)
+	require.NoError(t, err)
+
+	result, err := DeleteWhere("orders", _cl.Filter{
+		{Column: "status", Operator: "=", Value: "cancelled"},
+		{Column: "qty", Operator: "<", Value: 5},
+	}, client)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), result.AffectedRows)
+
+	result, err = DeleteWhere("orders", _cl.Filter{{Column: "status", Operator: "is null"}}, client)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), result.AffectedRows)
+
+	var remaining int
+	require.NoError(t, client.Database.QueryRow(`SELECT COUNT(*) FROM orders`).Scan(&remaining))
+	assert.Equal(t, 2, remaining)
+}
+
+func TestDeleteWhereEmptyFilter(t *testing.T) {
+	client := SetupSQLiteClient(t)
+	_, err := client.Database.Exec(`CREATE TABLE orders (id INTEGER PRIMARY KEY)`)
+	require.NoError(t, err)
+	_, err = client.Database.Exec(`INSERT INTO orders VALUES (1), (2)`)
+	require.NoError(t, err)
+
+	_, err = DeleteWhere("orders", nil, client)
+	assert.ErrorIs(t, err, util.ErrEmptyFilter)
+
+	_, err = DeleteWhere("orders", _cl.Filter{{Column: "id", Operator: "; DROP TABLE orders", Value: 1}}, client)
+	assert.ErrorContains(t, err, "unsupported filter operator")
+
+	var remaining int
+	require.NoError(t, client.Database.QueryRow(`SELECT COUNT(*) FROM orders`).Scan(&remaining))
+	assert.Equal(t, 2, remaining)
+}
+
+func TestFormatQuery(t *testing.T) {
+	tests := []struct {
+		name   string
+		dbType string
+		query  string
+		want   string
+	}{
+		{
+			name:  "select with join, conditions and subquery",
+			query: "select id, count(*) as n from users u left join orders o on o.user_id = u.id where u.active = 1 and o.total between 10 and 20 or u.id in (select user_id from vip) group by id order by n desc limit 10",
+			want: `SELECT
+  id,
+  count(*) AS n
+FROM
+  users u
+  LEFT JOIN orders o ON o.user_id = u.id
+WHERE
+  u.active = 1
+  AND o.total BETWEEN 10 AND 20
+  OR u.id IN (
+    SELECT
+      user_id
+    FROM
+      vip
+  )
+GROUP BY
+  id
+ORDER BY
+  n DESC
+LIMIT
+  10`,
+		},
+		{
+			name:  "insert keeps strings and signs intact",
+			query: "insert into t (a, b) values (1, 'x;  select'), (-2, 'it''s')",
+			want: `INSERT INTO
+  t (a, b)
+VALUES
+  (1, 'x;  select'),
+  (-2, 'it''s')`,
+		},
+		{
+			name:  "statements, casts and comments",
+			query: "update people set name = 'x', age = age - 1 where id = $1; delete from t where x::int > -1 -- done\n and y = 2",
+			want: `UPDATE
+  people
+SET
+  name = 'x',
+  age = age - 1
+WHERE
+  id = $1;
+
+DELETE FROM
+  t
+WHERE
+  x::int > -1 -- done
+  AND y = 2`,
+		},
+		{
+			name:  "signs right after an operator",
+			query: "select a*-1, b - -2 from t where a=-1 and x<-1 and y>=+3",
+			want: `SELECT
+  a * -1,
+  b - -2
+FROM
+  t
+WHERE
+  a = -1
+  AND x < -1
+  AND y >= +3`,
+		},
+		{
+			name:   "mysql signs after a concatenation",
+			dbType: "mysql",
+			query:  "select a->'$.x', c||-1 from t",
+			want: `SELECT
+  a -> '$.x',
+  c || -1
+FROM
+  t`,
+		},
+		{
+			name:  "cte and set operators",
+			query: "WITH recent AS (SELECT * FROM orders) SELECT * FROM recent UNION ALL SELECT * FROM old",
+			want: `WITH
+  recent AS (
+    SELECT
+      *
+    FROM
+      orders
+  )
+SELECT
+  *
+FROM
+  recent
+UNION ALL
+SELECT
+  *
+FROM
+  old`,
+		},
+		{
+			name:  "lists inside parentheses stay on one line",
+			query: "create table t (id int primary key, name text default 'a, b')",
+			want:  "CREATE TABLE t (id int PRIMARY KEY, name text DEFAULT 'a, b')",
+		},
+		{
+			name:   "mysql hash comments and backslash escapes",
+			dbType: "mysql",
+			query:  "select a # from b where\nfrom t where s = 'it\\'s; from' and d = \"x\\\"y\"",
+			want: `SELECT
+  a # from b where
+FROM
+  t
+WHERE
+  s = 'it\'s; from'
+  AND d = "x\"y"`,
+		},
+		{
+			name:   "postgres dollar-quoted bodies",
+			dbType: "postgresql",
+			query:  "create function f() returns int as $$ select 1; from t $$ language sql; select $tag$ it's $$ $tag$",
+			want: `CREATE function f() returns int AS $$ select 1; from t $$ language sql;
+
+SELECT
+  $tag$ it's $$ $tag$`,
+		},
+		{
+			name:   "postgres escape strings",
+			dbType: "postgresql",
+			query:  "select E'it\\'s -- where' from t where a = e'\\\\'",
+			want: `SELECT
+  E'it\'s -- where'
+FROM
+  t
+WHERE
+  a = e'\\'`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			formatted := FormatQuery(tt.dbType, tt.query)
+			assert.Equal(t, tt.want, formatted)
+			assert.Equal(t, formatted, FormatQuery(tt.dbType, formatted), "formatting is not idempotent")
+		})
+	}
+}
+
+func TestIsDestructiveStatement(t *testing.T) {
+	for _, q := range []string{
+		"DROP TABLE orders",
+		"SELECT 1; truncate orders",
+		"ALTER TABLE orders DROP COLUMN note",
+		"/* cleanup */ DROP INDEX idx_orders",
+		"SELECT '--'; DROP TABLE orders",
+		"DELETE FROM orders",
+		"UPDATE orders SET total = 0",
+		"UPDATE orders SET total = (SELECT MAX(total) FROM old WHERE old.id = 1)",
+		"DELETE FROM orders WHERE id = 1; DELETE FROM items",
+		"WITH stale AS (SELECT id FROM orders WHERE total = 0) DELETE FROM orders",
+	} {
+		assert.True(t, IsDestructiveStatement("", q), q)
+	}
+	for _, q := range []string{
+		"SELECT * FROM drops",
+		"ALTER TABLE orders ADD COLUMN dropped_at TEXT",
+		"DELETE FROM orders WHERE id = 1",
+		"UPDATE orders SET total = 0 WHERE id IN (SELECT id FROM old)",
+		"WITH stale AS (SELECT id FROM orders) DELETE FROM orders WHERE id IN (SELECT id FROM stale)",
+		"SELECT * FROM orders FOR UPDATE",
+		"WITH o AS (SELECT 1) SELECT * FROM orders FOR UPDATE",
+		"INSERT INTO orders (id) VALUES (1) ON CONFLICT (id) DO UPDATE SET total = 0",
+		"-- DROP TABLE orders\nSELECT 1",
+		"SELECT 'DROP TABLE orders; TRUNCATE orders'",
+	} {
+		assert.False(t, IsDestructiveStatement("", q), q)
+	}
+	assert.Equal(t,
+		[]TableRef{{Schema: "shop", Table: "orders"}, {Schema: "archive"}},
+		DestructiveTargets("", "shop", "TRUNCATE TABLE orders; UPDATE t SET x = 1 WHERE id = 2; DROP SCHEMA archive"),
+	)
+	assert.Equal(t,
+		[]TableRef{{Schema: "shop", Table: "items"}},
+		DestructiveTargets("", "shop", "DELETE FROM orders WHERE id = 1; DELETE FROM items"),
+	)
+}
+
+func TestChangesSchema(t *testing.T) {
+	for _, q := range []string{
+		"CREATE TABLE orders (id INTEGER)",
+		"SELECT 1; alter table orders add column note text",
+		"/* cleanup */ DROP INDEX idx_orders",
+		"RENAME TABLE orders TO archived_orders",
+		"COMMENT ON TABLE orders IS 'orders'",
+		"SELECT '/*'; CREATE TABLE orders (id INTEGER) -- */",
+	} {
+		assert.True(t, ChangesSchema("", q), q)
+	}
+	for _, q := range []string{
+		"SELECT * FROM created",
+		"INSERT INTO orders (note) VALUES ('drop')",
+		"TRUNCATE orders",
+		"-- CREATE TABLE orders\nSELECT 1",
+		"SELECT 'x; CREATE TABLE orders (id INTEGER)'",
+	} {
+		assert.False(t, ChangesSchema("", q), q)
+	}
+}
+
+func TestSystemTargets(t *testing.T) {
+	mysql := strings.ToLower(_sql.MySQL.String())
+	postgres := strings.ToLower(_sql.PostgreSQL.String())
+	sqlite := strings.ToLower(_sql.SQLite.String())
+
+	assert.Equal(t,
+		[]TableRef{{Schema: "mysql", Table: "user"}},
+		SystemTargets(mysql, "classicmodels", "UPDATE `mysql`.`user` SET host = '%'"),
+	)
+	assert.Equal(t,
+		[]TableRef{{Schema: "performance_schema", Table: "events"}, {Schema: "sys"}},
+		SystemTargets(mysql, "classicmodels", "TRUNCATE TABLE performance_schema.events; DROP DATABASE IF EXISTS sys"),
+	)
+	assert.Equal(t,
+		[]TableRef{{Schema: "mysql", Table: "db"}},
+		SystemTargets(mysql, "mysql", "DELETE FROM db WHERE user = ''"),
+	)
+	assert.Equal(t,
+		[]TableRef{{Schema: "pg_catalog", Table: "pg_class"}},
+		SystemTargets(postgres, "public", `DELETE FROM "pg_catalog"."pg_class"`),
+	)
+	assert.Equal(t,
+		[]TableRef{{Table: "sqlite_sequence"}},
+		SystemTargets(sqlite, "", "DELETE FROM sqlite_sequence"),
+	)
+
+	assert.Equal(t,
+		[]TableRef{{Table: "sqlite_sequence"}},
+		SystemTargets(sqlite, "", "DELETE FROM [sqlite_sequence]"),
+	)
+	// MySQL's multi-table forms name the tables being written through their aliases
+	for _, q := range []string{
+		"DELETE t FROM mysql.user t WHERE t.user = ''",
+		"DELETE u, a FROM mysql.user AS u JOIN audit a ON u.user = a.user AND a.id IN (1, 2)",
+		"DELETE FROM u USING mysql.user AS u, audit",
+		"DELETE LOW_PRIORITY `user` FROM `mysql`.`user`",
+		"UPDATE audit a JOIN mysql.user u ON u.user = a.user SET u.host = '%'",
+		"UPDATE audit, mysql.user SET host = '%'",
+		"INSERT mysql.user VALUES ('x')",
+		"REPLACE mysql.user (host) VALUES ('%')",
+		"CREATE INDEX idx ON mysql.user (host)",
+		"WITH x AS (SELECT 1) UPDATE mysql.user SET host = '%'",
+	} {
+		assert.Equal(t, []TableRef{{Schema: "mysql", Table: "user"}}, SystemTargets(mysql, "classicmodels", q), q)
+	}
+
+	// reads, and writes that only mention a system schema in passing, are not targets
+	assert.Empty(t, SystemTargets(mysql, "classicmodels", "SELECT * FROM mysql.user"))
+	assert.Empty(t, SystemTargets(mysql, "classicmodels",
+		"INSERT INTO audit SELECT table_name FROM information_schema.tables"))
+	assert.Empty(t, SystemTargets(mysql, "classicmodels", "UPDATE notes SET body = 'see mysql.user'"))
+	assert.Empty(t, SystemTargets(postgres, "public", "UPDATE mysql_users SET active = false"))
+	assert.Empty(t, SystemTargets(mysql, "classicmodels", "UPDATE notes SET body = REPLACE(body, 'mysql', 'user')"))
+	assert.Empty(t, SystemTargets(mysql, "classicmodels",
+		"INSERT INTO audit (id) VALUES (1) ON DUPLICATE KEY UPDATE id = (SELECT 1 FROM mysql.user LIMIT 1)"))
+	assert.Empty(t, SystemTargets(mysql, "classicmodels", "DELETE a FROM audit a JOIN mysql.user u ON u.user = a.user"))
+}
+
+func TestUpdateWhere(t *testing.T) {
+	client := SetupSQLiteClient(t)
+	_, err := client.Database.Exec(`CREATE TABLE orders (id INTEGER PRIMARY KEY, status TEXT, qty INTEGER)`)
+	require.NoError(t, err)
+	_, err = client.Database.Exec(`INSERT INTO orders VALUES (1, 'open', 1), (2, 'open', 3), (3, 'shipped', 10)`)
+	require.NoError(t, err)
+
+	result, err := UpdateWhere("orders",
+		map[string]interface{}{"status": "cancelled", "qty": float64(0)},
+		_cl.Filter{{Column: "status", Operator: "=", Value: "open"}, {Column: "qty", Operator: ">", Value: 2}},
+		client,
+	)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), result.AffectedRows)
+
+	var (
+		status string
+		qty    int
+	)
+	require.NoError(t, client.Database.QueryRow(`SELECT status, qty FROM orders WHERE id = 2`).Scan(&status, &qty))
+	assert.Equal(t, "cancelled", status)
+	assert.Equal(t, 0, qty)
+
+	_, err = UpdateWhere("orders", map[string]interface{}{"missing": 1},
+		_cl.Filter{{Column: "id", Operator: "=", Value: 1}}, client)
+	assert.ErrorContains(t, err, "column 'missing' not found")
+
+	_, err = UpdateWhere("orders", map[string]interface{}{"qty": 1.5},
+		_cl.Filter{{Column: "id", Operator: "=", Value: 1}}, client)
+	assert.ErrorContains(t, err, "is not a valid")
+}
+
+func TestUpdateWhereRequiresFilter(t *testing.T) {
+	client := SetupSQLiteClient(t)
+	_, err := client.Database.Exec(`CREATE TABLE orders (id INTEGER PRIMARY KEY, status TEXT)`)
+	require.NoError(t, err)
+	_, err = client.Database.Exec(`INSERT INTO orders VALUES (1, 'open'), (2, 'open')`)
+	require.NoError(t, err)
+
+	_, err = UpdateWhere("orders", map[string]interface{}{"status": "closed"}, nil, client)
+	assert.ErrorIs(t, err, util.ErrEmptyFilter)
+
+	var closed int
+	require.NoError(t, client.Database.QueryRow(`SELECT COUNT(*) FROM orders WHERE status = 'closed'`).Scan(&closed))
+	assert.Equal(t, 0, closed)
+
+	result, err := UpdateAll("orders", map[string]interface{}{"status": "closed"}, client)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), result.AffectedRows)
+}
+
+func TestUpdateRowTxRollback(t *testing.T) {
+	client := SetupSQLiteClient(t)
+	_, err := client.Database.Exec(`CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT)`)
+	require.NoError(t, err)
+	_, err = client.Database.Exec(`INSERT INTO people VALUES (1, 'ada')`)
+	require.NoError(t, err)
+
+	tx, err := client.Database.Begin()
+	require.NoError(t, err)
+	result, err := UpdateRowTx(tx, "people", "name", text("grace"), "1", "id", client)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), result.AffectedRows)
+
+	var name string
+	require.NoError(t, tx.QueryRow(`SELECT name FROM people WHERE id = 1`).Scan(&name))
+	assert.Equal(t, "grace", name)
+	require.NoError(t, tx.Rollback())
+
+	require.NoError(t, client.Database.QueryRow(`SELECT name FROM people WHERE id = 1`).Scan(&name))
+	assert.Equal(t, "ada", name)
+}
+
+func TestUpdateRowBatchIsAtomic(t *testing.T) {
+	client := SetupSQLiteClient(t)
+	_, err := client.Database.Exec(`CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT, age INTEGER CHECK (age >= 0))`)
+	require.NoError(t, err)
+	_, err = client.Database.Exec(`INSERT INTO people VALUES (1, 'ada', 36), (2, 'alan', 41)`)
+	require.NoError(t, err)
+
+	_, err = UpdateRowBatch([]RowUpdate{
+		{Table: "people", Column: "name", Value: text("grace"), KeyValue: "1", KeyColumn: "id"},
+		{Table: "people", Column: "age", Value: text("-1"), KeyValue: "2", KeyColumn: "id"},
+	}, client)
+	require.Error(t, err)
+
+	var name string
+	require.NoError(t, client.Database.QueryRow(`SELECT name FROM people WHERE id = 1`).Scan(&name))
+	assert.Equal(t, "ada", name)
+
+	results, err := UpdateRowBatch([]RowUpdate{
+		{Table: "people", Column: "name", Value: text("grace"), KeyValue: "1", KeyColumn: "id"},
+		{Table: "people", Column: "age", Value: text("42"), KeyValue: "2", KeyColumn: "id"},
+	}, client)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+
+	var age int
+	require.NoError(t, client.Database.QueryRow(`SELECT name FROM people WHERE id = 1`).Scan(&name))
+	require.NoError(t, client.Database.QueryRow(`SELECT age FROM people WHERE id = 2`).Scan(&age))
+	assert.Equal(t, "grace", name)
+	assert.Equal(t, 42, age)
+}
+
+func TestUpdateWholeRow(t *testing.T) {
+	client := SetupSQLiteClient(t)
+	_, err := client.Database.Exec(`CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT, age INTEGER, city TEXT)`)
+	require.NoError(t, err)
+	_, err = client.Database.Exec(`INSERT INTO people VALUES (1, 'ada', 36, 'london'), (2, 'alan', 41, 'wilmslow')`)
+	require.NoError(t, err)
+
+	result, err := UpdateWholeRow(RowEdit{
+		Table:      "people",
+		KeyColumns: []string{"id"},
+		KeyValues:  []interface{}{float64(1)},
+		Values:     map[string]interface{}{"name": "ada", "age": float64(37), "city": nil},
+	}, client)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), result.AffectedRows)
+	assert.Equal(t, []string{"age", "city"}, result.Changed)
+	assert.Equal(t, int64(37), result.Row["age"])
+	assert.Nil(t, result.Row["city"])
+
+	_, err = UpdateWholeRow(RowEdit{
+		Table:      "people",
+		KeyColumns: []string{"id"},
+		KeyValues:  []interface{}{float64(2)},
+		Values:     map[string]interface{}{"id": float64(3)},
+	}, client)
+	assert.ErrorContains(t, err, "primary key")
+
+	result, err = UpdateWholeRow(RowEdit{
+		Table:          "people",
+		KeyColumns:     []string{"id"},
+		KeyValues:      []interface{}{float64(2)},
+		Values:         map[string]interface{}{"id": float64(3)},
+		AllowKeyChange: true,
+	}, client)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"id"}, result.Changed)
+	assert.Equal(t, int64(3), result.Row["id"])
+
+	_, err = UpdateWholeRow(RowEdit{
+		Table:      "people",
+		KeyColumns: []string{"id"},
+		KeyValues:  []interface{}{float64(99)},
+		Values:     map[string]interface{}{"name": "nobody"},
+	}, client)
+	assert.ErrorContains(t, err, "no row")
+}
+
+func TestUpdateWholeRowPatchesColumnsAtOnce(t *testing.T) {
+	client := SetupSQLiteClient(t)
+	_, err := client.Database.Exec(`CREATE TABLE items (
+		id INTEGER PRIMARY KEY,
+		name TEXT,
+		price REAL,
+		quantity INTEGER,
+		total REAL GENERATED ALWAYS AS (price * quantity) VIRTUAL
+	)`)
+	require.NoError(t, err)
+	_, err = client.Database.Exec(`INSERT INTO items (id, name, price, quantity) VALUES (1, 'pen', 2.5, 4)`)
+	require.NoError(t, err)
+
+	// values arrive as JSON decodes them and are bound to the column types
+	result, err := UpdateWholeRow(RowEdit{
+		Table:      "items",
+		KeyColumns: []string{"id"},
+		KeyValues:  []interface{}{"1"},
+		Values:     map[string]interface{}{"name": "pencil", "price": "1.5", "quantity": float64(10)},
+	}, client)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), result.AffectedRows)
+	assert.Equal(t, []string{"name", "price", "quantity", "total"}, result.Changed)
+	assert.Equal(t, "pencil", result.Row["name"])
+	assert.Equal(t, 1.5, result.Row["price"])
+	assert.Equal(t, int64(10), result.Row["quantity"])
+	assert.Equal(t, 15.0, result.Row["total"])
+
+	_, err = UpdateWholeRow(RowEdit{
+		Table:      "items",
+		KeyColumns: []string{"id"},
+		KeyValues:  []interface{}{float64(1)},
+		Values:     map[string]interface{}{"name": "marker", "total": float64(0)},
+	}, client)
+	assert.ErrorIs(t, err, util.ErrColumnNotWritable)
+
+	_, err = UpdateWholeRow(RowEdit{
+		Table:      "items",
+		KeyColumns: []string{"id"},
+		KeyValues:  []interface{}{float64(1)},
+		Values:     map[string]interface{}{"name": "marker", "colour": "red"},
+	}, client)
+	assert.ErrorContains(t, err, "column 'colour' not found")
+
+	// a refused patch changes nothing, not even its valid columns
+	var name string
+	require.NoError(t, client.Database.QueryRow(`SELECT name FROM items WHERE id = 1`).Scan(&name))
+	assert.Equal(t, "pencil", name)
+}
+
+func TestUpdateWhereSQLiteIdentifierCase(t *testing.T) {
+	client := SetupSQLiteClient(t)
+	_, err := client.Database.Exec(`CREATE TABLE "People" ("Id" INTEGER PRIMARY KEY, "Name" TEXT)`)
+	require.NoError(t, err)
+	_, err = client.Database.Exec(`INSERT INTO "People" VALUES (1, 'ada')`)
+	require.NoError(t, err)
+
+	result, err := UpdateWhere("people", map[string]interface{}{"name": "grace"}, _cl.Filter{{Column: "id", Operator: "=", Value: 1}}, client)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, result.AffectedRows)
+
+	var name string
+	require.NoError(t, client.Database.QueryRow(`SELECT "Name" FROM "People" WHERE "Id" = 1`).Scan(&name))
+	assert.Equal(t, "grace", name)
+}
+
+func TestExecuteScriptMySQL(t *testing.T) {
+	client, err := SetupMySQLConnection()
+	require.NoError(t, err, "Failed to set up MySQL connection")
+	defer client.Database.Close()
+	script := `CREATE TABLE test_script (id INT); INSERT INTO test_script VALUES (1), (2);`
+	t.Cleanup(func() {
+		_, _ = client.Database.Exec(`DROP TABLE IF EXISTS test_script`)
+	})
+
+	// the main connection keeps multiStatements off
+	_, err = client.Database.Exec(script)
+	assert.Error(t, err)
+
+	_, err = ExecuteScript(script, client, false)
+	assert.ErrorIs(t, err, util.ErrMultiStatements)
+
+	_, err = ExecuteScript(script, client, true)
+	require.NoError(t, err)
+	var count int
+	require.NoError(t, client.Database.QueryRow(`SELECT COUNT(*) FROM test_script`).Scan(&count))
+	assert.Equal(t, 2, count)
+}
+
+func TestExecuteScriptMySQLDisabled(t *testing.T) {
+	client := SetupSQLiteClient(t)
+	client.Type = _sql.MySQL
+	_, err := ExecuteScript(`SELECT 1; SELECT 2;`, client, false)
+	assert.ErrorIs(t, err, util.ErrMultiStatements)
+}
+
+func TestExecuteScriptSQLite(t *testing.T) {
+	client := SetupSQLiteClient(t)
+	result, err := ExecuteScript(`CREATE TABLE notes (id INTEGER PRIMARY KEY, body TEXT); INSERT INTO notes (body) VALUES ('a'), ('b');`, client, false)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, result.AffectedRows)
+
+	var count int
+	require.NoError(t, client.Database.QueryRow(`SELECT COUNT(*) FROM notes`).Scan(&count))
+	assert.Equal(t, 2, count)
+}
+
+func TestStatementScanner(t *testing.T) {
+	for _, c := range []struct {
+		dbType string
+		script string
+		want   []string
+	}{
+		{"mysql", "# header; still a comment\nINSERT INTO t VALUES ('it\\'s;');\nSELECT 2", []string{
+			"# header; still a comment\nINSERT INTO t VALUES ('it\\'s;')", "SELECT 2",
+		}},
+		{"mysql", "/*!40101 SET NAMES utf8 */;\n-- done;\n", []string{"/*!40101 SET NAMES utf8 */"}},
+		{"mysql", "CREATE PROCEDURE p() BEGIN IF 1 THEN SELECT 1; END IF; CASE WHEN 1 THEN SELECT 2; END CASE; END;\nSELECT 3;", []string{
+			"CREATE PROCEDURE p() BEGIN IF 1 THEN SELECT 1; END IF; CASE WHEN 1 THEN SELECT 2; END CASE; END", "SELECT 3",
+		}},
+		{"postgresql", "CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql;SELECT ';'", []string{
+			"CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql", "SELECT ';'",
+		}},
+		{"sqlite", "CREATE TRIGGER tr AFTER INSERT ON t BEGIN UPDATE t SET n = CASE WHEN 1 THEN 2 END; DELETE FROM t; END;\n;\n/* bye */", []string{
+			"CREATE TRIGGER tr AFTER INSERT ON t BEGIN UPDATE t SET n = CASE WHEN 1 THEN 2 END; DELETE FROM t; END",
+		}},
+	} {
+		for name, r := range map[string]func() io.Reader{
+			"whole":    func() io.Reader { return strings.NewReader(c.script) },
+			"one byte": func() io.Reader { return iotest.OneByteReader(strings.NewReader(c.script)) },
+		} {
+			var got []string
+			scanner := NewStatementScanner(c.dbType, r())
+			for scanner.Scan() {
+				got = append(got, scanner.Text())
+			}
+			require.NoError(t, scanner.Err())
+			assert.Equal(t, c.want, got, "%s read %s", c.script, name)
+		}
+	}
+}
+
+func TestStatementScannerReadError(t *testing.T) {
+	scanner := NewStatementScanner("sqlite", iotest.TimeoutReader(iotest.OneByteReader(strings.NewReader("SELECT 1; SELECT 2"))))
+	assert.False(t, scanner.Scan())
+	assert.ErrorIs(t, scanner.Err(), iotest.ErrTimeout)
+}
+
+func TestExecuteScriptReaderSQLite(t *testing.T) {
+	client := SetupSQLiteClient(t)
+	result, err := ExecuteScriptReader(strings.NewReader(`CREATE TABLE notes (id INTEGER PRIMARY KEY, body TEXT);
+INSERT INTO notes (body) VALUES ('a;'), ('b');
+INSERT INTO notes (body) VALUES ('c')`), client, false)
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, result.AffectedRows)
+
+	_, err = ExecuteScriptReader(strings.NewReader(`INSERT INTO notes (body) VALUES ('d'); INSERT INTO missing VALUES (1);`), client, false)
+	assert.ErrorContains(t, err, "statement 2")
+	var count int
+	require.NoError(t, client.Database.QueryRow(`SELECT COUNT(*) FROM notes`).Scan(&count))
+	assert.Equal(t, 4, count)
+}
+
+// testNullRoundTrip reads a NULL and an empty string, swaps them through the update functions,
+// and checks that reading the table back still tells them apart.
+func testNullRoundTrip(t *testing.T, client *_cl.Client) {
+	_, err := client.Database.Exec(`CREATE TABLE test_nulls (id INT PRIMARY KEY, note VARCHAR(20))`)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, _ = client.Database.Exec(`DROP TABLE test_nulls`)
+	})
+	_, err = client.Database.Exec(`INSERT INTO test_nulls VALUES (1, NULL), (2, '')`)
+	require.NoError(t, err)
+
+	notes := func() map[string]interface{} {
+		table, err := client.GetTable("test_nulls", 1, 10)
+		require.NoError(t, err)
+		byID := make(map[string]interface{})
+		for _, row := range table.Data {
+			byID[fmt.Sprint(row["id"])] = row["note"]
+		}
+		return byID
+	}
+	assert.Equal(t, map[string]interface{}{"1": nil, "2": ""}, notes())
+
+	_, err = UpdateRow("test_nulls", "note", text(""), "1", "id", client)
+	require.NoError(t, err)
+	_, err = UpdateRow("test_nulls", "note", nil, "2", "id", client)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"1": "", "2": nil}, notes())
+
+	_, err = UpdateWhere("test_nulls", map[string]interface{}{"note": nil},
+		_cl.Filter{{Column: "id", Operator: "=", Value: 1}}, client)
+	require.NoError(t, err)
+	_, err = UpdateWhere("test_nulls", map[string]interface{}{"note": ""},
+		_cl.Filter{{Column: "id", Operator: "=", Value: 2}}, client)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"1": nil, "2": ""}, notes())
+}
+
+func TestNullRoundTripSQLite(t *testing.T) {
+	testNullRoundTrip(t, SetupSQLiteClient(t))
+}
+
+func TestNullRoundTripMySQL(t *testing.T) {
+	client, err := SetupMySQLConnection()
+	require.NoError(t, err, "Failed to set up MySQL connection")
+	defer client.Database.Close()
+	testNullRoundTrip(t, client)
+}
+
+func TestNullRoundTripPostgreSQL(t *testing.T) {
+	client, err := SetupPostgreSQLConnection()
+	require.NoError(t, err, "Failed to set up PostgreSQL connection")
+	defer client.Database.Close()
+	testNullRoundTrip(t, client)
+}
+
+func TestExecuteQueryDuplicateColumns(t *testing.T) {
+	client := SetupSQLiteClient(t)
+	_, err := client.Database.Exec(`CREATE TABLE a (id INTEGER PRIMARY KEY);
+		CREATE TABLE b (id INTEGER PRIMARY KEY, a_id INTEGER);
+		INSERT INTO a VALUES (1);
+		INSERT INTO b VALUES (2, 1)`)
+	require.NoError(t, err)
+
+	result, err := ExecuteQuery(&Query{SQLQuery: "SELECT a.id, b.id FROM a JOIN b ON b.a_id = a.id"}, client)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"id": int64(1), "id_2": int64(2)}, result.Data[0])
+	assert.Equal(t, []_cl.ColumnRename{{Index: 1, Column: "id", Name: "id_2"}}, result.Renamed)
+}
+
+func TestWithDefaultLimit(t *testing.T) {
+	for q, expected := range map[string]string{
+		"SELECT * FROM orders":                                   "SELECT * FROM orders\nLIMIT 100",
+		"select * from orders;\n":                                "select * from orders\nLIMIT 100",
+		"SELECT * FROM orders -- all of them":                    "SELECT * FROM orders -- all of them\nLIMIT 100",
+		"SELECT * FROM (SELECT * FROM orders LIMIT 5) AS recent": "SELECT * FROM (SELECT * FROM orders LIMIT 5) AS recent\nLIMIT 100",
+		"SELECT 'no limit' AS note FROM orders; -- done":         "SELECT 'no limit' AS note FROM orders\nLIMIT 100",
+		"SELECT limited FROM orders":                             "SELECT limited FROM orders\nLIMIT 100",
+	} {
+		limited, ok := WithDefaultLimit("", q, 100)
+		assert.True(t, ok, q)
+		assert.Equal(t, expected, limited, q)
+	}
+	for _, q := range []string{
+		"SELECT * FROM orders LIMIT 10",
+		"SELECT * FROM orders limit 10 offset 20",
+		"SELECT * FROM orders ORDER BY id FETCH FIRST 10 ROWS ONLY",
+		"SELECT * FROM orders WHERE id = 1 FOR UPDATE",
+		"SELECT * FROM orders WHERE id = 1 LOCK IN SHARE MODE",
+		"SELECT 1; SELECT 2",
+		"SELECT 'unterminated",
+		"UPDATE orders SET total = 0",
+		"WITH recent AS (SELECT 1) SELECT * FROM recent",
+	} {
+		unchanged, ok := WithDefaultLimit("", q, 100)
+		assert.False(t, ok, q)
+		assert.Equal(t, q, unchanged, q)
+	}
+	_, ok := WithDefaultLimit("", "SELECT * FROM orders", 0)
+	assert.False(t, ok)
+
+	// strings and comments follow the rules of the database
+	for _, c := range []struct {
+		dbType string
+		query  string
+		want   string
+	}{
+		{"mysql", `SELECT 'it\'s; LIMIT 1' AS note FROM orders`, "SELECT 'it\\'s; LIMIT 1' AS note FROM orders\nLIMIT 100"},
+		{"mysql", "SELECT * FROM orders # LIMIT 5", "SELECT * FROM orders # LIMIT 5\nLIMIT 100"},
+		{"mysql", `SELECT "LIMIT 5" FROM orders`, "SELECT \"LIMIT 5\" FROM orders\nLIMIT 100"},
+		{"postgresql", "SELECT $$ LIMIT 1; $$ AS note", "SELECT $$ LIMIT 1; $$ AS note\nLIMIT 100"},
+		{"postgresql", "SELECT * FROM orders /* LIMIT /* 5 */ */", "SELECT * FROM orders /* LIMIT /* 5 */ */\nLIMIT 100"},
+		{"sqlite", "SELECT [limit] FROM orders", "SELECT [limit] FROM orders\nLIMIT 100"},
+	} {
+		limited, ok := WithDefaultLimit(c.dbType, c.query, 100)
+		assert.True(t, ok, c.query)
+		assert.Equal(t, c.want, limited, c.query)
+	}
+	for _, c := range []struct {
+		dbType string
+		query  string
+	}{
+		// without backslash escapes the string ends before LIMIT
+		{"postgresql", `SELECT 'it\' LIMIT 1 -- '`},
+		{"mysql", "SELECT 'unterminated\\'"},
+		{"postgresql", "SELECT $$ unterminated"},
+		{"mysql", "SELECT 1 /*! ; SELECT 2 */"},
+	} {
+		unchanged, ok := WithDefaultLimit(c.dbType, c.query, 100)
+		assert.False(t, ok, c.query)
+		assert.Equal(t, c.query, unchanged, c.query)
+	}
+}
+
+func TestExecuteQueryDefaultLimit(t *testing.T) {
+	client := SetupSQLiteClient(t)
+	_, err := client.Database.Exec(`CREATE TABLE numbers (n INTEGER);
+		INSERT INTO numbers VALUES (1), (2), (3), (4), (5)`)
+	require.NoError(t, err)
+	client.DefaultLimit = 2
+
+	result, err := ExecuteQuery(&Query{SQLQuery: "SELECT n FROM numbers ORDER BY n"}, client)
+	require.NoError(t, err)
+	assert.Len(t, result.Data, 2)
+	assert.True(t, result.Limited)
+	assert.Equal(t, 2, result.Limit)
+
+	// a LIMIT of the query's own is kept
+	result, err = ExecuteQuery(&Query{SQLQuery: "SELECT n FROM numbers ORDER BY n LIMIT 4"}, client)
+	require.NoError(t, err)
+	assert.Len(t, result.Data, 4)
+	assert.False(t, result.Limited)
+
+	client.DefaultLimit = 0
+	result, err = ExecuteQuery(&Query{SQLQuery: "SELECT n FROM numbers"}, client)
+	require.NoError(t, err)
+	assert.Len(t, result.Data, 5)
+	assert.False(t, result.Limited)
+}
+
+func TestValidateQuerySQLite(t *testing.T) {
+	client := SetupSQLiteClient(t)
+	_, err := client.Database.Exec(`CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT)`)
+	require.NoError(t, err)
+
+	v, err := ValidateQuery("SELECT name FROM people WHERE id = 1;", client)
+	require.NoError(t, err)
+	assert.Equal(t, &Validation{Valid: true}, v)
+
+	v, err = ValidateQuery("SELECT name\nFROM people\nWHERE id = 1 LIMT 5", client)
+	require.NoError(t, err)
+	assert.False(t, v.Valid)
+	assert.Contains(t, v.Error, "syntax error")
+	assert.Equal(t, 3, v.Line)
+	assert.Equal(t, 14, v.Column)
+	assert.Equal(t, 38, v.Position)
+
+	v, err = ValidateQuery("SELECT name FROM (SELECT", client)
+	require.NoError(t, err)
+	assert.False(t, v.Valid)
+	assert.Equal(t, 1, v.Line)
+	assert.Equal(t, 25, v.Column)
+
+	// nothing runs
+	v, err = ValidateQuery("DELETE FROM people", client)
+	require.NoError(t, err)
+	assert.True(t, v.Valid)
+	v, err = ValidateQuery("SELECT * FROM missing", client)
+	require.NoError(t, err)
+	assert.False(t, v.Valid)
+	assert.Contains(t, v.Error, "no such table")
+
+	// a second statement is refused rather than prepared, wherever the semicolon hides
+	for _, q := range []string{"SELECT 1; DROP TABLE people", "SELECT '--'; DROP TABLE people", "SELECT 1 /* x */; DELETE FROM people"} {
+		_, err = ValidateQuery(q, client)
+		assert.ErrorIs(t, err, util.ErrSingleStatement, q)
+	}
+	v, err = ValidateQuery("SELECT ';' FROM people;", client)
+	require.NoError(t, err)
+	assert.True(t, v.Valid)
+	var tables int
+	require.NoError(t, client.Database.QueryRow(`SELECT count(*) FROM sqlite_master WHERE name = 'people'`).Scan(&tables))
+	assert.Equal(t, 1, tables)
+}
+
+func TestValidateQueryMySQL(t *testing.T) {
+	client, err := SetupMySQLConnection()
+	require.NoError(t, err, "Failed to set up MySQL connection")
+	defer client.Database.Close()
+
+	v, err := ValidateQuery("SELECT customerName FROM customers", client)
+	require.NoError(t, err)
+	assert.True(t, v.Valid)
+
+	v, err = ValidateQuery("SELECT customerName\nFORM customers", client)
+	require.NoError(t, err)
+	assert.False(t, v.Valid)
+	assert.Equal(t, 2, v.Line)
+	assert.Equal(t, 1, v.Column)
+}
+
+func TestValidateQueryPostgreSQL(t *testing.T) {
+	client, err := SetupPostgreSQLConnection()
+	require.NoError(t, err, "Failed to set up PostgreSQL connection")
+	defer client.Database.Close()
+	t.Cleanup(func() {
+		_, _ = client.Database.Exec(`DROP TABLE IF EXISTS validate_items`)
+	})
+	_, err = client.Database.Exec(`CREATE TABLE validate_items (id SERIAL PRIMARY KEY, name TEXT)`)
+	require.NoError(t, err)
+
+	v, err := ValidateQuery("SELECT name FROM validate_items WHERE id = 1;", client)
+	require.NoError(t, err)
+	assert.Equal(t, &Validation{Valid: true}, v)
+
+	v, err = ValidateQuery("SELECT name\nFORM validate_items", client)
+	require.NoError(t, err)
+	assert.False(t, v.Valid)
+	assert.Equal(t, 2, v.Line)
+
+	v, err = ValidateQuery("SELECT * FROM validate_missing", client)
+	require.NoError(t, err)
+	assert.False(t, v.Valid)
+	assert.Contains(t, v.Error, "does not exist")
+
+	_, err = ValidateQuery("CREATE TABLE validate_other (id int)", client)
+	assert.ErrorIs(t, err, util.ErrNotPreparable)
+
+	// nothing runs: neither the prepared statement nor one hidden after it
+	v, err = ValidateQuery("DELETE FROM validate_items", client)
+	require.NoError(t, err)
+	assert.True(t, v.Valid)
+	for _, q := range []string{
+		"SELECT 1; DROP TABLE validate_items",
+		"SELECT $$;$$; DROP TABLE validate_items",
+		"SELECT E'\\''; DROP TABLE validate_items",
+	} {
+		_, err = ValidateQuery(q, client)
+		assert.ErrorIs(t, err, util.ErrSingleStatement, q)
+	}
+	var exists bool
+	require.NoError(t, client.Database.QueryRow(`SELECT to_regclass('validate_items') IS NOT NULL`).Scan(&exists))
+	assert.True(t, exists)
+}
+
+func TestValidationPosition(t *testing.T) {
+	query := "SELECT a\nFORM t"
+	v := mysqlValidation(query, &mysql.MySQLError{
+		Number:  1064,
+		Message: "You have an error in your SQL syntax; check the manual that corresponds to your MySQL server version for the right syntax to use near 'FORM t' at line 2",
+	})
+	assert.Equal(t, Validation{Error: v.Error, Position: 10, Line: 2, Column: 1}, *v)
+
+	// PostgreSQL counts from the start of the PREPARE statement
+	v = postgresValidation(query, &pq.Error{Message: `syntax error at or near "t"`, Position: strconv.Itoa(len(_sql.PostgreSQLPrepareValidate) + 15)})
+	assert.Equal(t, Validation{Error: v.Error, Position: 15, Line: 2, Column: 6}, *v)
+}
+
+func testInsertRow(t *testing.T, client *_cl.Client, itemsDDL, notesDDL string) {
+	t.Cleanup(func() {
+		_, _ = client.Database.Exec(`DROP TABLE IF EXISTS insert_items`)
+		_, _ = client.Database.Exec(`DROP TABLE IF EXISTS insert_notes`)
+	})
+	_, err := client.Database.Exec(itemsDDL)
+	require.NoError(t, err)
+	_, err = client.Database.Exec(notesDDL)
+	require.NoError(t, err)
+
+	result, err := InsertRow("insert_items", map[string]interface{}{"name": "pen"}, client)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), result.AffectedRows)
+	assert.EqualValues(t, 1, result.InsertedKey["id"])
+
+	result, err = InsertRow("insert_items", map[string]interface{}{"name": "ink"}, client)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, result.InsertedKey["id"])
+
+	// a key given in the values is the key of the row
+	result, err = InsertRow("insert_items", map[string]interface{}{"id": float64(10), "name": "nib"}, client)
+	require.NoError(t, err)
+	assert.EqualValues(t, 10, result.InsertedKey["id"])
+
+	// without a primary key there is no key to return
+	result, err = InsertRow("insert_notes", map[string]interface{}{"body": "hello"}, client)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), result.AffectedRows)
+	assert.Nil(t, result.InsertedKey)
+
+	_, err = InsertRow("insert_items", map[string]interface{}{"colour": "red"}, client)
+	assert.ErrorContains(t, err, "column 'colour' not found")
+}
+
+func TestInsertRowSQLite(t *testing.T) {
+	client := SetupSQLiteClient(t)
+	testInsertRow(t, client,
+		`CREATE TABLE insert_items (id INTEGER PRIMARY KEY, name TEXT)`,
+		`CREATE TABLE insert_notes (body TEXT)`)
+
+	// the rowid is not the key of a table whose key is not an INTEGER PRIMARY KEY
+	_, err := client.Database.Exec(`CREATE TABLE insert_codes (code TEXT PRIMARY KEY, total INTEGER,
+		doubled INTEGER GENERATED ALWAYS AS (total * 2) VIRTUAL)`)
+	require.NoError(t, err)
+	result, err := InsertRow("insert_codes", map[string]interface{}{"code": "a1", "total": float64(3)}, client)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"code": "a1"}, result.InsertedKey)
+
+	_, err = InsertRow("insert_codes", map[string]interface{}{"code": "a2", "doubled": float64(4)}, client)
+	assert.ErrorIs(t, err, util.ErrColumnNotWritable)
+
+	result, err = InsertRow("insert_notes", map[string]interface{}{}, client)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), result.AffectedRows)
+}
+
+func TestInsertRowMySQL(t *testing.T) {
+	client, err := SetupMySQLConnection()
+	require.NoError(t, err, "Failed to set up MySQL connection")
+	defer client.Database.Close()
+	testInsertRow(t, client,
+		`CREATE TABLE insert_items (id INT AUTO_INCREMENT PRIMARY KEY, name VARCHAR(50))`,
+		`CREATE TABLE insert_notes (body VARCHAR(50))`)
+}
+
+func TestInsertRowPostgreSQL(t *testing.T) {
+	client, err := SetupPostgreSQLConnection()
+	require.NoError(t, err, "Failed to set up PostgreSQL connection")
+	defer client.Database.Close()
+	testInsertRow(t, client,
+		`CREATE TABLE insert_items (id SERIAL PRIMARY KEY, name TEXT)`,
+		`CREATE TABLE insert_notes (body TEXT)`)
+}
+
+func TestRenameIdentifier(t *testing.T) {
+	tests := []struct {
+		name    string
+		dbType  string
+		query   string
+		want    string
+		changed bool
+	}{
+		{
+			name:    "bare and qualified names",
+			dbType:  "sqlite",
+			query:   "SELECT orders.id FROM main.ORDERS JOIN order_items ON order_items.order_id = orders.id",
+			want:    "SELECT purchases.id FROM main.purchases JOIN order_items ON order_items.order_id = purchases.id",
+			changed: true,
+		},
+		{
+			name:    "strings and comments are left as is",
+			dbType:  "postgresql",
+			query:   "SELECT 'orders' AS label -- orders\nFROM \"orders\" /* orders */ WHERE note = 'it''s orders'",
+			want:    "SELECT 'orders' AS label -- orders\nFROM \"purchases\" /* orders */ WHERE note = 'it''s orders'",
+			changed: true,
+		},
+		{
+			name:    "MySQL double quotes are strings",
+			dbType:  "mysql",
+			query:   "SELECT \"orders\" FROM `orders`",
+			want:    "SELECT \"orders\" FROM `purchases`",
+			changed: true,
+		},
+		{
+			name:    "quoted identifiers match exactly",
+			dbType:  "postgresql",
+			query:   `SELECT * FROM "Orders"`,
+			want:    `SELECT * FROM "Orders"`,
+			changed: false,
+		},
+		{
+			name:    "backslashes only escape on MySQL",
+			dbType:  "postgresql",
+			query:   `SELECT * FROM orders WHERE path = 'C:\' OR note = ' orders '`,
+			want:    `SELECT * FROM purchases WHERE path = 'C:\' OR note = ' orders '`,
+			changed: true,
+		},
+		{
+			name:    "dollar-quoted bodies are left as is",
+			dbType:  "postgresql",
+			query:   "SELECT $$ FROM orders $$, $t$ orders $t$ FROM orders",
+			want:    "SELECT $$ FROM orders $$, $t$ orders $t$ FROM purchases",
+			changed: true,
+		},
+		{
+			name:    "PostgreSQL folds bare names",
+			dbType:  "postgresql",
+			query:   `SELECT * FROM Orders JOIN "ORDERS" ON true`,
+			want:    `SELECT * FROM purchases JOIN "ORDERS" ON true`,
+			changed: true,
+		},
+		{
+			name:    "MySQL matches names exactly",
+			dbType:  "mysql",
+			query:   "SELECT * FROM Orders, orders",
+			want:    "SELECT * FROM Orders, purchases",
+			changed: true,
+		},
+		{
+			name:    "columns and aliases sharing the name are left as is",
+			dbType:  "sqlite",
+			query:   "SELECT orders, o.orders AS orders, orders.* FROM shop.orders o, orders WHERE EXISTS (SELECT 1 FROM [orders])",
+			want:    "SELECT orders, o.orders AS orders, purchases.* FROM shop.purchases o, purchases WHERE EXISTS (SELECT 1 FROM [purchases])",
+			changed: true,
+		},
+		{
+			name:    "written tables",
+			dbType:  "mysql",
+			query:   "INSERT INTO orders (id) VALUES (1); UPDATE orders SET orders = 1; DELETE FROM `orders`; TRUNCATE TABLE orders",
+			want:    "INSERT INTO purchases (id) VALUES (1); UPDATE purchases SET orders = 1; DELETE FROM `purchases`; TRUNCATE TABLE purchases",
+			changed: true,
+		},
+		{
+			name:    "names containing the table are left as is",
+			dbType:  "sqlite",
+			query:   "SELECT * FROM orders_archive, archived_orders",
+			want:    "SELECT * FROM orders_archive, archived_orders",
+			changed: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changed := RenameIdentifier(tt.dbType, tt.query, "orders", "purchases")
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.changed, changed)
+		})
+	}
+
+	got, _ := RenameIdentifier("postgresql", "SELECT * FROM orders", "orders", "order list")
+	assert.Equal(t, `SELECT * FROM "order list"`, got)
+	got, _ = RenameIdentifier("postgresql", "SELECT * FROM orders", "orders", "Purchases")
+	assert.Equal(t, `SELECT * FROM "Purchases"`, got)
+}
+
+func TestBindParams(t *testing.T) {
+	q := "SELECT * FROM orders WHERE customer = :customer AND total > :min -- :ignored\n" +
+		"AND note <> ':quoted' AND id::text LIKE :customer AND slice[1:2] IS NOT NULL"
+	assert.Equal(t, []string{"customer", "min"}, QueryParams(_sql.PostgreSQL.String(), q))
+	// literals end where the database ends them
+	assert.Equal(t, []string{"y"}, QueryParams(_sql.MySQL.String(), `SELECT 'it\'s :x', "a\":x" # :z`+"\n, :y"))
+	assert.Equal(t, []string{"y"}, QueryParams(_sql.PostgreSQL.String(), "SELECT $$ :x $$, $f$ ' :z $f$, E'\\' :w', :y"))
+	assert.Equal(t, []string{"y"}, QueryParams(_sql.SQLite.String(), `SELECT 'C:\' AS p, [a:x], :y`))
+
+	values := map[string]interface{}{"customer": "ada", "min": json.Number("10")}
+	bound, args, err := BindParams(_sql.PostgreSQL.String(), q, values)
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM orders WHERE customer = $1 AND total > $2 -- :ignored\n"+
+		"AND note <> ':quoted' AND id::text LIKE $1 AND slice[1:2] IS NOT NULL", bound)
+	assert.Equal(t, []interface{}{"ada", int64(10)}, args)
+
+	bound, args, err = BindParams(_sql.SQLite.String(), q, values)
+	require.NoError(t, err)
+	assert.Contains(t, bound, "customer = ? AND total > ?")
+	assert.Equal(t, []interface{}{"ada", int64(10), "ada"}, args)
+
+	_, _, err = BindParams(_sql.SQLite.String(), q, map[string]interface{}{"customer": "ada"})
+	var missing *MissingParamsError
+	require.ErrorAs(t, err, &missing)
+	assert.Equal(t, []string{"min"}, missing.Names)
+	_, _, err = BindParams(_sql.SQLite.String(), q, nil)
+	require.ErrorIs(t, err, util.ErrMissingParams)
+	assert.EqualError(t, err, "missing values for parameters: customer, min")
+	values["other"] = 1
+	_, _, err = BindParams(_sql.SQLite.String(), q, values)
+	assert.ErrorContains(t, err, "unknown parameter other")
+
+	bound, args, err = BindParams(_sql.MySQL.String(), "SELECT 1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT 1", bound)
+	assert.Empty(t, args)
+}
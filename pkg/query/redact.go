@@ -0,0 +1,73 @@
+package query
+
+import "strings"
+
+// RedactSecrets replaces the passwords written in the query with the string literal of replacement:
+// the literals following IDENTIFIED [WITH plugin] BY, and REPLACE after it, on MySQL, PASSWORD on PostgreSQL, and
+// password = in a filter or PASSWORD FOR account = PASSWORD(...). Literals are found with the lexical
+// rules of the database type, so a MySQL backslash-escaped quote or a PostgreSQL dollar-quoted string
+// is redacted whole.
+func RedactSecrets(dbType, query, replacement string) string {
+	var (
+		builder strings.Builder
+		last    int
+		tokens  []token
+	)
+
+	for _, t := range tokenize(dbType, query) {
+		if t.kind != tokenLineComment && t.kind != tokenBlockComment {
+			tokens = append(tokens, t)
+		}
+	}
+	for _, i := range secretLiterals(tokens) {
+		builder.WriteString(query[last:tokens[i].pos])
+		builder.WriteString("'" + strings.ReplaceAll(replacement, "'", "''") + "'")
+		last = tokens[i].pos + len(tokens[i].text)
+	}
+	builder.WriteString(query[last:])
+	return builder.String()
+}
+
+// secretLiterals returns the indexes of the string tokens holding passwords, in order.
+func secretLiterals(tokens []token) []int {
+	var secrets []int
+
+	for i := 0; i < len(tokens); i++ {
+		j := -1
+		switch wordAt(tokens, i) {
+		case "IDENTIFIED":
+			j = i + 1
+			if wordAt(tokens, j) == "WITH" {
+				// the authentication plugin, named or quoted
+				j += 2
+			}
+			if keyword := wordAt(tokens, j); keyword != "BY" && keyword != "AS" {
+				continue
+			}
+			j++
+			// the current password, in IDENTIFIED BY 'new' REPLACE 'current'
+			if wordAt(tokens, j+1) == "REPLACE" && j+2 < len(tokens) && tokens[j+2].kind == tokenString {
+				secrets = append(secrets, j)
+				j += 2
+			}
+		case "PASSWORD":
+			j = i + 1
+			// PASSWORD FOR 'app'@'%' = ...
+			if wordAt(tokens, j) == "FOR" {
+				for j < len(tokens) && !operatorAt(tokens, j, "=") {
+					j++
+				}
+			}
+			for operatorAt(tokens, j, "=") || punctAt(tokens, j, "(") || wordAt(tokens, j) == "PASSWORD" {
+				j++
+			}
+		default:
+			continue
+		}
+		if j < len(tokens) && tokens[j].kind == tokenString {
+			secrets = append(secrets, j)
+			i = j
+		}
+	}
+	return secrets
+}
@@ -0,0 +1,218 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	_sql "github.com/yazeed1s/sqlweb/db/sql"
+	_client "github.com/yazeed1s/sqlweb/pkg/client"
+)
+
+// buildRenameColumnQuery returns the statement that renames a column.
+// MySQL 8, PostgreSQL and SQLite 3.25+ all accept the same syntax.
+func buildRenameColumnQuery(dbType, schema, table, column, newName string) string {
+	return fmt.Sprintf(
+		_sql.SQLRenameColumn,
+		_client.QualifiedTable(dbType, schema, table),
+		_client.QuoteIdentifier(dbType, column),
+		_client.QuoteIdentifier(dbType, newName),
+	)
+}
+
+// RenameColumn renames a column of the table and drops the table's cached column metadata.
+func RenameColumn(table, column, newName string, client *_client.Client) (*Result, error) {
+	if err := checkDatabaseConnection(client.Database); err != nil {
+		return nil, err
+	}
+	if newName == "" {
+		return nil, fmt.Errorf("new column name is missing or empty")
+	}
+
+	query := buildRenameColumnQuery(client.Type.String(), client.Schema.Name, table, column, newName)
+	result, err := execSchemaChange(
+		query,
+		fmt.Sprintf("Column '%s.%s' renamed to '%s' successfully", table, column, newName),
+		client.Database,
+	)
+	if err != nil {
+		return nil, err
+	}
+	client.InvalidateColumns(client.Schema.Name, table)
+	return result, nil
+}
+
+// buildRenameTableQuery returns the statement that renames a table. MySQL would move a table renamed
+// to an unqualified name to the default database, so the new name is qualified there; PostgreSQL and
+// SQLite only accept an unqualified one.
+func buildRenameTableQuery(dbType, schema, table, newName string) string {
+	renamed := _client.QuoteIdentifier(dbType, newName)
+	if strings.EqualFold(dbType, _sql.MySQL.String()) {
+		renamed = _client.QualifiedTable(dbType, schema, newName)
+	}
+	return fmt.Sprintf(_sql.SQLRenameTable, _client.QualifiedTable(dbType, schema, table), renamed)
+}
+
+// RenameTable renames a table and drops its cached column metadata.
+func RenameTable(table, newName string, client *_client.Client) (*Result, error) {
+	if err := checkDatabaseConnection(client.Database); err != nil {
+		return nil, err
+	}
+	if newName == "" {
+		return nil, fmt.Errorf("new table name is missing or empty")
+	}
+
+	query := buildRenameTableQuery(client.Type.String(), client.Schema.Name, table, newName)
+	result, err := execSchemaChange(
+		query,
+		fmt.Sprintf("Table '%s' renamed to '%s' successfully", table, newName),
+		client.Database,
+	)
+	if err != nil {
+		return nil, err
+	}
+	client.InvalidateColumns(client.Schema.Name, table)
+	return result, nil
+}
+
+// renameClauses are the keywords starting the clauses a table name may follow a comma in, or ending them.
+var renameClauses = toSet("SELECT", "FROM", "WHERE", "GROUP", "ORDER", "HAVING", "LIMIT", "OFFSET", "SET", "VALUES",
+	"ON", "JOIN", "USING", "UPDATE", "INTO", "RETURNING", "UNION", "TABLE", "TRUNCATE", "WINDOW")
+
+// tableListClauses are the clauses listing tables separated by commas.
+var tableListClauses = toSet("FROM", "USING", "UPDATE", "TABLE", "TRUNCATE")
+
+// tableKeywords are the keywords a table name follows.
+var tableKeywords = toSet("FROM", "JOIN", "INTO", "UPDATE", "TABLE", "TRUNCATE", "USING", "REFERENCES", "ONLY", "EXISTS")
+
+// RenameIdentifier rewrites the query to name the table from as to, and reports whether it changed.
+// It works on tokens read with the lexical rules of the database type, so strings, dollar-quoted bodies and
+// comments are left as is. Only table names are replaced: names following FROM, JOIN, INTO, UPDATE, TABLE
+// and the like, optionally schema-qualified, and the qualifiers of columns such as from.id. Columns and aliases
+// sharing the name keep it. Names are matched the way the database resolves them: PostgreSQL folds bare names
+// to lower case and matches quoted ones exactly, MySQL matches them exactly, as on case-sensitive file systems,
+// and SQLite ignores case.
+func RenameIdentifier(dbType, query, from, to string) (string, bool) {
+	var (
+		builder strings.Builder
+		last    int
+		changed bool
+		tokens  []token
+		// clauses holds the last clause keyword at each parenthesis depth
+		clauses = []string{""}
+	)
+
+	for _, t := range tokenize(dbType, query) {
+		if t.kind != tokenLineComment && t.kind != tokenBlockComment {
+			tokens = append(tokens, t)
+		}
+	}
+	for i, t := range tokens {
+		switch keyword := wordAt(tokens, i); {
+		case punctAt(tokens, i, "("):
+			clauses = append(clauses, "")
+			continue
+		case punctAt(tokens, i, ")"):
+			if len(clauses) > 1 {
+				clauses = clauses[:len(clauses)-1]
+			}
+			continue
+		case renameClauses[keyword]:
+			clauses[len(clauses)-1] = keyword
+			continue
+		}
+		if !namesTable(dbType, t, from) || !isTableName(tokens, i, clauses[len(clauses)-1]) {
+			continue
+		}
+		builder.WriteString(query[last:t.pos])
+		builder.WriteString(renamedIdentifier(dbType, t, to))
+		last = t.pos + len(t.text)
+		changed = true
+	}
+	builder.WriteString(query[last:])
+	return builder.String(), changed
+}
+
+// isTableName reports whether the name at i is a table: the last part of a dotted name in a table position,
+// or the part before the column of a dotted name anywhere else.
+func isTableName(tokens []token, i int, clause string) bool {
+	start, end := i, i
+	for start >= 2 && punctAt(tokens, start-1, ".") && isName(tokens[start-2]) {
+		start -= 2
+	}
+	for end+2 < len(tokens) && punctAt(tokens, end+1, ".") && (isName(tokens[end+2]) || operatorAt(tokens, end+2, "*")) {
+		end += 2
+	}
+	var (
+		parts = (end-start)/2 + 1
+		part  = (i - start) / 2
+	)
+
+	if wordAt(tokens, start-1) != "" && tableKeywords[wordAt(tokens, start-1)] ||
+		punctAt(tokens, start-1, ",") && tableListClauses[clause] {
+		return part == parts-1
+	}
+	return parts >= 2 && part == parts-2
+}
+
+// namesTable reports whether the word or quoted identifier t names the table from.
+func namesTable(dbType string, t token, from string) bool {
+	var name string
+	switch t.kind {
+	case tokenWord:
+		name = t.text
+		switch {
+		case strings.EqualFold(dbType, _sql.MySQL.String()):
+		case strings.EqualFold(dbType, _sql.SQLite.String()):
+			return strings.EqualFold(name, from)
+		default:
+			name = strings.ToLower(name)
+		}
+	case tokenQuoted:
+		name = unquoteIdentifier(t.text)
+		if quote := t.text[:1]; quote != "[" {
+			name = strings.ReplaceAll(name, quote+quote, quote)
+		}
+		if strings.EqualFold(dbType, _sql.SQLite.String()) {
+			return strings.EqualFold(name, from)
+		}
+	default:
+		return false
+	}
+	return name == from
+}
+
+// renamedIdentifier returns to written the way t was: quoted with the same quotes, or bare when it can be.
+func renamedIdentifier(dbType string, t token, to string) string {
+	if t.kind != tokenQuoted {
+		return bareIdentifier(dbType, to)
+	}
+	switch quote := t.text[:1]; quote {
+	case "[":
+		return "[" + to + "]"
+	default:
+		return quote + strings.ReplaceAll(to, quote, quote+quote) + quote
+	}
+}
+
+// isName reports whether the token is a word or a quoted identifier.
+func isName(t token) bool {
+	return t.kind == tokenWord || t.kind == tokenQuoted
+}
+
+// bareIdentifier returns the name as is when it can be written unquoted, else quoted for the database type.
+// PostgreSQL would fold an unquoted name with upper-case letters, so such a name is quoted there.
+func bareIdentifier(dbType, name string) string {
+	if name == "" {
+		return _client.QuoteIdentifier(dbType, name)
+	}
+	if strings.EqualFold(dbType, _sql.PostgreSQL.String()) && strings.ToLower(name) != name {
+		return _client.QuoteIdentifier(dbType, name)
+	}
+	for i, r := range name {
+		if !isWordRune(r) || (i == 0 && unicode.IsDigit(r)) {
+			return _client.QuoteIdentifier(dbType, name)
+		}
+	}
+	return name
+}
@@ -0,0 +1,252 @@
+package query
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	_sql "github.com/yazeed1s/sqlweb/db/sql"
+	_client "github.com/yazeed1s/sqlweb/pkg/client"
+)
+
+// RowEdit describes a whole-row edit: the row identified by KeyColumns/KeyValues
+// gets every column in Values set at once.
+type RowEdit struct {
+	Table      string
+	KeyColumns []string
+	KeyValues  []interface{}
+	Values     map[string]interface{}
+	// AllowKeyChange permits Values to modify primary key columns
+	AllowKeyChange bool
+}
+
+// RowEditResult is the outcome of a whole-row edit: the row as read back after the update,
+// and the columns whose value actually differs from before.
+type RowEditResult struct {
+	Result
+	Row     _client.Row `json:"row,omitempty"`
+	Changed []string    `json:"changed"`
+}
+
+// MarshalJSON encodes the fields of Result followed by the row and the changed columns. Without it, the
+// MarshalJSON of the embedded Result would be promoted and encode only those of Result.
+func (r RowEditResult) MarshalJSON() ([]byte, error) {
+	result, err := json.Marshal(r.Result)
+	if err != nil {
+		return nil, err
+	}
+	edit, err := json.Marshal(struct {
+		Row     _client.Row `json:"row,omitempty"`
+		Changed []string    `json:"changed"`
+	}{r.Row, r.Changed})
+	if err != nil {
+		return nil, err
+	}
+	result = append(result[:len(result)-1], ',')
+	return append(result, edit[1:]...), nil
+}
+
+// isPrimaryKey reports whether the column is part of the primary key. MySQL and PostgreSQL
+// report "PRI", SQLite reports the column's position in the key (0 when it is not part of it).
+func isPrimaryKey(dbType string, col _client.Column) bool {
+	if strings.EqualFold(dbType, _sql.SQLite.String()) {
+		return col.Key != "" && col.Key != "0"
+	}
+	return col.Key == "PRI"
+}
+
+// keyFilter builds the filter matching the row identified by the key columns and values.
+func keyFilter(keyColumns []string, keyValues []interface{}) _client.Filter {
+	filter := make(_client.Filter, len(keyColumns))
+	for i, column := range keyColumns {
+		filter[i] = _client.Condition{Column: column, Operator: "=", Value: keyValues[i]}
+	}
+	return filter
+}
+
+// buildRowUpdate validates the edit against the table's columns and builds the UPDATE of the row.
+// Unknown and generated columns are refused, and so are primary key columns unless edit.AllowKeyChange is set.
+func buildRowUpdate(dbType, schema string, columns []_client.Column, edit RowEdit) (string, []interface{}, error) {
+	if len(edit.Values) == 0 {
+		return "", nil, fmt.Errorf("no values to update")
+	}
+	if len(edit.KeyColumns) == 0 || len(edit.KeyColumns) != len(edit.KeyValues) {
+		return "", nil, fmt.Errorf("key %v does not match key columns %v", edit.KeyValues, edit.KeyColumns)
+	}
+
+	byName := make(map[string]_client.Column, len(columns))
+	for _, col := range columns {
+		byName[columnKey(dbType, col.Field)] = col
+	}
+	for _, key := range edit.KeyColumns {
+		if _, ok := byName[columnKey(dbType, key)]; !ok {
+			return "", nil, fmt.Errorf("column '%s' not found in table '%s'", key, edit.Table)
+		}
+	}
+	if !edit.AllowKeyChange {
+		for name := range edit.Values {
+			if col, ok := byName[columnKey(dbType, name)]; ok && isPrimaryKey(dbType, col) {
+				return "", nil, fmt.Errorf("column '%s' is part of the primary key of '%s'", name, edit.Table)
+			}
+		}
+	}
+
+	return buildUpdate(dbType, schema, edit.Table, columns, edit.Values, keyFilter(edit.KeyColumns, edit.KeyValues), false)
+}
+
+// bindKeyValues converts the key values to the types of their columns, see bindValue.
+func bindKeyValues(dbType string, columns []_client.Column, keyColumns []string, keyValues []interface{}) ([]interface{}, error) {
+	if len(keyColumns) == 0 || len(keyColumns) != len(keyValues) {
+		return nil, fmt.Errorf("key %v does not match key columns %v", keyValues, keyColumns)
+	}
+
+	types := make(map[string]string, len(columns))
+	for _, col := range columns {
+		types[columnKey(dbType, col.Field)] = col.Type
+	}
+
+	bound := make([]interface{}, len(keyValues))
+	for i, v := range keyValues {
+		value, err := bindValue(types[columnKey(dbType, keyColumns[i])], v)
+		if err != nil {
+			return nil, fmt.Errorf("key column '%s': %w", keyColumns[i], err)
+		}
+		bound[i] = value
+	}
+	return bound, nil
+}
+
+// selectRow reads the single row matching the key. It fails if the key matches no row or several.
+func selectRow(db queryer, dbType, schema, table string, keyColumns []string, keyValues []interface{}) (_client.Row, error) {
+	where, args, err := keyFilter(keyColumns, keyValues).Where(dbType, 1)
+	if err != nil {
+		return nil, err
+	}
+	query := fmt.Sprintf("SELECT * FROM %s WHERE %s", _client.QualifiedTable(dbType, schema, table), where)
+	// the row is read back whole, it is compared with the values written
+	res, err := execQueryHelper(context.Background(), db, _client.CellLimit{}, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	res.fillMaps()
+	switch len(res.Data) {
+	case 0:
+		return nil, fmt.Errorf("no row of '%s' matches key %v", table, keyValues)
+	case 1:
+		return res.Data[0], nil
+	default:
+		return nil, fmt.Errorf("key %v matches %d rows of '%s', it must identify a single row", keyValues, len(res.Data), table)
+	}
+}
+
+// changedColumns lists, in table order, the columns whose value differs between the two rows.
+func changedColumns(columns []_client.Column, before, after _client.Row) []string {
+	changed := make([]string, 0)
+	for _, col := range columns {
+		if fmt.Sprint(before[col.Field]) != fmt.Sprint(after[col.Field]) {
+			changed = append(changed, col.Field)
+		}
+	}
+	return changed
+}
+
+// UpdateWholeRow sets all the edited columns of a single row with one UPDATE run in a transaction,
+// and returns the row read back within the same transaction along with the columns that changed.
+func UpdateWholeRow(edit RowEdit, client *_client.Client) (*RowEditResult, error) {
+	if err := checkDatabaseConnection(client.Database); err != nil {
+		return nil, err
+	}
+
+	var (
+		err         error
+		dbType      string
+		schema      string
+		query       string
+		args        []interface{}
+		columns     []_client.Column
+		tx          *sql.Tx
+		res         sql.Result
+		before      _client.Row
+		after       _client.Row
+		newKey      []interface{}
+		startTime   time.Time
+		elapsedTime time.Duration
+		rows        int64
+	)
+
+	dbType, schema = client.Type.String(), client.Schema.Name
+	columns, err = client.GetCachedColumnsWith(schema, edit.Table, append(sortedNames(edit.Values), edit.KeyColumns...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	edit.KeyValues, err = bindKeyValues(dbType, columns, edit.KeyColumns, edit.KeyValues)
+	if err != nil {
+		return nil, err
+	}
+
+	query, args, err = buildRowUpdate(dbType, schema, columns, edit)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err = client.Database.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	before, err = selectRow(tx, dbType, schema, edit.Table, edit.KeyColumns, edit.KeyValues)
+	if err != nil {
+		return nil, err
+	}
+
+	startTime = time.Now()
+	res, err = tx.Exec(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	elapsedTime = time.Since(startTime)
+
+	rows, err = res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	// the key itself may have been edited, the row is then read back under its new key
+	newKey = make([]interface{}, len(edit.KeyColumns))
+	for i, key := range edit.KeyColumns {
+		newKey[i] = edit.KeyValues[i]
+		if v, ok := edit.Values[key]; ok {
+			newKey[i] = v
+		}
+	}
+	newKey, err = bindKeyValues(dbType, columns, edit.KeyColumns, newKey)
+	if err != nil {
+		return nil, err
+	}
+	after, err = selectRow(tx, dbType, schema, edit.Table, edit.KeyColumns, newKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &RowEditResult{
+		Result: Result{
+			AffectedRows: rows,
+			Time:         fmt.Sprintf("%.3f", elapsedTime.Seconds()),
+			TimeMS:       elapsedTime.Milliseconds(),
+			Msg:          fmt.Sprintf("Row updated successfully (%d rows affected, time taken %.3f)", rows, elapsedTime.Seconds()),
+		},
+		Row:     after,
+		Changed: changedColumns(columns, before, after),
+	}, nil
+}
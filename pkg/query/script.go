@@ -0,0 +1,172 @@
+package query
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/yazeed1s/sqlweb/db/connection"
+	_sql "github.com/yazeed1s/sqlweb/db/sql"
+	_client "github.com/yazeed1s/sqlweb/pkg/client"
+	"github.com/yazeed1s/sqlweb/pkg/util"
+)
+
+// execer is satisfied by *sql.DB and *sql.Conn.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// ExecuteScript runs a script of several statements in a single Exec and reports the rows they affected.
+// Scripts return no rows: a SELECT in a script runs, but its result is discarded.
+//
+// MySQL only accepts scripts on a connection opened with multiStatements, see connection.ConnectForScript.
+// Such a connection is opened for the script and closed right after, and only when multiStatements is true;
+// otherwise util.ErrMultiStatements is returned.
+func ExecuteScript(script string, client *_client.Client, multiStatements bool) (*Result, error) {
+	ctx := context.Background()
+	conn, release, err := scriptConn(ctx, client, multiStatements)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return execScriptHelper(ctx, conn, script)
+}
+
+// ExecuteScriptReader runs the script r holds one statement at a time, as StatementScanner splits it, so
+// that a script larger than memory can run. The statements run in order on a single connection, set up as
+// for ExecuteScript, and the first that fails stops the script with an error telling its position; the
+// statements before it are not rolled back.
+func ExecuteScriptReader(r io.Reader, client *_client.Client, multiStatements bool) (*Result, error) {
+	ctx := context.Background()
+	conn, release, err := scriptConn(ctx, client, multiStatements)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	var (
+		scanner   = NewStatementScanner(client.Type.String(), r)
+		startTime = time.Now()
+		rows      int64
+		n         int
+	)
+	for scanner.Scan() {
+		n++
+		res, err := conn.ExecContext(ctx, scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("statement %d: %w", n, err)
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return nil, fmt.Errorf("statement %d: %w", n, err)
+		}
+		rows += affected
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	return scriptResult(rows, time.Since(startTime)), nil
+}
+
+// scriptConn returns the connection the scripts of the client run on, and the func releasing it. On MySQL
+// it is opened for the script, as ExecuteScript describes.
+func scriptConn(ctx context.Context, client *_client.Client, multiStatements bool) (*sql.Conn, func(), error) {
+	if err := checkDatabaseConnection(client.Database); err != nil {
+		return nil, nil, err
+	}
+
+	switch strings.ToLower(client.Type.String()) {
+	case strings.ToLower(_sql.MySQL.String()):
+		if !multiStatements {
+			return nil, nil, util.ErrMultiStatements
+		}
+		db, err := connection.ConnectForScript(&connection.Connection{
+			Host:     client.Host,
+			Port:     client.Port,
+			User:     client.User,
+			Password: client.Password,
+			Name:     client.Schema.Name,
+			Type:     client.Type,
+
+			Credentials:     client.Credentials,
+			ApplicationName: client.ApplicationName,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			_ = db.Close()
+			return nil, nil, err
+		}
+		return conn, func() {
+			_ = conn.Close()
+			_ = db.Close()
+		}, nil
+
+	case strings.ToLower(_sql.PostgreSQL.String()):
+		conn, err := client.Database.Conn(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		// the search path is set on the connection the script runs on, as for single queries
+		if client.Schema.Name != "" {
+			_, err = conn.ExecContext(ctx, fmt.Sprintf(_sql.PostgreSQLSetSearchPath, pq.QuoteIdentifier(client.Schema.Name)))
+			if err != nil {
+				_ = conn.Close()
+				return nil, nil, err
+			}
+			return conn, func() {
+				resetSearchPath(conn)
+				_ = conn.Close()
+			}, nil
+		}
+		return conn, func() { _ = conn.Close() }, nil
+
+	case strings.ToLower(_sql.SQLite.String()):
+		conn, err := client.Database.Conn(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		return conn, func() { _ = conn.Close() }, nil
+	}
+
+	return nil, nil, fmt.Errorf("unsupported database type: %s", client.Type.String())
+}
+
+func execScriptHelper(ctx context.Context, db execer, script string) (*Result, error) {
+	var (
+		err       error
+		res       sql.Result
+		rows      int64
+		startTime time.Time
+	)
+
+	startTime = time.Now()
+	res, err = db.ExecContext(ctx, script)
+	if err != nil {
+		return nil, err
+	}
+	rows, err = res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	return scriptResult(rows, time.Since(startTime)), nil
+}
+
+// scriptResult reports a script that ran in elapsed and affected rows.
+func scriptResult(rows int64, elapsed time.Duration) *Result {
+	result := &Result{
+		AffectedRows: rows,
+		Time:         fmt.Sprintf("%.5f", elapsed.Seconds()),
+		TimeMS:       elapsed.Milliseconds(),
+		Data:         make([]map[string]interface{}, 0),
+	}
+	result.Msg = fmt.Sprintf("Script executed successfully (%d rows affected, time taken %s)", result.AffectedRows, result.Time)
+	return result
+}
@@ -0,0 +1,184 @@
+package query
+
+import (
+	"io"
+	"strings"
+)
+
+// scanChunkSize is how much of a script StatementScanner reads at once, at least.
+const scanChunkSize = 64 << 10
+
+// routineKinds are the objects whose CREATE statement may hold a BEGIN ... END body of several statements.
+var routineKinds = toSet("TRIGGER", "PROCEDURE", "FUNCTION", "EVENT")
+
+// blockEnds follow END when it closes a MySQL block other than BEGIN or CASE, e.g. END IF, whose
+// opening keywords are not counted.
+var blockEnds = toSet("IF", "LOOP", "WHILE", "REPEAT")
+
+// StatementScanner reads the statements of a script one at a time, following the lexical rules of the
+// database type, so that a script is run without ever being held in memory as a whole. Statements end
+// with a semicolon outside of strings, comments and the BEGIN ... END body of a trigger or routine.
+// Statements holding nothing but comments are skipped.
+type StatementScanner struct {
+	reader  io.Reader
+	dialect dialect
+	err     error
+	eof     bool
+	// buf holds the script read and not returned yet. The tokens before next belong to the statement
+	// starting at start, -1 until it has a token.
+	buf   []byte
+	next  int
+	start int
+	// statements are read and wait to be returned
+	statements []string
+	text       string
+	// the statement being read
+	significant bool
+	create      bool
+	routine     bool
+	depth       int
+}
+
+// NewStatementScanner returns a scanner reading the statements of the script r holds.
+func NewStatementScanner(dbType string, r io.Reader) *StatementScanner {
+	return &StatementScanner{reader: r, dialect: dialectOf(dbType), start: -1}
+}
+
+// Scan advances to the next statement, which Text then returns. It returns false at the end of the script
+// or on a read error, which Err returns.
+func (s *StatementScanner) Scan() bool {
+	for len(s.statements) == 0 {
+		if s.eof || s.err != nil {
+			return false
+		}
+		s.fill()
+	}
+	s.text, s.statements = s.statements[0], s.statements[1:]
+	return true
+}
+
+// Text returns the statement read by the last call to Scan, without its semicolon.
+func (s *StatementScanner) Text() string {
+	return s.text
+}
+
+// Err returns the first error met reading the script.
+func (s *StatementScanner) Err() error {
+	return s.err
+}
+
+// fill reads more of the script and splits off the statements it completes. At least as much is read as
+// is held already, so that a long statement is not tokenized over and over.
+func (s *StatementScanner) fill() {
+	size := len(s.buf)
+	if size < scanChunkSize {
+		size = scanChunkSize
+	}
+	if cap(s.buf)-len(s.buf) < size {
+		grown := make([]byte, len(s.buf), 2*len(s.buf)+size)
+		copy(grown, s.buf)
+		s.buf = grown
+	}
+	n, err := s.reader.Read(s.buf[len(s.buf) : len(s.buf)+size])
+	s.buf = s.buf[:len(s.buf)+n]
+	switch {
+	case err == io.EOF:
+		s.eof = true
+	case err != nil:
+		s.err = err
+		return
+	}
+	s.split()
+}
+
+// split walks the tokens read since the last call, adding the statements they complete. The last token
+// is left for the next call unless the script is over, as it may go on in what is not read yet.
+func (s *StatementScanner) split() {
+	var (
+		sql    = string(s.buf)
+		tokens = s.dialect.tokenize(sql, s.next)
+		end    = len(tokens)
+	)
+	if !s.eof && end > 0 {
+		end--
+	}
+
+	s.next = len(sql)
+	if end < len(tokens) {
+		s.next = tokens[end].pos
+	}
+	for i := 0; i < end; i++ {
+		t := tokens[i]
+		if s.start == -1 {
+			s.start = t.pos
+		}
+		switch {
+		case t.kind == tokenLineComment || t.kind == tokenBlockComment:
+			// MySQL runs the content of /*!...*/ comments
+			if s.dialect.versionComments && strings.HasPrefix(t.text, "/*!") {
+				s.significant = true
+			}
+			continue
+		case t.kind == tokenPunct && t.text == ";" && s.depth == 0:
+			s.add(sql[s.start:t.pos])
+			continue
+		}
+
+		word := ""
+		if t.kind == tokenWord {
+			word = strings.ToUpper(t.text)
+		}
+		if !s.significant {
+			s.significant = true
+			s.create = word == "CREATE"
+		}
+		switch {
+		case s.create && routineKinds[word]:
+			s.routine = true
+		case s.routine && (word == "BEGIN" || word == "CASE"):
+			s.depth++
+		case s.routine && word == "END" && s.depth > 0:
+			if i+1 == end && !s.eof {
+				// whether it closes the block depends on the word that follows
+				s.next = t.pos
+				break
+			}
+			following := ""
+			if i+1 < end && tokens[i+1].kind == tokenWord {
+				following = strings.ToUpper(tokens[i+1].text)
+			}
+			switch {
+			case blockEnds[following]:
+				continue
+			case following == "CASE":
+				// END CASE closes a CASE statement, which must not open another block
+				i++
+			}
+			s.depth--
+		}
+		if s.next == t.pos {
+			break
+		}
+	}
+
+	if s.eof && s.next == len(sql) && s.start != -1 {
+		s.add(sql[s.start:])
+	}
+	// drop what was returned, keeping the statement being read
+	drop := s.next
+	if s.start != -1 {
+		drop = s.start
+		s.start = 0
+	}
+	s.buf = s.buf[:copy(s.buf, s.buf[drop:])]
+	s.next -= drop
+}
+
+// add ends the statement being read, keeping it unless it holds nothing but comments.
+func (s *StatementScanner) add(statement string) {
+	if s.significant {
+		s.statements = append(s.statements, strings.TrimSpace(statement))
+	}
+	s.start = -1
+	s.significant, s.create, s.routine, s.depth = false, false, false, 0
+}
@@ -0,0 +1,411 @@
+package query
+
+import (
+	"strings"
+
+	_sql "github.com/yazeed1s/sqlweb/db/sql"
+)
+
+// systemSchemas lists, per dialect, the schemas owned by the database server itself.
+// Writing to them can break the server or its privileges, so mutations are refused by default.
+var systemSchemas = map[string][]string{
+	strings.ToLower(_sql.MySQL.String()): {
+		"mysql", "sys", "performance_schema", "information_schema",
+	},
+	strings.ToLower(_sql.PostgreSQL.String()): {
+		"pg_catalog", "pg_toast", "information_schema",
+	},
+}
+
+// sqliteSystemPrefix is the prefix SQLite reserves for its internal tables (sqlite_master, sqlite_sequence, ...).
+const sqliteSystemPrefix = "sqlite_"
+
+// IsSystemSchema reports whether the schema belongs to the database server for the given dialect.
+// PostgreSQL's per-session toast schemas (pg_toast_temp_N) are treated like pg_toast.
+func IsSystemSchema(dbType, schema string) bool {
+	dbType = strings.ToLower(dbType)
+	schema = strings.ToLower(schema)
+	for _, name := range systemSchemas[dbType] {
+		if schema == name {
+			return true
+		}
+	}
+	return dbType == strings.ToLower(_sql.PostgreSQL.String()) && strings.HasPrefix(schema, "pg_toast")
+}
+
+// IsSystemTable reports whether the table lives in a system schema, or is one of SQLite's internal tables.
+// An empty table only checks the schema.
+func IsSystemTable(dbType, schema, table string) bool {
+	if strings.ToLower(dbType) == strings.ToLower(_sql.SQLite.String()) {
+		return strings.HasPrefix(strings.ToLower(table), sqliteSystemPrefix)
+	}
+	return IsSystemSchema(dbType, schema)
+}
+
+// clauseWords are the keywords that may follow a table name, and so never name a table or its alias.
+var clauseWords = map[string]bool{
+	"AS": true, "SET": true, "WHERE": true, "USING": true, "ON": true, "FROM": true, "TO": true,
+	"JOIN": true, "INNER": true, "LEFT": true, "RIGHT": true, "FULL": true, "CROSS": true, "OUTER": true,
+	"NATURAL": true, "STRAIGHT_JOIN": true, "ORDER": true, "GROUP": true, "HAVING": true, "LIMIT": true,
+	"RETURNING": true, "VALUES": true, "VALUE": true, "SELECT": true, "PARTITION": true, "DEFAULT": true,
+	"USE": true, "FORCE": true, "IGNORE": true, "WITH": true, "WINDOW": true, "UNION": true, "FOR": true,
+	"ONLY": true, "OF": true, "TABLESAMPLE": true,
+}
+
+// joinWords are the keywords that join a table to the ones before it.
+var joinWords = map[string]bool{
+	"JOIN": true, "INNER": true, "LEFT": true, "RIGHT": true, "FULL": true, "CROSS": true,
+	"OUTER": true, "NATURAL": true, "STRAIGHT_JOIN": true,
+}
+
+// modifierWords are the MySQL keywords that may come between INSERT, UPDATE, DELETE or REPLACE and its table.
+var modifierWords = map[string]bool{
+	"LOW_PRIORITY": true, "HIGH_PRIORITY": true, "DELAYED": true, "QUICK": true, "IGNORE": true, "ONLY": true,
+}
+
+// statementTargets returns the tables and schemas a single statement writes to: the tables of INSERT, UPDATE
+// and DELETE, including MySQL's multi-table forms whose aliases are resolved to their tables, the tables named
+// after TABLE or TRUNCATE, the table of CREATE INDEX ... ON and of COPY ... FROM, and the schemas named
+// after DATABASE or SCHEMA. Tables that are only read, after FROM or JOIN, are left out.
+// Unqualified tables are resolved against defaultSchema; a schema-only target has an empty Table.
+func statementTargets(statement []token, defaultSchema string) []TableRef {
+	var refs []TableRef
+
+	for i := 0; i < len(statement); i++ {
+		var (
+			keyword = wordAt(statement, i)
+			prev    = wordAt(statement, i-1)
+			next    = wordAt(statement, i+1)
+			found   []TableRef
+		)
+
+		switch keyword {
+		case "INSERT", "REPLACE":
+			j := skipWords(statement, i+1, modifierWords)
+			if wordAt(statement, j) == "INTO" {
+				continue
+			}
+			// INSERT t VALUES on MySQL, unless REPLACE is the string function
+			if ref, _, _, ok := tableItem(statement, j, defaultSchema); ok && !punctAt(statement, i+1, "(") {
+				found = []TableRef{ref}
+			}
+		case "INTO":
+			j := i + 1
+			if next == "TABLE" {
+				j++
+			}
+			if ref, _, end, ok := tableItem(statement, j, defaultSchema); ok {
+				found, i = []TableRef{ref}, end-1
+			}
+		case "UPDATE":
+			// FOR UPDATE, ON UPDATE CASCADE, ON DUPLICATE KEY UPDATE, DO UPDATE, GRANT UPDATE ON ...
+			if prev == "FOR" || prev == "KEY" || prev == "DO" || prev == "ON" || next == "ON" || next == "OF" ||
+				punctAt(statement, i+1, ",") || punctAt(statement, i-1, ",") {
+				continue
+			}
+			var end int
+			found, _, end = tableList(statement, skipWords(statement, i+1, modifierWords), defaultSchema, true)
+			i = end - 1
+		case "DELETE":
+			if prev == "ON" || next == "ON" || next == "OF" || punctAt(statement, i+1, ",") || punctAt(statement, i-1, ",") {
+				continue
+			}
+			var end int
+			found, end = deleteTargets(statement, skipWords(statement, i+1, modifierWords), defaultSchema)
+			i = end - 1
+		case "TRUNCATE":
+			j := i + 1
+			if next == "TABLE" {
+				j++
+			}
+			var end int
+			found, _, end = tableList(statement, j, defaultSchema, false)
+			i = end - 1
+		case "TABLE", "TABLES":
+			var end int
+			found, _, end = tableList(statement, skipIfExists(statement, i+1), defaultSchema, false)
+			// RENAME TABLE a TO b, c TO d
+			for wordAt(statement, end) == "TO" {
+				var renamed []TableRef
+				renamed, _, end = tableList(statement, end+1, defaultSchema, false)
+				found = append(found, renamed...)
+			}
+			i = end - 1
+		case "DATABASE", "SCHEMA":
+			j := skipIfExists(statement, i+1)
+			if name, ok := nameAt(statement, j); ok {
+				found = []TableRef{{Schema: name}}
+			}
+		case "INDEX":
+			// the index name, then ON and its table
+			for j := i + 1; j < len(statement) && j < i+6 && !punctAt(statement, j, "("); j++ {
+				if wordAt(statement, j) != "ON" {
+					continue
+				}
+				if ref, _, _, ok := tableItem(statement, j+1, defaultSchema); ok {
+					found = []TableRef{ref}
+				}
+				break
+			}
+		case "COPY":
+			ref, _, end, ok := tableItem(statement, i+1, defaultSchema)
+			if ok && punctAt(statement, end, "(") {
+				end = skipGroup(statement, end)
+			}
+			if ok && wordAt(statement, end) == "FROM" {
+				found = []TableRef{ref}
+			}
+		}
+		refs = append(refs, found...)
+	}
+	return refs
+}
+
+// deleteTargets returns the tables a DELETE writes to, starting after DELETE and its modifiers, and the index
+// after them. The tables named before MySQL's FROM (DELETE t FROM ...) or USING (DELETE FROM t USING ...)
+// may be aliases of the tables that follow it, e.g. DELETE u FROM mysql.user u.
+func deleteTargets(statement []token, i int, defaultSchema string) ([]TableRef, int) {
+	var (
+		refs    []TableRef
+		aliases map[string]TableRef
+		source  bool
+	)
+
+	if wordAt(statement, i) == "FROM" {
+		refs, _, i = tableList(statement, i+1, defaultSchema, false)
+		if wordAt(statement, i) == "USING" && !punctAt(statement, i+1, "(") {
+			_, aliases, i = tableList(statement, i+1, defaultSchema, true)
+			source = true
+		}
+	} else {
+		refs, _, i = tableList(statement, i, defaultSchema, false)
+		if wordAt(statement, i) == "FROM" {
+			_, aliases, i = tableList(statement, i+1, defaultSchema, true)
+			source = true
+		}
+	}
+	if !source {
+		return refs, i
+	}
+	for n, ref := range refs {
+		if aliased, ok := aliases[strings.ToLower(ref.Table)]; ok && ref.Schema == defaultSchema {
+			refs[n] = aliased
+		}
+	}
+	return refs, i
+}
+
+// tableList reads the tables of a list starting at i, separated by commas and, when joins is set, by joins
+// whose ON and USING conditions are skipped. It returns the tables, the tables keyed by their lower-cased
+// aliases and names, and the index of the first token past the list.
+func tableList(statement []token, i int, defaultSchema string, joins bool) ([]TableRef, map[string]TableRef, int) {
+	var (
+		refs    []TableRef
+		aliases = make(map[string]TableRef)
+	)
+
+	for {
+		if punctAt(statement, i, "(") {
+			// a derived table, which is not written to
+			i = skipGroup(statement, i)
+			if _, end, ok := aliasAt(statement, i); ok {
+				i = end
+			}
+		} else {
+			ref, alias, end, ok := tableItem(statement, i, defaultSchema)
+			if !ok {
+				return refs, aliases, i
+			}
+			refs = append(refs, ref)
+			aliases[strings.ToLower(ref.Table)] = ref
+			if alias != "" {
+				aliases[strings.ToLower(alias)] = ref
+			}
+			i = end
+		}
+
+		if joins {
+			i = skipJoinCondition(statement, i)
+		}
+		switch {
+		case punctAt(statement, i, ","):
+			i++
+		case joins && joinWords[wordAt(statement, i)]:
+			i = skipWords(statement, i, joinWords)
+		default:
+			return refs, aliases, i
+		}
+	}
+}
+
+// tableItem reads a table of a list at i along with its alias, e.g. mysql.user AS u, and returns the index after them.
+func tableItem(statement []token, i int, defaultSchema string) (TableRef, string, int, bool) {
+	if wordAt(statement, i) == "ONLY" {
+		i++
+	}
+
+	var parts []string
+	for {
+		name, ok := nameAt(statement, i)
+		if !ok {
+			break
+		}
+		parts = append(parts, name)
+		i++
+		if !punctAt(statement, i, ".") {
+			break
+		}
+		if _, ok = nameAt(statement, i+1); !ok {
+			break
+		}
+		i++
+	}
+	if len(parts) == 0 {
+		return TableRef{}, "", i, false
+	}
+
+	ref := TableRef{Schema: defaultSchema, Table: parts[len(parts)-1]}
+	if len(parts) > 1 {
+		ref.Schema = parts[len(parts)-2]
+	}
+	// t.* in MySQL's multi-table DELETE, t * for the descendant tables on PostgreSQL
+	if punctAt(statement, i, ".") && operatorAt(statement, i+1, "*") {
+		i += 2
+	} else if operatorAt(statement, i, "*") {
+		i++
+	}
+	alias, end, ok := aliasAt(statement, i)
+	if !ok {
+		return ref, "", i, true
+	}
+	return ref, alias, end, true
+}
+
+// aliasAt reads an alias at i, with or without AS, and returns the index after it.
+func aliasAt(statement []token, i int) (string, int, bool) {
+	if wordAt(statement, i) == "AS" {
+		i++
+	}
+	alias, ok := nameAt(statement, i)
+	return alias, i + 1, ok
+}
+
+// skipJoinCondition skips the ON or USING condition of a join at i, up to the next join, comma or clause.
+func skipJoinCondition(statement []token, i int) int {
+	switch wordAt(statement, i) {
+	case "USING":
+		if punctAt(statement, i+1, "(") {
+			return skipGroup(statement, i+1)
+		}
+		return i
+	case "ON":
+		for i++; i < len(statement); i++ {
+			if punctAt(statement, i, "(") {
+				i = skipGroup(statement, i) - 1
+				continue
+			}
+			keyword := wordAt(statement, i)
+			if punctAt(statement, i, ",") || joinWords[keyword] || (clauseWords[keyword] && keyword != "ON") {
+				return i
+			}
+		}
+	}
+	return i
+}
+
+// skipGroup returns the index after the parenthesized group opening at i.
+func skipGroup(statement []token, i int) int {
+	depth := 0
+	for ; i < len(statement); i++ {
+		switch {
+		case punctAt(statement, i, "("):
+			depth++
+		case punctAt(statement, i, ")"):
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return i
+}
+
+// skipIfExists skips IF EXISTS or IF NOT EXISTS at i.
+func skipIfExists(statement []token, i int) int {
+	if wordAt(statement, i) != "IF" {
+		return i
+	}
+	i++
+	if wordAt(statement, i) == "NOT" {
+		i++
+	}
+	if wordAt(statement, i) == "EXISTS" {
+		i++
+	}
+	return i
+}
+
+// skipWords skips the tokens at i that are one of the keywords.
+func skipWords(statement []token, i int, keywords map[string]bool) int {
+	for keywords[wordAt(statement, i)] {
+		i++
+	}
+	return i
+}
+
+// nameAt returns the unquoted identifier at i, unless the token there is not one or is a clause keyword.
+func nameAt(statement []token, i int) (string, bool) {
+	if i < 0 || i >= len(statement) {
+		return "", false
+	}
+	switch t := statement[i]; t.kind {
+	case tokenQuoted:
+		return unquoteIdentifier(t.text), true
+	case tokenWord:
+		return t.text, !clauseWords[strings.ToUpper(t.text)]
+	}
+	return "", false
+}
+
+// wordAt returns the word at i upper-cased, or "" when the token there is not a word.
+func wordAt(statement []token, i int) string {
+	if i < 0 || i >= len(statement) || statement[i].kind != tokenWord {
+		return ""
+	}
+	return strings.ToUpper(statement[i].text)
+}
+
+// punctAt reports whether the token at i is the punctuation p.
+func punctAt(statement []token, i int, p string) bool {
+	return i >= 0 && i < len(statement) && statement[i].kind == tokenPunct && statement[i].text == p
+}
+
+// operatorAt reports whether the token at i is the operator op.
+func operatorAt(statement []token, i int, op string) bool {
+	return i >= 0 && i < len(statement) && statement[i].kind == tokenOperator && statement[i].text == op
+}
+
+// SystemTargets returns the system tables and schemas that the writing statements of the query target.
+// Read-only statements are skipped, so selecting from information_schema is never reported.
+// Each target is returned once, in order of first appearance.
+func SystemTargets(dbType, defaultSchema, query string) []TableRef {
+	var (
+		refs []TableRef
+		seen map[TableRef]bool
+	)
+
+	seen = make(map[TableRef]bool)
+	for _, statement := range splitStatements(dbType, query) {
+		if isReadOnly(statement) {
+			continue
+		}
+		for _, ref := range statementTargets(statement, defaultSchema) {
+			if seen[ref] || !IsSystemTable(dbType, ref.Schema, ref.Table) {
+				continue
+			}
+			seen[ref] = true
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
@@ -0,0 +1,112 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	_sql "github.com/yazeed1s/sqlweb/db/sql"
+	"github.com/yazeed1s/sqlweb/pkg/util"
+)
+
+// temporalKind is how a column stores dates and times, and so how a value written to it is formatted.
+type temporalKind int
+
+const (
+	notTemporal temporalKind = iota
+	// dateColumn stores a calendar date
+	dateColumn
+	// timestampColumn stores a date and time of day without a time zone
+	timestampColumn
+	// zonedColumn stores an instant: PostgreSQL's timestamp with time zone and MySQL's TIMESTAMP,
+	// both of which read a value without an offset in the time zone of the session
+	zonedColumn
+)
+
+// zonedLayouts are the layouts of values with a UTC offset, tried before localLayouts.
+// Fractional seconds are accepted after the seconds of any of them.
+var zonedLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05-07",
+	"2006-01-02T15:04:05-07",
+}
+
+// localLayouts are the layouts of values without a UTC offset.
+var localLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// columnTemporalKind returns how a column of the given data type stores dates and times. Times of day
+// and years are not handled: they are written as given.
+func columnTemporalKind(dbType, dataType string) temporalKind {
+	lowerCase := strings.ToLower(strings.TrimSpace(dataType))
+	switch {
+	case strings.HasPrefix(lowerCase, "timestamptz"),
+		strings.Contains(lowerCase, "timestamp") && strings.Contains(lowerCase, "with time zone") && !strings.Contains(lowerCase, "without"):
+		return zonedColumn
+	case strings.HasPrefix(lowerCase, "timestamp") && strings.EqualFold(dbType, _sql.MySQL.String()):
+		return zonedColumn
+	case strings.HasPrefix(lowerCase, "timestamp"), strings.HasPrefix(lowerCase, "datetime"):
+		return timestampColumn
+	case lowerCase == "date":
+		return dateColumn
+	}
+	return notTemporal
+}
+
+// parseTemporal parses a date or timestamp in one of zonedLayouts or localLayouts,
+// and reports whether it carried a UTC offset.
+func parseTemporal(value string) (time.Time, bool, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range zonedLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true, nil
+		}
+	}
+	for _, layout := range localLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, false, nil
+		}
+	}
+	return time.Time{}, false, fmt.Errorf("%q: %w", value, util.ErrInvalidTime)
+}
+
+// temporalValue returns the SQL expression writing a date or timestamp to a column, and the argument bound to
+// its placeholder. The value is bound in a canonical format so that the database does not have to guess at the input.
+// A value without an offset is a wall clock time and is written as given. A value with an offset is an instant:
+// zone-less columns get it in UTC, PostgreSQL's zoned columns get the offset along with it, and MySQL's
+// TIMESTAMP gets it as a Unix time, which FROM_UNIXTIME turns into the session time zone it reads values in.
+// Dates are written as given, and refused when they carry a time of day. MySQL's zero date, 0000-00-00, is
+// passed through for the server to accept or refuse under its sql_mode.
+func temporalValue(dbType string, kind temporalKind, value, placeholder string) (string, string, error) {
+	const layout = "2006-01-02 15:04:05.999999"
+
+	t, zoned, err := parseTemporal(value)
+	if err != nil {
+		if zero := strings.TrimSpace(value); strings.EqualFold(dbType, _sql.MySQL.String()) && strings.HasPrefix(zero, "0000-00-00") {
+			return placeholder, zero, nil
+		}
+		return "", "", err
+	}
+
+	switch {
+	case kind == dateColumn:
+		if t.Hour() != 0 || t.Minute() != 0 || t.Second() != 0 || t.Nanosecond() != 0 {
+			return "", "", fmt.Errorf("%q has a time of day: %w", value, util.ErrInvalidTime)
+		}
+		return placeholder, t.Format("2006-01-02"), nil
+	case !zoned:
+		return placeholder, t.Format(layout), nil
+	case kind == zonedColumn && strings.EqualFold(dbType, _sql.PostgreSQL.String()):
+		return placeholder, t.Format(layout + "-07:00"), nil
+	case kind == zonedColumn && strings.EqualFold(dbType, _sql.MySQL.String()):
+		return fmt.Sprintf("FROM_UNIXTIME(%s)", placeholder), fmt.Sprintf("%d.%06d", t.Unix(), t.Nanosecond()/1000), nil
+	default:
+		return placeholder, t.UTC().Format(layout), nil
+	}
+}
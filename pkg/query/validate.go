@@ -0,0 +1,214 @@
+package query
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+	_sql "github.com/yazeed1s/sqlweb/db/sql"
+	_client "github.com/yazeed1s/sqlweb/pkg/client"
+	"github.com/yazeed1s/sqlweb/pkg/util"
+)
+
+// Validation is the outcome of checking a query without running it.
+// Position, Line and Column locate the error when the database reports where it is, and are 0 otherwise.
+type Validation struct {
+	Valid bool   `json:"valid"`
+	Error string `json:"error,omitempty"`
+	// Position is the 1-based character offset of the error in the query
+	Position int `json:"position,omitempty"`
+	Line     int `json:"line,omitempty"`
+	Column   int `json:"column,omitempty"`
+}
+
+// postgresPreparable are the statements PostgreSQL accepts in PREPARE.
+var postgresPreparable = toSet("SELECT", "INSERT", "UPDATE", "DELETE", "VALUES", "WITH", "MERGE", "TABLE")
+
+// ValidateQuery checks the syntax of a query, and that the objects it names exist, without running it:
+// MySQL and PostgreSQL prepare it with PREPARE and deallocate it, and SQLite compiles it without stepping.
+// Errors reported by the database make the query invalid; the returned error is for anything else.
+//
+// Only one statement is checked, and util.ErrSingleStatement is returned for a query holding several:
+// PostgreSQL's PREPARE goes through the simple query protocol, which would run the statements after the first.
+// PostgreSQL can only prepare SELECT, INSERT, UPDATE, DELETE and VALUES (including WITH), and
+// util.ErrNotPreparable is returned for anything else.
+func ValidateQuery(sqlQuery string, client *_client.Client) (*Validation, error) {
+	if err := checkDatabaseConnection(client.Database); err != nil {
+		return nil, err
+	}
+
+	var (
+		err  error
+		ctx  context.Context
+		conn *sql.Conn
+	)
+
+	// a trailing semicolon is not part of the statement, and MySQL's PREPARE refuses it
+	sqlQuery = strings.TrimRight(sqlQuery, "; \t\r\n")
+	statements := splitStatements(client.Type.String(), sqlQuery)
+	if len(statements) > 1 {
+		return nil, util.ErrSingleStatement
+	}
+	ctx = context.Background()
+	// the prepared statement is named, so it is prepared and deallocated on a connection of its own
+	conn, err = client.Database.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func(conn *sql.Conn) {
+		err := conn.Close()
+		if err != nil {
+			return
+		}
+	}(conn)
+
+	switch strings.ToLower(client.Type.String()) {
+	case strings.ToLower(_sql.MySQL.String()):
+		if client.Schema.Name != "" {
+			_, err = conn.ExecContext(ctx, fmt.Sprintf(_sql.MySQLUse, _client.QuoteIdentifier(client.Type.String(), client.Schema.Name)))
+			if err != nil {
+				return nil, err
+			}
+		}
+		_, err = conn.ExecContext(ctx, _sql.MySQLSetValidate, sqlQuery)
+		if err != nil {
+			return nil, err
+		}
+		_, err = conn.ExecContext(ctx, _sql.MySQLPrepareValidate)
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) {
+			return mysqlValidation(sqlQuery, mysqlErr), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		_, err = conn.ExecContext(ctx, _sql.MySQLDeallocateValidate)
+		if err != nil {
+			return nil, err
+		}
+		return &Validation{Valid: true}, nil
+
+	case strings.ToLower(_sql.PostgreSQL.String()):
+		if len(statements) == 0 || !postgresPreparable[firstKeyword(statements[0])] {
+			return nil, util.ErrNotPreparable
+		}
+		if client.Schema.Name != "" {
+			_, err = conn.ExecContext(ctx, fmt.Sprintf(_sql.PostgreSQLSetSearchPath, pq.QuoteIdentifier(client.Schema.Name)))
+			if err != nil {
+				return nil, err
+			}
+			defer resetSearchPath(conn)
+		}
+		_, err = conn.ExecContext(ctx, _sql.PostgreSQLPrepareValidate+sqlQuery)
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) {
+			return postgresValidation(sqlQuery, pqErr), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		_, err = conn.ExecContext(ctx, _sql.PostgreSQLDeallocateValidate)
+		if err != nil {
+			return nil, err
+		}
+		return &Validation{Valid: true}, nil
+
+	case strings.ToLower(_sql.SQLite.String()):
+		var stmt *sql.Stmt
+		stmt, err = conn.PrepareContext(ctx, sqlQuery)
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) {
+			return sqliteValidation(sqlQuery, err), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err = stmt.Close(); err != nil {
+			return nil, err
+		}
+		return &Validation{Valid: true}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported database type: %s", client.Type.String())
+}
+
+// mysqlNearPattern matches where MySQL says a syntax error is, e.g. "near 'FORM t' at line 1".
+var mysqlNearPattern = regexp.MustCompile(`(?s)near '(.*)' at line (\d+)$`)
+
+// mysqlValidation locates the error from the text MySQL quotes after "near", which is the start
+// of the rest of the query on the reported line, truncated.
+func mysqlValidation(sqlQuery string, e *mysql.MySQLError) *Validation {
+	v := &Validation{Error: e.Error()}
+	match := mysqlNearPattern.FindStringSubmatch(e.Message)
+	if match == nil {
+		return v
+	}
+	line, _ := strconv.Atoi(match[2])
+	lines := strings.SplitAfter(sqlQuery, "\n")
+	if line < 1 || line > len(lines) {
+		return v
+	}
+	start := len(strings.Join(lines[:line-1], ""))
+	if match[1] == "" {
+		return v.at(sqlQuery, len(sqlQuery))
+	}
+	if i := strings.Index(sqlQuery[start:], match[1]); i != -1 {
+		return v.at(sqlQuery, start+i)
+	}
+	return v
+}
+
+// postgresValidation locates the error from its position, which counts characters of the PREPARE statement.
+func postgresValidation(sqlQuery string, e *pq.Error) *Validation {
+	v := &Validation{Error: e.Error()}
+	position, err := strconv.Atoi(e.Position)
+	if err != nil {
+		return v
+	}
+	offset := position - 1 - utf8.RuneCountInString(_sql.PostgreSQLPrepareValidate)
+	if offset < 0 {
+		return v
+	}
+	runes := []rune(sqlQuery)
+	if offset > len(runes) {
+		offset = len(runes)
+	}
+	return v.at(sqlQuery, len(string(runes[:offset])))
+}
+
+// sqliteNearPattern matches the token SQLite names in a syntax error, e.g. `near "SELEC": syntax error`.
+var sqliteNearPattern = regexp.MustCompile(`near "(.*)": syntax error`)
+
+// sqliteValidation locates the error at the first occurrence of the token SQLite complains about,
+// or at the end of the query when the input is incomplete.
+func sqliteValidation(sqlQuery string, e error) *Validation {
+	v := &Validation{Error: e.Error()}
+	if strings.Contains(e.Error(), "incomplete input") {
+		return v.at(sqlQuery, len(sqlQuery))
+	}
+	match := sqliteNearPattern.FindStringSubmatch(e.Error())
+	if match == nil {
+		return v
+	}
+	if i := strings.Index(sqlQuery, match[1]); i != -1 {
+		return v.at(sqlQuery, i)
+	}
+	return v
+}
+
+// at sets the position of the error to the byte offset in the query.
+func (v *Validation) at(sqlQuery string, offset int) *Validation {
+	before := sqlQuery[:offset]
+	v.Position = utf8.RuneCountInString(before) + 1
+	v.Line = strings.Count(before, "\n") + 1
+	v.Column = utf8.RuneCountInString(before[strings.LastIndex(before, "\n")+1:]) + 1
+	return v
+}
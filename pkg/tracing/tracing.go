@@ -0,0 +1,132 @@
+// Package tracing traces requests and the database calls they make with OpenTelemetry. Spans are
+// exported over OTLP once Setup is given an endpoint; until then the tracer does nothing.
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation scope of the spans.
+const tracerName = "github.com/yazeed1s/sqlweb"
+
+// Attributes of the database spans, beyond the semantic conventions.
+const (
+	// RowsAttribute is the number of rows a query read or changed
+	RowsAttribute = attribute.Key("db.rows")
+	// TableAttribute is the table a query reads, when it reads a single known table
+	TableAttribute = attribute.Key("db.sql.table")
+)
+
+// Setup exports the spans over OTLP/HTTP to the endpoint, e.g. "http://localhost:4318", or to the one of the
+// OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT environment variables when it is empty.
+// With neither, tracing stays off. The returned function flushes the pending spans and stops exporting.
+func Setup(ctx context.Context, endpoint string) (func(context.Context) error, error) {
+	var options []otlptracehttp.Option
+
+	if endpoint != "" {
+		options = append(options, otlptracehttp.WithEndpointURL(endpoint))
+	} else if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName("sqlweb")))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
+
+// tracer returns the tracer of the registered provider, which does nothing until Setup registers one.
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// StartQuery starts the span of a database call, a child of the span of ctx, e.g. the one of the request
+// running it. The kind is the leading keyword of the statement, the table is left out when empty.
+func StartQuery(ctx context.Context, name, dbSystem, kind, table string) (context.Context, trace.Span) {
+	attributes := []attribute.KeyValue{semconv.DBSystemKey.String(dbSystem), semconv.DBOperationName(kind)}
+	if table != "" {
+		attributes = append(attributes, TableAttribute.String(table))
+	}
+	return tracer().Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attributes...))
+}
+
+// EndQuery ends the span of a database call with the number of rows it read or changed, or its error.
+func EndQuery(span trace.Span, rows int64, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else {
+		span.SetAttributes(RowsAttribute.Int64(rows))
+	}
+	span.End()
+}
+
+// statusWriter records the status code of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to flush a download.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Route wraps the handler of a route in a server span named after its method and path, continuing the
+// trace of the request when it carries one. Responses with a 5xx status mark the span as failed.
+func Route(method, path string, next http.HandlerFunc) http.HandlerFunc {
+	name := method + " " + path
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer().Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPRoute(path), semconv.HTTPRequestMethodKey.String(r.Method)),
+		)
+		defer span.End()
+
+		writer := &statusWriter{ResponseWriter: w}
+		next(writer, r.WithContext(ctx))
+
+		if writer.status == 0 {
+			writer.status = http.StatusOK
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(writer.status))
+		if writer.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(writer.status))
+		}
+	}
+}
@@ -3,5 +3,31 @@ package util
 import "errors"
 
 var (
-	ErrUnmarshalJSONClient = errors.New("Error Unmarshalling JSON ")
+	ErrUnmarshalJSONClient   = errors.New("Error Unmarshalling JSON ")
+	ErrReadOnly              = errors.New("sqlweb is running in read-only mode")
+	ErrCommentsUnsupported   = errors.New("database does not support table or column comments")
+	ErrColumnNotWritable     = errors.New("column is generated and cannot be edited")
+	ErrEmptyFilter           = errors.New("a non-empty filter is required")
+	ErrSchemaChanged         = errors.New("table structure changed since it was loaded")
+	ErrSystemSchema          = errors.New("refusing to modify a system schema without confirmation")
+	ErrConfirmation          = errors.New("refusing a destructive operation without confirmation")
+	ErrNotPreparable         = errors.New("only SELECT, INSERT, UPDATE, DELETE and VALUES statements can be validated on PostgreSQL")
+	ErrMultiStatements       = errors.New("multi-statement scripts are disabled for MySQL connections")
+	ErrNoCreateDatabase      = errors.New("CREATE DATABASE is not supported for SQLite: a database is a file, connect to a new path to create one")
+	ErrNoDropDatabase        = errors.New("DROP DATABASE is not supported for SQLite: a database is a file, delete it to drop it")
+	ErrDropConnectedDatabase = errors.New("cannot drop the database of the current connection, connect to another database such as postgres first")
+	ErrStatementTimeout      = errors.New("statement timed out")
+	ErrColumnProtected       = errors.New("column is protected by the connection and cannot be edited")
+	ErrResultTooLarge        = errors.New("result is too large to display")
+	ErrInvalidTime           = errors.New("value is not a valid date or timestamp")
+	ErrPolicyViolation       = errors.New("column is excluded from exports by the connection")
+	ErrView                  = errors.New("views cannot be truncated or edited")
+	ErrUnknownCollation      = errors.New("unknown collation")
+	ErrMissingParams         = errors.New("missing values for parameters")
+	ErrExecutionToken        = errors.New("execution token is unknown, expired, already used or issued for another statement")
+	ErrSingleStatement       = errors.New("only a single statement can be checked without running it")
+	ErrNotExplainable        = errors.New("only SELECT, INSERT, UPDATE, DELETE, REPLACE, MERGE and VALUES statements can be explained")
+	ErrTooManyUploads        = errors.New("too many uploads in progress, complete or wait for one of them")
+	ErrUploadReserve         = errors.New("the uploads in progress already hold as many bytes as allowed")
+	ErrScriptInSafeMode      = errors.New("scripts cannot run in safe mode, send their statements to /execute one at a time")
 )